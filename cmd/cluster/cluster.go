@@ -51,6 +51,10 @@ func NewCmdCluster() *cobra.Command {
 		NewCmdClusterRestart(),
 		NewCmdClusterList(),
 		NewCmdClusterEdit(),
+		NewCmdClusterApply(),
+		NewCmdClusterUpgrade(),
+		NewCmdClusterSnapshot(),
+		NewCmdClusterRestore(),
 	)
 
 	// add flags
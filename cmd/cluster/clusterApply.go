@@ -0,0 +1,139 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cluster
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/k3d-io/k3d/v5/cmd/util"
+	cliconfig "github.com/k3d-io/k3d/v5/cmd/util/config"
+	"github.com/k3d-io/k3d/v5/pkg/client"
+	"github.com/k3d-io/k3d/v5/pkg/config"
+	l "github.com/k3d-io/k3d/v5/pkg/logger"
+	"github.com/k3d-io/k3d/v5/pkg/runtimes"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+// NewCmdClusterApply returns a new cobra command
+func NewCmdClusterApply() *cobra.Command {
+	var configFile string
+	var dryRun bool
+	var timeout time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "apply [NAME] --config FILE",
+		Short: "Apply a config file to an existing cluster",
+		Long: `Apply a config file (kind: Simple) to an existing cluster.
+Nodes are added, deleted or replaced (keeping their k3s state) until the cluster matches the config.
+Settings that can only be set on cluster creation (network, token, API port, ...) cannot be changed.`,
+		Args:              cobra.RangeArgs(0, 1),
+		ValidArgsFunction: util.ValidArgsAvailableClusters,
+		Run: func(cmd *cobra.Command, args []string) {
+			cfgViper := viper.New()
+			if err := cliconfig.InitViperWithConfigFile(cfgViper, configFile); err != nil {
+				l.Log().Fatalf("Failed to read config file '%s': %v", configFile, err)
+			}
+			simpleCfg, err := config.SimpleConfigFromViper(cfgViper)
+			if err != nil {
+				l.Log().Fatalln(err)
+			}
+			if err := cliconfig.SelectRuntime(simpleCfg); err != nil {
+				l.Log().Fatalln(err)
+			}
+			if len(args) != 0 {
+				simpleCfg.Name = args[0]
+			}
+			if simpleCfg.Name == "" {
+				simpleCfg.Name = k3d.DefaultClusterName
+			}
+
+			cluster, err := client.ClusterGet(cmd.Context(), runtimes.SelectedRuntime, &k3d.Cluster{Name: simpleCfg.Name})
+			if err != nil {
+				l.Log().Fatalf("Failed to get cluster '%s': %v", simpleCfg.Name, err)
+			}
+
+			if err := config.ProcessSimpleConfig(&simpleCfg); err != nil {
+				l.Log().Fatalf("error processing/sanitizing simple config: %v", err)
+			}
+			clusterConfig, err := config.TransformSimpleToClusterConfig(cmd.Context(), runtimes.SelectedRuntime, simpleCfg, configFile)
+			if err != nil {
+				l.Log().Fatalln(err)
+			}
+			clusterConfig, err = config.ProcessClusterConfig(*clusterConfig)
+			if err != nil {
+				l.Log().Fatalf("error processing cluster configuration: %v", err)
+			}
+
+			plan, err := client.ClusterPlan(cmd.Context(), runtimes.SelectedRuntime, cluster, clusterConfig)
+			if err != nil {
+				l.Log().Fatalln(err)
+			}
+			if plan.IsEmpty() {
+				l.Log().Infof("Cluster '%s' is up to date", cluster.Name)
+				return
+			}
+			printClusterApplyPlan(plan)
+			if dryRun {
+				return
+			}
+
+			if err := client.ClusterApply(cmd.Context(), runtimes.SelectedRuntime, cluster, plan, k3d.ClusterApplyOpts{Timeout: timeout}); err != nil {
+				l.Log().Fatalf("Failed to apply config to cluster '%s': %v", cluster.Name, err)
+			}
+			l.Log().Infof("Successfully applied config to cluster '%s'", cluster.Name)
+		},
+	}
+
+	cmd.Flags().StringVarP(&configFile, "config", "c", "", "Path of the config file to apply")
+	if err := cmd.MarkFlagRequired("config"); err != nil {
+		l.Log().Fatalln("Failed to mark flag 'config' as required")
+	}
+	if err := cmd.MarkFlagFilename("config", "yaml", "yml"); err != nil {
+		l.Log().Fatalln("Failed to mark flag 'config' as filename flag")
+	}
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Only print the changes that would be made to the cluster")
+	cmd.Flags().DurationVar(&timeout, "timeout", 0*time.Second, "Maximum waiting time for each added node to be ready before failing/returning.")
+
+	return cmd
+}
+
+// printClusterApplyPlan prints the planned actions, one per line, followed by their changes
+func printClusterApplyPlan(plan *k3d.ClusterApplyPlan) {
+	symbols := map[k3d.ClusterApplyActionType]string{
+		k3d.ClusterApplyActionAddNode:            "+",
+		k3d.ClusterApplyActionReplaceNode:        "~",
+		k3d.ClusterApplyActionDeleteNode:         "-",
+		k3d.ClusterApplyActionUpdateLoadbalancer: "~",
+		k3d.ClusterApplyActionConnectRegistry:    "+",
+		k3d.ClusterApplyActionDisconnectRegistry: "-",
+	}
+	for _, action := range plan.Actions {
+		fmt.Printf("%s %s %s (%s)\n", symbols[action.Type], action.Role, action.Target, action.Type)
+		for _, change := range action.Changes {
+			fmt.Printf("    %s\n", change)
+		}
+	}
+}
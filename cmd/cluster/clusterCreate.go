@@ -110,6 +110,11 @@ func NewCmdClusterCreate() *cobra.Command {
 
 			l.Log().Debugf("========== Merged Simple Config ==========\n%+v\n==========================\n", simpleCfg)
 
+			// the runtime and its connection settings may be set in the config file, unless they were set via flags or environment variable
+			if err := cliconfig.SelectRuntime(simpleCfg); err != nil {
+				l.Log().Fatalln(err)
+			}
+
 			/**************************************
 			 * Transform, Process & Validate Configuration *
 			 **************************************/
@@ -239,7 +244,7 @@ func NewCmdClusterCreate() *cobra.Command {
 	cmd.Flags().StringArrayP("volume", "v", nil, "Mount volumes into the nodes (Format: `[SOURCE:]DEST[@NODEFILTER[;NODEFILTER...]]`\n - Example: `k3d cluster create --agents 2 -v /my/path@agent:0,1 -v /tmp/test:/tmp/other@server:0`")
 	_ = ppViper.BindPFlag("cli.volumes", cmd.Flags().Lookup("volume"))
 
-	cmd.Flags().StringArrayP("port", "p", nil, "Map ports from the node containers (via the serverlb) to the host (Format: `[HOST:][HOSTPORT:]CONTAINERPORT[/PROTOCOL][@NODEFILTER]`)\n - Example: `k3d cluster create --agents 2 -p 8080:80@agent:0 -p 8081@agent:1`")
+	cmd.Flags().StringArrayP("port", "p", nil, "Map ports from the node containers (via the serverlb) to the host (Format: `[HOST:][HOSTPORT:]CONTAINERPORT[/PROTOCOL][@NODEFILTER]`)\n - Example: `k3d cluster create --agents 2 -p 8080:80@agent:0 -p 8081@agent:1`\n - Use the `proxyprotocol` suffix to pass the client address on via the PROXY protocol: `-p 8443:443@loadbalancer:proxyprotocol`")
 	_ = ppViper.BindPFlag("cli.ports", cmd.Flags().Lookup("port"))
 
 	cmd.Flags().StringArrayP("k3s-node-label", "", nil, "Add label to k3s node (Format: `KEY[=VALUE][@NODEFILTER[;NODEFILTER...]]`\n - Example: `k3d cluster create --agents 2 --k3s-node-label \"my.label@agent:0,1\" --k3s-node-label \"other.label=somevalue@server:0\"`")
@@ -251,12 +256,21 @@ func NewCmdClusterCreate() *cobra.Command {
 	cmd.Flags().StringArrayP("runtime-ulimit", "", nil, "Add ulimit to container runtime (Format: `NAME[=SOFT]:[HARD]`\n - Example: `k3d cluster create --agents 2 --runtime-ulimit \"nofile=1024:1024\" --runtime-ulimit \"noproc=1024:1024\"`")
 	_ = ppViper.BindPFlag("cli.runtime-ulimits", cmd.Flags().Lookup("runtime-ulimit"))
 
+	cmd.Flags().StringArray("cpuset", nil, "Pin nodes to CPUs of the host (Format: `CPUS[@NODEFILTER[;NODEFILTER...]]`)\n - Example: `k3d cluster create --agents 2 --cpuset \"0-1@server:*\" --cpuset \"2,3@agent:*\"`")
+	_ = ppViper.BindPFlag("cli.cpusets", cmd.Flags().Lookup("cpuset"))
+
 	cmd.Flags().String("registry-create", "", "Create a k3d-managed registry and connect it to the cluster (Format: `NAME[:HOST][:HOSTPORT]`\n - Example: `k3d cluster create --registry-create mycluster-registry:0.0.0.0:5432`")
 	_ = ppViper.BindPFlag("cli.registries.create", cmd.Flags().Lookup("registry-create"))
 
 	cmd.Flags().Bool("enforce-registry-port-match", false, "Make the internal registry port match the external one")
 	_ = ppViper.BindPFlag("cli.registries.create.enforcePortMatch", cmd.Flags().Lookup("enforce-registry-port-match"))
 
+	cmd.Flags().Bool("registry-create-tls", false, "Serve the registry created via --registry-create via https with a certificate signed by a generated CA")
+	_ = ppViper.BindPFlag("cli.registries.create.tls", cmd.Flags().Lookup("registry-create-tls"))
+
+	cmd.Flags().StringArray("registry-mirror", nil, "Create a k3d-managed pull-through cache for an upstream registry and use it as a mirror in the cluster (Format: `URL` or `REGISTRY`)\n - Example: `k3d cluster create --registry-mirror docker.io --registry-mirror https://ghcr.io`")
+	_ = ppViper.BindPFlag("cli.registries.mirrors", cmd.Flags().Lookup("registry-mirror"))
+
 	cmd.Flags().StringArray("host-alias", nil, "Add `ip:host[,host,...]` mappings")
 	_ = ppViper.BindPFlag("hostaliases", cmd.Flags().Lookup("host-alias"))
 
@@ -321,6 +335,12 @@ func NewCmdClusterCreate() *cobra.Command {
 	cmd.Flags().String("agents-memory", "", "Memory limit imposed on the agents nodes [From docker]")
 	_ = cfgViper.BindPFlag("options.runtime.agentsmemory", cmd.Flags().Lookup("agents-memory"))
 
+	cmd.Flags().String("servers-cpus", "", "Number of CPUs (fractional) the server nodes may use [From docker]")
+	_ = cfgViper.BindPFlag("options.runtime.serverscpus", cmd.Flags().Lookup("servers-cpus"))
+
+	cmd.Flags().String("agents-cpus", "", "Number of CPUs (fractional) the agent nodes may use [From docker]")
+	_ = cfgViper.BindPFlag("options.runtime.agentscpus", cmd.Flags().Lookup("agents-cpus"))
+
 	cmd.Flags().Bool("host-pid-mode", false, "Enable host pid mode of server(s) and agent(s)")
 	_ = cfgViper.BindPFlag("options.runtime.hostpidmode", cmd.Flags().Lookup("host-pid-mode"))
 
@@ -339,9 +359,15 @@ func NewCmdClusterCreate() *cobra.Command {
 	}
 
 	/* Loadbalancer / Proxy */
+	cmd.Flags().String("lb-mode", "", fmt.Sprintf("Implementation of the loadbalancers (one of %v): nginx (default) or native, a tcp/udp proxy built into k3d without support for HTTP(S) routes", k3d.LoadbalancerModes))
+	_ = cfgViper.BindPFlag("options.k3d.loadbalancer.mode", cmd.Flags().Lookup("lb-mode"))
+
 	cmd.Flags().StringSlice("lb-config-override", nil, "Use dotted YAML path syntax to override nginx loadbalancer settings")
 	_ = cfgViper.BindPFlag("options.k3d.loadbalancer.configoverrides", cmd.Flags().Lookup("lb-config-override"))
 
+	cmd.Flags().StringArray("lb-route", nil, "Route HTTP(S) requests for a hostname from the loadbalancer to a port on the nodes (Format: `host=HOST,port=PORT[,path=PATH][,listen=[HOST:][HOSTPORT:]CONTAINERPORT][,cert=FILE,key=FILE][@NODEFILTER[;NODEFILTER...]]`)\n - Example: `k3d cluster create --agents 2 --lb-route \"host=app.localhost,port=30080,listen=8080:80@agent:*\"`")
+	_ = ppViper.BindPFlag("cli.lb-routes", cmd.Flags().Lookup("lb-route"))
+
 	/* Subcommands */
 
 	// done
@@ -411,7 +437,7 @@ func applyCLIOverrides(cfg conf.SimpleConfig) (conf.SimpleConfig, error) {
 			l.Log().Fatalln(err)
 		}
 
-		if strings.Contains(volume, k3d.DefaultRegistriesFilePath) && (cfg.Registries.Create != nil || cfg.Registries.Config != "" || len(cfg.Registries.Use) != 0) {
+		if strings.Contains(volume, k3d.DefaultRegistriesFilePath) && (cfg.Registries.Create != nil || cfg.Registries.Config != "" || len(cfg.Registries.Use) != 0 || len(cfg.Registries.Mirrors) != 0) {
 			l.Log().Warnf("Seems like you're mounting a file at '%s' while also using a referenced registries config or k3d-managed registries: Your mounted file will probably be overwritten!", k3d.DefaultRegistriesFilePath)
 		}
 
@@ -440,6 +466,9 @@ func applyCLIOverrides(cfg conf.SimpleConfig) (conf.SimpleConfig, error) {
 		if err != nil {
 			l.Log().Fatalln(err)
 		}
+		if _, err := cliutil.ValidatePortMap(portmap); err != nil {
+			l.Log().Fatalln(err)
+		}
 
 		// create new entry or append filter to existing entry
 		if _, exists := portFilterMap[portmap]; exists {
@@ -518,6 +547,29 @@ func applyCLIOverrides(cfg conf.SimpleConfig) (conf.SimpleConfig, error) {
 		cfg.Options.Runtime.Ulimits = append(cfg.Options.Runtime.Ulimits, *cliutil.ParseRuntimeUlimit[conf.Ulimit](ulimit))
 	}
 
+	// --cpuset
+	// the order matters here, as a later cpuset overrides an earlier one for the same node
+	for _, cpusetFlag := range ppViper.GetStringSlice("cli.cpusets") {
+		cpuset, nodeFilters, err := cliutil.SplitFiltersFromFlag(cpusetFlag)
+		if err != nil {
+			l.Log().Fatalln(err)
+		}
+
+		cfg.Options.Runtime.CPUSets = append(cfg.Options.Runtime.CPUSets, conf.CPUSetWithNodeFilters{
+			CPUSet:      cpuset,
+			NodeFilters: nodeFilters,
+		})
+	}
+
+	// --lb-route
+	for _, routeFlag := range ppViper.GetStringSlice("cli.lb-routes") {
+		route, err := cliutil.ParseLoadbalancerRouteFlag(routeFlag)
+		if err != nil {
+			l.Log().Fatalln(err)
+		}
+		cfg.Options.K3dOptions.Loadbalancer.Routes = append(cfg.Options.K3dOptions.Loadbalancer.Routes, *route)
+	}
+
 	// --env
 	// envFilterMap will add container env vars to applied node filters
 	envFilterMap := make(map[string][]string, 1)
@@ -577,6 +629,7 @@ func applyCLIOverrides(cfg conf.SimpleConfig) (conf.SimpleConfig, error) {
 			cfg.Registries.Create = &conf.SimpleConfigRegistryCreateConfig{}
 		}
 		cfg.Registries.Create.EnforcePortMatch = ppViper.GetBool("cli.registries.create.enforcePortMatch")
+		cfg.Registries.Create.TLS = cfg.Registries.Create.TLS || ppViper.GetBool("cli.registries.create.tls")
 		cfg.Registries.Create.Name = fvSplit[0]
 		if len(fvSplit) > 1 {
 			exposeAPI, err = cliutil.ParsePortExposureSpec(fvSplit[1], k3d.DefaultRegistryPort, cfg.Registries.Create.EnforcePortMatch)
@@ -588,6 +641,13 @@ func applyCLIOverrides(cfg conf.SimpleConfig) (conf.SimpleConfig, error) {
 		}
 	}
 
+	// --registry-mirror
+	for _, upstream := range ppViper.GetStringSlice("cli.registries.mirrors") {
+		cfg.Registries.Mirrors = append(cfg.Registries.Mirrors, conf.SimpleConfigRegistryCreateConfig{
+			Proxy: k3d.RegistryProxy{RemoteURL: upstream},
+		})
+	}
+
 	// --host-alias
 	hostAliasFlags := ppViper.GetStringSlice("hostaliases")
 	if len(hostAliasFlags) > 0 {
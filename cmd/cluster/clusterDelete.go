@@ -60,7 +60,19 @@ func initClusterDeleteConfig() error {
 		l.Log().Debugf("Additional CLI Configuration:\n%s", c)
 	}
 
-	return cliconfig.InitViperWithConfigFile(clusterDeleteCfgViper, clusterDeletePpViper.GetString("config"))
+	if err := cliconfig.InitViperWithConfigFile(clusterDeleteCfgViper, clusterDeletePpViper.GetString("config")); err != nil {
+		return err
+	}
+
+	// the cluster has to be deleted from the runtime it was created in
+	if clusterDeletePpViper.GetString("config") != "" {
+		cfg, err := config.SimpleConfigFromViper(clusterDeleteCfgViper)
+		if err != nil {
+			return err
+		}
+		return cliconfig.SelectRuntime(cfg)
+	}
+	return nil
 }
 
 // NewCmdClusterDelete returns a new cobra command
@@ -42,10 +42,20 @@ func NewCmdClusterEdit() *cobra.Command {
 		Aliases:           []string{"update"},
 		ValidArgsFunction: cliutil.ValidArgsAvailableClusters,
 		Run: func(cmd *cobra.Command, args []string) {
-			existingCluster, changeset := parseEditClusterCmd(cmd, args)
+			existingCluster, changeset, scaleOpts := parseEditClusterCmd(cmd, args)
 
 			l.Log().Debugf("===== Current =====\n%+v\n===== Changeset =====\n%+v\n", existingCluster, changeset)
 
+			if scaleOpts.Servers != nil || scaleOpts.Agents != nil {
+				if err := client.ClusterScale(cmd.Context(), runtimes.SelectedRuntime, existingCluster, scaleOpts); err != nil {
+					l.Log().Fatalf("Failed to scale the cluster: %v", err)
+				}
+				var err error
+				if existingCluster, err = client.ClusterGet(cmd.Context(), runtimes.SelectedRuntime, existingCluster); err != nil {
+					l.Log().Fatalln(err)
+				}
+			}
+
 			if err := client.ClusterEditChangesetSimple(cmd.Context(), runtimes.SelectedRuntime, existingCluster, changeset); err != nil {
 				l.Log().Fatalf("Failed to update the cluster: %v", err)
 			}
@@ -59,13 +69,15 @@ func NewCmdClusterEdit() *cobra.Command {
 	// add flags
 	cmd.Flags().StringArray("port-add", nil, "Map ports from the node containers (via the serverlb) to the host (Format: `[HOST:][HOSTPORT:]CONTAINERPORT[/PROTOCOL][@NODEFILTER]`)\n - Example: `k3d cluster edit k3d-mycluster-serverlb --port-add 8080:80`")
 	cmd.Flags().StringArray("port-delete", nil, "[EXPERIMENTAL] Delete a port mapping with the given format\nThe mapping spec needs to be exactly the same as the one used during creation\n - Example: `k3d cluster edit k3d-mycluster-serverlb --port-delete 8080:80`")
+	cmd.Flags().IntP("servers", "s", 0, "Scale the cluster to this number of server nodes (requires embedded etcd to add servers)\n - Example: `k3d cluster edit mycluster --servers 3`")
+	cmd.Flags().IntP("agents", "a", 0, "Scale the cluster to this number of agent nodes (the highest-numbered nodes are drained and removed first)\n - Example: `k3d cluster edit mycluster --agents 2`")
 
 	// done
 	return cmd
 }
 
 // parseEditClusterCmd parses the command input into variables required to delete nodes
-func parseEditClusterCmd(cmd *cobra.Command, args []string) (*k3d.Cluster, *conf.SimpleConfig) {
+func parseEditClusterCmd(cmd *cobra.Command, args []string) (*k3d.Cluster, *conf.SimpleConfig, k3d.ClusterScaleOpts) {
 	existingCluster, err := client.ClusterGet(cmd.Context(), runtimes.SelectedRuntime, &k3d.Cluster{Name: args[0]})
 	if err != nil {
 		l.Log().Fatalln(err)
@@ -73,7 +85,7 @@ func parseEditClusterCmd(cmd *cobra.Command, args []string) (*k3d.Cluster, *conf
 
 	if existingCluster == nil {
 		l.Log().Infof("Cluster %s not found", args[0])
-		return nil, nil
+		return nil, nil, k3d.ClusterScaleOpts{}
 	}
 
 	changeset := conf.SimpleConfig{}
@@ -87,7 +99,30 @@ func parseEditClusterCmd(cmd *cobra.Command, args []string) (*k3d.Cluster, *conf
 		l.Log().Fatalln("Cannot combine port addition and deletion")
 	}
 
-	return existingCluster, &changeset
+	// only the roles whose number of nodes is given are scaled
+	scaleOpts := k3d.ClusterScaleOpts{}
+	if cmd.Flags().Changed("servers") {
+		servers, err := cmd.Flags().GetInt("servers")
+		if err != nil {
+			l.Log().Fatalln(err)
+		}
+		if servers < 1 {
+			l.Log().Fatalln("A cluster needs at least one server node")
+		}
+		scaleOpts.Servers = &servers
+	}
+	if cmd.Flags().Changed("agents") {
+		agents, err := cmd.Flags().GetInt("agents")
+		if err != nil {
+			l.Log().Fatalln(err)
+		}
+		if agents < 0 {
+			l.Log().Fatalln("The number of agent nodes can't be negative")
+		}
+		scaleOpts.Agents = &agents
+	}
+
+	return existingCluster, &changeset, scaleOpts
 }
 
 func parsePortChangeFlag(cmd *cobra.Command, changeset *conf.SimpleConfig, flagName string, isRemoval bool) bool {
@@ -103,6 +138,9 @@ func parsePortChangeFlag(cmd *cobra.Command, changeset *conf.SimpleConfig, flagN
 		if err != nil {
 			l.Log().Fatalln(err)
 		}
+		if _, err := cliutil.ValidatePortMap(portmap); err != nil {
+			l.Log().Fatalln(err)
+		}
 
 		// create new entry or append filter to existing entry
 		if _, exists := portFilterMap[portmap]; exists {
@@ -0,0 +1,134 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cluster
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/k3d-io/k3d/v5/pkg/client"
+	l "github.com/k3d-io/k3d/v5/pkg/logger"
+	"github.com/k3d-io/k3d/v5/pkg/runtimes"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+// NewCmdClusterRestore returns a new cobra command
+func NewCmdClusterRestore() *cobra.Command {
+	// create new command
+	cmd := &cobra.Command{
+		Use:   "restore FILE",
+		Short: "Recreate a k3d cluster from a snapshot archive",
+		Long: `Recreate a k3d cluster from a snapshot archive created with 'k3d cluster snapshot'.
+The cluster must not exist anymore.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			timeout, err := cmd.Flags().GetDuration("timeout")
+			if err != nil {
+				l.Log().Fatalln(err)
+			}
+			wait, err := cmd.Flags().GetBool("wait")
+			if err != nil {
+				l.Log().Fatalln(err)
+			}
+			updateKubeconfig, err := cmd.Flags().GetBool("kubeconfig-update-default")
+			if err != nil {
+				l.Log().Fatalln(err)
+			}
+			switchContext, err := cmd.Flags().GetBool("kubeconfig-switch-context")
+			if err != nil {
+				l.Log().Fatalln(err)
+			}
+			noRollback, err := cmd.Flags().GetBool("no-rollback")
+			if err != nil {
+				l.Log().Fatalln(err)
+			}
+			if updateKubeconfig {
+				l.Log().Debugln("'--kubeconfig-update-default set: enabling wait-for-server")
+				wait = true
+			}
+
+			file, err := os.Open(args[0])
+			if err != nil {
+				l.Log().Fatalf("Failed to open snapshot file '%s': %v", args[0], err)
+			}
+			defer file.Close()
+
+			clusterConfig, err := client.ClusterRestore(cmd.Context(), runtimes.SelectedRuntime, file, k3d.ClusterRestoreOpts{WaitForServer: wait, Timeout: timeout})
+			if err != nil {
+				l.Log().Errorln(err)
+				if clusterConfig == nil {
+					l.Log().Fatalln("Cluster restore FAILED")
+				}
+				if noRollback {
+					l.Log().Fatalln("Cluster restore FAILED, rollback deactivated.")
+				}
+				// rollback if restore failed
+				l.Log().Errorln("Failed to restore cluster >>> Rolling Back")
+				if err := client.ClusterDelete(cmd.Context(), runtimes.SelectedRuntime, &clusterConfig.Cluster, k3d.ClusterDeleteOpts{SkipRegistryCheck: true}); err != nil {
+					l.Log().Errorln(err)
+					l.Log().Fatalln("Cluster restore FAILED, also FAILED to rollback changes!")
+				}
+				l.Log().Fatalln("Cluster restore FAILED, all changes have been rolled back!")
+			}
+			l.Log().Infof("Cluster '%s' restored successfully!", clusterConfig.Name)
+
+			if !updateKubeconfig && switchContext {
+				l.Log().Infoln("--kubeconfig-update-default=false --> sets --kubeconfig-switch-context=false")
+				switchContext = false
+			}
+
+			if updateKubeconfig {
+				l.Log().Debugf("Updating default kubeconfig with a new context for cluster %s", clusterConfig.Name)
+				if _, err := client.KubeconfigGetWrite(cmd.Context(), runtimes.SelectedRuntime, &clusterConfig.Cluster, "", &client.WriteKubeConfigOptions{UpdateExisting: true, OverwriteExisting: false, UpdateCurrentContext: switchContext}); err != nil {
+					l.Log().Warningln(err)
+				}
+			}
+
+			// print information on how to use the cluster with kubectl
+			l.Log().Infoln("You can now use it like this:")
+			if updateKubeconfig && !switchContext {
+				fmt.Printf("kubectl config use-context %s\n", fmt.Sprintf("%s-%s", k3d.DefaultObjectNamePrefix, clusterConfig.Name))
+			} else if !switchContext {
+				if runtime.GOOS == "windows" {
+					fmt.Printf("$env:KUBECONFIG=(%s kubeconfig write %s)\n", os.Args[0], clusterConfig.Name)
+				} else {
+					fmt.Printf("export KUBECONFIG=$(%s kubeconfig write %s)\n", os.Args[0], clusterConfig.Name)
+				}
+			}
+			fmt.Println("kubectl cluster-info")
+		},
+	}
+
+	// add flags
+	cmd.Flags().Duration("timeout", 0*time.Second, "Rollback changes if cluster couldn't be restored in specified duration.")
+	cmd.Flags().Bool("wait", true, "Wait for the server(s) to be ready before returning. Use '--timeout DURATION' to not wait forever.")
+	cmd.Flags().Bool("kubeconfig-update-default", true, "Directly update the default kubeconfig with the restored cluster's context")
+	cmd.Flags().Bool("kubeconfig-switch-context", true, "Directly switch the default kubeconfig's current-context to the restored cluster's context (requires --kubeconfig-update-default)")
+	cmd.Flags().Bool("no-rollback", false, "Disable the automatic rollback actions, if anything goes wrong")
+
+	// done
+	return cmd
+}
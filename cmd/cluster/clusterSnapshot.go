@@ -0,0 +1,97 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cluster
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/k3d-io/k3d/v5/cmd/util"
+	"github.com/k3d-io/k3d/v5/pkg/client"
+	l "github.com/k3d-io/k3d/v5/pkg/logger"
+	"github.com/k3d-io/k3d/v5/pkg/runtimes"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+// NewCmdClusterSnapshot returns a new cobra command
+func NewCmdClusterSnapshot() *cobra.Command {
+	// create new command
+	cmd := &cobra.Command{
+		Use:   "snapshot [NAME]",
+		Short: "Save a snapshot of an existing k3d cluster to an archive",
+		Long: `Save a snapshot of an existing k3d cluster to an archive.
+The snapshot contains the k3s datastore (SQLite database or etcd snapshot), the state k3s keeps on the nodes,
+the loadbalancer configuration and the contents of the image volume.
+A running server using SQLite is stopped while its database is copied and started again afterwards.
+It can be used to recreate the cluster with 'k3d cluster restore'.`,
+		Args:              cobra.RangeArgs(0, 1),
+		ValidArgsFunction: util.ValidArgsAvailableClusters,
+		Run: func(cmd *cobra.Command, args []string) {
+			clusterName := k3d.DefaultClusterName
+			if len(args) != 0 {
+				clusterName = args[0]
+			}
+
+			output, err := cmd.Flags().GetString("output")
+			if err != nil {
+				l.Log().Fatalln(err)
+			}
+			if output == "" {
+				output = fmt.Sprintf("%s-%s-snapshot.tar.gz", k3d.DefaultObjectNamePrefix, clusterName)
+			}
+			noImages, err := cmd.Flags().GetBool("no-images")
+			if err != nil {
+				l.Log().Fatalln(err)
+			}
+
+			file, err := os.Create(output)
+			if err != nil {
+				l.Log().Fatalf("Failed to create snapshot file '%s': %v", output, err)
+			}
+
+			l.Log().Infof("Saving snapshot of cluster '%s' to '%s'...", clusterName, output)
+			if _, err := client.ClusterSnapshot(cmd.Context(), runtimes.SelectedRuntime, &k3d.Cluster{Name: clusterName}, file, k3d.ClusterSnapshotOpts{IncludeImages: !noImages}); err != nil {
+				file.Close()
+				if err := os.Remove(output); err != nil {
+					l.Log().Warnf("Failed to remove incomplete snapshot file '%s': %v", output, err)
+				}
+				l.Log().Fatalln(err)
+			}
+			if err := file.Close(); err != nil {
+				l.Log().Fatalf("Failed to write snapshot file '%s': %v", output, err)
+			}
+			l.Log().Infof("Saved snapshot of cluster '%s' to '%s'", clusterName, output)
+		},
+	}
+
+	// add flags
+	cmd.Flags().StringP("output", "o", "", "Path of the snapshot archive (default: k3d-<cluster>-snapshot.tar.gz)")
+	if err := cmd.MarkFlagFilename("output", "tar.gz", "tgz"); err != nil {
+		l.Log().Fatalln("Failed to mark flag 'output' as filename flag")
+	}
+	cmd.Flags().Bool("no-images", false, "Do not include the contents of the image volume in the snapshot")
+
+	// done
+	return cmd
+}
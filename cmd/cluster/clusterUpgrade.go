@@ -0,0 +1,76 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cluster
+
+import (
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/k3d-io/k3d/v5/cmd/util"
+	"github.com/k3d-io/k3d/v5/pkg/client"
+	l "github.com/k3d-io/k3d/v5/pkg/logger"
+	"github.com/k3d-io/k3d/v5/pkg/runtimes"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+// NewCmdClusterUpgrade returns a new cobra command
+func NewCmdClusterUpgrade() *cobra.Command {
+	upgradeOpts := k3d.ClusterUpgradeOpts{}
+
+	cmd := &cobra.Command{
+		Use:   "upgrade [NAME] --image IMAGE",
+		Short: "Upgrade the nodes of a cluster to a new k3s image",
+		Long: `Upgrade the nodes of a cluster to a new k3s image, one node at a time (servers first, then agents).
+Each node is cordoned and drained using the cluster's kubeconfig, replaced by a node running the new image
+(keeping its volumes and k3s datastore) and uncordoned once it's ready.
+If a new node fails to come up, the old node is brought back and the upgrade stops.`,
+		Args:              cobra.RangeArgs(0, 1),
+		ValidArgsFunction: util.ValidArgsAvailableClusters,
+		Run: func(cmd *cobra.Command, args []string) {
+			clusterName := k3d.DefaultClusterName
+			if len(args) != 0 {
+				clusterName = args[0]
+			}
+
+			cluster, err := client.ClusterGet(cmd.Context(), runtimes.SelectedRuntime, &k3d.Cluster{Name: clusterName})
+			if err != nil {
+				l.Log().Fatalf("Failed to get cluster '%s': %v", clusterName, err)
+			}
+
+			if err := client.ClusterUpgrade(cmd.Context(), runtimes.SelectedRuntime, cluster, upgradeOpts); err != nil {
+				l.Log().Fatalf("Failed to upgrade cluster '%s': %v", clusterName, err)
+			}
+			l.Log().Infof("Successfully upgraded cluster '%s' to image '%s'", clusterName, upgradeOpts.Image)
+		},
+	}
+
+	cmd.Flags().StringVarP(&upgradeOpts.Image, "image", "i", "", "Specify k3s image that the nodes should be upgraded to (e.g. rancher/k3s:v1.31.4-k3s1)")
+	if err := cmd.MarkFlagRequired("image"); err != nil {
+		l.Log().Fatalln("Failed to mark flag 'image' as required")
+	}
+	cmd.Flags().DurationVar(&upgradeOpts.Timeout, "timeout", 0*time.Second, "Maximum waiting time for each new node to get ready before rolling back/failing.")
+	cmd.Flags().DurationVar(&upgradeOpts.DrainTimeout, "drain-timeout", k3d.DefaultNodeDrainTimeout, "Maximum waiting time for the pods of each node to be evicted.")
+	cmd.Flags().BoolVar(&upgradeOpts.SkipDrain, "no-drain", false, "Replace nodes without cordoning and draining them first (e.g. if the Kubernetes API is not reachable)")
+
+	return cmd
+}
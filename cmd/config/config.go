@@ -41,7 +41,7 @@ func NewCmdConfig() *cobra.Command {
 		},
 	}
 
-	cmd.AddCommand(NewCmdConfigInit(), NewCmdConfigMigrate())
+	cmd.AddCommand(NewCmdConfigInit(), NewCmdConfigMigrate(), NewCmdConfigExport())
 
 	return cmd
 }
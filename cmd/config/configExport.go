@@ -0,0 +1,94 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package config
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+
+	"github.com/k3d-io/k3d/v5/cmd/util"
+	"github.com/k3d-io/k3d/v5/pkg/client"
+	"github.com/k3d-io/k3d/v5/pkg/config"
+	l "github.com/k3d-io/k3d/v5/pkg/logger"
+	"github.com/k3d-io/k3d/v5/pkg/runtimes"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+// NewCmdConfigExport returns a new cobra command
+func NewCmdConfigExport() *cobra.Command {
+	var output string
+	var includeToken bool
+
+	cmd := &cobra.Command{
+		Use:   "export [CLUSTER]",
+		Short: "Export an existing cluster as config file",
+		Long: `Export an existing cluster as config file (kind: Simple), which can be used to create the cluster again with 'k3d cluster create --config'.
+Node filters are inferred from the nodes that each setting applies to.`,
+		Args:              cobra.RangeArgs(0, 1),
+		ValidArgsFunction: util.ValidArgsAvailableClusters,
+		Run: func(cmd *cobra.Command, args []string) {
+			clusterName := k3d.DefaultClusterName
+			if len(args) != 0 {
+				clusterName = args[0]
+			}
+
+			cluster, err := client.ClusterGet(cmd.Context(), runtimes.SelectedRuntime, &k3d.Cluster{Name: clusterName})
+			if err != nil {
+				l.Log().Fatalf("Failed to get cluster '%s': %v", clusterName, err)
+			}
+
+			simpleConfig, err := config.TransformClusterToSimpleConfig(cmd.Context(), runtimes.SelectedRuntime, cluster)
+			if err != nil {
+				l.Log().Fatalln(err)
+			}
+			if !includeToken {
+				simpleConfig.ClusterToken = ""
+			}
+
+			yamlout, err := yaml.Marshal(simpleConfig)
+			if err != nil {
+				l.Log().Fatalln(err)
+			}
+
+			if output == "-" {
+				if _, err := os.Stdout.Write(yamlout); err != nil {
+					l.Log().Fatalln(err)
+				}
+			} else {
+				if err := os.WriteFile(output, yamlout, 0644); err != nil {
+					l.Log().Fatalln(err)
+				}
+				l.Log().Infof("Exported cluster '%s' to '%s'", clusterName, output)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", "-", "Write the config to this file ('-' for stdout)")
+	if err := cmd.MarkFlagFilename("output", "yaml", "yml"); err != nil {
+		l.Log().Fatalf("Failed to mark flag 'output' as filename flag: %v", err)
+	}
+	cmd.Flags().BoolVar(&includeToken, "include-token", false, "Include the cluster token in the exported config (don't check it into version control)")
+
+	return cmd
+}
@@ -23,6 +23,7 @@ package debug
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/spf13/cobra"
 	"sigs.k8s.io/yaml"
@@ -68,27 +69,160 @@ func NewCmdDebugLoadbalancer() *cobra.Command {
 		},
 	}
 
-	cmd.AddCommand(&cobra.Command{
+	getConfigCmd := &cobra.Command{
 		Use:               "get-config CLUSTERNAME",
 		Args:              cobra.ExactArgs(1), // cluster name
 		ValidArgsFunction: util.ValidArgsAvailableClusters,
 		Run: func(cmd *cobra.Command, args []string) {
-			c, err := client.ClusterGet(cmd.Context(), runtimes.SelectedRuntime, &types.Cluster{Name: args[0]})
+			lbconf := getLoadbalancerConfig(cmd, args[0])
+			yamlized, err := yaml.Marshal(lbconf)
 			if err != nil {
 				l.Log().Fatalln(err)
 			}
+			fmt.Println(string(yamlized))
+		},
+	}
+	getConfigCmd.Flags().String("name", "", "Get the config of a named loadbalancer instead of the server loadbalancer")
+	cmd.AddCommand(getConfigCmd)
 
-			lbconf, err := client.GetLoadbalancerConfig(cmd.Context(), runtimes.SelectedRuntime, c)
+	renderCmd := &cobra.Command{
+		Use:               "render [CLUSTERNAME]",
+		Short:             "Render the nginx config of the loadbalancer locally",
+		Long:              `Render the nginx config the loadbalancer generates from its config, either from a running cluster or from a config file (--file)`,
+		Args:              cobra.MaximumNArgs(1), // cluster name
+		ValidArgsFunction: util.ValidArgsAvailableClusters,
+		Run: func(cmd *cobra.Command, args []string) {
+			file, err := cmd.Flags().GetString("file")
 			if err != nil {
 				l.Log().Fatalln(err)
 			}
-			yamlized, err := yaml.Marshal(lbconf)
+
+			var lbconf types.LoadbalancerConfig
+			switch {
+			case file != "" && len(args) == 0:
+				lbconf = readLoadbalancerConfigFile(file)
+			case file == "" && len(args) == 1:
+				lbconf = getLoadbalancerConfig(cmd, args[0])
+			default:
+				l.Log().Fatalln("Specify either a cluster or a config file (--file)")
+			}
+
+			rendered, err := client.LoadbalancerRenderConfig(lbconf)
+			if err != nil {
+				l.Log().Fatalln(err)
+			}
+			fmt.Println(string(rendered))
+		},
+	}
+	renderCmd.Flags().StringP("file", "f", "", "Render the config from this file (e.g. the output of `get-config`)")
+	renderCmd.Flags().String("name", "", "Render the config of a named loadbalancer instead of the server loadbalancer")
+	cmd.AddCommand(renderCmd)
+
+	validateCmd := &cobra.Command{
+		Use:               "validate CLUSTERNAME",
+		Short:             "Check the nginx config in the running loadbalancer",
+		Long:              `Check the nginx config in the running loadbalancer (nginx -t)`,
+		Args:              cobra.ExactArgs(1), // cluster name
+		ValidArgsFunction: util.ValidArgsAvailableClusters,
+		Run: func(cmd *cobra.Command, args []string) {
+			output, err := client.LoadbalancerTestConfig(cmd.Context(), runtimes.SelectedRuntime, &types.Cluster{Name: args[0]}, getLoadbalancerName(cmd))
+			fmt.Println(output)
+			if err != nil {
+				l.Log().Fatalln(err)
+			}
+		},
+	}
+	validateCmd.Flags().String("name", "", "Check the config of a named loadbalancer instead of the server loadbalancer")
+	cmd.AddCommand(validateCmd)
+
+	setConfigCmd := &cobra.Command{
+		Use:   "set-config CLUSTERNAME FILE",
+		Short: "Replace the config of the running loadbalancer",
+		Long:  `Replace the config of the running loadbalancer with a (hand-edited) one, e.g. from get-config. The config is validated and reloaded in place, so it can't publish new ports.`,
+		Args:  cobra.ExactArgs(2), // cluster name, config file
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) == 0 {
+				return util.ValidArgsAvailableClusters(cmd, args, toComplete)
+			}
+			return nil, cobra.ShellCompDirectiveDefault
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			lbconf := readLoadbalancerConfigFile(args[1])
+			if err := client.LoadbalancerSetConfig(cmd.Context(), runtimes.SelectedRuntime, &types.Cluster{Name: args[0]}, getLoadbalancerName(cmd), lbconf); err != nil {
+				l.Log().Fatalln(err)
+			}
+			l.Log().Infof("Successfully updated the loadbalancer config of cluster '%s'", args[0])
+		},
+	}
+	setConfigCmd.Flags().String("name", "", "Replace the config of a named loadbalancer instead of the server loadbalancer")
+	cmd.AddCommand(setConfigCmd)
+
+	statsCmd := &cobra.Command{
+		Use:               "stats CLUSTERNAME",
+		Short:             "Show the connection counters of the loadbalancer",
+		Long:              `Show the connection counters of the loadbalancer (nginx stub_status)`,
+		Args:              cobra.ExactArgs(1), // cluster name
+		ValidArgsFunction: util.ValidArgsAvailableClusters,
+		Run: func(cmd *cobra.Command, args []string) {
+			stats, err := client.LoadbalancerGetStats(cmd.Context(), runtimes.SelectedRuntime, &types.Cluster{Name: args[0]}, getLoadbalancerName(cmd))
+			if err != nil {
+				l.Log().Fatalln(err)
+			}
+			yamlized, err := yaml.Marshal(stats)
 			if err != nil {
 				l.Log().Fatalln(err)
 			}
 			fmt.Println(string(yamlized))
 		},
-	})
+	}
+	statsCmd.Flags().String("name", "", "Show the counters of a named loadbalancer instead of the server loadbalancer")
+	cmd.AddCommand(statsCmd)
 
 	return cmd
 }
+
+// getLoadbalancerName returns the name of the named loadbalancer given via --name (empty for the server loadbalancer)
+func getLoadbalancerName(cmd *cobra.Command) string {
+	name, err := cmd.Flags().GetString("name")
+	if err != nil {
+		l.Log().Fatalln(err)
+	}
+	return name
+}
+
+// getLoadbalancerConfig gets the config of the cluster's server loadbalancer or of the named loadbalancer (--name)
+func getLoadbalancerConfig(cmd *cobra.Command, clusterName string) types.LoadbalancerConfig {
+	name := getLoadbalancerName(cmd)
+
+	c, err := client.ClusterGet(cmd.Context(), runtimes.SelectedRuntime, &types.Cluster{Name: clusterName})
+	if err != nil {
+		l.Log().Fatalln(err)
+	}
+
+	if name == "" {
+		lbconf, err := client.GetLoadbalancerConfig(cmd.Context(), runtimes.SelectedRuntime, c)
+		if err != nil {
+			l.Log().Fatalln(err)
+		}
+		return lbconf
+	}
+
+	lb := c.GetLoadbalancer(name)
+	if lb == nil || lb.Config == nil {
+		l.Log().Fatalf("Cluster '%s' has no loadbalancer named '%s'", clusterName, name)
+	}
+	return *lb.Config
+}
+
+// readLoadbalancerConfigFile reads a loadbalancer config from a YAML (or JSON) file, rejecting unknown fields
+func readLoadbalancerConfigFile(file string) types.LoadbalancerConfig {
+	var lbconf types.LoadbalancerConfig
+	content, err := os.ReadFile(file)
+	if err != nil {
+		l.Log().Fatalf("Failed to read loadbalancer config: %v", err)
+	}
+	if err := yaml.UnmarshalStrict(content, &lbconf); err != nil {
+		l.Log().Fatalf("Failed to parse loadbalancer config '%s': %v", file, err)
+	}
+	return lbconf
+}
@@ -34,6 +34,7 @@ import (
 	l "github.com/k3d-io/k3d/v5/pkg/logger"
 	"github.com/k3d-io/k3d/v5/pkg/runtimes"
 	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+	k3dutil "github.com/k3d-io/k3d/v5/pkg/util"
 )
 
 // NewCmdNodeCreate returns a new cobra command
@@ -76,6 +77,8 @@ func NewCmdNodeCreate() *cobra.Command {
 
 	cmd.Flags().StringP("image", "i", "", "Specify k3s image used for the node(s) (default: copied from existing node)")
 	cmd.Flags().String("memory", "", "Memory limit imposed on the node [From docker]")
+	cmd.Flags().String("cpus", "", "Number of CPUs (fractional) the node may use [From docker]")
+	cmd.Flags().String("cpuset", "", "CPUs of the host the node is pinned to (e.g. `0-3,5`) [From docker]")
 
 	cmd.Flags().BoolVar(&createNodeOpts.Wait, "wait", true, "Wait for the node(s) to be ready before returning.")
 	cmd.Flags().DurationVar(&createNodeOpts.Timeout, "timeout", 0*time.Second, "Maximum waiting time for '--wait' before canceling/returning.")
@@ -137,6 +140,24 @@ func parseCreateNodeCmd(cmd *cobra.Command, args []string) ([]*k3d.Node, string)
 		l.Log().Errorf("Provided memory limit value is invalid")
 	}
 
+	// --cpus
+	cpus, err := cmd.Flags().GetString("cpus")
+	if err != nil {
+		l.Log().Fatalln(err)
+	}
+	if _, err := k3dutil.ParseCPUs(cpus); cpus != "" && err != nil {
+		l.Log().Fatalf("Provided CPU limit value is invalid: %v", err)
+	}
+
+	// --cpuset
+	cpuset, err := cmd.Flags().GetString("cpuset")
+	if err != nil {
+		l.Log().Fatalln(err)
+	}
+	if err := k3dutil.ValidateCPUSet(cpuset); cpuset != "" && err != nil {
+		l.Log().Fatalf("Provided cpuset is invalid: %v", err)
+	}
+
 	// --runtime-label
 	runtimeLabelsFlag, err := cmd.Flags().GetStringSlice("runtime-label")
 	if err != nil {
@@ -206,6 +227,8 @@ func parseCreateNodeCmd(cmd *cobra.Command, args []string) ([]*k3d.Node, string)
 			RuntimeUlimits: runtimeUlimits,
 			Restart:        true,
 			Memory:         memory,
+			CPUs:           cpus,
+			CPUSet:         cpuset,
 			Networks:       networks,
 			Args:           k3sArgs,
 		}
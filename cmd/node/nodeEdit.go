@@ -58,6 +58,9 @@ func NewCmdNodeEdit() *cobra.Command {
 
 	// add flags
 	cmd.Flags().StringArray("port-add", nil, "[EXPERIMENTAL] (serverlb only!) Map ports from the node container to the host (Format: `[HOST:][HOSTPORT:]CONTAINERPORT[/PROTOCOL][@NODEFILTER]`)\n - Example: `k3d node edit k3d-mycluster-serverlb --port-add 8080:80`")
+	cmd.Flags().String("cpus", "", "[EXPERIMENTAL] (server/agent/serverlb) Number of CPUs (fractional) the node may use (`none` to remove the limit)\n - Example: `k3d node edit k3d-mycluster-agent-0 --cpus 1.5`")
+	cmd.Flags().String("cpuset", "", "[EXPERIMENTAL] (server/agent/serverlb) CPUs of the host the node is pinned to (`none` to remove the pinning)\n - Example: `k3d node edit k3d-mycluster-agent-0 --cpuset 0-1`")
+	cmd.Flags().Bool("lb-drain", false, "[EXPERIMENTAL] (server/agent only!) Take the node out of the loadbalancer's rotation without removing it (`--lb-drain=false` puts it back)\n - Example: `k3d node edit k3d-mycluster-server-1 --lb-drain`")
 	cmd.Flags().StringArray("port-delete", nil, "[EXPERIMENTAL] (serverlb only!) Remove port mappings between a node and the host (Format: `[HOST:][HOSTPORT:]CONTAINERPORT[/PROTOCOL][@NODEFILTER]`)\n - Example: `k3d node edit k3d-mycluster-serverlb --port-delete 8080:80`")
 
 	// done
@@ -77,8 +80,8 @@ func parseEditNodeCmd(cmd *cobra.Command, args []string) (*k3d.Node, *client.Nod
 		return nil, nil
 	}
 
-	if existingNode.Role != k3d.LoadBalancerRole {
-		l.Log().Fatalln("Currently only the loadbalancer can be updated!")
+	if existingNode.Role != k3d.LoadBalancerRole && existingNode.Role != k3d.ServerRole && existingNode.Role != k3d.AgentRole {
+		l.Log().Fatalln("Currently only the loadbalancer, server and agent nodes can be updated!")
 	}
 
 	changeset := &client.NodeEditChangeset{}
@@ -92,6 +95,24 @@ func parseEditNodeCmd(cmd *cobra.Command, args []string) (*k3d.Node, *client.Nod
 		l.Log().Fatalln("Cannot combine port addition and deletion")
 	}
 
+	if (portsAdded || portsDeleted) && existingNode.Role != k3d.LoadBalancerRole {
+		l.Log().Fatalln("Currently only the ports of the loadbalancer can be updated!")
+	}
+
+	changeset.CPUs = parseResourceChangeFlag(cmd, "cpus")
+	changeset.CPUSet = parseResourceChangeFlag(cmd, "cpuset")
+
+	if cmd.Flags().Changed("lb-drain") {
+		if existingNode.Role == k3d.LoadBalancerRole {
+			l.Log().Fatalln("Only server and agent nodes can be drained from the loadbalancer!")
+		}
+		drain, err := cmd.Flags().GetBool("lb-drain")
+		if err != nil {
+			l.Log().Fatalln(err)
+		}
+		changeset.LoadbalancerDrain = &drain
+	}
+
 	return existingNode, changeset
 }
 
@@ -116,3 +137,18 @@ func parsePortChangeFlag(cmd *cobra.Command, changeset *client.NodeEditChangeset
 
 	return len(portFlags) > 0
 }
+
+// parseResourceChangeFlag returns the new value of a resource setting, nil if it's unchanged or empty if it should be removed ("none")
+func parseResourceChangeFlag(cmd *cobra.Command, flagName string) *string {
+	if !cmd.Flags().Changed(flagName) {
+		return nil
+	}
+	value, err := cmd.Flags().GetString(flagName)
+	if err != nil {
+		l.Log().Fatalln(err)
+	}
+	if value == "none" {
+		value = ""
+	}
+	return &value
+}
@@ -79,16 +79,18 @@ func NewCmdNodeList() *cobra.Command {
 			// print existing nodes
 			headers := &[]string{}
 			if !nodeListFlags.noHeader {
-				headers = &[]string{"NAME", "ROLE", "CLUSTER", "STATUS"}
+				headers = &[]string{"NAME", "ROLE", "CLUSTER", "STATUS", "CPUS", "CPUSET"}
 			}
 
 			util.PrintNodes(existingNodes, nodeListFlags.output,
 				headers, util.NodePrinterFunc(func(tabwriter *tabwriter.Writer, node *k3d.Node) {
-					fmt.Fprintf(tabwriter, "%s\t%s\t%s\t%s\n",
+					fmt.Fprintf(tabwriter, "%s\t%s\t%s\t%s\t%s\t%s\n",
 						strings.TrimPrefix(node.Name, "/"),
 						string(node.Role),
 						node.RuntimeLabels[k3d.LabelClusterName],
-						node.State.Status)
+						node.State.Status,
+						valueOrDash(node.CPUs),
+						valueOrDash(node.CPUSet))
 				}))
 		},
 	}
@@ -101,3 +103,11 @@ func NewCmdNodeList() *cobra.Command {
 	// done
 	return cmd
 }
+
+// valueOrDash returns the value or a dash, if it's not set (e.g. no CPU limit)
+func valueOrDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
@@ -0,0 +1,152 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/k3d-io/k3d/v5/pkg/loadbalancer"
+	l "github.com/k3d-io/k3d/v5/pkg/logger"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+// NewCmdProxy returns a new cobra command
+func NewCmdProxy() *cobra.Command {
+	opts := loadbalancer.ProxyOpts{}
+
+	cmd := &cobra.Command{
+		Use:    "proxy",
+		Hidden: true,
+		Short:  "Run the native loadbalancer",
+		Long: `Run the native loadbalancer: a tcp/udp proxy configured by the k3d loadbalancer config.
+This is what runs inside loadbalancers created with '--lb-mode native', the config is reloaded when it changes.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx, cancel := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer cancel()
+
+			proxy := loadbalancer.NewProxy(opts)
+
+			hup := make(chan os.Signal, 1)
+			signal.Notify(hup, syscall.SIGHUP)
+			go func() {
+				for range hup {
+					if err := proxy.Reload(); err != nil {
+						l.Log().Errorln(err)
+					}
+				}
+			}()
+
+			if err := proxy.Run(ctx); err != nil {
+				l.Log().Fatalln(err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.ConfigPath, "config", "c", k3d.DefaultLoadbalancerConfigPath, "Path of the loadbalancer config")
+	cmd.Flags().StringVar(&opts.ListenHost, "listen-host", "", "Host to listen on for the proxied ports (default: all interfaces)")
+	cmd.Flags().DurationVar(&opts.ReloadInterval, "reload-interval", time.Second, "Interval to check the config for changes")
+
+	checkCmd := &cobra.Command{
+		Use:   "check",
+		Short: "Check the loadbalancer config",
+		Long:  `Check that the loadbalancer config can be served by the native loadbalancer and that all of its targets resolve`,
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			configPath, _ := cmd.Flags().GetString("config")
+			cfg, _, err := loadbalancer.ReadConfig(configPath)
+			if err != nil {
+				l.Log().Fatalln(err)
+			}
+			if err := loadbalancer.CheckConfig(cmd.Context(), cfg); err != nil {
+				l.Log().Fatalln(err)
+			}
+			fmt.Printf("loadbalancer config %s is valid: the native loadbalancer can serve its %d port(s) and all targets resolve\n", configPath, len(cfg.Ports))
+		},
+	}
+	checkCmd.Flags().StringP("config", "c", k3d.DefaultLoadbalancerConfigPath, "Path of the loadbalancer config")
+
+	statsCmd := &cobra.Command{
+		Use:   "stats",
+		Short: "Show the connection counters of the running loadbalancer",
+		Long:  `Show the connection counters of the running loadbalancer (in the format of nginx' stub_status)`,
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := callStatusEndpoint(http.MethodGet, "/status"); err != nil {
+				l.Log().Fatalln(err)
+			}
+		},
+	}
+
+	reloadCmd := &cobra.Command{
+		Use:   "reload",
+		Short: "Reload the config of the running loadbalancer",
+		Long:  `Reload the config of the running loadbalancer, without waiting for it to notice the change`,
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := callStatusEndpoint(http.MethodPost, "/reload"); err != nil {
+				l.Log().Fatalln(err)
+			}
+		},
+	}
+
+	cmd.AddCommand(checkCmd, statsCmd, reloadCmd)
+
+	return cmd
+}
+
+// callStatusEndpoint calls the status endpoint of the loadbalancer running in the same container and prints its response
+func callStatusEndpoint(method string, path string) error {
+	url := fmt.Sprintf("http://%s%s", net.JoinHostPort("127.0.0.1", strconv.Itoa(k3d.DefaultLoadbalancerStatusPort)), path)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach the loadbalancer: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response of the loadbalancer: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("loadbalancer returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	fmt.Print(string(body))
+	return nil
+}
@@ -47,7 +47,16 @@ func NewCmdRegistry() *cobra.Command {
 		NewCmdRegistryStart(),
 		NewCmdRegistryStop(),
 		NewCmdRegistryDelete(),
-		NewCmdRegistryList())
+		NewCmdRegistryList(),
+		NewCmdRegistryConnect(),
+		NewCmdRegistryDisconnect(),
+		NewCmdRegistryImages(),
+		NewCmdRegistryTags(),
+		NewCmdRegistryPush(),
+		NewCmdRegistryDeleteImage(),
+		NewCmdRegistryGC(),
+		NewCmdRegistryExport(),
+		NewCmdRegistryImport())
 
 	// add flags
 
@@ -39,17 +39,22 @@ type regCreatePreProcessedFlags struct {
 	Port     string
 	Clusters []string
 	Volumes  []string
+	Auth     string
 }
 
 type regCreateFlags struct {
-	Image            string
-	Network          string
-	ProxyRemoteURL   string
-	ProxyUsername    string
-	ProxyPassword    string
-	NoHelp           bool
-	DeleteEnabled    bool
-	EnforcePortMatch bool
+	Kind              string
+	Image             string
+	Network           string
+	ProxyRemoteURL    string
+	ProxyUsername     string
+	ProxyPassword     string
+	ProxyPasswordFile string
+	ProxyPasswordEnv  string
+	NoHelp            bool
+	DeleteEnabled     bool
+	EnforcePortMatch  bool
+	TLS               bool
 }
 
 var helptext string = `# You can now use the registry like this (example):
@@ -66,6 +71,16 @@ docker push %s/mynginx:v0.1
 kubectl run mynginx --image %s/mynginx:v0.1
 `
 
+var helptextTLS string = `# The registry serves TLS with a certificate signed by its own CA, which the nodes of connected clusters trust.
+# To push to it with docker, make docker trust the CA (on Docker Desktop, restart it afterwards):
+sudo mkdir -p /etc/docker/certs.d/%s && sudo cp %s /etc/docker/certs.d/%s/ca.crt
+`
+
+var helptextAuth string = `# The registry requires authentication, which the nodes of connected clusters are configured for.
+# To push to it with docker, log in first:
+docker login %s --username %s
+`
+
 // NewCmdRegistryCreate returns a new cobra command
 func NewCmdRegistryCreate() *cobra.Command {
 	flags := &regCreateFlags{}
@@ -90,22 +105,29 @@ func NewCmdRegistryCreate() *cobra.Command {
 			regString := fmt.Sprintf("%s:%s", reg.Host, reg.ExposureOpts.Binding.HostPort)
 			if !flags.NoHelp {
 				fmt.Println(fmt.Sprintf(helptext, regString, regString, regString, regString))
+				if reg.Options.TLS {
+					caPath, err := client.RegistryHostCAPath(reg.Host)
+					if err != nil {
+						l.Log().Fatalln(err)
+					}
+					fmt.Println(fmt.Sprintf(helptextTLS, regString, caPath, regString))
+				}
+				if reg.Options.Auth.Username != "" {
+					fmt.Println(fmt.Sprintf(helptextAuth, regString, reg.Options.Auth.Username))
+				}
 			}
 		},
 	}
 
 	// add flags
 
-	// TODO: connecting to clusters requires non-existing config reload functionality in containerd
-	cmd.Flags().StringArrayVarP(&ppFlags.Clusters, "cluster", "c", nil, "[NotReady] Select the cluster(s) that the registry shall connect to.")
+	cmd.Flags().StringArrayVarP(&ppFlags.Clusters, "cluster", "c", nil, "Select the cluster(s) that the registry shall connect to (same as `k3d registry connect`, restarts the k3s nodes of the clusters)")
 	if err := cmd.RegisterFlagCompletionFunc("cluster", cliutil.ValidArgsAvailableClusters); err != nil {
 		l.Log().Fatalln("Failed to register flag completion for '--cluster'", err)
 	}
-	if err := cmd.Flags().MarkHidden("cluster"); err != nil {
-		l.Log().Fatalln("Failed to hide --cluster flag on registry create command")
-	}
 
-	cmd.Flags().StringVarP(&flags.Image, "image", "i", fmt.Sprintf("%s:%s", k3d.DefaultRegistryImageRepo, k3d.DefaultRegistryImageTag), "Specify image used for the registry")
+	cmd.Flags().StringVar(&flags.Kind, "kind", string(k3d.RegistryKindDistribution), fmt.Sprintf("Select the registry implementation (one of %v)", k3d.RegistryKinds))
+	cmd.Flags().StringVarP(&flags.Image, "image", "i", "", fmt.Sprintf("Specify image used for the registry (default: %s:%s for the kind distribution, %s:%s for the kind zot, %s:%s for the kind harbor-lite)", k3d.DefaultRegistryImageRepo, k3d.DefaultRegistryImageTag, k3d.DefaultRegistryZotImageRepo, k3d.DefaultRegistryZotImageTag, k3d.DefaultRegistryHarborLiteImageRepo, k3d.DefaultRegistryHarborLiteImageTag))
 
 	cmd.Flags().StringVarP(&ppFlags.Port, "port", "p", "random", "Select which port the registry should be listening on on your machine (localhost) (Format: `[HOST:]HOSTPORT`)\n - Example: `k3d registry create --port 0.0.0.0:5111`")
 	cmd.Flags().StringArrayVarP(&ppFlags.Volumes, "volume", "v", nil, "Mount volumes into the registry node (Format: `[SOURCE:]DEST`")
@@ -114,10 +136,15 @@ func NewCmdRegistryCreate() *cobra.Command {
 	cmd.Flags().StringVar(&flags.ProxyRemoteURL, "proxy-remote-url", "", "Specify the url of the proxied remote registry")
 	cmd.Flags().StringVar(&flags.ProxyUsername, "proxy-username", "", "Specify the username of the proxied remote registry")
 	cmd.Flags().StringVar(&flags.ProxyPassword, "proxy-password", "", "Specify the password of the proxied remote registry")
+	cmd.Flags().StringVar(&flags.ProxyPasswordFile, "proxy-password-file", "", "Read the password of the proxied remote registry from a file")
+	cmd.Flags().StringVar(&flags.ProxyPasswordEnv, "proxy-password-env", "", "Read the password of the proxied remote registry from an environment variable")
+	cmd.MarkFlagsMutuallyExclusive("proxy-password", "proxy-password-file", "proxy-password-env")
 
 	cmd.Flags().BoolVar(&flags.NoHelp, "no-help", false, "Disable the help text (How-To use the registry)")
 	cmd.Flags().BoolVar(&flags.DeleteEnabled, "delete-enabled", false, "Enable image deletion")
 	cmd.Flags().BoolVar(&flags.EnforcePortMatch, "enforce-port-match", false, "Make the internal registry port match the external one")
+	cmd.Flags().BoolVar(&flags.TLS, "tls", false, "Serve the registry via https with a certificate signed by a generated CA, which is trusted by the nodes of connected clusters and exported to the k3d config directory")
+	cmd.Flags().StringVar(&ppFlags.Auth, "auth", "", "Require authentication via htpasswd with the given credentials, which the nodes of connected clusters are configured with (Format: `USERNAME:PASSWORD`)")
 
 	// done
 	return cmd
@@ -148,14 +175,21 @@ func parseCreateRegistryCmd(cmd *cobra.Command, args []string, flags *regCreateF
 		registryName = fmt.Sprintf("%s-%s", k3d.DefaultObjectNamePrefix, args[0])
 	}
 
+	// --kind
+	options := k3d.RegistryOptions{Kind: k3d.RegistryKind(flags.Kind)}
+	if _, err := client.GetRegistryImplementation(options.Kind); err != nil {
+		l.Log().Fatalln(err)
+	}
+
 	// -- proxy
-	var options k3d.RegistryOptions
 
 	if flags.ProxyRemoteURL != "" {
 		proxy := k3d.RegistryProxy{
-			RemoteURL: flags.ProxyRemoteURL,
-			Username:  flags.ProxyUsername,
-			Password:  flags.ProxyPassword,
+			RemoteURL:    flags.ProxyRemoteURL,
+			Username:     flags.ProxyUsername,
+			Password:     flags.ProxyPassword,
+			PasswordFile: flags.ProxyPasswordFile,
+			PasswordEnv:  flags.ProxyPasswordEnv,
 		}
 		options.Proxy = proxy
 		l.Log().Traceln("Proxy info:", proxy)
@@ -177,6 +211,15 @@ func parseCreateRegistryCmd(cmd *cobra.Command, args []string, flags *regCreateF
 
 	options.DeleteEnabled = flags.DeleteEnabled
 	options.EnforcePortMatch = flags.EnforcePortMatch
+	options.TLS = flags.TLS
+
+	// --auth
+	if ppFlags.Auth != "" {
+		options.Auth, err = client.ParseRegistryAuth(ppFlags.Auth)
+		if err != nil {
+			l.Log().Fatalln(err)
+		}
+	}
 
 	return &k3d.Registry{Host: registryName, Image: flags.Image, ExposureOpts: *exposePort, Network: flags.Network, Options: options, Volumes: volumes}, clusters
 }
@@ -31,7 +31,8 @@ import (
 )
 
 type registryDeleteFlags struct {
-	All bool
+	All          bool
+	DeleteVolume bool
 }
 
 // NewCmdRegistryDelete returns a new cobra command
@@ -52,7 +53,7 @@ func NewCmdRegistryDelete() *cobra.Command {
 				l.Log().Infoln("No registries found")
 			} else {
 				for _, node := range nodes {
-					if err := client.NodeDelete(cmd.Context(), runtimes.SelectedRuntime, node, k3d.NodeDeleteOpts{SkipLBUpdate: true}); err != nil {
+					if err := client.NodeDelete(cmd.Context(), runtimes.SelectedRuntime, node, k3d.NodeDeleteOpts{SkipLBUpdate: true, DeleteRegistryVolume: flags.DeleteVolume}); err != nil {
 						l.Log().Fatalln(err)
 					}
 				}
@@ -64,6 +65,7 @@ func NewCmdRegistryDelete() *cobra.Command {
 
 	// add flags
 	cmd.Flags().BoolVarP(&flags.All, "all", "a", false, "Delete all existing registries")
+	cmd.Flags().BoolVar(&flags.DeleteVolume, "delete-volume", false, "Delete the data volume of the registry as well (by default, it's kept, so a registry re-created with the same name still has the images)")
 
 	// done
 	return cmd
@@ -0,0 +1,59 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package registry
+
+import (
+	"github.com/k3d-io/k3d/v5/pkg/client"
+	l "github.com/k3d-io/k3d/v5/pkg/logger"
+	"github.com/k3d-io/k3d/v5/pkg/runtimes"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+	"github.com/spf13/cobra"
+)
+
+// NewCmdRegistryDeleteImage returns a new cobra command
+func NewCmdRegistryDeleteImage() *cobra.Command {
+	// create new cobra command
+	cmd := &cobra.Command{
+		Use:     "delete-image REGISTRY/REPOSITORY(:TAG|@DIGEST)...",
+		Aliases: []string{"rmi"},
+		Short:   "Delete image(s) from a registry",
+		Long: `Delete image(s) from a registry (requires a registry created with --delete-enabled).
+The registry deletes images by digest, so all tags referencing the same image are deleted.
+Run 'k3d registry gc' afterwards to free the disk space used by the image.
+ - Example: k3d registry delete-image k3d-myregistry.localhost/mynginx:v0.1`,
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			for _, ref := range args {
+				registry, image, err := client.SplitRegistryImageRef(ref)
+				if err != nil {
+					l.Log().Fatalln(err)
+				}
+				if err := client.RegistryDeleteImage(cmd.Context(), runtimes.SelectedRuntime, &k3d.Node{Name: registry}, image); err != nil {
+					l.Log().Fatalln(err)
+				}
+			}
+		},
+	}
+
+	// done
+	return cmd
+}
@@ -0,0 +1,52 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package registry
+
+import (
+	"github.com/k3d-io/k3d/v5/pkg/client"
+	l "github.com/k3d-io/k3d/v5/pkg/logger"
+	"github.com/k3d-io/k3d/v5/pkg/runtimes"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+	"github.com/spf13/cobra"
+)
+
+// NewCmdRegistryDisconnect returns a new cobra command
+func NewCmdRegistryDisconnect() *cobra.Command {
+	// create new cobra command
+	cmd := &cobra.Command{
+		Use:   "disconnect REGISTRY CLUSTER",
+		Short: "Disconnect a registry from a cluster",
+		Long: `Disconnect a registry from a cluster.
+This removes the registry from the registries.yaml of all k3s nodes and from the LocalRegistryHosting ConfigMap,
+restarts the k3s nodes (one by one) to apply the configuration and detaches the registry from the cluster network.`,
+		Args:              cobra.ExactArgs(2),
+		ValidArgsFunction: validArgsRegistryAndCluster,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := client.RegistryDisconnect(cmd.Context(), runtimes.SelectedRuntime, &k3d.Node{Name: args[0]}, &k3d.Cluster{Name: args[1]}); err != nil {
+				l.Log().Fatalln(err)
+			}
+		},
+	}
+
+	// done
+	return cmd
+}
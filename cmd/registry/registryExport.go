@@ -0,0 +1,83 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package registry
+
+import (
+	"os"
+
+	"github.com/k3d-io/k3d/v5/cmd/util"
+	"github.com/k3d-io/k3d/v5/pkg/client"
+	l "github.com/k3d-io/k3d/v5/pkg/logger"
+	"github.com/k3d-io/k3d/v5/pkg/runtimes"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+	"github.com/spf13/cobra"
+)
+
+// NewCmdRegistryExport returns a new cobra command
+func NewCmdRegistryExport() *cobra.Command {
+	opts := k3d.RegistryExportOpts{}
+
+	// create new cobra command
+	cmd := &cobra.Command{
+		Use:   "export NAME FILE",
+		Short: "Export a registry and its data to an archive",
+		Long: `Export a registry and its data to an archive.
+The archive contains the settings of the registry and the contents of its volume, which are streamed out via a k3d-tools node.
+It can be used to recreate the registry, e.g. on another machine, with 'k3d registry import'.
+The password of a registry with authentication is left out, unless --include-credentials is set:
+pass the credentials to 'k3d registry import --auth' instead.`,
+		Args:              cobra.ExactArgs(2),
+		ValidArgsFunction: util.ValidArgsAvailableRegistries,
+		Run: func(cmd *cobra.Command, args []string) {
+			registryNode, err := client.NodeGet(cmd.Context(), runtimes.SelectedRuntime, &k3d.Node{Name: args[0]})
+			if err != nil {
+				l.Log().Fatalln(err)
+			}
+			if registryNode.Role != k3d.RegistryRole {
+				l.Log().Fatalf("Node '%s' is not a registry", registryNode.Name)
+			}
+
+			file, err := os.Create(args[1])
+			if err != nil {
+				l.Log().Fatalf("Failed to create registry archive '%s': %v", args[1], err)
+			}
+
+			l.Log().Infof("Exporting registry '%s' to '%s'...", registryNode.Name, args[1])
+			if err := client.RegistryExport(cmd.Context(), runtimes.SelectedRuntime, registryNode, file, opts); err != nil {
+				file.Close()
+				if err := os.Remove(args[1]); err != nil {
+					l.Log().Warnf("Failed to remove incomplete registry archive '%s': %v", args[1], err)
+				}
+				l.Log().Fatalln(err)
+			}
+			if err := file.Close(); err != nil {
+				l.Log().Fatalf("Failed to write registry archive '%s': %v", args[1], err)
+			}
+			l.Log().Infof("Exported registry '%s' to '%s'", registryNode.Name, args[1])
+		},
+	}
+
+	cmd.Flags().BoolVar(&opts.IncludeCredentials, "include-credentials", false, "Also write the password of a registry with authentication to the archive (in plain text: anyone who can read the archive can access the registry)")
+
+	// done
+	return cmd
+}
@@ -0,0 +1,59 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package registry
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/k3d-io/k3d/v5/cmd/util"
+	"github.com/k3d-io/k3d/v5/pkg/client"
+	l "github.com/k3d-io/k3d/v5/pkg/logger"
+	"github.com/k3d-io/k3d/v5/pkg/runtimes"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+	"github.com/spf13/cobra"
+)
+
+// NewCmdRegistryImages returns a new cobra command
+func NewCmdRegistryImages() *cobra.Command {
+	// create new cobra command
+	cmd := &cobra.Command{
+		Use:               "images REGISTRY",
+		Short:             "List the repositories in a registry",
+		Long:              `List the repositories in a registry (via the catalog API of the registry).`,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: util.ValidArgsAvailableRegistries,
+		Run: func(cmd *cobra.Command, args []string) {
+			repos, err := client.RegistryListRepositories(cmd.Context(), runtimes.SelectedRuntime, &k3d.Node{Name: args[0]})
+			if err != nil {
+				l.Log().Fatalln(err)
+			}
+			sort.Strings(repos)
+			for _, repo := range repos {
+				fmt.Println(repo)
+			}
+		},
+	}
+
+	// done
+	return cmd
+}
@@ -0,0 +1,91 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package registry
+
+import (
+	"fmt"
+	"os"
+
+	cliutil "github.com/k3d-io/k3d/v5/cmd/util"
+	"github.com/k3d-io/k3d/v5/pkg/client"
+	l "github.com/k3d-io/k3d/v5/pkg/logger"
+	"github.com/k3d-io/k3d/v5/pkg/runtimes"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+	"github.com/spf13/cobra"
+)
+
+// NewCmdRegistryImport returns a new cobra command
+func NewCmdRegistryImport() *cobra.Command {
+	var name, port, auth string
+
+	// create new cobra command
+	cmd := &cobra.Command{
+		Use:   "import FILE",
+		Short: "Create a registry from an archive",
+		Long: `Create a registry from an archive created with 'k3d registry export'.
+The data is restored into the volume of the new registry before it is started.
+The password of a proxied remote registry is not part of the archive, and neither is the password of a registry
+with authentication, unless it was exported with --include-credentials: pass its credentials via --auth.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			opts := k3d.RegistryImportOpts{}
+			if name != "" {
+				opts.Name = fmt.Sprintf("%s-%s", k3d.DefaultObjectNamePrefix, name)
+			}
+			if port != "" {
+				exposePort, err := cliutil.ParsePortExposureSpec(port, k3d.DefaultRegistryPort, false)
+				if err != nil {
+					l.Log().Errorln("Failed to parse registry port")
+					l.Log().Fatalln(err)
+				}
+				opts.ExposureOpts = exposePort
+			}
+			if auth != "" {
+				registryAuth, err := client.ParseRegistryAuth(auth)
+				if err != nil {
+					l.Log().Fatalln(err)
+				}
+				opts.Auth = &registryAuth
+			}
+
+			file, err := os.Open(args[0])
+			if err != nil {
+				l.Log().Fatalf("Failed to open registry archive '%s': %v", args[0], err)
+			}
+			defer file.Close()
+
+			registryNode, err := client.RegistryImport(cmd.Context(), runtimes.SelectedRuntime, file, opts)
+			if err != nil {
+				l.Log().Fatalln(err)
+			}
+			l.Log().Infof("Successfully imported registry '%s' from '%s'", registryNode.Name, args[0])
+		},
+	}
+
+	// add flags
+	cmd.Flags().StringVar(&name, "name", "", "Name of the new registry (default: name of the exported registry)")
+	cmd.Flags().StringVarP(&port, "port", "p", "", "Select which port the registry should be listening on on your machine (localhost) (Format: `[HOST:]HOSTPORT`) (default: port of the exported registry)")
+	cmd.Flags().StringVar(&auth, "auth", "", "Credentials of the new registry, required if the archive doesn't contain the password (Format: `USERNAME:PASSWORD`) (default: credentials in the archive)")
+
+	// done
+	return cmd
+}
@@ -44,10 +44,13 @@ import (
 	"github.com/k3d-io/k3d/v5/cmd/image"
 	"github.com/k3d-io/k3d/v5/cmd/kubeconfig"
 	"github.com/k3d-io/k3d/v5/cmd/node"
+	"github.com/k3d-io/k3d/v5/cmd/proxy"
 	"github.com/k3d-io/k3d/v5/cmd/registry"
 	cliutil "github.com/k3d-io/k3d/v5/cmd/util"
 	l "github.com/k3d-io/k3d/v5/pkg/logger"
 	"github.com/k3d-io/k3d/v5/pkg/runtimes"
+	runtimeTypes "github.com/k3d-io/k3d/v5/pkg/runtimes/types"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
 	"github.com/k3d-io/k3d/v5/pkg/util"
 	"github.com/k3d-io/k3d/v5/version"
 )
@@ -58,6 +61,8 @@ type RootFlags struct {
 	traceLogging       bool
 	timestampedLogging bool
 	version            bool
+	runtime            string
+	runtimeConnection  runtimeTypes.ConnectionOpts
 }
 
 type VersionInfo struct {
@@ -90,6 +95,12 @@ All Nodes of a k3d cluster are part of the same docker network.`,
 	rootCmd.PersistentFlags().BoolVar(&flags.debugLogging, "verbose", false, "Enable verbose output (debug logging)")
 	rootCmd.PersistentFlags().BoolVar(&flags.traceLogging, "trace", false, "Enable super verbose output (trace logging)")
 	rootCmd.PersistentFlags().BoolVar(&flags.timestampedLogging, "timestamps", false, "Enable Log timestamps")
+	rootCmd.PersistentFlags().StringVar(&flags.runtime, "runtime", "", fmt.Sprintf("Container runtime to use (one of %s) [$%s] (default: docker)", strings.Join(runtimes.Names(), ", "), k3d.K3dEnvRuntime))
+	rootCmd.PersistentFlags().StringVar(&flags.runtimeConnection.Endpoint, "runtime-endpoint", "", "Endpoint of the container runtime (e.g. unix:///run/podman/podman.sock or tcp://10.0.0.1:2376), overriding the runtime's default")
+	rootCmd.PersistentFlags().DurationVar(&flags.runtimeConnection.Timeout, "runtime-timeout", 0, "Timeout for establishing the connection to the container runtime (e.g. 10s)")
+	rootCmd.PersistentFlags().StringVar(&flags.runtimeConnection.TLS.CACert, "runtime-tls-ca", "", "Path to the CA certificate used to verify the container runtime endpoint")
+	rootCmd.PersistentFlags().StringVar(&flags.runtimeConnection.TLS.Cert, "runtime-tls-cert", "", "Path to the client certificate used to authenticate against the container runtime endpoint")
+	rootCmd.PersistentFlags().StringVar(&flags.runtimeConnection.TLS.Key, "runtime-tls-key", "", "Path to the client key used to authenticate against the container runtime endpoint")
 
 	// add local flags
 	rootCmd.Flags().BoolVar(&flags.version, "version", false, "Show k3d and default k3s version")
@@ -105,16 +116,44 @@ All Nodes of a k3d cluster are part of the same docker network.`,
 		cfg.NewCmdConfig(),
 		registry.NewCmdRegistry(),
 		debug.NewCmdDebug(),
+		proxy.NewCmdProxy(),
 		&cobra.Command{
 			Use:   "runtime-info",
 			Short: "Show runtime information",
-			Long:  "Show some information about the runtime environment (e.g. docker info)",
+			Long:  "Show some information about the runtime environment (e.g. docker info) and why the runtime was selected",
 			Run: func(cmd *cobra.Command, args []string) {
 				info, err := runtimes.SelectedRuntime.Info()
 				if err != nil {
 					l.Log().Fatalln(err)
 				}
-				err = util.NewYAMLEncoder(os.Stdout).Encode(info)
+				type runtimeSelectionInfo struct {
+					Name     string                   `json:"name"`
+					Source   runtimes.SelectionSource `json:"source"`
+					Reason   string                   `json:"reason"`
+					Endpoint string                   `json:"endpoint,omitempty"`
+					Timeout  string                   `json:"timeout,omitempty"`
+					TLS      *runtimeTypes.TLSOpts    `json:"tls,omitempty"`
+				}
+				selection := runtimes.CurrentSelection
+				output := struct {
+					*runtimeTypes.RuntimeInfo
+					Selection runtimeSelectionInfo `json:"selection"`
+				}{
+					RuntimeInfo: info,
+					Selection: runtimeSelectionInfo{
+						Name:     selection.Name,
+						Source:   selection.Source,
+						Reason:   selection.Reason(),
+						Endpoint: selection.Connection.Endpoint,
+					},
+				}
+				if selection.Connection.Timeout > 0 {
+					output.Selection.Timeout = selection.Connection.Timeout.String()
+				}
+				if selection.Connection.TLS != (runtimeTypes.TLSOpts{}) {
+					output.Selection.TLS = &selection.Connection.TLS
+				}
+				err = util.NewYAMLEncoder(os.Stdout).Encode(output)
 				if err != nil {
 					l.Log().Fatalln(err)
 				}
@@ -201,12 +240,13 @@ func initLogging() {
 }
 
 func initRuntime() {
-	runtime, err := runtimes.GetRuntime("docker")
-	if err != nil {
+	selection := runtimes.ResolveSelection(flags.runtime, os.Getenv(k3d.K3dEnvRuntime), "")
+	selection.Connection = flags.runtimeConnection
+	if err := runtimes.Select(selection); err != nil {
 		l.Log().Fatalln(err)
 	}
-	runtimes.SelectedRuntime = runtime
-	if rtinfo, err := runtime.Info(); err == nil {
+	l.Log().Debugf("Selected runtime '%s' (%s)", selection.Name, selection.Reason())
+	if rtinfo, err := runtimes.SelectedRuntime.Info(); err == nil {
 		l.Log().Debugf("Runtime Info:\n%+v", rtinfo)
 	}
 }
@@ -34,7 +34,9 @@ import (
 
 	"github.com/k3d-io/k3d/v5/cmd/util"
 	"github.com/k3d-io/k3d/v5/pkg/config"
+	conf "github.com/k3d-io/k3d/v5/pkg/config/v1alpha5"
 	l "github.com/k3d-io/k3d/v5/pkg/logger"
+	"github.com/k3d-io/k3d/v5/pkg/runtimes"
 )
 
 func InitViperWithConfigFile(cfgViper *viper.Viper, configFile string) error {
@@ -112,3 +114,13 @@ func InitViperWithConfigFile(cfgViper *viper.Viper, configFile string) error {
 	}
 	return nil
 }
+
+// SelectRuntime selects the runtime and its connection settings from a config file (options.runtime),
+// unless they were set via flags or environment variable, so every command reading a config file uses the same runtime
+func SelectRuntime(simpleCfg conf.SimpleConfig) error {
+	if err := runtimes.SelectFromConfig(simpleCfg.Options.Runtime.Name, config.TransformRuntimeConnections(simpleCfg)); err != nil {
+		return fmt.Errorf("failed to select runtime from config: %w", err)
+	}
+	l.Log().Debugf("Using runtime '%s' (%s)", runtimes.CurrentSelection.Name, runtimes.CurrentSelection.Reason())
+	return nil
+}
@@ -113,9 +113,19 @@ func ParsePortExposureSpec(exposedPortSpec, internalPort string, enforcePortMatc
 	return api, nil
 }
 
-// ValidatePortMap validates a port mapping
+// ValidatePortMap validates a port mapping, which may also map a range of ports
+// (e.g. `30000-30100:30000-30100`, where host and container port ranges must have the same size)
 func ValidatePortMap(portmap string) (string, error) {
-	return portmap, nil // TODO: ValidatePortMap: add validation of port mapping
+	portmappings, err := nat.ParsePortSpec(portmap)
+	if err != nil {
+		return "", fmt.Errorf("invalid port mapping '%s' (Format: `[HOST:][HOSTPORT[-HOSTPORT]:]CONTAINERPORT[-CONTAINERPORT][/PROTOCOL]`): %w", portmap, err)
+	}
+	for _, pm := range portmappings {
+		if pm.Port.Int() == 0 {
+			return "", fmt.Errorf("invalid port mapping '%s': container port must not be 0", portmap)
+		}
+	}
+	return portmap, nil
 }
 
 // GetFreePort tries to fetch an open port from the OS-Kernel
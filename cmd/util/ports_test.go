@@ -27,3 +27,15 @@ func Test_ParsePortExposureSpec_PortMatchEnforcement(t *testing.T) {
 	require.Nil(t, err)
 	require.Equal(t, strings.Split(string(r.Port), "/")[0], string(r.Binding.HostPort))
 }
+
+func Test_ValidatePortMap(t *testing.T) {
+	for _, portmap := range []string{"8080:80", "80", "127.0.0.1:8080:80/udp", "30000-30100:30000-30100", "30000-30100", "8000-8100:80"} {
+		_, err := ValidatePortMap(portmap)
+		require.Nil(t, err, portmap)
+	}
+
+	for _, portmap := range []string{"", "8080:", "30000-30100:30000-30010", "30100-30000:30100-30000", "8080:70000", "0"} {
+		_, err := ValidatePortMap(portmap)
+		require.NotNil(t, err, portmap)
+	}
+}
@@ -0,0 +1,76 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package util
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	conf "github.com/k3d-io/k3d/v5/pkg/config/v1alpha5"
+)
+
+// ParseLoadbalancerRouteFlag parses a loadbalancer route given on the command line
+// (Format: `host=HOST,port=PORT[,path=PATH][,listen=[HOST:][HOSTPORT:]CONTAINERPORT][,cert=FILE,key=FILE][@NODEFILTER[;NODEFILTER...]]`)
+func ParseLoadbalancerRouteFlag(flag string) (*conf.LoadbalancerRouteWithNodeFilters, error) {
+	spec, nodeFilters, err := SplitFiltersFromFlag(flag)
+	if err != nil {
+		return nil, err
+	}
+
+	route := &conf.LoadbalancerRouteWithNodeFilters{
+		NodeFilters: nodeFilters,
+	}
+
+	for _, field := range strings.Split(spec, ",") {
+		key, value, found := strings.Cut(field, "=")
+		if !found || value == "" {
+			return nil, fmt.Errorf("invalid loadbalancer route '%s': '%s' is not of the form KEY=VALUE", flag, field)
+		}
+		switch strings.TrimSpace(key) {
+		case "host":
+			route.Host = value
+		case "path":
+			route.Path = value
+		case "port":
+			port, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid loadbalancer route '%s': port '%s' is not a number", flag, value)
+			}
+			route.Port = port
+		case "listen":
+			route.Listen = value
+		case "cert":
+			route.TLS.Cert = value
+		case "key":
+			route.TLS.Key = value
+		default:
+			return nil, fmt.Errorf("invalid loadbalancer route '%s': unknown key '%s' (allowed: host, path, port, listen, cert, key)", flag, key)
+		}
+	}
+
+	if route.Host == "" || route.Port == 0 {
+		return nil, fmt.Errorf("invalid loadbalancer route '%s': host and port are required", flag)
+	}
+
+	return route, nil
+}
@@ -0,0 +1,38 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ParseLoadbalancerRouteFlag(t *testing.T) {
+	r, err := ParseLoadbalancerRouteFlag("host=app.localhost,port=8080")
+	require.Nil(t, err)
+	require.Equal(t, "app.localhost", r.Host)
+	require.Equal(t, 8080, r.Port)
+	require.Equal(t, "", r.Path)
+	require.Equal(t, "", r.Listen)
+	require.Nil(t, r.NodeFilters)
+
+	r, err = ParseLoadbalancerRouteFlag("host=app.localhost,path=/api,port=30080,listen=8443:443,cert=tls.crt,key=tls.key@agent:*;server:0")
+	require.Nil(t, err)
+	require.Equal(t, "/api", r.Path)
+	require.Equal(t, 30080, r.Port)
+	require.Equal(t, "8443:443", r.Listen)
+	require.Equal(t, "tls.crt", r.TLS.Cert)
+	require.Equal(t, "tls.key", r.TLS.Key)
+	require.Equal(t, []string{"agent:*", "server:0"}, r.NodeFilters)
+
+	_, err = ParseLoadbalancerRouteFlag("host=app.localhost")
+	require.NotNil(t, err)
+
+	_, err = ParseLoadbalancerRouteFlag("host=app.localhost,port=http")
+	require.NotNil(t, err)
+
+	_, err = ParseLoadbalancerRouteFlag("host=app.localhost,port=80,tls=true")
+	require.NotNil(t, err)
+
+	_, err = ParseLoadbalancerRouteFlag("app.localhost:80")
+	require.NotNil(t, err)
+}
@@ -22,14 +22,18 @@ THE SOFTWARE.
 package actions
 
 import (
+	"archive/tar"
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"strings"
 
 	"github.com/k3d-io/k3d/v5/pkg/runtimes"
+	runtimeErr "github.com/k3d-io/k3d/v5/pkg/runtimes/errors"
 	k3d "github.com/k3d-io/k3d/v5/pkg/types"
 	"github.com/k3d-io/k3d/v5/pkg/util"
 
@@ -60,6 +64,35 @@ func (act WriteFileAction) Info() string {
 	return fmt.Sprintf("[%s] Writing %d bytes to %s (mode %s): %s", act.Name(), len(act.Content), act.Dest, act.Mode.String(), act.Description)
 }
 
+// WriteHostFileAction writes a file from the host into the node filesystem.
+// The file is only read when the action runs, so that large files (e.g. a restored datastore) are not kept in memory until then.
+type WriteHostFileAction struct {
+	Runtime     runtimes.Runtime
+	Src         string
+	Dest        string
+	Mode        os.FileMode
+	Description string
+}
+
+func (act WriteHostFileAction) Run(ctx context.Context, node *k3d.Node) error {
+	content, err := os.ReadFile(act.Src)
+	if err != nil {
+		return fmt.Errorf("failed to read '%s': %w", act.Src, err)
+	}
+	return act.Runtime.WriteToNode(ctx, content, act.Dest, act.Mode, node)
+}
+
+func (act WriteHostFileAction) Name() string {
+	return "WriteHostFileAction"
+}
+
+func (act WriteHostFileAction) Info() string {
+	if act.Description == "" {
+		act.Description = "<no description>"
+	}
+	return fmt.Sprintf("[%s] Writing %s to %s (mode %s): %s", act.Name(), act.Src, act.Dest, act.Mode.String(), act.Description)
+}
+
 // RewriteFileAction takes an existing file from the node filesystem and rewrites it using a specified rewrite function
 type RewriteFileAction struct {
 	Runtime     runtimes.Runtime
@@ -170,3 +203,63 @@ func (act ExecAction) Run(ctx context.Context, node *k3d.Node) error {
 	}
 	return nil
 }
+
+// CopyFromNodeAction copies files and directories from another (e.g. stopped) node into the node filesystem
+type CopyFromNodeAction struct {
+	Runtime     runtimes.Runtime
+	Source      *k3d.Node // evaluated when the action runs, so it may be renamed in the meantime
+	Paths       []string  // paths that don't exist on the source node are skipped
+	Description string
+}
+
+func (act CopyFromNodeAction) Name() string {
+	return "CopyFromNodeAction"
+}
+
+func (act CopyFromNodeAction) Info() string {
+	if act.Description == "" {
+		act.Description = "<no description>"
+	}
+	return fmt.Sprintf("[%s] Copying %s from node %s: %s", act.Name(), strings.Join(act.Paths, ", "), act.Source.Name, act.Description)
+}
+
+func (act CopyFromNodeAction) Run(ctx context.Context, node *k3d.Node) error {
+	for _, p := range act.Paths {
+		reader, err := act.Runtime.ReadFromNode(ctx, p, act.Source)
+		if err != nil {
+			if errors.Is(err, runtimeErr.ErrRuntimeFileNotFound) {
+				l.Log().Debugf("Not copying '%s' from node '%s' as it doesn't exist", p, act.Source.Name)
+				continue
+			}
+			return fmt.Errorf("runtime failed to read '%s' from node '%s': %w", p, act.Source.Name, err)
+		}
+
+		tarReader := tar.NewReader(reader)
+		for {
+			header, err := tarReader.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				reader.Close()
+				return fmt.Errorf("failed to read '%s' from node '%s': %w", p, act.Source.Name, err)
+			}
+			if header.Typeflag != tar.TypeReg {
+				continue
+			}
+			content, err := io.ReadAll(tarReader)
+			if err != nil {
+				reader.Close()
+				return fmt.Errorf("failed to read '%s' from node '%s': %w", header.Name, act.Source.Name, err)
+			}
+			// entries are relative to the parent directory of the requested path
+			dest := path.Join(path.Dir(p), header.Name)
+			if err := act.Runtime.WriteToNode(ctx, content, dest, os.FileMode(header.Mode)&os.ModePerm, node); err != nil {
+				reader.Close()
+				return fmt.Errorf("failed to write '%s' to node '%s': %w", dest, node.Name, err)
+			}
+		}
+		reader.Close()
+	}
+	return nil
+}
@@ -0,0 +1,830 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package client
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/docker/go-connections/nat"
+	"k8s.io/utils/strings/slices"
+
+	"github.com/k3d-io/k3d/v5/pkg/actions"
+	config "github.com/k3d-io/k3d/v5/pkg/config/v1alpha5"
+	l "github.com/k3d-io/k3d/v5/pkg/logger"
+	k3drt "github.com/k3d-io/k3d/v5/pkg/runtimes"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+	"github.com/k3d-io/k3d/v5/pkg/types/k3s"
+)
+
+// ClusterPlan compares an existing cluster (as returned by ClusterGet) with the desired cluster config
+// and returns the node adds, replacements and deletions (and other changes) needed to reconcile them.
+// Existing nodes are matched with the desired ones by name first and then by role in order of their index.
+func ClusterPlan(ctx context.Context, runtime k3drt.Runtime, cluster *k3d.Cluster, desired *config.ClusterConfig) (*k3d.ClusterApplyPlan, error) {
+	manifest, err := ClusterSnapshotManifest(ctx, runtime, cluster)
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe cluster '%s': %w", cluster.Name, err)
+	}
+
+	if err := clusterPlanCheckImmutable(manifest, desired); err != nil {
+		return nil, err
+	}
+
+	plan := &k3d.ClusterApplyPlan{Cluster: cluster.Name, Actions: []k3d.ClusterApplyAction{}}
+
+	liveNodes := map[string]*k3d.Node{}
+	for _, node := range cluster.Nodes {
+		liveNodes[node.Name] = node
+	}
+
+	/*
+	 * Nodes
+	 */
+
+	desiredNodes := NodeFilterByRoles(desired.Nodes, []k3d.Role{k3d.ServerRole, k3d.AgentRole}, nil)
+	pairs, added, deleted := clusterPlanPairNodes(manifest.Nodes, desiredNodes)
+
+	// names of the desired nodes in the resulting cluster (matched nodes keep their name)
+	nodeNames := map[string]string{}
+
+	for _, pair := range pairs {
+		nodeNames[pair.desired.Name] = pair.live.Name
+		changes := diffNodeSpecs(pair.live, desiredNodeSpec(pair.desired))
+		if len(changes) == 0 {
+			continue
+		}
+		replacement, err := replacementNode(liveNodes[pair.live.Name], pair.desired)
+		if err != nil {
+			return nil, err
+		}
+		plan.Actions = append(plan.Actions, k3d.ClusterApplyAction{
+			Type:    k3d.ClusterApplyActionReplaceNode,
+			Target:  pair.live.Name,
+			Role:    pair.live.Role,
+			Changes: changes,
+			Node:    replacement,
+		})
+	}
+
+	for _, node := range added {
+		if node.Role == k3d.ServerRole && manifest.Datastore == k3d.ClusterSnapshotDatastoreSQLite {
+			return nil, fmt.Errorf("cannot add server node '%s': cluster '%s' doesn't use embedded etcd (it was created with a single server)", node.Name, cluster.Name)
+		}
+		nodeNames[node.Name] = node.Name
+		plan.Actions = append(plan.Actions, k3d.ClusterApplyAction{
+			Type:    k3d.ClusterApplyActionAddNode,
+			Target:  node.Name,
+			Role:    node.Role,
+			Changes: diffNodeSpecs(k3d.ClusterSnapshotNode{}, desiredNodeSpec(node)),
+			Node:    node,
+		})
+	}
+
+	for _, node := range deleted {
+		plan.Actions = append(plan.Actions, k3d.ClusterApplyAction{
+			Type:   k3d.ClusterApplyActionDeleteNode,
+			Target: node.Name,
+			Role:   node.Role,
+			Node:   liveNodes[node.Name],
+		})
+	}
+
+	/*
+	 * Loadbalancer
+	 */
+
+	if manifest.Loadbalancer != nil && desired.ServerLoadBalancer != nil && desired.ServerLoadBalancer.Node != nil && desired.ServerLoadBalancer.Config != nil {
+		plan.LoadbalancerPorts = nat.PortMap{}
+		for port, bindings := range desired.ServerLoadBalancer.Node.Ports {
+			if port.Port() != k3d.DefaultAPIPort {
+				plan.LoadbalancerPorts[port] = bindings
+			}
+		}
+
+		plan.LoadbalancerConfig = &k3d.LoadbalancerConfig{
+			Ports:    map[string][]string{},
+			Settings: desired.ServerLoadBalancer.Config.Settings,
+		}
+		for port, targets := range desired.ServerLoadBalancer.Config.Ports {
+			for _, target := range targets {
+				if name, ok := nodeNames[target]; ok {
+					target = name
+				}
+				plan.LoadbalancerConfig.Ports[port] = append(plan.LoadbalancerConfig.Ports[port], target)
+			}
+		}
+		for _, server := range desired.ServerLoadBalancer.Config.HTTP {
+			routes := []k3d.LoadbalancerHTTPRoute{}
+			for _, route := range server.Routes {
+				targets := []string{}
+				for _, target := range route.Nodes {
+					if name, ok := nodeNames[target]; ok {
+						target = name
+					}
+					targets = append(targets, target)
+				}
+				route.Nodes = targets
+				routes = append(routes, route)
+			}
+			server.Routes = routes
+			plan.LoadbalancerConfig.HTTP = append(plan.LoadbalancerConfig.HTTP, server)
+		}
+		for _, file := range desired.ServerLoadBalancer.Node.Files {
+			if strings.HasPrefix(file.Destination, k3d.DefaultLoadbalancerCertsPath+"/") {
+				plan.LoadbalancerFiles = append(plan.LoadbalancerFiles, file)
+			}
+		}
+		plan.LoadbalancerConfig.Settings.Upstreams = nil
+		for port, nodeOpts := range desired.ServerLoadBalancer.Config.Settings.Upstreams {
+			for target, opts := range nodeOpts {
+				if name, ok := nodeNames[target]; ok {
+					target = name
+				}
+				loadbalancerSetUpstreamOptions(plan.LoadbalancerConfig, port, target, opts)
+			}
+		}
+		if plan.LoadbalancerConfig.Settings.WorkerConnections == k3d.DefaultLoadbalancerWorkerConnections {
+			// not configured explicitly, so keep what k3d calculated for the cluster
+			plan.LoadbalancerConfig.Settings.WorkerConnections = manifest.Loadbalancer.Config.Settings.WorkerConnections
+		}
+
+		if changes := diffLoadbalancer(manifest.Loadbalancer.Ports, &manifest.Loadbalancer.Config, plan.LoadbalancerPorts, plan.LoadbalancerConfig); len(changes) > 0 {
+			lbName := ""
+			if cluster.ServerLoadBalancer != nil && cluster.ServerLoadBalancer.Node != nil {
+				lbName = cluster.ServerLoadBalancer.Node.Name
+			}
+			plan.Actions = append(plan.Actions, k3d.ClusterApplyAction{
+				Type:    k3d.ClusterApplyActionUpdateLoadbalancer,
+				Target:  lbName,
+				Role:    k3d.LoadBalancerRole,
+				Changes: changes,
+			})
+		}
+	}
+
+	/*
+	 * Registries
+	 */
+
+	// registries managed by the cluster (create, mirrors) are kept, if they exist already
+	managedRegistries := desired.ClusterCreateOpts.Registries.Mirrors
+	if desired.ClusterCreateOpts.Registries.Create != nil {
+		managedRegistries = append([]*k3d.Registry{desired.ClusterCreateOpts.Registries.Create}, managedRegistries...)
+	}
+	desiredRegistries := []string{}
+	for _, reg := range managedRegistries {
+		if !slices.Contains(manifest.Registries, reg.Host) {
+			l.Log().Warnf("Ignoring registry '%s' to be created: apply only connects existing registries", reg.Host)
+			continue
+		}
+		desiredRegistries = append(desiredRegistries, reg.Host)
+	}
+	for _, reg := range desired.ClusterCreateOpts.Registries.Use {
+		desiredRegistries = append(desiredRegistries, reg.Host)
+		if !slices.Contains(manifest.Registries, reg.Host) {
+			plan.Actions = append(plan.Actions, k3d.ClusterApplyAction{
+				Type:   k3d.ClusterApplyActionConnectRegistry,
+				Target: reg.Host,
+				Role:   k3d.RegistryRole,
+			})
+		}
+	}
+	for _, reg := range manifest.Registries {
+		if !slices.Contains(desiredRegistries, reg) {
+			plan.Actions = append(plan.Actions, k3d.ClusterApplyAction{
+				Type:   k3d.ClusterApplyActionDisconnectRegistry,
+				Target: reg,
+				Role:   k3d.RegistryRole,
+			})
+		}
+	}
+
+	return plan, nil
+}
+
+// clusterPlanCheckImmutable returns an error if the desired config changes settings that can only be set on cluster creation
+func clusterPlanCheckImmutable(manifest *k3d.ClusterSnapshot, desired *config.ClusterConfig) error {
+	immutable := []string{}
+	if desired.Network.External && desired.Network.Name != manifest.Network.Name {
+		immutable = append(immutable, fmt.Sprintf("network (%s -> %s)", manifest.Network.Name, desired.Network.Name))
+	}
+	if desired.Network.IPAM.IPPrefix.IsValid() && desired.Network.IPAM.IPPrefix.String() != manifest.Network.Subnet {
+		immutable = append(immutable, fmt.Sprintf("subnet (%s -> %s)", manifest.Network.Subnet, desired.Network.IPAM.IPPrefix))
+	}
+	if desired.Token != "" && desired.Token != manifest.Token {
+		immutable = append(immutable, "token")
+	}
+	if desired.KubeAPI != nil && desired.KubeAPI.Binding.HostPort != "" && desired.KubeAPI.Binding.HostPort != manifest.KubeAPI.HostPort {
+		immutable = append(immutable, fmt.Sprintf("kubeAPI host port (%s -> %s)", manifest.KubeAPI.HostPort, desired.KubeAPI.Binding.HostPort))
+	}
+	if desired.ClusterCreateOpts.DisableLoadBalancer != (manifest.Loadbalancer == nil) {
+		immutable = append(immutable, "loadbalancer (enabled/disabled)")
+	}
+	if manifest.Loadbalancer != nil && desired.ServerLoadBalancer != nil && desired.ServerLoadBalancer.Node != nil {
+		if liveMode, desiredMode := loadbalancerSnapshotMode(manifest.Loadbalancer), desired.ServerLoadBalancer.Node.LoadbalancerMode(); liveMode != desiredMode {
+			immutable = append(immutable, fmt.Sprintf("loadbalancer mode (%s -> %s)", liveMode, desiredMode))
+		}
+	}
+	liveLBs, desiredLBs := []string{}, []string{}
+	for _, lb := range manifest.Loadbalancers {
+		liveLBs = append(liveLBs, lb.Name)
+	}
+	for _, lb := range desired.Loadbalancers {
+		desiredLBs = append(desiredLBs, lb.Node.RuntimeLabels[k3d.LabelLoadbalancerName])
+	}
+	sort.Strings(liveLBs)
+	sort.Strings(desiredLBs)
+	if !slices.Equal(liveLBs, desiredLBs) {
+		immutable = append(immutable, fmt.Sprintf("named loadbalancers (%s -> %s)", strings.Join(liveLBs, ","), strings.Join(desiredLBs, ",")))
+	}
+	if desired.ClusterCreateOpts.DisableImageVolume == manifest.ImageVolume {
+		immutable = append(immutable, "image volume (enabled/disabled)")
+	}
+	if len(immutable) > 0 {
+		return fmt.Errorf("the following settings can only be set when creating cluster '%s' (recreate it instead): %s", manifest.Name, strings.Join(immutable, ", "))
+	}
+	return nil
+}
+
+// loadbalancerSnapshotMode returns the mode of a captured loadbalancer
+func loadbalancerSnapshotMode(lb *k3d.ClusterSnapshotLoadbalancer) k3d.LoadbalancerMode {
+	if lb.Mode == "" {
+		return k3d.LoadbalancerModeNginx
+	}
+	return lb.Mode
+}
+
+type clusterPlanNodePair struct {
+	live    k3d.ClusterSnapshotNode
+	desired *k3d.Node
+}
+
+// clusterPlanPairNodes matches existing and desired nodes by name and then by role in order of their index
+func clusterPlanPairNodes(live []k3d.ClusterSnapshotNode, desired []*k3d.Node) ([]clusterPlanNodePair, []*k3d.Node, []k3d.ClusterSnapshotNode) {
+	sortedLive := append([]k3d.ClusterSnapshotNode{}, live...)
+	sort.SliceStable(sortedLive, func(i, j int) bool {
+		if len(sortedLive[i].Name) != len(sortedLive[j].Name) {
+			return len(sortedLive[i].Name) < len(sortedLive[j].Name)
+		}
+		return sortedLive[i].Name < sortedLive[j].Name
+	})
+
+	pairs := []clusterPlanNodePair{}
+	pairedLive := map[string]bool{}
+	unpaired := []*k3d.Node{}
+	for _, node := range desired {
+		found := false
+		for _, liveNode := range sortedLive {
+			if liveNode.Name == node.Name && liveNode.Role == node.Role && !pairedLive[liveNode.Name] {
+				pairs = append(pairs, clusterPlanNodePair{live: liveNode, desired: node})
+				pairedLive[liveNode.Name] = true
+				found = true
+				break
+			}
+		}
+		if !found {
+			unpaired = append(unpaired, node)
+		}
+	}
+
+	added := []*k3d.Node{}
+	for _, node := range unpaired {
+		found := false
+		for _, liveNode := range sortedLive {
+			if liveNode.Role == node.Role && !pairedLive[liveNode.Name] {
+				pairs = append(pairs, clusterPlanNodePair{live: liveNode, desired: node})
+				pairedLive[liveNode.Name] = true
+				found = true
+				break
+			}
+		}
+		if !found {
+			added = append(added, node)
+		}
+	}
+
+	deleted := []k3d.ClusterSnapshotNode{}
+	for _, liveNode := range sortedLive {
+		if !pairedLive[liveNode.Name] {
+			deleted = append(deleted, liveNode)
+		}
+	}
+
+	return pairs, added, deleted
+}
+
+// desiredNodeSpec describes a node from a cluster config the same way ClusterSnapshotManifest describes existing nodes
+func desiredNodeSpec(node *k3d.Node) k3d.ClusterSnapshotNode {
+	spec := k3d.ClusterSnapshotNode{
+		Name:    node.Name,
+		Role:    node.Role,
+		Image:   node.Image,
+		Args:    append([]string{}, node.Args...),
+		Env:     append([]string{}, node.Env...),
+		Volumes: append([]string{}, node.Volumes...),
+		Ports:   node.Ports,
+		Memory:  normalizeNodeMemory(node.Memory, false),
+		CPUs:    normalizeNodeCPUs(node.CPUs),
+		CPUSet:  node.CPUSet,
+	}
+	spec.RuntimeLabels = userRuntimeLabels(node.RuntimeLabels)
+	for k, v := range node.K3sNodeLabels {
+		spec.Args = append(spec.Args, "--node-label", fmt.Sprintf("%s=%s", k, v))
+	}
+	return spec
+}
+
+// diffNodeSpecs returns the human readable changes between two node specs
+func diffNodeSpecs(current, desired k3d.ClusterSnapshotNode) []string {
+	changes := []string{}
+	if current.Image != desired.Image {
+		changes = append(changes, fmt.Sprintf("~ image %s -> %s", valueOrNone(current.Image), desired.Image))
+	}
+	if current.Memory != desired.Memory {
+		changes = append(changes, fmt.Sprintf("~ memory %s -> %s", valueOrNone(current.Memory), valueOrNone(desired.Memory)))
+	}
+	if current.CPUs != desired.CPUs {
+		changes = append(changes, fmt.Sprintf("~ cpus %s -> %s", valueOrNone(current.CPUs), valueOrNone(desired.CPUs)))
+	}
+	if current.CPUSet != desired.CPUSet {
+		changes = append(changes, fmt.Sprintf("~ cpuset %s -> %s", valueOrNone(current.CPUSet), valueOrNone(desired.CPUSet)))
+	}
+
+	currentArgs, currentLabels := SplitK3sArgs(current.Args)
+	desiredArgs, desiredLabels := SplitK3sArgs(desired.Args)
+	changes = append(changes, diffStringSets("arg", currentArgs, desiredArgs)...)
+	changes = append(changes, diffStringSets("node-label", currentLabels, desiredLabels)...)
+	changes = append(changes, diffStringSets("env", current.Env, desired.Env)...)
+	changes = append(changes, diffStringSets("runtime-label", labelSpecs(current.RuntimeLabels), labelSpecs(desired.RuntimeLabels))...)
+	changes = append(changes, diffStringSets("volume", current.Volumes, desired.Volumes)...)
+	changes = append(changes, diffStringSets("port", portMapSpecs(withoutAPIPort(current)), portMapSpecs(withoutAPIPort(desired)))...)
+
+	return changes
+}
+
+// withoutAPIPort returns the ports of a node without the Kubernetes API port, which k3d exposes on servers if the loadbalancer is disabled
+func withoutAPIPort(node k3d.ClusterSnapshotNode) nat.PortMap {
+	ports := nat.PortMap{}
+	for port, bindings := range node.Ports {
+		if node.Role == k3d.ServerRole && port.Port() == k3d.DefaultAPIPort {
+			continue
+		}
+		ports[port] = bindings
+	}
+	return ports
+}
+
+// diffLoadbalancer returns the human readable changes between two loadbalancer specs
+func diffLoadbalancer(currentPorts nat.PortMap, currentConfig *k3d.LoadbalancerConfig, desiredPorts nat.PortMap, desiredConfig *k3d.LoadbalancerConfig) []string {
+	current := nat.PortMap{}
+	for port, bindings := range currentPorts {
+		if port.Port() != k3d.DefaultAPIPort {
+			current[port] = bindings
+		}
+	}
+	changes := diffStringSets("port", portMapSpecs(current), portMapSpecs(desiredPorts))
+
+	portKeys := []string{}
+	for port := range currentConfig.Ports {
+		portKeys = append(portKeys, port)
+	}
+	for port := range desiredConfig.Ports {
+		if _, ok := currentConfig.Ports[port]; !ok {
+			portKeys = append(portKeys, port)
+		}
+	}
+	sort.Strings(portKeys)
+	for _, port := range portKeys {
+		currentTargets := append([]string{}, currentConfig.Ports[port]...)
+		desiredTargets := append([]string{}, desiredConfig.Ports[port]...)
+		sort.Strings(currentTargets)
+		sort.Strings(desiredTargets)
+		if strings.Join(currentTargets, ",") != strings.Join(desiredTargets, ",") {
+			changes = append(changes, fmt.Sprintf("~ proxy %s -> [%s] (was [%s])", port, strings.Join(desiredTargets, ", "), strings.Join(currentTargets, ", ")))
+		}
+	}
+
+	changes = append(changes, diffStringSets("route", loadbalancerRouteSpecs(currentConfig), loadbalancerRouteSpecs(desiredConfig))...)
+	changes = append(changes, diffStringSets("upstream", loadbalancerUpstreamSpecs(currentConfig), loadbalancerUpstreamSpecs(desiredConfig))...)
+	changes = append(changes, diffStringSets("port option", loadbalancerPortOptionSpecs(currentConfig), loadbalancerPortOptionSpecs(desiredConfig))...)
+
+	if currentConfig.Settings.WorkerConnections != desiredConfig.Settings.WorkerConnections {
+		changes = append(changes, fmt.Sprintf("~ settings.workerConnections %d -> %d", currentConfig.Settings.WorkerConnections, desiredConfig.Settings.WorkerConnections))
+	}
+	if currentConfig.Settings.DefaultProxyTimeout != desiredConfig.Settings.DefaultProxyTimeout {
+		changes = append(changes, fmt.Sprintf("~ settings.defaultProxyTimeout %d -> %d", currentConfig.Settings.DefaultProxyTimeout, desiredConfig.Settings.DefaultProxyTimeout))
+	}
+	return changes
+}
+
+// loadbalancerRouteSpecs returns the HTTP(S) routes of a loadbalancer config in a comparable form
+func loadbalancerRouteSpecs(lbConfig *k3d.LoadbalancerConfig) []string {
+	specs := []string{}
+	for _, server := range lbConfig.HTTP {
+		scheme := "http"
+		if server.TLS != nil {
+			scheme = "https"
+		}
+		for _, route := range server.Routes {
+			targets := append([]string{}, route.Nodes...)
+			sort.Strings(targets)
+			specs = append(specs, fmt.Sprintf("%s://%s:%d%s -> %d [%s]", scheme, server.Host, server.Listen, route.Path, route.Port, strings.Join(targets, ", ")))
+		}
+	}
+	sort.Strings(specs)
+	return specs
+}
+
+// loadbalancerUpstreamSpecs returns the upstream options of a loadbalancer config in a comparable form
+func loadbalancerUpstreamSpecs(lbConfig *k3d.LoadbalancerConfig) []string {
+	specs := []string{}
+	for port, nodeOpts := range lbConfig.Settings.Upstreams {
+		for nodeName, opts := range nodeOpts {
+			spec := fmt.Sprintf("%s %s:", port, nodeName)
+			if opts.Weight != 0 {
+				spec += fmt.Sprintf(" weight=%d", opts.Weight)
+			}
+			if opts.MaxFails != nil {
+				spec += fmt.Sprintf(" maxFails=%d", *opts.MaxFails)
+			}
+			if opts.FailTimeout != "" {
+				spec += fmt.Sprintf(" failTimeout=%s", opts.FailTimeout)
+			}
+			if opts.Backup {
+				spec += " backup"
+			}
+			if opts.Down {
+				spec += " down"
+			}
+			specs = append(specs, spec)
+		}
+	}
+	sort.Strings(specs)
+	return specs
+}
+
+// loadbalancerPortOptionSpecs returns the port options of a loadbalancer config in a comparable form
+func loadbalancerPortOptionSpecs(lbConfig *k3d.LoadbalancerConfig) []string {
+	specs := []string{}
+	for port, opts := range lbConfig.Settings.PortOptions {
+		if opts.ProxyProtocol {
+			specs = append(specs, fmt.Sprintf("%s proxyProtocol", port))
+		}
+	}
+	sort.Strings(specs)
+	return specs
+}
+
+// diffStringSets returns the added (+) and removed (-) values, ignoring their order
+func diffStringSets(kind string, current, desired []string) []string {
+	changes := []string{}
+	for _, value := range current {
+		if !slices.Contains(desired, value) {
+			changes = append(changes, fmt.Sprintf("- %s %s", kind, value))
+		}
+	}
+	for _, value := range desired {
+		if !slices.Contains(current, value) {
+			changes = append(changes, fmt.Sprintf("+ %s %s", kind, value))
+		}
+	}
+	return changes
+}
+
+// portMapSpecs formats port mappings like they're passed to --port ([HOST:][HOSTPORT:]CONTAINERPORT/PROTOCOL)
+func portMapSpecs(portMap nat.PortMap) []string {
+	specs := []string{}
+	for port, bindings := range portMap {
+		if len(bindings) == 0 {
+			bindings = []nat.PortBinding{{}}
+		}
+		for _, binding := range bindings {
+			spec := string(port)
+			if binding.HostPort != "" {
+				spec = fmt.Sprintf("%s:%s", binding.HostPort, spec)
+				if binding.HostIP != "" && binding.HostIP != "0.0.0.0" {
+					spec = fmt.Sprintf("%s:%s", binding.HostIP, spec)
+				}
+			}
+			specs = append(specs, spec)
+		}
+	}
+	sort.Strings(specs)
+	return specs
+}
+
+// labelSpecs returns the labels as sorted key=value pairs
+func labelSpecs(labels map[string]string) []string {
+	specs := []string{}
+	for k, v := range labels {
+		specs = append(specs, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(specs)
+	return specs
+}
+
+func valueOrNone(value string) string {
+	if value == "" {
+		return "<none>"
+	}
+	return value
+}
+
+// replacementNode creates the spec for a replacement of an existing node with the settings of the desired node.
+// Everything that k3d generates for the existing node (cluster labels, K3S_URL, image volume, ...) is kept.
+func replacementNode(existing *k3d.Node, desired *k3d.Node) (*k3d.Node, error) {
+	node, err := CopyNode(context.Background(), existing, CopyNodeOpts{keepState: false})
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy node '%s': %w", existing.Name, err)
+	}
+
+	node.Image = desired.Image
+	node.Memory = desired.Memory
+	node.CPUs = desired.CPUs
+	node.CPUSet = desired.CPUSet
+	node.HookActions = nil
+	node.K3sNodeLabels = desired.K3sNodeLabels
+
+	// runtime labels: the ones k3d generates for the existing node and the ones set for the desired node
+	for k := range userRuntimeLabels(existing.RuntimeLabels) {
+		delete(node.RuntimeLabels, k)
+	}
+	for k, v := range userRuntimeLabels(desired.RuntimeLabels) {
+		if node.RuntimeLabels == nil {
+			node.RuntimeLabels = map[string]string{}
+		}
+		node.RuntimeLabels[k] = v
+	}
+
+	// command: the role and the flags that k3d sets (the TLS SANs are added again on creation)
+	node.Cmd = []string{}
+	if len(existing.Cmd) > 0 {
+		node.Cmd = append(node.Cmd, existing.Cmd[0])
+	}
+	for _, flag := range k3d.DoNotCopyServerFlags {
+		if slices.Contains(existing.Cmd, flag) {
+			node.Cmd = append(node.Cmd, flag)
+		}
+	}
+	node.Args = append([]string{}, desired.Args...)
+
+	node.Env = []string{}
+	for _, env := range existing.Env {
+		if strings.HasPrefix(env, k3s.EnvClusterToken+"=") || strings.HasPrefix(env, k3s.EnvClusterConnectURL+"=") {
+			node.Env = append(node.Env, env)
+		}
+	}
+	node.Env = append(node.Env, desired.Env...)
+
+	node.Volumes = []string{}
+	for _, volume := range existing.Volumes {
+		if strings.HasSuffix(volume, ":"+k3d.DefaultImageVolumeMountPath) {
+			node.Volumes = append(node.Volumes, volume)
+		}
+	}
+	node.Volumes = append(node.Volumes, desired.Volumes...)
+
+	node.Ports = nat.PortMap{}
+	for port, bindings := range existing.Ports {
+		if node.Role == k3d.ServerRole && port.Port() == k3d.DefaultAPIPort {
+			node.Ports[port] = bindings
+		}
+	}
+	for port, bindings := range desired.Ports {
+		node.Ports[port] = bindings
+	}
+
+	return node, nil
+}
+
+// ClusterApply executes a plan created by ClusterPlan
+func ClusterApply(ctx context.Context, runtime k3drt.Runtime, cluster *k3d.Cluster, plan *k3d.ClusterApplyPlan, opts k3d.ClusterApplyOpts) error {
+	for _, action := range plan.Actions {
+		if action.Type == k3d.ClusterApplyActionConnectRegistry {
+			l.Log().Infof("Connecting registry '%s' to network '%s'...", action.Target, cluster.Network.Name)
+			if err := RegistryConnectNetworks(ctx, runtime, &k3d.Node{Name: action.Target}, []string{cluster.Network.Name}); err != nil {
+				return fmt.Errorf("failed to connect registry '%s': %w", action.Target, err)
+			}
+		}
+	}
+
+	var envInfo *k3d.EnvironmentInfo
+	for _, action := range plan.Actions {
+		if action.Type != k3d.ClusterApplyActionReplaceNode && action.Type != k3d.ClusterApplyActionAddNode {
+			continue
+		}
+		var err error
+		if envInfo, err = GatherEnvironmentInfo(ctx, runtime, cluster); err != nil {
+			return fmt.Errorf("failed to gather environment information: %w", err)
+		}
+		break
+	}
+
+	for _, action := range plan.Actions {
+		if action.Type != k3d.ClusterApplyActionReplaceNode {
+			continue
+		}
+		existing, err := runtime.GetNode(ctx, &k3d.Node{Name: action.Target})
+		if err != nil {
+			return fmt.Errorf("failed to get node '%s': %w", action.Target, err)
+		}
+		l.Log().Infof("Replacing %s node '%s'...", action.Role, action.Target)
+		if err := nodeReplaceKeepingState(ctx, runtime, existing, action.Node, k3d.NodeReplaceOpts{EnvironmentInfo: envInfo, Timeout: opts.Timeout}); err != nil {
+			return fmt.Errorf("failed to replace node '%s': %w", action.Target, err)
+		}
+	}
+
+	for _, action := range plan.Actions {
+		if action.Type != k3d.ClusterApplyActionAddNode {
+			continue
+		}
+		current, err := ClusterGet(ctx, runtime, &k3d.Cluster{Name: cluster.Name})
+		if err != nil {
+			return fmt.Errorf("failed to get cluster '%s': %w", cluster.Name, err)
+		}
+		// new nodes are copies of an existing node with the same role, which might not match the desired spec exactly
+		node := &k3d.Node{
+			Name:   action.Node.Name,
+			Role:   action.Node.Role,
+			Image:  action.Node.Image,
+			Memory: action.Node.Memory,
+			CPUs:   action.Node.CPUs,
+			CPUSet: action.Node.CPUSet,
+		}
+		l.Log().Infof("Adding %s node '%s'...", node.Role, node.Name)
+		if err := NodeAddToCluster(ctx, runtime, node, current, k3d.NodeCreateOpts{Wait: true, Timeout: opts.Timeout, ClusterToken: current.Token, EnvironmentInfo: envInfo}); err != nil {
+			return fmt.Errorf("failed to add node '%s': %w", node.Name, err)
+		}
+		if err := clusterApplyEnsureNodeSpec(ctx, runtime, envInfo, cluster, action.Node); err != nil {
+			return err
+		}
+	}
+
+	for _, action := range plan.Actions {
+		if action.Type != k3d.ClusterApplyActionDeleteNode {
+			continue
+		}
+		current, err := ClusterGet(ctx, runtime, &k3d.Cluster{Name: cluster.Name})
+		if err != nil {
+			return fmt.Errorf("failed to get cluster '%s': %w", cluster.Name, err)
+		}
+		l.Log().Infof("Deleting %s node '%s'...", action.Role, action.Target)
+		if err := nodeRemoveFromCluster(ctx, runtime, action.Node, NodeFilterByRoles(current.Nodes, []k3d.Role{k3d.ServerRole}, nil)); err != nil {
+			return err
+		}
+	}
+
+	if plan.LoadbalancerConfig != nil {
+		if err := clusterApplyLoadbalancer(ctx, runtime, cluster, plan); err != nil {
+			return err
+		}
+	}
+
+	for _, action := range plan.Actions {
+		if action.Type == k3d.ClusterApplyActionDisconnectRegistry {
+			l.Log().Infof("Disconnecting registry '%s' from network '%s'...", action.Target, cluster.Network.Name)
+			if err := runtime.DisconnectNodeFromNetwork(ctx, &k3d.Node{Name: action.Target}, cluster.Network.Name); err != nil {
+				return fmt.Errorf("failed to disconnect registry '%s': %w", action.Target, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// clusterApplyEnsureNodeSpec replaces a freshly added node if copying an existing node didn't result in the desired spec
+func clusterApplyEnsureNodeSpec(ctx context.Context, runtime k3drt.Runtime, envInfo *k3d.EnvironmentInfo, cluster *k3d.Cluster, desired *k3d.Node) error {
+	current, err := ClusterGet(ctx, runtime, &k3d.Cluster{Name: cluster.Name})
+	if err != nil {
+		return fmt.Errorf("failed to get cluster '%s': %w", cluster.Name, err)
+	}
+	var added *k3d.Node
+	for _, node := range current.Nodes {
+		if node.Name == desired.Name {
+			added = node
+		}
+	}
+	if added == nil {
+		return fmt.Errorf("node '%s' not found after adding it", desired.Name)
+	}
+
+	changes := diffNodeSpecs(snapshotNodeFromNode(added), desiredNodeSpec(desired))
+	if len(changes) == 0 {
+		return nil
+	}
+	l.Log().Debugf("Node '%s' differs from the desired spec after copying it from an existing node: %v", desired.Name, changes)
+
+	replacement, err := replacementNode(added, desired)
+	if err != nil {
+		return err
+	}
+	if err := nodeReplaceKeepingState(ctx, runtime, added, replacement, k3d.NodeReplaceOpts{EnvironmentInfo: envInfo}); err != nil {
+		return fmt.Errorf("failed to replace node '%s': %w", desired.Name, err)
+	}
+	return nil
+}
+
+// nodeReplaceKeepingState replaces an existing node, carrying over the k3s state which lives in an anonymous volume
+// (node password and, on servers, the datastore) and is thus not part of the new container
+func nodeReplaceKeepingState(ctx context.Context, runtime k3drt.Runtime, existing, replacement *k3d.Node, opts k3d.NodeReplaceOpts) error {
+	statePaths := []string{k3sNodePasswordPath, k3d.DefaultRegistriesFilePath}
+	if replacement.Role == k3d.ServerRole {
+		statePaths = append(statePaths, k3sServerDataPath)
+	}
+	// the CAs of TLS-enabled registries are written to the node's trust store, which is part of the image
+	if files, err := readNodeFiles(ctx, runtime, existing, k3d.DefaultRegistriesFilePath); err == nil && len(files) == 1 {
+		caFiles, err := registryCAFiles(files[0].Content)
+		if err != nil {
+			l.Log().Warnf("Failed to parse registry config of node %s: %v", existing.Name, err)
+		}
+		statePaths = append(statePaths, caFiles...)
+	}
+	replacement.HookActions = append(replacement.HookActions, k3d.NodeHook{
+		Stage: k3d.LifecycleStagePreStart,
+		Action: actions.CopyFromNodeAction{
+			Runtime:     runtime,
+			Source:      existing, // NodeReplace renames this node before the new one is started
+			Paths:       statePaths,
+			Description: "Carry over k3s state from the replaced node",
+		},
+	})
+	if opts.EnvironmentInfo != nil && !slices.Contains(existing.Networks, "host") {
+		replacement.HookActions = append(replacement.HookActions, k3d.NodeHook{
+			Stage: k3d.LifecycleStagePostStart,
+			Action: actions.ExecAction{
+				Runtime:     runtime,
+				Command:     []string{"sh", "-c", fmt.Sprintf("echo '%s %s' >> /etc/hosts", opts.EnvironmentInfo.HostGateway.String(), k3d.DefaultK3dInternalHostRecord)},
+				Description: fmt.Sprintf("Inject /etc/hosts record for %s", k3d.DefaultK3dInternalHostRecord),
+			},
+		})
+	}
+	return NodeReplace(ctx, runtime, existing, replacement, opts)
+}
+
+// clusterApplyLoadbalancer brings the loadbalancer in line with the plan, after the nodes were changed
+func clusterApplyLoadbalancer(ctx context.Context, runtime k3drt.Runtime, cluster *k3d.Cluster, plan *k3d.ClusterApplyPlan) error {
+	current, err := ClusterGet(ctx, runtime, &k3d.Cluster{Name: cluster.Name})
+	if err != nil {
+		return fmt.Errorf("failed to get cluster '%s': %w", cluster.Name, err)
+	}
+	if current.ServerLoadBalancer == nil || current.ServerLoadBalancer.Node == nil {
+		return nil
+	}
+	lbNode := current.ServerLoadBalancer.Node
+
+	currentConfig, err := GetLoadbalancerConfig(ctx, runtime, current)
+	if err != nil {
+		return fmt.Errorf("failed to get loadbalancer config: %w", err)
+	}
+
+	// the API port is always proxied to all servers
+	desiredConfig := *plan.LoadbalancerConfig
+	desiredConfig.Ports = map[string][]string{}
+	for port, targets := range plan.LoadbalancerConfig.Ports {
+		desiredConfig.Ports[port] = targets
+	}
+	apiPort := fmt.Sprintf("%s.tcp", k3d.DefaultAPIPort)
+	desiredConfig.Ports[apiPort] = []string{}
+	for _, server := range NodeFilterByRoles(current.Nodes, []k3d.Role{k3d.ServerRole}, nil) {
+		desiredConfig.Ports[apiPort] = append(desiredConfig.Ports[apiPort], server.Name)
+	}
+
+	desiredPorts := nat.PortMap{}
+	for port, bindings := range plan.LoadbalancerPorts {
+		desiredPorts[port] = bindings
+	}
+	for port, bindings := range lbNode.Ports {
+		if port.Port() == k3d.DefaultAPIPort {
+			desiredPorts[port] = bindings
+		}
+	}
+
+	changes := diffLoadbalancer(lbNode.Ports, &currentConfig, desiredPorts, &desiredConfig)
+	if len(changes) == 0 {
+		return nil
+	}
+	l.Log().Debugf("Updating loadbalancer '%s': %v", lbNode.Name, changes)
+
+	return loadbalancerUpdate(ctx, runtime, lbNode, desiredPorts, desiredConfig, plan.LoadbalancerFiles)
+}
@@ -0,0 +1,171 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package client_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/k3d-io/k3d/v5/pkg/client"
+	"github.com/k3d-io/k3d/v5/pkg/config"
+	conf "github.com/k3d-io/k3d/v5/pkg/config/v1alpha5"
+	"github.com/k3d-io/k3d/v5/pkg/runtimes/fake"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+func TestFakeRuntimeClusterApply(t *testing.T) {
+	ctx := context.Background()
+	rt := fake.NewRuntime()
+	cluster := runFakeCluster(t, rt, "test", 1, 1)
+
+	if err := rt.WriteToNode(ctx, []byte("agent-password"), "/etc/rancher/node/password", 0600, &k3d.Node{Name: "k3d-test-agent-0"}); err != nil {
+		t.Fatalf("failed to write node password: %v", err)
+	}
+
+	simpleCfg := conf.SimpleConfig{
+		Servers: 1,
+		Agents:  2,
+		Env:     []conf.EnvVarWithNodeFilters{{EnvVar: "FOO=bar", NodeFilters: []string{"agent:0"}}},
+		Ports:   []conf.PortWithNodeFilters{{Port: "8080:80", NodeFilters: []string{"loadbalancer"}}},
+	}
+	simpleCfg.Name = "test"
+	desired, err := config.TransformSimpleToClusterConfig(ctx, rt, simpleCfg, "")
+	if err != nil {
+		t.Fatalf("failed to transform simple config: %v", err)
+	}
+
+	plan, err := client.ClusterPlan(ctx, rt, cluster, desired)
+	if err != nil {
+		t.Fatalf("failed to plan: %v", err)
+	}
+	actions := map[k3d.ClusterApplyActionType][]string{}
+	for _, action := range plan.Actions {
+		actions[action.Type] = append(actions[action.Type], action.Target)
+	}
+	expected := map[k3d.ClusterApplyActionType][]string{
+		k3d.ClusterApplyActionReplaceNode:        {"k3d-test-agent-0"},
+		k3d.ClusterApplyActionAddNode:            {"k3d-test-agent-1"},
+		k3d.ClusterApplyActionUpdateLoadbalancer: {"k3d-test-serverlb"},
+	}
+	if !reflect.DeepEqual(actions, expected) {
+		t.Fatalf("expected actions %v, got %v", expected, actions)
+	}
+
+	if err := client.ClusterApply(ctx, rt, cluster, plan, k3d.ClusterApplyOpts{}); err != nil {
+		t.Fatalf("failed to apply plan: %v", err)
+	}
+
+	applied, err := client.ClusterGet(ctx, rt, &k3d.Cluster{Name: cluster.Name})
+	if err != nil {
+		t.Fatalf("failed to get cluster: %v", err)
+	}
+	if len(applied.Nodes) != 4 {
+		t.Errorf("expected 4 nodes (server, 2 agents, loadbalancer), got %d", len(applied.Nodes))
+	}
+	for _, node := range applied.Nodes {
+		if node.Name == "k3d-test-agent-0" {
+			found := false
+			for _, env := range node.Env {
+				found = found || env == "FOO=bar"
+			}
+			if !found {
+				t.Errorf("expected env FOO=bar on replaced node, got %v", node.Env)
+			}
+		}
+	}
+	if password, _ := rt.ReadFile("k3d-test-agent-0", "/etc/rancher/node/password"); string(password) != "agent-password" {
+		t.Errorf("expected node password to be carried over, got '%s'", password)
+	}
+	if _, ok := applied.ServerLoadBalancer.Node.Ports["80/tcp"]; !ok {
+		t.Errorf("expected loadbalancer to expose port 80, got %v", applied.ServerLoadBalancer.Node.Ports)
+	}
+
+	// applying the same config again is a no-op
+	plan, err = client.ClusterPlan(ctx, rt, applied, desired)
+	if err != nil {
+		t.Fatalf("failed to plan: %v", err)
+	}
+	if !plan.IsEmpty() {
+		t.Errorf("expected empty plan after apply, got %+v", plan.Actions)
+	}
+
+	// settings that can only be set on creation are refused
+	desired.Token = "other"
+	if _, err := client.ClusterPlan(ctx, rt, applied, desired); err == nil {
+		t.Errorf("expected plan to fail for a changed token")
+	}
+}
+
+func TestFakeRuntimeClusterApplyRuntimeLabels(t *testing.T) {
+	ctx := context.Background()
+	rt := fake.NewRuntime()
+	cluster := runFakeCluster(t, rt, "test", 1, 1)
+
+	planWithLabel := func(t *testing.T, cluster *k3d.Cluster, label string) *k3d.ClusterApplyPlan {
+		simpleCfg := conf.SimpleConfig{Servers: 1, Agents: 1}
+		simpleCfg.Name = "test"
+		simpleCfg.Options.Runtime.Labels = []conf.LabelWithNodeFilters{{Label: label, NodeFilters: []string{"agent:0"}}}
+		desired, err := config.TransformSimpleToClusterConfig(ctx, rt, simpleCfg, "")
+		if err != nil {
+			t.Fatalf("failed to transform simple config: %v", err)
+		}
+		plan, err := client.ClusterPlan(ctx, rt, cluster, desired)
+		if err != nil {
+			t.Fatalf("failed to plan: %v", err)
+		}
+		return plan
+	}
+
+	plan := planWithLabel(t, cluster, "team=a")
+	if len(plan.Actions) != 1 || plan.Actions[0].Type != k3d.ClusterApplyActionReplaceNode || plan.Actions[0].Target != "k3d-test-agent-0" {
+		t.Fatalf("expected agent to be replaced for a new runtime label, got %+v", plan.Actions)
+	}
+	if !reflect.DeepEqual(plan.Actions[0].Changes, []string{"+ runtime-label team=a"}) {
+		t.Errorf("expected runtime label to be added, got %v", plan.Actions[0].Changes)
+	}
+	if err := client.ClusterApply(ctx, rt, cluster, plan, k3d.ClusterApplyOpts{}); err != nil {
+		t.Fatalf("failed to apply plan: %v", err)
+	}
+
+	applied, err := client.ClusterGet(ctx, rt, &k3d.Cluster{Name: cluster.Name})
+	if err != nil {
+		t.Fatalf("failed to get cluster: %v", err)
+	}
+	agent, err := client.NodeGet(ctx, rt, &k3d.Node{Name: "k3d-test-agent-0"})
+	if err != nil {
+		t.Fatalf("failed to get agent: %v", err)
+	}
+	// runtimes only return k3d labels, so the user labels are recorded in one of them
+	if agent.RuntimeLabels[k3d.LabelNodeUserLabels] != `{"team":"a"}` || agent.RuntimeLabels[k3d.LabelClusterName] != "test" {
+		t.Errorf("expected user and k3d labels on the replaced node, got %v", agent.RuntimeLabels)
+	}
+	if plan := planWithLabel(t, applied, "team=a"); !plan.IsEmpty() {
+		t.Errorf("expected empty plan after apply, got %+v", plan.Actions)
+	}
+
+	plan = planWithLabel(t, applied, "team=b")
+	if len(plan.Actions) != 1 || !reflect.DeepEqual(plan.Actions[0].Changes, []string{"- runtime-label team=a", "+ runtime-label team=b"}) {
+		t.Errorf("expected changed runtime label, got %+v", plan.Actions)
+	}
+}
@@ -172,6 +172,12 @@ func ClusterPrep(ctx context.Context, runtime k3drt.Runtime, clusterConfig *conf
 		if err != nil {
 			return fmt.Errorf("failed to translate node to registry spec: %w", err)
 		}
+		if regNode.RuntimeLabels[k3d.LabelRegistryAuth] != "" {
+			regFromNode.Options.Auth, err = RegistryGetAuth(regNode)
+			if err != nil {
+				return err
+			}
+		}
 		*reg = *regFromNode
 	}
 
@@ -198,6 +204,41 @@ func ClusterPrep(ctx context.Context, runtime k3drt.Runtime, clusterConfig *conf
 		}
 	}
 
+	// Create pull-through mirrors bound to this cluster, or use them if they exist already (e.g. shared with other clusters)
+mirrors:
+	for _, mirror := range clusterConfig.ClusterCreateOpts.Registries.Mirrors {
+		for _, reg := range clusterConfig.ClusterCreateOpts.Registries.Use {
+			if reg.Host == mirror.Host {
+				l.Log().Infof("Skipping creation of mirror for '%s': registry '%s' already referenced in use list", RegistryMirrorName(mirror.Options.Proxy.RemoteURL), mirror.Host)
+				continue mirrors
+			}
+		}
+		if regNode, err := runtime.GetNode(ctx, &k3d.Node{Name: mirror.Host, Role: k3d.RegistryRole}); err == nil && regNode != nil {
+			l.Log().Infof("Using existing registry '%s' as mirror for '%s'", mirror.Host, RegistryMirrorName(mirror.Options.Proxy.RemoteURL))
+			reg, err := RegistryFromNode(regNode)
+			if err != nil {
+				return fmt.Errorf("failed to translate node to registry spec: %w", err)
+			}
+			if regNode.RuntimeLabels[k3d.LabelRegistryAuth] != "" {
+				reg.Options.Auth, err = RegistryGetAuth(regNode)
+				if err != nil {
+					return err
+				}
+			}
+			clusterConfig.ClusterCreateOpts.Registries.Use = append(clusterConfig.ClusterCreateOpts.Registries.Use, reg)
+			continue
+		}
+
+		registryNode, err := RegistryCreate(ctx, runtime, mirror)
+		if err != nil {
+			return fmt.Errorf("failed to create mirror for '%s': %w", RegistryMirrorName(mirror.Options.Proxy.RemoteURL), err)
+		}
+
+		clusterConfig.Cluster.Nodes = append(clusterConfig.Cluster.Nodes, registryNode)
+
+		clusterConfig.ClusterCreateOpts.Registries.Use = append(clusterConfig.ClusterCreateOpts.Registries.Use, mirror)
+	}
+
 	// Use existing registries (including the new one, if created)
 	l.Log().Tracef("Using Registries: %+v", clusterConfig.ClusterCreateOpts.Registries.Use)
 
@@ -213,6 +254,24 @@ func ClusterPrep(ctx context.Context, runtime k3drt.Runtime, clusterConfig *conf
 			if err := RegistryConnectNetworks(ctx, runtime, regNode, []string{clusterConfig.Cluster.Network.Name}); err != nil {
 				return fmt.Errorf("Failed to connect registry node '%s' to cluster network: %+v", regNode.Name, err)
 			}
+
+			// add the CA of TLS-enabled registries to the trust store of the nodes
+			if externalReg.Options.TLS {
+				ca, err := RegistryGetCA(ctx, runtime, regNode)
+				if err != nil {
+					return err
+				}
+				clusterConfig.ClusterCreateOpts.NodeHooks = append(clusterConfig.ClusterCreateOpts.NodeHooks, k3d.NodeHook{
+					Stage: k3d.LifecycleStagePreStart,
+					Action: actions.WriteFileAction{
+						Runtime:     runtime,
+						Content:     ca,
+						Dest:        RegistryNodeCAPath(externalReg),
+						Mode:        0644,
+						Description: fmt.Sprintf("Write CA of registry %s", externalReg.Host),
+					},
+				})
+			}
 		}
 
 		// generate the registries.yaml
@@ -581,39 +640,54 @@ ClusterCreatOpts:
 			cluster.ServerLoadBalancer.Config = &lbConfig
 		}
 
-		// ensure labels
-		cluster.ServerLoadBalancer.Node.FillRuntimeLabels()
-		for k, v := range clusterCreateOpts.GlobalLabels {
-			cluster.ServerLoadBalancer.Node.RuntimeLabels[k] = v
+		if err := loadbalancerCreate(ctx, runtime, cluster.ServerLoadBalancer, clusterCreateOpts.GlobalLabels); err != nil {
+			return err
 		}
+	}
 
-		// prepare to write config to lb container
-		configyaml, err := yaml.Marshal(cluster.ServerLoadBalancer.Config)
-		if err != nil {
-			return fmt.Errorf("failed to marshal loadbalancer config: %w", err)
+	// *** Named Loadbalancers ***
+	for _, lb := range cluster.Loadbalancers {
+		if err := loadbalancerCreate(ctx, runtime, lb, clusterCreateOpts.GlobalLabels); err != nil {
+			return err
 		}
+	}
 
-		writeLbConfigAction := k3d.NodeHook{
-			Stage: k3d.LifecycleStagePreStart,
-			Action: actions.WriteFileAction{
-				Runtime:     runtime,
-				Dest:        k3d.DefaultLoadbalancerConfigPath,
-				Mode:        0744,
-				Content:     configyaml,
-				Description: "Write Loadbalancer Configuration",
-			},
-		}
+	return nil
+}
 
-		cluster.ServerLoadBalancer.Node.HookActions = append(cluster.ServerLoadBalancer.Node.HookActions, writeLbConfigAction)
-		cluster.ServerLoadBalancer.Node.Restart = true
+// loadbalancerCreate creates the loadbalancer node with a hook writing its config to the container
+func loadbalancerCreate(ctx context.Context, runtime k3drt.Runtime, lb *k3d.Loadbalancer, globalLabels map[string]string) error {
+	// ensure labels
+	lb.Node.FillRuntimeLabels()
+	for k, v := range globalLabels {
+		lb.Node.RuntimeLabels[k] = v
+	}
 
-		l.Log().Infof("Creating LoadBalancer '%s'", cluster.ServerLoadBalancer.Node.Name)
-		if err := NodeCreate(ctx, runtime, cluster.ServerLoadBalancer.Node, k3d.NodeCreateOpts{}); err != nil {
-			return fmt.Errorf("error creating loadbalancer: %v", err)
-		}
-		l.Log().Debugf("Created loadbalancer '%s'", cluster.ServerLoadBalancer.Node.Name)
+	// prepare to write config to lb container
+	configyaml, err := yaml.Marshal(lb.Config)
+	if err != nil {
+		return fmt.Errorf("failed to marshal loadbalancer config: %w", err)
+	}
+
+	writeLbConfigAction := k3d.NodeHook{
+		Stage: k3d.LifecycleStagePreStart,
+		Action: actions.WriteFileAction{
+			Runtime:     runtime,
+			Dest:        k3d.DefaultLoadbalancerConfigPath,
+			Mode:        0744,
+			Content:     configyaml,
+			Description: "Write Loadbalancer Configuration",
+		},
 	}
 
+	lb.Node.HookActions = append(lb.Node.HookActions, writeLbConfigAction)
+	lb.Node.Restart = true
+
+	l.Log().Infof("Creating LoadBalancer '%s'", lb.Node.Name)
+	if err := NodeCreate(ctx, runtime, lb.Node, k3d.NodeCreateOpts{}); err != nil {
+		return fmt.Errorf("error creating loadbalancer: %v", err)
+	}
+	l.Log().Debugf("Created loadbalancer '%s'", lb.Node.Name)
 	return nil
 }
 
@@ -868,7 +942,7 @@ func ClusterGet(ctx context.Context, runtime k3drt.Runtime, cluster *k3d.Cluster
 	// Loadbalancer
 	if cluster.ServerLoadBalancer == nil {
 		for _, node := range cluster.Nodes {
-			if node.Role == k3d.LoadBalancerRole {
+			if node.IsServerLoadBalancer() {
 				cluster.ServerLoadBalancer = &k3d.Loadbalancer{
 					Node: node,
 				}
@@ -884,6 +958,26 @@ func ClusterGet(ctx context.Context, runtime k3drt.Runtime, cluster *k3d.Cluster
 		}
 	}
 
+	// Named Loadbalancers
+	if len(cluster.Loadbalancers) == 0 {
+		for _, node := range cluster.Nodes {
+			if node.Role != k3d.LoadBalancerRole || node.IsServerLoadBalancer() {
+				continue
+			}
+			lbcfg, err := loadbalancerReadConfig(ctx, runtime, node)
+			if err != nil {
+				l.Log().Errorf("error getting loadbalancer config from %s: %v", node.Name, err)
+			}
+			cluster.Loadbalancers = append(cluster.Loadbalancers, &k3d.Loadbalancer{
+				Node:   node,
+				Config: &lbcfg,
+			})
+		}
+		sort.Slice(cluster.Loadbalancers, func(i, j int) bool {
+			return cluster.Loadbalancers[i].Node.Name < cluster.Loadbalancers[j].Node.Name
+		})
+	}
+
 	vols, err := runtime.GetVolumesByLabel(ctx, map[string]string{k3d.LabelClusterName: cluster.Name})
 	if err != nil {
 		return nil, err
@@ -959,7 +1053,7 @@ func ClusterStart(ctx context.Context, runtime k3drt.Runtime, cluster *k3d.Clust
 		l.Log().Infoln("Starting the initializing server...")
 		if err := NodeStart(ctx, runtime, initNode, &k3d.NodeStartOpts{
 			Wait:            true, // always wait for the init node
-			NodeHooks:       clusterStartOpts.NodeHooks,
+			NodeHooks:       append(clusterStartOpts.NodeHooks, initNode.HookActions...),
 			ReadyLogMessage: k3d.GetReadyLogMessage(initNode, clusterStartOpts.Intent), // initNode means, that we're using etcd -> this will need quorum, so "k3s is up and running" won't happen right now
 			EnvironmentInfo: clusterStartOpts.EnvironmentInfo,
 		}); err != nil {
@@ -1202,9 +1296,13 @@ func prepCreateLocalRegistryHostingConfigMap(ctx context.Context, runtime k3drt.
 	return nil
 }
 
-// ClusterEditChangesetSimple modifies an existing cluster with a given SimpleConfig changeset
+// ClusterEditChangesetSimple modifies an existing cluster with a given SimpleConfig changeset.
+// Only ports are changed, use ClusterScale to add or remove nodes.
 func ClusterEditChangesetSimple(ctx context.Context, runtime k3drt.Runtime, cluster *k3d.Cluster, changeset *config.SimpleConfig) error {
-	// nodeCount := len(cluster.Nodes)
+	if len(changeset.Ports) == 0 {
+		return nil
+	}
+
 	nodeList := cluster.Nodes
 
 	// === Ports ===
@@ -1232,14 +1330,17 @@ func ClusterEditChangesetSimple(ctx context.Context, runtime k3drt.Runtime, clus
 	if len(changeset.Ports) > 0 {
 		// 1. ensure that there are only supported suffices in the node filters // TODO: overly complex right now, needs simplification
 		for _, portWithNodeFilters := range changeset.Ports {
-			filteredNodes, err := util.FilterNodesWithSuffix(nodeList, portWithNodeFilters.NodeFilters)
+			filteredNodes, err := util.FilterNodesWithSuffix(nodeList, portWithNodeFilters.NodeFilters, "proxy", "proxyprotocol", "direct")
 			if err != nil {
 				return fmt.Errorf("failed to filter nodes: %w", err)
 			}
 
-			for suffix := range filteredNodes {
+			for suffix, nodes := range filteredNodes {
+				if len(nodes) == 0 { // allowed, but not used
+					continue
+				}
 				switch suffix {
-				case "proxy", util.NodeFilterSuffixNone, util.NodeFilterMapKeyAll:
+				case "proxy", "proxyprotocol", util.NodeFilterSuffixNone, util.NodeFilterMapKeyAll:
 					continue
 				default:
 					return fmt.Errorf("error: 'cluster edit' does not (yet) support the '%s' opt/suffix for adding ports", suffix)
@@ -1256,28 +1357,9 @@ func ClusterEditChangesetSimple(ctx context.Context, runtime k3drt.Runtime, clus
 
 	l.Log().Debugf("ORIGINAL:\n> Ports: %+v\n> Config: %+v\nCHANGESET:\n> Ports: %+v\n> Config: %+v", existingLB.Node.Ports, existingLB.Config, lbChangeset.Node.Ports, lbChangeset.Config)
 
-	// prepare to write config to lb container
-	configyaml, err := yaml.Marshal(lbChangeset.Config)
-	if err != nil {
-		return fmt.Errorf("failed to marshal loadbalancer config changeset: %w", err)
-	}
-	writeLbConfigAction := k3d.NodeHook{
-		Stage: k3d.LifecycleStagePreStart,
-		Action: actions.WriteFileAction{
-			Runtime:     runtime,
-			Dest:        k3d.DefaultLoadbalancerConfigPath,
-			Mode:        0744,
-			Content:     configyaml,
-			Description: "Write Loadbalancer Configuration",
-		},
-	}
-	if lbChangeset.Node.HookActions == nil {
-		lbChangeset.Node.HookActions = []k3d.NodeHook{}
-	}
-	lbChangeset.Node.HookActions = append(lbChangeset.Node.HookActions, writeLbConfigAction)
-
-	if err := NodeReplace(ctx, runtime, existingLB.Node, lbChangeset.Node); err != nil {
-		return fmt.Errorf("error replacing loadbalancer node: %w", err)
+	// the config is reloaded in place, unless new host port bindings require a new container
+	if err := loadbalancerUpdate(ctx, runtime, existingLB.Node, lbChangeset.Node.Ports, *lbChangeset.Config, nil); err != nil {
+		return fmt.Errorf("failed to update loadbalancer: %w", err)
 	}
 
 	return nil
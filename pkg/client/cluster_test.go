@@ -0,0 +1,152 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package client_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/k3d-io/k3d/v5/pkg/client"
+	conf "github.com/k3d-io/k3d/v5/pkg/config/v1alpha5"
+	"github.com/k3d-io/k3d/v5/pkg/runtimes/fake"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+func TestFakeRuntimeClusterRun(t *testing.T) {
+	rt := fake.NewRuntime()
+	cluster := runFakeCluster(t, rt, "test", 1, 1)
+
+	if len(cluster.Nodes) != 3 {
+		t.Fatalf("expected 3 nodes (server, agent, loadbalancer), got %d", len(cluster.Nodes))
+	}
+	if cluster.ServerLoadBalancer == nil || cluster.ServerLoadBalancer.Node == nil {
+		t.Fatalf("expected cluster to have a server loadbalancer")
+	}
+
+	network, err := rt.GetNetwork(context.Background(), &cluster.Network)
+	if err != nil {
+		t.Fatalf("failed to get cluster network: %v", err)
+	}
+	for _, node := range cluster.Nodes {
+		if !node.State.Running {
+			t.Errorf("expected node '%s' to be running", node.Name)
+		}
+		if !network.IPAM.IPPrefix.Contains(node.IP.IP) {
+			t.Errorf("expected node '%s' to have an IP in %s, got '%s'", node.Name, network.IPAM.IPPrefix, node.IP.IP)
+		}
+	}
+
+	// the tools node used to gather environment info must be gone again
+	if _, err := client.NodeGet(context.Background(), rt, &k3d.Node{Name: "k3d-test-tools"}); err == nil {
+		t.Errorf("expected tools node to be removed after cluster creation")
+	}
+
+	// the loadbalancer config must point to the server
+	lbConfig, ok := rt.ReadFile(cluster.ServerLoadBalancer.Node.Name, k3d.DefaultLoadbalancerConfigPath)
+	if !ok {
+		t.Fatalf("expected loadbalancer config to be written to %s", k3d.DefaultLoadbalancerConfigPath)
+	}
+	if !strings.Contains(string(lbConfig), "k3d-test-server-0") {
+		t.Errorf("expected loadbalancer config to contain the server node, got:\n%s", lbConfig)
+	}
+
+	// host records are injected into every K3s node
+	for _, nodeName := range []string{"k3d-test-server-0", "k3d-test-agent-0"} {
+		history := rt.ExecHistory(nodeName)
+		if len(history) == 0 || !strings.Contains(strings.Join(history[len(history)-1], " "), "> /etc/hosts") {
+			t.Errorf("expected /etc/hosts to be updated in node '%s', got exec history %v", nodeName, history)
+		}
+	}
+	coreDNS, _ := rt.ReadFile("k3d-test-server-0", "/var/lib/rancher/k3s/server/manifests/coredns.yaml")
+	if !strings.Contains(string(coreDNS), k3d.DefaultK3dInternalHostRecord) {
+		t.Errorf("expected CoreDNS manifest to contain a record for '%s', got:\n%s", k3d.DefaultK3dInternalHostRecord, coreDNS)
+	}
+}
+
+func TestFakeRuntimeClusterEditChangesetSimple(t *testing.T) {
+	ctx := context.Background()
+	rt := fake.NewRuntime()
+	cluster := runFakeCluster(t, rt, "test", 1, 1)
+	oldLBID := cluster.ServerLoadBalancer.Node.Name
+
+	changeset := &conf.SimpleConfig{
+		Ports: []conf.PortWithNodeFilters{
+			{Port: "8080:80", NodeFilters: []string{"agent:0"}},
+		},
+	}
+	if err := client.ClusterEditChangesetSimple(ctx, rt, cluster, changeset); err != nil {
+		t.Fatalf("failed to edit cluster: %v", err)
+	}
+
+	cluster, err := client.ClusterGet(ctx, rt, &k3d.Cluster{Name: "test"})
+	if err != nil {
+		t.Fatalf("failed to get cluster: %v", err)
+	}
+	if len(cluster.Nodes) != 3 {
+		t.Fatalf("expected 3 nodes after replacing the loadbalancer, got %d", len(cluster.Nodes))
+	}
+
+	lb := cluster.ServerLoadBalancer.Node
+	if lb.Name != oldLBID {
+		t.Errorf("expected replaced loadbalancer to keep its name '%s', got '%s'", oldLBID, lb.Name)
+	}
+	if !lb.State.Running {
+		t.Errorf("expected replaced loadbalancer to be running")
+	}
+	if _, ok := lb.Ports["80/tcp"]; !ok {
+		t.Errorf("expected replaced loadbalancer to expose port 80/tcp, got %v", lb.Ports)
+	}
+
+	lbConfig, err := client.GetLoadbalancerConfig(ctx, rt, cluster)
+	if err != nil {
+		t.Fatalf("failed to get loadbalancer config: %v", err)
+	}
+	if nodes := lbConfig.Ports["80.tcp"]; len(nodes) != 1 || nodes[0] != "k3d-test-agent-0" {
+		t.Errorf("expected port 80.tcp to be proxied to the agent, got %v", lbConfig.Ports)
+	}
+}
+
+func TestFakeRuntimeClusterDelete(t *testing.T) {
+	ctx := context.Background()
+	rt := fake.NewRuntime()
+	cluster := runFakeCluster(t, rt, "test", 1, 1)
+
+	if err := client.ClusterDelete(ctx, rt, cluster, k3d.ClusterDeleteOpts{}); err != nil {
+		t.Fatalf("failed to delete cluster: %v", err)
+	}
+
+	nodes, err := client.NodeList(ctx, rt)
+	if err != nil {
+		t.Fatalf("failed to list nodes: %v", err)
+	}
+	if len(nodes) != 0 {
+		t.Errorf("expected no nodes to be left, got %d", len(nodes))
+	}
+	if _, err := rt.GetNetwork(ctx, &k3d.ClusterNetwork{Name: cluster.Network.Name}); err == nil {
+		t.Errorf("expected cluster network '%s' to be removed", cluster.Network.Name)
+	}
+	if _, err := rt.GetVolume(cluster.ImageVolume); err == nil {
+		t.Errorf("expected image volume '%s' to be removed", cluster.ImageVolume)
+	}
+}
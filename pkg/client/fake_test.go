@@ -0,0 +1,56 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package client_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/k3d-io/k3d/v5/pkg/client"
+	"github.com/k3d-io/k3d/v5/pkg/config"
+	conf "github.com/k3d-io/k3d/v5/pkg/config/v1alpha5"
+	"github.com/k3d-io/k3d/v5/pkg/runtimes/fake"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+// runFakeCluster creates and starts a cluster with the given amount of servers and agents in the fake runtime
+func runFakeCluster(t *testing.T, rt *fake.Runtime, name string, servers, agents int) *k3d.Cluster {
+	t.Helper()
+	ctx := context.Background()
+
+	simpleCfg := conf.SimpleConfig{Servers: servers, Agents: agents}
+	simpleCfg.Name = name
+	clusterCfg, err := config.TransformSimpleToClusterConfig(ctx, rt, simpleCfg, "")
+	if err != nil {
+		t.Fatalf("failed to transform simple config: %v", err)
+	}
+	if err := client.ClusterRun(ctx, rt, clusterCfg); err != nil {
+		t.Fatalf("failed to run cluster: %v", err)
+	}
+
+	cluster, err := client.ClusterGet(ctx, rt, &k3d.Cluster{Name: name})
+	if err != nil {
+		t.Fatalf("failed to get cluster: %v", err)
+	}
+	return cluster
+}
@@ -111,8 +111,14 @@ func GetHostIP(ctx context.Context, runtime runtimes.Runtime, cluster *k3d.Clust
 		return ip, nil
 	}
 
-	// Catch all other runtime selections
-	return netip.Addr{}, fmt.Errorf("GetHostIP only implemented for the docker runtime")
+	// All other runtimes (e.g. podman) report the gateway of the cluster network
+	ip, err := runtime.GetHostIP(ctx, cluster.Network.Name)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("runtime failed to get host IP: %w", err)
+	}
+	l.Log().Infof("HostIP: using network gateway %s address", ip)
+
+	return ip, nil
 }
 
 func resolveHostnameFromInside(ctx context.Context, rtime runtimes.Runtime, node *k3d.Node, hostname string, cmd ResolveHostCmd) (netip.Addr, error) {
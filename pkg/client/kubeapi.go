@@ -0,0 +1,233 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+
+	l "github.com/k3d-io/k3d/v5/pkg/logger"
+)
+
+// kubeAPIPollInterval is the time to wait between two requests when waiting for the Kubernetes API
+var kubeAPIPollInterval = 2 * time.Second
+
+// kubeAPIClient talks to the Kubernetes API of a cluster (using its kubeconfig) to cordon, drain and watch nodes.
+// Only the few fields needed for that are modeled here.
+type kubeAPIClient struct {
+	host   string
+	client *http.Client
+}
+
+type kubeObjectMeta struct {
+	Name            string            `json:"name"`
+	Namespace       string            `json:"namespace,omitempty"`
+	Annotations     map[string]string `json:"annotations,omitempty"`
+	OwnerReferences []struct {
+		Kind string `json:"kind"`
+	} `json:"ownerReferences,omitempty"`
+}
+
+type kubeNode struct {
+	Metadata kubeObjectMeta `json:"metadata"`
+	Spec     struct {
+		Unschedulable bool `json:"unschedulable,omitempty"`
+	} `json:"spec"`
+	Status struct {
+		Conditions []struct {
+			Type   string `json:"type"`
+			Status string `json:"status"`
+		} `json:"conditions"`
+		NodeInfo struct {
+			KubeletVersion string `json:"kubeletVersion"`
+		} `json:"nodeInfo"`
+	} `json:"status"`
+}
+
+type kubePod struct {
+	Metadata kubeObjectMeta `json:"metadata"`
+	Status   struct {
+		Phase string `json:"phase"`
+	} `json:"status"`
+}
+
+type kubePodList struct {
+	Items []kubePod `json:"items"`
+}
+
+// newKubeAPIClient creates a client for the current context of the kubeconfig
+func newKubeAPIClient(kubeconfig *clientcmdapi.Config) (*kubeAPIClient, error) {
+	restConfig, err := clientcmd.NewDefaultClientConfig(*kubeconfig, &clientcmd.ConfigOverrides{}).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client config from kubeconfig: %w", err)
+	}
+	httpClient, err := rest.HTTPClientFor(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create http client: %w", err)
+	}
+	return &kubeAPIClient{host: strings.TrimSuffix(restConfig.Host, "/"), client: httpClient}, nil
+}
+
+// request sends a request to the Kubernetes API and decodes the response into out (if not nil).
+// It returns the HTTP status code, so that callers can handle expected errors (e.g. 404).
+func (c *kubeAPIClient) request(ctx context.Context, method, path, contentType string, body interface{}, out interface{}) (int, error) {
+	var reqBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return 0, fmt.Errorf("failed to marshal request body: %w", err)
+		}
+		reqBody = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.host+path, reqBody)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("%s %s failed: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, fmt.Errorf("failed to read response of %s %s: %w", method, path, err)
+	}
+	if resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("%s %s failed with status %d: %s", method, path, resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	if out != nil {
+		if err := json.Unmarshal(respBody, out); err != nil {
+			return resp.StatusCode, fmt.Errorf("failed to decode response of %s %s: %w", method, path, err)
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+// NodeSetUnschedulable cordons (or uncordons) a node
+func (c *kubeAPIClient) NodeSetUnschedulable(ctx context.Context, name string, unschedulable bool) error {
+	patch := map[string]interface{}{"spec": map[string]interface{}{"unschedulable": unschedulable}}
+	if _, err := c.request(ctx, http.MethodPatch, "/api/v1/nodes/"+url.PathEscape(name), "application/merge-patch+json", patch, nil); err != nil {
+		return fmt.Errorf("failed to set node '%s' unschedulable=%t: %w", name, unschedulable, err)
+	}
+	return nil
+}
+
+// NodeDrain evicts all pods from a node (like `kubectl drain --ignore-daemonsets --delete-emptydir-data`) and waits for them to be gone.
+// Evictions blocked by a PodDisruptionBudget are retried until the context is done.
+func (c *kubeAPIClient) NodeDrain(ctx context.Context, name string) error {
+	for {
+		var pods kubePodList
+		query := url.Values{"fieldSelector": []string{"spec.nodeName=" + name}}
+		if _, err := c.request(ctx, http.MethodGet, "/api/v1/pods?"+query.Encode(), "", nil, &pods); err != nil {
+			return fmt.Errorf("failed to list pods on node '%s': %w", name, err)
+		}
+
+		remaining := 0
+		for _, pod := range pods.Items {
+			if !podNeedsEviction(pod) {
+				continue
+			}
+			remaining++
+			eviction := map[string]interface{}{
+				"apiVersion": "policy/v1",
+				"kind":       "Eviction",
+				"metadata":   map[string]string{"name": pod.Metadata.Name, "namespace": pod.Metadata.Namespace},
+			}
+			path := fmt.Sprintf("/api/v1/namespaces/%s/pods/%s/eviction", url.PathEscape(pod.Metadata.Namespace), url.PathEscape(pod.Metadata.Name))
+			status, err := c.request(ctx, http.MethodPost, path, "application/json", eviction, nil)
+			switch {
+			case err == nil, status == http.StatusNotFound:
+				l.Log().Debugf("Evicting pod %s/%s from node '%s'", pod.Metadata.Namespace, pod.Metadata.Name, name)
+			case status == http.StatusTooManyRequests:
+				l.Log().Debugf("Eviction of pod %s/%s is blocked by a PodDisruptionBudget, retrying...", pod.Metadata.Namespace, pod.Metadata.Name)
+			default:
+				return fmt.Errorf("failed to evict pod %s/%s: %w", pod.Metadata.Namespace, pod.Metadata.Name, err)
+			}
+		}
+		if remaining == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out draining node '%s' (%d pods left): %w", name, remaining, ctx.Err())
+		case <-time.After(kubeAPIPollInterval):
+		}
+	}
+}
+
+// podNeedsEviction returns false for pods that drain leaves alone: DaemonSet pods, static (mirror) pods and finished pods
+func podNeedsEviction(pod kubePod) bool {
+	if pod.Status.Phase == "Succeeded" || pod.Status.Phase == "Failed" {
+		return false
+	}
+	if _, ok := pod.Metadata.Annotations["kubernetes.io/config.mirror"]; ok {
+		return false
+	}
+	for _, owner := range pod.Metadata.OwnerReferences {
+		if owner.Kind == "DaemonSet" {
+			return false
+		}
+	}
+	return true
+}
+
+// NodeWaitForReady waits until the node reports the Ready condition and returns its kubelet version.
+// Errors are retried until the context is done, as the API might be unavailable while servers are replaced.
+func (c *kubeAPIClient) NodeWaitForReady(ctx context.Context, name string) (string, error) {
+	for {
+		var node kubeNode
+		_, err := c.request(ctx, http.MethodGet, "/api/v1/nodes/"+url.PathEscape(name), "", nil, &node)
+		if err == nil {
+			for _, condition := range node.Status.Conditions {
+				if condition.Type == "Ready" && condition.Status == "True" {
+					return node.Status.NodeInfo.KubeletVersion, nil
+				}
+			}
+		} else {
+			l.Log().Tracef("Waiting for node '%s' to be ready: %v", name, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("timed out waiting for node '%s' to be ready: %w", name, ctx.Err())
+		case <-time.After(kubeAPIPollInterval):
+		}
+	}
+}
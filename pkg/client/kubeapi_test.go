@@ -0,0 +1,214 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/k3d-io/k3d/v5/pkg/runtimes/fake"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// fakeKubeAPI serves the few Kubernetes API endpoints used to cordon, drain and watch nodes
+type fakeKubeAPI struct {
+	mu            sync.Mutex
+	unschedulable bool
+	notReady      bool              // the node never reports the Ready condition
+	pods          map[string]string // pod name -> owner kind
+	blockedOnce   map[string]bool   // pods whose first eviction is refused like by a PodDisruptionBudget
+	evicted       []string
+}
+
+func (f *fakeKubeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodPatch && r.URL.Path == "/api/v1/nodes/k3d-test-agent-0":
+		var patch struct {
+			Spec struct {
+				Unschedulable bool `json:"unschedulable"`
+			} `json:"spec"`
+		}
+		body, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(body, &patch)
+		f.unschedulable = patch.Spec.Unschedulable
+		_, _ = w.Write([]byte(`{}`))
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v1/nodes/k3d-test-agent-0":
+		ready := "True"
+		if f.notReady {
+			ready = "False"
+		}
+		_, _ = fmt.Fprintf(w, `{"metadata":{"name":"k3d-test-agent-0"},"status":{"conditions":[{"type":"Ready","status":"%s"}],"nodeInfo":{"kubeletVersion":"v1.31.4+k3s1"}}}`, ready)
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v1/pods":
+		if r.URL.Query().Get("fieldSelector") != "spec.nodeName=k3d-test-agent-0" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		list := kubePodList{}
+		for name, owner := range f.pods {
+			pod := kubePod{}
+			pod.Metadata.Name = name
+			pod.Metadata.Namespace = "default"
+			if owner != "" {
+				pod.Metadata.OwnerReferences = append(pod.Metadata.OwnerReferences, struct {
+					Kind string `json:"kind"`
+				}{Kind: owner})
+			}
+			list.Items = append(list.Items, pod)
+		}
+		_ = json.NewEncoder(w).Encode(list)
+	case r.Method == http.MethodPost && len(r.URL.Path) > len("/api/v1/namespaces/default/pods/"):
+		name := r.URL.Path[len("/api/v1/namespaces/default/pods/") : len(r.URL.Path)-len("/eviction")]
+		if f.blockedOnce[name] {
+			delete(f.blockedOnce, name)
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		delete(f.pods, name)
+		f.evicted = append(f.evicted, name)
+		_, _ = w.Write([]byte(`{}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestKubeAPIClientCordonDrainReady(t *testing.T) {
+	kubeAPIPollInterval = 10 * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	api := &fakeKubeAPI{
+		pods:        map[string]string{"web": "ReplicaSet", "db": "StatefulSet", "svclb": "DaemonSet"},
+		blockedOnce: map[string]bool{"db": true},
+	}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	kube, err := newKubeAPIClient(&clientcmdapi.Config{
+		Clusters:       map[string]*clientcmdapi.Cluster{"test": {Server: server.URL}},
+		AuthInfos:      map[string]*clientcmdapi.AuthInfo{"admin": {}},
+		Contexts:       map[string]*clientcmdapi.Context{"test": {Cluster: "test", AuthInfo: "admin"}},
+		CurrentContext: "test",
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	if err := kube.NodeSetUnschedulable(ctx, "k3d-test-agent-0", true); err != nil {
+		t.Fatalf("failed to cordon node: %v", err)
+	}
+	if !api.unschedulable {
+		t.Errorf("expected node to be cordoned")
+	}
+
+	if err := kube.NodeDrain(ctx, "k3d-test-agent-0"); err != nil {
+		t.Fatalf("failed to drain node: %v", err)
+	}
+	if len(api.evicted) != 2 {
+		t.Errorf("expected 2 pods to be evicted, got %v", api.evicted)
+	}
+	if _, ok := api.pods["svclb"]; !ok {
+		t.Errorf("expected DaemonSet pod not to be evicted")
+	}
+
+	version, err := kube.NodeWaitForReady(ctx, "k3d-test-agent-0")
+	if err != nil {
+		t.Fatalf("failed to wait for node: %v", err)
+	}
+	if version != "v1.31.4+k3s1" {
+		t.Errorf("expected kubelet version v1.31.4+k3s1, got %s", version)
+	}
+
+	shortCtx, shortCancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer shortCancel()
+	if _, err := kube.NodeWaitForReady(shortCtx, "k3d-test-agent-1"); err == nil {
+		t.Errorf("expected waiting for a missing node to fail")
+	}
+}
+
+func TestNodeUpgradeRollsBackUnreadyNode(t *testing.T) {
+	kubeAPIPollInterval = 10 * time.Millisecond
+	ctx := context.Background()
+	rt := fake.NewRuntime()
+
+	api := &fakeKubeAPI{notReady: true}
+	server := httptest.NewServer(api)
+	defer server.Close()
+	kube, err := newKubeAPIClient(&clientcmdapi.Config{
+		Clusters:       map[string]*clientcmdapi.Cluster{"test": {Server: server.URL}},
+		AuthInfos:      map[string]*clientcmdapi.AuthInfo{"admin": {}},
+		Contexts:       map[string]*clientcmdapi.Context{"test": {Cluster: "test", AuthInfo: "admin"}},
+		CurrentContext: "test",
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	if _, _, err := rt.CreateNetworkIfNotPresent(ctx, &k3d.ClusterNetwork{Name: "k3d-test"}); err != nil {
+		t.Fatalf("failed to create network: %v", err)
+	}
+	agent := &k3d.Node{
+		Name:          "k3d-test-agent-0",
+		Role:          k3d.AgentRole,
+		Image:         "rancher/k3s:v1.31.4-k3s1",
+		Networks:      []string{"k3d-test"},
+		RuntimeLabels: map[string]string{k3d.LabelClusterName: "test"},
+	}
+	if err := NodeCreate(ctx, rt, agent, k3d.NodeCreateOpts{}); err != nil {
+		t.Fatalf("failed to create node: %v", err)
+	}
+	envInfo := &k3d.EnvironmentInfo{HostGateway: netip.MustParseAddr("172.30.0.1")}
+	if err := NodeStart(ctx, rt, agent, &k3d.NodeStartOpts{Wait: true, EnvironmentInfo: envInfo}); err != nil {
+		t.Fatalf("failed to start node: %v", err)
+	}
+	existing, err := NodeGet(ctx, rt, agent)
+	if err != nil {
+		t.Fatalf("failed to get node: %v", err)
+	}
+
+	err = nodeUpgrade(ctx, rt, kube, envInfo, existing, k3d.ClusterUpgradeOpts{Image: "rancher/k3s:v9.9.9-k3s1", Timeout: 500 * time.Millisecond})
+	if err == nil {
+		t.Fatalf("expected upgrade to fail for a node that never gets ready")
+	}
+
+	nodes, err := NodeList(ctx, rt)
+	if err != nil {
+		t.Fatalf("failed to list nodes: %v", err)
+	}
+	if len(nodes) != 1 || nodes[0].Name != agent.Name || nodes[0].Image != agent.Image || !nodes[0].State.Running {
+		t.Fatalf("expected the old node to be back and running, got %+v", nodes)
+	}
+	if api.unschedulable {
+		t.Errorf("expected the old node to be uncordoned")
+	}
+}
@@ -27,6 +27,10 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"os"
+	"regexp"
+	goruntime "runtime"
+	"sort"
 	"strings"
 	"time"
 
@@ -34,8 +38,11 @@ import (
 	"github.com/go-test/deep"
 	"dario.cat/mergo"
 	"github.com/spf13/viper"
+	"k8s.io/utils/strings/slices"
 	"sigs.k8s.io/yaml"
 
+	"github.com/k3d-io/k3d/v5/pkg/actions"
+	config "github.com/k3d-io/k3d/v5/pkg/config/v1alpha5"
 	l "github.com/k3d-io/k3d/v5/pkg/logger"
 	"github.com/k3d-io/k3d/v5/pkg/runtimes"
 	k3d "github.com/k3d-io/k3d/v5/pkg/types"
@@ -48,8 +55,36 @@ var (
 	ErrLBConfigEntryExists  error = errors.New("lbconfig: entry exists in config")
 )
 
-// UpdateLoadbalancerConfig updates the loadbalancer config with an updated list of servers belonging to that cluster
+// UpdateLoadbalancerConfig updates the loadbalancer config with an updated list of servers belonging to that cluster.
+// Targets of the other ports are kept (see loadbalancerKeepTargets). Named loadbalancers are updated as well.
 func UpdateLoadbalancerConfig(ctx context.Context, runtime runtimes.Runtime, cluster *k3d.Cluster) error {
+	return loadbalancersUpdateConfig(ctx, runtime, cluster, nil)
+}
+
+// LoadbalancerDrainNode takes a node out of rotation (or puts it back) by marking its upstreams in the loadbalancers as down,
+// without removing it from the loadbalancer configs.
+func LoadbalancerDrainNode(ctx context.Context, runtime runtimes.Runtime, cluster *k3d.Cluster, nodeName string, drain bool) error {
+	targeted := false
+	if err := loadbalancersUpdateConfig(ctx, runtime, cluster, func(lbConfig *k3d.LoadbalancerConfig) error {
+		ports := loadbalancerNodePorts(lbConfig, nodeName)
+		for _, port := range ports {
+			opts := lbConfig.Settings.Upstreams[port][nodeName]
+			opts.Down = drain
+			loadbalancerSetUpstreamOptions(lbConfig, port, nodeName, opts)
+		}
+		targeted = targeted || len(ports) > 0
+		return nil
+	}); err != nil {
+		return err
+	}
+	if !targeted {
+		return fmt.Errorf("node '%s' is not a target of the loadbalancer", nodeName)
+	}
+	return nil
+}
+
+// loadbalancersUpdateConfig updates the server loadbalancer and the named loadbalancers of the cluster (see loadbalancerUpdateConfig)
+func loadbalancersUpdateConfig(ctx context.Context, runtime runtimes.Runtime, cluster *k3d.Cluster, modify func(lbConfig *k3d.LoadbalancerConfig) error) error {
 	var err error
 	// update cluster details to ensure that we have the latest node list
 	cluster, err = ClusterGet(ctx, runtime, cluster)
@@ -57,16 +92,39 @@ func UpdateLoadbalancerConfig(ctx context.Context, runtime runtimes.Runtime, clu
 		return fmt.Errorf("failed to update details for cluster '%s': %w", cluster.Name, err)
 	}
 
-	currentConfig, err := GetLoadbalancerConfig(ctx, runtime, cluster)
+	lbs := []*k3d.Loadbalancer{}
+	if cluster.ServerLoadBalancer != nil && cluster.ServerLoadBalancer.Node != nil {
+		lbs = append(lbs, cluster.ServerLoadBalancer)
+	}
+	lbs = append(lbs, cluster.Loadbalancers...)
+	if len(lbs) == 0 {
+		return fmt.Errorf("cluster '%s' has no loadbalancer", cluster.Name)
+	}
+
+	for _, lb := range lbs {
+		if err := loadbalancerUpdateConfig(ctx, runtime, cluster, lb, modify); err != nil {
+			return fmt.Errorf("failed to update loadbalancer '%s': %w", lb.Node.Name, err)
+		}
+	}
+	return nil
+}
+
+// loadbalancerUpdateConfig regenerates the config of a loadbalancer for the current nodes of the cluster (see UpdateLoadbalancerConfig)
+// and applies the optional modification before writing it to the loadbalancer
+func loadbalancerUpdateConfig(ctx context.Context, runtime runtimes.Runtime, cluster *k3d.Cluster, lb *k3d.Loadbalancer, modify func(lbConfig *k3d.LoadbalancerConfig) error) error {
+	currentConfig, err := loadbalancerReadConfig(ctx, runtime, lb.Node)
 	if err != nil {
 		return fmt.Errorf("error getting current config from loadbalancer: %w", err)
 	}
 
 	l.Log().Tracef("Current loadbalancer config:\n%+v", currentConfig)
 
-	newLBConfig, err := LoadbalancerGenerateConfig(cluster)
-	if err != nil {
-		return fmt.Errorf("error generating new loadbalancer config: %w", err)
+	newLBConfig := loadbalancerGenerateConfig(cluster, lb)
+	newLBConfig = loadbalancerKeepTargets(currentConfig, newLBConfig, cluster.Nodes)
+	if modify != nil {
+		if err := modify(&newLBConfig); err != nil {
+			return err
+		}
 	}
 	l.Log().Tracef("New loadbalancer config:\n%+v", currentConfig)
 
@@ -74,24 +132,385 @@ func UpdateLoadbalancerConfig(ctx context.Context, runtime runtimes.Runtime, clu
 		l.Log().Debugf("Updating the loadbalancer with this diff: %+v", diff)
 	}
 
-	newLbConfigYaml, err := yaml.Marshal(&newLBConfig)
+	return loadbalancerWriteConfig(ctx, runtime, lb.Node, newLBConfig)
+}
+
+// loadbalancerKeepTargets carries the targets of the current config over to a generated config, which proxies all ports to the servers.
+// Targets that don't exist anymore are dropped and new nodes are added to the ports (and HTTP routes) that proxy to all other nodes of their role.
+// The Kubernetes API port always targets all servers.
+func loadbalancerKeepTargets(current, generated k3d.LoadbalancerConfig, nodes []*k3d.Node) k3d.LoadbalancerConfig {
+	current = loadbalancerExpandPorts(current)
+	generated = loadbalancerExpandPorts(generated)
+
+	known := map[string]bool{}
+	for _, targets := range current.Ports {
+		for _, target := range targets {
+			known[target] = true
+		}
+	}
+	for _, server := range current.HTTP {
+		for _, route := range server.Routes {
+			for _, target := range route.Nodes {
+				known[target] = true
+			}
+		}
+	}
+
+	for port := range generated.Ports {
+		currentTargets, ok := current.Ports[port]
+		if !ok || port == fmt.Sprintf("%s.tcp", k3d.DefaultAPIPort) {
+			continue
+		}
+		if targets := loadbalancerUpdateTargets(currentTargets, known, nodes); len(targets) > 0 {
+			generated.Ports[port] = targets
+		}
+	}
+
+	generated.HTTP = nil
+	for _, server := range current.HTTP {
+		routes := []k3d.LoadbalancerHTTPRoute{}
+		for _, route := range server.Routes {
+			if route.Nodes = loadbalancerUpdateTargets(route.Nodes, known, nodes); len(route.Nodes) > 0 {
+				routes = append(routes, route)
+			}
+		}
+		if len(routes) > 0 {
+			server.Routes = routes
+			generated.HTTP = append(generated.HTTP, server)
+		}
+	}
+
+	generated.Settings.Upstreams = nil
+	loadbalancerKeepUpstreamOptions(current.Settings.Upstreams, &generated)
+	generated.Settings.PortOptions = nil
+	loadbalancerKeepPortOptions(current.Settings.PortOptions, &generated)
+
+	generated.Settings.DefaultProxyTimeout = current.Settings.DefaultProxyTimeout
+	if current.Settings.WorkerConnections > generated.Settings.WorkerConnections {
+		generated.Settings.WorkerConnections = current.Settings.WorkerConnections
+	}
+
+	return loadbalancerCompactPorts(generated)
+}
+
+// loadbalancerUpdateTargets drops targets that don't exist anymore and adds new (unknown) nodes of a role, if all known nodes of that role are targeted
+func loadbalancerUpdateTargets(currentTargets []string, known map[string]bool, nodes []*k3d.Node) []string {
+	targets := []string{}
+	for _, role := range []k3d.Role{k3d.ServerRole, k3d.AgentRole} {
+		roleNodes := NodeFilterByRoles(nodes, []k3d.Role{role}, nil)
+		targeted, knownNodes := 0, 0
+		for _, node := range roleNodes {
+			if known[node.Name] {
+				knownNodes++
+				if slices.Contains(currentTargets, node.Name) {
+					targeted++
+				}
+			}
+		}
+		for _, node := range roleNodes {
+			if slices.Contains(currentTargets, node.Name) || (!known[node.Name] && targeted > 0 && targeted == knownNodes) {
+				targets = append(targets, node.Name)
+			}
+		}
+	}
+	return targets
+}
+
+// TransformLoadbalancerUpstreams sets the upstream options of the loadbalancer's targets, for the ports (and nodes) selected by the config entries
+func TransformLoadbalancerUpstreams(cluster *k3d.Cluster, upstreams []config.LoadbalancerUpstreamWithNodeFilters) error {
+	if len(upstreams) == 0 {
+		return nil
+	}
+	if cluster.ServerLoadBalancer == nil || cluster.ServerLoadBalancer.Config == nil {
+		return fmt.Errorf("loadbalancer upstream options specified, but loadbalancer is disabled")
+	}
+	// options are set port by port, so they can differ within a port range
+	expanded := loadbalancerExpandPorts(*cluster.ServerLoadBalancer.Config)
+	lbConfig := &expanded
+
+	for _, upstream := range upstreams {
+		ports := map[string]bool{} // all ports, if empty
+		if upstream.Port != "" {
+			proto, portNum := nat.SplitProtoPort(upstream.Port)
+			start, end, err := nat.ParsePortRangeToInt(portNum)
+			if err != nil || portNum == "" {
+				return fmt.Errorf("invalid loadbalancer upstream port '%s'", upstream.Port)
+			}
+			loadbalancerForEachPort(loadbalancerPortConfig(start, end, proto), func(port string) {
+				ports[port] = true
+			})
+		}
+
+		nodes, err := util.FilterNodes(cluster.Nodes, upstream.NodeFilters)
+		if err != nil {
+			return fmt.Errorf("failed to filter nodes for loadbalancer upstream options: %w", err)
+		}
+
+		matched := false
+		for _, node := range nodes {
+			for _, nodePort := range loadbalancerNodePorts(lbConfig, node.Name) {
+				if len(ports) > 0 && !ports[nodePort] {
+					continue
+				}
+				matched = true
+				opts := lbConfig.Settings.Upstreams[nodePort][node.Name]
+				if upstream.Weight != 0 {
+					opts.Weight = upstream.Weight
+				}
+				if upstream.MaxFails != nil {
+					opts.MaxFails = upstream.MaxFails
+				}
+				if upstream.FailTimeout != "" {
+					opts.FailTimeout = upstream.FailTimeout
+				}
+				opts.Backup = opts.Backup || upstream.Backup
+				opts.Down = opts.Down || upstream.Down
+				if err := ValidateLoadbalancerUpstreamOptions(opts); err != nil {
+					return fmt.Errorf("invalid loadbalancer upstream options for node '%s' on port %s: %w", node.Name, nodePort, err)
+				}
+				loadbalancerSetUpstreamOptions(lbConfig, nodePort, node.Name, opts)
+			}
+		}
+		if !matched {
+			l.Log().Warnf("Loadbalancer upstream options for port '%s' and node filters %v don't match any target of the loadbalancer", upstream.Port, upstream.NodeFilters)
+		}
+	}
+	*cluster.ServerLoadBalancer.Config = loadbalancerCompactPorts(expanded)
+	return nil
+}
+
+// loadbalancerUpdate brings a running loadbalancer in line with the desired ports and config.
+// As long as no host port bindings have to be added or removed, the config (and the files, e.g. certificates) are reloaded
+// in the running container, which keeps existing connections. Otherwise, the loadbalancer is replaced by a new container.
+func loadbalancerUpdate(ctx context.Context, runtime runtimes.Runtime, lbNode *k3d.Node, desiredPorts nat.PortMap, desiredConfig k3d.LoadbalancerConfig, files []k3d.File) error {
+	if !loadbalancerPortsChanged(lbNode.Ports, desiredPorts) {
+		l.Log().Infof("Reloading loadbalancer '%s' in place (published ports are unchanged)...", lbNode.Name)
+		for _, file := range files {
+			if err := runtime.WriteToNode(ctx, file.Content, file.Destination, 0600, lbNode); err != nil {
+				return fmt.Errorf("failed to write %s to loadbalancer: %w", file.Description, err)
+			}
+		}
+		if err := loadbalancerWriteConfig(ctx, runtime, lbNode, desiredConfig); err != nil && !errors.Is(err, ErrLBConfigHostNotFound) {
+			return fmt.Errorf("failed to update loadbalancer config: %w", err)
+		}
+		return nil
+	}
+
+	l.Log().Infof("Replacing loadbalancer '%s' (published ports changed)...", lbNode.Name)
+	replacement, err := CopyNode(ctx, lbNode, CopyNodeOpts{keepState: false})
+	if err != nil {
+		return fmt.Errorf("error copying existing loadbalancer: %w", err)
+	}
+	replacement.Ports = desiredPorts
+	configyaml, err := yaml.Marshal(desiredConfig)
+	if err != nil {
+		return fmt.Errorf("failed to marshal loadbalancer config: %w", err)
+	}
+	replacement.HookActions = append(replacement.HookActions, k3d.NodeHook{
+		Stage: k3d.LifecycleStagePreStart,
+		Action: actions.WriteFileAction{
+			Runtime:     runtime,
+			Dest:        k3d.DefaultLoadbalancerConfigPath,
+			Mode:        0744,
+			Content:     configyaml,
+			Description: "Write Loadbalancer Configuration",
+		},
+	})
+	loadbalancerKeepCertificates(runtime, lbNode, replacement)
+	for _, file := range files {
+		replacement.HookActions = append(replacement.HookActions, k3d.NodeHook{
+			Stage: k3d.LifecycleStagePreStart,
+			Action: actions.WriteFileAction{
+				Runtime:     runtime,
+				Dest:        file.Destination,
+				Mode:        0600,
+				Content:     file.Content,
+				Description: fmt.Sprintf("Write %s", file.Description),
+			},
+		})
+	}
+	if err := NodeReplace(ctx, runtime, lbNode, replacement, k3d.NodeReplaceOpts{}); err != nil {
+		return fmt.Errorf("error replacing loadbalancer node: %w", err)
+	}
+	return nil
+}
+
+// loadbalancerPortsChanged returns true if host port bindings have to be added or removed to get from the current to the desired ports.
+// Bindings without a host port match any binding of the port, as the runtime picks a random host port for them.
+func loadbalancerPortsChanged(current, desired nat.PortMap) bool {
+	contains := func(portMap nat.PortMap, port nat.Port, binding nat.PortBinding) bool {
+		for _, existing := range portMap[port] {
+			if existing == binding || util.IsPortBindingEqual(existing, binding) || binding.HostPort == "" || existing.HostPort == "" {
+				return true
+			}
+		}
+		return false
+	}
+	for port, bindings := range desired {
+		if _, ok := current[port]; !ok {
+			return true
+		}
+		for _, binding := range bindings {
+			if !contains(current, port, binding) {
+				return true
+			}
+		}
+	}
+	for port, bindings := range current {
+		if _, ok := desired[port]; !ok {
+			return true
+		}
+		for _, binding := range bindings {
+			if !contains(desired, port, binding) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// loadbalancerNodePorts returns the ports of the loadbalancer (e.g. 80.tcp) with the node as a target, including those serving HTTP(S) routes
+func loadbalancerNodePorts(lbConfig *k3d.LoadbalancerConfig, nodeName string) []string {
+	ports := []string{}
+	for port, targets := range lbConfig.Ports {
+		if slices.Contains(targets, nodeName) {
+			ports = append(ports, port)
+		}
+	}
+	for _, server := range lbConfig.HTTP {
+		port := fmt.Sprintf("%d.tcp", server.Listen)
+		for _, route := range server.Routes {
+			if slices.Contains(route.Nodes, nodeName) && !slices.Contains(ports, port) {
+				ports = append(ports, port)
+			}
+		}
+	}
+	sort.Strings(ports)
+	return ports
+}
+
+// loadbalancerKeepUpstreamOptions carries upstream options over to a new config, for the targets that still exist
+func loadbalancerKeepUpstreamOptions(upstreams map[string]map[string]k3d.LoadbalancerUpstreamOptions, lbConfig *k3d.LoadbalancerConfig) {
+	for port, nodeOpts := range upstreams {
+		for nodeName, opts := range nodeOpts {
+			if slices.Contains(loadbalancerNodePorts(lbConfig, nodeName), port) {
+				loadbalancerSetUpstreamOptions(lbConfig, port, nodeName, opts)
+			}
+		}
+	}
+}
+
+// loadbalancerSetUpstreamOptions sets the options of a target node of a loadbalancer port, removing them if they're all defaults
+func loadbalancerSetUpstreamOptions(lbConfig *k3d.LoadbalancerConfig, port, nodeName string, opts k3d.LoadbalancerUpstreamOptions) {
+	if opts == (k3d.LoadbalancerUpstreamOptions{}) {
+		delete(lbConfig.Settings.Upstreams[port], nodeName)
+		if len(lbConfig.Settings.Upstreams[port]) == 0 {
+			delete(lbConfig.Settings.Upstreams, port)
+		}
+		return
+	}
+	if lbConfig.Settings.Upstreams == nil {
+		lbConfig.Settings.Upstreams = map[string]map[string]k3d.LoadbalancerUpstreamOptions{}
+	}
+	if lbConfig.Settings.Upstreams[port] == nil {
+		lbConfig.Settings.Upstreams[port] = map[string]k3d.LoadbalancerUpstreamOptions{}
+	}
+	lbConfig.Settings.Upstreams[port][nodeName] = opts
+}
+
+// loadbalancerKeepPortOptions carries port options over to a new config, for the ports that are still proxied
+func loadbalancerKeepPortOptions(portOptions map[string]k3d.LoadbalancerPortOptions, lbConfig *k3d.LoadbalancerConfig) {
+	for port, opts := range portOptions {
+		if _, ok := lbConfig.Ports[port]; ok {
+			loadbalancerSetPortOptions(lbConfig, port, opts)
+		}
+	}
+}
+
+// loadbalancerSetPortOptions sets the options of a loadbalancer port, removing them if they're all defaults
+func loadbalancerSetPortOptions(lbConfig *k3d.LoadbalancerConfig, port string, opts k3d.LoadbalancerPortOptions) {
+	if opts == (k3d.LoadbalancerPortOptions{}) {
+		delete(lbConfig.Settings.PortOptions, port)
+		return
+	}
+	if lbConfig.Settings.PortOptions == nil {
+		lbConfig.Settings.PortOptions = map[string]k3d.LoadbalancerPortOptions{}
+	}
+	lbConfig.Settings.PortOptions[port] = opts
+}
+
+// validateLoadbalancerPortOptions checks that the options belong to a proxied port and can be used for its protocol
+func validateLoadbalancerPortOptions(lbConfig k3d.LoadbalancerConfig, port string, opts k3d.LoadbalancerPortOptions) error {
+	if _, ok := lbConfig.Ports[port]; !ok {
+		return fmt.Errorf("options set for port '%s', which is not proxied by the loadbalancer", port)
+	}
+	if opts.ProxyProtocol && !strings.HasSuffix(port, ".tcp") {
+		return fmt.Errorf("the PROXY protocol can only be enabled for tcp ports, not for '%s'", port)
+	}
+	return nil
+}
+
+// loadbalancerFailTimeoutRegexp matches nginx time values, e.g. 10s or 500ms
+var loadbalancerFailTimeoutRegexp = regexp.MustCompile(`^[0-9]+(ms|s|m|h)?$`)
+
+// ValidateLoadbalancerUpstreamOptions checks that the upstream options can be used in the nginx config
+func ValidateLoadbalancerUpstreamOptions(opts k3d.LoadbalancerUpstreamOptions) error {
+	if opts.Weight < 0 {
+		return fmt.Errorf("invalid weight %d: must not be negative", opts.Weight)
+	}
+	if opts.MaxFails != nil && *opts.MaxFails < 0 {
+		return fmt.Errorf("invalid maxFails %d: must not be negative", *opts.MaxFails)
+	}
+	if opts.FailTimeout != "" && !loadbalancerFailTimeoutRegexp.MatchString(opts.FailTimeout) {
+		return fmt.Errorf("invalid failTimeout '%s': must be a duration like 10s or 500ms", opts.FailTimeout)
+	}
+	return nil
+}
+
+// loadbalancerReloadCmd renders the nginx config from the values file (checking it) and reloads nginx,
+// which also picks up changed certificates
+var loadbalancerReloadCmd = []string{"sh", "-c", fmt.Sprintf("confd -onetime -backend file -file %s && nginx -s reload", k3d.DefaultLoadbalancerConfigPath)}
+
+// loadbalancerNativeReloadCmd makes the native loadbalancer reload its config right away
+var loadbalancerNativeReloadCmd = []string{k3d.DefaultLoadbalancerNativeBinary, "proxy", "reload"}
+
+// loadbalancerWriteConfig writes the config to a running loadbalancer, triggers a reload and waits for it to pick it up
+func loadbalancerWriteConfig(ctx context.Context, runtime runtimes.Runtime, lbNode *k3d.Node, lbConfig k3d.LoadbalancerConfig) error {
+	reloadCmd := loadbalancerReloadCmd
+	if lbNode.LoadbalancerMode() == k3d.LoadbalancerModeNative {
+		if len(lbConfig.HTTP) > 0 {
+			return fmt.Errorf("loadbalancer '%s' runs in %s mode, which doesn't support HTTP(S) routes", lbNode.Name, k3d.LoadbalancerModeNative)
+		}
+		reloadCmd = loadbalancerNativeReloadCmd
+	}
+
+	newLbConfigYaml, err := yaml.Marshal(&lbConfig)
 	if err != nil {
 		return fmt.Errorf("error marshalling the new loadbalancer config: %w", err)
 	}
 	l.Log().Debugf("Writing lb config:\n%s", string(newLbConfigYaml))
 	startTime := time.Now().Truncate(time.Second).UTC()
-	if err := runtime.WriteToNode(ctx, newLbConfigYaml, k3d.DefaultLoadbalancerConfigPath, 0744, cluster.ServerLoadBalancer.Node); err != nil {
+	if err := runtime.WriteToNode(ctx, newLbConfigYaml, k3d.DefaultLoadbalancerConfigPath, 0744, lbNode); err != nil {
 		return fmt.Errorf("error writing new loadbalancer config to container: %w", err)
 	}
 
+	// confd (or the native loadbalancer) watches the values file anyway, but this applies the change right away.
+	// If the reload fails, the old config may still be served, so we restart the loadbalancer, which renders the new one on startup.
+	if err := runtime.ExecInNode(ctx, lbNode, reloadCmd); err != nil {
+		l.Log().Warnf("Failed to reload loadbalancer '%s' in place, restarting it (this drops open connections): %v", lbNode.Name, err)
+		if err := loadbalancerRestart(ctx, runtime, lbNode); err != nil {
+			return fmt.Errorf("failed to restart loadbalancer '%s' after its reload failed: %w", lbNode.Name, err)
+		}
+	}
+
 	successCtx, successCtxCancel := context.WithDeadline(ctx, time.Now().Add(5*time.Second))
 	defer successCtxCancel()
-	err = NodeWaitForLogMessage(successCtx, runtime, cluster.ServerLoadBalancer.Node, k3d.GetReadyLogMessage(cluster.ServerLoadBalancer.Node, k3d.IntentAny), startTime)
+	err = NodeWaitForLogMessage(successCtx, runtime, lbNode, k3d.GetReadyLogMessage(lbNode, k3d.IntentAny), startTime)
 	if err != nil {
 		if errors.Is(err, context.DeadlineExceeded) {
 			failureCtx, failureCtxCancel := context.WithDeadline(ctx, time.Now().Add(5*time.Second))
 			defer failureCtxCancel()
-			err = NodeWaitForLogMessage(failureCtx, runtime, cluster.ServerLoadBalancer.Node, "host not found in upstream", startTime)
+			err = NodeWaitForLogMessage(failureCtx, runtime, lbNode, "host not found in upstream", startTime)
 			if err != nil {
 				l.Log().Warnf("Failed to check if the loadbalancer was configured correctly or if it broke. Please check it manually or try again: %v", err)
 				return ErrLBConfigFailedTest
@@ -104,20 +523,32 @@ func UpdateLoadbalancerConfig(ctx context.Context, runtime runtimes.Runtime, clu
 			return ErrLBConfigFailedTest
 		}
 	}
-	l.Log().Infof("Successfully configured loadbalancer %s!", cluster.ServerLoadBalancer.Node.Name)
+	l.Log().Infof("Successfully configured loadbalancer %s!", lbNode.Name)
 
 	time.Sleep(1 * time.Second) // waiting for a second, to avoid issues with too fast lb updates which would screw up the log waits
 
 	return nil
 }
 
+// loadbalancerRestart stops and starts a loadbalancer container, keeping its files (e.g. the config)
+func loadbalancerRestart(ctx context.Context, runtime runtimes.Runtime, lbNode *k3d.Node) error {
+	if err := runtime.StopNode(ctx, lbNode); err != nil {
+		return fmt.Errorf("failed to stop loadbalancer: %w", err)
+	}
+	lbNode.State.Running = false
+	if err := NodeStart(ctx, runtime, lbNode, &k3d.NodeStartOpts{}); err != nil {
+		return fmt.Errorf("failed to start loadbalancer: %w", err)
+	}
+	return nil
+}
+
 func GetLoadbalancerConfig(ctx context.Context, runtime runtimes.Runtime, cluster *k3d.Cluster) (k3d.LoadbalancerConfig, error) {
 	var cfg k3d.LoadbalancerConfig
 
 	if cluster.ServerLoadBalancer == nil || cluster.ServerLoadBalancer.Node == nil {
 		cluster.ServerLoadBalancer = &k3d.Loadbalancer{}
 		for _, node := range cluster.Nodes {
-			if node.Role == k3d.LoadBalancerRole {
+			if node.IsServerLoadBalancer() {
 				var err error
 				cluster.ServerLoadBalancer.Node, err = NodeGet(ctx, runtime, node)
 				if err != nil {
@@ -127,9 +558,16 @@ func GetLoadbalancerConfig(ctx context.Context, runtime runtimes.Runtime, cluste
 		}
 	}
 
-	reader, err := runtime.ReadFromNode(ctx, k3d.DefaultLoadbalancerConfigPath, cluster.ServerLoadBalancer.Node)
+	return loadbalancerReadConfig(ctx, runtime, cluster.ServerLoadBalancer.Node)
+}
+
+// loadbalancerReadConfig reads the config of a loadbalancer node (the server loadbalancer or a named one)
+func loadbalancerReadConfig(ctx context.Context, runtime runtimes.Runtime, lbNode *k3d.Node) (k3d.LoadbalancerConfig, error) {
+	var cfg k3d.LoadbalancerConfig
+
+	reader, err := runtime.ReadFromNode(ctx, k3d.DefaultLoadbalancerConfigPath, lbNode)
 	if err != nil {
-		return cfg, fmt.Errorf("runtime failed to read loadbalancer config '%s' from node '%s': %w", k3d.DefaultLoadbalancerConfigPath, cluster.ServerLoadBalancer.Node.Name, err)
+		return cfg, fmt.Errorf("runtime failed to read loadbalancer config '%s' from node '%s': %w", k3d.DefaultLoadbalancerConfigPath, lbNode.Name, err)
 	}
 	defer reader.Close()
 
@@ -148,6 +586,12 @@ func GetLoadbalancerConfig(ctx context.Context, runtime runtimes.Runtime, cluste
 }
 
 func LoadbalancerGenerateConfig(cluster *k3d.Cluster) (k3d.LoadbalancerConfig, error) {
+	return loadbalancerGenerateConfig(cluster, cluster.ServerLoadBalancer), nil
+}
+
+// loadbalancerGenerateConfig generates the config of a loadbalancer, proxying its exposed ports to the servers.
+// Only the server loadbalancer proxies the Kubernetes API.
+func loadbalancerGenerateConfig(cluster *k3d.Cluster, lb *k3d.Loadbalancer) k3d.LoadbalancerConfig {
 	lbConfig := k3d.LoadbalancerConfig{
 		Ports:    map[string][]string{},
 		Settings: k3d.LoadBalancerSettings{},
@@ -162,18 +606,35 @@ func LoadbalancerGenerateConfig(cluster *k3d.Cluster) (k3d.LoadbalancerConfig, e
 	}
 
 	// Default API Port proxied to the server nodes
-	lbConfig.Ports[fmt.Sprintf("%s.tcp", k3d.DefaultAPIPort)] = servers
+	if lb == cluster.ServerLoadBalancer {
+		lbConfig.Ports[fmt.Sprintf("%s.tcp", k3d.DefaultAPIPort)] = servers
+	}
+
+	// HTTP(S) routes are kept as they are, their ports are not proxied to the servers
+	httpPorts := loadbalancerHTTPPorts(lb.Config)
+	if lb.Config != nil {
+		lbConfig.HTTP = lb.Config.HTTP
+	}
 
 	// generate comma-separated list of extra ports to forward // TODO: no default targets?
-	for exposedPort := range cluster.ServerLoadBalancer.Node.Ports {
+	for exposedPort := range lb.Node.Ports {
+		if httpPorts[string(exposedPort)] {
+			continue
+		}
 		// TODO: catch duplicates here?
 		lbConfig.Ports[fmt.Sprintf("%s.%s", exposedPort.Port(), exposedPort.Proto())] = servers
 	}
 
+	if lb.Config != nil {
+		current := loadbalancerExpandPorts(*lb.Config)
+		loadbalancerKeepUpstreamOptions(current.Settings.Upstreams, &lbConfig)
+		loadbalancerKeepPortOptions(current.Settings.PortOptions, &lbConfig)
+	}
+
 	// some additional nginx settings
-	lbConfig.Settings.WorkerConnections = k3d.DefaultLoadbalancerWorkerConnections + len(cluster.ServerLoadBalancer.Node.Ports)*len(servers)
+	lbConfig.Settings.WorkerConnections = k3d.DefaultLoadbalancerWorkerConnections + len(lb.Node.Ports)*len(servers)
 
-	return lbConfig, nil
+	return loadbalancerCompactPorts(lbConfig)
 }
 
 func LoadbalancerPrepare(ctx context.Context, runtime runtimes.Runtime, cluster *k3d.Cluster, opts *k3d.LoadbalancerCreateOpts) (*k3d.Node, error) {
@@ -195,18 +656,8 @@ func LoadbalancerPrepare(ctx context.Context, runtime runtimes.Runtime, cluster
 	}
 
 	if opts != nil && opts.ConfigOverrides != nil && len(opts.ConfigOverrides) > 0 {
-		tmpViper := viper.New()
-		for _, override := range opts.ConfigOverrides {
-			kv := strings.SplitN(override, "=", 2)
-			l.Log().Tracef("Overriding LB config with %s...", kv)
-			tmpViper.Set(kv[0], kv[1])
-		}
-		lbConfigOverride := &k3d.LoadbalancerConfig{}
-		if err := tmpViper.Unmarshal(lbConfigOverride); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal loadbalancer config override into loadbalancer config: %w", err)
-		}
-		if err := mergo.MergeWithOverwrite(cluster.ServerLoadBalancer.Config, lbConfigOverride); err != nil {
-			return nil, fmt.Errorf("failed to override loadbalancer config: %w", err)
+		if err := loadbalancerOverrideConfig(cluster.ServerLoadBalancer.Config, opts.ConfigOverrides); err != nil {
+			return nil, err
 		}
 	}
 
@@ -221,9 +672,132 @@ func LoadbalancerPrepare(ctx context.Context, runtime runtimes.Runtime, cluster
 		Restart:       true,
 	}
 
+	if opts != nil {
+		if err := loadbalancerSetMode(lbNode, opts.Mode); err != nil {
+			return nil, err
+		}
+	}
+
 	return lbNode, nil
 }
 
+// loadbalancerSetMode makes the loadbalancer node run the implementation of the mode (the default is nginx)
+func loadbalancerSetMode(lbNode *k3d.Node, mode k3d.LoadbalancerMode) error {
+	switch mode {
+	case "", k3d.LoadbalancerModeNginx:
+		return nil
+	case k3d.LoadbalancerModeNative:
+		lbNode.Cmd = []string{"proxy", "--config", k3d.DefaultLoadbalancerConfigPath}
+		if lbNode.RuntimeLabels == nil {
+			lbNode.RuntimeLabels = map[string]string{}
+		}
+		lbNode.RuntimeLabels[k3d.LabelLoadbalancerMode] = string(mode)
+
+		if os.Getenv(k3d.K3dEnvImageLoadbalancerNative) != "" || goruntime.GOOS != "linux" {
+			// an image containing the (linux) k3d binary as its entrypoint
+			l.Log().Debugf("Native loadbalancer '%s' runs the k3d binary of an image, as the running one can't be copied into it", lbNode.Name)
+			lbNode.Image = k3d.GetLoadbalancerNativeImage()
+			return nil
+		}
+		// the running k3d binary is copied into the tools image, which k3d uses anyway, when the loadbalancer starts (see loadbalancerCopyBinary)
+		lbNode.Image = k3d.GetToolsImage()
+		lbNode.RuntimeLabels[k3d.LabelLoadbalancerCopyBinary] = "true"
+		return nil
+	}
+	return fmt.Errorf("invalid loadbalancer mode '%s': must be one of %v", mode, k3d.LoadbalancerModes)
+}
+
+// loadbalancerCopyBinary copies the running k3d binary into a native loadbalancer running the tools image (see loadbalancerSetMode),
+// on every start, so that it runs the same version as the k3d binary managing it
+func loadbalancerCopyBinary(ctx context.Context, runtime runtimes.Runtime, node *k3d.Node) error {
+	if node.Role != k3d.LoadBalancerRole || node.RuntimeLabels[k3d.LabelLoadbalancerCopyBinary] != "true" {
+		return nil
+	}
+	binary, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find the k3d binary to copy into loadbalancer '%s': %w", node.Name, err)
+	}
+	action := actions.WriteHostFileAction{
+		Runtime:     runtime,
+		Src:         binary,
+		Dest:        k3d.DefaultLoadbalancerNativeBinary,
+		Mode:        0755,
+		Description: "Copy the k3d binary into the native loadbalancer",
+	}
+	l.Log().Tracef("Node %s: %s", node.Name, action.Info())
+	if err := action.Run(ctx, node); err != nil {
+		return fmt.Errorf("failed to copy the k3d binary into loadbalancer '%s': %w", node.Name, err)
+	}
+	return nil
+}
+
+// LoadbalancerPrepareNamed prepares a named loadbalancer next to the server loadbalancer of the cluster.
+// It doesn't proxy the Kubernetes API, so its ports have to be added via TransformLoadbalancerPorts.
+func LoadbalancerPrepareNamed(ctx context.Context, runtime runtimes.Runtime, cluster *k3d.Cluster, name string, opts *k3d.LoadbalancerCreateOpts) (*k3d.Loadbalancer, error) {
+	if err := ValidateHostname(name); err != nil {
+		return nil, fmt.Errorf("invalid loadbalancer name: %w", err)
+	}
+	if name == "server" {
+		return nil, fmt.Errorf("invalid loadbalancer name '%s': reserved for the server loadbalancer", name)
+	}
+	if cluster.GetLoadbalancer(name) != nil {
+		return nil, fmt.Errorf("cluster '%s' already has a loadbalancer named '%s'", cluster.Name, name)
+	}
+
+	labels := map[string]string{}
+	if opts != nil {
+		for k, v := range opts.Labels {
+			labels[k] = v
+		}
+	}
+	labels[k3d.LabelLoadbalancerName] = name
+
+	lb := k3d.NewLoadbalancer()
+	lb.Node = &k3d.Node{
+		Name:          fmt.Sprintf("%s-%s-%slb", k3d.DefaultObjectNamePrefix, cluster.Name, name),
+		Image:         k3d.GetLoadbalancerImage(),
+		Ports:         nat.PortMap{},
+		Role:          k3d.LoadBalancerRole,
+		RuntimeLabels: labels,
+		Networks:      []string{cluster.Network.Name},
+		Restart:       true,
+	}
+
+	if opts != nil {
+		if err := loadbalancerSetMode(lb.Node, opts.Mode); err != nil {
+			return nil, err
+		}
+		if len(opts.ConfigOverrides) > 0 {
+			if err := loadbalancerOverrideConfig(lb.Config, opts.ConfigOverrides); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return lb, nil
+}
+
+// loadbalancerOverrideConfig sets the KEY=VALUE overrides in the loadbalancer config
+func loadbalancerOverrideConfig(lbConfig *k3d.LoadbalancerConfig, overrides []string) error {
+	tmpViper := viper.New()
+	for _, override := range overrides {
+		kv := strings.SplitN(override, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("invalid loadbalancer config override '%s': expected KEY=VALUE", override)
+		}
+		l.Log().Tracef("Overriding LB config with %s...", kv)
+		tmpViper.Set(kv[0], kv[1])
+	}
+	lbConfigOverride := &k3d.LoadbalancerConfig{}
+	if err := tmpViper.Unmarshal(lbConfigOverride); err != nil {
+		return fmt.Errorf("failed to unmarshal loadbalancer config override into loadbalancer config: %w", err)
+	}
+	if err := mergo.MergeWithOverwrite(lbConfig, lbConfigOverride); err != nil {
+		return fmt.Errorf("failed to override loadbalancer config: %w", err)
+	}
+	return nil
+}
+
 func loadbalancerAddPortConfigs(loadbalancer *k3d.Loadbalancer, portmapping nat.PortMapping, targetNodes []*k3d.Node) error {
 	portconfig := fmt.Sprintf("%s.%s", portmapping.Port.Port(), portmapping.Port.Proto())
 	nodenames := []string{}
@@ -240,12 +814,8 @@ func loadbalancerAddPortConfigs(loadbalancer *k3d.Loadbalancer, portmapping nat.
 		return nil
 	}
 
-nodenameLoop:
 	for _, nodename := range nodenames {
-		for _, existingName := range loadbalancer.Config.Ports[portconfig] {
-			if nodename == existingName {
-				continue nodenameLoop
-			}
+		if !slices.Contains(loadbalancer.Config.Ports[portconfig], nodename) {
 			loadbalancer.Config.Ports[portconfig] = append(loadbalancer.Config.Ports[portconfig], nodename)
 		}
 	}
@@ -273,6 +843,7 @@ func loadbalancerRemovePortConfigs(loadbalancer *k3d.Loadbalancer, portmapping n
 		if 0 == len(loadbalancer.Config.Ports[portconfig]) {
 			// deleting the empty map entry to get rid of an invalid Docker-level port mapping it leaves
 			delete(loadbalancer.Config.Ports, portconfig)
+			delete(loadbalancer.Config.Settings.PortOptions, portconfig)
 		}
 	}
 
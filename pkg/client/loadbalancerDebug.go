@@ -0,0 +1,273 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/docker/go-connections/nat"
+
+	l "github.com/k3d-io/k3d/v5/pkg/logger"
+	"github.com/k3d-io/k3d/v5/pkg/runtimes"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+	"github.com/k3d-io/k3d/v5/proxy"
+)
+
+// LoadbalancerRenderConfig renders the nginx config the loadbalancer generates from the given config,
+// using the same template and template functions as confd in the k3d-proxy image
+func LoadbalancerRenderConfig(lbConfig k3d.LoadbalancerConfig) ([]byte, error) {
+	values, err := loadbalancerConfigValues(lbConfig)
+	if err != nil {
+		return nil, err
+	}
+	return proxy.RenderNginxConfig(values)
+}
+
+// loadbalancerConfigValues flattens the config into the keys confd's file backend reads from the values file (e.g. /ports/80.tcp/0)
+func loadbalancerConfigValues(lbConfig k3d.LoadbalancerConfig) (map[string]string, error) {
+	raw, err := json.Marshal(lbConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal loadbalancer config: %w", err)
+	}
+	var tree interface{}
+	if err := json.Unmarshal(raw, &tree); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal loadbalancer config: %w", err)
+	}
+
+	values := map[string]string{}
+	var walk func(key string, node interface{})
+	walk = func(key string, node interface{}) {
+		switch n := node.(type) {
+		case map[string]interface{}:
+			for k, v := range n {
+				walk(path.Join(key, k), v)
+			}
+		case []interface{}:
+			for i, v := range n {
+				walk(path.Join(key, strconv.Itoa(i)), v)
+			}
+		case string:
+			values[key] = n
+		case bool:
+			values[key] = strconv.FormatBool(n)
+		case float64:
+			values[key] = strconv.FormatFloat(n, 'f', -1, 64)
+		}
+	}
+	walk("/", tree)
+	return values, nil
+}
+
+// ValidateLoadbalancerConfig checks a (e.g. hand-edited) loadbalancer config for mistakes nginx would choke on
+func ValidateLoadbalancerConfig(lbConfig k3d.LoadbalancerConfig) error {
+	listening := map[string]string{} // port/proto -> what uses it
+	for port, targets := range lbConfig.Ports {
+		start, end, proto, err := loadbalancerPortRange(port)
+		if err != nil {
+			return err
+		}
+		if len(targets) == 0 {
+			return fmt.Errorf("port '%s' has no targets", port)
+		}
+		for portNum := start; portNum <= end; portNum++ {
+			key := fmt.Sprintf("%d/%s", portNum, proto)
+			if what, ok := listening[key]; ok {
+				return fmt.Errorf("port '%s' overlaps with %s", port, what)
+			}
+			listening[key] = fmt.Sprintf("port %s", port)
+		}
+	}
+
+	if err := loadbalancerCheckPortCount(&lbConfig); err != nil {
+		return err
+	}
+
+	for _, server := range lbConfig.HTTP {
+		if !routeHostRegexp.MatchString(server.Host) {
+			return fmt.Errorf("invalid HTTP host '%s'", server.Host)
+		}
+		key := fmt.Sprintf("%d/tcp", server.Listen)
+		if what, ok := listening[key]; ok && strings.HasPrefix(what, "port") {
+			return fmt.Errorf("HTTP host '%s' listens on port %d, which is already used by %s", server.Host, server.Listen, what)
+		}
+		listening[key] = fmt.Sprintf("HTTP host %s", server.Host)
+		if len(server.Routes) == 0 {
+			return fmt.Errorf("HTTP host '%s' has no routes", server.Host)
+		}
+		for _, route := range server.Routes {
+			if !strings.HasPrefix(route.Path, "/") {
+				return fmt.Errorf("invalid path '%s' for HTTP host '%s'", route.Path, server.Host)
+			}
+			if len(route.Nodes) == 0 {
+				return fmt.Errorf("route '%s%s' has no targets", server.Host, route.Path)
+			}
+		}
+	}
+
+	if what, ok := listening[fmt.Sprintf("%d/tcp", k3d.DefaultLoadbalancerStatusPort)]; ok {
+		return fmt.Errorf("port %d is reserved for the loadbalancer's status endpoint, but used by %s", k3d.DefaultLoadbalancerStatusPort, what)
+	}
+
+	for port, nodeOpts := range lbConfig.Settings.Upstreams {
+		for nodeName, opts := range nodeOpts {
+			if err := ValidateLoadbalancerUpstreamOptions(opts); err != nil {
+				return fmt.Errorf("invalid upstream options for node '%s' on port %s: %w", nodeName, port, err)
+			}
+		}
+	}
+
+	for port, opts := range lbConfig.Settings.PortOptions {
+		if err := validateLoadbalancerPortOptions(lbConfig, port, opts); err != nil {
+			return err
+		}
+	}
+
+	if _, err := LoadbalancerRenderConfig(lbConfig); err != nil {
+		return err
+	}
+	return nil
+}
+
+// LoadbalancerSetConfig replaces the config of a cluster's running server loadbalancer or named loadbalancer (name), e.g. with a hand-edited one
+func LoadbalancerSetConfig(ctx context.Context, runtime runtimes.Runtime, cluster *k3d.Cluster, name string, lbConfig k3d.LoadbalancerConfig) error {
+	if err := ValidateLoadbalancerConfig(lbConfig); err != nil {
+		return fmt.Errorf("invalid loadbalancer config: %w", err)
+	}
+	lbNode, err := loadbalancerGetNode(ctx, runtime, cluster, name)
+	if err != nil {
+		return err
+	}
+
+	// the config can't publish ports, so these wouldn't be reachable from the host
+	for portconfig := range lbConfig.Ports {
+		loadbalancerForEachPort(portconfig, func(port string) {
+			if _, ok := lbNode.Ports[nat.Port(strings.Replace(port, ".", "/", 1))]; !ok {
+				l.Log().Warnf("Port %s is not published by loadbalancer '%s', so it's only reachable from the cluster network", port, lbNode.Name)
+			}
+		})
+	}
+
+	return loadbalancerWriteConfig(ctx, runtime, lbNode, lbConfig)
+}
+
+// LoadbalancerTestConfig runs the config check in the cluster's server loadbalancer or named loadbalancer (name) and returns its output
+func LoadbalancerTestConfig(ctx context.Context, runtime runtimes.Runtime, cluster *k3d.Cluster, name string) (string, error) {
+	lbNode, err := loadbalancerGetNode(ctx, runtime, cluster, name)
+	if err != nil {
+		return "", err
+	}
+	if lbNode.LoadbalancerMode() == k3d.LoadbalancerModeNative {
+		output, err := loadbalancerExec(ctx, runtime, lbNode, []string{k3d.DefaultLoadbalancerNativeBinary, "proxy", "check", "--config", k3d.DefaultLoadbalancerConfigPath})
+		if err != nil {
+			return output, fmt.Errorf("config check failed in loadbalancer '%s': %w", lbNode.Name, err)
+		}
+		return output, nil
+	}
+	output, err := loadbalancerExec(ctx, runtime, lbNode, []string{"nginx", "-t"})
+	if err != nil {
+		return output, fmt.Errorf("nginx config check failed in loadbalancer '%s': %w", lbNode.Name, err)
+	}
+	return output, nil
+}
+
+// stubStatusRegexp parses the output of nginx' stub_status
+var stubStatusRegexp = regexp.MustCompile(`(?s)Active connections:\s*(\d+).*?(\d+)\s+(\d+)\s+(\d+)\s+Reading:\s*(\d+)\s+Writing:\s*(\d+)\s+Waiting:\s*(\d+)`)
+
+// LoadbalancerGetStats returns the connection counters of the cluster's server loadbalancer or named loadbalancer (name)
+func LoadbalancerGetStats(ctx context.Context, runtime runtimes.Runtime, cluster *k3d.Cluster, name string) (*k3d.LoadbalancerStats, error) {
+	lbNode, err := loadbalancerGetNode(ctx, runtime, cluster, name)
+	if err != nil {
+		return nil, err
+	}
+	statusCmd := []string{"wget", "-qO-", fmt.Sprintf("http://127.0.0.1:%d/status", k3d.DefaultLoadbalancerStatusPort)}
+	if lbNode.LoadbalancerMode() == k3d.LoadbalancerModeNative {
+		// the native loadbalancer image has no wget, but serves the same status
+		statusCmd = []string{k3d.DefaultLoadbalancerNativeBinary, "proxy", "stats"}
+	}
+	output, err := loadbalancerExec(ctx, runtime, lbNode, statusCmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query status endpoint of loadbalancer '%s' (it may predate the status endpoint, try replacing it): %w", lbNode.Name, err)
+	}
+
+	match := stubStatusRegexp.FindStringSubmatch(output)
+	if match == nil {
+		return nil, fmt.Errorf("unexpected output of the status endpoint of loadbalancer '%s': %s", lbNode.Name, output)
+	}
+	counters := make([]int64, len(match)-1)
+	for i, value := range match[1:] {
+		if counters[i], err = strconv.ParseInt(value, 10, 64); err != nil {
+			return nil, fmt.Errorf("failed to parse status of loadbalancer '%s': %w", lbNode.Name, err)
+		}
+	}
+	return &k3d.LoadbalancerStats{
+		Active:   counters[0],
+		Accepted: counters[1],
+		Handled:  counters[2],
+		Requests: counters[3],
+		Reading:  counters[4],
+		Writing:  counters[5],
+		Waiting:  counters[6],
+	}, nil
+}
+
+// loadbalancerGetNode returns the (running) server loadbalancer node of a cluster or, if a name is given, the node of the named loadbalancer
+func loadbalancerGetNode(ctx context.Context, runtime runtimes.Runtime, cluster *k3d.Cluster, name string) (*k3d.Node, error) {
+	current, err := ClusterGet(ctx, runtime, &k3d.Cluster{Name: cluster.Name})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cluster '%s': %w", cluster.Name, err)
+	}
+	lb := current.ServerLoadBalancer
+	if name != "" {
+		lb = current.GetLoadbalancer(name)
+	}
+	if lb == nil || lb.Node == nil || lb.Node.Role != k3d.LoadBalancerRole {
+		if name != "" {
+			return nil, fmt.Errorf("cluster '%s' has no loadbalancer named '%s'", cluster.Name, name)
+		}
+		return nil, fmt.Errorf("cluster '%s' has no loadbalancer", cluster.Name)
+	}
+	if !lb.Node.State.Running {
+		return nil, fmt.Errorf("loadbalancer '%s' is not running", lb.Node.Name)
+	}
+	return lb.Node, nil
+}
+
+// loadbalancerExec runs a command in the loadbalancer and returns its output
+func loadbalancerExec(ctx context.Context, runtime runtimes.Runtime, lbNode *k3d.Node, cmd []string) (string, error) {
+	reader, execErr := runtime.ExecInNodeGetLogs(ctx, lbNode, cmd)
+	output := ""
+	if reader != nil {
+		raw, err := io.ReadAll(reader)
+		if err != nil {
+			return "", fmt.Errorf("failed to read output of '%s': %w", strings.Join(cmd, " "), err)
+		}
+		output = string(raw)
+	}
+	return output, execErr
+}
@@ -0,0 +1,117 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package client
+
+import (
+	"strings"
+	"testing"
+
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+func TestLoadbalancerRenderConfig(t *testing.T) {
+	maxFails := 0
+	lbConfig := k3d.LoadbalancerConfig{
+		Ports: map[string][]string{
+			"6443.tcp":        {"k3d-test-server-0", "k3d-test-server-1"},
+			"53.udp":          {"k3d-test-agent-0"},
+			"30000-30002.tcp": {"k3d-test-agent-0"},
+		},
+		HTTP: []k3d.LoadbalancerHTTPServer{
+			{
+				Host:   "app.localhost",
+				Listen: 443,
+				TLS:    &k3d.LoadbalancerHTTPTLS{Certificate: "/etc/nginx/certs/app.crt", Key: "/etc/nginx/certs/app.key"},
+				Routes: []k3d.LoadbalancerHTTPRoute{{Path: "/", Port: 30080, Nodes: []string{"k3d-test-agent-0"}}},
+			},
+		},
+		Settings: k3d.LoadBalancerSettings{
+			WorkerConnections: 1026,
+			Upstreams: map[string]map[string]k3d.LoadbalancerUpstreamOptions{
+				"6443.tcp": {"k3d-test-server-1": {Weight: 2, MaxFails: &maxFails, Down: true}},
+			},
+			PortOptions: map[string]k3d.LoadbalancerPortOptions{"6443.tcp": {ProxyProtocol: true}},
+		},
+	}
+
+	rendered, err := LoadbalancerRenderConfig(lbConfig)
+	if err != nil {
+		t.Fatalf("failed to render loadbalancer config: %v", err)
+	}
+	for _, expected := range []string{
+		"worker_connections 1026;",
+		"server k3d-test-server-0:6443 max_fails=1 fail_timeout=10s;",
+		"server k3d-test-server-1:6443 weight=2 max_fails=0 fail_timeout=10s down;",
+		"listen        53 udp;",
+		"listen        30000;",
+		"listen        30002;",
+		"server k3d-test-agent-0:30001 max_fails=1 fail_timeout=10s;",
+		"listen      443 ssl;",
+		"ssl_certificate     /etc/nginx/certs/app.crt;",
+		"server k3d-test-agent-0:30080 max_fails=1 fail_timeout=10s;",
+		"proxy_timeout 600;",
+		"stub_status;",
+	} {
+		if !strings.Contains(string(rendered), expected) {
+			t.Errorf("expected rendered config to contain '%s', got:\n%s", expected, rendered)
+		}
+	}
+	if count := strings.Count(string(rendered), "proxy_protocol on;"); count != 1 {
+		t.Errorf("expected the PROXY protocol to be enabled for exactly one port, got %d in:\n%s", count, rendered)
+	}
+}
+
+func TestValidateLoadbalancerConfig(t *testing.T) {
+	valid := k3d.LoadbalancerConfig{
+		Ports: map[string][]string{"6443.tcp": {"k3d-test-server-0"}},
+	}
+	if err := ValidateLoadbalancerConfig(valid); err != nil {
+		t.Errorf("expected config to be valid, got %v", err)
+	}
+
+	for name, lbConfig := range map[string]k3d.LoadbalancerConfig{
+		"invalid port":      {Ports: map[string][]string{"6443": {"k3d-test-server-0"}}},
+		"invalid proto":     {Ports: map[string][]string{"6443.sctp": {"k3d-test-server-0"}}},
+		"no targets":        {Ports: map[string][]string{"6443.tcp": {}}},
+		"overlapping ports": {Ports: map[string][]string{"30000-30010.tcp": {"k3d-test-server-0"}, "30005.tcp": {"k3d-test-server-0"}}},
+		"invalid range":     {Ports: map[string][]string{"30010-30000.tcp": {"k3d-test-server-0"}}},
+		"too many ports":    {Ports: map[string][]string{"30000-30400.tcp": {"k3d-test-server-0"}, "30401-30600.udp": {"k3d-test-server-0"}}},
+		"status port":       {Ports: map[string][]string{"18090.tcp": {"k3d-test-server-0"}}},
+		"http port clash":   {Ports: map[string][]string{"80.tcp": {"k3d-test-server-0"}}, HTTP: []k3d.LoadbalancerHTTPServer{{Host: "app.localhost", Listen: 80, Routes: []k3d.LoadbalancerHTTPRoute{{Path: "/", Port: 80, Nodes: []string{"k3d-test-server-0"}}}}}},
+		"invalid upstream": {
+			Ports:    map[string][]string{"6443.tcp": {"k3d-test-server-0"}},
+			Settings: k3d.LoadBalancerSettings{Upstreams: map[string]map[string]k3d.LoadbalancerUpstreamOptions{"6443.tcp": {"k3d-test-server-0": {FailTimeout: "ten seconds"}}}},
+		},
+		"proxy protocol on udp": {
+			Ports:    map[string][]string{"53.udp": {"k3d-test-server-0"}},
+			Settings: k3d.LoadBalancerSettings{PortOptions: map[string]k3d.LoadbalancerPortOptions{"53.udp": {ProxyProtocol: true}}},
+		},
+		"options of unknown port": {
+			Ports:    map[string][]string{"6443.tcp": {"k3d-test-server-0"}},
+			Settings: k3d.LoadBalancerSettings{PortOptions: map[string]k3d.LoadbalancerPortOptions{"443.tcp": {ProxyProtocol: true}}},
+		},
+	} {
+		if err := ValidateLoadbalancerConfig(lbConfig); err == nil {
+			t.Errorf("expected an error for config with %s", name)
+		}
+	}
+}
@@ -0,0 +1,596 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package client_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/k3d-io/k3d/v5/pkg/client"
+	"github.com/k3d-io/k3d/v5/pkg/config"
+	conf "github.com/k3d-io/k3d/v5/pkg/config/v1alpha5"
+	"github.com/k3d-io/k3d/v5/pkg/runtimes/fake"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+func TestFakeRuntimeLoadbalancerReload(t *testing.T) {
+	ctx := context.Background()
+	rt := fake.NewRuntime()
+	cluster := runFakeCluster(t, rt, "test", 1, 2)
+	lbName := cluster.ServerLoadBalancer.Node.Name
+
+	reloaded := func() bool {
+		for _, cmd := range rt.ExecHistory(lbName) {
+			if strings.Contains(strings.Join(cmd, " "), "nginx -s reload") {
+				return true
+			}
+		}
+		return false
+	}
+
+	// a new host port binding requires a new container
+	changeset := &conf.SimpleConfig{
+		Ports: []conf.PortWithNodeFilters{{Port: "8080:80", NodeFilters: []string{"agent:0"}}},
+	}
+	if err := client.ClusterEditChangesetSimple(ctx, rt, cluster, changeset); err != nil {
+		t.Fatalf("failed to edit cluster: %v", err)
+	}
+	if reloaded() {
+		t.Errorf("expected loadbalancer to be replaced instead of reloaded for a new port")
+	}
+
+	// proxying an already published port to more nodes only needs a reload
+	cluster, err := client.ClusterGet(ctx, rt, &k3d.Cluster{Name: "test"})
+	if err != nil {
+		t.Fatalf("failed to get cluster: %v", err)
+	}
+	changeset.Ports = []conf.PortWithNodeFilters{{Port: "8080:80", NodeFilters: []string{"agents:*"}}}
+	if err := client.ClusterEditChangesetSimple(ctx, rt, cluster, changeset); err != nil {
+		t.Fatalf("failed to edit cluster: %v", err)
+	}
+	if !reloaded() {
+		t.Errorf("expected loadbalancer to be reloaded in place, got exec history %v", rt.ExecHistory(lbName))
+	}
+
+	cluster, err = client.ClusterGet(ctx, rt, &k3d.Cluster{Name: "test"})
+	if err != nil {
+		t.Fatalf("failed to get cluster: %v", err)
+	}
+	lbConfig, err := client.GetLoadbalancerConfig(ctx, rt, cluster)
+	if err != nil {
+		t.Fatalf("failed to get loadbalancer config: %v", err)
+	}
+	targets := append([]string{}, lbConfig.Ports["80.tcp"]...)
+	sort.Strings(targets)
+	if !reflect.DeepEqual(targets, []string{"k3d-test-agent-0", "k3d-test-agent-1"}) {
+		t.Errorf("expected port 80.tcp to be proxied to both agents, got %v", lbConfig.Ports)
+	}
+	if bindings := cluster.ServerLoadBalancer.Node.Ports["80/tcp"]; len(bindings) != 1 {
+		t.Errorf("expected a single binding for port 80/tcp, got %v", bindings)
+	}
+}
+
+func TestFakeRuntimeLoadbalancerProxyProtocol(t *testing.T) {
+	ctx := context.Background()
+	rt := fake.NewRuntime()
+	cluster := runFakeCluster(t, rt, "test", 1, 1)
+
+	changeset := &conf.SimpleConfig{
+		Ports: []conf.PortWithNodeFilters{{Port: "8443:443", NodeFilters: []string{"loadbalancer:proxyprotocol"}}},
+	}
+	if err := client.ClusterEditChangesetSimple(ctx, rt, cluster, changeset); err != nil {
+		t.Fatalf("failed to edit cluster: %v", err)
+	}
+
+	// the PROXY protocol can't be used for udp ports
+	cluster, err := client.ClusterGet(ctx, rt, &k3d.Cluster{Name: "test"})
+	if err != nil {
+		t.Fatalf("failed to get cluster: %v", err)
+	}
+	changeset.Ports = []conf.PortWithNodeFilters{{Port: "5353:53/udp", NodeFilters: []string{"agent:0:proxyprotocol"}}}
+	if err := client.ClusterEditChangesetSimple(ctx, rt, cluster, changeset); err == nil {
+		t.Errorf("expected an error when enabling the PROXY protocol for a udp port")
+	}
+
+	// other ports don't use it and it's kept when the loadbalancer is replaced
+	cluster, err = client.ClusterGet(ctx, rt, &k3d.Cluster{Name: "test"})
+	if err != nil {
+		t.Fatalf("failed to get cluster: %v", err)
+	}
+	changeset.Ports = []conf.PortWithNodeFilters{{Port: "8080:80", NodeFilters: []string{"agent:0"}}}
+	if err := client.ClusterEditChangesetSimple(ctx, rt, cluster, changeset); err != nil {
+		t.Fatalf("failed to edit cluster: %v", err)
+	}
+
+	cluster, err = client.ClusterGet(ctx, rt, &k3d.Cluster{Name: "test"})
+	if err != nil {
+		t.Fatalf("failed to get cluster: %v", err)
+	}
+	lbConfig, err := client.GetLoadbalancerConfig(ctx, rt, cluster)
+	if err != nil {
+		t.Fatalf("failed to get loadbalancer config: %v", err)
+	}
+	if !reflect.DeepEqual(lbConfig.Settings.PortOptions, map[string]k3d.LoadbalancerPortOptions{"443.tcp": {ProxyProtocol: true}}) {
+		t.Errorf("expected the PROXY protocol to be enabled for port 443.tcp only, got %v", lbConfig.Settings.PortOptions)
+	}
+	targets := append([]string{}, lbConfig.Ports["443.tcp"]...)
+	sort.Strings(targets)
+	if !reflect.DeepEqual(targets, []string{"k3d-test-agent-0", "k3d-test-server-0"}) {
+		t.Errorf("expected port 443.tcp to be proxied to all nodes, got %v", lbConfig.Ports)
+	}
+}
+
+func TestFakeRuntimeLoadbalancerPortRanges(t *testing.T) {
+	ctx := context.Background()
+	rt := fake.NewRuntime()
+	cluster := runFakeCluster(t, rt, "test", 1, 1)
+
+	lbPorts := func() map[string][]string {
+		cluster, err := client.ClusterGet(ctx, rt, &k3d.Cluster{Name: "test"})
+		if err != nil {
+			t.Fatalf("failed to get cluster: %v", err)
+		}
+		lbConfig, err := client.GetLoadbalancerConfig(ctx, rt, cluster)
+		if err != nil {
+			t.Fatalf("failed to get loadbalancer config: %v", err)
+		}
+		delete(lbConfig.Ports, "6443.tcp")
+		return lbConfig.Ports
+	}
+
+	// a range is kept as a single entry
+	changeset := &conf.SimpleConfig{
+		Ports: []conf.PortWithNodeFilters{{Port: "30000-30010:30000-30010", NodeFilters: []string{"agent:0"}}},
+	}
+	if err := client.ClusterEditChangesetSimple(ctx, rt, cluster, changeset); err != nil {
+		t.Fatalf("failed to edit cluster: %v", err)
+	}
+	if ports := lbPorts(); !reflect.DeepEqual(ports, map[string][]string{"30000-30010.tcp": {"k3d-test-agent-0"}}) {
+		t.Errorf("expected a single port range in the loadbalancer config, got %v", ports)
+	}
+
+	// deleting ports from it splits the range
+	cluster, err := client.ClusterGet(ctx, rt, &k3d.Cluster{Name: "test"})
+	if err != nil {
+		t.Fatalf("failed to get cluster: %v", err)
+	}
+	changeset.Ports = []conf.PortWithNodeFilters{{Port: "30005-30006:30005-30006", NodeFilters: []string{"agent:0"}, Removal: true}}
+	if err := client.ClusterEditChangesetSimple(ctx, rt, cluster, changeset); err != nil {
+		t.Fatalf("failed to edit cluster: %v", err)
+	}
+	expected := map[string][]string{"30000-30004.tcp": {"k3d-test-agent-0"}, "30007-30010.tcp": {"k3d-test-agent-0"}}
+	if ports := lbPorts(); !reflect.DeepEqual(ports, expected) {
+		t.Errorf("expected the port range to be split into %v, got %v", expected, ports)
+	}
+
+	cluster, err = client.ClusterGet(ctx, rt, &k3d.Cluster{Name: "test"})
+	if err != nil {
+		t.Fatalf("failed to get cluster: %v", err)
+	}
+	if _, ok := cluster.ServerLoadBalancer.Node.Ports["30005/tcp"]; ok {
+		t.Errorf("expected port 30005/tcp not to be published anymore, got %v", cluster.ServerLoadBalancer.Node.Ports)
+	}
+	if len(cluster.ServerLoadBalancer.Node.Ports) != 10 { // 9 ports of the ranges + the Kubernetes API
+		t.Errorf("expected 10 published ports, got %v", cluster.ServerLoadBalancer.Node.Ports)
+	}
+
+	// ranges too large for the loadbalancer are rejected
+	changeset.Ports = []conf.PortWithNodeFilters{{Port: "31000-32767:31000-32767", NodeFilters: []string{"agent:0"}}}
+	if err := client.ClusterEditChangesetSimple(ctx, rt, cluster, changeset); err == nil || !strings.Contains(err.Error(), "at most") {
+		t.Errorf("expected an error for a port range exceeding the loadbalancer's limit, got %v", err)
+	}
+	if ports := lbPorts(); !reflect.DeepEqual(ports, expected) {
+		t.Errorf("expected the loadbalancer config to be unchanged, got %v", ports)
+	}
+}
+
+func TestFakeRuntimeNamedLoadbalancers(t *testing.T) {
+	ctx := context.Background()
+	rt := fake.NewRuntime()
+
+	simpleCfg := conf.SimpleConfig{Servers: 1, Agents: 2}
+	simpleCfg.Name = "test"
+	simpleCfg.Options.K3dOptions.Loadbalancers = []conf.SimpleConfigNamedLoadbalancer{
+		{Name: "ingress", Ports: []conf.PortWithNodeFilters{{Port: "127.0.0.2:8080:80", NodeFilters: []string{"agents:*"}}}},
+	}
+	clusterCfg, err := config.TransformSimpleToClusterConfig(ctx, rt, simpleCfg, "")
+	if err != nil {
+		t.Fatalf("failed to transform simple config: %v", err)
+	}
+	if err := client.ClusterRun(ctx, rt, clusterCfg); err != nil {
+		t.Fatalf("failed to run cluster: %v", err)
+	}
+
+	ingressTargets := func() []string {
+		cluster, err := client.ClusterGet(ctx, rt, &k3d.Cluster{Name: "test"})
+		if err != nil {
+			t.Fatalf("failed to get cluster: %v", err)
+		}
+		lb := cluster.GetLoadbalancer("ingress")
+		if lb == nil || lb.Config == nil {
+			t.Fatalf("expected cluster to have a loadbalancer named 'ingress', got %v", cluster.Loadbalancers)
+		}
+		targets := append([]string{}, lb.Config.Ports["80.tcp"]...)
+		sort.Strings(targets)
+		return targets
+	}
+
+	cluster, err := client.ClusterGet(ctx, rt, &k3d.Cluster{Name: "test"})
+	if err != nil {
+		t.Fatalf("failed to get cluster: %v", err)
+	}
+	if len(cluster.Loadbalancers) != 1 || cluster.Loadbalancers[0].Node.Name != "k3d-test-ingresslb" {
+		t.Fatalf("expected the named loadbalancer 'k3d-test-ingresslb', got %v", cluster.Loadbalancers)
+	}
+	if !cluster.HasLoadBalancer() || cluster.ServerLoadBalancer.Node.Name != "k3d-test-serverlb" {
+		t.Errorf("expected the server loadbalancer to be unaffected, got %v", cluster.ServerLoadBalancer)
+	}
+	if bindings := cluster.Loadbalancers[0].Node.Ports["80/tcp"]; len(bindings) != 1 || bindings[0].HostIP != "127.0.0.2" || bindings[0].HostPort != "8080" {
+		t.Errorf("expected port 80 of the named loadbalancer to be published on 127.0.0.2:8080, got %v", bindings)
+	}
+	if _, ok := cluster.ServerLoadBalancer.Config.Ports["80.tcp"]; ok {
+		t.Errorf("expected port 80 not to be proxied by the server loadbalancer, got %v", cluster.ServerLoadBalancer.Config.Ports)
+	}
+	if _, ok := cluster.Loadbalancers[0].Config.Ports["6443.tcp"]; ok {
+		t.Errorf("expected the named loadbalancer not to proxy the Kubernetes API, got %v", cluster.Loadbalancers[0].Config.Ports)
+	}
+	if targets := ingressTargets(); !reflect.DeepEqual(targets, []string{"k3d-test-agent-0", "k3d-test-agent-1"}) {
+		t.Errorf("expected port 80 to be proxied to all agents, got %v", targets)
+	}
+
+	// new agents are added to the named loadbalancer as well
+	if err := client.ClusterScale(ctx, rt, &k3d.Cluster{Name: "test"}, k3d.ClusterScaleOpts{Servers: nodeCount(1), Agents: nodeCount(3)}); err != nil {
+		t.Fatalf("failed to scale up: %v", err)
+	}
+	if targets := ingressTargets(); !reflect.DeepEqual(targets, []string{"k3d-test-agent-0", "k3d-test-agent-1", "k3d-test-agent-2"}) {
+		t.Errorf("expected port 80 to be proxied to all agents after scaling up, got %v", targets)
+	}
+
+	// the debug commands resolve the named loadbalancer by name
+	cluster, err = client.ClusterGet(ctx, rt, &k3d.Cluster{Name: "test"})
+	if err != nil {
+		t.Fatalf("failed to get cluster: %v", err)
+	}
+	ingressConfig := *cluster.GetLoadbalancer("ingress").Config
+	ingressConfig.Settings.DefaultProxyTimeout = 900
+	if err := client.LoadbalancerSetConfig(ctx, rt, cluster, "ingress", ingressConfig); err != nil {
+		t.Fatalf("failed to set config of the named loadbalancer: %v", err)
+	}
+	if err := client.LoadbalancerSetConfig(ctx, rt, cluster, "missing", ingressConfig); err == nil {
+		t.Errorf("expected an error for a loadbalancer name that doesn't exist")
+	}
+	if cluster, err = client.ClusterGet(ctx, rt, &k3d.Cluster{Name: "test"}); err != nil {
+		t.Fatalf("failed to get cluster: %v", err)
+	}
+	if timeout := cluster.GetLoadbalancer("ingress").Config.Settings.DefaultProxyTimeout; timeout != 900 {
+		t.Errorf("expected the config of the named loadbalancer to be replaced, got timeout %d", timeout)
+	}
+	if timeout := cluster.ServerLoadBalancer.Config.Settings.DefaultProxyTimeout; timeout == 900 {
+		t.Errorf("expected the config of the server loadbalancer to stay unchanged")
+	}
+	if _, err := client.LoadbalancerTestConfig(ctx, rt, cluster, "ingress"); err != nil {
+		t.Errorf("failed to check config of the named loadbalancer: %v", err)
+	}
+	if history := rt.ExecHistory("k3d-test-ingresslb"); len(history) == 0 || !reflect.DeepEqual(history[len(history)-1], []string{"nginx", "-t"}) {
+		t.Errorf("expected the config check to run in the named loadbalancer, got %v", history)
+	}
+
+	// the named loadbalancer shares the lifecycle of the cluster
+	if err := client.ClusterStop(ctx, rt, cluster); err != nil {
+		t.Fatalf("failed to stop cluster: %v", err)
+	}
+	stopped, err := client.ClusterGet(ctx, rt, &k3d.Cluster{Name: "test"})
+	if err != nil {
+		t.Fatalf("failed to get cluster: %v", err)
+	}
+	if stopped.Loadbalancers[0].Node.State.Running {
+		t.Errorf("expected the named loadbalancer to be stopped")
+	}
+	envInfo, err := client.GatherEnvironmentInfo(ctx, rt, stopped)
+	if err != nil {
+		t.Fatalf("failed to gather environment info: %v", err)
+	}
+	if err := client.ClusterStart(ctx, rt, stopped, k3d.ClusterStartOpts{EnvironmentInfo: envInfo}); err != nil {
+		t.Fatalf("failed to start cluster: %v", err)
+	}
+	started, err := client.ClusterGet(ctx, rt, &k3d.Cluster{Name: "test"})
+	if err != nil {
+		t.Fatalf("failed to get cluster: %v", err)
+	}
+	if !started.Loadbalancers[0].Node.State.Running {
+		t.Errorf("expected the named loadbalancer to be running again")
+	}
+
+	if err := client.ClusterDelete(ctx, rt, started, k3d.ClusterDeleteOpts{}); err != nil {
+		t.Fatalf("failed to delete cluster: %v", err)
+	}
+	nodes, err := client.NodeList(ctx, rt)
+	if err != nil {
+		t.Fatalf("failed to list nodes: %v", err)
+	}
+	if len(nodes) != 0 {
+		t.Errorf("expected no nodes to be left, got %d", len(nodes))
+	}
+}
+
+func TestFakeRuntimeLoadbalancerReloadFailed(t *testing.T) {
+	ctx := context.Background()
+	rt := fake.NewRuntime()
+	cluster := runFakeCluster(t, rt, "test", 1, 0)
+
+	// the loadbalancer neither reloads nor picks up the new config on its own, only a restart applies it
+	rt.ExecHandler = func(node *k3d.Node, cmd []string, stdin []byte) (string, error) {
+		if node.Role == k3d.LoadBalancerRole && strings.Contains(strings.Join(cmd, " "), "nginx -s reload") {
+			return "", fmt.Errorf("nginx: [emerg] unexpected end of file")
+		}
+		return "", nil
+	}
+	rt.FileWriteLogScripts = nil
+
+	before, err := rt.GetNode(ctx, cluster.ServerLoadBalancer.Node)
+	if err != nil {
+		t.Fatalf("failed to get loadbalancer: %v", err)
+	}
+	lbConfig, err := client.GetLoadbalancerConfig(ctx, rt, cluster)
+	if err != nil {
+		t.Fatalf("failed to get loadbalancer config: %v", err)
+	}
+	lbConfig.Settings.DefaultProxyTimeout = 900
+	if err := client.LoadbalancerSetConfig(ctx, rt, cluster, "", lbConfig); err != nil {
+		t.Fatalf("expected the loadbalancer to be restarted after the failed reload, got: %v", err)
+	}
+
+	after, err := rt.GetNode(ctx, cluster.ServerLoadBalancer.Node)
+	if err != nil {
+		t.Fatalf("failed to get loadbalancer: %v", err)
+	}
+	if !after.State.Running || after.State.Started == before.State.Started {
+		t.Errorf("expected loadbalancer to be restarted, got state %+v (before: %+v)", after.State, before.State)
+	}
+	updated, err := client.GetLoadbalancerConfig(ctx, rt, cluster)
+	if err != nil {
+		t.Fatalf("failed to get loadbalancer config: %v", err)
+	}
+	if updated.Settings.DefaultProxyTimeout != 900 {
+		t.Errorf("expected the loadbalancer config to be replaced, got %+v", updated)
+	}
+}
+
+func TestFakeRuntimeLoadbalancerUpstreams(t *testing.T) {
+	ctx := context.Background()
+	rt := fake.NewRuntime()
+
+	simpleCfg := conf.SimpleConfig{Servers: 2}
+	simpleCfg.Name = "test"
+	simpleCfg.Options.K3dOptions.Loadbalancer.Upstreams = []conf.LoadbalancerUpstreamWithNodeFilters{
+		{Port: "6443", Weight: 3, FailTimeout: "30s", NodeFilters: []string{"server:0"}},
+	}
+	clusterCfg, err := config.TransformSimpleToClusterConfig(ctx, rt, simpleCfg, "")
+	if err != nil {
+		t.Fatalf("failed to transform simple config: %v", err)
+	}
+	if err := client.ClusterRun(ctx, rt, clusterCfg); err != nil {
+		t.Fatalf("failed to run cluster: %v", err)
+	}
+
+	getUpstreams := func() map[string]k3d.LoadbalancerUpstreamOptions {
+		t.Helper()
+		cluster, err := client.ClusterGet(ctx, rt, &k3d.Cluster{Name: "test"})
+		if err != nil {
+			t.Fatalf("failed to get cluster: %v", err)
+		}
+		lbConfig, err := client.GetLoadbalancerConfig(ctx, rt, cluster)
+		if err != nil {
+			t.Fatalf("failed to get loadbalancer config: %v", err)
+		}
+		return lbConfig.Settings.Upstreams["6443.tcp"]
+	}
+
+	expected := k3d.LoadbalancerUpstreamOptions{Weight: 3, FailTimeout: "30s"}
+	if opts := getUpstreams()["k3d-test-server-0"]; !reflect.DeepEqual(opts, expected) {
+		t.Errorf("expected upstream options %+v for the first server, got %+v", expected, opts)
+	}
+
+	// draining only changes the loadbalancer config and keeps the other options
+	drain := true
+	server := &k3d.Node{Name: "k3d-test-server-1", Role: k3d.ServerRole, RuntimeLabels: map[string]string{k3d.LabelClusterName: "test"}}
+	if err := client.NodeEdit(ctx, rt, server, &client.NodeEditChangeset{LoadbalancerDrain: &drain}); err != nil {
+		t.Fatalf("failed to drain node: %v", err)
+	}
+	upstreams := getUpstreams()
+	if !upstreams["k3d-test-server-1"].Down {
+		t.Errorf("expected drained server to be down, got %+v", upstreams)
+	}
+	if !reflect.DeepEqual(upstreams["k3d-test-server-0"], expected) {
+		t.Errorf("expected upstream options of the first server to be kept, got %+v", upstreams)
+	}
+
+	// options survive a regenerated config
+	node := &k3d.Node{Name: "k3d-test-agent-0", Role: k3d.AgentRole, Image: k3d.DefaultK3sImageRepo}
+	if err := client.NodeAddToCluster(ctx, rt, node, &k3d.Cluster{Name: "test"}, k3d.NodeCreateOpts{}); err != nil {
+		t.Fatalf("failed to add node to cluster: %v", err)
+	}
+	if err := client.UpdateLoadbalancerConfig(ctx, rt, &k3d.Cluster{Name: "test"}); err != nil {
+		t.Fatalf("failed to update loadbalancer config: %v", err)
+	}
+	if !getUpstreams()["k3d-test-server-1"].Down {
+		t.Errorf("expected drained server to stay down after updating the loadbalancer")
+	}
+
+	drain = false
+	if err := client.NodeEdit(ctx, rt, server, &client.NodeEditChangeset{LoadbalancerDrain: &drain}); err != nil {
+		t.Fatalf("failed to undrain node: %v", err)
+	}
+	if opts, ok := getUpstreams()["k3d-test-server-1"]; ok {
+		t.Errorf("expected no upstream options for the undrained server, got %+v", opts)
+	}
+
+	// nodes that aren't targets of the loadbalancer can't be drained
+	drain = true
+	if err := client.NodeEdit(ctx, rt, &k3d.Node{Name: "k3d-test-agent-0", Role: k3d.AgentRole, RuntimeLabels: map[string]string{k3d.LabelClusterName: "test"}}, &client.NodeEditChangeset{LoadbalancerDrain: &drain}); err == nil {
+		t.Errorf("expected an error draining a node that isn't a loadbalancer target")
+	}
+}
+
+func TestFakeRuntimeLoadbalancerDebug(t *testing.T) {
+	ctx := context.Background()
+	rt := fake.NewRuntime()
+	rt.ExecHandler = func(node *k3d.Node, cmd []string, stdin []byte) (string, error) {
+		if cmd[0] == "wget" {
+			return "Active connections: 3 \nserver accepts handled requests\n 17 16 31 \nReading: 0 Writing: 2 Waiting: 1 \n", nil
+		}
+		return "", nil
+	}
+	cluster := runFakeCluster(t, rt, "test", 1, 1)
+
+	stats, err := client.LoadbalancerGetStats(ctx, rt, cluster, "")
+	if err != nil {
+		t.Fatalf("failed to get loadbalancer stats: %v", err)
+	}
+	expected := k3d.LoadbalancerStats{Active: 3, Accepted: 17, Handled: 16, Requests: 31, Writing: 2, Waiting: 1}
+	if *stats != expected {
+		t.Errorf("expected stats %+v, got %+v", expected, *stats)
+	}
+
+	lbConfig, err := client.GetLoadbalancerConfig(ctx, rt, cluster)
+	if err != nil {
+		t.Fatalf("failed to get loadbalancer config: %v", err)
+	}
+	lbConfig.Settings.DefaultProxyTimeout = 900
+	if err := client.LoadbalancerSetConfig(ctx, rt, cluster, "", lbConfig); err != nil {
+		t.Fatalf("failed to set loadbalancer config: %v", err)
+	}
+	updated, err := client.GetLoadbalancerConfig(ctx, rt, cluster)
+	if err != nil {
+		t.Fatalf("failed to get loadbalancer config: %v", err)
+	}
+	if updated.Settings.DefaultProxyTimeout != 900 {
+		t.Errorf("expected the loadbalancer config to be replaced, got %+v", updated)
+	}
+
+	lbConfig.Ports["6443.tcp"] = nil
+	if err := client.LoadbalancerSetConfig(ctx, rt, cluster, "", lbConfig); err == nil {
+		t.Errorf("expected an error for a config with a port without targets")
+	}
+}
+
+func TestFakeRuntimeLoadbalancerNativeMode(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv(k3d.K3dEnvImageLoadbalancerNative, "")
+	rt := fake.NewRuntime()
+	rt.ExecHandler = func(node *k3d.Node, cmd []string, stdin []byte) (string, error) {
+		if cmd[0] == k3d.DefaultLoadbalancerNativeBinary && cmd[len(cmd)-1] == "stats" {
+			return "Active connections: 1 \nserver accepts handled requests\n 5 5 0 \nReading: 0 Writing: 1 Waiting: 0 \n", nil
+		}
+		return "", nil
+	}
+
+	simpleCfg := conf.SimpleConfig{Servers: 1, Agents: 1}
+	simpleCfg.Name = "test"
+	simpleCfg.Options.K3dOptions.Loadbalancer.Mode = string(k3d.LoadbalancerModeNative)
+	simpleCfg.Options.K3dOptions.Loadbalancers = []conf.SimpleConfigNamedLoadbalancer{
+		{Name: "ingress", Ports: []conf.PortWithNodeFilters{{Port: "8080:80", NodeFilters: []string{"agents:*"}}}},
+	}
+	clusterCfg, err := config.TransformSimpleToClusterConfig(ctx, rt, simpleCfg, "")
+	if err != nil {
+		t.Fatalf("failed to transform simple config: %v", err)
+	}
+	if err := client.ClusterRun(ctx, rt, clusterCfg); err != nil {
+		t.Fatalf("failed to run cluster: %v", err)
+	}
+
+	cluster, err := client.ClusterGet(ctx, rt, &k3d.Cluster{Name: "test"})
+	if err != nil {
+		t.Fatalf("failed to get cluster: %v", err)
+	}
+	binary, err := os.Executable()
+	if err != nil {
+		t.Fatalf("failed to find the running binary: %v", err)
+	}
+	binaryInfo, err := os.Stat(binary)
+	if err != nil {
+		t.Fatalf("failed to stat the running binary: %v", err)
+	}
+	for _, lbNode := range []*k3d.Node{cluster.ServerLoadBalancer.Node, cluster.GetLoadbalancer("ingress").Node} {
+		// no image of its own: the running binary is copied into the tools image
+		if lbNode.LoadbalancerMode() != k3d.LoadbalancerModeNative || lbNode.Image != k3d.GetToolsImage() || lbNode.RuntimeLabels[k3d.LabelLoadbalancerCopyBinary] != "true" {
+			t.Errorf("expected loadbalancer '%s' to run the copied k3d binary in the tools image, got mode '%s', image '%s' and labels %v", lbNode.Name, lbNode.LoadbalancerMode(), lbNode.Image, lbNode.RuntimeLabels)
+		}
+		if content, ok := rt.ReadFile(lbNode.Name, k3d.DefaultLoadbalancerNativeBinary); !ok || int64(len(content)) != binaryInfo.Size() {
+			t.Errorf("expected the running binary to be copied to %s in loadbalancer '%s'", k3d.DefaultLoadbalancerNativeBinary, lbNode.Name)
+		}
+		if !reflect.DeepEqual(lbNode.Cmd, []string{"proxy", "--config", k3d.DefaultLoadbalancerConfigPath}) {
+			t.Errorf("expected loadbalancer '%s' to run the proxy command, got %v", lbNode.Name, lbNode.Cmd)
+		}
+	}
+
+	// updates reload the native loadbalancer instead of nginx
+	if err := client.ClusterScale(ctx, rt, &k3d.Cluster{Name: "test"}, k3d.ClusterScaleOpts{Servers: nodeCount(1), Agents: nodeCount(2)}); err != nil {
+		t.Fatalf("failed to scale up: %v", err)
+	}
+	reloaded := false
+	for _, cmd := range rt.ExecHistory("k3d-test-serverlb") {
+		if cmd[0] == "sh" {
+			t.Errorf("expected no nginx reload in the native loadbalancer, got %v", cmd)
+		}
+		if reflect.DeepEqual(cmd, []string{k3d.DefaultLoadbalancerNativeBinary, "proxy", "reload"}) {
+			reloaded = true
+		}
+	}
+	if !reloaded {
+		t.Errorf("expected the native loadbalancer to be reloaded, got %v", rt.ExecHistory("k3d-test-serverlb"))
+	}
+
+	stats, err := client.LoadbalancerGetStats(ctx, rt, cluster, "")
+	if err != nil {
+		t.Fatalf("failed to get loadbalancer stats: %v", err)
+	}
+	if expected := (k3d.LoadbalancerStats{Active: 1, Accepted: 5, Handled: 5, Writing: 1}); *stats != expected {
+		t.Errorf("expected stats %+v, got %+v", expected, *stats)
+	}
+
+	lbConfig, err := client.GetLoadbalancerConfig(ctx, rt, cluster)
+	if err != nil {
+		t.Fatalf("failed to get loadbalancer config: %v", err)
+	}
+	lbConfig.HTTP = []k3d.LoadbalancerHTTPServer{{Host: "app.localhost", Listen: 80, Routes: []k3d.LoadbalancerHTTPRoute{{Path: "/", Port: 30080, Nodes: []string{"k3d-test-agent-0"}}}}}
+	if err := client.LoadbalancerSetConfig(ctx, rt, cluster, "", lbConfig); err == nil {
+		t.Errorf("expected an error for HTTP routes in the native loadbalancer")
+	}
+
+	simpleCfg.Name = "routes"
+	simpleCfg.Options.K3dOptions.Loadbalancer.Routes = []conf.LoadbalancerRouteWithNodeFilters{{Host: "app.localhost", Port: 30080}}
+	if _, err := config.TransformSimpleToClusterConfig(ctx, rt, simpleCfg, ""); err == nil {
+		t.Errorf("expected an error for loadbalancer routes in native mode")
+	}
+	simpleCfg.Options.K3dOptions.Loadbalancer.Routes = nil
+	simpleCfg.Options.K3dOptions.Loadbalancer.Mode = "haproxy"
+	if _, err := config.TransformSimpleToClusterConfig(ctx, rt, simpleCfg, ""); err == nil {
+		t.Errorf("expected an error for an unknown loadbalancer mode")
+	}
+}
@@ -26,6 +26,7 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -122,6 +123,8 @@ func NodeAddToCluster(ctx context.Context, runtime runtimes.Runtime, node *k3d.N
 	if srcNode.Role != node.Role {
 		l.Log().Debugf("Dropping some fields from source node because it's not of the same role (%s != %s)...", srcNode.Role, node.Role)
 		srcNode.Memory = "" // memory settings are scoped per role (--servers-memory/--agents-memory)
+		srcNode.CPUs = ""   // same for CPU limits (--servers-cpus/--agents-cpus)
+		srcNode.CPUSet = ""
 	}
 
 	// TODO: I guess proper deduplication can be handled in a cleaner/better way or at the infofaker level at some point
@@ -179,6 +182,12 @@ func NodeAddToCluster(ctx context.Context, runtime runtimes.Runtime, node *k3d.N
 		registryConfigBytes = bytes.Trim(registryConfigBytes[512:], "\x00") // trim control characters, etc.
 	}
 
+	// fetch the CAs of TLS-enabled registries referenced in the registry config (before the source node gets overwritten)
+	registryCAHooks := []k3d.NodeHook{}
+	if len(registryConfigBytes) != 0 {
+		registryCAHooks = registryCopyCAHooks(ctx, runtime, srcNode, registryConfigBytes)
+	}
+
 	// merge node config of new node into existing node config
 	if err := mergo.MergeWithOverwrite(srcNode, *node); err != nil {
 		return fmt.Errorf("failed to merge new node config into existing node config: %w", err)
@@ -205,10 +214,13 @@ func NodeAddToCluster(ctx context.Context, runtime runtimes.Runtime, node *k3d.N
 		// Use LB if available as registration url for nodes
 		// otherwise fallback to server node
 		var registrationNode *k3d.Node
-		serverLBNodes := util.FilterNodesByRole(cluster.Nodes, k3d.LoadBalancerRole)
-		if len(serverLBNodes) > 0 {
-			registrationNode = serverLBNodes[0]
-		} else {
+		for _, existingNode := range cluster.Nodes {
+			if existingNode.IsServerLoadBalancer() {
+				registrationNode = existingNode
+				break
+			}
+		}
+		if registrationNode == nil {
 			for _, existingNode := range cluster.Nodes {
 				if existingNode.Role == k3d.ServerRole {
 					registrationNode = existingNode
@@ -253,6 +265,7 @@ func NodeAddToCluster(ctx context.Context, runtime runtimes.Runtime, node *k3d.N
 				},
 			},
 		)
+		createNodeOpts.NodeHooks = append(createNodeOpts.NodeHooks, registryCAHooks...)
 	}
 
 	if cluster.Network.Name != "host" {
@@ -281,9 +294,9 @@ func NodeAddToCluster(ctx context.Context, runtime runtimes.Runtime, node *k3d.N
 		return fmt.Errorf("failed to run node '%s': %w", node.Name, err)
 	}
 
-	// if it's a server node, then update the loadbalancer configuration
-	if node.Role == k3d.ServerRole {
-		l.Log().Infoln("Updating loadbalancer config to include new server node(s)")
+	// if it's a server node (or an agent node with named loadbalancers), then update the loadbalancer configuration
+	if node.Role == k3d.ServerRole || (node.Role == k3d.AgentRole && len(cluster.Loadbalancers) > 0) {
+		l.Log().Infof("Updating loadbalancer config to include new %s node(s)", node.Role)
 		if err := UpdateLoadbalancerConfig(ctx, runtime, cluster); err != nil {
 			if !errors.Is(err, ErrLBConfigHostNotFound) {
 				return fmt.Errorf("error updating loadbalancer: %w", err)
@@ -446,6 +459,10 @@ func NodeStart(ctx context.Context, runtime runtimes.Runtime, node *k3d.Node, no
 		return fmt.Errorf("failed to enable k3d fixes: %w", err)
 	}
 
+	if err := loadbalancerCopyBinary(ctx, runtime, node); err != nil {
+		return err
+	}
+
 	startTime := time.Now()
 	l.Log().Debugf("Node %s Start Time: %+v", node.Name, startTime)
 
@@ -599,6 +616,42 @@ func enableFixes(ctx context.Context, runtime runtimes.Runtime, node *k3d.Node,
 	return nil
 }
 
+// userRuntimeLabels returns the runtime labels of a node that were set by the user, i.e. not the ones generated by k3d.
+// Runtimes only return the k3d labels of existing nodes, so the user labels are read from the label that nodeRecordUserLabels sets on creation.
+func userRuntimeLabels(labels map[string]string) map[string]string {
+	userLabels := map[string]string{}
+	if recorded, ok := labels[k3d.LabelNodeUserLabels]; ok {
+		if err := json.Unmarshal([]byte(recorded), &userLabels); err != nil {
+			l.Log().Warnf("Failed to read user labels from label '%s': %v", k3d.LabelNodeUserLabels, err)
+		}
+	}
+	for k, v := range labels {
+		if _, ok := k3d.DefaultRuntimeLabels[k]; ok || strings.HasPrefix(k, "k3d") {
+			continue
+		}
+		userLabels[k] = v
+	}
+	if len(userLabels) == 0 {
+		return nil
+	}
+	return userLabels
+}
+
+// nodeRecordUserLabels stores the user labels of a node in a k3d label, so that they can be compared and carried over later on
+func nodeRecordUserLabels(node *k3d.Node) error {
+	delete(node.RuntimeLabels, k3d.LabelNodeUserLabels) // copied from another node, which might have different user labels
+	userLabels := userRuntimeLabels(node.RuntimeLabels)
+	if len(userLabels) == 0 {
+		return nil
+	}
+	userLabelsJSON, err := json.Marshal(userLabels)
+	if err != nil {
+		return fmt.Errorf("failed to marshal user labels of node '%s': %w", node.Name, err)
+	}
+	node.RuntimeLabels[k3d.LabelNodeUserLabels] = string(userLabelsJSON)
+	return nil
+}
+
 // NodeCreate creates a new containerized k3s node
 func NodeCreate(ctx context.Context, runtime runtimes.Runtime, node *k3d.Node, createNodeOpts k3d.NodeCreateOpts) error {
 	l.Log().Tracef("Creating node from spec\n%+v", node)
@@ -611,6 +664,9 @@ func NodeCreate(ctx context.Context, runtime runtimes.Runtime, node *k3d.Node, c
 
 	// ### Labels ###
 	node.FillRuntimeLabels()
+	if err := nodeRecordUserLabels(node); err != nil {
+		return err
+	}
 
 	for k, v := range node.K3sNodeLabels {
 		node.Args = append(node.Args, "--node-label", fmt.Sprintf("%s=%s", k, v))
@@ -696,6 +752,26 @@ func NodeDelete(ctx context.Context, runtime runtimes.Runtime, node *k3d.Node, o
 		}
 	}
 
+	// delete the CA and credentials of a registry, which were kept in the k3d config dir
+	if node.Role == k3d.RegistryRole && (node.RuntimeLabels[k3d.LabelRegistryProtocol] == "https" || node.RuntimeLabels[k3d.LabelRegistryAuth] != "") {
+		if err := RegistryRemoveHostFiles(node.Name); err != nil {
+			l.Log().Errorf("Could not remove the CA and credentials of registry %s: %+v", node.Name, err)
+		}
+	}
+
+	// delete the data volume of a registry, which was created alongside it, only if asked to, as it holds the (cached) images
+	if volume, ok := node.RuntimeLabels[k3d.LabelRegistryVolume]; ok && node.Role == k3d.RegistryRole {
+		if opts.DeleteRegistryVolume {
+			if err := runtime.DeleteVolume(ctx, volume); err != nil {
+				l.Log().Errorf("Could not remove the data volume of registry %s: %+v", node.Name, err)
+			} else {
+				l.Log().Infof("Deleted data volume '%s' of registry '%s'", volume, node.Name)
+			}
+		} else {
+			l.Log().Infof("Keeping data volume '%s' of registry '%s', which a registry re-created with the same name will use again", volume, node.Name)
+		}
+	}
+
 	// update the server loadbalancer
 	if !opts.SkipLBUpdate && (node.Role == k3d.ServerRole || node.Role == k3d.AgentRole) {
 		cluster, err := ClusterGet(ctx, runtime, &k3d.Cluster{Name: node.RuntimeLabels[k3d.LabelClusterName]})
@@ -703,8 +779,8 @@ func NodeDelete(ctx context.Context, runtime runtimes.Runtime, node *k3d.Node, o
 			return fmt.Errorf("failed fo find cluster for node '%s': %w", node.Name, err)
 		}
 
-		// if it's a server node, then update the loadbalancer configuration
-		if node.Role == k3d.ServerRole && cluster.ServerLoadBalancer != nil {
+		// if it's a server node, then update the loadbalancer configuration (named loadbalancers may target agents as well)
+		if (node.Role == k3d.ServerRole && cluster.ServerLoadBalancer != nil) || len(cluster.Loadbalancers) > 0 {
 			if err := UpdateLoadbalancerConfig(ctx, runtime, cluster); err != nil {
 				if !errors.Is(err, ErrLBConfigHostNotFound) {
 					return fmt.Errorf("failed to update cluster loadbalancer: %w", err)
@@ -939,11 +1015,29 @@ type NodeEditPortBinding struct {
 }
 
 type NodeEditChangeset struct {
-	Ports map[nat.Port][]NodeEditPortBinding
+	Ports  map[nat.Port][]NodeEditPortBinding
+	CPUs   *string // nil: unchanged, empty: no limit
+	CPUSet *string // nil: unchanged, empty: no pinning
+
+	LoadbalancerDrain *bool // nil: unchanged, true: taken out of the loadbalancer's rotation, false: put back
 }
 
 // NodeEdit let's you update an existing node
 func NodeEdit(ctx context.Context, runtime runtimes.Runtime, existingNode *k3d.Node, changeset *NodeEditChangeset) error {
+	// === Loadbalancer drain ===
+	// only the loadbalancer config changes, so the node doesn't need to be replaced for this
+	if changeset.LoadbalancerDrain != nil {
+		if existingNode.Role != k3d.ServerRole && existingNode.Role != k3d.AgentRole {
+			return fmt.Errorf("only server and agent nodes can be drained from the loadbalancer")
+		}
+		if err := LoadbalancerDrainNode(ctx, runtime, &k3d.Cluster{Name: existingNode.RuntimeLabels[k3d.LabelClusterName]}, existingNode.Name, *changeset.LoadbalancerDrain); err != nil {
+			return fmt.Errorf("failed to drain node '%s' from the loadbalancer: %w", existingNode.Name, err)
+		}
+		if len(changeset.Ports) == 0 && changeset.CPUs == nil && changeset.CPUSet == nil {
+			return nil
+		}
+	}
+
 	/*
 	 * Make a deep copy of the existing node
 	 */
@@ -990,19 +1084,55 @@ func NodeEdit(ctx context.Context, runtime runtimes.Runtime, existingNode *k3d.N
 		}
 	}
 
+	// === Resources ===
+	if changeset.CPUs != nil {
+		if *changeset.CPUs != "" {
+			if _, err := util.ParseCPUs(*changeset.CPUs); err != nil {
+				return fmt.Errorf("invalid CPU limit: %w", err)
+			}
+		}
+		result.CPUs = *changeset.CPUs
+	}
+	if changeset.CPUSet != nil {
+		if *changeset.CPUSet != "" {
+			if err := util.ValidateCPUSet(*changeset.CPUSet); err != nil {
+				return fmt.Errorf("invalid cpuset: %w", err)
+			}
+		}
+		result.CPUSet = *changeset.CPUSet
+	}
+
+	// --- K3s node specifics ---
+	if result.Role == k3d.ServerRole || result.Role == k3d.AgentRole {
+		return nodeEditK3sNode(ctx, runtime, existingNode, result)
+	}
+
 	// --- Loadbalancer specifics ---
 	if result.Role == k3d.LoadBalancerRole {
 		cluster, err := ClusterGet(ctx, runtime, &k3d.Cluster{Name: existingNode.RuntimeLabels[k3d.LabelClusterName]})
 		if err != nil {
 			return fmt.Errorf("error updating loadbalancer config: %w", err)
 		}
-		if cluster.ServerLoadBalancer == nil {
-			cluster.ServerLoadBalancer = k3d.NewLoadbalancer()
+		lb := cluster.ServerLoadBalancer
+		if name := existingNode.RuntimeLabels[k3d.LabelLoadbalancerName]; name != "" {
+			lb = cluster.GetLoadbalancer(name)
 		}
-		cluster.ServerLoadBalancer.Node = result
-		lbConfig, err := LoadbalancerGenerateConfig(cluster)
-		if err != nil {
-			return fmt.Errorf("error generating loadbalancer config: %v", err)
+		if lb == nil {
+			lb = k3d.NewLoadbalancer()
+			if result.IsServerLoadBalancer() {
+				cluster.ServerLoadBalancer = lb
+			}
+		}
+		lb.Node = result
+		lbConfig := loadbalancerGenerateConfig(cluster, lb)
+		if lb.Config != nil {
+			// existing ports keep their targets (e.g. the agents of an ingress loadbalancer) instead of being proxied to the servers
+			lbConfig = loadbalancerKeepTargets(*lb.Config, lbConfig, cluster.Nodes)
+		}
+
+		// without resource changes, the config is reloaded in place, unless new host port bindings require a new container
+		if changeset.CPUs == nil && changeset.CPUSet == nil {
+			return loadbalancerUpdate(ctx, runtime, existingNode, result.Ports, lbConfig, nil)
 		}
 
 		// prepare to write config to lb container
@@ -1023,13 +1153,47 @@ func NodeEdit(ctx context.Context, runtime runtimes.Runtime, existingNode *k3d.N
 		}
 
 		result.HookActions = append(result.HookActions, writeLbConfigAction)
+		loadbalancerKeepCertificates(runtime, existingNode, result)
 	}
 
 	// replace existing node
-	return NodeReplace(ctx, runtime, existingNode, result)
+	return NodeReplace(ctx, runtime, existingNode, result, k3d.NodeReplaceOpts{})
 }
 
-func NodeReplace(ctx context.Context, runtime runtimes.Runtime, old, new *k3d.Node) error {
+// nodeEditK3sNode replaces a server or agent node with one using the edited resources.
+// Other than the loadbalancer, k3s nodes are rebuilt from their sanitized spec and keep their k3s state.
+func nodeEditK3sNode(ctx context.Context, runtime runtimes.Runtime, existingNode *k3d.Node, edited *k3d.Node) error {
+	cluster, err := ClusterGet(ctx, runtime, &k3d.Cluster{Name: existingNode.RuntimeLabels[k3d.LabelClusterName]})
+	if err != nil {
+		return fmt.Errorf("failed to get cluster of node '%s': %w", existingNode.Name, err)
+	}
+	envInfo, err := GatherEnvironmentInfo(ctx, runtime, cluster)
+	if err != nil {
+		return fmt.Errorf("failed to gather environment information: %w", err)
+	}
+
+	spec := snapshotNodeFromNode(existingNode)
+	replacement, err := replacementNode(existingNode, &k3d.Node{
+		Name:          existingNode.Name,
+		Role:          existingNode.Role,
+		Image:         existingNode.Image,
+		Args:          spec.Args,
+		Env:           spec.Env,
+		Volumes:       spec.Volumes,
+		Ports:         spec.Ports,
+		RuntimeLabels: spec.RuntimeLabels,
+		Memory:        spec.Memory,
+		CPUs:          edited.CPUs,
+		CPUSet:        edited.CPUSet,
+	})
+	if err != nil {
+		return err
+	}
+
+	return nodeReplaceKeepingState(ctx, runtime, existingNode, replacement, k3d.NodeReplaceOpts{EnvironmentInfo: envInfo})
+}
+
+func NodeReplace(ctx context.Context, runtime runtimes.Runtime, old, new *k3d.Node, opts k3d.NodeReplaceOpts) error {
 	// rename existing node
 	oldNameTemp := fmt.Sprintf("%s-%s", old.Name, util.GenerateRandomString(5))
 	oldNameOriginal := old.Name
@@ -1056,20 +1220,24 @@ func NodeReplace(ctx context.Context, runtime runtimes.Runtime, old, new *k3d.No
 
 	// start new node
 	l.Log().Infof("Starting new node %s...", new.Name)
-	if err := NodeStart(ctx, runtime, new, &k3d.NodeStartOpts{Wait: true, NodeHooks: new.HookActions}); err != nil {
-		if err := NodeDelete(ctx, runtime, new, k3d.NodeDeleteOpts{SkipLBUpdate: true}); err != nil {
-			return fmt.Errorf("Failed to start new node. Also failed to rollback: %+v", err)
-		}
-		if err := runtime.RenameNode(ctx, old, oldNameOriginal); err != nil {
-			return fmt.Errorf("Failed to start new node. Also failed to rename %s back to %s: %+v", old.Name, oldNameOriginal, err)
-		}
-		old.Name = oldNameOriginal
-		if err := NodeStart(ctx, runtime, old, &k3d.NodeStartOpts{Wait: true}); err != nil {
-			return fmt.Errorf("Failed to start new node. Also failed to restart old node: %+v", err)
+	startCtx := ctx
+	if opts.Timeout > 0*time.Second {
+		var cancel context.CancelFunc
+		startCtx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	if err := NodeStart(startCtx, runtime, new, &k3d.NodeStartOpts{Wait: true, NodeHooks: new.HookActions, EnvironmentInfo: opts.EnvironmentInfo}); err != nil {
+		if rollbackErr := NodeReplaceRollback(ctx, runtime, old, new, oldNameOriginal, opts); rollbackErr != nil {
+			return fmt.Errorf("Failed to start new node: %+v. Also failed to roll back: %w", err, rollbackErr)
 		}
 		return fmt.Errorf("Failed to start new node. Rolled back: %+v", err)
 	}
 
+	if opts.KeepOldNode {
+		l.Log().Debugf("Keeping old node %s for a possible rollback", old.Name)
+		return nil
+	}
+
 	// cleanup: delete old node
 	l.Log().Infof("Deleting old node %s...", old.Name)
 	if err := NodeDelete(ctx, runtime, old, k3d.NodeDeleteOpts{SkipLBUpdate: true}); err != nil {
@@ -1080,6 +1248,24 @@ func NodeReplace(ctx context.Context, runtime runtimes.Runtime, old, new *k3d.No
 	return nil
 }
 
+// NodeReplaceRollback brings back the old node of a replacement (see NodeReplace): it deletes the new node,
+// renames the old node back to its original name and starts it again
+func NodeReplaceRollback(ctx context.Context, runtime runtimes.Runtime, old, new *k3d.Node, name string, opts k3d.NodeReplaceOpts) error {
+	l.Log().Infof("Rolling back to old node %s...", old.Name)
+	if err := NodeDelete(ctx, runtime, new, k3d.NodeDeleteOpts{SkipLBUpdate: true}); err != nil {
+		return fmt.Errorf("failed to delete new node '%s': %w", new.Name, err)
+	}
+	if err := runtime.RenameNode(ctx, old, name); err != nil {
+		return fmt.Errorf("failed to rename %s back to %s: %w", old.Name, name, err)
+	}
+	old.Name = name
+	old.State.Running = false
+	if err := NodeStart(ctx, runtime, old, &k3d.NodeStartOpts{Wait: true, EnvironmentInfo: opts.EnvironmentInfo}); err != nil {
+		return fmt.Errorf("failed to restart old node '%s': %w", name, err)
+	}
+	return nil
+}
+
 type CopyNodeOpts struct {
 	keepState bool
 }
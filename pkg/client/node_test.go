@@ -0,0 +1,125 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package client_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/k3d-io/k3d/v5/pkg/client"
+	"github.com/k3d-io/k3d/v5/pkg/runtimes/fake"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+func TestFakeRuntimeNodeAddToCluster(t *testing.T) {
+	ctx := context.Background()
+	rt := fake.NewRuntime()
+	cluster := runFakeCluster(t, rt, "test", 1, 0)
+
+	node := &k3d.Node{
+		Name:  "k3d-test-agent-new",
+		Role:  k3d.AgentRole,
+		Image: k3d.DefaultK3sImageRepo,
+	}
+	if err := client.NodeAddToCluster(ctx, rt, node, cluster, k3d.NodeCreateOpts{Wait: true}); err != nil {
+		t.Fatalf("failed to add node to cluster: %v", err)
+	}
+
+	cluster, err := client.ClusterGet(ctx, rt, &k3d.Cluster{Name: "test"})
+	if err != nil {
+		t.Fatalf("failed to get cluster: %v", err)
+	}
+	if len(cluster.Nodes) != 3 {
+		t.Fatalf("expected 3 nodes after adding an agent, got %d", len(cluster.Nodes))
+	}
+
+	added, err := client.NodeGet(ctx, rt, node)
+	if err != nil {
+		t.Fatalf("failed to get added node: %v", err)
+	}
+	if !added.State.Running {
+		t.Errorf("expected added node to be running")
+	}
+	if added.RuntimeLabels[k3d.LabelClusterName] != "test" {
+		t.Errorf("expected added node to be labeled with the cluster name, got labels %v", added.RuntimeLabels)
+	}
+	network, err := rt.GetNetwork(ctx, &cluster.Network)
+	if err != nil {
+		t.Fatalf("failed to get cluster network: %v", err)
+	}
+	if !network.IPAM.IPPrefix.Contains(added.IP.IP) {
+		t.Errorf("expected added node to have an IP in %s, got '%s'", network.IPAM.IPPrefix, added.IP.IP)
+	}
+}
+
+func TestFakeRuntimeNodeEditCPUs(t *testing.T) {
+	ctx := context.Background()
+	rt := fake.NewRuntime()
+	runFakeCluster(t, rt, "test", 1, 1)
+
+	agent := &k3d.Node{Name: "k3d-test-agent-0"}
+	if err := rt.WriteToNode(ctx, []byte("secret"), "/etc/rancher/node/password", 0600, agent); err != nil {
+		t.Fatalf("failed to write node password: %v", err)
+	}
+
+	existing, err := client.NodeGet(ctx, rt, agent)
+	if err != nil {
+		t.Fatalf("failed to get node: %v", err)
+	}
+	cpus, cpuset := "1.50", "0-1"
+	if err := client.NodeEdit(ctx, rt, existing, &client.NodeEditChangeset{CPUs: &cpus, CPUSet: &cpuset}); err != nil {
+		t.Fatalf("failed to edit node: %v", err)
+	}
+
+	edited, err := client.NodeGet(ctx, rt, agent)
+	if err != nil {
+		t.Fatalf("failed to get edited node: %v", err)
+	}
+	if edited.CPUs != "1.5" || edited.CPUSet != "0-1" {
+		t.Errorf("expected 1.5 CPUs pinned to 0-1, got '%s' CPUs pinned to '%s'", edited.CPUs, edited.CPUSet)
+	}
+	if !edited.State.Running {
+		t.Errorf("expected edited node to be running")
+	}
+	if password, _ := rt.ReadFile(agent.Name, "/etc/rancher/node/password"); string(password) != "secret" {
+		t.Errorf("expected node password to be carried over, got '%s'", password)
+	}
+
+	// removing the limit keeps the pinning
+	none := ""
+	if err := client.NodeEdit(ctx, rt, edited, &client.NodeEditChangeset{CPUs: &none}); err != nil {
+		t.Fatalf("failed to edit node again: %v", err)
+	}
+	edited, err = client.NodeGet(ctx, rt, agent)
+	if err != nil {
+		t.Fatalf("failed to get edited node: %v", err)
+	}
+	if edited.CPUs != "" || edited.CPUSet != "0-1" {
+		t.Errorf("expected no CPU limit pinned to 0-1, got '%s' CPUs pinned to '%s'", edited.CPUs, edited.CPUSet)
+	}
+
+	invalid := "0.0000000001"
+	if err := client.NodeEdit(ctx, rt, edited, &client.NodeEditChangeset{CPUs: &invalid}); err == nil {
+		t.Errorf("expected an error for an invalid CPU limit")
+	}
+}
@@ -25,6 +25,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"reflect"
+	"slices"
+	"sort"
 	"strings"
 
 	"github.com/docker/go-connections/nat"
@@ -44,9 +47,25 @@ var (
 )
 
 func TransformPorts(ctx context.Context, runtime runtimes.Runtime, cluster *k3d.Cluster, portsWithNodeFilters []config.PortWithNodeFilters) error {
+	return transformPorts(cluster, cluster.ServerLoadBalancer, portsWithNodeFilters)
+}
+
+// TransformLoadbalancerPorts maps the ports from a named loadbalancer of the cluster to the filtered nodes.
+// In contrast to TransformPorts, there are no direct port mappings.
+func TransformLoadbalancerPorts(cluster *k3d.Cluster, lb *k3d.Loadbalancer, portsWithNodeFilters []config.PortWithNodeFilters) error {
+	return transformPorts(cluster, lb, portsWithNodeFilters)
+}
+
+// transformPorts maps the ports from the loadbalancer (proxy) or from the nodes themselves (direct) to the host
+func transformPorts(cluster *k3d.Cluster, lb *k3d.Loadbalancer, portsWithNodeFilters []config.PortWithNodeFilters) error {
 	nodeCount := len(cluster.Nodes)
 	nodeList := cluster.Nodes
 
+	// port ranges are changed port by port
+	if lb != nil && lb.Config != nil {
+		*lb.Config = loadbalancerExpandPorts(*lb.Config)
+	}
+
 	for _, portWithNodeFilters := range portsWithNodeFilters {
 		l.Log().Tracef("inspecting port mapping for %s with nodefilters %s", portWithNodeFilters.Port, portWithNodeFilters.NodeFilters)
 		if len(portWithNodeFilters.NodeFilters) == 0 && nodeCount > 1 {
@@ -58,11 +77,18 @@ func TransformPorts(ctx context.Context, runtime runtimes.Runtime, cluster *k3d.
 			if strings.HasPrefix(f, "loadbalancer") {
 				l.Log().Infof("portmapping '%s' targets the loadbalancer: defaulting to %s", portWithNodeFilters.Port, types.DefaultTargetsNodefiltersPortMappings)
 				portWithNodeFilters.NodeFilters = types.DefaultTargetsNodefiltersPortMappings
+				if strings.HasSuffix(f, ":proxyprotocol") {
+					nodeFilters := []string{}
+					for _, nf := range types.DefaultTargetsNodefiltersPortMappings {
+						nodeFilters = append(nodeFilters, strings.TrimSuffix(nf, ":proxy")+":proxyprotocol")
+					}
+					portWithNodeFilters.NodeFilters = nodeFilters
+				}
 				break
 			}
 		}
 
-		filteredNodes, err := util.FilterNodesWithSuffix(nodeList, portWithNodeFilters.NodeFilters, "proxy", "direct") // TODO: move "proxy" and "direct" allowed suffices to constants
+		filteredNodes, err := util.FilterNodesWithSuffix(nodeList, portWithNodeFilters.NodeFilters, "proxy", "proxyprotocol", "direct") // TODO: move "proxy", "proxyprotocol" and "direct" allowed suffices to constants
 		if err != nil {
 			return err
 		}
@@ -79,17 +105,34 @@ func TransformPorts(ctx context.Context, runtime runtimes.Runtime, cluster *k3d.
 				return fmt.Errorf("error parsing port spec '%s': %+v", portWithNodeFilters.Port, err)
 			}
 
-			if suffix == "proxy" || suffix == util.NodeFilterSuffixNone { // proxy is the default suffix for port mappings
-				if cluster.ServerLoadBalancer == nil {
+			if suffix == "proxy" || suffix == "proxyprotocol" || suffix == util.NodeFilterSuffixNone { // proxy is the default suffix for port mappings
+				if lb == nil {
 					return fmt.Errorf("port-mapping of type 'proxy' specified, but loadbalancer is disabled")
 				}
-				changePortMappings(cluster.ServerLoadBalancer.Node, portmappings, removalFlag)
 				for _, pm := range portmappings {
-					if err := changeLBPortConfigs(cluster.ServerLoadBalancer, pm, nodes, removalFlag); err != nil {
+					if pm.Port.Int() == k3d.DefaultLoadbalancerStatusPort && pm.Port.Proto() == "tcp" {
+						return fmt.Errorf("port %d of the loadbalancer is reserved for its status endpoint", k3d.DefaultLoadbalancerStatusPort)
+					}
+				}
+				changePortMappings(lb.Node, portmappings, removalFlag)
+				for _, pm := range portmappings {
+					if err := changeLBPortConfigs(lb, pm, nodes, removalFlag); err != nil {
 						return fmt.Errorf("error modifying loadbalancer port config : %w", err)
 					}
 				}
+				// proxyprotocol: the loadbalancer sends the PROXY protocol header, so the targets see the client's address
+				if suffix == "proxyprotocol" && !removalFlag {
+					for _, pm := range portmappings {
+						if pm.Port.Proto() != "tcp" {
+							return fmt.Errorf("error: the PROXY protocol can only be enabled for tcp ports, not for '%s'", pm.Port)
+						}
+						loadbalancerSetPortOptions(lb.Config, fmt.Sprintf("%s.%s", pm.Port.Port(), pm.Port.Proto()), k3d.LoadbalancerPortOptions{ProxyProtocol: true})
+					}
+				}
 			} else if suffix == "direct" {
+				if lb != cluster.ServerLoadBalancer {
+					return fmt.Errorf("error: direct port-mapping (%s) specified for the named loadbalancer '%s'", portmappings, lb.Node.RuntimeLabels[k3d.LabelLoadbalancerName])
+				}
 				if len(nodes) > 1 {
 					return fmt.Errorf("error: cannot apply a direct port-mapping (%s) to more than one node", portmappings)
 				}
@@ -102,10 +145,17 @@ func TransformPorts(ctx context.Context, runtime runtimes.Runtime, cluster *k3d.
 		}
 	}
 
+	if lb != nil && lb.Config != nil {
+		*lb.Config = loadbalancerCompactPorts(*lb.Config)
+		if err := loadbalancerCheckPortCount(lb.Config); err != nil {
+			return err
+		}
+	}
+
 	// print generated loadbalancer config if exists
 	// (avoid segmentation fault if loadbalancer is disabled)
-	if l.Log().GetLevel() >= logrus.DebugLevel && cluster.ServerLoadBalancer != nil {
-		yamlized, err := yaml.Marshal(cluster.ServerLoadBalancer.Config)
+	if l.Log().GetLevel() >= logrus.DebugLevel && lb != nil {
+		yamlized, err := yaml.Marshal(lb.Config)
 		if err != nil {
 			l.Log().Errorf("error printing loadbalancer config: %v", err)
 		} else {
@@ -156,3 +206,154 @@ func removePortMappings(node *k3d.Node, portmappings []nat.PortMapping) {
 		}
 	}
 }
+
+/*
+ * Port ranges in the loadbalancer config
+ *
+ * Ports of the loadbalancer config are either single ports (e.g. 80.tcp) or port ranges (e.g. 30000-30100.tcp),
+ * which nginx.tmpl turns into one upstream and server per port (hence the limit of k3d.MaxLoadbalancerPorts).
+ * To change them, the config is expanded to single ports first and compacted to ranges again afterwards.
+ */
+
+// loadbalancerPortRange returns the first and last port and the protocol of a loadbalancer port config
+func loadbalancerPortRange(portconfig string) (int, int, string, error) {
+	ports, proto, ok := strings.Cut(portconfig, ".")
+	if !ok || (proto != "tcp" && proto != "udp") || ports == "" {
+		return 0, 0, "", fmt.Errorf("invalid port '%s': must be of the form PORT[-PORT].PROTOCOL (tcp or udp)", portconfig)
+	}
+	start, end, err := nat.ParsePortRangeToInt(ports)
+	if err != nil {
+		return 0, 0, "", fmt.Errorf("invalid port '%s': %w", portconfig, err)
+	}
+	return start, end, proto, nil
+}
+
+// loadbalancerPortConfig returns the loadbalancer port config for a port range, which may also be a single port
+func loadbalancerPortConfig(start, end int, proto string) string {
+	if start == end {
+		return fmt.Sprintf("%d.%s", start, proto)
+	}
+	return fmt.Sprintf("%d-%d.%s", start, end, proto)
+}
+
+// loadbalancerProxiedPort returns the port config (single port or range) of the loadbalancer proxying the given port
+func loadbalancerProxiedPort(lbConfig *k3d.LoadbalancerConfig, port nat.Port) (string, bool) {
+	for portconfig := range lbConfig.Ports {
+		start, end, proto, err := loadbalancerPortRange(portconfig)
+		if err == nil && proto == port.Proto() && start <= port.Int() && port.Int() <= end {
+			return portconfig, true
+		}
+	}
+	return "", false
+}
+
+// loadbalancerForEachPort calls fn for each single port (e.g. 30000.tcp) of a port config, or only for the port config itself if it's invalid
+func loadbalancerForEachPort(portconfig string, fn func(port string)) {
+	start, end, proto, err := loadbalancerPortRange(portconfig)
+	if err != nil {
+		fn(portconfig)
+		return
+	}
+	for port := start; port <= end; port++ {
+		fn(loadbalancerPortConfig(port, port, proto))
+	}
+}
+
+// loadbalancerCheckPortCount returns an error if the loadbalancer proxies more than k3d.MaxLoadbalancerPorts single ports
+func loadbalancerCheckPortCount(lbConfig *k3d.LoadbalancerConfig) error {
+	count := 0
+	for portconfig := range lbConfig.Ports {
+		loadbalancerForEachPort(portconfig, func(string) { count++ })
+	}
+	if count > k3d.MaxLoadbalancerPorts {
+		return fmt.Errorf("the loadbalancer would proxy %d ports, but at most %d are supported, as each port (also within port ranges) is a server of its own in the nginx config: use smaller port ranges or map them directly to a node when creating the cluster (e.g. `30000-32767:30000-32767@server:0:direct`)", count, k3d.MaxLoadbalancerPorts)
+	}
+	return nil
+}
+
+// loadbalancerExpandPorts returns a copy of the config, which has an entry per single port instead of port ranges (incl. upstream and port options)
+func loadbalancerExpandPorts(lbConfig k3d.LoadbalancerConfig) k3d.LoadbalancerConfig {
+	expanded := lbConfig
+	expanded.Ports = map[string][]string{}
+	expanded.Settings.Upstreams = nil
+	expanded.Settings.PortOptions = nil
+
+	for portconfig, targets := range lbConfig.Ports {
+		loadbalancerForEachPort(portconfig, func(port string) {
+			expanded.Ports[port] = append([]string{}, targets...)
+		})
+	}
+	for portconfig, nodeOpts := range lbConfig.Settings.Upstreams {
+		loadbalancerForEachPort(portconfig, func(port string) {
+			for nodeName, opts := range nodeOpts {
+				loadbalancerSetUpstreamOptions(&expanded, port, nodeName, opts)
+			}
+		})
+	}
+	for portconfig, opts := range lbConfig.Settings.PortOptions {
+		loadbalancerForEachPort(portconfig, func(port string) {
+			loadbalancerSetPortOptions(&expanded, port, opts)
+		})
+	}
+	return expanded
+}
+
+// loadbalancerCompactPorts returns a copy of the config, in which consecutive ports with the same targets and options are merged into port ranges.
+// The Kubernetes API port is always kept on its own.
+func loadbalancerCompactPorts(lbConfig k3d.LoadbalancerConfig) k3d.LoadbalancerConfig {
+	expanded := loadbalancerExpandPorts(lbConfig)
+	compacted := expanded
+	compacted.Ports = map[string][]string{}
+	compacted.Settings.Upstreams = nil
+	compacted.Settings.PortOptions = nil
+
+	keep := func(portconfig, port string) {
+		compacted.Ports[portconfig] = expanded.Ports[port]
+		for nodeName, opts := range expanded.Settings.Upstreams[port] {
+			loadbalancerSetUpstreamOptions(&compacted, portconfig, nodeName, opts)
+		}
+		loadbalancerSetPortOptions(&compacted, portconfig, expanded.Settings.PortOptions[port])
+	}
+	mergeable := func(a, b string) bool {
+		targetsA := append([]string{}, expanded.Ports[a]...)
+		targetsB := append([]string{}, expanded.Ports[b]...)
+		sort.Strings(targetsA)
+		sort.Strings(targetsB)
+		return slices.Equal(targetsA, targetsB) &&
+			expanded.Settings.PortOptions[a] == expanded.Settings.PortOptions[b] &&
+			reflect.DeepEqual(expanded.Settings.Upstreams[a], expanded.Settings.Upstreams[b])
+	}
+
+	portsByProto := map[string][]int{}
+	for portconfig := range expanded.Ports {
+		port, _, proto, err := loadbalancerPortRange(portconfig)
+		if err != nil || portconfig == fmt.Sprintf("%s.tcp", k3d.DefaultAPIPort) {
+			keep(portconfig, portconfig)
+			continue
+		}
+		portsByProto[proto] = append(portsByProto[proto], port)
+	}
+	for proto, ports := range portsByProto {
+		sort.Ints(ports)
+		for i := 0; i < len(ports); {
+			first := loadbalancerPortConfig(ports[i], ports[i], proto)
+			j := i
+			for j+1 < len(ports) && ports[j+1] == ports[j]+1 && mergeable(first, loadbalancerPortConfig(ports[j+1], ports[j+1], proto)) {
+				j++
+			}
+			keep(loadbalancerPortConfig(ports[i], ports[j], proto), first)
+			i = j + 1
+		}
+	}
+
+	// upstream options of ports that are not proxied, but serve HTTP(S) routes
+	for port, nodeOpts := range expanded.Settings.Upstreams {
+		if _, ok := expanded.Ports[port]; !ok {
+			for nodeName, opts := range nodeOpts {
+				loadbalancerSetUpstreamOptions(&compacted, port, nodeName, opts)
+			}
+		}
+	}
+
+	return compacted
+}
@@ -23,8 +23,12 @@ package client
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/url"
+	"os"
 	gort "runtime"
+	"strings"
 
 	wharfie "github.com/rancher/wharfie/pkg/registries"
 
@@ -67,6 +71,17 @@ func RegistryCreate(ctx context.Context, runtime runtimes.Runtime, reg *k3d.Regi
 		reg.Network = k3d.DefaultRuntimeNetwork
 	}
 
+	impl, err := GetRegistryImplementation(reg.Options.Kind)
+	if err != nil {
+		return nil, err
+	}
+	if reg.Options.Kind == "" {
+		reg.Options.Kind = k3d.RegistryKindDistribution
+	}
+	if reg.Image == "" {
+		reg.Image = impl.DefaultImage()
+	}
+
 	registryNode := &k3d.Node{
 		Name:     reg.Host,
 		Image:    reg.Image,
@@ -76,28 +91,42 @@ func RegistryCreate(ctx context.Context, runtime runtimes.Runtime, reg *k3d.Regi
 		Env:      []string{},
 	}
 
-	if reg.Options.EnforcePortMatch {
-		registryNode.Env = append(registryNode.Env, fmt.Sprintf("REGISTRY_HTTP_ADDR=:%s", reg.ExposureOpts.Binding.HostPort))
+	if len(reg.Volumes) > 0 {
+		registryNode.Volumes = reg.Volumes
 	}
 
-	if reg.Options.Proxy.RemoteURL != "" {
-		registryNode.Env = append(registryNode.Env, fmt.Sprintf("REGISTRY_PROXY_REMOTEURL=%s", reg.Options.Proxy.RemoteURL))
-
-		if reg.Options.Proxy.Username != "" {
-			registryNode.Env = append(registryNode.Env, fmt.Sprintf("REGISTRY_PROXY_USERNAME=%s", reg.Options.Proxy.Username))
+	var certs *registryCertificates
+	if reg.Options.TLS {
+		reg.Protocol = "https"
+		certs, err = registryGenerateCertificates(reg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate TLS certificates for registry '%s': %w", reg.Host, err)
 		}
+	}
 
-		if reg.Options.Proxy.Password != "" {
-			registryNode.Env = append(registryNode.Env, fmt.Sprintf("REGISTRY_PROXY_PASSWORD=%s", reg.Options.Proxy.Password))
+	var htpasswd []byte
+	if reg.Options.Auth != (k3d.RegistryAuth{}) {
+		if err := registryValidateAuth(reg.Options.Auth); err != nil {
+			return nil, err
+		}
+		htpasswd, err = registryGenerateHtpasswd(reg.Options.Auth)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate htpasswd file for registry '%s': %w", reg.Host, err)
 		}
 	}
 
-	if reg.Options.DeleteEnabled {
-		registryNode.Env = append(registryNode.Env, "REGISTRY_STORAGE_DELETE_ENABLED=true")
+	// the implementation gets the resolved proxy password, which is never stored in the registry spec itself
+	spec := *reg
+	if reg.Options.Proxy.RemoteURL != "" {
+		password, err := registryProxyPassword(reg.Options.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get password of the proxied remote registry for registry '%s': %w", reg.Host, err)
+		}
+		spec.Options.Proxy = k3d.RegistryProxy{RemoteURL: reg.Options.Proxy.RemoteURL, Username: reg.Options.Proxy.Username, Password: password}
 	}
-
-	if len(reg.Volumes) > 0 {
-		registryNode.Volumes = reg.Volumes
+	configFiles, err := impl.Configure(&spec, registryNode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure registry '%s' of kind %s: %w", reg.Host, reg.Options.Kind, err)
 	}
 
 	// error out if that registry exists already
@@ -114,7 +143,19 @@ func RegistryCreate(ctx context.Context, runtime runtimes.Runtime, reg *k3d.Regi
 		k3d.LabelRegistryHostIP:       reg.ExposureOpts.Binding.HostIP,
 		k3d.LabelRegistryPortExternal: reg.ExposureOpts.Binding.HostPort,
 		k3d.LabelRegistryPortInternal: reg.ExposureOpts.Port.Port(),
+		k3d.LabelRegistryKind:         string(reg.Options.Kind),
+	}
+	if reg.Protocol != "" {
+		registryNode.RuntimeLabels[k3d.LabelRegistryProtocol] = reg.Protocol
+	}
+	if htpasswd != nil {
+		registryNode.RuntimeLabels[k3d.LabelRegistryAuth] = registryAuthType
 	}
+	optionsLabel, err := registryOptionsLabel(reg.Options)
+	if err != nil {
+		return nil, err
+	}
+	registryNode.RuntimeLabels[k3d.LabelRegistryOptions] = optionsLabel
 	for k, v := range k3d.DefaultRuntimeLabels {
 		registryNode.RuntimeLabels[k] = v
 	}
@@ -126,37 +167,67 @@ func RegistryCreate(ctx context.Context, runtime runtimes.Runtime, reg *k3d.Regi
 	registryNode.Ports = nat.PortMap{}
 	registryNode.Ports[reg.ExposureOpts.Port] = []nat.PortBinding{reg.ExposureOpts.Binding}
 
+	// keep the data in a named volume, unless something else is mounted there already, so it can be exported (see RegistryExport)
+	volumeExisted := false
+	if _, ok := registryDataVolume(registryNode.Volumes, impl.StoragePath()); !ok {
+		volume := registryDataVolumeName(registryNode.Name)
+		if _, err := runtime.GetVolume(volume); err == nil {
+			l.Log().Infof("Using existing data volume '%s' of a previously deleted registry '%s'", volume, registryNode.Name)
+			volumeExisted = true
+		}
+		if err := registryCreateDataVolume(ctx, runtime, volume); err != nil {
+			return nil, err
+		}
+		registryNode.Volumes = append(registryNode.Volumes, fmt.Sprintf("%s:%s", volume, impl.StoragePath()))
+		registryNode.RuntimeLabels[k3d.LabelRegistryVolume] = volume
+	}
+
 	// create the registry node
 	l.Log().Infof("Creating node '%s'", registryNode.Name)
 	if err := NodeCreate(ctx, runtime, registryNode, k3d.NodeCreateOpts{}); err != nil {
+		if volume, ok := registryNode.RuntimeLabels[k3d.LabelRegistryVolume]; ok && !volumeExisted {
+			if err := runtime.DeleteVolume(ctx, volume); err != nil {
+				l.Log().Warnf("Failed to delete data volume '%s' of registry '%s': %v", volume, registryNode.Name, err)
+			}
+		}
 		return nil, fmt.Errorf("failed to create registry node '%s': %w", registryNode.Name, err)
 	}
 
+	for path, content := range configFiles {
+		if err := runtime.WriteToNode(ctx, content, path, impl.ConfigFileMode(), registryNode); err != nil {
+			return nil, fmt.Errorf("failed to write '%s' to registry '%s': %w", path, registryNode.Name, err)
+		}
+	}
+
+	if certs != nil {
+		if err := registryWriteCertificates(ctx, runtime, registryNode, certs, impl.ConfigFileMode()); err != nil {
+			return nil, err
+		}
+		if _, err := registryExportCA(reg, certs.CA); err != nil {
+			l.Log().Warnf("Failed to export the CA of registry '%s' to the host: %v", reg.Host, err)
+		}
+	}
+
+	if htpasswd != nil {
+		if err := registryWriteAuth(ctx, runtime, registryNode, htpasswd, impl.ConfigFileMode()); err != nil {
+			return nil, err
+		}
+		if err := registryStoreAuth(registryNode.Name, reg.Options.Auth); err != nil {
+			return nil, err
+		}
+	}
+
 	l.Log().Infof("Successfully created registry '%s'", registryNode.Name)
 
 	return registryNode, nil
 }
 
-// RegistryConnectClusters connects an existing registry to one or more clusters
+// RegistryConnectClusters connects an existing registry to one or more clusters (see RegistryConnect)
 func RegistryConnectClusters(ctx context.Context, runtime runtimes.Runtime, registryNode *k3d.Node, clusters []*k3d.Cluster) error {
-	// find registry node
-	registryNode, err := NodeGet(ctx, runtime, registryNode)
-	if err != nil {
-		return fmt.Errorf("Failed to find registry node '%s': %w", registryNode.Name, err)
-	}
-
-	// get cluster details and connect
 	failed := 0
 	for _, c := range clusters {
-		cluster, err := ClusterGet(ctx, runtime, c)
-		if err != nil {
-			l.Log().Warnf("Failed to connect to cluster '%s': Cluster not found", c.Name)
-			failed++
-			continue
-		}
-		if err := runtime.ConnectNodeToNetwork(ctx, registryNode, cluster.Network.Name); err != nil {
-			l.Log().Warnf("Failed to connect to cluster '%s': Connection failed", cluster.Name)
-			l.Log().Warnln(err)
+		if err := RegistryConnect(ctx, runtime, registryNode, c); err != nil {
+			l.Log().Warnf("Failed to connect to cluster '%s': %v", c.Name, err)
 			failed++
 		}
 	}
@@ -201,6 +272,29 @@ func RegistryGenerateK3sConfig(ctx context.Context, registries []*k3d.Registry)
 	for _, reg := range registries {
 		internalAddress := fmt.Sprintf("%s:%s", reg.Host, reg.ExposureOpts.Port.Port())
 		externalAddress := fmt.Sprintf("%s:%s", reg.Host, reg.ExposureOpts.Binding.HostPort)
+		protocol := "http"
+		if reg.Protocol != "" {
+			protocol = reg.Protocol
+		}
+
+		// TLS-enabled registries: trust their CA, which is added to the nodes (see RegistryNodeCAPath)
+		// registries with authentication: use their credentials, so no imagePullSecrets are required
+		hasAuth := reg.Options.Auth != (k3d.RegistryAuth{})
+		if protocol == "https" || hasAuth {
+			if regConf.Configs == nil {
+				regConf.Configs = make(map[string]wharfie.RegistryConfig)
+			}
+			for _, address := range []string{internalAddress, externalAddress} {
+				config := wharfie.RegistryConfig{}
+				if protocol == "https" {
+					config.TLS = &wharfie.TLSConfig{CAFile: RegistryNodeCAPath(reg)}
+				}
+				if hasAuth {
+					config.Auth = &wharfie.AuthConfig{Username: reg.Options.Auth.Username, Password: reg.Options.Auth.Password}
+				}
+				regConf.Configs[address] = config
+			}
+		}
 
 		// init mirrors if nil
 		if regConf.Mirrors == nil {
@@ -209,21 +303,21 @@ func RegistryGenerateK3sConfig(ctx context.Context, registries []*k3d.Registry)
 
 		regConf.Mirrors[externalAddress] = wharfie.Mirror{
 			Endpoints: []string{
-				fmt.Sprintf("http://%s", internalAddress),
+				fmt.Sprintf("%s://%s", protocol, internalAddress),
 			},
 			Rewrites: rewritesConf,
 		}
 
 		regConf.Mirrors[internalAddress] = wharfie.Mirror{
 			Endpoints: []string{
-				fmt.Sprintf("http://%s", internalAddress),
+				fmt.Sprintf("%s://%s", protocol, internalAddress),
 			},
 			Rewrites: rewritesConf, // stub out rewrites so we dont override with nil
 		}
 
 		if reg.Options.Proxy.RemoteURL != "" {
-			regConf.Mirrors[reg.Options.Proxy.RemoteURL] = wharfie.Mirror{
-				Endpoints: []string{fmt.Sprintf("http://%s", internalAddress)},
+			regConf.Mirrors[RegistryMirrorName(reg.Options.Proxy.RemoteURL)] = wharfie.Mirror{
+				Endpoints: []string{fmt.Sprintf("%s://%s", protocol, internalAddress)},
 			}
 		}
 	}
@@ -231,6 +325,71 @@ func RegistryGenerateK3sConfig(ctx context.Context, registries []*k3d.Registry)
 	return regConf, nil
 }
 
+// RegistryMirrorName returns the name of the upstream registry proxied via remoteURL, as used in the mirrors section of the registries.yaml
+// (e.g. docker.io for https://registry-1.docker.io)
+func RegistryMirrorName(remoteURL string) string {
+	name := strings.TrimSuffix(remoteURL, "/")
+	if u, err := url.Parse(remoteURL); err == nil && u.Host != "" {
+		name = u.Host
+	}
+	if name == k3d.DefaultDockerHubAddress || name == "index.docker.io" {
+		return "docker.io"
+	}
+	return name
+}
+
+// RegistryMirrorRemoteURL returns the URL of an upstream registry, which may be given by its name only (e.g. ghcr.io or docker.io)
+func RegistryMirrorRemoteURL(upstream string) string {
+	if strings.Contains(upstream, "://") {
+		return upstream
+	}
+	if RegistryMirrorName(upstream) == "docker.io" {
+		return fmt.Sprintf("https://%s", k3d.DefaultDockerHubAddress)
+	}
+	return fmt.Sprintf("https://%s", strings.TrimSuffix(upstream, "/"))
+}
+
+// registryOptionsLabel returns the options of a registry as stored in its labels, i.e. without any secrets
+func registryOptionsLabel(options k3d.RegistryOptions) (string, error) {
+	options.Proxy = k3d.RegistryProxy{RemoteURL: options.Proxy.RemoteURL, Username: options.Proxy.Username}
+	options.Auth.Password = ""
+	optionsJSON, err := json.Marshal(options)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal registry options: %w", err)
+	}
+	return string(optionsJSON), nil
+}
+
+// registryProxyPassword returns the password of the proxied remote registry, which may be read from a file or an environment variable,
+// so that it doesn't have to be part of the config
+func registryProxyPassword(proxy k3d.RegistryProxy) (string, error) {
+	set := 0
+	for _, p := range []string{proxy.Password, proxy.PasswordFile, proxy.PasswordEnv} {
+		if p != "" {
+			set++
+		}
+	}
+	if set > 1 {
+		return "", fmt.Errorf("only one of password, passwordFile and passwordEnv may be set")
+	}
+
+	switch {
+	case proxy.PasswordFile != "":
+		content, err := os.ReadFile(proxy.PasswordFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read password file: %w", err)
+		}
+		return strings.TrimRight(string(content), "\r\n"), nil
+	case proxy.PasswordEnv != "":
+		password, ok := os.LookupEnv(proxy.PasswordEnv)
+		if !ok {
+			return "", fmt.Errorf("environment variable '%s' is not set", proxy.PasswordEnv)
+		}
+		return password, nil
+	}
+	return proxy.Password, nil
+}
+
 // RegistryGet gets a registry node by name and returns it as a registry object
 func RegistryGet(ctx context.Context, runtime runtimes.Runtime, name string) (*k3d.Registry, error) {
 	regNode, err := runtime.GetNode(ctx, &k3d.Node{
@@ -251,8 +410,26 @@ func RegistryGet(ctx context.Context, runtime runtimes.Runtime, name string) (*k
 // RegistryFromNode transforms a node spec to a registry spec
 func RegistryFromNode(node *k3d.Node) (*k3d.Registry, error) {
 	registry := &k3d.Registry{
-		Host:  node.Name,
-		Image: node.Image,
+		Host:     node.Name,
+		Image:    node.Image,
+		Protocol: node.RuntimeLabels[k3d.LabelRegistryProtocol],
+	}
+	if options, ok := node.RuntimeLabels[k3d.LabelRegistryOptions]; ok {
+		if err := json.Unmarshal([]byte(options), &registry.Options); err != nil {
+			return nil, fmt.Errorf("failed to parse options of registry '%s' from label '%s': %w", node.Name, k3d.LabelRegistryOptions, err)
+		}
+	}
+	registry.Options.Kind = node.RegistryKind()
+	impl, err := GetRegistryImplementation(registry.Options.Kind)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse registry spec from node '%s': %w", node.Name, err)
+	}
+	registry.Options.TLS = registry.Protocol == "https"
+	registry.Options.DeleteEnabled = impl.DeleteEnabled(node)
+	for _, env := range node.Env {
+		if remoteURL, ok := strings.CutPrefix(env, "REGISTRY_PROXY_REMOTEURL="); ok {
+			registry.Options.Proxy.RemoteURL = remoteURL
+		}
 	}
 
 	// we expect exactly one portmap
@@ -0,0 +1,316 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package client
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	l "github.com/k3d-io/k3d/v5/pkg/logger"
+	"github.com/k3d-io/k3d/v5/pkg/runtimes"
+	runtimeErr "github.com/k3d-io/k3d/v5/pkg/runtimes/errors"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+const registryArchiveDataDir = "data" // archive directory holding the contents of the registry volume
+
+// RegistryExport writes the registry spec and the contents of its volume (see RegistryImplementation.StoragePath) as gzipped tar archive to w.
+// The data is streamed out via a k3d-tools node, which mounts the volume of the registry.
+// The password of a registry with authentication is left out, unless opts.IncludeCredentials is set.
+func RegistryExport(ctx context.Context, runtime runtimes.Runtime, registryNode *k3d.Node, w io.Writer, opts k3d.RegistryExportOpts) error {
+	reg, err := RegistryFromNode(registryNode)
+	if err != nil {
+		return fmt.Errorf("failed to translate node to registry spec: %w", err)
+	}
+	if registryNode.RuntimeLabels[k3d.LabelRegistryAuth] != "" {
+		reg.Options.Auth, err = RegistryGetAuth(registryNode)
+		if err != nil {
+			return err
+		}
+		if opts.IncludeCredentials {
+			l.Log().Warnf("The archive contains the password of registry '%s' in plain text: anyone who can read it can access the registry!", registryNode.Name)
+		} else {
+			reg.Options.Auth.Password = ""
+		}
+	}
+	reg.ExposureOpts.Host = registryNode.RuntimeLabels[k3d.LabelRegistryHost]
+
+	impl, err := GetRegistryImplementation(reg.Options.Kind)
+	if err != nil {
+		return err
+	}
+
+	manifest, err := yaml.Marshal(reg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal registry spec: %w", err)
+	}
+
+	dataNode := registryNode
+	if volume, ok := registryDataVolume(registryNode.Volumes, impl.StoragePath()); ok {
+		toolsNode, err := runRegistryToolsNode(ctx, runtime, registryNode.Name, volume, impl.StoragePath())
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := runtime.DeleteNode(ctx, toolsNode); err != nil {
+				l.Log().Errorf("failed to delete tools node '%s' (try to delete it manually): %v", toolsNode.Name, err)
+			}
+		}()
+		dataNode = toolsNode
+	} else {
+		l.Log().Warnf("Registry '%s' has no volume mounted at %s (created by an older version of k3d?): reading the data from the registry itself", registryNode.Name, impl.StoragePath())
+	}
+
+	gzipWriter := gzip.NewWriter(w)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	if err := writeTarFile(tarWriter, k3d.RegistryArchiveManifestName, 0644, manifest); err != nil {
+		return err
+	}
+	if err := registryExportData(ctx, runtime, dataNode, impl.StoragePath(), tarWriter); err != nil {
+		return err
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return fmt.Errorf("failed to close registry archive: %w", err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return fmt.Errorf("failed to close registry archive: %w", err)
+	}
+	return nil
+}
+
+// registryExportData streams the contents of the registry volume from the node into the archive
+func registryExportData(ctx context.Context, runtime runtimes.Runtime, node *k3d.Node, storagePath string, tarWriter *tar.Writer) error {
+	reader, err := runtime.ReadFromNode(ctx, storagePath, node)
+	if err != nil {
+		if errors.Is(err, runtimeErr.ErrRuntimeFileNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to read registry data from node '%s': %w", node.Name, err)
+	}
+	defer reader.Close()
+
+	files := 0
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			l.Log().Infof("Exported %d files from the registry volume", files)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read registry data: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := strings.TrimPrefix(strings.TrimPrefix(header.Name, path.Base(storagePath)), "/")
+		l.Log().Debugf("Adding '%s' to registry archive", name)
+		if err := tarWriter.WriteHeader(&tar.Header{Name: path.Join(registryArchiveDataDir, name), Mode: header.Mode, Size: header.Size, ModTime: header.ModTime, Typeflag: tar.TypeReg}); err != nil {
+			return fmt.Errorf("failed to write tar header: %w", err)
+		}
+		if _, err := io.Copy(tarWriter, tarReader); err != nil {
+			return fmt.Errorf("failed to write '%s' to registry archive: %w", name, err)
+		}
+		files++
+	}
+}
+
+// RegistryImport creates and starts a new registry from an archive written by RegistryExport.
+// The data is restored into the new registry's volume via a k3d-tools node before the registry is started.
+func RegistryImport(ctx context.Context, runtime runtimes.Runtime, r io.Reader, opts k3d.RegistryImportOpts) (*k3d.Node, error) {
+	dataDir, err := os.MkdirTemp("", "k3d-registry-import-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory for registry data: %w", err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	reg, files, err := readRegistryArchive(r, dataDir)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Name != "" {
+		reg.Host = opts.Name
+	}
+	if opts.ExposureOpts != nil {
+		reg.ExposureOpts = *opts.ExposureOpts
+	}
+	if opts.Auth != nil {
+		reg.Options.Auth = *opts.Auth
+	} else if reg.Options.Auth.Username != "" && reg.Options.Auth.Password == "" {
+		return nil, fmt.Errorf("registry '%s' requires authentication, but the archive doesn't contain the password of user '%s': pass the credentials of the new registry (e.g. via `--auth`)", reg.Host, reg.Options.Auth.Username)
+	}
+	if reg.Options.Proxy.Username != "" {
+		l.Log().Warnf("The password of the proxied remote registry is not part of the archive: registry '%s' will access %s without credentials", reg.Host, reg.Options.Proxy.RemoteURL)
+		reg.Options.Proxy.Username = ""
+	}
+
+	impl, err := GetRegistryImplementation(reg.Options.Kind)
+	if err != nil {
+		return nil, err
+	}
+
+	if existingNode, err := runtime.GetNode(ctx, &k3d.Node{Name: reg.Host}); err == nil && existingNode != nil {
+		return nil, fmt.Errorf("cannot import registry '%s' because a node with that name already exists", reg.Host)
+	}
+
+	volume := registryDataVolumeName(reg.Host)
+	if _, err := runtime.GetVolume(volume); err == nil {
+		return nil, fmt.Errorf("cannot import registry '%s' because its data volume '%s' already exists (left over from a deleted registry, remove it with `docker volume rm %s`)", reg.Host, volume, volume)
+	}
+	if err := registryCreateDataVolume(ctx, runtime, volume); err != nil {
+		return nil, err
+	}
+
+	if files > 0 {
+		toolsNode, err := runRegistryToolsNode(ctx, runtime, reg.Host, volume, impl.StoragePath())
+		if err != nil {
+			return nil, err
+		}
+		l.Log().Infof("Restoring %d files to the volume of registry '%s'...", files, reg.Host)
+		err = runtime.CopyToNode(ctx, dataDir+string(os.PathSeparator)+".", impl.StoragePath(), toolsNode)
+		if deleteErr := runtime.DeleteNode(ctx, toolsNode); deleteErr != nil {
+			l.Log().Errorf("failed to delete tools node '%s' (try to delete it manually): %v", toolsNode.Name, deleteErr)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to restore data of registry '%s': %w", reg.Host, err)
+		}
+	}
+
+	return RegistryRun(ctx, runtime, reg)
+}
+
+// readRegistryArchive reads the registry spec from an archive written by RegistryExport and extracts the registry data to dataDir
+func readRegistryArchive(r io.Reader, dataDir string) (*k3d.Registry, int, error) {
+	gzipReader, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read registry archive: %w", err)
+	}
+	defer gzipReader.Close()
+
+	var reg *k3d.Registry
+	files := 0
+
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to read registry archive: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := path.Clean(header.Name)
+		switch {
+		case name == k3d.RegistryArchiveManifestName:
+			content, err := io.ReadAll(tarReader)
+			if err != nil {
+				return nil, 0, fmt.Errorf("failed to read registry spec: %w", err)
+			}
+			reg = &k3d.Registry{}
+			if err := yaml.Unmarshal(content, reg); err != nil {
+				return nil, 0, fmt.Errorf("failed to unmarshal registry spec: %w", err)
+			}
+		case strings.HasPrefix(name, registryArchiveDataDir+"/"):
+			dest := filepath.Join(dataDir, filepath.FromSlash(strings.TrimPrefix(name, registryArchiveDataDir+"/")))
+			if !strings.HasPrefix(dest, filepath.Clean(dataDir)+string(os.PathSeparator)) {
+				return nil, 0, fmt.Errorf("invalid data path '%s' in registry archive", name)
+			}
+			if err := extractFile(tarReader, dest, header.Mode); err != nil {
+				return nil, 0, err
+			}
+			files++
+		}
+	}
+
+	if reg == nil {
+		return nil, 0, fmt.Errorf("invalid registry archive: missing %s", k3d.RegistryArchiveManifestName)
+	}
+	return reg, files, nil
+}
+
+// registryDataVolume returns the source (named volume or host path) mounted at the storage path of the registry
+func registryDataVolume(volumes []string, storagePath string) (string, bool) {
+	for _, volume := range volumes {
+		src, dest, found := strings.Cut(volume, ":")
+		if !found {
+			continue
+		}
+		dest, _, _ = strings.Cut(dest, ":")
+		if path.Clean(dest) == storagePath {
+			return src, true
+		}
+	}
+	return "", false
+}
+
+// registryDataVolumeName returns the name of the named volume created for the data of a registry
+func registryDataVolumeName(registryName string) string {
+	return fmt.Sprintf("%s-data", registryName)
+}
+
+func registryCreateDataVolume(ctx context.Context, runtime runtimes.Runtime, volume string) error {
+	if err := runtime.CreateVolume(ctx, volume, map[string]string{k3d.LabelRole: string(k3d.RegistryRole)}); err != nil {
+		return fmt.Errorf("failed to create registry data volume '%s': %w", volume, err)
+	}
+	return nil
+}
+
+// runRegistryToolsNode starts a k3d-tools node, which mounts the data volume of a registry
+func runRegistryToolsNode(ctx context.Context, runtime runtimes.Runtime, registryName string, volume string, storagePath string) (*k3d.Node, error) {
+	labels := map[string]string{}
+	for k, v := range k3d.DefaultRuntimeLabels {
+		labels[k] = v
+	}
+	for k, v := range k3d.DefaultRuntimeLabelsVar {
+		labels[k] = v
+	}
+	node := &k3d.Node{
+		Name:          fmt.Sprintf("%s-tools", registryName),
+		Image:         k3d.GetToolsImage(),
+		Role:          k3d.NoRole,
+		Volumes:       []string{fmt.Sprintf("%s:%s", volume, storagePath)},
+		Networks:      []string{k3d.DefaultRuntimeNetwork},
+		Cmd:           []string{},
+		Args:          []string{"noop"},
+		RuntimeLabels: labels,
+	}
+	if err := NodeRun(ctx, runtime, node, k3d.NodeCreateOpts{}); err != nil {
+		return nil, fmt.Errorf("failed to run k3d-tools node for registry '%s': %w", registryName, err)
+	}
+	return node, nil
+}
@@ -0,0 +1,206 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package client_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/docker/go-connections/nat"
+
+	"github.com/k3d-io/k3d/v5/pkg/client"
+	"github.com/k3d-io/k3d/v5/pkg/runtimes/fake"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+func TestFakeRuntimeRegistryExportImport(t *testing.T) {
+	ctx := context.Background()
+	rt := fake.NewRuntime()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	if _, _, err := rt.CreateNetworkIfNotPresent(ctx, &k3d.ClusterNetwork{Name: k3d.DefaultRuntimeNetwork}); err != nil {
+		t.Fatalf("failed to create default network: %v", err)
+	}
+
+	reg := &k3d.Registry{Host: "k3d-exportreg", Image: "registry:2", Options: k3d.RegistryOptions{
+		DeleteEnabled: true,
+		Auth:          k3d.RegistryAuth{Username: "user", Password: "secret"},
+	}}
+	reg.ExposureOpts.Port = nat.Port("5000/tcp")
+	reg.ExposureOpts.Binding = nat.PortBinding{HostIP: "0.0.0.0", HostPort: "5000"}
+	regNode, err := client.RegistryRun(ctx, rt, reg)
+	if err != nil {
+		t.Fatalf("failed to run registry: %v", err)
+	}
+	regNode, err = client.NodeGet(ctx, rt, regNode)
+	if err != nil {
+		t.Fatalf("failed to get registry node: %v", err)
+	}
+	if !slices.Contains(regNode.Volumes, "k3d-exportreg-data:"+k3d.DefaultRegistryMountPath) || regNode.RuntimeLabels[k3d.LabelRegistryVolume] != "k3d-exportreg-data" {
+		t.Fatalf("expected registry data to be kept in the named volume 'k3d-exportreg-data', got volumes %v and labels %v", regNode.Volumes, regNode.RuntimeLabels)
+	}
+	if strings.Contains(regNode.RuntimeLabels[k3d.LabelRegistryOptions], "secret") {
+		t.Errorf("expected registry options label not to contain the password, got %s", regNode.RuntimeLabels[k3d.LabelRegistryOptions])
+	}
+
+	blobPath := k3d.DefaultRegistryMountPath + "/docker/registry/v2/blobs/sha256/ab/abcdef/data"
+	if err := rt.WriteToNode(ctx, []byte("layer"), blobPath, 0644, regNode); err != nil {
+		t.Fatalf("failed to write blob to registry: %v", err)
+	}
+
+	archive := &bytes.Buffer{}
+	if err := client.RegistryExport(ctx, rt, regNode, archive, k3d.RegistryExportOpts{}); err != nil {
+		t.Fatalf("failed to export registry: %v", err)
+	}
+	if _, err := rt.GetNode(ctx, &k3d.Node{Name: "k3d-exportreg-tools"}); err == nil {
+		t.Errorf("expected tools node to be removed after the export")
+	}
+	if content := readArchive(t, archive.Bytes()); bytes.Contains(content, []byte("secret")) {
+		t.Errorf("expected the archive not to contain the password of the registry")
+	}
+
+	archiveWithCredentials := &bytes.Buffer{}
+	if err := client.RegistryExport(ctx, rt, regNode, archiveWithCredentials, k3d.RegistryExportOpts{IncludeCredentials: true}); err != nil {
+		t.Fatalf("failed to export registry with credentials: %v", err)
+	}
+	if content := readArchive(t, archiveWithCredentials.Bytes()); !bytes.Contains(content, []byte("secret")) {
+		t.Errorf("expected the archive to contain the password of the registry when asked to")
+	}
+
+	if err := client.NodeDelete(ctx, rt, regNode, k3d.NodeDeleteOpts{SkipLBUpdate: true, DeleteRegistryVolume: true}); err != nil {
+		t.Fatalf("failed to delete registry: %v", err)
+	}
+	if _, err := rt.GetVolume("k3d-exportreg-data"); err == nil {
+		t.Errorf("expected data volume to be deleted together with the registry when asked to")
+	}
+
+	if _, err := client.RegistryImport(ctx, rt, bytes.NewReader(archive.Bytes()), k3d.RegistryImportOpts{Name: "k3d-imported"}); err == nil {
+		t.Fatalf("expected importing a registry with authentication to fail without the password")
+	}
+	if _, err := rt.GetVolume("k3d-imported-data"); err == nil {
+		t.Fatalf("expected the failed import not to create a data volume")
+	}
+
+	importedNode, err := client.RegistryImport(ctx, rt, bytes.NewReader(archive.Bytes()), k3d.RegistryImportOpts{Name: "k3d-imported", Auth: &reg.Options.Auth})
+	if err != nil {
+		t.Fatalf("failed to import registry: %v", err)
+	}
+	if content, ok := rt.ReadFile(importedNode.Name, blobPath); !ok || string(content) != "layer" {
+		t.Errorf("expected imported registry to contain the exported data, got %q", content)
+	}
+	importedNode, err = client.NodeGet(ctx, rt, importedNode)
+	if err != nil {
+		t.Fatalf("failed to get imported registry node: %v", err)
+	}
+	imported, err := client.RegistryFromNode(importedNode)
+	if err != nil {
+		t.Fatalf("failed to get registry from node: %v", err)
+	}
+	if !imported.Options.DeleteEnabled || imported.ExposureOpts.Binding.HostPort != "5000" {
+		t.Errorf("expected imported registry to keep the options and port of the exported one, got %+v", imported)
+	}
+	auth, err := client.RegistryGetAuth(importedNode)
+	if err != nil || auth != reg.Options.Auth {
+		t.Errorf("expected imported registry to keep the credentials, got %+v (%v)", auth, err)
+	}
+
+	if _, err := client.RegistryImport(ctx, rt, bytes.NewReader(archive.Bytes()), k3d.RegistryImportOpts{Name: "k3d-imported", Auth: &reg.Options.Auth}); err == nil {
+		t.Errorf("expected importing a registry with an existing name to fail")
+	}
+
+	importedNode, err = client.RegistryImport(ctx, rt, archiveWithCredentials, k3d.RegistryImportOpts{Name: "k3d-imported-credentials"})
+	if err != nil {
+		t.Fatalf("failed to import registry with credentials: %v", err)
+	}
+	if auth, err := client.RegistryGetAuth(importedNode); err != nil || auth != reg.Options.Auth {
+		t.Errorf("expected registry imported with credentials to keep them, got %+v (%v)", auth, err)
+	}
+}
+
+// readArchive returns the uncompressed contents of a registry archive
+func readArchive(t *testing.T, archive []byte) []byte {
+	gzipReader, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatalf("failed to read registry archive: %v", err)
+	}
+	content, err := io.ReadAll(gzipReader)
+	if err != nil {
+		t.Fatalf("failed to read registry archive: %v", err)
+	}
+	return content
+}
+
+func TestFakeRuntimeRegistryDeleteKeepsVolume(t *testing.T) {
+	ctx := context.Background()
+	rt := fake.NewRuntime()
+	if _, _, err := rt.CreateNetworkIfNotPresent(ctx, &k3d.ClusterNetwork{Name: k3d.DefaultRuntimeNetwork}); err != nil {
+		t.Fatalf("failed to create default network: %v", err)
+	}
+
+	newRegistry := func() *k3d.Registry {
+		reg := &k3d.Registry{Host: "k3d-cachereg", Image: "registry:2"}
+		reg.ExposureOpts.Port = nat.Port("5000/tcp")
+		reg.ExposureOpts.Binding = nat.PortBinding{HostIP: "0.0.0.0", HostPort: "5000"}
+		return reg
+	}
+	regNode, err := client.RegistryRun(ctx, rt, newRegistry())
+	if err != nil {
+		t.Fatalf("failed to run registry: %v", err)
+	}
+	regNode, err = client.NodeGet(ctx, rt, regNode)
+	if err != nil {
+		t.Fatalf("failed to get registry node: %v", err)
+	}
+	blobPath := k3d.DefaultRegistryMountPath + "/docker/registry/v2/blobs/sha256/ab/abcdef/data"
+	if err := rt.WriteToNode(ctx, []byte("layer"), blobPath, 0644, regNode); err != nil {
+		t.Fatalf("failed to write blob to registry: %v", err)
+	}
+
+	archive := &bytes.Buffer{}
+	if err := client.RegistryExport(ctx, rt, regNode, archive, k3d.RegistryExportOpts{}); err != nil {
+		t.Fatalf("failed to export registry: %v", err)
+	}
+
+	if err := client.NodeDelete(ctx, rt, regNode, k3d.NodeDeleteOpts{SkipLBUpdate: true}); err != nil {
+		t.Fatalf("failed to delete registry: %v", err)
+	}
+	if _, err := rt.GetVolume("k3d-cachereg-data"); err != nil {
+		t.Fatalf("expected data volume to be kept by default: %v", err)
+	}
+
+	if _, err := client.RegistryImport(ctx, rt, archive, k3d.RegistryImportOpts{}); err == nil {
+		t.Errorf("expected import into the kept data volume to fail")
+	}
+
+	regNode, err = client.RegistryRun(ctx, rt, newRegistry())
+	if err != nil {
+		t.Fatalf("failed to re-create registry: %v", err)
+	}
+	if content, ok := rt.ReadFile(regNode.Name, blobPath); !ok || string(content) != "layer" {
+		t.Errorf("expected re-created registry to find its data again, got %q", content)
+	}
+}
@@ -0,0 +1,135 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package client
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/k3d-io/k3d/v5/pkg/runtimes"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+	"github.com/k3d-io/k3d/v5/pkg/util"
+)
+
+const (
+	registryAuthType        = "htpasswd"
+	registryAuthRealm       = "k3d registry"
+	registryHtpasswdFile    = "htpasswd"
+	registryCredentialsFile = "credentials" // plain credentials, kept on the host only
+)
+
+// ParseRegistryAuth parses credentials in the format `USERNAME:PASSWORD`
+func ParseRegistryAuth(spec string) (k3d.RegistryAuth, error) {
+	username, password, found := strings.Cut(spec, ":")
+	if !found {
+		return k3d.RegistryAuth{}, fmt.Errorf("invalid registry credentials '%s': expected format USERNAME:PASSWORD", spec)
+	}
+	auth := k3d.RegistryAuth{Username: username, Password: password}
+	if err := registryValidateAuth(auth); err != nil {
+		return k3d.RegistryAuth{}, err
+	}
+	return auth, nil
+}
+
+// registryValidateAuth checks that the credentials can be used in an htpasswd file
+func registryValidateAuth(auth k3d.RegistryAuth) error {
+	if auth.Username == "" || auth.Password == "" {
+		return fmt.Errorf("invalid registry credentials: username and password must not be empty")
+	}
+	if strings.ContainsAny(auth.Username, ":\n") {
+		return fmt.Errorf("invalid registry credentials: username '%s' must not contain ':' or newlines", auth.Username)
+	}
+	if strings.Contains(auth.Password, "\n") {
+		return fmt.Errorf("invalid registry credentials: password must not contain newlines")
+	}
+	return nil
+}
+
+// registryGenerateHtpasswd generates the htpasswd file (bcrypt being the only supported hash) for the registry's credentials
+func registryGenerateHtpasswd(auth k3d.RegistryAuth) ([]byte, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(auth.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password of user '%s': %w", auth.Username, err)
+	}
+	return []byte(fmt.Sprintf("%s:%s\n", auth.Username, hash)), nil
+}
+
+// registryWriteAuth writes the htpasswd file into the (created) registry container
+func registryWriteAuth(ctx context.Context, runtime runtimes.Runtime, regNode *k3d.Node, htpasswd []byte, mode os.FileMode) error {
+	if err := runtime.WriteToNode(ctx, htpasswd, path.Join(k3d.DefaultRegistryAuthPath, registryHtpasswdFile), mode, regNode); err != nil {
+		return fmt.Errorf("failed to write '%s' to registry '%s': %w", registryHtpasswdFile, regNode.Name, err)
+	}
+	return nil
+}
+
+// RegistryHostCredentialsPath returns the path of the registry's credentials on the host (in the k3d config directory)
+func RegistryHostCredentialsPath(registryName string) (string, error) {
+	configDir, err := util.GetConfigDirOrCreate()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "registries", registryName, registryCredentialsFile), nil
+}
+
+// registryStoreAuth keeps the credentials of the registry on the host (readable by the current user only),
+// so that clusters using the registry later on can be configured to access it.
+// They're deliberately not stored in the registry container, which only gets the htpasswd file.
+func registryStoreAuth(registryName string, auth k3d.RegistryAuth) error {
+	credentialsPath, err := RegistryHostCredentialsPath(registryName)
+	if err != nil {
+		return fmt.Errorf("failed to get path for the credentials of registry '%s': %w", registryName, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(credentialsPath), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for the credentials of registry '%s': %w", registryName, err)
+	}
+	if err := os.WriteFile(credentialsPath, []byte(fmt.Sprintf("%s:%s", auth.Username, auth.Password)), 0600); err != nil {
+		return fmt.Errorf("failed to write the credentials of registry '%s': %w", registryName, err)
+	}
+	// WriteFile doesn't change the permissions of an existing file
+	if err := os.Chmod(credentialsPath, 0600); err != nil {
+		return fmt.Errorf("failed to restrict permissions of the credentials of registry '%s': %w", registryName, err)
+	}
+	return nil
+}
+
+// RegistryGetAuth reads the credentials of a registry with authentication from the k3d config directory
+func RegistryGetAuth(regNode *k3d.Node) (k3d.RegistryAuth, error) {
+	credentialsPath, err := RegistryHostCredentialsPath(regNode.Name)
+	if err != nil {
+		return k3d.RegistryAuth{}, fmt.Errorf("failed to get path for the credentials of registry '%s': %w", regNode.Name, err)
+	}
+	content, err := os.ReadFile(credentialsPath)
+	if err != nil {
+		return k3d.RegistryAuth{}, fmt.Errorf("failed to read credentials of registry '%s' (write them as USERNAME:PASSWORD to %s if the registry was created elsewhere): %w", regNode.Name, credentialsPath, err)
+	}
+	auth, err := ParseRegistryAuth(strings.TrimSpace(string(content)))
+	if err != nil {
+		return k3d.RegistryAuth{}, fmt.Errorf("failed to parse credentials of registry '%s': %w", regNode.Name, err)
+	}
+	return auth, nil
+}
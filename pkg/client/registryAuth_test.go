@@ -0,0 +1,133 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package client_test
+
+import (
+	"context"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/docker/go-connections/nat"
+	wharfie "github.com/rancher/wharfie/pkg/registries"
+	"golang.org/x/crypto/bcrypt"
+	"sigs.k8s.io/yaml"
+
+	"github.com/k3d-io/k3d/v5/pkg/client"
+	"github.com/k3d-io/k3d/v5/pkg/config"
+	conf "github.com/k3d-io/k3d/v5/pkg/config/v1alpha5"
+	"github.com/k3d-io/k3d/v5/pkg/runtimes/fake"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+func TestFakeRuntimeRegistryAuth(t *testing.T) {
+	ctx := context.Background()
+	rt := fake.NewRuntime()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	if _, _, err := rt.CreateNetworkIfNotPresent(ctx, &k3d.ClusterNetwork{Name: k3d.DefaultRuntimeNetwork}); err != nil {
+		t.Fatalf("failed to create default network: %v", err)
+	}
+
+	for _, spec := range []string{"user", ":password", "user:"} {
+		if auth, err := client.ParseRegistryAuth(spec); err == nil {
+			t.Errorf("expected credentials '%s' to be rejected, got %+v", spec, auth)
+		}
+	}
+	auth, err := client.ParseRegistryAuth("user:pass:word")
+	if err != nil || auth.Username != "user" || auth.Password != "pass:word" {
+		t.Fatalf("expected password to keep its colons, got %+v (%v)", auth, err)
+	}
+
+	reg := &k3d.Registry{Host: "k3d-authreg", Image: "registry:2", Options: k3d.RegistryOptions{Auth: auth}}
+	reg.ExposureOpts.Port = nat.Port("5000/tcp")
+	reg.ExposureOpts.Binding = nat.PortBinding{HostIP: "0.0.0.0", HostPort: "5000"}
+	regNode, err := client.RegistryRun(ctx, rt, reg)
+	if err != nil {
+		t.Fatalf("failed to run registry: %v", err)
+	}
+	regNode, err = client.NodeGet(ctx, rt, regNode)
+	if err != nil {
+		t.Fatalf("failed to get registry node: %v", err)
+	}
+	if regNode.RuntimeLabels[k3d.LabelRegistryAuth] != "htpasswd" {
+		t.Errorf("expected registry to be labeled with auth htpasswd, got labels %v", regNode.RuntimeLabels)
+	}
+	for _, env := range []string{"REGISTRY_AUTH=htpasswd", "REGISTRY_AUTH_HTPASSWD_PATH=" + k3d.DefaultRegistryAuthPath + "/htpasswd"} {
+		if !slices.Contains(regNode.Env, env) {
+			t.Errorf("expected registry env to contain '%s', got %v", env, regNode.Env)
+		}
+	}
+	htpasswd, ok := rt.ReadFile(regNode.Name, k3d.DefaultRegistryAuthPath+"/htpasswd")
+	if !ok {
+		t.Fatalf("expected htpasswd file to be written to the registry node")
+	}
+	user, hash, _ := strings.Cut(strings.TrimSpace(string(htpasswd)), ":")
+	if user != "user" || bcrypt.CompareHashAndPassword([]byte(hash), []byte("pass:word")) != nil {
+		t.Errorf("expected htpasswd file to contain a bcrypt hash of the password for 'user', got '%s'", htpasswd)
+	}
+	if files, ok := rt.ReadFile(regNode.Name, k3d.DefaultRegistryAuthPath+"/credentials"); ok {
+		t.Errorf("expected no plain credentials in the registry container, got '%s'", files)
+	}
+	credentialsPath, err := client.RegistryHostCredentialsPath(regNode.Name)
+	if err != nil {
+		t.Fatalf("failed to get host credentials path: %v", err)
+	}
+	info, err := os.Stat(credentialsPath)
+	if err != nil {
+		t.Fatalf("expected credentials to be kept in the k3d config dir: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("expected credentials file to be readable by the owner only, got %s", info.Mode().Perm())
+	}
+
+	simpleCfg := conf.SimpleConfig{Servers: 1}
+	simpleCfg.Name = "test"
+	simpleCfg.Registries.Use = []string{"k3d-authreg:5000"}
+	clusterCfg, err := config.TransformSimpleToClusterConfig(ctx, rt, simpleCfg, "")
+	if err != nil {
+		t.Fatalf("failed to transform simple config: %v", err)
+	}
+	if err := client.ClusterRun(ctx, rt, clusterCfg); err != nil {
+		t.Fatalf("failed to run cluster: %v", err)
+	}
+	registriesYaml, ok := rt.ReadFile("k3d-test-server-0", k3d.DefaultRegistriesFilePath)
+	if !ok {
+		t.Fatalf("expected registries.yaml to be written to the server node")
+	}
+	regConf := &wharfie.Registry{}
+	if err := yaml.Unmarshal(registriesYaml, regConf); err != nil {
+		t.Fatalf("failed to parse registries.yaml: %v", err)
+	}
+	regAuth := regConf.Configs["k3d-authreg:5000"].Auth
+	if regAuth == nil || regAuth.Username != "user" || regAuth.Password != "pass:word" {
+		t.Errorf("expected registries.yaml to contain the registry credentials, got:\n%s", registriesYaml)
+	}
+
+	if err := client.NodeDelete(ctx, rt, regNode, k3d.NodeDeleteOpts{}); err != nil {
+		t.Fatalf("failed to delete registry: %v", err)
+	}
+	if _, err := os.Stat(credentialsPath); !os.IsNotExist(err) {
+		t.Errorf("expected credentials '%s' to be removed with the registry, got %v", credentialsPath, err)
+	}
+}
@@ -0,0 +1,259 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	wharfie "github.com/rancher/wharfie/pkg/registries"
+	goyaml "gopkg.in/yaml.v2"
+
+	l "github.com/k3d-io/k3d/v5/pkg/logger"
+	"github.com/k3d-io/k3d/v5/pkg/runtimes"
+	runtimeErrors "github.com/k3d-io/k3d/v5/pkg/runtimes/errors"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+// RegistryConnect connects an existing registry to an existing cluster:
+// it attaches the registry to the cluster network, merges its configuration into the registries.yaml of all k3s nodes,
+// points the LocalRegistryHosting ConfigMap to it and restarts the k3s nodes, so that containerd picks up the change
+func RegistryConnect(ctx context.Context, runtime runtimes.Runtime, registryNode *k3d.Node, cluster *k3d.Cluster) error {
+	regNode, reg, cluster, err := registryConnectPrepare(ctx, runtime, registryNode, cluster)
+	if err != nil {
+		return err
+	}
+	nodes := NodeFilterByRoles(cluster.Nodes, []k3d.Role{k3d.ServerRole, k3d.AgentRole}, nil)
+
+	// network
+	if slices.Contains(regNode.Networks, cluster.Network.Name) {
+		l.Log().Infof("Registry '%s' is already connected to network '%s'", regNode.Name, cluster.Network.Name)
+	} else {
+		l.Log().Infof("Connecting registry '%s' to network '%s'...", regNode.Name, cluster.Network.Name)
+		if err := runtime.ConnectNodeToNetwork(ctx, regNode, cluster.Network.Name); err != nil {
+			return fmt.Errorf("failed to connect registry '%s' to network '%s': %w", regNode.Name, cluster.Network.Name, err)
+		}
+	}
+
+	// registries.yaml (and CA of TLS-enabled registries)
+	regConf, err := RegistryGenerateK3sConfig(ctx, []*k3d.Registry{reg})
+	if err != nil {
+		return fmt.Errorf("failed to generate registry config for registry '%s': %w", reg.Host, err)
+	}
+	var ca []byte
+	if reg.Options.TLS {
+		if ca, err = RegistryGetCA(ctx, runtime, regNode); err != nil {
+			return err
+		}
+	}
+	for _, node := range nodes {
+		if ca != nil {
+			if err := runtime.WriteToNode(ctx, ca, RegistryNodeCAPath(reg), 0644, node); err != nil {
+				return fmt.Errorf("failed to write CA of registry '%s' to node '%s': %w", reg.Host, node.Name, err)
+			}
+		}
+		if err := registryUpdateNodeConfig(ctx, runtime, node, func(nodeConf *wharfie.Registry) error {
+			return RegistryMergeConfig(ctx, nodeConf, regConf)
+		}); err != nil {
+			return err
+		}
+	}
+
+	// LocalRegistryHosting ConfigMap
+	if err := registryUpdateLocalRegistryHostingConfigMap(ctx, runtime, cluster, reg); err != nil {
+		return err
+	}
+
+	if err := registryRestartK3sNodes(ctx, runtime, cluster, nodes); err != nil {
+		return err
+	}
+
+	l.Log().Infof("Successfully connected registry '%s' to cluster '%s'", regNode.Name, cluster.Name)
+	return nil
+}
+
+// RegistryDisconnect reverses RegistryConnect: it removes the registry's configuration from the k3s nodes,
+// drops or re-points the LocalRegistryHosting ConfigMap, restarts the k3s nodes and detaches the registry from the cluster network
+func RegistryDisconnect(ctx context.Context, runtime runtimes.Runtime, registryNode *k3d.Node, cluster *k3d.Cluster) error {
+	regNode, reg, cluster, err := registryConnectPrepare(ctx, runtime, registryNode, cluster)
+	if err != nil {
+		return err
+	}
+	nodes := NodeFilterByRoles(cluster.Nodes, []k3d.Role{k3d.ServerRole, k3d.AgentRole}, nil)
+
+	// registries.yaml (and CA of TLS-enabled registries)
+	regConf, err := RegistryGenerateK3sConfig(ctx, []*k3d.Registry{reg})
+	if err != nil {
+		return fmt.Errorf("failed to generate registry config for registry '%s': %w", reg.Host, err)
+	}
+	for _, node := range nodes {
+		if err := registryUpdateNodeConfig(ctx, runtime, node, func(nodeConf *wharfie.Registry) error {
+			for mirror := range regConf.Mirrors {
+				delete(nodeConf.Mirrors, mirror)
+			}
+			for address := range regConf.Configs {
+				delete(nodeConf.Configs, address)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		if reg.Options.TLS {
+			if err := runtime.ExecInNode(ctx, node, []string{"rm", "-f", RegistryNodeCAPath(reg)}); err != nil {
+				return fmt.Errorf("failed to remove CA of registry '%s' from node '%s': %w", reg.Host, node.Name, err)
+			}
+		}
+	}
+
+	// LocalRegistryHosting ConfigMap: advertise another registry connected to the cluster, if there is one
+	networkNodes, err := runtime.GetNodesInNetwork(ctx, cluster.Network.Name)
+	if err != nil {
+		return fmt.Errorf("failed to list nodes in network '%s': %w", cluster.Network.Name, err)
+	}
+	var remaining *k3d.Registry
+	for _, node := range networkNodes {
+		if node.Role != k3d.RegistryRole || node.Name == regNode.Name {
+			continue
+		}
+		if remaining, err = RegistryFromNode(node); err != nil {
+			return fmt.Errorf("failed to translate node to registry spec: %w", err)
+		}
+		break
+	}
+	if err := registryUpdateLocalRegistryHostingConfigMap(ctx, runtime, cluster, remaining); err != nil {
+		return err
+	}
+
+	if err := registryRestartK3sNodes(ctx, runtime, cluster, nodes); err != nil {
+		return err
+	}
+
+	// network
+	if slices.Contains(regNode.Networks, cluster.Network.Name) {
+		l.Log().Infof("Disconnecting registry '%s' from network '%s'...", regNode.Name, cluster.Network.Name)
+		if err := runtime.DisconnectNodeFromNetwork(ctx, regNode, cluster.Network.Name); err != nil {
+			return fmt.Errorf("failed to disconnect registry '%s' from network '%s': %w", regNode.Name, cluster.Network.Name, err)
+		}
+	}
+
+	l.Log().Infof("Successfully disconnected registry '%s' from cluster '%s'", regNode.Name, cluster.Name)
+	return nil
+}
+
+// registryConnectPrepare gets the registry node, the registry spec (including credentials) and the cluster
+func registryConnectPrepare(ctx context.Context, runtime runtimes.Runtime, registryNode *k3d.Node, cluster *k3d.Cluster) (*k3d.Node, *k3d.Registry, *k3d.Cluster, error) {
+	regNode, err := NodeGet(ctx, runtime, registryNode)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to find registry node '%s': %w", registryNode.Name, err)
+	}
+	if regNode.Role != k3d.RegistryRole {
+		return nil, nil, nil, fmt.Errorf("node '%s' is not a registry", regNode.Name)
+	}
+	reg, err := RegistryFromNode(regNode)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to translate node to registry spec: %w", err)
+	}
+	if regNode.RuntimeLabels[k3d.LabelRegistryAuth] != "" {
+		if reg.Options.Auth, err = RegistryGetAuth(regNode); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	cluster, err = ClusterGet(ctx, runtime, &k3d.Cluster{Name: cluster.Name})
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to get cluster '%s': %w", cluster.Name, err)
+	}
+	return regNode, reg, cluster, nil
+}
+
+// registryUpdateNodeConfig reads the registries.yaml of a node (if there is one), modifies it and writes it back
+func registryUpdateNodeConfig(ctx context.Context, runtime runtimes.Runtime, node *k3d.Node, modify func(*wharfie.Registry) error) error {
+	nodeConf := &wharfie.Registry{}
+	files, err := readNodeFiles(ctx, runtime, node, k3d.DefaultRegistriesFilePath)
+	if err != nil && !errors.Is(err, runtimeErrors.ErrRuntimeFileNotFound) {
+		return fmt.Errorf("failed to read registry config from node '%s': %w", node.Name, err)
+	}
+	if len(files) == 1 {
+		if err := goyaml.Unmarshal(files[0].Content, nodeConf); err != nil {
+			return fmt.Errorf("failed to parse registry config of node '%s': %w", node.Name, err)
+		}
+	}
+	if err := modify(nodeConf); err != nil {
+		return err
+	}
+	content, err := goyaml.Marshal(nodeConf)
+	if err != nil {
+		return fmt.Errorf("failed to marshal registry config for node '%s': %w", node.Name, err)
+	}
+	if err := runtime.WriteToNode(ctx, content, k3d.DefaultRegistriesFilePath, 0644, node); err != nil {
+		return fmt.Errorf("failed to write registry config to node '%s': %w", node.Name, err)
+	}
+	return nil
+}
+
+// registryUpdateLocalRegistryHostingConfigMap points the LocalRegistryHosting ConfigMap to the given registry or deletes it, if there is none
+func registryUpdateLocalRegistryHostingConfigMap(ctx context.Context, runtime runtimes.Runtime, cluster *k3d.Cluster, reg *k3d.Registry) error {
+	if reg == nil {
+		for _, node := range NodeFilterByRoles(cluster.Nodes, []k3d.Role{k3d.ServerRole}, nil) {
+			err := runtime.ExecInNode(ctx, node, []string{"kubectl", "delete", "configmap", "local-registry-hosting", "--namespace", "kube-public", "--ignore-not-found"})
+			if err == nil {
+				return nil
+			}
+			l.Log().Debugf("Failed to delete LocalRegistryHosting ConfigMap in node %s: %+v", node.Name, err)
+		}
+		l.Log().Warnf("Failed to delete LocalRegistryHosting ConfigMap")
+		return nil
+	}
+
+	regCm, err := RegistryGenerateLocalRegistryHostingConfigMapYAML(ctx, runtime, []*k3d.Registry{reg})
+	if err != nil {
+		return fmt.Errorf("failed to generate LocalRegistryHosting configmap: %w", err)
+	}
+	for _, node := range NodeFilterByRoles(cluster.Nodes, []k3d.Role{k3d.ServerRole, k3d.AgentRole}, nil) {
+		if err := runtime.WriteToNode(ctx, regCm, k3d.DefaultLocalRegistryHostingConfigmapTempPath, 0644, node); err != nil {
+			return fmt.Errorf("failed to write LocalRegistryHosting configmap to node '%s': %w", node.Name, err)
+		}
+	}
+	return prepCreateLocalRegistryHostingConfigMap(ctx, runtime, cluster)
+}
+
+// registryRestartK3sNodes restarts the k3s nodes one by one (servers first), as containerd only reads the registry configuration on startup
+func registryRestartK3sNodes(ctx context.Context, runtime runtimes.Runtime, cluster *k3d.Cluster, nodes []*k3d.Node) error {
+	envInfo, err := GatherEnvironmentInfo(ctx, runtime, cluster)
+	if err != nil {
+		return fmt.Errorf("failed to gather environment information: %w", err)
+	}
+	for _, role := range []k3d.Role{k3d.ServerRole, k3d.AgentRole} {
+		for _, node := range NodeFilterByRoles(nodes, []k3d.Role{role}, nil) {
+			l.Log().Infof("Restarting node '%s' to apply the registry configuration...", node.Name)
+			if err := runtime.StopNode(ctx, node); err != nil {
+				return fmt.Errorf("runtime failed to stop node '%s': %w", node.Name, err)
+			}
+			node.State.Running = false
+			if err := NodeStart(ctx, runtime, node, &k3d.NodeStartOpts{Wait: true, EnvironmentInfo: envInfo}); err != nil {
+				return fmt.Errorf("failed to restart node '%s': %w", node.Name, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package client_test
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/docker/go-connections/nat"
+	wharfie "github.com/rancher/wharfie/pkg/registries"
+	"sigs.k8s.io/yaml"
+
+	"github.com/k3d-io/k3d/v5/pkg/client"
+	"github.com/k3d-io/k3d/v5/pkg/runtimes/fake"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+func TestFakeRuntimeRegistryConnect(t *testing.T) {
+	ctx := context.Background()
+	rt := fake.NewRuntime()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	if _, _, err := rt.CreateNetworkIfNotPresent(ctx, &k3d.ClusterNetwork{Name: k3d.DefaultRuntimeNetwork}); err != nil {
+		t.Fatalf("failed to create default network: %v", err)
+	}
+	cluster := runFakeCluster(t, rt, "test", 1, 1)
+
+	reg := &k3d.Registry{Host: "k3d-connreg", Image: "registry:2", Options: k3d.RegistryOptions{Auth: k3d.RegistryAuth{Username: "user", Password: "password"}}}
+	reg.ExposureOpts.Port = nat.Port("5000/tcp")
+	reg.ExposureOpts.Binding = nat.PortBinding{HostIP: "0.0.0.0", HostPort: "5111"}
+	regNode, err := client.RegistryRun(ctx, rt, reg)
+	if err != nil {
+		t.Fatalf("failed to run registry: %v", err)
+	}
+
+	readRegistryConfig := func(nodeName string) *wharfie.Registry {
+		t.Helper()
+		content, ok := rt.ReadFile(nodeName, k3d.DefaultRegistriesFilePath)
+		if !ok {
+			t.Fatalf("expected registries.yaml to be written to node '%s'", nodeName)
+		}
+		regConf := &wharfie.Registry{}
+		if err := yaml.Unmarshal(content, regConf); err != nil {
+			t.Fatalf("failed to parse registries.yaml of node '%s': %v", nodeName, err)
+		}
+		return regConf
+	}
+	inNetwork := func() bool {
+		t.Helper()
+		node, err := client.NodeGet(ctx, rt, regNode)
+		if err != nil {
+			t.Fatalf("failed to get registry node: %v", err)
+		}
+		return slices.Contains(node.Networks, cluster.Network.Name)
+	}
+	kubectlCalls := func(verb string) int {
+		calls := 0
+		for _, nodeName := range []string{"k3d-test-server-0", "k3d-test-agent-0"} {
+			for _, cmd := range rt.ExecHistory(nodeName) {
+				if strings.Contains(strings.Join(cmd, " "), "kubectl "+verb) {
+					calls++
+				}
+			}
+		}
+		return calls
+	}
+
+	if err := client.RegistryConnect(ctx, rt, &k3d.Node{Name: regNode.Name}, &k3d.Cluster{Name: "test"}); err != nil {
+		t.Fatalf("failed to connect registry: %v", err)
+	}
+	if !inNetwork() {
+		t.Errorf("expected registry to be connected to network '%s'", cluster.Network.Name)
+	}
+	for _, nodeName := range []string{"k3d-test-server-0", "k3d-test-agent-0"} {
+		regConf := readRegistryConfig(nodeName)
+		if mirror, ok := regConf.Mirrors["k3d-connreg:5111"]; !ok || !slices.Contains(mirror.Endpoints, "http://k3d-connreg:5000") {
+			t.Errorf("expected registries.yaml of node '%s' to contain a mirror for the registry, got %+v", nodeName, regConf.Mirrors)
+		}
+		if auth := regConf.Configs["k3d-connreg:5000"].Auth; auth == nil || auth.Username != "user" || auth.Password != "password" {
+			t.Errorf("expected registries.yaml of node '%s' to contain the registry credentials, got %+v", nodeName, regConf.Configs)
+		}
+		node, err := client.NodeGet(ctx, rt, &k3d.Node{Name: nodeName})
+		if err != nil {
+			t.Fatalf("failed to get node '%s': %v", nodeName, err)
+		}
+		if !node.State.Running {
+			t.Errorf("expected node '%s' to be running again after the restart", nodeName)
+		}
+	}
+	if cm, ok := rt.ReadFile("k3d-test-server-0", k3d.DefaultLocalRegistryHostingConfigmapTempPath); !ok || !strings.Contains(string(cm), "k3d-connreg:5000") {
+		t.Errorf("expected LocalRegistryHosting ConfigMap to point to the registry, got:\n%s", cm)
+	}
+	if kubectlCalls("apply") == 0 {
+		t.Errorf("expected LocalRegistryHosting ConfigMap to be applied, got exec history %v and %v", rt.ExecHistory("k3d-test-server-0"), rt.ExecHistory("k3d-test-agent-0"))
+	}
+
+	if err := client.RegistryDisconnect(ctx, rt, &k3d.Node{Name: regNode.Name}, &k3d.Cluster{Name: "test"}); err != nil {
+		t.Fatalf("failed to disconnect registry: %v", err)
+	}
+	if inNetwork() {
+		t.Errorf("expected registry to be disconnected from network '%s'", cluster.Network.Name)
+	}
+	for _, nodeName := range []string{"k3d-test-server-0", "k3d-test-agent-0"} {
+		if regConf := readRegistryConfig(nodeName); len(regConf.Mirrors) != 0 || len(regConf.Configs) != 0 {
+			t.Errorf("expected registry to be removed from registries.yaml of node '%s', got %+v", nodeName, regConf)
+		}
+	}
+	if kubectlCalls("delete configmap local-registry-hosting") == 0 {
+		t.Errorf("expected LocalRegistryHosting ConfigMap to be deleted, got exec history %v", rt.ExecHistory("k3d-test-server-0"))
+	}
+}
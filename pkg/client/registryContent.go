@@ -0,0 +1,284 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+
+	l "github.com/k3d-io/k3d/v5/pkg/logger"
+	"github.com/k3d-io/k3d/v5/pkg/runtimes"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+// SplitRegistryImageRef splits a reference in the format `REGISTRY[:PORT]/REPOSITORY[:TAG|@DIGEST]`
+// into the name of the registry (node) and the reference of the image inside the registry
+func SplitRegistryImageRef(ref string) (string, string, error) {
+	registry, image, found := strings.Cut(ref, "/")
+	registry, _, _ = strings.Cut(registry, ":")
+	if !found || registry == "" || image == "" {
+		return "", "", fmt.Errorf("invalid image reference '%s': expected format REGISTRY/REPOSITORY[:TAG|@DIGEST]", ref)
+	}
+	return registry, image, nil
+}
+
+// RegistryListRepositories lists the repositories in a registry (catalog)
+func RegistryListRepositories(ctx context.Context, runtime runtimes.Runtime, registryNode *k3d.Node) ([]string, error) {
+	address, opts, err := registryRemoteOptions(ctx, runtime, registryNode)
+	if err != nil {
+		return nil, err
+	}
+	repos, err := crane.Catalog(address, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list repositories of registry '%s': %w", registryNode.Name, err)
+	}
+	return repos, nil
+}
+
+// RegistryListTags lists the tags of a repository in a registry
+func RegistryListTags(ctx context.Context, runtime runtimes.Runtime, registryNode *k3d.Node, repository string) ([]string, error) {
+	address, opts, err := registryRemoteOptions(ctx, runtime, registryNode)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := crane.ListTags(fmt.Sprintf("%s/%s", address, repository), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tags of repository '%s' in registry '%s': %w", repository, registryNode.Name, err)
+	}
+	return tags, nil
+}
+
+// RegistryPushImage retags an image from the local container runtime for the registry and pushes it there.
+// It returns the reference of the pushed image, as seen from the host.
+func RegistryPushImage(ctx context.Context, runtime runtimes.Runtime, registryNode *k3d.Node, image string) (string, error) {
+	address, opts, err := registryRemoteOptions(ctx, runtime, registryNode)
+	if err != nil {
+		return "", err
+	}
+
+	runtimeImages, err := runtime.GetImages(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch list of existing images from runtime: %w", err)
+	}
+	runtimeImage, found := findRuntimeImage(image, runtimeImages)
+	if !found {
+		return "", fmt.Errorf("image '%s' couldn't be found in the container runtime", image)
+	}
+	target, err := registryPushTarget(address, runtimeImage)
+	if err != nil {
+		return "", err
+	}
+
+	// the image tarball has to be read multiple times, so it's buffered in a temporary file
+	stream, err := runtime.GetImageStream(ctx, []string{runtimeImage})
+	if err != nil {
+		return "", fmt.Errorf("failed to export image '%s' from the container runtime: %w", runtimeImage, err)
+	}
+	defer stream.Close()
+	tmpFile, err := os.CreateTemp("", "k3d-registry-push-*.tar")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file for image '%s': %w", runtimeImage, err)
+	}
+	defer os.Remove(tmpFile.Name())
+	if _, err := io.Copy(tmpFile, stream); err != nil {
+		tmpFile.Close()
+		return "", fmt.Errorf("failed to export image '%s' from the container runtime: %w", runtimeImage, err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return "", fmt.Errorf("failed to write temporary file for image '%s': %w", runtimeImage, err)
+	}
+
+	tag, err := name.NewTag(runtimeImage)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse image name '%s': %w", runtimeImage, err)
+	}
+	img, err := tarball.ImageFromPath(tmpFile.Name(), &tag)
+	if err != nil {
+		return "", fmt.Errorf("failed to read image '%s': %w", runtimeImage, err)
+	}
+
+	l.Log().Infof("Pushing image '%s' to '%s'...", runtimeImage, target)
+	if err := crane.Push(img, target, opts...); err != nil {
+		return "", fmt.Errorf("failed to push image '%s' to registry '%s': %w", runtimeImage, registryNode.Name, err)
+	}
+	return target, nil
+}
+
+// registryPushTarget returns the reference of an image retagged for a registry,
+// dropping the original registry (and the implicit `library/` of DockerHub images)
+func registryPushTarget(registryAddress string, image string) (string, error) {
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse image name '%s': %w", image, err)
+	}
+	repository := ref.Context().RepositoryStr()
+	if ref.Context().RegistryStr() == name.DefaultRegistry {
+		repository = strings.TrimPrefix(repository, "library/")
+	}
+	if digest, ok := ref.(name.Digest); ok {
+		return fmt.Sprintf("%s/%s@%s", registryAddress, repository, digest.DigestStr()), nil
+	}
+	return fmt.Sprintf("%s/%s:%s", registryAddress, repository, ref.Identifier()), nil
+}
+
+// RegistryDeleteImage deletes an image (`REPOSITORY:TAG` or `REPOSITORY@DIGEST`) from a registry.
+// As the registry deletes manifests by digest, all tags referencing the same manifest are deleted.
+func RegistryDeleteImage(ctx context.Context, runtime runtimes.Runtime, registryNode *k3d.Node, image string) error {
+	regNode, err := NodeGet(ctx, runtime, registryNode)
+	if err != nil {
+		return fmt.Errorf("failed to find registry node '%s': %w", registryNode.Name, err)
+	}
+	reg, err := RegistryFromNode(regNode)
+	if err != nil {
+		return fmt.Errorf("failed to translate node to registry spec: %w", err)
+	}
+	if !reg.Options.DeleteEnabled {
+		return fmt.Errorf("registry '%s' doesn't allow deleting images (create it with `--delete-enabled`)", regNode.Name)
+	}
+
+	address, opts, err := registryRemoteOptions(ctx, runtime, regNode)
+	if err != nil {
+		return err
+	}
+	ref := fmt.Sprintf("%s/%s", address, image)
+	if !strings.Contains(image, "@") {
+		digest, err := crane.Digest(ref, opts...)
+		if err != nil {
+			return fmt.Errorf("failed to resolve digest of image '%s' in registry '%s': %w", image, regNode.Name, err)
+		}
+		repository, _, _ := strings.Cut(image, ":")
+		ref = fmt.Sprintf("%s/%s@%s", address, repository, digest)
+	}
+	if err := crane.Delete(ref, opts...); err != nil {
+		return fmt.Errorf("failed to delete image '%s' from registry '%s': %w", image, regNode.Name, err)
+	}
+	l.Log().Infof("Deleted image '%s' from registry '%s'", image, regNode.Name)
+	return nil
+}
+
+// RegistryGarbageCollect runs the garbage collector of a registry inside its container and returns its output.
+// The registry is restarted afterwards (unless it's a dry run) to clear its cache of blob descriptors.
+func RegistryGarbageCollect(ctx context.Context, runtime runtimes.Runtime, registryNode *k3d.Node, opts k3d.RegistryGarbageCollectOpts) (string, error) {
+	regNode, err := NodeGet(ctx, runtime, registryNode)
+	if err != nil {
+		return "", fmt.Errorf("failed to find registry node '%s': %w", registryNode.Name, err)
+	}
+	if regNode.Role != k3d.RegistryRole {
+		return "", fmt.Errorf("node '%s' is not a registry", regNode.Name)
+	}
+
+	impl, err := GetRegistryImplementation(regNode.RegistryKind())
+	if err != nil {
+		return "", err
+	}
+	cmd, err := impl.GarbageCollectCmd(opts)
+	if err != nil {
+		return "", fmt.Errorf("cannot run garbage collector in registry '%s': %w", regNode.Name, err)
+	}
+
+	l.Log().Infof("Running garbage collector in registry '%s'...", regNode.Name)
+	logs, err := runtime.ExecInNodeGetLogs(ctx, regNode, cmd)
+	var output []byte
+	if logs != nil {
+		output, _ = io.ReadAll(logs)
+	}
+	if err != nil {
+		return string(output), fmt.Errorf("failed to run garbage collector in registry '%s': %w", regNode.Name, err)
+	}
+
+	if !opts.DryRun {
+		l.Log().Infof("Restarting registry '%s'...", regNode.Name)
+		if err := runtime.StopNode(ctx, regNode); err != nil {
+			return string(output), fmt.Errorf("runtime failed to stop registry '%s': %w", regNode.Name, err)
+		}
+		if err := runtime.StartNode(ctx, regNode); err != nil {
+			return string(output), fmt.Errorf("runtime failed to start registry '%s': %w", regNode.Name, err)
+		}
+	}
+	return string(output), nil
+}
+
+// registryRemoteOptions returns the address of a registry as reachable from the host (via its exposed port)
+// and the options to access it (plain http, trusting its CA or using its credentials)
+func registryRemoteOptions(ctx context.Context, runtime runtimes.Runtime, registryNode *k3d.Node) (string, []crane.Option, error) {
+	regNode, err := NodeGet(ctx, runtime, registryNode)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to find registry node '%s': %w", registryNode.Name, err)
+	}
+	if regNode.Role != k3d.RegistryRole {
+		return "", nil, fmt.Errorf("node '%s' is not a registry", regNode.Name)
+	}
+	reg, err := RegistryFromNode(regNode)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to translate node to registry spec: %w", err)
+	}
+	if reg.ExposureOpts.Binding.HostPort == "" {
+		return "", nil, fmt.Errorf("registry '%s' doesn't expose a port on the host", regNode.Name)
+	}
+
+	host := reg.ExposureOpts.Binding.HostIP
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "localhost"
+		if runtimeHost := runtime.GetHost(); runtimeHost != "" {
+			host = strings.Split(runtimeHost, ":")[0] // remove the port
+		}
+	}
+	address := net.JoinHostPort(host, reg.ExposureOpts.Binding.HostPort)
+
+	opts := []crane.Option{crane.WithContext(ctx)}
+	if reg.Options.TLS {
+		ca, err := RegistryGetCA(ctx, runtime, regNode)
+		if err != nil {
+			return "", nil, err
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(ca) {
+			return "", nil, fmt.Errorf("failed to parse CA of registry '%s'", regNode.Name)
+		}
+		transport := remote.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}
+		opts = append(opts, crane.WithTransport(transport))
+	} else {
+		opts = append(opts, crane.Insecure)
+	}
+	if regNode.RuntimeLabels[k3d.LabelRegistryAuth] != "" {
+		auth, err := RegistryGetAuth(regNode)
+		if err != nil {
+			return "", nil, err
+		}
+		opts = append(opts, crane.WithAuth(&authn.Basic{Username: auth.Username, Password: auth.Password}))
+	}
+	return address, opts, nil
+}
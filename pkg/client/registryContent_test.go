@@ -0,0 +1,146 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package client_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/docker/go-connections/nat"
+
+	"github.com/k3d-io/k3d/v5/pkg/client"
+	"github.com/k3d-io/k3d/v5/pkg/runtimes/fake"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+func TestFakeRuntimeRegistryContent(t *testing.T) {
+	ctx := context.Background()
+	rt := fake.NewRuntime()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	if _, _, err := rt.CreateNetworkIfNotPresent(ctx, &k3d.ClusterNetwork{Name: k3d.DefaultRuntimeNetwork}); err != nil {
+		t.Fatalf("failed to create default network: %v", err)
+	}
+	rt.ExecHandler = func(node *k3d.Node, cmd []string, stdin []byte) (string, error) {
+		if len(cmd) > 1 && cmd[0] == "registry" && cmd[1] == "garbage-collect" {
+			return "0 blobs marked, 2 blobs and 0 manifests eligible for deletion\n", nil
+		}
+		return "", nil
+	}
+
+	// minimal registry API (catalog, tags, manifests) requiring basic auth
+	const digest = "sha256:0000000000000000000000000000000000000000000000000000000000000001"
+	deleted := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || user != "user" || password != "password" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.URL.Path == "/v2/":
+			w.WriteHeader(http.StatusOK)
+		case r.URL.Path == "/v2/_catalog":
+			_, _ = w.Write([]byte(`{"repositories":["mynginx","other"]}`))
+		case r.URL.Path == "/v2/mynginx/tags/list":
+			_, _ = w.Write([]byte(`{"name":"mynginx","tags":["v0.1","v0.2"]}`))
+		case r.Method == http.MethodHead && r.URL.Path == "/v2/mynginx/manifests/v0.1":
+			w.Header().Set("Content-Type", "application/vnd.docker.distribution.manifest.v2+json")
+			w.Header().Set("Docker-Content-Digest", digest)
+			w.Header().Set("Content-Length", "100")
+			w.WriteHeader(http.StatusOK)
+		case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/v2/mynginx/manifests/"):
+			deleted = append(deleted, strings.TrimPrefix(r.URL.Path, "/v2/mynginx/manifests/"))
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("failed to parse server URL: %v", err)
+	}
+
+	reg := &k3d.Registry{Host: "k3d-contentreg", Image: "registry:2", Options: k3d.RegistryOptions{
+		DeleteEnabled: true,
+		Auth:          k3d.RegistryAuth{Username: "user", Password: "password"},
+	}}
+	reg.ExposureOpts.Port = nat.Port("5000/tcp")
+	reg.ExposureOpts.Binding = nat.PortBinding{HostIP: serverURL.Hostname(), HostPort: serverURL.Port()}
+	regNode, err := client.RegistryRun(ctx, rt, reg)
+	if err != nil {
+		t.Fatalf("failed to run registry: %v", err)
+	}
+
+	repos, err := client.RegistryListRepositories(ctx, rt, &k3d.Node{Name: regNode.Name})
+	if err != nil || !reflect.DeepEqual(repos, []string{"mynginx", "other"}) {
+		t.Errorf("expected repositories [mynginx other], got %v (%v)", repos, err)
+	}
+
+	registry, repository, err := client.SplitRegistryImageRef("k3d-contentreg:5000/mynginx")
+	if err != nil || registry != "k3d-contentreg" || repository != "mynginx" {
+		t.Fatalf("failed to split image reference: got '%s', '%s' (%v)", registry, repository, err)
+	}
+	tags, err := client.RegistryListTags(ctx, rt, &k3d.Node{Name: registry}, repository)
+	if err != nil || !reflect.DeepEqual(tags, []string{"v0.1", "v0.2"}) {
+		t.Errorf("expected tags [v0.1 v0.2], got %v (%v)", tags, err)
+	}
+
+	if err := client.RegistryDeleteImage(ctx, rt, &k3d.Node{Name: regNode.Name}, "mynginx:v0.1"); err != nil {
+		t.Fatalf("failed to delete image: %v", err)
+	}
+	if !reflect.DeepEqual(deleted, []string{digest}) {
+		t.Errorf("expected image to be deleted by its digest, got deleted references %v", deleted)
+	}
+
+	output, err := client.RegistryGarbageCollect(ctx, rt, &k3d.Node{Name: regNode.Name}, k3d.RegistryGarbageCollectOpts{DeleteUntagged: true})
+	if err != nil {
+		t.Fatalf("failed to run garbage collector: %v", err)
+	}
+	if !strings.Contains(output, "eligible for deletion") {
+		t.Errorf("expected garbage collector output to be returned, got '%s'", output)
+	}
+	expectedCmd := []string{"registry", "garbage-collect", "--delete-untagged", k3d.DefaultRegistryConfigPath}
+	if history := rt.ExecHistory(regNode.Name); len(history) == 0 || !reflect.DeepEqual(history[len(history)-1], expectedCmd) {
+		t.Errorf("expected garbage collector to be run as %v, got exec history %v", expectedCmd, history)
+	}
+	if regNode, err = client.NodeGet(ctx, rt, regNode); err != nil || !regNode.State.Running {
+		t.Errorf("expected registry to be running again after garbage collection (%v)", err)
+	}
+
+	// deleting images requires a registry with deletion enabled
+	reg = &k3d.Registry{Host: "k3d-readonlyreg", Image: "registry:2"}
+	reg.ExposureOpts.Port = nat.Port("5000/tcp")
+	reg.ExposureOpts.Binding = nat.PortBinding{HostIP: "127.0.0.1", HostPort: "5222"}
+	if _, err := client.RegistryRun(ctx, rt, reg); err != nil {
+		t.Fatalf("failed to run registry: %v", err)
+	}
+	if err := client.RegistryDeleteImage(ctx, rt, &k3d.Node{Name: "k3d-readonlyreg"}, "mynginx:v0.1"); err == nil || !strings.Contains(err.Error(), "--delete-enabled") {
+		t.Errorf("expected deleting images from a registry without deletion enabled to fail, got %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package client
+
+import (
+	"fmt"
+	"os"
+	"slices"
+
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+const (
+	registryHarborLiteConfigPath  = "/etc/registry/config.yml" // read by the entrypoint of the registry-photon image
+	registryHarborLiteStoragePath = "/storage"
+	registryHarborLiteBinary      = "registry_DO_NOT_USE_GC" // the distribution binary, renamed by Harbor
+)
+
+// registryHarborLite is the registry component of Harbor (goharbor/registry-photon), running standalone without
+// the other Harbor services. It's based on distribution and thus configured via REGISTRY_* environment variables as well,
+// but k3d has to replace its config file, as the one shipped with the image expects Harbor's token service and cache.
+type registryHarborLite struct{}
+
+func (registryHarborLite) DefaultImage() string {
+	return fmt.Sprintf("%s:%s", k3d.DefaultRegistryHarborLiteImageRepo, k3d.DefaultRegistryHarborLiteImageTag)
+}
+
+func (registryHarborLite) StoragePath() string {
+	return registryHarborLiteStoragePath
+}
+
+func (h registryHarborLite) Configure(reg *k3d.Registry, node *k3d.Node) (map[string][]byte, error) {
+	registryDistributionEnv(reg, node)
+
+	password := ""
+	if reg.Options.Proxy.RemoteURL != "" {
+		password = reg.Options.Proxy.Password
+	}
+	configYAML, err := registryDistributionConfigFile(h.StoragePath(), password)
+	if err != nil {
+		return nil, err
+	}
+	return map[string][]byte{registryHarborLiteConfigPath: configYAML}, nil
+}
+
+// ConfigFileMode makes the files readable for the unprivileged user the registry-photon image runs as
+func (registryHarborLite) ConfigFileMode() os.FileMode {
+	return 0644
+}
+
+func (registryHarborLite) DeleteEnabled(node *k3d.Node) bool {
+	return slices.Contains(node.Env, "REGISTRY_STORAGE_DELETE_ENABLED=true")
+}
+
+func (registryHarborLite) GarbageCollectCmd(opts k3d.RegistryGarbageCollectOpts) ([]string, error) {
+	return registryDistributionGarbageCollectCmd(registryHarborLiteBinary, registryHarborLiteConfigPath, opts), nil
+}
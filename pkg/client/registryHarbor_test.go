@@ -0,0 +1,129 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package client_test
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/docker/go-connections/nat"
+	"sigs.k8s.io/yaml"
+
+	"github.com/k3d-io/k3d/v5/pkg/client"
+	"github.com/k3d-io/k3d/v5/pkg/runtimes/fake"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+func TestFakeRuntimeRegistryHarborLite(t *testing.T) {
+	ctx := context.Background()
+	rt := fake.NewRuntime()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	if _, _, err := rt.CreateNetworkIfNotPresent(ctx, &k3d.ClusterNetwork{Name: k3d.DefaultRuntimeNetwork}); err != nil {
+		t.Fatalf("failed to create default network: %v", err)
+	}
+	t.Setenv("K3D_TEST_HARBOR_PROXY_PASSWORD", "proxysecret")
+
+	reg := &k3d.Registry{Host: "k3d-harborlitereg", Options: k3d.RegistryOptions{
+		Kind:          k3d.RegistryKindHarborLite,
+		TLS:           true,
+		Auth:          k3d.RegistryAuth{Username: "user", Password: "secret"},
+		DeleteEnabled: true,
+		Proxy:         k3d.RegistryProxy{RemoteURL: "https://ghcr.io", Username: "proxyuser", PasswordEnv: "K3D_TEST_HARBOR_PROXY_PASSWORD"},
+	}}
+	reg.ExposureOpts.Port = nat.Port("5000/tcp")
+	reg.ExposureOpts.Binding = nat.PortBinding{HostIP: "0.0.0.0", HostPort: "5000"}
+	regNode, err := client.RegistryRun(ctx, rt, reg)
+	if err != nil {
+		t.Fatalf("failed to run registry: %v", err)
+	}
+	regNode, err = client.NodeGet(ctx, rt, regNode)
+	if err != nil {
+		t.Fatalf("failed to get registry node: %v", err)
+	}
+
+	if expected := fmt.Sprintf("%s:%s", k3d.DefaultRegistryHarborLiteImageRepo, k3d.DefaultRegistryHarborLiteImageTag); regNode.Image != expected {
+		t.Errorf("expected harbor-lite registry to use the image '%s', got '%s'", expected, regNode.Image)
+	}
+	if regNode.RegistryKind() != k3d.RegistryKindHarborLite {
+		t.Errorf("expected registry node to be labeled with kind harbor-lite, got labels %v", regNode.RuntimeLabels)
+	}
+	for _, env := range []string{"REGISTRY_PROXY_REMOTEURL=https://ghcr.io", "REGISTRY_STORAGE_DELETE_ENABLED=true", "REGISTRY_AUTH=htpasswd"} {
+		if !slices.Contains(regNode.Env, env) {
+			t.Errorf("expected registry env to contain '%s', got %v", env, regNode.Env)
+		}
+	}
+	for _, env := range regNode.Env {
+		if strings.Contains(env, "proxysecret") {
+			t.Errorf("expected the proxy password not to be part of the environment, got '%s'", env)
+		}
+	}
+
+	configYAML, ok := rt.ReadFile(regNode.Name, "/etc/registry/config.yml")
+	if !ok {
+		t.Fatalf("expected harbor-lite config to be written to the registry")
+	}
+	var config struct {
+		Storage struct {
+			Filesystem struct {
+				RootDirectory string `json:"rootdirectory"`
+			} `json:"filesystem"`
+		} `json:"storage"`
+		Auth  map[string]interface{} `json:"auth"`
+		Proxy struct {
+			Password string `json:"password"`
+		} `json:"proxy"`
+	}
+	if err := yaml.Unmarshal(configYAML, &config); err != nil {
+		t.Fatalf("failed to parse harbor-lite config: %v", err)
+	}
+	if config.Storage.Filesystem.RootDirectory != "/storage" || config.Proxy.Password != "proxysecret" {
+		t.Errorf("expected harbor-lite config to store data in /storage and hold the proxy password, got %s", configYAML)
+	}
+	if _, ok := config.Auth["token"]; ok {
+		t.Errorf("expected harbor-lite config not to use Harbor's token service, got %s", configYAML)
+	}
+
+	if !slices.Contains(regNode.Volumes, "k3d-harborlitereg-data:/storage") {
+		t.Errorf("expected registry data to be kept in the named volume 'k3d-harborlitereg-data', got volumes %v", regNode.Volumes)
+	}
+
+	harbor, err := client.RegistryFromNode(regNode)
+	if err != nil {
+		t.Fatalf("failed to get registry from node: %v", err)
+	}
+	if harbor.Options.Kind != k3d.RegistryKindHarborLite || !harbor.Options.DeleteEnabled || harbor.Options.Proxy.RemoteURL != "https://ghcr.io" {
+		t.Errorf("expected harbor-lite registry with deletion enabled proxying https://ghcr.io, got %+v", harbor.Options)
+	}
+
+	if _, err := client.RegistryGarbageCollect(ctx, rt, regNode, k3d.RegistryGarbageCollectOpts{DryRun: true}); err != nil {
+		t.Fatalf("failed to run garbage collector: %v", err)
+	}
+	expectedCmd := []string{"registry_DO_NOT_USE_GC", "garbage-collect", "--dry-run", "/etc/registry/config.yml"}
+	if history := rt.ExecHistory(regNode.Name); len(history) == 0 || !reflect.DeepEqual(history[len(history)-1], expectedCmd) {
+		t.Errorf("expected garbage collector to be run as %v, got exec history %v", expectedCmd, history)
+	}
+}
@@ -0,0 +1,215 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package client
+
+import (
+	"fmt"
+	"os"
+	"slices"
+
+	"sigs.k8s.io/yaml"
+
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+// RegistryImplementation covers everything that differs between the kinds of registries k3d can create (see k3d.RegistryKinds)
+type RegistryImplementation interface {
+	// DefaultImage returns the image used, if the registry spec doesn't specify one
+	DefaultImage() string
+	// StoragePath returns the path inside the registry container, where the registry stores its data
+	StoragePath() string
+	// Configure sets up the registry node according to the registry spec (which holds the resolved proxy password)
+	// and returns the configuration files, which have to be written to the node before it's started (keyed by path)
+	Configure(reg *k3d.Registry, node *k3d.Node) (map[string][]byte, error)
+	// ConfigFileMode returns the mode of the files k3d writes to the registry container (config, certificates, htpasswd),
+	// which have to be readable by the user the registry runs as
+	ConfigFileMode() os.FileMode
+	// DeleteEnabled returns true, if the registry running in the node allows deleting images via its API
+	DeleteEnabled(node *k3d.Node) bool
+	// GarbageCollectCmd returns the command running the garbage collector inside the registry container
+	GarbageCollectCmd(opts k3d.RegistryGarbageCollectOpts) ([]string, error)
+}
+
+// GetRegistryImplementation returns the implementation of a registry kind (default: distribution)
+func GetRegistryImplementation(kind k3d.RegistryKind) (RegistryImplementation, error) {
+	switch kind {
+	case "", k3d.RegistryKindDistribution:
+		return registryDistribution{}, nil
+	case k3d.RegistryKindZot:
+		return registryZot{}, nil
+	case k3d.RegistryKindHarborLite:
+		return registryHarborLite{}, nil
+	}
+	return nil, fmt.Errorf("unsupported registry kind '%s' (supported: %v)", kind, k3d.RegistryKinds)
+}
+
+// registryDistribution is the CNCF distribution registry (registry:2), configured via REGISTRY_* environment variables
+// (except for secrets, which go into its config file)
+type registryDistribution struct{}
+
+func (registryDistribution) DefaultImage() string {
+	return fmt.Sprintf("%s:%s", k3d.DefaultRegistryImageRepo, k3d.DefaultRegistryImageTag)
+}
+
+func (registryDistribution) StoragePath() string {
+	return k3d.DefaultRegistryMountPath
+}
+
+func (r registryDistribution) Configure(reg *k3d.Registry, node *k3d.Node) (map[string][]byte, error) {
+	registryDistributionEnv(reg, node)
+
+	files := map[string][]byte{}
+	if reg.Options.Proxy.RemoteURL != "" && reg.Options.Proxy.Password != "" {
+		// the password goes into the config file instead of the environment, where anyone inspecting the container could read it
+		configYAML, err := registryDistributionConfigFile(r.StoragePath(), reg.Options.Proxy.Password)
+		if err != nil {
+			return nil, err
+		}
+		files[k3d.DefaultRegistryConfigPath] = configYAML
+	}
+	return files, nil
+}
+
+func (registryDistribution) ConfigFileMode() os.FileMode {
+	return 0600
+}
+
+// registryDistributionEnv configures a distribution-based registry via REGISTRY_* environment variables,
+// which take precedence over its config file
+func registryDistributionEnv(reg *k3d.Registry, node *k3d.Node) {
+	if reg.Options.EnforcePortMatch {
+		node.Env = append(node.Env, fmt.Sprintf("REGISTRY_HTTP_ADDR=:%s", reg.ExposureOpts.Binding.HostPort))
+	}
+
+	if reg.Options.Proxy.RemoteURL != "" {
+		node.Env = append(node.Env, fmt.Sprintf("REGISTRY_PROXY_REMOTEURL=%s", reg.Options.Proxy.RemoteURL))
+		if reg.Options.Proxy.Username != "" {
+			node.Env = append(node.Env, fmt.Sprintf("REGISTRY_PROXY_USERNAME=%s", reg.Options.Proxy.Username))
+		}
+	}
+
+	if reg.Options.DeleteEnabled {
+		node.Env = append(node.Env, "REGISTRY_STORAGE_DELETE_ENABLED=true")
+	}
+
+	if reg.Options.TLS {
+		node.Env = append(node.Env,
+			fmt.Sprintf("REGISTRY_HTTP_TLS_CERTIFICATE=%s/%s", k3d.DefaultRegistryCertsPath, registryCertFile),
+			fmt.Sprintf("REGISTRY_HTTP_TLS_KEY=%s/%s", k3d.DefaultRegistryCertsPath, registryKeyFile),
+		)
+	}
+
+	if reg.Options.Auth != (k3d.RegistryAuth{}) {
+		node.Env = append(node.Env,
+			fmt.Sprintf("REGISTRY_AUTH=%s", registryAuthType),
+			fmt.Sprintf("REGISTRY_AUTH_HTPASSWD_REALM=%s", registryAuthRealm),
+			fmt.Sprintf("REGISTRY_AUTH_HTPASSWD_PATH=%s/%s", k3d.DefaultRegistryAuthPath, registryHtpasswdFile),
+		)
+	}
+}
+
+// registryDistributionConfigFile generates the config file of a distribution-based registry, holding the proxy password (if any)
+func registryDistributionConfigFile(storagePath string, proxyPassword string) ([]byte, error) {
+	config := registryDistributionDefaultConfig(storagePath)
+	if proxyPassword != "" {
+		config.Proxy = &distributionProxy{Password: proxyPassword}
+	}
+	configYAML, err := yaml.Marshal(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal registry config: %w", err)
+	}
+	return configYAML, nil
+}
+
+// distributionConfig is the part of the distribution config file (config.yml) k3d writes,
+// settings passed via REGISTRY_* environment variables take precedence over it
+type distributionConfig struct {
+	Version string             `json:"version"`
+	Log     distributionLog    `json:"log"`
+	Storage distributionStore  `json:"storage"`
+	HTTP    distributionHTTP   `json:"http"`
+	Health  distributionHealth `json:"health"`
+	Proxy   *distributionProxy `json:"proxy,omitempty"`
+}
+
+type distributionLog struct {
+	Fields map[string]string `json:"fields"`
+}
+
+type distributionStore struct {
+	Cache      map[string]string `json:"cache"`
+	Filesystem map[string]string `json:"filesystem"`
+}
+
+type distributionHTTP struct {
+	Addr    string              `json:"addr"`
+	Headers map[string][]string `json:"headers"`
+}
+
+type distributionHealth struct {
+	StorageDriver distributionHealthCheck `json:"storagedriver"`
+}
+
+type distributionHealthCheck struct {
+	Enabled   bool   `json:"enabled"`
+	Interval  string `json:"interval"`
+	Threshold int    `json:"threshold"`
+}
+
+// distributionProxy holds the password of the proxied remote registry (URL and username are passed via the environment)
+type distributionProxy struct {
+	Password string `json:"password"`
+}
+
+// registryDistributionDefaultConfig returns the config file shipped with the registry:2 image, which writing our own replaces
+func registryDistributionDefaultConfig(storagePath string) distributionConfig {
+	return distributionConfig{
+		Version: "0.1",
+		Log:     distributionLog{Fields: map[string]string{"service": "registry"}},
+		Storage: distributionStore{
+			Cache:      map[string]string{"blobdescriptor": "inmemory"},
+			Filesystem: map[string]string{"rootdirectory": storagePath},
+		},
+		HTTP:   distributionHTTP{Addr: ":" + k3d.DefaultRegistryPort, Headers: map[string][]string{"X-Content-Type-Options": {"nosniff"}}},
+		Health: distributionHealth{StorageDriver: distributionHealthCheck{Enabled: true, Interval: "10s", Threshold: 3}},
+	}
+}
+
+func (registryDistribution) DeleteEnabled(node *k3d.Node) bool {
+	return slices.Contains(node.Env, "REGISTRY_STORAGE_DELETE_ENABLED=true")
+}
+
+func (registryDistribution) GarbageCollectCmd(opts k3d.RegistryGarbageCollectOpts) ([]string, error) {
+	return registryDistributionGarbageCollectCmd("registry", k3d.DefaultRegistryConfigPath, opts), nil
+}
+
+// registryDistributionGarbageCollectCmd returns the garbage-collect command of a distribution-based registry binary
+func registryDistributionGarbageCollectCmd(binary string, configPath string, opts k3d.RegistryGarbageCollectOpts) []string {
+	cmd := []string{binary, "garbage-collect"}
+	if opts.DeleteUntagged {
+		cmd = append(cmd, "--delete-untagged")
+	}
+	if opts.DryRun {
+		cmd = append(cmd, "--dry-run")
+	}
+	return append(cmd, configPath)
+}
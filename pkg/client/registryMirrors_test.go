@@ -0,0 +1,145 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package client_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	wharfie "github.com/rancher/wharfie/pkg/registries"
+	"sigs.k8s.io/yaml"
+
+	"github.com/k3d-io/k3d/v5/pkg/client"
+	"github.com/k3d-io/k3d/v5/pkg/config"
+	conf "github.com/k3d-io/k3d/v5/pkg/config/v1alpha5"
+	"github.com/k3d-io/k3d/v5/pkg/runtimes/fake"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+func TestFakeRuntimeRegistryMirrors(t *testing.T) {
+	ctx := context.Background()
+	rt := fake.NewRuntime()
+	if _, _, err := rt.CreateNetworkIfNotPresent(ctx, &k3d.ClusterNetwork{Name: k3d.DefaultRuntimeNetwork}); err != nil {
+		t.Fatalf("failed to create default network: %v", err)
+	}
+
+	passwordFile := filepath.Join(t.TempDir(), "ghcr-token")
+	if err := os.WriteFile(passwordFile, []byte("ghcr-secret\n"), 0600); err != nil {
+		t.Fatalf("failed to write password file: %v", err)
+	}
+	t.Setenv("K3D_TEST_DOCKERHUB_TOKEN", "dockerhub-secret")
+
+	simpleCfg := conf.SimpleConfig{Servers: 1}
+	simpleCfg.Name = "test"
+	simpleCfg.Registries.Mirrors = []conf.SimpleConfigRegistryCreateConfig{
+		{Proxy: k3d.RegistryProxy{RemoteURL: "docker.io", Username: "me", PasswordEnv: "K3D_TEST_DOCKERHUB_TOKEN"}},
+		{Proxy: k3d.RegistryProxy{RemoteURL: "https://ghcr.io", Username: "me", PasswordFile: passwordFile}},
+		{Name: "k3d-quay-cache", Proxy: k3d.RegistryProxy{RemoteURL: "quay.io"}},
+	}
+
+	duplicateCfg := simpleCfg
+	duplicateCfg.Registries.Mirrors = append(slices.Clone(simpleCfg.Registries.Mirrors), conf.SimpleConfigRegistryCreateConfig{Proxy: k3d.RegistryProxy{RemoteURL: "https://registry-1.docker.io"}})
+	if _, err := config.TransformSimpleToClusterConfig(ctx, rt, duplicateCfg, ""); err == nil {
+		t.Errorf("expected mirroring docker.io twice to fail")
+	}
+
+	clusterCfg, err := config.TransformSimpleToClusterConfig(ctx, rt, simpleCfg, "")
+	if err != nil {
+		t.Fatalf("failed to transform simple config: %v", err)
+	}
+	if err := client.ClusterRun(ctx, rt, clusterCfg); err != nil {
+		t.Fatalf("failed to run cluster: %v", err)
+	}
+
+	expectedMirrors := map[string]string{
+		"docker.io": "k3d-test-mirror-docker-io",
+		"ghcr.io":   "k3d-test-mirror-ghcr-io",
+		"quay.io":   "k3d-quay-cache",
+	}
+	expectedPasswords := map[string]string{
+		"k3d-test-mirror-docker-io": "dockerhub-secret",
+		"k3d-test-mirror-ghcr-io":   "ghcr-secret",
+	}
+	for _, name := range expectedMirrors {
+		regNode, err := client.NodeGet(ctx, rt, &k3d.Node{Name: name})
+		if err != nil {
+			t.Fatalf("expected mirror registry '%s' to be created: %v", name, err)
+		}
+		if regNode.RuntimeLabels[k3d.LabelClusterName] != "test" {
+			t.Errorf("expected mirror registry '%s' to belong to cluster 'test', got labels %v", name, regNode.RuntimeLabels)
+		}
+		password, ok := expectedPasswords[name]
+		if !ok {
+			continue
+		}
+		regConfig, ok := rt.ReadFile(name, k3d.DefaultRegistryConfigPath)
+		if !ok {
+			t.Fatalf("expected config file to be written to mirror registry '%s'", name)
+		}
+		distConfig := struct {
+			Proxy struct {
+				Password string `json:"password"`
+			} `json:"proxy"`
+		}{}
+		if err := yaml.Unmarshal(regConfig, &distConfig); err != nil {
+			t.Fatalf("failed to parse config file of mirror registry '%s': %v", name, err)
+		}
+		if distConfig.Proxy.Password != password {
+			t.Errorf("expected mirror registry '%s' to get the password from the file or environment via its config file, got:\n%s", name, regConfig)
+		}
+	}
+
+	nodes, err := client.NodeList(ctx, rt)
+	if err != nil {
+		t.Fatalf("failed to list nodes: %v", err)
+	}
+	for _, node := range nodes {
+		for _, env := range node.Env {
+			for _, password := range expectedPasswords {
+				if strings.Contains(env, password) {
+					t.Errorf("expected no proxy password in the environment of node '%s', got '%s'", node.Name, env)
+				}
+			}
+		}
+	}
+
+	registriesYaml, ok := rt.ReadFile("k3d-test-server-0", k3d.DefaultRegistriesFilePath)
+	if !ok {
+		t.Fatalf("expected registries.yaml to be written to the server node")
+	}
+	regConf := &wharfie.Registry{}
+	if err := yaml.Unmarshal(registriesYaml, regConf); err != nil {
+		t.Fatalf("failed to parse registries.yaml: %v", err)
+	}
+	for upstream, name := range expectedMirrors {
+		mirror, ok := regConf.Mirrors[upstream]
+		if !ok || !slices.Contains(mirror.Endpoints, fmt.Sprintf("http://%s:5000", name)) {
+			t.Errorf("expected registries.yaml to mirror '%s' via '%s', got:\n%s", upstream, name, registriesYaml)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package client
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	wharfie "github.com/rancher/wharfie/pkg/registries"
+	"k8s.io/utils/strings/slices"
+	"sigs.k8s.io/yaml"
+
+	"github.com/k3d-io/k3d/v5/pkg/actions"
+	l "github.com/k3d-io/k3d/v5/pkg/logger"
+	"github.com/k3d-io/k3d/v5/pkg/runtimes"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+	"github.com/k3d-io/k3d/v5/pkg/util"
+)
+
+const (
+	registryCAFile   = "ca.crt"
+	registryCertFile = "tls.crt"
+	registryKeyFile  = "tls.key"
+
+	registryCertValidity = 365 * 24 * time.Hour // certificates are regenerated on each `registry create`
+)
+
+// registryCertificates are the PEM encoded CA, certificate and key of a TLS-enabled registry
+type registryCertificates struct {
+	CA   []byte
+	Cert []byte
+	Key  []byte
+}
+
+// registryGenerateCertificates generates a CA and a server certificate signed by it,
+// valid for the registry's name and the hosts it can be reached at
+func registryGenerateCertificates(reg *k3d.Registry) (*registryCertificates, error) {
+	notBefore := time.Now().Add(-time.Hour) // tolerate clock skew between host and containers
+	notAfter := notBefore.Add(registryCertValidity)
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate CA key: %w", err)
+	}
+	caSerial, err := registryCertSerial()
+	if err != nil {
+		return nil, err
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          caSerial,
+		Subject:               pkix.Name{Organization: []string{"k3d"}, CommonName: fmt.Sprintf("k3d registry CA for %s", reg.Host)},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CA certificate: %w", err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CA certificate: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate registry key: %w", err)
+	}
+	serial, err := registryCertSerial()
+	if err != nil {
+		return nil, err
+	}
+	dnsNames, ips := registryCertificateHosts(reg)
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{Organization: []string{"k3d"}, CommonName: reg.Host},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     dnsNames,
+		IPAddresses:  ips,
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create registry certificate: %w", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal registry key: %w", err)
+	}
+
+	return &registryCertificates{
+		CA:   pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}),
+		Cert: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}),
+		Key:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}, nil
+}
+
+func registryCertSerial() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate certificate serial number: %w", err)
+	}
+	return serial, nil
+}
+
+// registryCertificateHosts returns the names and IPs the registry is reachable at: its name (from the cluster network),
+// the host it's exposed on and the aliases of the docker host (from the host and from the nodes)
+func registryCertificateHosts(reg *k3d.Registry) ([]string, []net.IP) {
+	dnsNames := []string{}
+	ips := []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("::1")}
+	seen := map[string]bool{"127.0.0.1": true, "::1": true}
+	for _, host := range []string{reg.Host, reg.ExposureOpts.Host, reg.ExposureOpts.Binding.HostIP, "localhost", k3d.DefaultK3dInternalHostRecord} {
+		if host == "" || seen[host] {
+			continue
+		}
+		seen[host] = true
+		if ip := net.ParseIP(host); ip != nil {
+			if !ip.IsUnspecified() {
+				ips = append(ips, ip)
+			}
+			continue
+		}
+		dnsNames = append(dnsNames, host)
+	}
+	return dnsNames, ips
+}
+
+// registryWriteCertificates writes the certificates into the (created) registry container
+func registryWriteCertificates(ctx context.Context, runtime runtimes.Runtime, regNode *k3d.Node, certs *registryCertificates, mode os.FileMode) error {
+	for name, content := range map[string][]byte{
+		registryCAFile:   certs.CA,
+		registryCertFile: certs.Cert,
+		registryKeyFile:  certs.Key,
+	} {
+		if err := runtime.WriteToNode(ctx, content, path.Join(k3d.DefaultRegistryCertsPath, name), mode, regNode); err != nil {
+			return fmt.Errorf("failed to write '%s' to registry '%s': %w", name, regNode.Name, err)
+		}
+	}
+	return nil
+}
+
+// RegistryGetCA reads the CA of a TLS-enabled registry from its container
+func RegistryGetCA(ctx context.Context, runtime runtimes.Runtime, regNode *k3d.Node) ([]byte, error) {
+	caPath := path.Join(k3d.DefaultRegistryCertsPath, registryCAFile)
+	files, err := readNodeFiles(ctx, runtime, regNode, caPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA of registry '%s': %w", regNode.Name, err)
+	}
+	if len(files) != 1 {
+		return nil, fmt.Errorf("failed to read CA of registry '%s': expected exactly one file at %s, found %d", regNode.Name, caPath, len(files))
+	}
+	return files[0].Content, nil
+}
+
+// RegistryNodeCAPath returns the path of the registry's CA in the trust store of the k3s nodes
+func RegistryNodeCAPath(reg *k3d.Registry) string {
+	return path.Join(k3d.DefaultRegistryNodeCAPath, fmt.Sprintf("%s-ca.crt", reg.Host))
+}
+
+// RegistryHostCAPath returns the path of the registry's CA exported to the host (in the k3d config directory)
+func RegistryHostCAPath(registryName string) (string, error) {
+	configDir, err := util.GetConfigDirOrCreate()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "registries", registryName, registryCAFile), nil
+}
+
+// registryExportCA writes the CA of the registry to the host, so that e.g. docker can be configured to trust it
+func registryExportCA(reg *k3d.Registry, ca []byte) (string, error) {
+	caPath, err := RegistryHostCAPath(reg.Host)
+	if err != nil {
+		return "", fmt.Errorf("failed to get path for the CA of registry '%s': %w", reg.Host, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(caPath), 0755); err != nil {
+		return "", fmt.Errorf("failed to create directory for the CA of registry '%s': %w", reg.Host, err)
+	}
+	if err := os.WriteFile(caPath, ca, 0644); err != nil {
+		return "", fmt.Errorf("failed to write the CA of registry '%s': %w", reg.Host, err)
+	}
+	l.Log().Infof("Exported the CA of registry '%s' to %s", reg.Host, caPath)
+	return caPath, nil
+}
+
+// RegistryRemoveHostFiles removes the CA and credentials of a registry kept on the host, if there are any
+func RegistryRemoveHostFiles(registryName string) error {
+	caPath, err := RegistryHostCAPath(registryName)
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(filepath.Dir(caPath)); err != nil {
+		return fmt.Errorf("failed to remove the host files of registry '%s': %w", registryName, err)
+	}
+	return nil
+}
+
+// registryCopyCAHooks returns hooks to copy the CAs of the TLS-enabled registries used in the registries.yaml
+// from an existing node of the cluster to a new one
+func registryCopyCAHooks(ctx context.Context, runtime runtimes.Runtime, srcNode *k3d.Node, registryConfig []byte) []k3d.NodeHook {
+	caFiles, err := registryCAFiles(registryConfig)
+	if err != nil {
+		l.Log().Warnf("Failed to parse registry config of node %s: %v", srcNode.Name, err)
+		return nil
+	}
+
+	hooks := []k3d.NodeHook{}
+	for _, caFile := range caFiles {
+		files, err := readNodeFiles(ctx, runtime, srcNode, caFile)
+		if err == nil && len(files) != 1 {
+			err = fmt.Errorf("expected exactly one file, found %d", len(files))
+		}
+		if err != nil {
+			l.Log().Warnf("Failed to read registry CA %s from node %s: %v", caFile, srcNode.Name, err)
+			continue
+		}
+		hooks = append(hooks, k3d.NodeHook{
+			Stage: k3d.LifecycleStagePreStart,
+			Action: actions.WriteFileAction{
+				Runtime:     runtime,
+				Content:     files[0].Content,
+				Dest:        caFile,
+				Mode:        0644,
+				Description: fmt.Sprintf("Write registry CA %s", path.Base(caFile)),
+			},
+		})
+	}
+	return hooks
+}
+
+// registryCAFiles returns the node paths of the k3d-managed registry CAs referenced in the registries.yaml
+func registryCAFiles(registryConfig []byte) ([]string, error) {
+	regConf := &wharfie.Registry{}
+	if err := yaml.Unmarshal(registryConfig, regConf); err != nil {
+		return nil, err
+	}
+
+	caFiles := []string{}
+	for _, config := range regConf.Configs {
+		if config.TLS == nil || slices.Contains(caFiles, config.TLS.CAFile) || !strings.HasPrefix(config.TLS.CAFile, k3d.DefaultRegistryNodeCAPath+"/") {
+			continue
+		}
+		caFiles = append(caFiles, config.TLS.CAFile)
+	}
+	sort.Strings(caFiles)
+	return caFiles, nil
+}
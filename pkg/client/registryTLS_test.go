@@ -0,0 +1,214 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package client_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/go-connections/nat"
+
+	"github.com/k3d-io/k3d/v5/pkg/client"
+	"github.com/k3d-io/k3d/v5/pkg/config"
+	conf "github.com/k3d-io/k3d/v5/pkg/config/v1alpha5"
+	"github.com/k3d-io/k3d/v5/pkg/runtimes/fake"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+func TestFakeRuntimeRegistryTLS(t *testing.T) {
+	ctx := context.Background()
+	rt := fake.NewRuntime()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	// registries are created in the default runtime network before being connected to the cluster
+	if _, _, err := rt.CreateNetworkIfNotPresent(ctx, &k3d.ClusterNetwork{Name: k3d.DefaultRuntimeNetwork}); err != nil {
+		t.Fatalf("failed to create default network: %v", err)
+	}
+
+	simpleCfg := conf.SimpleConfig{Servers: 1}
+	simpleCfg.Name = "test"
+	simpleCfg.Registries.Create = &conf.SimpleConfigRegistryCreateConfig{TLS: true}
+	clusterCfg, err := config.TransformSimpleToClusterConfig(ctx, rt, simpleCfg, "")
+	if err != nil {
+		t.Fatalf("failed to transform simple config: %v", err)
+	}
+	if err := client.ClusterRun(ctx, rt, clusterCfg); err != nil {
+		t.Fatalf("failed to run cluster: %v", err)
+	}
+
+	regNode, err := client.NodeGet(ctx, rt, &k3d.Node{Name: clusterCfg.ClusterCreateOpts.Registries.Create.Host})
+	if err != nil {
+		t.Fatalf("failed to get registry node: %v", err)
+	}
+	if regNode.RuntimeLabels[k3d.LabelRegistryProtocol] != "https" {
+		t.Errorf("expected registry to be labeled with protocol https, got labels %v", regNode.RuntimeLabels)
+	}
+	reg, err := client.RegistryFromNode(regNode)
+	if err != nil {
+		t.Fatalf("failed to get registry from node: %v", err)
+	}
+	if !reg.Options.TLS {
+		t.Errorf("expected registry to have TLS enabled")
+	}
+
+	ca, err := client.RegistryGetCA(ctx, rt, regNode)
+	if err != nil {
+		t.Fatalf("failed to get registry CA: %v", err)
+	}
+	certPEM, ok := rt.ReadFile(regNode.Name, k3d.DefaultRegistryCertsPath+"/tls.crt")
+	if !ok {
+		t.Fatalf("expected registry certificate to be written to the registry node")
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(ca) {
+		t.Fatalf("failed to parse registry CA")
+	}
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		t.Fatalf("failed to decode registry certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("failed to parse registry certificate: %v", err)
+	}
+	for _, host := range []string{reg.Host, "localhost", "127.0.0.1"} {
+		if _, err := cert.Verify(x509.VerifyOptions{DNSName: host, Roots: roots}); err != nil {
+			t.Errorf("expected registry certificate to be valid for '%s': %v", host, err)
+		}
+	}
+
+	nodeCA, ok := rt.ReadFile("k3d-test-server-0", client.RegistryNodeCAPath(reg))
+	if !ok || !bytes.Equal(nodeCA, ca) {
+		t.Errorf("expected server node to trust the registry CA at '%s'", client.RegistryNodeCAPath(reg))
+	}
+	registriesYaml, ok := rt.ReadFile("k3d-test-server-0", k3d.DefaultRegistriesFilePath)
+	if !ok {
+		t.Fatalf("expected registries.yaml to be written to the server node")
+	}
+	if !strings.Contains(string(registriesYaml), "https://"+reg.Host) || !strings.Contains(string(registriesYaml), client.RegistryNodeCAPath(reg)) {
+		t.Errorf("expected registries.yaml to use https with the registry CA, got:\n%s", registriesYaml)
+	}
+
+	hostCAPath, err := client.RegistryHostCAPath(reg.Host)
+	if err != nil {
+		t.Fatalf("failed to get host CA path: %v", err)
+	}
+	if hostCA, err := os.ReadFile(hostCAPath); err != nil || !bytes.Equal(hostCA, ca) {
+		t.Errorf("expected registry CA to be exported to '%s': %v", hostCAPath, err)
+	}
+
+	cluster, err := client.ClusterGet(ctx, rt, &k3d.Cluster{Name: "test"})
+	if err != nil {
+		t.Fatalf("failed to get cluster: %v", err)
+	}
+	agent := &k3d.Node{Name: "k3d-test-agent-new", Role: k3d.AgentRole, Image: k3d.DefaultK3sImageRepo}
+	if err := client.NodeAddToCluster(ctx, rt, agent, cluster, k3d.NodeCreateOpts{Wait: true}); err != nil {
+		t.Fatalf("failed to add node to cluster: %v", err)
+	}
+	if agentCA, ok := rt.ReadFile(agent.Name, client.RegistryNodeCAPath(reg)); !ok || !bytes.Equal(agentCA, ca) {
+		t.Errorf("expected added agent to trust the registry CA at '%s'", client.RegistryNodeCAPath(reg))
+	}
+
+	if err := client.NodeDelete(ctx, rt, regNode, k3d.NodeDeleteOpts{}); err != nil {
+		t.Fatalf("failed to delete registry: %v", err)
+	}
+	if _, err := os.Stat(hostCAPath); !os.IsNotExist(err) {
+		t.Errorf("expected exported registry CA '%s' to be removed, got %v", hostCAPath, err)
+	}
+}
+
+func TestFakeRuntimeRegistryTLSLaterNodes(t *testing.T) {
+	ctx := context.Background()
+	rt := fake.NewRuntime()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	if _, _, err := rt.CreateNetworkIfNotPresent(ctx, &k3d.ClusterNetwork{Name: k3d.DefaultRuntimeNetwork}); err != nil {
+		t.Fatalf("failed to create default network: %v", err)
+	}
+	cluster := runFakeCluster(t, rt, "test", 1, 0)
+
+	reg := &k3d.Registry{Host: "k3d-tlsreg", Image: "registry:2", Options: k3d.RegistryOptions{TLS: true}}
+	reg.ExposureOpts.Port = nat.Port("5000/tcp")
+	reg.ExposureOpts.Binding = nat.PortBinding{HostIP: "0.0.0.0", HostPort: "5112"}
+	regNode, err := client.RegistryRun(ctx, rt, reg)
+	if err != nil {
+		t.Fatalf("failed to run registry: %v", err)
+	}
+	if err := client.RegistryConnect(ctx, rt, &k3d.Node{Name: regNode.Name}, &k3d.Cluster{Name: "test"}); err != nil {
+		t.Fatalf("failed to connect registry: %v", err)
+	}
+	ca, err := client.RegistryGetCA(ctx, rt, regNode)
+	if err != nil {
+		t.Fatalf("failed to get registry CA: %v", err)
+	}
+
+	block, _ := pem.Decode(ca)
+	if block == nil {
+		t.Fatalf("failed to decode registry CA")
+	}
+	caCert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("failed to parse registry CA: %v", err)
+	}
+	if validity := caCert.NotAfter.Sub(caCert.NotBefore); validity > 366*24*time.Hour {
+		t.Errorf("expected registry CA to be valid for at most a year, got %s", validity)
+	}
+
+	expectCA := func(nodeName string) {
+		t.Helper()
+		if nodeCA, ok := rt.ReadFile(nodeName, client.RegistryNodeCAPath(reg)); !ok || !bytes.Equal(nodeCA, ca) {
+			t.Errorf("expected node '%s' to trust the registry CA at '%s'", nodeName, client.RegistryNodeCAPath(reg))
+		}
+	}
+
+	// node added by scaling after the registry was connected
+	if err := client.ClusterScale(ctx, rt, cluster, k3d.ClusterScaleOpts{Agents: nodeCount(1)}); err != nil {
+		t.Fatalf("failed to scale cluster: %v", err)
+	}
+	expectCA("k3d-test-agent-0")
+
+	// nodes replaced by editing and upgrading
+	agent, err := client.NodeGet(ctx, rt, &k3d.Node{Name: "k3d-test-agent-0"})
+	if err != nil {
+		t.Fatalf("failed to get node: %v", err)
+	}
+	cpus := "1"
+	if err := client.NodeEdit(ctx, rt, agent, &client.NodeEditChangeset{CPUs: &cpus}); err != nil {
+		t.Fatalf("failed to edit node: %v", err)
+	}
+	expectCA("k3d-test-agent-0")
+
+	cluster, err = client.ClusterGet(ctx, rt, &k3d.Cluster{Name: "test"})
+	if err != nil {
+		t.Fatalf("failed to get cluster: %v", err)
+	}
+	if err := client.ClusterUpgrade(ctx, rt, cluster, k3d.ClusterUpgradeOpts{Image: "rancher/k3s:v9.9.9-k3s1", SkipDrain: true}); err != nil {
+		t.Fatalf("failed to upgrade cluster: %v", err)
+	}
+	expectCA("k3d-test-server-0")
+	expectCA("k3d-test-agent-0")
+}
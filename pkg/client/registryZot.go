@@ -0,0 +1,185 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+const (
+	registryZotConfigPath      = "/etc/zot/config.json"
+	registryZotCredentialsPath = "/etc/zot/credentials.json" // credentials of the proxied remote registry, so they don't show up in the container's env
+	registryZotDistSpecVersion = "1.1.0"                     // OCI distribution spec with artifacts and referrers
+)
+
+// registryZot is zot (https://zotregistry.dev), an OCI-native registry configured via a JSON config file.
+// Pull-through caching is done by its sync extension and garbage is collected automatically.
+type registryZot struct{}
+
+type zotConfig struct {
+	DistSpecVersion string         `json:"distSpecVersion"`
+	Storage         zotStorage     `json:"storage"`
+	HTTP            zotHTTP        `json:"http"`
+	Log             zotLog         `json:"log"`
+	Extensions      *zotExtensions `json:"extensions,omitempty"`
+}
+
+type zotStorage struct {
+	RootDirectory string `json:"rootDirectory"`
+	GC            bool   `json:"gc"`
+}
+
+type zotHTTP struct {
+	Address string   `json:"address"`
+	Port    string   `json:"port"`
+	Realm   string   `json:"realm,omitempty"`
+	TLS     *zotTLS  `json:"tls,omitempty"`
+	Auth    *zotAuth `json:"auth,omitempty"`
+}
+
+type zotTLS struct {
+	Cert string `json:"cert"`
+	Key  string `json:"key"`
+}
+
+type zotAuth struct {
+	Htpasswd zotHtpasswd `json:"htpasswd"`
+}
+
+type zotHtpasswd struct {
+	Path string `json:"path"`
+}
+
+type zotLog struct {
+	Level string `json:"level"`
+}
+
+type zotExtensions struct {
+	Sync *zotSync `json:"sync,omitempty"`
+}
+
+type zotSync struct {
+	Enable          bool              `json:"enable"`
+	CredentialsFile string            `json:"credentialsFile,omitempty"`
+	Registries      []zotSyncRegistry `json:"registries"`
+}
+
+type zotSyncRegistry struct {
+	URLs      []string         `json:"urls"`
+	OnDemand  bool             `json:"onDemand"`
+	TLSVerify bool             `json:"tlsVerify"`
+	Content   []zotSyncContent `json:"content"`
+}
+
+type zotSyncContent struct {
+	Prefix string `json:"prefix"`
+}
+
+type zotCredentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+func (registryZot) DefaultImage() string {
+	return fmt.Sprintf("%s:%s", k3d.DefaultRegistryZotImageRepo, k3d.DefaultRegistryZotImageTag)
+}
+
+func (registryZot) StoragePath() string {
+	return k3d.DefaultRegistryMountPath
+}
+
+func (z registryZot) Configure(reg *k3d.Registry, node *k3d.Node) (map[string][]byte, error) {
+	config := zotConfig{
+		DistSpecVersion: registryZotDistSpecVersion,
+		Storage:         zotStorage{RootDirectory: z.StoragePath(), GC: true},
+		HTTP:            zotHTTP{Address: "0.0.0.0", Port: reg.ExposureOpts.Port.Port()},
+		Log:             zotLog{Level: "info"},
+	}
+	files := map[string][]byte{}
+
+	if reg.Options.TLS {
+		config.HTTP.TLS = &zotTLS{
+			Cert: path.Join(k3d.DefaultRegistryCertsPath, registryCertFile),
+			Key:  path.Join(k3d.DefaultRegistryCertsPath, registryKeyFile),
+		}
+	}
+
+	if reg.Options.Auth != (k3d.RegistryAuth{}) {
+		config.HTTP.Realm = registryAuthRealm
+		config.HTTP.Auth = &zotAuth{Htpasswd: zotHtpasswd{Path: path.Join(k3d.DefaultRegistryAuthPath, registryHtpasswdFile)}}
+	}
+
+	if proxy := reg.Options.Proxy; proxy.RemoteURL != "" {
+		sync := &zotSync{
+			Enable: true,
+			Registries: []zotSyncRegistry{{
+				URLs:      []string{proxy.RemoteURL},
+				OnDemand:  true,
+				TLSVerify: true,
+				Content:   []zotSyncContent{{Prefix: "**"}},
+			}},
+		}
+		if proxy.Username != "" {
+			u, err := url.Parse(proxy.RemoteURL)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse URL of the proxied remote registry '%s': %w", proxy.RemoteURL, err)
+			}
+			if u.Host == "" {
+				return nil, fmt.Errorf("URL of the proxied remote registry '%s' has no host", proxy.RemoteURL)
+			}
+			credentials, err := json.Marshal(map[string]zotCredentials{u.Host: {Username: proxy.Username, Password: proxy.Password}})
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal zot credentials: %w", err)
+			}
+			files[registryZotCredentialsPath] = credentials
+			sync.CredentialsFile = registryZotCredentialsPath
+		}
+		config.Extensions = &zotExtensions{Sync: sync}
+	}
+
+	configJSON, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal zot config: %w", err)
+	}
+	files[registryZotConfigPath] = configJSON
+
+	node.Cmd = []string{"serve", registryZotConfigPath}
+	return files, nil
+}
+
+func (registryZot) ConfigFileMode() os.FileMode {
+	return 0600
+}
+
+func (registryZot) DeleteEnabled(node *k3d.Node) bool {
+	return true
+}
+
+func (registryZot) GarbageCollectCmd(opts k3d.RegistryGarbageCollectOpts) ([]string, error) {
+	return nil, fmt.Errorf("registries of kind %s collect garbage automatically", k3d.RegistryKindZot)
+}
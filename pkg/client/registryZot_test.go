@@ -0,0 +1,153 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package client_test
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/docker/go-connections/nat"
+	"sigs.k8s.io/yaml"
+
+	"github.com/k3d-io/k3d/v5/pkg/client"
+	"github.com/k3d-io/k3d/v5/pkg/runtimes/fake"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+func TestFakeRuntimeRegistryZot(t *testing.T) {
+	ctx := context.Background()
+	rt := fake.NewRuntime()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	if _, _, err := rt.CreateNetworkIfNotPresent(ctx, &k3d.ClusterNetwork{Name: k3d.DefaultRuntimeNetwork}); err != nil {
+		t.Fatalf("failed to create default network: %v", err)
+	}
+	t.Setenv("K3D_TEST_ZOT_PROXY_PASSWORD", "proxysecret")
+
+	reg := &k3d.Registry{Host: "k3d-zotreg", Options: k3d.RegistryOptions{
+		Kind:  k3d.RegistryKindZot,
+		TLS:   true,
+		Auth:  k3d.RegistryAuth{Username: "user", Password: "secret"},
+		Proxy: k3d.RegistryProxy{RemoteURL: "https://ghcr.io", Username: "proxyuser", PasswordEnv: "K3D_TEST_ZOT_PROXY_PASSWORD"},
+	}}
+	reg.ExposureOpts.Port = nat.Port("5000/tcp")
+	reg.ExposureOpts.Binding = nat.PortBinding{HostIP: "0.0.0.0", HostPort: "5000"}
+	regNode, err := client.RegistryRun(ctx, rt, reg)
+	if err != nil {
+		t.Fatalf("failed to run registry: %v", err)
+	}
+	regNode, err = client.NodeGet(ctx, rt, regNode)
+	if err != nil {
+		t.Fatalf("failed to get registry node: %v", err)
+	}
+
+	if expected := fmt.Sprintf("%s:%s", k3d.DefaultRegistryZotImageRepo, k3d.DefaultRegistryZotImageTag); regNode.Image != expected {
+		t.Errorf("expected zot registry to use the image '%s', got '%s'", expected, regNode.Image)
+	}
+	if regNode.RegistryKind() != k3d.RegistryKindZot {
+		t.Errorf("expected registry node to be labeled with kind zot, got labels %v", regNode.RuntimeLabels)
+	}
+	for _, env := range regNode.Env {
+		if strings.HasPrefix(env, "REGISTRY_") {
+			t.Errorf("expected zot registry not to be configured via the environment, got %s", env)
+		}
+	}
+
+	configJSON, ok := rt.ReadFile(regNode.Name, "/etc/zot/config.json")
+	if !ok {
+		t.Fatalf("expected zot config to be written to the registry")
+	}
+	var config struct {
+		DistSpecVersion string `json:"distSpecVersion"`
+		Storage         struct {
+			RootDirectory string `json:"rootDirectory"`
+		} `json:"storage"`
+		HTTP struct {
+			Port string `json:"port"`
+			TLS  struct {
+				Cert string `json:"cert"`
+			} `json:"tls"`
+			Auth struct {
+				Htpasswd struct {
+					Path string `json:"path"`
+				} `json:"htpasswd"`
+			} `json:"auth"`
+		} `json:"http"`
+		Extensions struct {
+			Sync struct {
+				Enable          bool   `json:"enable"`
+				CredentialsFile string `json:"credentialsFile"`
+				Registries      []struct {
+					URLs     []string `json:"urls"`
+					OnDemand bool     `json:"onDemand"`
+				} `json:"registries"`
+			} `json:"sync"`
+		} `json:"extensions"`
+	}
+	if err := yaml.Unmarshal(configJSON, &config); err != nil {
+		t.Fatalf("failed to parse zot config: %v", err)
+	}
+	if config.DistSpecVersion != "1.1.0" || config.Storage.RootDirectory != k3d.DefaultRegistryMountPath || config.HTTP.Port != "5000" {
+		t.Errorf("unexpected zot config %s", configJSON)
+	}
+	if config.HTTP.TLS.Cert != k3d.DefaultRegistryCertsPath+"/tls.crt" || config.HTTP.Auth.Htpasswd.Path != k3d.DefaultRegistryAuthPath+"/htpasswd" {
+		t.Errorf("expected zot config to enable TLS and htpasswd authentication, got %s", configJSON)
+	}
+	sync := config.Extensions.Sync
+	if !sync.Enable || len(sync.Registries) != 1 || !sync.Registries[0].OnDemand || !reflect.DeepEqual(sync.Registries[0].URLs, []string{"https://ghcr.io"}) {
+		t.Errorf("expected zot config to proxy https://ghcr.io on demand, got %s", configJSON)
+	}
+	if strings.Contains(string(configJSON), "proxysecret") {
+		t.Errorf("expected zot config not to contain the proxy password")
+	}
+	credentials, ok := rt.ReadFile(regNode.Name, sync.CredentialsFile)
+	if !ok || string(credentials) != `{"ghcr.io":{"username":"proxyuser","password":"proxysecret"}}` {
+		t.Errorf("expected proxy credentials to be written to the credentials file, got %q", credentials)
+	}
+
+	if !slices.Contains(regNode.Volumes, "k3d-zotreg-data:"+k3d.DefaultRegistryMountPath) {
+		t.Errorf("expected registry data to be kept in the named volume 'k3d-zotreg-data', got volumes %v", regNode.Volumes)
+	}
+
+	zot, err := client.RegistryFromNode(regNode)
+	if err != nil {
+		t.Fatalf("failed to get registry from node: %v", err)
+	}
+	if zot.Options.Kind != k3d.RegistryKindZot || !zot.Options.DeleteEnabled || zot.Options.Proxy.RemoteURL != "https://ghcr.io" {
+		t.Errorf("expected zot registry with deletion enabled proxying https://ghcr.io, got %+v", zot.Options)
+	}
+
+	if _, err := client.RegistryGarbageCollect(ctx, rt, regNode, k3d.RegistryGarbageCollectOpts{}); err == nil {
+		t.Errorf("expected garbage collection to be refused for zot, which collects garbage automatically")
+	}
+
+	unknown := &k3d.Registry{Host: "k3d-unknownreg", Options: k3d.RegistryOptions{Kind: "no-such-kind"}}
+	unknown.ExposureOpts.Port = nat.Port("5000/tcp")
+	unknown.ExposureOpts.Binding = nat.PortBinding{HostIP: "0.0.0.0", HostPort: "5001"}
+	if _, err := client.RegistryCreate(ctx, rt, unknown); err == nil {
+		t.Errorf("expected creating a registry of an unknown kind to fail")
+	}
+}
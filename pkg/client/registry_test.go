@@ -65,3 +65,44 @@ metadata:
 		t.Errorf("Computed configmap\n-> Actual:\n%s\n  does not match expected YAML\n-> Expected:\n%s", strings.TrimSpace(string(cm)), strings.TrimSpace(expectedYAMLString))
 	}
 }
+
+func TestRegistryPushTarget(t *testing.T) {
+	tests := map[string]string{
+		"nginx":                          "localhost:5000/nginx:latest",
+		"nginx:1.25":                     "localhost:5000/nginx:1.25",
+		"rancher/k3s:v1.29.1-k3s1":       "localhost:5000/rancher/k3s:v1.29.1-k3s1",
+		"ghcr.io/k3d-io/k3d-proxy:5.6.0": "localhost:5000/k3d-io/k3d-proxy:5.6.0",
+		"k3d-myregistry:5000/myapp:v0.1": "localhost:5000/myapp:v0.1",
+		"quay.io/library/something:tag":  "localhost:5000/library/something:tag",
+	}
+	for image, expected := range tests {
+		target, err := registryPushTarget("localhost:5000", image)
+		if err != nil {
+			t.Errorf("failed to get push target for image '%s': %v", image, err)
+			continue
+		}
+		if target != expected {
+			t.Errorf("expected push target for image '%s' to be '%s', got '%s'", image, expected, target)
+		}
+	}
+}
+
+func TestRegistryMirrorName(t *testing.T) {
+	tests := map[string][2]string{ // upstream -> [remote URL, mirror name]
+		"docker.io":                    {"https://registry-1.docker.io", "docker.io"},
+		"https://registry-1.docker.io": {"https://registry-1.docker.io", "docker.io"},
+		"https://index.docker.io/":     {"https://index.docker.io/", "docker.io"},
+		"ghcr.io":                      {"https://ghcr.io", "ghcr.io"},
+		"registry.k8s.io/":             {"https://registry.k8s.io", "registry.k8s.io"},
+		"http://myregistry:5000":       {"http://myregistry:5000", "myregistry:5000"},
+	}
+	for upstream, expected := range tests {
+		remoteURL := RegistryMirrorRemoteURL(upstream)
+		if remoteURL != expected[0] {
+			t.Errorf("expected remote URL for '%s' to be '%s', got '%s'", upstream, expected[0], remoteURL)
+		}
+		if name := RegistryMirrorName(remoteURL); name != expected[1] {
+			t.Errorf("expected mirror name for '%s' to be '%s', got '%s'", remoteURL, expected[1], name)
+		}
+	}
+}
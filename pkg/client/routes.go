@@ -0,0 +1,230 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/docker/go-connections/nat"
+
+	"github.com/k3d-io/k3d/v5/pkg/actions"
+	config "github.com/k3d-io/k3d/v5/pkg/config/v1alpha5"
+	"github.com/k3d-io/k3d/v5/pkg/runtimes"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+	"github.com/k3d-io/k3d/v5/pkg/util"
+)
+
+// defaultRouteNodeFilters are used for routes without node filters, as k3s serves ingress and service ports on all nodes
+var defaultRouteNodeFilters = []string{"server:*", "agent:*"}
+
+// routeHostRegexp matches hostnames, optionally with a leading wildcard label (e.g. *.example.com)
+var routeHostRegexp = regexp.MustCompile(`^(\*\.)?[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?)*$`)
+
+// TransformLoadbalancerRoutes adds HTTP(S) routes to the cluster's loadbalancer: the routes become part of its config,
+// the ports they're served on get exposed and TLS certificates are copied into the loadbalancer.
+// Relative certificate paths are resolved against the config file.
+func TransformLoadbalancerRoutes(ctx context.Context, runtime runtimes.Runtime, cluster *k3d.Cluster, routes []config.LoadbalancerRouteWithNodeFilters, configFile string) error {
+	if len(routes) == 0 {
+		return nil
+	}
+	if cluster.ServerLoadBalancer == nil || cluster.ServerLoadBalancer.Node == nil || cluster.ServerLoadBalancer.Config == nil {
+		return fmt.Errorf("loadbalancer routes specified, but loadbalancer is disabled")
+	}
+	if cluster.ServerLoadBalancer.Node.LoadbalancerMode() == k3d.LoadbalancerModeNative {
+		return fmt.Errorf("loadbalancer routes specified, but the %s loadbalancer doesn't support HTTP(S) routes", k3d.LoadbalancerModeNative)
+	}
+
+	for _, route := range routes {
+		if err := loadbalancerAddRoute(cluster.ServerLoadBalancer, cluster.Nodes, route, configFile); err != nil {
+			return fmt.Errorf("failed to add loadbalancer route '%s%s': %w", route.Host, route.Path, err)
+		}
+	}
+	return nil
+}
+
+// loadbalancerAddRoute adds a single route to the loadbalancer, grouping routes by hostname and port
+func loadbalancerAddRoute(lb *k3d.Loadbalancer, nodes []*k3d.Node, route config.LoadbalancerRouteWithNodeFilters, configFile string) error {
+	if !routeHostRegexp.MatchString(route.Host) {
+		return fmt.Errorf("invalid hostname '%s'", route.Host)
+	}
+	routePath := route.Path
+	if routePath == "" {
+		routePath = "/"
+	}
+	if !strings.HasPrefix(routePath, "/") || strings.ContainsAny(routePath, " \t\n;{}") {
+		return fmt.Errorf("invalid path '%s': must start with '/' and must not contain whitespace, ';' or braces", routePath)
+	}
+	if route.Port < 1 || route.Port > 65535 {
+		return fmt.Errorf("invalid target port %d", route.Port)
+	}
+
+	useTLS := route.TLS.Cert != "" || route.TLS.Key != ""
+	if useTLS && (route.TLS.Cert == "" || route.TLS.Key == "") {
+		return fmt.Errorf("TLS termination requires both a certificate and a key")
+	}
+
+	// the port the route is served on
+	listen := route.Listen
+	if listen == "" {
+		listen = strconv.Itoa(k3d.DefaultLoadbalancerHTTPPort)
+		if useTLS {
+			listen = strconv.Itoa(k3d.DefaultLoadbalancerHTTPSPort)
+		}
+	}
+	portmappings, err := nat.ParsePortSpec(listen)
+	if err != nil {
+		return fmt.Errorf("error parsing listen spec '%s': %w", listen, err)
+	}
+	if len(portmappings) != 1 || portmappings[0].Port.Proto() != "tcp" {
+		return fmt.Errorf("invalid listen spec '%s': routes are served on a single TCP port", listen)
+	}
+	portmapping := portmappings[0]
+	listenPort := portmapping.Port.Int()
+	if listenPort == k3d.DefaultLoadbalancerStatusPort {
+		return fmt.Errorf("port %d of the loadbalancer is reserved for its status endpoint", listenPort)
+	}
+	if _, ok := loadbalancerProxiedPort(lb.Config, portmapping.Port); ok {
+		return fmt.Errorf("port %d of the loadbalancer is already proxied to the nodes (layer 4)", listenPort)
+	}
+	for _, server := range lb.Config.HTTP {
+		if server.Listen == listenPort && (server.TLS != nil) != useTLS {
+			return fmt.Errorf("port %d of the loadbalancer can't serve both HTTP and HTTPS", listenPort)
+		}
+	}
+
+	// targets
+	nodeFilters := route.NodeFilters
+	if len(nodeFilters) == 0 {
+		nodeFilters = defaultRouteNodeFilters
+	}
+	targetNodes, err := util.FilterNodes(nodes, nodeFilters)
+	if err != nil {
+		return fmt.Errorf("failed to filter nodes: %w", err)
+	}
+	targets := []string{}
+	for _, node := range targetNodes {
+		if node.Role != k3d.ServerRole && node.Role != k3d.AgentRole {
+			return fmt.Errorf("routes can only target server and agent nodes, not '%s'", node.Name)
+		}
+		targets = append(targets, node.Name)
+	}
+	if len(targets) == 0 {
+		return fmt.Errorf("node filters %v don't match any node", nodeFilters)
+	}
+
+	// the virtual server for the hostname
+	var server *k3d.LoadbalancerHTTPServer
+	for i := range lb.Config.HTTP {
+		if lb.Config.HTTP[i].Host == route.Host && lb.Config.HTTP[i].Listen == listenPort {
+			server = &lb.Config.HTTP[i]
+		}
+	}
+	if server == nil {
+		lb.Config.HTTP = append(lb.Config.HTTP, k3d.LoadbalancerHTTPServer{Host: route.Host, Listen: listenPort})
+		server = &lb.Config.HTTP[len(lb.Config.HTTP)-1]
+	}
+	for _, existing := range server.Routes {
+		if existing.Path == routePath {
+			return fmt.Errorf("duplicate route for path '%s' on port %d", routePath, listenPort)
+		}
+	}
+
+	if useTLS {
+		cert, err := readRouteFile(configFile, route.TLS.Cert)
+		if err != nil {
+			return fmt.Errorf("failed to read certificate: %w", err)
+		}
+		key, err := readRouteFile(configFile, route.TLS.Key)
+		if err != nil {
+			return fmt.Errorf("failed to read certificate key: %w", err)
+		}
+		base := path.Join(k3d.DefaultLoadbalancerCertsPath, fmt.Sprintf("%s.%d", strings.ReplaceAll(route.Host, "*", "_"), listenPort))
+		tls := &k3d.LoadbalancerHTTPTLS{Certificate: base + ".crt", Key: base + ".key"}
+		if server.TLS == nil {
+			server.TLS = tls
+			lb.Node.Files = append(lb.Node.Files,
+				k3d.File{Content: cert, Destination: tls.Certificate, Description: fmt.Sprintf("TLS certificate for %s", route.Host)},
+				k3d.File{Content: key, Destination: tls.Key, Description: fmt.Sprintf("TLS certificate key for %s", route.Host)},
+			)
+		} else {
+			for _, file := range lb.Node.Files {
+				if file.Destination == server.TLS.Certificate && !bytes.Equal(file.Content, cert) {
+					return fmt.Errorf("all routes for host '%s' on port %d have to use the same certificate", route.Host, listenPort)
+				}
+			}
+		}
+	}
+
+	server.Routes = append(server.Routes, k3d.LoadbalancerHTTPRoute{Path: routePath, Port: route.Port, Nodes: targets})
+
+	// expose the port, unless it's exposed already (without a specific host port, any existing binding will do)
+	for _, binding := range lb.Node.Ports[portmapping.Port] {
+		if util.IsPortBindingEqual(binding, portmapping.Binding) || portmapping.Binding.HostPort == "" {
+			return nil
+		}
+	}
+	addPortMappings(lb.Node, []nat.PortMapping{portmapping})
+
+	return nil
+}
+
+// readRouteFile reads a certificate (or key), which can be embedded in the config file or referenced by path
+func readRouteFile(configFile, source string) ([]byte, error) {
+	if filepath.IsAbs(source) {
+		return os.ReadFile(source)
+	}
+	return util.ReadFileSource(configFile, source)
+}
+
+// loadbalancerHTTPPorts returns the ports of the loadbalancer that serve HTTP(S) routes
+func loadbalancerHTTPPorts(lbConfig *k3d.LoadbalancerConfig) map[string]bool {
+	ports := map[string]bool{}
+	if lbConfig == nil {
+		return ports
+	}
+	for _, server := range lbConfig.HTTP {
+		ports[fmt.Sprintf("%d/tcp", server.Listen)] = true
+	}
+	return ports
+}
+
+// loadbalancerKeepCertificates carries the TLS certificates of the HTTP(S) routes over to a replacement loadbalancer,
+// as they're not part of the loadbalancer image
+func loadbalancerKeepCertificates(runtime runtimes.Runtime, existing, replacement *k3d.Node) {
+	replacement.HookActions = append(replacement.HookActions, k3d.NodeHook{
+		Stage: k3d.LifecycleStagePreStart,
+		Action: actions.CopyFromNodeAction{
+			Runtime:     runtime,
+			Source:      existing, // NodeReplace renames this node before the new one is started
+			Paths:       []string{k3d.DefaultLoadbalancerCertsPath},
+			Description: "Carry over TLS certificates from the replaced loadbalancer",
+		},
+	})
+}
@@ -0,0 +1,127 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package client_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/docker/go-connections/nat"
+
+	"github.com/k3d-io/k3d/v5/pkg/client"
+	"github.com/k3d-io/k3d/v5/pkg/config"
+	conf "github.com/k3d-io/k3d/v5/pkg/config/v1alpha5"
+	"github.com/k3d-io/k3d/v5/pkg/runtimes/fake"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+func TestFakeRuntimeLoadbalancerRoutes(t *testing.T) {
+	ctx := context.Background()
+	rt := fake.NewRuntime()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "tls.crt"), []byte("certificate"), 0600); err != nil {
+		t.Fatalf("failed to write certificate: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "tls.key"), []byte("key"), 0600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+
+	simpleCfg := conf.SimpleConfig{Servers: 1, Agents: 2}
+	simpleCfg.Name = "test"
+	simpleCfg.Options.K3dOptions.Loadbalancer.Routes = []conf.LoadbalancerRouteWithNodeFilters{
+		{Host: "app.localhost", Port: 30080, Listen: "8080:80", NodeFilters: []string{"agent:*"}},
+		{Host: "app.localhost", Path: "/api", Port: 30081, Listen: "8080:80", NodeFilters: []string{"agent:1"}},
+		{Host: "secure.localhost", Port: 30443, TLS: conf.LoadbalancerRouteTLS{Cert: "tls.crt", Key: "tls.key"}},
+	}
+	clusterCfg, err := config.TransformSimpleToClusterConfig(ctx, rt, simpleCfg, filepath.Join(dir, "config.yaml"))
+	if err != nil {
+		t.Fatalf("failed to transform simple config: %v", err)
+	}
+	if err := client.ClusterRun(ctx, rt, clusterCfg); err != nil {
+		t.Fatalf("failed to run cluster: %v", err)
+	}
+
+	cluster, err := client.ClusterGet(ctx, rt, &k3d.Cluster{Name: "test"})
+	if err != nil {
+		t.Fatalf("failed to get cluster: %v", err)
+	}
+	lb := cluster.ServerLoadBalancer.Node
+	for _, port := range []nat.Port{"80/tcp", "443/tcp"} {
+		if _, ok := lb.Ports[port]; !ok {
+			t.Errorf("expected loadbalancer to expose port %s, got %v", port, lb.Ports)
+		}
+	}
+
+	lbConfig, err := client.GetLoadbalancerConfig(ctx, rt, cluster)
+	if err != nil {
+		t.Fatalf("failed to get loadbalancer config: %v", err)
+	}
+	if len(lbConfig.HTTP) != 2 {
+		t.Fatalf("expected 2 virtual servers in the loadbalancer config, got %+v", lbConfig.HTTP)
+	}
+	if routes := lbConfig.HTTP[0].Routes; len(routes) != 2 || routes[1].Path != "/api" || !reflect.DeepEqual(routes[1].Nodes, []string{"k3d-test-agent-1"}) {
+		t.Errorf("expected two routes for app.localhost, got %+v", routes)
+	}
+	if _, ok := lbConfig.Ports["80.tcp"]; ok {
+		t.Errorf("expected port 80 not to be proxied on layer 4, got %v", lbConfig.Ports)
+	}
+	tls := lbConfig.HTTP[1].TLS
+	if tls == nil || lbConfig.HTTP[1].Listen != k3d.DefaultLoadbalancerHTTPSPort {
+		t.Fatalf("expected secure.localhost to be served with TLS on port %d, got %+v", k3d.DefaultLoadbalancerHTTPSPort, lbConfig.HTTP[1])
+	}
+	if cert, _ := rt.ReadFile(lb.Name, tls.Certificate); string(cert) != "certificate" {
+		t.Errorf("expected certificate to be written to %s, got '%s'", tls.Certificate, cert)
+	}
+
+	// replacing the loadbalancer keeps the routes and the certificates
+	changeset := &conf.SimpleConfig{
+		Ports: []conf.PortWithNodeFilters{{Port: "9090:90", NodeFilters: []string{"agent:0"}}},
+	}
+	if err := client.ClusterEditChangesetSimple(ctx, rt, cluster, changeset); err != nil {
+		t.Fatalf("failed to edit cluster: %v", err)
+	}
+	cluster, err = client.ClusterGet(ctx, rt, &k3d.Cluster{Name: "test"})
+	if err != nil {
+		t.Fatalf("failed to get cluster: %v", err)
+	}
+	lbConfig, err = client.GetLoadbalancerConfig(ctx, rt, cluster)
+	if err != nil {
+		t.Fatalf("failed to get loadbalancer config: %v", err)
+	}
+	if len(lbConfig.HTTP) != 2 {
+		t.Errorf("expected routes to be kept when replacing the loadbalancer, got %+v", lbConfig.HTTP)
+	}
+	if key, _ := rt.ReadFile(cluster.ServerLoadBalancer.Node.Name, tls.Key); string(key) != "key" {
+		t.Errorf("expected certificate key to be carried over to the replaced loadbalancer, got '%s'", key)
+	}
+
+	// a port can't be proxied on layer 4 and serve routes at the same time
+	simpleCfg.Ports = []conf.PortWithNodeFilters{{Port: "80", NodeFilters: []string{"loadbalancer"}}}
+	if _, err := config.TransformSimpleToClusterConfig(ctx, rt, simpleCfg, filepath.Join(dir, "config.yaml")); err == nil {
+		t.Errorf("expected an error for a route on a port that's proxied on layer 4")
+	}
+}
@@ -0,0 +1,172 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package client
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	l "github.com/k3d-io/k3d/v5/pkg/logger"
+	k3drt "github.com/k3d-io/k3d/v5/pkg/runtimes"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+// ClusterScale adds or removes server and agent nodes, so that the cluster has the requested number of them.
+// Only roles with a requested number are scaled, servers first.
+func ClusterScale(ctx context.Context, runtime k3drt.Runtime, cluster *k3d.Cluster, opts k3d.ClusterScaleOpts) error {
+	if opts.Servers != nil {
+		if err := clusterScaleRole(ctx, runtime, cluster.Name, k3d.ServerRole, *opts.Servers); err != nil {
+			return fmt.Errorf("failed to scale servers: %w", err)
+		}
+	}
+	if opts.Agents != nil {
+		if err := clusterScaleRole(ctx, runtime, cluster.Name, k3d.AgentRole, *opts.Agents); err != nil {
+			return fmt.Errorf("failed to scale agents: %w", err)
+		}
+	}
+	return nil
+}
+
+// clusterScaleRole adds or removes nodes of the given role until the cluster has the target number of them.
+// New nodes are copies of an existing node (like `k3d node create`), while the highest-numbered nodes are removed
+// after draining them and deleting them from Kubernetes (which also removes the etcd member of a server).
+// The server loadbalancer is updated afterwards.
+func clusterScaleRole(ctx context.Context, runtime k3drt.Runtime, clusterName string, role k3d.Role, target int) error {
+	cluster, err := ClusterGet(ctx, runtime, &k3d.Cluster{Name: clusterName})
+	if err != nil {
+		return fmt.Errorf("failed to get cluster '%s': %w", clusterName, err)
+	}
+
+	nodes := NodeFilterByRoles(cluster.Nodes, []k3d.Role{role}, nil)
+	sort.SliceStable(nodes, func(i, j int) bool {
+		if len(nodes[i].Name) != len(nodes[j].Name) {
+			return len(nodes[i].Name) < len(nodes[j].Name)
+		}
+		return nodes[i].Name < nodes[j].Name
+	})
+
+	switch {
+	case target == len(nodes):
+		return nil
+	case target < 0, role == k3d.ServerRole && target == 0:
+		return fmt.Errorf("invalid number of %s nodes: %d", role, target)
+	case target > len(nodes):
+		if role == k3d.ServerRole {
+			manifest, err := ClusterSnapshotManifest(ctx, runtime, cluster)
+			if err != nil {
+				return fmt.Errorf("failed to describe cluster '%s': %w", cluster.Name, err)
+			}
+			if manifest.Datastore == k3d.ClusterSnapshotDatastoreSQLite {
+				return fmt.Errorf("cannot add servers to cluster '%s': it doesn't use embedded etcd (it was created with a single server)", cluster.Name)
+			}
+		}
+
+		existingNames := map[string]bool{}
+		for _, node := range cluster.Nodes {
+			existingNames[node.Name] = true
+		}
+		suffix := 0
+		for i := len(nodes); i < target; i++ {
+			for existingNames[GenerateNodeName(cluster.Name, role, suffix)] {
+				suffix++
+			}
+			node := &k3d.Node{
+				Name:    GenerateNodeName(cluster.Name, role, suffix),
+				Role:    role,
+				Restart: true,
+			}
+			existingNames[node.Name] = true
+
+			l.Log().Infof("Adding %s node '%s' (%d/%d)...", role, node.Name, i+1, target)
+			current, err := ClusterGet(ctx, runtime, &k3d.Cluster{Name: cluster.Name})
+			if err != nil {
+				return fmt.Errorf("failed to get cluster '%s': %w", cluster.Name, err)
+			}
+			if err := NodeAddToCluster(ctx, runtime, node, current, k3d.NodeCreateOpts{Wait: true, ClusterToken: current.Token}); err != nil {
+				return fmt.Errorf("failed to add %s node '%s': %w", role, node.Name, err)
+			}
+		}
+	default:
+		victims := nodes[target:]
+		remaining := NodeFilterByRoles(cluster.Nodes, []k3d.Role{k3d.ServerRole}, nil)
+		if role == k3d.ServerRole {
+			remaining = nodes[:target]
+		}
+		for i := len(victims) - 1; i >= 0; i-- {
+			l.Log().Infof("Removing %s node '%s'...", role, victims[i].Name)
+			if err := nodeRemoveFromCluster(ctx, runtime, victims[i], remaining); err != nil {
+				return err
+			}
+		}
+	}
+
+	if (cluster.ServerLoadBalancer != nil && cluster.ServerLoadBalancer.Node != nil) || len(cluster.Loadbalancers) > 0 {
+		if err := UpdateLoadbalancerConfig(ctx, runtime, &k3d.Cluster{Name: cluster.Name}); err != nil {
+			return fmt.Errorf("failed to update loadbalancer: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// nodeRemoveFromCluster drains a node and deletes it from Kubernetes and the runtime, running kubectl in one of the given servers.
+// Deleting the Kubernetes node of a server makes k3s remove its etcd member, so this is done while the server is still running,
+// whereas agents are stopped first, so that they can't register again.
+func nodeRemoveFromCluster(ctx context.Context, runtime k3drt.Runtime, node *k3d.Node, servers []*k3d.Node) error {
+	var executor *k3d.Node
+	for _, server := range servers {
+		if server.Name != node.Name && server.State.Running {
+			executor = server
+			break
+		}
+	}
+
+	deleteKubernetesNode := func() {
+		if executor == nil {
+			return
+		}
+		if err := runtime.ExecInNode(ctx, executor, []string{"kubectl", "delete", "node", node.Name, "--ignore-not-found"}); err != nil {
+			l.Log().Warnf("Failed to delete Kubernetes node '%s': %v", node.Name, err)
+		}
+	}
+
+	if executor == nil {
+		l.Log().Warnf("No running server left to drain node '%s' and to remove it from Kubernetes", node.Name)
+	} else if node.State.Running {
+		drain := []string{"kubectl", "drain", node.Name, "--ignore-daemonsets", "--delete-emptydir-data", fmt.Sprintf("--timeout=%s", k3d.DefaultNodeDrainTimeout)}
+		if err := runtime.ExecInNode(ctx, executor, drain); err != nil {
+			return fmt.Errorf("failed to drain node '%s': %w", node.Name, err)
+		}
+	}
+
+	if node.Role == k3d.ServerRole {
+		deleteKubernetesNode()
+	}
+	if err := NodeDelete(ctx, runtime, node, k3d.NodeDeleteOpts{SkipLBUpdate: true}); err != nil {
+		return fmt.Errorf("failed to delete node '%s': %w", node.Name, err)
+	}
+	if node.Role != k3d.ServerRole {
+		deleteKubernetesNode()
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package client_test
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/k3d-io/k3d/v5/pkg/client"
+	conf "github.com/k3d-io/k3d/v5/pkg/config/v1alpha5"
+	"github.com/k3d-io/k3d/v5/pkg/runtimes/fake"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+func nodeCount(n int) *int {
+	return &n
+}
+
+func TestFakeRuntimeClusterScale(t *testing.T) {
+	ctx := context.Background()
+	rt := fake.NewRuntime()
+	cluster := runFakeCluster(t, rt, "test", 1, 1)
+
+	// expose a port on the only agent, which new agents should be added to
+	changeset := &conf.SimpleConfig{Ports: []conf.PortWithNodeFilters{{Port: "8080:80", NodeFilters: []string{"agent:0"}}}}
+	if err := client.ClusterEditChangesetSimple(ctx, rt, cluster, changeset); err != nil {
+		t.Fatalf("failed to edit cluster: %v", err)
+	}
+
+	countRole := func(cluster *k3d.Cluster, role k3d.Role) int {
+		return len(client.NodeFilterByRoles(cluster.Nodes, []k3d.Role{role}, nil))
+	}
+	lbTargets := func(cluster *k3d.Cluster) []string {
+		lbConfig, err := client.GetLoadbalancerConfig(ctx, rt, cluster)
+		if err != nil {
+			t.Fatalf("failed to get loadbalancer config: %v", err)
+		}
+		targets := append([]string{}, lbConfig.Ports["80.tcp"]...)
+		sort.Strings(targets)
+		return targets
+	}
+
+	// scale up
+	if err := client.ClusterScale(ctx, rt, &k3d.Cluster{Name: "test"}, k3d.ClusterScaleOpts{Servers: nodeCount(1), Agents: nodeCount(3)}); err != nil {
+		t.Fatalf("failed to scale up: %v", err)
+	}
+	scaled, err := client.ClusterGet(ctx, rt, &k3d.Cluster{Name: "test"})
+	if err != nil {
+		t.Fatalf("failed to get cluster: %v", err)
+	}
+	if countRole(scaled, k3d.AgentRole) != 3 {
+		t.Fatalf("expected 3 agents after scaling up, got %d", countRole(scaled, k3d.AgentRole))
+	}
+	if targets := lbTargets(scaled); !reflect.DeepEqual(targets, []string{"k3d-test-agent-0", "k3d-test-agent-1", "k3d-test-agent-2"}) {
+		t.Errorf("expected port 80 to be proxied to all agents, got %v", targets)
+	}
+
+	// scale down: the highest-numbered agents are drained and removed
+	if err := client.ClusterScale(ctx, rt, &k3d.Cluster{Name: "test"}, k3d.ClusterScaleOpts{Servers: nodeCount(1), Agents: nodeCount(1)}); err != nil {
+		t.Fatalf("failed to scale down: %v", err)
+	}
+	scaled, err = client.ClusterGet(ctx, rt, &k3d.Cluster{Name: "test"})
+	if err != nil {
+		t.Fatalf("failed to get cluster: %v", err)
+	}
+	if agents := client.NodeFilterByRoles(scaled.Nodes, []k3d.Role{k3d.AgentRole}, nil); len(agents) != 1 || agents[0].Name != "k3d-test-agent-0" {
+		t.Fatalf("expected only agent 0 to be left, got %d agents", len(agents))
+	}
+	if targets := lbTargets(scaled); !reflect.DeepEqual(targets, []string{"k3d-test-agent-0"}) {
+		t.Errorf("expected port 80 to be proxied to the remaining agent, got %v", targets)
+	}
+	drained := []string{}
+	for _, cmd := range rt.ExecHistory("k3d-test-server-0") {
+		if len(cmd) > 2 && cmd[0] == "kubectl" && cmd[1] == "drain" {
+			drained = append(drained, cmd[2])
+		}
+	}
+	if !reflect.DeepEqual(drained, []string{"k3d-test-agent-2", "k3d-test-agent-1"}) {
+		t.Errorf("expected agents 2 and 1 to be drained, got %v", drained)
+	}
+
+	// a single server cluster uses sqlite, so servers can't be added
+	if err := client.ClusterScale(ctx, rt, &k3d.Cluster{Name: "test"}, k3d.ClusterScaleOpts{Servers: nodeCount(3), Agents: nodeCount(1)}); err == nil {
+		t.Errorf("expected adding servers to a sqlite cluster to fail")
+	}
+}
+
+func TestFakeRuntimeClusterScaleSingleRole(t *testing.T) {
+	ctx := context.Background()
+	rt := fake.NewRuntime()
+	runFakeCluster(t, rt, "test", 1, 2)
+
+	// only servers are given, so the agents are left untouched
+	if err := client.ClusterScale(ctx, rt, &k3d.Cluster{Name: "test"}, k3d.ClusterScaleOpts{Servers: nodeCount(1)}); err != nil {
+		t.Fatalf("failed to scale servers: %v", err)
+	}
+	cluster, err := client.ClusterGet(ctx, rt, &k3d.Cluster{Name: "test"})
+	if err != nil {
+		t.Fatalf("failed to get cluster: %v", err)
+	}
+	if agents := client.NodeFilterByRoles(cluster.Nodes, []k3d.Role{k3d.AgentRole}, nil); len(agents) != 2 {
+		t.Errorf("expected both agents to survive scaling the servers, got %d agents", len(agents))
+	}
+
+	// a changeset with node counts doesn't scale the cluster
+	if err := client.ClusterEditChangesetSimple(ctx, rt, cluster, &conf.SimpleConfig{Servers: 1}); err != nil {
+		t.Fatalf("failed to edit cluster: %v", err)
+	}
+	if cluster, err = client.ClusterGet(ctx, rt, &k3d.Cluster{Name: "test"}); err != nil {
+		t.Fatalf("failed to get cluster: %v", err)
+	}
+	if agents := client.NodeFilterByRoles(cluster.Nodes, []k3d.Role{k3d.AgentRole}, nil); len(agents) != 2 {
+		t.Errorf("expected both agents to survive editing the cluster, got %d agents", len(agents))
+	}
+}
@@ -0,0 +1,975 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package client
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/go-connections/nat"
+	dockerunits "github.com/docker/go-units"
+	"k8s.io/utils/strings/slices"
+	"sigs.k8s.io/yaml"
+
+	"github.com/k3d-io/k3d/v5/pkg/actions"
+	config "github.com/k3d-io/k3d/v5/pkg/config/v1alpha5"
+	l "github.com/k3d-io/k3d/v5/pkg/logger"
+	k3drt "github.com/k3d-io/k3d/v5/pkg/runtimes"
+	runtimeErr "github.com/k3d-io/k3d/v5/pkg/runtimes/errors"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+	"github.com/k3d-io/k3d/v5/pkg/types/fixes"
+	"github.com/k3d-io/k3d/v5/pkg/types/k3s"
+	"github.com/k3d-io/k3d/v5/pkg/util"
+	"github.com/k3d-io/k3d/v5/version"
+)
+
+const (
+	snapshotNodesDir  = "nodes"  // archive directory holding the files captured from each node (nodes/<node>/<path>)
+	snapshotImagesDir = "images" // archive directory holding the contents of the image volume
+
+	k3sServerDataPath   = "/var/lib/rancher/k3s/server"
+	k3sNodePasswordPath = "/etc/rancher/node/password"
+
+	etcdSnapshotDir         = k3sServerDataPath + "/db/k3d-snapshot"
+	etcdSnapshotName        = "k3d-snapshot"
+	etcdRestorePath         = k3sServerDataPath + "/db/k3d-restore/snapshot"
+	etcdRestoreEntrypoint   = "/bin/k3d-entrypoint-restore.sh"
+	k3dEntrypointScriptPath = "/bin/k3d-entrypoint.sh"
+)
+
+// k3sImageEnvPrefixes are environment variables set by the K3s image itself, which are not part of the node spec
+var k3sImageEnvPrefixes = []string{"PATH=", "CRI_CONFIG_FILE="}
+
+// etcdRestoreScript resets the embedded etcd from the restored snapshot once, before k3s is started for the first time.
+// k3s exits after a cluster reset, so this has to happen in a separate run from the k3d entrypoint.
+var etcdRestoreScript = []byte(fmt.Sprintf(`#!/bin/sh
+
+set -o errexit
+set -o nounset
+
+SNAPSHOT="%s"
+
+[ -f "$SNAPSHOT" ] || exit 0
+
+echo "[$(date -Iseconds)] Restoring etcd from $SNAPSHOT..."
+/bin/k3s server --cluster-reset --cluster-reset-restore-path="$SNAPSHOT"
+rm -rf "$(dirname "$SNAPSHOT")"
+echo "[$(date -Iseconds)] Restored etcd from snapshot"
+`, etcdRestorePath))
+
+// snapshotFile is a regular file captured from a node
+type snapshotFile struct {
+	Path    string
+	Mode    int64
+	Content []byte
+}
+
+// snapshotRestoreFile is a file of a snapshot archive, which was extracted to the host to be restored to a node
+type snapshotRestoreFile struct {
+	Path string // path on the node
+	Mode int64
+	Src  string // path of the extracted file on the host
+}
+
+// ClusterSnapshot writes a snapshot of the cluster as gzipped tar archive to w.
+// It contains the k3s datastore, the state that k3s keeps on the nodes (TLS material, node passwords),
+// the loadbalancer configuration and (optionally) the contents of the image volume.
+func ClusterSnapshot(ctx context.Context, runtime k3drt.Runtime, cluster *k3d.Cluster, w io.Writer, opts k3d.ClusterSnapshotOpts) (*k3d.ClusterSnapshot, error) {
+	cluster, err := ClusterGet(ctx, runtime, cluster)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cluster: %w", err)
+	}
+
+	snapshot, err := ClusterSnapshotManifest(ctx, runtime, cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	gzipWriter := gzip.NewWriter(w)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	if err := snapshotWriteNodeFiles(ctx, runtime, cluster, snapshot, tarWriter); err != nil {
+		return nil, err
+	}
+
+	if opts.IncludeImages && snapshot.ImageVolume {
+		if err := snapshotWriteImages(ctx, runtime, cluster, tarWriter); err != nil {
+			return nil, err
+		}
+	}
+
+	// the manifest lists the files captured from the nodes, which are streamed into the archive beforehand
+	manifest, err := yaml.Marshal(snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal snapshot manifest: %w", err)
+	}
+	if err := writeTarFile(tarWriter, k3d.ClusterSnapshotManifestName, 0644, manifest); err != nil {
+		return nil, err
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close snapshot archive: %w", err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close snapshot archive: %w", err)
+	}
+
+	return snapshot, nil
+}
+
+// ClusterSnapshotManifest describes an existing cluster (as returned by ClusterGet) in a way that allows to recreate it.
+// It does not capture any files from the nodes.
+func ClusterSnapshotManifest(ctx context.Context, runtime k3drt.Runtime, cluster *k3d.Cluster) (*k3d.ClusterSnapshot, error) {
+	snapshot := &k3d.ClusterSnapshot{
+		K3dVersion:  version.GetVersion(),
+		Created:     time.Now().UTC(),
+		Name:        cluster.Name,
+		Token:       cluster.Token,
+		Network:     k3d.ClusterSnapshotNetwork{Name: cluster.Network.Name, External: cluster.Network.External},
+		ImageVolume: cluster.ImageVolume != "",
+		Datastore:   k3d.ClusterSnapshotDatastoreSQLite,
+	}
+
+	startOpts, err := GetClusterStartOptsFromLabels(cluster)
+	if err != nil {
+		return nil, err
+	}
+	snapshot.HostAliases = startOpts.HostAliases
+
+	nodes := NodeFilterByRoles(cluster.Nodes, []k3d.Role{k3d.ServerRole, k3d.AgentRole}, nil)
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].Role != nodes[j].Role {
+			return nodes[i].Role == k3d.ServerRole
+		}
+		return nodes[i].Name < nodes[j].Name
+	})
+
+	servers := []*k3d.Node{}
+	for _, node := range nodes {
+		if node.Role == k3d.ServerRole {
+			servers = append(servers, node)
+			if snapshot.KubeAPI.HostPort == "" {
+				snapshot.KubeAPI = k3d.ClusterSnapshotKubeAPI{
+					Host:     node.RuntimeLabels[k3d.LabelServerAPIHost],
+					HostIP:   node.RuntimeLabels[k3d.LabelServerAPIHostIP],
+					HostPort: node.RuntimeLabels[k3d.LabelServerAPIPort],
+				}
+			}
+			if node.RuntimeLabels[k3d.LabelNodeStaticIP] != "" {
+				snapshot.Network.Managed = true
+			}
+			for _, arg := range node.Cmd {
+				if strings.HasPrefix(arg, "--datastore-endpoint") {
+					snapshot.Datastore = k3d.ClusterSnapshotDatastoreExternal
+				}
+			}
+			if node.ServerOpts.IsInit && snapshot.Datastore != k3d.ClusterSnapshotDatastoreExternal {
+				snapshot.Datastore = k3d.ClusterSnapshotDatastoreEtcd
+			}
+		}
+		if snapshot.Network.Subnet == "" {
+			snapshot.Network.Subnet = node.RuntimeLabels[k3d.LabelNetworkIPRange]
+		}
+		snapshot.Nodes = append(snapshot.Nodes, snapshotNodeFromNode(node))
+	}
+
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("cluster '%s' has no server nodes", cluster.Name)
+	}
+	if len(servers) > 1 && snapshot.Datastore == k3d.ClusterSnapshotDatastoreSQLite {
+		snapshot.Datastore = k3d.ClusterSnapshotDatastoreEtcd
+	}
+
+	// the datastore is captured from (and restored to) the initializing server, if there is one
+	datastoreNode := servers[0]
+	for _, server := range servers {
+		if server.ServerOpts.IsInit {
+			datastoreNode = server
+			break
+		}
+	}
+	if snapshot.Datastore == k3d.ClusterSnapshotDatastoreEtcd && !datastoreNode.State.Running {
+		for _, server := range servers {
+			if server.State.Running {
+				datastoreNode = server
+				break
+			}
+		}
+	}
+	snapshot.DatastoreNode = datastoreNode.Name
+
+	// the snapshot is restored to the datastore node, which therefore has to be the initializing server
+	if snapshot.Datastore == k3d.ClusterSnapshotDatastoreEtcd {
+		for i := range snapshot.Nodes {
+			snapshot.Nodes[i].IsInit = snapshot.Nodes[i].Name == snapshot.DatastoreNode
+		}
+	}
+
+	if cluster.ServerLoadBalancer != nil && cluster.ServerLoadBalancer.Node != nil && cluster.ServerLoadBalancer.Config != nil {
+		lbPorts := nat.PortMap{}
+		for port, bindings := range cluster.ServerLoadBalancer.Node.Ports {
+			if port.Port() == k3d.DefaultAPIPort { // re-added with the exposed API when restoring
+				continue
+			}
+			lbPorts[port] = bindings
+		}
+		snapshot.Loadbalancer = &k3d.ClusterSnapshotLoadbalancer{
+			Mode:   snapshotLoadbalancerMode(cluster.ServerLoadBalancer.Node),
+			Image:  cluster.ServerLoadBalancer.Node.Image,
+			Ports:  lbPorts,
+			Config: *cluster.ServerLoadBalancer.Config,
+		}
+	}
+	for _, lb := range cluster.Loadbalancers {
+		if lb.Node == nil || lb.Config == nil {
+			continue
+		}
+		snapshot.Loadbalancers = append(snapshot.Loadbalancers, k3d.ClusterSnapshotLoadbalancer{
+			Name:   lb.Node.RuntimeLabels[k3d.LabelLoadbalancerName],
+			Mode:   snapshotLoadbalancerMode(lb.Node),
+			Image:  lb.Node.Image,
+			Ports:  lb.Node.Ports,
+			Config: *lb.Config,
+		})
+	}
+
+	networkNodes, err := runtime.GetNodesInNetwork(ctx, cluster.Network.Name)
+	if err != nil {
+		l.Log().Warnf("Failed to list registries connected to network '%s': %v", cluster.Network.Name, err)
+	}
+	for _, node := range networkNodes {
+		if node.Role == k3d.RegistryRole && !slices.Contains(snapshot.Registries, node.Name) {
+			snapshot.Registries = append(snapshot.Registries, node.Name)
+		}
+	}
+	sort.Strings(snapshot.Registries)
+
+	return snapshot, nil
+}
+
+// snapshotLoadbalancerMode returns the mode of a loadbalancer, empty for the default (nginx) to keep older snapshots unchanged
+func snapshotLoadbalancerMode(lbNode *k3d.Node) k3d.LoadbalancerMode {
+	if mode := lbNode.LoadbalancerMode(); mode != k3d.LoadbalancerModeNginx {
+		return mode
+	}
+	return ""
+}
+
+// snapshotNodeFromNode strips everything from a node spec that ClusterCreate and NodeCreate generate, so that the node can be created again from it
+func snapshotNodeFromNode(node *k3d.Node) k3d.ClusterSnapshotNode {
+	snapshotNode := k3d.ClusterSnapshotNode{
+		Name:   node.Name,
+		Role:   node.Role,
+		Image:  node.Image,
+		IsInit: node.ServerOpts.IsInit,
+		Ports:  node.Ports,
+	}
+	snapshotNode.RuntimeLabels = userRuntimeLabels(node.RuntimeLabels)
+
+	// args: the first element of the command is the k3s subcommand (server/agent), which is set by role
+	generatedTLSSANs := []string{node.RuntimeLabels[k3d.LabelServerAPIHost], node.RuntimeLabels[k3d.LabelServerLoadBalancer]}
+	args := node.Cmd
+	if len(args) > 0 {
+		args = args[1:]
+	}
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--tls-san" && i+1 < len(args) && slices.Contains(generatedTLSSANs, args[i+1]) {
+			i++
+			continue
+		}
+		if slices.Contains(k3d.DoNotCopyServerFlags, args[i]) {
+			continue
+		}
+		snapshotNode.Args = append(snapshotNode.Args, args[i])
+	}
+
+	for _, env := range node.Env {
+		if strings.HasPrefix(env, k3s.EnvClusterToken+"=") || strings.HasPrefix(env, k3s.EnvClusterConnectURL+"=") || slices.Contains(k3d.DefaultNodeEnv, env) {
+			continue
+		}
+		if hasAnyPrefix(env, k3sImageEnvPrefixes) {
+			continue
+		}
+		snapshotNode.Env = append(snapshotNode.Env, env)
+	}
+
+	for _, volume := range node.Volumes {
+		if strings.HasSuffix(volume, ":"+k3d.DefaultImageVolumeMountPath) {
+			continue
+		}
+		generated := false
+		for _, suffix := range util.DoNotCopyVolumeSuffices {
+			if strings.HasSuffix(volume, suffix) {
+				generated = true
+			}
+		}
+		if !generated {
+			snapshotNode.Volumes = append(snapshotNode.Volumes, volume)
+		}
+	}
+
+	snapshotNode.Memory = normalizeNodeMemory(node.Memory, true)
+	snapshotNode.CPUs = node.CPUs
+	snapshotNode.CPUSet = node.CPUSet
+
+	return snapshotNode
+}
+
+// normalizeNodeMemory converts a memory limit to bytes, rounded the way the runtime reports it, so that limits can be compared.
+// Reported limits are human readable in decimal units (e.g. 1.074GB), while configured limits use binary units (e.g. 1g).
+// No limit (empty or zero) results in an empty string.
+func normalizeNodeMemory(memory string, reported bool) string {
+	if memory == "" {
+		return ""
+	}
+	if !reported {
+		bytes, err := dockerunits.RAMInBytes(memory)
+		if err != nil {
+			return memory
+		}
+		memory = dockerunits.HumanSize(float64(bytes))
+	}
+	bytes, err := dockerunits.FromHumanSize(memory)
+	if err != nil || bytes <= 0 {
+		return ""
+	}
+	return strconv.FormatInt(bytes, 10)
+}
+
+// normalizeNodeCPUs formats a configured CPU limit (e.g. 1.50) the way the runtime reports it (e.g. 1.5), so that limits can be compared.
+func normalizeNodeCPUs(cpus string) string {
+	if cpus == "" {
+		return ""
+	}
+	nanoCPUs, err := util.ParseCPUs(cpus)
+	if err != nil {
+		return cpus
+	}
+	return util.FormatCPUs(nanoCPUs)
+}
+
+// SplitK3sArgs separates the k3s node labels (--node-label) from the other k3s args
+// and joins flags with their values (--flag value -> --flag=value), so that args can be compared and exported one by one
+func SplitK3sArgs(args []string) ([]string, []string) {
+	extraArgs := []string{}
+	labels := []string{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		hasValue := strings.HasPrefix(arg, "-") && !strings.Contains(arg, "=") && i+1 < len(args) && !strings.HasPrefix(args[i+1], "-")
+		if arg == "--node-label" && hasValue {
+			labels = append(labels, args[i+1])
+			i++
+			continue
+		}
+		if hasValue {
+			arg = fmt.Sprintf("%s=%s", arg, args[i+1])
+			i++
+		}
+		extraArgs = append(extraArgs, arg)
+	}
+	return extraArgs, labels
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// snapshotWriteNodeFiles streams the datastore and the state that k3s keeps on the nodes into the snapshot archive
+func snapshotWriteNodeFiles(ctx context.Context, runtime k3drt.Runtime, cluster *k3d.Cluster, snapshot *k3d.ClusterSnapshot, tarWriter *tar.Writer) error {
+	for i, snapshotNode := range snapshot.Nodes {
+		node := &k3d.Node{Name: snapshotNode.Name}
+		isDatastoreNode := snapshotNode.Name == snapshot.DatastoreNode
+
+		paths := []string{k3sNodePasswordPath, k3d.DefaultRegistriesFilePath}
+		if isDatastoreNode {
+			paths = append(paths, k3sServerDataPath+"/tls", k3sServerDataPath+"/cred", k3sServerDataPath+"/token")
+			if snapshot.Datastore == k3d.ClusterSnapshotDatastoreSQLite {
+				paths = append(paths, k3sServerDataPath+"/db")
+			}
+		}
+
+		// copying the SQLite database of a running server may result in a corrupt snapshot, so the server is stopped meanwhile
+		var stoppedServer *k3d.Node
+		if isDatastoreNode && snapshot.Datastore == k3d.ClusterSnapshotDatastoreSQLite {
+			for _, n := range cluster.Nodes {
+				if n.Name == node.Name && n.State.Running {
+					stoppedServer = n
+				}
+			}
+		}
+		if stoppedServer != nil {
+			l.Log().Warnf("Stopping server '%s' while copying its SQLite datastore, as a copy of the database of a running server may be corrupt: the Kubernetes API is unavailable meanwhile", node.Name)
+			if err := runtime.StopNode(ctx, stoppedServer); err != nil {
+				return fmt.Errorf("runtime failed to stop server '%s': %w", node.Name, err)
+			}
+			stoppedServer.State.Running = false
+		}
+
+		var files []string
+		var err error
+		for _, p := range paths {
+			var captured []string
+			captured, err = snapshotWriteNodePath(ctx, runtime, node, p, tarWriter, nil)
+			if err != nil {
+				if errors.Is(err, runtimeErr.ErrRuntimeFileNotFound) {
+					l.Log().Debugf("Skipping '%s' on node '%s' as it doesn't exist", p, node.Name)
+					err = nil
+					continue
+				}
+				err = fmt.Errorf("failed to capture '%s' from node '%s': %w", p, node.Name, err)
+				break
+			}
+			files = append(files, captured...)
+		}
+
+		if stoppedServer != nil {
+			if restartErr := snapshotRestartServer(ctx, runtime, cluster, stoppedServer); restartErr != nil {
+				if err != nil {
+					return fmt.Errorf("%w (also failed to restart server '%s': %v)", err, node.Name, restartErr)
+				}
+				return restartErr
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		if isDatastoreNode {
+			switch snapshot.Datastore {
+			case k3d.ClusterSnapshotDatastoreEtcd:
+				if err := snapshotWriteEtcd(ctx, runtime, node, tarWriter); err != nil {
+					return err
+				}
+				files = append(files, etcdRestorePath)
+			case k3d.ClusterSnapshotDatastoreExternal:
+				l.Log().Warnf("Cluster '%s' uses an external datastore, which is not included in the snapshot", cluster.Name)
+			}
+		}
+
+		snapshot.Nodes[i].Files = files
+	}
+
+	return nil
+}
+
+// snapshotRestartServer starts a server again, which was stopped to take a consistent copy of its datastore
+func snapshotRestartServer(ctx context.Context, runtime k3drt.Runtime, cluster *k3d.Cluster, server *k3d.Node) error {
+	l.Log().Infof("Restarting server '%s'...", server.Name)
+	envInfo, err := GatherEnvironmentInfo(ctx, runtime, cluster)
+	if err != nil {
+		return fmt.Errorf("failed to gather environment information: %w", err)
+	}
+	if err := NodeStart(ctx, runtime, server, &k3d.NodeStartOpts{Wait: true, EnvironmentInfo: envInfo}); err != nil {
+		return fmt.Errorf("failed to restart server '%s': %w", server.Name, err)
+	}
+	return nil
+}
+
+// snapshotWriteNodePath streams all regular files at the given path (file or directory) from a node into the snapshot archive
+// (as nodes/<node>/<path>) without keeping them in memory and returns their paths on the node.
+// If set, dest maps the path of a file on the node to the path it is restored to, skipping the file if it returns false.
+func snapshotWriteNodePath(ctx context.Context, runtime k3drt.Runtime, node *k3d.Node, p string, tarWriter *tar.Writer, dest func(string) (string, bool)) ([]string, error) {
+	reader, err := runtime.ReadFromNode(ctx, p, node)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	files := []string{}
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read '%s': %w", p, err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		// entries are relative to the parent directory of the requested path
+		filePath := path.Join(path.Dir(p), header.Name)
+		if dest != nil {
+			var ok bool
+			if filePath, ok = dest(filePath); !ok {
+				continue
+			}
+		}
+		name := path.Join(snapshotNodesDir, node.Name, filePath)
+		if err := tarWriter.WriteHeader(&tar.Header{Name: name, Mode: header.Mode, Size: header.Size, ModTime: header.ModTime, Typeflag: tar.TypeReg}); err != nil {
+			return nil, fmt.Errorf("failed to write tar header for '%s': %w", name, err)
+		}
+		if _, err := io.Copy(tarWriter, tarReader); err != nil {
+			return nil, fmt.Errorf("failed to write '%s' to snapshot: %w", name, err)
+		}
+		files = append(files, filePath)
+	}
+}
+
+// snapshotWriteEtcd takes an etcd snapshot on a running server node and streams it into the snapshot archive to be restored at etcdRestorePath
+func snapshotWriteEtcd(ctx context.Context, runtime k3drt.Runtime, node *k3d.Node, tarWriter *tar.Writer) error {
+	l.Log().Infof("Taking etcd snapshot on node '%s'...", node.Name)
+	cmd := fmt.Sprintf("rm -rf %[1]s && k3s etcd-snapshot save --dir %[1]s --name %[2]s", etcdSnapshotDir, etcdSnapshotName)
+	logreader, err := runtime.ExecInNodeGetLogs(ctx, node, []string{"sh", "-c", cmd})
+	if err != nil {
+		if logreader != nil {
+			if logs, readErr := io.ReadAll(logreader); readErr == nil && len(logs) > 0 {
+				l.Log().Errorf("etcd snapshot logs:\n%s", logs)
+			}
+		}
+		return fmt.Errorf("failed to take etcd snapshot on node '%s' (etcd snapshots require a running server): %w", node.Name, err)
+	}
+	defer func() {
+		if err := runtime.ExecInNode(ctx, node, []string{"rm", "-rf", etcdSnapshotDir}); err != nil {
+			l.Log().Warnf("Failed to clean up etcd snapshot directory on node '%s': %v", node.Name, err)
+		}
+	}()
+
+	found := false
+	_, err = snapshotWriteNodePath(ctx, runtime, node, etcdSnapshotDir, tarWriter, func(p string) (string, bool) {
+		if found || !strings.HasPrefix(path.Base(p), etcdSnapshotName) {
+			return "", false
+		}
+		found = true
+		return etcdRestorePath, true
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read etcd snapshot from node '%s': %w", node.Name, err)
+	}
+	if !found {
+		return fmt.Errorf("etcd snapshot not found in '%s' on node '%s'", etcdSnapshotDir, node.Name)
+	}
+	return nil
+}
+
+// snapshotWriteImages streams the contents of the image volume into the snapshot archive
+func snapshotWriteImages(ctx context.Context, runtime k3drt.Runtime, cluster *k3d.Cluster, tarWriter *tar.Writer) error {
+	var node *k3d.Node
+	for _, n := range cluster.Nodes {
+		if n.Role == k3d.ServerRole || n.Role == k3d.AgentRole {
+			node = n
+			break
+		}
+	}
+	if node == nil {
+		return nil
+	}
+
+	reader, err := runtime.ReadFromNode(ctx, k3d.DefaultImageVolumeMountPath, node)
+	if err != nil {
+		if errors.Is(err, runtimeErr.ErrRuntimeFileNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to read image volume from node '%s': %w", node.Name, err)
+	}
+	defer reader.Close()
+
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read image volume contents: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := strings.TrimPrefix(strings.TrimPrefix(header.Name, path.Base(k3d.DefaultImageVolumeMountPath)), "/")
+		l.Log().Infof("Adding image tarball '%s' to snapshot", name)
+		if err := tarWriter.WriteHeader(&tar.Header{Name: path.Join(snapshotImagesDir, name), Mode: header.Mode, Size: header.Size, ModTime: header.ModTime, Typeflag: tar.TypeReg}); err != nil {
+			return fmt.Errorf("failed to write tar header: %w", err)
+		}
+		if _, err := io.Copy(tarWriter, tarReader); err != nil {
+			return fmt.Errorf("failed to write image tarball '%s' to snapshot: %w", name, err)
+		}
+	}
+}
+
+// readNodeFiles reads all regular files at the given path (file or directory) from a node
+func readNodeFiles(ctx context.Context, runtime k3drt.Runtime, node *k3d.Node, p string) ([]snapshotFile, error) {
+	reader, err := runtime.ReadFromNode(ctx, p, node)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	files := []snapshotFile{}
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read '%s': %w", p, err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		content, err := io.ReadAll(tarReader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read '%s': %w", header.Name, err)
+		}
+		// entries are relative to the parent directory of the requested path
+		files = append(files, snapshotFile{Path: path.Join(path.Dir(p), header.Name), Mode: header.Mode, Content: content})
+	}
+}
+
+func writeTarFile(tarWriter *tar.Writer, name string, mode int64, content []byte) error {
+	if err := tarWriter.WriteHeader(&tar.Header{Name: name, Mode: mode, Size: int64(len(content)), ModTime: time.Now(), Typeflag: tar.TypeReg}); err != nil {
+		return fmt.Errorf("failed to write tar header for '%s': %w", name, err)
+	}
+	if _, err := tarWriter.Write(content); err != nil {
+		return fmt.Errorf("failed to write '%s' to archive: %w", name, err)
+	}
+	return nil
+}
+
+// ClusterRestore recreates a cluster from a snapshot archive written by ClusterSnapshot using ClusterRun.
+// The returned cluster config can be used to roll back if the restore failed.
+func ClusterRestore(ctx context.Context, runtime k3drt.Runtime, r io.Reader, opts k3d.ClusterRestoreOpts) (*config.ClusterConfig, error) {
+	// the archive is extracted to disk, so that the node files and images don't have to be kept in memory
+	extractDir, err := os.MkdirTemp("", "k3d-restore-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory for the snapshot contents: %w", err)
+	}
+	defer os.RemoveAll(extractDir)
+	imagesDir := filepath.Join(extractDir, snapshotImagesDir)
+
+	snapshot, nodeFiles, images, err := readSnapshotArchive(r, extractDir)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := ClusterGet(ctx, runtime, &k3d.Cluster{Name: snapshot.Name}); err == nil {
+		return nil, fmt.Errorf("cannot restore cluster '%s' because a cluster with that name already exists", snapshot.Name)
+	}
+
+	clusterConfig, err := clusterConfigFromSnapshot(ctx, runtime, snapshot, nodeFiles, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	l.Log().Infof("Restoring cluster '%s' from snapshot taken at %s", snapshot.Name, snapshot.Created.Format(time.RFC3339))
+	if err := ClusterRun(ctx, runtime, clusterConfig); err != nil {
+		return clusterConfig, err
+	}
+
+	if len(images) > 0 {
+		if err := restoreImages(ctx, runtime, &clusterConfig.Cluster, imagesDir, images); err != nil {
+			return clusterConfig, err
+		}
+	}
+
+	return clusterConfig, nil
+}
+
+// readSnapshotArchive reads the manifest from a snapshot archive and extracts the node files and images to extractDir
+func readSnapshotArchive(r io.Reader, extractDir string) (*k3d.ClusterSnapshot, map[string][]snapshotRestoreFile, []string, error) {
+	gzipReader, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to read snapshot archive: %w", err)
+	}
+	defer gzipReader.Close()
+
+	var snapshot *k3d.ClusterSnapshot
+	nodeFiles := map[string][]snapshotRestoreFile{}
+	images := []string{}
+	imagesDir := filepath.Join(extractDir, snapshotImagesDir)
+	nodesDir := filepath.Join(extractDir, snapshotNodesDir)
+
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to read snapshot archive: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := path.Clean(header.Name)
+		switch {
+		case name == k3d.ClusterSnapshotManifestName:
+			content, err := io.ReadAll(tarReader)
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("failed to read snapshot manifest: %w", err)
+			}
+			snapshot = &k3d.ClusterSnapshot{}
+			if err := yaml.Unmarshal(content, snapshot); err != nil {
+				return nil, nil, nil, fmt.Errorf("failed to unmarshal snapshot manifest: %w", err)
+			}
+		case strings.HasPrefix(name, snapshotNodesDir+"/"):
+			nodeName, filePath, found := strings.Cut(strings.TrimPrefix(name, snapshotNodesDir+"/"), "/")
+			if !found {
+				continue
+			}
+			dest := filepath.Join(nodesDir, filepath.FromSlash(strings.TrimPrefix(name, snapshotNodesDir+"/")))
+			if !strings.HasPrefix(dest, filepath.Clean(nodesDir)+string(os.PathSeparator)) {
+				return nil, nil, nil, fmt.Errorf("invalid node file path '%s' in snapshot", name)
+			}
+			if err := extractFile(tarReader, dest, header.Mode); err != nil {
+				return nil, nil, nil, err
+			}
+			nodeFiles[nodeName] = append(nodeFiles[nodeName], snapshotRestoreFile{Path: "/" + filePath, Mode: header.Mode, Src: dest})
+		case strings.HasPrefix(name, snapshotImagesDir+"/"):
+			image := strings.TrimPrefix(name, snapshotImagesDir+"/")
+			dest := filepath.Join(imagesDir, filepath.FromSlash(image))
+			if !strings.HasPrefix(dest, filepath.Clean(imagesDir)+string(os.PathSeparator)) {
+				return nil, nil, nil, fmt.Errorf("invalid image path '%s' in snapshot", name)
+			}
+			if err := extractFile(tarReader, dest, header.Mode); err != nil {
+				return nil, nil, nil, err
+			}
+			images = append(images, image)
+		}
+	}
+
+	if snapshot == nil {
+		return nil, nil, nil, fmt.Errorf("invalid snapshot archive: missing %s", k3d.ClusterSnapshotManifestName)
+	}
+	return snapshot, nodeFiles, images, nil
+}
+
+func extractFile(r io.Reader, dest string, mode int64) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for '%s': %w", dest, err)
+	}
+	f, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(mode)&os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("failed to create '%s': %w", dest, err)
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, r); err != nil {
+		return fmt.Errorf("failed to extract '%s': %w", dest, err)
+	}
+	return nil
+}
+
+// clusterConfigFromSnapshot creates the cluster config to recreate the snapshotted cluster with,
+// including hooks to restore the captured files before the nodes are started
+func clusterConfigFromSnapshot(ctx context.Context, runtime k3drt.Runtime, snapshot *k3d.ClusterSnapshot, nodeFiles map[string][]snapshotRestoreFile, opts k3d.ClusterRestoreOpts) (*config.ClusterConfig, error) {
+	cluster := k3d.Cluster{
+		Name:  snapshot.Name,
+		Token: snapshot.Token,
+		Network: k3d.ClusterNetwork{
+			Name:     snapshot.Network.Name,
+			External: snapshot.Network.External,
+		},
+		KubeAPI: &k3d.ExposureOpts{
+			Host: snapshot.KubeAPI.Host,
+			PortMapping: nat.PortMapping{
+				Port: k3d.DefaultAPIPort,
+				Binding: nat.PortBinding{
+					HostIP:   snapshot.KubeAPI.HostIP,
+					HostPort: snapshot.KubeAPI.HostPort,
+				},
+			},
+		},
+		Nodes: []*k3d.Node{},
+	}
+
+	if snapshot.Network.Managed {
+		cluster.Network.IPAM.Managed = true
+		if !snapshot.Network.External && snapshot.Network.Subnet != "" {
+			subnet, err := netip.ParsePrefix(snapshot.Network.Subnet)
+			if err != nil {
+				return nil, fmt.Errorf("invalid subnet '%s' in snapshot: %w", snapshot.Network.Subnet, err)
+			}
+			cluster.Network.IPAM.IPPrefix = subnet
+		}
+	}
+
+	clusterCreateOpts := k3d.ClusterCreateOpts{
+		DisableImageVolume:  !snapshot.ImageVolume,
+		DisableLoadBalancer: snapshot.Loadbalancer == nil,
+		WaitForServer:       opts.WaitForServer,
+		Timeout:             opts.Timeout,
+		HostAliases:         snapshot.HostAliases,
+		GlobalLabels:        map[string]string{},
+		GlobalEnv:           []string{},
+	}
+
+	for _, registry := range snapshot.Registries {
+		if _, err := runtime.GetNode(ctx, &k3d.Node{Name: registry}); err != nil {
+			l.Log().Warnf("Registry '%s' was connected to the cluster, but doesn't exist anymore: %v", registry, err)
+			continue
+		}
+		clusterCreateOpts.Registries.Use = append(clusterCreateOpts.Registries.Use, &k3d.Registry{Host: registry})
+	}
+
+	for _, snapshotNode := range snapshot.Nodes {
+		node := &k3d.Node{
+			Name:       snapshotNode.Name,
+			Role:       snapshotNode.Role,
+			Image:      snapshotNode.Image,
+			Args:       append([]string{}, snapshotNode.Args...),
+			Env:        append([]string{}, snapshotNode.Env...),
+			Volumes:    append([]string{}, snapshotNode.Volumes...),
+			Ports:      snapshotNode.Ports,
+			Memory:     snapshotNode.Memory,
+			CPUs:       snapshotNode.CPUs,
+			CPUSet:     snapshotNode.CPUSet,
+			ServerOpts: k3d.ServerOpts{IsInit: snapshotNode.IsInit},
+		}
+		if len(snapshotNode.RuntimeLabels) > 0 {
+			node.RuntimeLabels = map[string]string{}
+			for k, v := range snapshotNode.RuntimeLabels {
+				node.RuntimeLabels[k] = v
+			}
+		}
+		if node.ServerOpts.IsInit {
+			cluster.InitNode = node
+		}
+
+		for _, file := range nodeFiles[node.Name] {
+			node.HookActions = append(node.HookActions, k3d.NodeHook{
+				Stage: k3d.LifecycleStagePreStart,
+				Action: actions.WriteHostFileAction{
+					Runtime:     runtime,
+					Src:         file.Src,
+					Dest:        file.Path,
+					Mode:        os.FileMode(file.Mode) & os.ModePerm,
+					Description: fmt.Sprintf("Restore %s from snapshot", file.Path),
+				},
+			})
+		}
+
+		if snapshot.Datastore == k3d.ClusterSnapshotDatastoreEtcd && node.Name == snapshot.DatastoreNode {
+			node.K3dEntrypoint = true
+			node.HookActions = append(node.HookActions,
+				k3d.NodeHook{
+					Stage: k3d.LifecycleStagePreStart,
+					Action: actions.WriteFileAction{
+						Runtime:     runtime,
+						Content:     fixes.K3DEntrypoint,
+						Dest:        k3dEntrypointScriptPath,
+						Mode:        0744,
+						Description: "Write custom k3d entrypoint script",
+					},
+				},
+				k3d.NodeHook{
+					Stage: k3d.LifecycleStagePreStart,
+					Action: actions.WriteFileAction{
+						Runtime:     runtime,
+						Content:     etcdRestoreScript,
+						Dest:        etcdRestoreEntrypoint,
+						Mode:        0744,
+						Description: "Write entrypoint script to restore etcd from snapshot",
+					},
+				},
+			)
+		}
+
+		cluster.Nodes = append(cluster.Nodes, node)
+	}
+
+	if snapshot.Loadbalancer != nil {
+		cluster.ServerLoadBalancer = k3d.NewLoadbalancer()
+		for port, bindings := range snapshot.Loadbalancer.Ports {
+			if cluster.ServerLoadBalancer.Node.Ports == nil {
+				cluster.ServerLoadBalancer.Node.Ports = nat.PortMap{}
+			}
+			cluster.ServerLoadBalancer.Node.Ports[port] = bindings
+		}
+		lbConfig := snapshot.Loadbalancer.Config
+		cluster.ServerLoadBalancer.Config = &lbConfig
+		lbNode, err := LoadbalancerPrepare(ctx, runtime, &cluster, &k3d.LoadbalancerCreateOpts{Mode: snapshot.Loadbalancer.Mode})
+		if err != nil {
+			return nil, fmt.Errorf("failed to prepare loadbalancer: %w", err)
+		}
+		if snapshot.Loadbalancer.Image != "" {
+			lbNode.Image = snapshot.Loadbalancer.Image
+		}
+		cluster.ServerLoadBalancer.Node = lbNode
+		cluster.Nodes = append(cluster.Nodes, lbNode)
+	}
+
+	for _, snapshotLB := range snapshot.Loadbalancers {
+		lb, err := LoadbalancerPrepareNamed(ctx, runtime, &cluster, snapshotLB.Name, &k3d.LoadbalancerCreateOpts{Mode: snapshotLB.Mode})
+		if err != nil {
+			return nil, fmt.Errorf("failed to prepare loadbalancer '%s': %w", snapshotLB.Name, err)
+		}
+		if snapshotLB.Image != "" {
+			lb.Node.Image = snapshotLB.Image
+		}
+		for port, bindings := range snapshotLB.Ports {
+			lb.Node.Ports[port] = bindings
+		}
+		lbConfig := snapshotLB.Config
+		lb.Config = &lbConfig
+		cluster.Loadbalancers = append(cluster.Loadbalancers, lb)
+		cluster.Nodes = append(cluster.Nodes, lb.Node)
+	}
+
+	return &config.ClusterConfig{
+		Cluster:           cluster,
+		ClusterCreateOpts: clusterCreateOpts,
+	}, nil
+}
+
+// restoreImages copies the image tarballs back into the image volume and imports them into all k3s nodes
+func restoreImages(ctx context.Context, runtime k3drt.Runtime, cluster *k3d.Cluster, imagesDir string, images []string) error {
+	nodes := NodeFilterByRoles(cluster.Nodes, []k3d.Role{k3d.ServerRole, k3d.AgentRole}, nil)
+	if len(nodes) == 0 {
+		return nil
+	}
+
+	l.Log().Infof("Restoring %d image tarball(s) to the image volume...", len(images))
+	if err := runtime.CopyToNode(ctx, imagesDir+string(os.PathSeparator)+".", k3d.DefaultImageVolumeMountPath, nodes[0]); err != nil {
+		return fmt.Errorf("failed to copy images to node '%s': %w", nodes[0].Name, err)
+	}
+
+	for _, node := range nodes {
+		for _, image := range images {
+			imagePath := path.Join(k3d.DefaultImageVolumeMountPath, image)
+			l.Log().Debugf("Importing image tarball '%s' into node '%s'...", imagePath, node.Name)
+			if err := runtime.ExecInNode(ctx, node, []string{"ctr", "image", "import", "--all-platforms", imagePath}); err != nil {
+				return fmt.Errorf("failed to import image tarball '%s' into node '%s': %w", imagePath, node.Name, err)
+			}
+		}
+	}
+	return nil
+}
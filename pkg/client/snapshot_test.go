@@ -0,0 +1,124 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package client_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/k3d-io/k3d/v5/pkg/client"
+	"github.com/k3d-io/k3d/v5/pkg/runtimes/fake"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+// datastoreReadRecorder records whether the server was running while its datastore was read
+type datastoreReadRecorder struct {
+	*fake.Runtime
+	readWhileRunning bool
+	read             bool
+}
+
+func (r *datastoreReadRecorder) ReadFromNode(ctx context.Context, filePath string, node *k3d.Node) (io.ReadCloser, error) {
+	if strings.HasSuffix(filePath, "/server/db") {
+		r.read = true
+		if running, _, err := r.GetNodeStatus(ctx, node); err == nil && running {
+			r.readWhileRunning = true
+		}
+	}
+	return r.Runtime.ReadFromNode(ctx, filePath, node)
+}
+
+func TestFakeRuntimeClusterSnapshotRestore(t *testing.T) {
+	ctx := context.Background()
+	rt := fake.NewRuntime()
+	cluster := runFakeCluster(t, rt, "test", 1, 1)
+
+	server := &k3d.Node{Name: "k3d-test-server-0"}
+	if err := rt.WriteToNode(ctx, []byte("sqlite"), "/var/lib/rancher/k3s/server/db/state.db", 0600, server); err != nil {
+		t.Fatalf("failed to write datastore: %v", err)
+	}
+	if err := rt.WriteToNode(ctx, []byte("agent-password"), "/etc/rancher/node/password", 0600, &k3d.Node{Name: "k3d-test-agent-0"}); err != nil {
+		t.Fatalf("failed to write node password: %v", err)
+	}
+
+	var archive bytes.Buffer
+	recorder := &datastoreReadRecorder{Runtime: rt}
+	snapshot, err := client.ClusterSnapshot(ctx, recorder, cluster, &archive, k3d.ClusterSnapshotOpts{IncludeImages: true})
+	if err != nil {
+		t.Fatalf("failed to snapshot cluster: %v", err)
+	}
+	if !recorder.read || recorder.readWhileRunning {
+		t.Errorf("expected the SQLite datastore to be copied while the server is stopped (read: %t, while running: %t)", recorder.read, recorder.readWhileRunning)
+	}
+	if running, _, err := rt.GetNodeStatus(ctx, server); err != nil || !running {
+		t.Errorf("expected server to be running again after the snapshot (%v)", err)
+	}
+	if !slices.Contains(snapshot.Nodes[0].Files, "/var/lib/rancher/k3s/server/db/state.db") {
+		t.Errorf("expected the datastore to be listed in the snapshot manifest, got %v", snapshot.Nodes[0].Files)
+	}
+	if snapshot.Datastore != k3d.ClusterSnapshotDatastoreSQLite || snapshot.DatastoreNode != server.Name {
+		t.Errorf("expected sqlite datastore on '%s', got %s on '%s'", server.Name, snapshot.Datastore, snapshot.DatastoreNode)
+	}
+	if len(snapshot.Nodes) != 2 {
+		t.Fatalf("expected 2 nodes in snapshot, got %d", len(snapshot.Nodes))
+	}
+
+	if err := client.ClusterDelete(ctx, rt, cluster, k3d.ClusterDeleteOpts{}); err != nil {
+		t.Fatalf("failed to delete cluster: %v", err)
+	}
+
+	if _, err := client.ClusterRestore(ctx, rt, &archive, k3d.ClusterRestoreOpts{}); err != nil {
+		t.Fatalf("failed to restore cluster: %v", err)
+	}
+
+	restored, err := client.ClusterGet(ctx, rt, &k3d.Cluster{Name: "test"})
+	if err != nil {
+		t.Fatalf("failed to get restored cluster: %v", err)
+	}
+	if len(restored.Nodes) != 3 {
+		t.Errorf("expected 3 nodes (server, agent, loadbalancer), got %d", len(restored.Nodes))
+	}
+	if restored.Token != cluster.Token {
+		t.Errorf("expected cluster token '%s' to be restored, got '%s'", cluster.Token, restored.Token)
+	}
+
+	if db, _ := rt.ReadFile(server.Name, "/var/lib/rancher/k3s/server/db/state.db"); string(db) != "sqlite" {
+		t.Errorf("expected datastore to be restored, got '%s'", db)
+	}
+	if password, _ := rt.ReadFile("k3d-test-agent-0", "/etc/rancher/node/password"); string(password) != "agent-password" {
+		t.Errorf("expected node password to be restored, got '%s'", password)
+	}
+	lbConfig, _ := rt.ReadFile(restored.ServerLoadBalancer.Node.Name, k3d.DefaultLoadbalancerConfigPath)
+	if !strings.Contains(string(lbConfig), "k3d-test-server-0") {
+		t.Errorf("expected loadbalancer config to contain the server node, got:\n%s", lbConfig)
+	}
+
+	// restoring over an existing cluster is refused
+	if _, err := client.ClusterRestore(ctx, rt, bytes.NewReader(archive.Bytes()), k3d.ClusterRestoreOpts{}); err == nil {
+		t.Errorf("expected restore to fail while the cluster exists")
+	}
+}
@@ -0,0 +1,178 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package client
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	l "github.com/k3d-io/k3d/v5/pkg/logger"
+	k3drt "github.com/k3d-io/k3d/v5/pkg/runtimes"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+// ClusterUpgrade replaces the server and agent nodes of a cluster one after another with nodes running a new image.
+// Servers are upgraded first, then agents. Each node is cordoned and drained via the cluster's kubeconfig (unless disabled),
+// replaced (keeping its volumes and k3s state) and uncordoned once it reports ready.
+// If a new node fails to start, the old node is brought back and the upgrade stops.
+func ClusterUpgrade(ctx context.Context, runtime k3drt.Runtime, cluster *k3d.Cluster, opts k3d.ClusterUpgradeOpts) error {
+	if opts.Image == "" {
+		return fmt.Errorf("no image specified to upgrade cluster '%s' to", cluster.Name)
+	}
+
+	cluster, err := ClusterGet(ctx, runtime, &k3d.Cluster{Name: cluster.Name})
+	if err != nil {
+		return fmt.Errorf("failed to get cluster: %w", err)
+	}
+
+	nodes := []*k3d.Node{}
+	for _, role := range []k3d.Role{k3d.ServerRole, k3d.AgentRole} {
+		roleNodes := NodeFilterByRoles(cluster.Nodes, []k3d.Role{role}, nil)
+		sort.SliceStable(roleNodes, func(i, j int) bool {
+			if len(roleNodes[i].Name) != len(roleNodes[j].Name) {
+				return len(roleNodes[i].Name) < len(roleNodes[j].Name)
+			}
+			return roleNodes[i].Name < roleNodes[j].Name
+		})
+		for _, node := range roleNodes {
+			if node.Image != opts.Image {
+				nodes = append(nodes, node)
+			}
+		}
+	}
+	if len(nodes) == 0 {
+		l.Log().Infof("All nodes of cluster '%s' already use image '%s'", cluster.Name, opts.Image)
+		return nil
+	}
+
+	var kube *kubeAPIClient
+	if !opts.SkipDrain {
+		kubeconfig, err := KubeconfigGet(ctx, runtime, cluster)
+		if err != nil {
+			return fmt.Errorf("failed to get kubeconfig of cluster '%s' (required to drain nodes): %w", cluster.Name, err)
+		}
+		if kube, err = newKubeAPIClient(kubeconfig); err != nil {
+			return err
+		}
+	}
+
+	envInfo, err := GatherEnvironmentInfo(ctx, runtime, cluster)
+	if err != nil {
+		return fmt.Errorf("failed to gather environment information: %w", err)
+	}
+
+	for i, node := range nodes {
+		name := node.Name
+		l.Log().Infof("Upgrading %s node '%s' (%d/%d) from '%s' to '%s'...", node.Role, name, i+1, len(nodes), node.Image, opts.Image)
+		if err := nodeUpgrade(ctx, runtime, kube, envInfo, node, opts); err != nil {
+			return fmt.Errorf("failed to upgrade node '%s' (%d/%d nodes upgraded): %w", name, i, len(nodes), err)
+		}
+	}
+
+	return nil
+}
+
+// nodeUpgrade replaces a single node with one running the new image, draining it first if a Kubernetes API client is given
+func nodeUpgrade(ctx context.Context, runtime k3drt.Runtime, kube *kubeAPIClient, envInfo *k3d.EnvironmentInfo, node *k3d.Node, opts k3d.ClusterUpgradeOpts) error {
+	name := node.Name // NodeReplace renames the existing node
+
+	if kube != nil {
+		l.Log().Infof("Draining node '%s'...", name)
+		if err := kube.NodeSetUnschedulable(ctx, name, true); err != nil {
+			return err
+		}
+		drainCtx := ctx
+		if opts.DrainTimeout > 0*time.Second {
+			var cancel context.CancelFunc
+			drainCtx, cancel = context.WithTimeout(ctx, opts.DrainTimeout)
+			defer cancel()
+		}
+		if err := kube.NodeDrain(drainCtx, name); err != nil {
+			if uncordonErr := kube.NodeSetUnschedulable(ctx, name, false); uncordonErr != nil {
+				l.Log().Warnln(uncordonErr)
+			}
+			return err
+		}
+	}
+
+	// the replacement is built from the sanitized node spec, so that generated settings (e.g. TLS SANs) don't pile up
+	spec := snapshotNodeFromNode(node)
+	replacement, err := replacementNode(node, &k3d.Node{
+		Name:          name,
+		Role:          node.Role,
+		Image:         opts.Image,
+		Args:          spec.Args,
+		Env:           spec.Env,
+		Volumes:       spec.Volumes,
+		Ports:         spec.Ports,
+		RuntimeLabels: spec.RuntimeLabels,
+		Memory:        spec.Memory,
+		CPUs:          spec.CPUs,
+		CPUSet:        spec.CPUSet,
+	})
+	if err != nil {
+		return err
+	}
+
+	// with a Kubernetes API client, the old node is kept until the new one is ready, so that the upgrade can be rolled back
+	replaceOpts := k3d.NodeReplaceOpts{EnvironmentInfo: envInfo, Timeout: opts.Timeout, KeepOldNode: kube != nil}
+	if err := nodeReplaceKeepingState(ctx, runtime, node, replacement, replaceOpts); err != nil {
+		if kube != nil {
+			if uncordonErr := kube.NodeSetUnschedulable(ctx, name, false); uncordonErr != nil {
+				l.Log().Warnln(uncordonErr)
+			}
+		}
+		return err
+	}
+
+	if kube != nil {
+		readyCtx := ctx
+		if opts.Timeout > 0*time.Second {
+			var cancel context.CancelFunc
+			readyCtx, cancel = context.WithTimeout(ctx, opts.Timeout)
+			defer cancel()
+		}
+		version, err := kube.NodeWaitForReady(readyCtx, name)
+		if err != nil {
+			l.Log().Warnf("New node '%s' did not become ready: %v", name, err)
+			if rollbackErr := NodeReplaceRollback(ctx, runtime, node, replacement, name, replaceOpts); rollbackErr != nil {
+				return fmt.Errorf("%w (rollback to the old node failed: %v)", err, rollbackErr)
+			}
+			if uncordonErr := kube.NodeSetUnschedulable(ctx, name, false); uncordonErr != nil {
+				return fmt.Errorf("%w (rolled back to the old node, but failed to uncordon it: %v)", err, uncordonErr)
+			}
+			return fmt.Errorf("%w (rolled back to the old node)", err)
+		}
+		l.Log().Infof("Deleting old node %s...", node.Name)
+		if err := NodeDelete(ctx, runtime, node, k3d.NodeDeleteOpts{SkipLBUpdate: true}); err != nil {
+			return fmt.Errorf("failed to delete old node '%s': %w", node.Name, err)
+		}
+		if err := kube.NodeSetUnschedulable(ctx, name, false); err != nil {
+			return err
+		}
+		l.Log().Infof("Node '%s' is ready (%s)", name, version)
+	}
+
+	return nil
+}
@@ -0,0 +1,149 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package client_test
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/k3d-io/k3d/v5/pkg/client"
+	"github.com/k3d-io/k3d/v5/pkg/runtimes/fake"
+	runtimeTypes "github.com/k3d-io/k3d/v5/pkg/runtimes/types"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+func TestFakeRuntimeClusterUpgrade(t *testing.T) {
+	ctx := context.Background()
+	rt := fake.NewRuntime()
+	cluster := runFakeCluster(t, rt, "test", 1, 1)
+
+	server := &k3d.Node{Name: "k3d-test-server-0"}
+	if err := rt.WriteToNode(ctx, []byte("sqlite"), "/var/lib/rancher/k3s/server/db/state.db", 0600, server); err != nil {
+		t.Fatalf("failed to write datastore: %v", err)
+	}
+
+	newImage := "rancher/k3s:v9.9.9-k3s1"
+	if err := client.ClusterUpgrade(ctx, rt, cluster, k3d.ClusterUpgradeOpts{Image: newImage, SkipDrain: true}); err != nil {
+		t.Fatalf("failed to upgrade cluster: %v", err)
+	}
+
+	upgraded, err := client.ClusterGet(ctx, rt, &k3d.Cluster{Name: cluster.Name})
+	if err != nil {
+		t.Fatalf("failed to get cluster: %v", err)
+	}
+	if len(upgraded.Nodes) != 3 {
+		t.Fatalf("expected 3 nodes (server, agent, loadbalancer), got %d", len(upgraded.Nodes))
+	}
+	for _, node := range upgraded.Nodes {
+		if node.Role == k3d.LoadBalancerRole {
+			if node.Image == newImage {
+				t.Errorf("expected loadbalancer image to stay unchanged")
+			}
+			continue
+		}
+		if node.Image != newImage {
+			t.Errorf("expected node '%s' to use image '%s', got '%s'", node.Name, newImage, node.Image)
+		}
+		if !node.State.Running {
+			t.Errorf("expected node '%s' to be running", node.Name)
+		}
+		tlsSANs := 0
+		for _, arg := range node.Cmd {
+			if arg == "--tls-san" {
+				tlsSANs++
+			}
+		}
+		if node.Role == k3d.ServerRole && tlsSANs != 2 {
+			t.Errorf("expected 2 TLS SANs on '%s' after upgrade, got command %v", node.Name, node.Cmd)
+		}
+	}
+
+	if db, _ := rt.ReadFile(server.Name, "/var/lib/rancher/k3s/server/db/state.db"); string(db) != "sqlite" {
+		t.Errorf("expected datastore to be carried over, got '%s'", db)
+	}
+
+	// upgrading to the same image again is a no-op
+	if err := client.ClusterUpgrade(ctx, rt, upgraded, k3d.ClusterUpgradeOpts{Image: newImage, SkipDrain: true}); err != nil {
+		t.Fatalf("failed to upgrade cluster again: %v", err)
+	}
+}
+
+// silentImageRuntime simulates nodes running a broken image, which never log that they're ready
+type silentImageRuntime struct {
+	*fake.Runtime
+	image string
+}
+
+func (r *silentImageRuntime) GetNodeLogs(ctx context.Context, node *k3d.Node, since time.Time, opts *runtimeTypes.NodeLogsOpts) (io.ReadCloser, error) {
+	if node.Image == r.image {
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+	return r.Runtime.GetNodeLogs(ctx, node, since, opts)
+}
+
+func TestFakeRuntimeClusterUpgradeRollback(t *testing.T) {
+	ctx := context.Background()
+	rt := fake.NewRuntime()
+	cluster := runFakeCluster(t, rt, "test", 1, 1)
+
+	agent := &k3d.Node{Name: "k3d-test-agent-0"}
+	if err := rt.WriteToNode(ctx, []byte("agent-password"), "/etc/rancher/node/password", 0600, agent); err != nil {
+		t.Fatalf("failed to write node password: %v", err)
+	}
+	oldAgent, err := client.NodeGet(ctx, rt, agent)
+	if err != nil {
+		t.Fatalf("failed to get agent: %v", err)
+	}
+
+	newImage := "rancher/k3s:v9.9.9-k3s1"
+	brokenRt := &silentImageRuntime{Runtime: rt, image: newImage}
+	err = client.ClusterUpgrade(ctx, brokenRt, cluster, k3d.ClusterUpgradeOpts{Image: newImage, SkipDrain: true, Timeout: 5 * time.Second})
+	if err == nil {
+		t.Fatalf("expected upgrade to fail for nodes that never get ready")
+	}
+
+	nodes, err := client.NodeList(ctx, rt)
+	if err != nil {
+		t.Fatalf("failed to list nodes: %v", err)
+	}
+	if len(nodes) != 3 {
+		t.Fatalf("expected the old nodes to be the only ones left (server, agent, loadbalancer), got %d", len(nodes))
+	}
+	for _, node := range nodes {
+		if node.Image == newImage {
+			t.Errorf("expected node '%s' to be rolled back to the old image", node.Name)
+		}
+		if !node.State.Running {
+			t.Errorf("expected node '%s' to be running again", node.Name)
+		}
+	}
+	if password, _ := rt.ReadFile(agent.Name, "/etc/rancher/node/password"); string(password) != "agent-password" {
+		t.Errorf("expected the old node with its state to be back, got password '%s'", password)
+	}
+	if restored, err := client.NodeGet(ctx, rt, agent); err != nil || restored.Image != oldAgent.Image {
+		t.Errorf("expected old agent to be back (%v)", err)
+	}
+}
@@ -0,0 +1,502 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package config
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker/go-connections/nat"
+
+	"github.com/k3d-io/k3d/v5/pkg/client"
+	configtypes "github.com/k3d-io/k3d/v5/pkg/config/types"
+	conf "github.com/k3d-io/k3d/v5/pkg/config/v1alpha5"
+	l "github.com/k3d-io/k3d/v5/pkg/logger"
+	"github.com/k3d-io/k3d/v5/pkg/runtimes"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+// TransformClusterToSimpleConfig transforms an existing cluster (as returned by client.ClusterGet) back into a simple configuration,
+// inferring the node filters from the nodes that each setting applies to
+func TransformClusterToSimpleConfig(ctx context.Context, runtime runtimes.Runtime, cluster *k3d.Cluster) (*conf.SimpleConfig, error) {
+	manifest, err := client.ClusterSnapshotManifest(ctx, runtime, cluster)
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe cluster '%s': %w", cluster.Name, err)
+	}
+
+	servers := []k3d.ClusterSnapshotNode{}
+	agents := []k3d.ClusterSnapshotNode{}
+	for _, node := range manifest.Nodes {
+		switch node.Role {
+		case k3d.ServerRole:
+			servers = append(servers, node)
+		case k3d.AgentRole:
+			agents = append(agents, node)
+		}
+	}
+	// node filters address nodes by their index, so we sort them like they were created (server-0, server-1, ..., server-10)
+	for _, nodes := range [][]k3d.ClusterSnapshotNode{servers, agents} {
+		sort.SliceStable(nodes, func(i, j int) bool {
+			if len(nodes[i].Name) != len(nodes[j].Name) {
+				return len(nodes[i].Name) < len(nodes[j].Name)
+			}
+			return nodes[i].Name < nodes[j].Name
+		})
+	}
+	nodes := append(append([]k3d.ClusterSnapshotNode{}, servers...), agents...)
+	filters := newNodeFilterInference(servers, agents)
+
+	simpleConfig := &conf.SimpleConfig{
+		TypeMeta: configtypes.TypeMeta{
+			Kind:       "Simple",
+			APIVersion: conf.ApiVersion,
+		},
+		ObjectMeta: configtypes.ObjectMeta{
+			Name: manifest.Name,
+		},
+		Servers:      len(servers),
+		Agents:       len(agents),
+		ClusterToken: manifest.Token,
+		ExposeAPI: conf.SimpleExposureOpts{
+			Host:     manifest.KubeAPI.Host,
+			HostIP:   manifest.KubeAPI.HostIP,
+			HostPort: manifest.KubeAPI.HostPort,
+		},
+		HostAliases: manifest.HostAliases,
+	}
+
+	if manifest.Network.External {
+		simpleConfig.Network = manifest.Network.Name
+	}
+	if manifest.Network.Managed {
+		simpleConfig.Subnet = manifest.Network.Subnet
+		if simpleConfig.Subnet == "" {
+			simpleConfig.Subnet = "auto"
+		}
+	}
+
+	// -> IMAGE & RESOURCES
+	if len(nodes) > 0 {
+		simpleConfig.Image = nodes[0].Image
+	}
+	for _, node := range nodes {
+		if node.Image != simpleConfig.Image {
+			l.Log().Warnf("Node '%s' uses image '%s' instead of '%s', which cannot be expressed in a simple config", node.Name, node.Image, simpleConfig.Image)
+		}
+	}
+	nodeMemory := func(node k3d.ClusterSnapshotNode) string { return node.Memory }
+	nodeCPUs := func(node k3d.ClusterSnapshotNode) string { return node.CPUs }
+	simpleConfig.Options.Runtime.ServersMemory = commonNodeValue(servers, "memory limits", nodeMemory)
+	simpleConfig.Options.Runtime.AgentsMemory = commonNodeValue(agents, "memory limits", nodeMemory)
+	simpleConfig.Options.Runtime.ServersCPUs = commonNodeValue(servers, "CPU limits", nodeCPUs)
+	simpleConfig.Options.Runtime.AgentsCPUs = commonNodeValue(agents, "CPU limits", nodeCPUs)
+
+	cpusets, cpusetNodes := groupNodeValues(nodes, func(node k3d.ClusterSnapshotNode) []string {
+		if node.CPUSet == "" {
+			return nil
+		}
+		return []string{node.CPUSet}
+	})
+	for _, cpuset := range cpusets {
+		simpleConfig.Options.Runtime.CPUSets = append(simpleConfig.Options.Runtime.CPUSets, conf.CPUSetWithNodeFilters{CPUSet: cpuset, NodeFilters: filters.infer(cpusetNodes[cpuset], "")})
+	}
+
+	// -> VOLUMES
+	volumes, volumeNodes := groupNodeValues(nodes, func(node k3d.ClusterSnapshotNode) []string { return node.Volumes })
+	for _, volume := range volumes {
+		simpleConfig.Volumes = append(simpleConfig.Volumes, conf.VolumeWithNodeFilters{Volume: volume, NodeFilters: filters.infer(volumeNodes[volume], "")})
+	}
+
+	// -> ENV
+	envVars, envVarNodes := groupNodeValues(nodes, func(node k3d.ClusterSnapshotNode) []string { return node.Env })
+	for _, envVar := range envVars {
+		simpleConfig.Env = append(simpleConfig.Env, conf.EnvVarWithNodeFilters{EnvVar: envVar, NodeFilters: filters.infer(envVarNodes[envVar], "")})
+	}
+
+	// -> ARGS & K3S NODE LABELS
+	nodeArgs := map[string][]string{}
+	nodeLabels := map[string][]string{}
+	for _, node := range nodes {
+		nodeArgs[node.Name], nodeLabels[node.Name] = client.SplitK3sArgs(node.Args)
+	}
+	args, argNodes := groupNodeValues(nodes, func(node k3d.ClusterSnapshotNode) []string { return nodeArgs[node.Name] })
+	for _, arg := range args {
+		simpleConfig.Options.K3sOptions.ExtraArgs = append(simpleConfig.Options.K3sOptions.ExtraArgs, conf.K3sArgWithNodeFilters{Arg: arg, NodeFilters: filters.infer(argNodes[arg], "")})
+	}
+	labels, labelNodes := groupNodeValues(nodes, func(node k3d.ClusterSnapshotNode) []string { return nodeLabels[node.Name] })
+	for _, label := range labels {
+		simpleConfig.Options.K3sOptions.NodeLabels = append(simpleConfig.Options.K3sOptions.NodeLabels, conf.LabelWithNodeFilters{Label: label, NodeFilters: filters.infer(labelNodes[label], "")})
+	}
+
+	// -> PORTS (direct)
+	ports, portNodes := groupNodeValues(nodes, func(node k3d.ClusterSnapshotNode) []string {
+		nodePorts := nat.PortMap{}
+		for port, bindings := range node.Ports {
+			if node.Role == k3d.ServerRole && port.Port() == k3d.DefaultAPIPort { // exposed via kubeAPI
+				continue
+			}
+			nodePorts[port] = bindings
+		}
+		return portSpecs(nodePorts)
+	})
+	for _, port := range ports {
+		simpleConfig.Ports = append(simpleConfig.Ports, conf.PortWithNodeFilters{Port: port, NodeFilters: filters.infer(portNodes[port], "direct")})
+	}
+
+	// -> LOADBALANCER
+	if manifest.Loadbalancer == nil {
+		simpleConfig.Options.K3dOptions.DisableLoadbalancer = true
+	} else {
+		simpleConfig.Ports = append(simpleConfig.Ports, loadbalancerPortSpecs(manifest.Loadbalancer, filters)...)
+
+		for _, server := range manifest.Loadbalancer.Config.HTTP {
+			listenPort := nat.Port(fmt.Sprintf("%d/tcp", server.Listen))
+			listen := strconv.Itoa(server.Listen)
+			if specs := portSpecs(nat.PortMap{listenPort: manifest.Loadbalancer.Ports[listenPort]}); len(specs) > 0 {
+				listen = specs[0]
+			}
+			if server.TLS != nil {
+				l.Log().Warnf("Loadbalancer routes for '%s' terminate TLS, but the certificate cannot be exported: add it to the routes as 'tls.cert' and 'tls.key'", server.Host)
+			}
+			for _, route := range server.Routes {
+				simpleConfig.Options.K3dOptions.Loadbalancer.Routes = append(simpleConfig.Options.K3dOptions.Loadbalancer.Routes, conf.LoadbalancerRouteWithNodeFilters{
+					Host:        server.Host,
+					Path:        route.Path,
+					Port:        route.Port,
+					Listen:      listen,
+					NodeFilters: filters.infer(route.Nodes, ""),
+				})
+			}
+		}
+
+		upstreamPorts := []string{}
+		for port := range manifest.Loadbalancer.Config.Settings.Upstreams {
+			upstreamPorts = append(upstreamPorts, port)
+		}
+		sort.Strings(upstreamPorts)
+		for _, port := range upstreamPorts {
+			// nodes with the same options share an entry
+			nodeOpts := manifest.Loadbalancer.Config.Settings.Upstreams[port]
+			nodeNames := []string{}
+			for nodeName := range nodeOpts {
+				nodeNames = append(nodeNames, nodeName)
+			}
+			sort.Strings(nodeNames)
+			grouped := map[string][]string{}
+			keys := []string{}
+			for _, nodeName := range nodeNames {
+				opts := nodeOpts[nodeName]
+				maxFails := "-"
+				if opts.MaxFails != nil {
+					maxFails = strconv.Itoa(*opts.MaxFails)
+				}
+				key := fmt.Sprintf("%d/%s/%s/%v/%v", opts.Weight, maxFails, opts.FailTimeout, opts.Backup, opts.Down)
+				if _, ok := grouped[key]; !ok {
+					keys = append(keys, key)
+				}
+				grouped[key] = append(grouped[key], nodeName)
+			}
+			for _, key := range keys {
+				opts := nodeOpts[grouped[key][0]]
+				simpleConfig.Options.K3dOptions.Loadbalancer.Upstreams = append(simpleConfig.Options.K3dOptions.Loadbalancer.Upstreams, conf.LoadbalancerUpstreamWithNodeFilters{
+					Port:        strings.Replace(port, ".", "/", 1),
+					Weight:      opts.Weight,
+					Backup:      opts.Backup,
+					MaxFails:    opts.MaxFails,
+					FailTimeout: opts.FailTimeout,
+					Down:        opts.Down,
+					NodeFilters: filters.infer(grouped[key], ""),
+				})
+			}
+		}
+
+		simpleConfig.Options.K3dOptions.Loadbalancer.ConfigOverrides = loadbalancerConfigOverrides(manifest.Loadbalancer.Config.Settings)
+		simpleConfig.Options.K3dOptions.Loadbalancer.Mode = string(manifest.Loadbalancer.Mode)
+	}
+
+	// -> NAMED LOADBALANCERS
+	for _, lb := range manifest.Loadbalancers {
+		// the simple config has a single mode for all loadbalancers
+		if manifest.Loadbalancer == nil && len(simpleConfig.Options.K3dOptions.Loadbalancers) == 0 {
+			simpleConfig.Options.K3dOptions.Loadbalancer.Mode = string(lb.Mode)
+		} else if lb.Mode != k3d.LoadbalancerMode(simpleConfig.Options.K3dOptions.Loadbalancer.Mode) {
+			l.Log().Warnf("Loadbalancer '%s' runs in a different mode than the other loadbalancers, which cannot be expressed in a simple config", lb.Name)
+		}
+		if len(lb.Config.HTTP) > 0 || len(lb.Config.Settings.Upstreams) > 0 {
+			l.Log().Warnf("Loadbalancer '%s' has HTTP routes or upstream options, which cannot be expressed in a simple config", lb.Name)
+		}
+		simpleConfig.Options.K3dOptions.Loadbalancers = append(simpleConfig.Options.K3dOptions.Loadbalancers, conf.SimpleConfigNamedLoadbalancer{
+			Name:            lb.Name,
+			Ports:           loadbalancerPortSpecs(&lb, filters),
+			ConfigOverrides: loadbalancerConfigOverrides(lb.Config.Settings),
+		})
+	}
+
+	simpleConfig.Options.K3dOptions.DisableImageVolume = !manifest.ImageVolume
+	simpleConfig.Options.K3dOptions.Wait = true
+	simpleConfig.Options.KubeconfigOptions = conf.SimpleConfigOptionsKubeconfig{
+		UpdateDefaultKubeconfig: true,
+		SwitchCurrentContext:    true,
+	}
+
+	// -> REGISTRIES
+	simpleConfig.Registries.Use = manifest.Registries
+
+	return simpleConfig, nil
+}
+
+// loadbalancerPortSpecs returns the port mappings proxied by the loadbalancer, with node filters selecting their targets
+func loadbalancerPortSpecs(lb *k3d.ClusterSnapshotLoadbalancer, filters *nodeFilterInference) []conf.PortWithNodeFilters {
+	var result []conf.PortWithNodeFilters
+
+	// ports serving HTTP(S) routes are exposed by the routes themselves
+	httpPorts := map[int]bool{}
+	for _, server := range lb.Config.HTTP {
+		httpPorts[server.Listen] = true
+	}
+
+	// proxied ports may be port ranges (e.g. 30000-30100.tcp)
+	portConfigs := map[nat.Port]string{}
+	for portConfig := range lb.Config.Ports {
+		ports, proto, _ := strings.Cut(portConfig, ".")
+		start, end, err := nat.ParsePortRangeToInt(ports)
+		if err != nil {
+			continue
+		}
+		for port := start; port <= end; port++ {
+			portConfigs[nat.Port(fmt.Sprintf("%d/%s", port, proto))] = portConfig
+		}
+	}
+
+	exportedRanges := map[string]bool{}
+	for _, port := range sortedPorts(lb.Ports) {
+		if port.Proto() == "tcp" && httpPorts[port.Int()] {
+			continue
+		}
+		portConfig, ok := portConfigs[port]
+		if !ok {
+			portConfig = fmt.Sprintf("%s.%s", port.Port(), port.Proto())
+		}
+		if exportedRanges[portConfig] {
+			continue
+		}
+		targets := lb.Config.Ports[portConfig]
+		suffix := "proxy"
+		if lb.Config.Settings.PortOptions[portConfig].ProxyProtocol {
+			suffix = "proxyprotocol"
+		}
+		specs := portSpecs(nat.PortMap{port: lb.Ports[port]})
+		if spec, ok := portRangeSpec(lb.Ports, portConfig); ok {
+			specs = []string{spec}
+			exportedRanges[portConfig] = true
+		}
+		for _, spec := range specs {
+			result = append(result, conf.PortWithNodeFilters{Port: spec, NodeFilters: filters.infer(targets, suffix)})
+		}
+	}
+	return result
+}
+
+// loadbalancerConfigOverrides returns the overrides (configOverrides) for the non-default loadbalancer settings
+func loadbalancerConfigOverrides(settings k3d.LoadBalancerSettings) []string {
+	var overrides []string
+	if settings.WorkerConnections != 0 && settings.WorkerConnections != k3d.DefaultLoadbalancerWorkerConnections {
+		overrides = append(overrides, fmt.Sprintf("settings.workerConnections=%d", settings.WorkerConnections))
+	}
+	if settings.DefaultProxyTimeout != 0 {
+		overrides = append(overrides, fmt.Sprintf("settings.defaultProxyTimeout=%d", settings.DefaultProxyTimeout))
+	}
+	if settings.HealthCheck != nil {
+		if settings.HealthCheck.Interval != "" {
+			overrides = append(overrides, fmt.Sprintf("settings.healthCheck.interval=%s", settings.HealthCheck.Interval))
+		}
+		if settings.HealthCheck.Threshold != 0 {
+			overrides = append(overrides, fmt.Sprintf("settings.healthCheck.threshold=%d", settings.HealthCheck.Threshold))
+		}
+	}
+	return overrides
+}
+
+// nodeFilterInference creates node filters matching a given set of nodes
+type nodeFilterInference struct {
+	servers map[string]int
+	agents  map[string]int
+}
+
+func newNodeFilterInference(servers, agents []k3d.ClusterSnapshotNode) *nodeFilterInference {
+	inference := &nodeFilterInference{servers: map[string]int{}, agents: map[string]int{}}
+	for i, node := range servers {
+		inference.servers[node.Name] = i
+	}
+	for i, node := range agents {
+		inference.agents[node.Name] = i
+	}
+	return inference
+}
+
+// infer returns the node filters (with optional suffix) that select exactly the given nodes
+func (f *nodeFilterInference) infer(nodeNames []string, suffix string) []string {
+	filters := []string{}
+	for _, group := range []struct {
+		name, wildcard string
+		indices        map[string]int
+	}{
+		{"server", "servers", f.servers},
+		{"agent", "agents", f.agents},
+	} {
+		selected := []int{}
+		for _, name := range nodeNames {
+			if i, ok := group.indices[name]; ok {
+				selected = append(selected, i)
+			}
+		}
+		if len(selected) == 0 {
+			continue
+		}
+
+		var filter string
+		if len(selected) == len(group.indices) {
+			filter = fmt.Sprintf("%s:*", group.wildcard)
+		} else {
+			sort.Ints(selected)
+			indices := make([]string, len(selected))
+			for i, index := range selected {
+				indices[i] = strconv.Itoa(index)
+			}
+			filter = fmt.Sprintf("%s:%s", group.name, strings.Join(indices, ","))
+		}
+		if suffix != "" {
+			filter = fmt.Sprintf("%s:%s", filter, suffix)
+		}
+		filters = append(filters, filter)
+	}
+	return filters
+}
+
+// groupNodeValues returns all distinct values (in order of appearance) and the names of the nodes having each of them
+func groupNodeValues(nodes []k3d.ClusterSnapshotNode, values func(node k3d.ClusterSnapshotNode) []string) ([]string, map[string][]string) {
+	ordered := []string{}
+	nodesByValue := map[string][]string{}
+	for _, node := range nodes {
+		for _, value := range values(node) {
+			if _, ok := nodesByValue[value]; !ok {
+				ordered = append(ordered, value)
+			}
+			if len(nodesByValue[value]) == 0 || nodesByValue[value][len(nodesByValue[value])-1] != node.Name {
+				nodesByValue[value] = append(nodesByValue[value], node.Name)
+			}
+		}
+	}
+	return ordered, nodesByValue
+}
+
+// portSpecs formats the port mappings like they're passed to --port ([HOST:][HOSTPORT:]CONTAINERPORT[/PROTOCOL])
+func portSpecs(portMap nat.PortMap) []string {
+	specs := []string{}
+	for _, port := range sortedPorts(portMap) {
+		bindings := portMap[port]
+		if len(bindings) == 0 {
+			bindings = []nat.PortBinding{{}}
+		}
+		for _, binding := range bindings {
+			spec := string(port)
+			if binding.HostPort != "" {
+				spec = fmt.Sprintf("%s:%s", binding.HostPort, spec)
+				if binding.HostIP != "" && binding.HostIP != "0.0.0.0" {
+					spec = fmt.Sprintf("%s:%s", binding.HostIP, spec)
+				}
+			}
+			specs = append(specs, spec)
+		}
+	}
+	return specs
+}
+
+// portRangeSpec returns a single port mapping for a port range of the loadbalancer (e.g. 30000-30100.tcp),
+// if every port of it has one host port binding and those form a range as well
+func portRangeSpec(portMap nat.PortMap, portConfig string) (string, bool) {
+	ports, proto, _ := strings.Cut(portConfig, ".")
+	start, end, err := nat.ParsePortRangeToInt(ports)
+	if err != nil || start == end {
+		return "", false
+	}
+
+	var hostIP string
+	var hostStart int
+	for port := start; port <= end; port++ {
+		bindings := portMap[nat.Port(fmt.Sprintf("%d/%s", port, proto))]
+		if len(bindings) != 1 {
+			return "", false
+		}
+		hostPort := 0
+		if bindings[0].HostPort != "" {
+			if hostPort, err = strconv.Atoi(bindings[0].HostPort); err != nil {
+				return "", false
+			}
+		}
+		if port == start {
+			hostIP, hostStart = bindings[0].HostIP, hostPort
+		} else if bindings[0].HostIP != hostIP || (hostPort == 0) != (hostStart == 0) || (hostStart != 0 && hostPort != hostStart+port-start) {
+			return "", false
+		}
+	}
+
+	spec := fmt.Sprintf("%d-%d/%s", start, end, proto)
+	if hostStart != 0 {
+		spec = fmt.Sprintf("%d-%d:%s", hostStart, hostStart+end-start, spec)
+		if hostIP != "" && hostIP != "0.0.0.0" {
+			spec = fmt.Sprintf("%s:%s", hostIP, spec)
+		}
+	}
+	return spec, true
+}
+
+func sortedPorts(portMap nat.PortMap) []nat.Port {
+	ports := make([]nat.Port, 0, len(portMap))
+	for port := range portMap {
+		ports = append(ports, port)
+	}
+	sort.Slice(ports, func(i, j int) bool {
+		if ports[i].Int() != ports[j].Int() {
+			return ports[i].Int() < ports[j].Int()
+		}
+		return ports[i].Proto() < ports[j].Proto()
+	})
+	return ports
+}
+
+// commonNodeValue returns the value (e.g. the memory limit) shared by all given nodes (or none, if they differ)
+func commonNodeValue(nodes []k3d.ClusterSnapshotNode, what string, value func(k3d.ClusterSnapshotNode) string) string {
+	if len(nodes) == 0 {
+		return ""
+	}
+	for _, node := range nodes[1:] {
+		if value(node) != value(nodes[0]) {
+			l.Log().Warnf("%s nodes have different %s, which cannot be expressed in a simple config", nodes[0].Role, what)
+			return ""
+		}
+	}
+	return value(nodes[0])
+}
@@ -0,0 +1,115 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/k3d-io/k3d/v5/pkg/client"
+	conf "github.com/k3d-io/k3d/v5/pkg/config/v1alpha5"
+	"github.com/k3d-io/k3d/v5/pkg/runtimes/fake"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+func TestTransformClusterToSimpleConfig(t *testing.T) {
+	ctx := context.Background()
+	rt := fake.NewRuntime()
+
+	simpleCfg := conf.SimpleConfig{
+		Servers: 1,
+		Agents:  2,
+		Image:   "rancher/k3s:v1.31.5-k3s1",
+		Volumes: []conf.VolumeWithNodeFilters{
+			{Volume: "/tmp/data:/data", NodeFilters: []string{"agent:1"}},
+		},
+		Ports: []conf.PortWithNodeFilters{
+			{Port: "8080:80", NodeFilters: []string{"loadbalancer"}},
+			{Port: "9000:9000", NodeFilters: []string{"agent:1:direct"}},
+			{Port: "30000-30002:30000-30002", NodeFilters: []string{"server:0"}},
+		},
+		Env: []conf.EnvVarWithNodeFilters{
+			{EnvVar: "FOO=bar", NodeFilters: []string{"servers:*", "agents:*"}},
+		},
+	}
+	simpleCfg.Name = "export"
+	simpleCfg.Options.K3sOptions.ExtraArgs = []conf.K3sArgWithNodeFilters{
+		{Arg: "--disable=traefik", NodeFilters: []string{"server:0"}},
+	}
+	simpleCfg.Options.K3sOptions.NodeLabels = []conf.LabelWithNodeFilters{
+		{Label: "tier=frontend", NodeFilters: []string{"agent:0"}},
+	}
+	simpleCfg.Options.K3dOptions.Loadbalancers = []conf.SimpleConfigNamedLoadbalancer{
+		{Name: "ingress", Ports: []conf.PortWithNodeFilters{{Port: "127.0.0.2:8443:443", NodeFilters: []string{"agents:*"}}}},
+	}
+
+	clusterCfg, err := TransformSimpleToClusterConfig(ctx, rt, simpleCfg, "")
+	require.NoError(t, err)
+	require.NoError(t, client.ClusterRun(ctx, rt, clusterCfg))
+
+	cluster, err := client.ClusterGet(ctx, rt, &k3d.Cluster{Name: "export"})
+	require.NoError(t, err)
+
+	exported, err := TransformClusterToSimpleConfig(ctx, rt, cluster)
+	require.NoError(t, err)
+
+	assert.Equal(t, "export", exported.Name)
+	assert.Equal(t, 1, exported.Servers)
+	assert.Equal(t, 2, exported.Agents)
+	assert.Equal(t, simpleCfg.Image, exported.Image)
+	assert.Equal(t, []conf.VolumeWithNodeFilters{{Volume: "/tmp/data:/data", NodeFilters: []string{"agent:1"}}}, exported.Volumes)
+	assert.Equal(t, []conf.EnvVarWithNodeFilters{{EnvVar: "FOO=bar", NodeFilters: []string{"servers:*", "agents:*"}}}, exported.Env)
+	assert.Equal(t, []conf.K3sArgWithNodeFilters{{Arg: "--disable=traefik", NodeFilters: []string{"servers:*"}}}, exported.Options.K3sOptions.ExtraArgs)
+	assert.Equal(t, []conf.LabelWithNodeFilters{{Label: "tier=frontend", NodeFilters: []string{"agent:0"}}}, exported.Options.K3sOptions.NodeLabels)
+	assert.ElementsMatch(t, []conf.PortWithNodeFilters{
+		{Port: "9000:9000/tcp", NodeFilters: []string{"agent:1:direct"}},
+		{Port: "8080:80/tcp", NodeFilters: []string{"servers:*:proxy", "agents:*:proxy"}},
+		{Port: "30000-30002:30000-30002/tcp", NodeFilters: []string{"servers:*:proxy"}},
+	}, exported.Ports)
+	assert.Equal(t, []conf.SimpleConfigNamedLoadbalancer{
+		{Name: "ingress", Ports: []conf.PortWithNodeFilters{{Port: "127.0.0.2:8443:443/tcp", NodeFilters: []string{"agents:*:proxy"}}}},
+	}, exported.Options.K3dOptions.Loadbalancers)
+
+	// the exported config is a valid config file
+	exportedJSON, err := json.Marshal(exported)
+	require.NoError(t, err)
+	require.NoError(t, ValidateSchemaJSON(exportedJSON, []byte(conf.JSONSchema)))
+
+	// the exported config creates the same cluster again
+	require.NoError(t, client.ClusterDelete(ctx, rt, cluster, k3d.ClusterDeleteOpts{}))
+	recreatedCfg, err := TransformSimpleToClusterConfig(ctx, rt, *exported, "")
+	require.NoError(t, err)
+	require.NoError(t, client.ClusterRun(ctx, rt, recreatedCfg))
+	recreated, err := client.ClusterGet(ctx, rt, &k3d.Cluster{Name: "export"})
+	require.NoError(t, err)
+	reexported, err := TransformClusterToSimpleConfig(ctx, rt, recreated)
+	require.NoError(t, err)
+	assert.Equal(t, exported.Volumes, reexported.Volumes)
+	assert.Equal(t, exported.Env, reexported.Env)
+	assert.Equal(t, exported.Options.K3sOptions, reexported.Options.K3sOptions)
+	assert.ElementsMatch(t, exported.Ports, reexported.Ports)
+	assert.Equal(t, exported.Options.K3dOptions.Loadbalancers, reexported.Options.K3dOptions.Loadbalancers)
+}
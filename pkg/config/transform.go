@@ -28,6 +28,7 @@ import (
 	"io"
 	"net/netip"
 	"os"
+	"slices"
 	"strings"
 
 	wharfie "github.com/rancher/wharfie/pkg/registries"
@@ -41,6 +42,7 @@ import (
 	conf "github.com/k3d-io/k3d/v5/pkg/config/v1alpha5"
 	l "github.com/k3d-io/k3d/v5/pkg/logger"
 	"github.com/k3d-io/k3d/v5/pkg/runtimes"
+	runtimeTypes "github.com/k3d-io/k3d/v5/pkg/runtimes/types"
 	k3d "github.com/k3d-io/k3d/v5/pkg/types"
 	"github.com/k3d-io/k3d/v5/pkg/util"
 	"github.com/k3d-io/k3d/v5/version"
@@ -117,7 +119,7 @@ func TransformSimpleToClusterConfig(ctx context.Context, runtime runtimes.Runtim
 
 	if !simpleConfig.Options.K3dOptions.DisableLoadbalancer {
 		newCluster.ServerLoadBalancer = k3d.NewLoadbalancer()
-		lbCreateOpts := &k3d.LoadbalancerCreateOpts{}
+		lbCreateOpts := &k3d.LoadbalancerCreateOpts{Mode: k3d.LoadbalancerMode(simpleConfig.Options.K3dOptions.Loadbalancer.Mode)}
 		if simpleConfig.Options.K3dOptions.Loadbalancer.ConfigOverrides != nil && len(simpleConfig.Options.K3dOptions.Loadbalancer.ConfigOverrides) > 0 {
 			lbCreateOpts.ConfigOverrides = simpleConfig.Options.K3dOptions.Loadbalancer.ConfigOverrides
 		}
@@ -131,6 +133,18 @@ func TransformSimpleToClusterConfig(ctx context.Context, runtime runtimes.Runtim
 		l.Log().Debugln("Disabling the load balancer")
 	}
 
+	for _, namedLB := range simpleConfig.Options.K3dOptions.Loadbalancers {
+		lb, err := client.LoadbalancerPrepareNamed(ctx, runtime, &newCluster, namedLB.Name, &k3d.LoadbalancerCreateOpts{
+			Mode:            k3d.LoadbalancerMode(simpleConfig.Options.K3dOptions.Loadbalancer.Mode),
+			ConfigOverrides: namedLB.ConfigOverrides,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error preparing the loadbalancer '%s': %w", namedLB.Name, err)
+		}
+		newCluster.Loadbalancers = append(newCluster.Loadbalancers, lb)
+		newCluster.Nodes = append(newCluster.Nodes, lb.Node)
+	}
+
 	/*************
 	 * Add Nodes *
 	 *************/
@@ -142,6 +156,7 @@ func TransformSimpleToClusterConfig(ctx context.Context, runtime runtimes.Runtim
 			Image:       simpleConfig.Image,
 			ServerOpts:  k3d.ServerOpts{},
 			Memory:      simpleConfig.Options.Runtime.ServersMemory,
+			CPUs:        simpleConfig.Options.Runtime.ServersCPUs,
 			HostPidMode: simpleConfig.Options.Runtime.HostPidMode,
 		}
 
@@ -164,6 +179,7 @@ func TransformSimpleToClusterConfig(ctx context.Context, runtime runtimes.Runtim
 			Role:        k3d.AgentRole,
 			Image:       simpleConfig.Image,
 			Memory:      simpleConfig.Options.Runtime.AgentsMemory,
+			CPUs:        simpleConfig.Options.Runtime.AgentsCPUs,
 			HostPidMode: simpleConfig.Options.Runtime.HostPidMode,
 		}
 		newCluster.Nodes = append(newCluster.Nodes, &agentNode)
@@ -191,6 +207,24 @@ func TransformSimpleToClusterConfig(ctx context.Context, runtime runtimes.Runtim
 	if err := client.TransformPorts(ctx, runtime, &newCluster, simpleConfig.Ports); err != nil {
 		return nil, fmt.Errorf("failed to transform ports: %w", err)
 	}
+	for _, namedLB := range simpleConfig.Options.K3dOptions.Loadbalancers {
+		if len(namedLB.Ports) == 0 {
+			return nil, fmt.Errorf("loadbalancer '%s' has no ports", namedLB.Name)
+		}
+		if err := client.TransformLoadbalancerPorts(&newCluster, newCluster.GetLoadbalancer(namedLB.Name), namedLB.Ports); err != nil {
+			return nil, fmt.Errorf("failed to transform ports of the loadbalancer '%s': %w", namedLB.Name, err)
+		}
+	}
+
+	// -> LOADBALANCER ROUTES
+	if err := client.TransformLoadbalancerRoutes(ctx, runtime, &newCluster, simpleConfig.Options.K3dOptions.Loadbalancer.Routes, configFileName); err != nil {
+		return nil, fmt.Errorf("failed to transform loadbalancer routes: %w", err)
+	}
+
+	// -> LOADBALANCER UPSTREAMS
+	if err := client.TransformLoadbalancerUpstreams(&newCluster, simpleConfig.Options.K3dOptions.Loadbalancer.Upstreams); err != nil {
+		return nil, fmt.Errorf("failed to transform loadbalancer upstreams: %w", err)
+	}
 
 	// -> K3S NODE LABELS
 	for _, k3sNodeLabelWithNodeFilters := range simpleConfig.Options.K3sOptions.NodeLabels {
@@ -252,6 +286,18 @@ func TransformSimpleToClusterConfig(ctx context.Context, runtime runtimes.Runtim
 		}
 	}
 
+	// -> CPUSETS
+	for _, cpusetWithNodeFilters := range simpleConfig.Options.Runtime.CPUSets {
+		nodes, err := util.FilterNodes(nodeList, cpusetWithNodeFilters.NodeFilters)
+		if err != nil {
+			return nil, fmt.Errorf("failed to filter nodes for cpuset '%s': %w", cpusetWithNodeFilters.CPUSet, err)
+		}
+
+		for _, node := range nodes {
+			node.CPUSet = cpusetWithNodeFilters.CPUSet
+		}
+	}
+
 	// -> ENV
 	for _, envVarWithNodeFilters := range simpleConfig.Env {
 		if len(envVarWithNodeFilters.NodeFilters) == 0 && nodeCount > 1 {
@@ -296,6 +342,8 @@ func TransformSimpleToClusterConfig(ctx context.Context, runtime runtimes.Runtim
 		GPURequest:          simpleConfig.Options.Runtime.GPURequest,
 		ServersMemory:       simpleConfig.Options.Runtime.ServersMemory,
 		AgentsMemory:        simpleConfig.Options.Runtime.AgentsMemory,
+		ServersCPUs:         simpleConfig.Options.Runtime.ServersCPUs,
+		AgentsCPUs:          simpleConfig.Options.Runtime.AgentsCPUs,
 		HostAliases:         simpleConfig.HostAliases,
 		GlobalLabels:        map[string]string{}, // empty init
 		GlobalEnv:           []string{},          // empty init
@@ -315,47 +363,41 @@ func TransformSimpleToClusterConfig(ctx context.Context, runtime runtimes.Runtim
 		simpleConfig.Registries.Create.Name == "" &&
 		simpleConfig.Registries.Create.Host == "" &&
 		simpleConfig.Registries.Create.HostPort == "" &&
-		simpleConfig.Registries.Create.Image == "" {
+		simpleConfig.Registries.Create.Image == "" &&
+		simpleConfig.Registries.Create.Kind == "" &&
+		!simpleConfig.Registries.Create.TLS &&
+		simpleConfig.Registries.Create.Proxy == (k3d.RegistryProxy{}) &&
+		simpleConfig.Registries.Create.Auth == (k3d.RegistryAuth{}) {
 		simpleConfig.Registries.Create = nil
 	}
 
 	if simpleConfig.Registries.Create != nil {
-		epSpecHost := "0.0.0.0"
-		epSpecPort := "random"
-
-		if simpleConfig.Registries.Create.HostPort != "" {
-			epSpecPort = simpleConfig.Registries.Create.HostPort
-		}
-		if simpleConfig.Registries.Create.Host != "" {
-			epSpecHost = simpleConfig.Registries.Create.Host
-		}
-
-		regPort, err := cliutil.ParsePortExposureSpec(fmt.Sprintf("%s:%s", epSpecHost, epSpecPort), k3d.DefaultRegistryPort, simpleConfig.Registries.Create.EnforcePortMatch)
+		reg, err := transformRegistryCreateConfig(*simpleConfig.Registries.Create, fmt.Sprintf("%s-%s-registry", k3d.DefaultObjectNamePrefix, newCluster.Name), newCluster.Name)
 		if err != nil {
-			return nil, fmt.Errorf("failed to get port for registry: %w", err)
+			return nil, err
 		}
+		clusterCreateOpts.Registries.Create = reg
+	}
 
-		regName := fmt.Sprintf("%s-%s-registry", k3d.DefaultObjectNamePrefix, newCluster.Name)
-		if simpleConfig.Registries.Create.Name != "" {
-			regName = simpleConfig.Registries.Create.Name
+	// pull-through caches: one registry per upstream
+	mirroredUpstreams := make(map[string]string, len(simpleConfig.Registries.Mirrors))
+	for _, mirrorCfg := range simpleConfig.Registries.Mirrors {
+		if mirrorCfg.Proxy.RemoteURL == "" {
+			return nil, fmt.Errorf("registry mirror '%s' is missing the remote URL of the upstream registry (proxy.remoteURL)", mirrorCfg.Name)
 		}
-
-		image := fmt.Sprintf("%s:%s", k3d.DefaultRegistryImageRepo, k3d.DefaultRegistryImageTag)
-		if simpleConfig.Registries.Create.Image != "" {
-			image = simpleConfig.Registries.Create.Image
+		mirrorCfg.Proxy.RemoteURL = client.RegistryMirrorRemoteURL(mirrorCfg.Proxy.RemoteURL)
+		upstream := client.RegistryMirrorName(mirrorCfg.Proxy.RemoteURL)
+		if other, ok := mirroredUpstreams[upstream]; ok {
+			return nil, fmt.Errorf("upstream registry '%s' is mirrored twice (%s and %s)", upstream, other, mirrorCfg.Proxy.RemoteURL)
 		}
+		mirroredUpstreams[upstream] = mirrorCfg.Proxy.RemoteURL
 
-		clusterCreateOpts.Registries.Create = &k3d.Registry{
-			ClusterRef:   newCluster.Name,
-			Host:         regName,
-			Image:        image,
-			ExposureOpts: *regPort,
-			Volumes:      simpleConfig.Registries.Create.Volumes,
-			Options: k3d.RegistryOptions{
-				Proxy:            simpleConfig.Registries.Create.Proxy,
-				EnforcePortMatch: simpleConfig.Registries.Create.EnforcePortMatch,
-			},
+		defaultName := fmt.Sprintf("%s-%s-mirror-%s", k3d.DefaultObjectNamePrefix, newCluster.Name, strings.NewReplacer(".", "-", ":", "-").Replace(upstream))
+		reg, err := transformRegistryCreateConfig(mirrorCfg, defaultName, newCluster.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to transform mirror for '%s': %w", upstream, err)
 		}
+		clusterCreateOpts.Registries.Mirrors = append(clusterCreateOpts.Registries.Mirrors, reg)
 	}
 
 	for _, usereg := range simpleConfig.Registries.Use {
@@ -441,3 +483,64 @@ func TransformSimpleToClusterConfig(ctx context.Context, runtime runtimes.Runtim
 
 	return clusterConfig, nil
 }
+
+// transformRegistryCreateConfig transforms the config of a registry to be created alongside the cluster into a registry spec
+func transformRegistryCreateConfig(regConfig conf.SimpleConfigRegistryCreateConfig, defaultName string, clusterName string) (*k3d.Registry, error) {
+	epSpecHost := "0.0.0.0"
+	epSpecPort := "random"
+
+	if regConfig.HostPort != "" {
+		epSpecPort = regConfig.HostPort
+	}
+	if regConfig.Host != "" {
+		epSpecHost = regConfig.Host
+	}
+
+	regPort, err := cliutil.ParsePortExposureSpec(fmt.Sprintf("%s:%s", epSpecHost, epSpecPort), k3d.DefaultRegistryPort, regConfig.EnforcePortMatch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get port for registry: %w", err)
+	}
+
+	regName := defaultName
+	if regConfig.Name != "" {
+		regName = regConfig.Name
+	}
+
+	// the image defaults to the one of the registry kind (see client.RegistryImplementation)
+	kind := k3d.RegistryKind(regConfig.Kind)
+	if kind != "" && !slices.Contains(k3d.RegistryKinds, kind) {
+		return nil, fmt.Errorf("unsupported registry kind '%s' (supported: %v)", kind, k3d.RegistryKinds)
+	}
+
+	return &k3d.Registry{
+		ClusterRef:   clusterName,
+		Host:         regName,
+		Image:        regConfig.Image,
+		ExposureOpts: *regPort,
+		Volumes:      regConfig.Volumes,
+		Options: k3d.RegistryOptions{
+			Kind:             kind,
+			Proxy:            regConfig.Proxy,
+			EnforcePortMatch: regConfig.EnforcePortMatch,
+			TLS:              regConfig.TLS,
+			Auth:             regConfig.Auth,
+		},
+	}, nil
+}
+
+// TransformRuntimeConnections transforms the runtime connection settings of a simple configuration to the runtime connection options, keyed by runtime name
+func TransformRuntimeConnections(simpleConfig conf.SimpleConfig) map[string]runtimeTypes.ConnectionOpts {
+	connections := make(map[string]runtimeTypes.ConnectionOpts, len(simpleConfig.Options.Runtime.Connections))
+	for name, conn := range simpleConfig.Options.Runtime.Connections {
+		connections[name] = runtimeTypes.ConnectionOpts{
+			Endpoint: conn.Endpoint,
+			Timeout:  conn.Timeout,
+			TLS: runtimeTypes.TLSOpts{
+				CACert: conn.TLS.CACert,
+				Cert:   conn.TLS.Cert,
+				Key:    conn.TLS.Key,
+			},
+		}
+	}
+	return connections
+}
@@ -31,6 +31,7 @@ import (
 
 	conf "github.com/k3d-io/k3d/v5/pkg/config/v1alpha5"
 	"github.com/k3d-io/k3d/v5/pkg/runtimes"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
 	"github.com/spf13/viper"
 )
 
@@ -78,6 +79,74 @@ func TestTransformEmptyRegistryCreateIsNil(t *testing.T) {
 		"Registries.Use should still have the referenced registry")
 }
 
+func TestTransformCPULimits(t *testing.T) {
+	simpleCfg := conf.SimpleConfig{
+		Servers: 1,
+		Agents:  2,
+		Options: conf.SimpleConfigOptions{
+			Runtime: conf.SimpleConfigOptionsRuntime{
+				ServersCPUs: "2",
+				AgentsCPUs:  "0.5",
+				CPUSets: []conf.CPUSetWithNodeFilters{
+					{CPUSet: "0-1", NodeFilters: []string{"agent:*"}},
+					{CPUSet: "2", NodeFilters: []string{"agent:1"}},
+				},
+			},
+		},
+	}
+	simpleCfg.Name = "cputest"
+
+	clusterCfg, err := TransformSimpleToClusterConfig(context.Background(), runtimes.Docker, simpleCfg, "")
+	require.NoError(t, err)
+
+	assert.Equal(t, "2", clusterCfg.ClusterCreateOpts.ServersCPUs)
+	assert.Equal(t, "0.5", clusterCfg.ClusterCreateOpts.AgentsCPUs)
+
+	resources := map[string][2]string{}
+	for _, node := range clusterCfg.Cluster.Nodes {
+		resources[node.Name] = [2]string{node.CPUs, node.CPUSet}
+	}
+	assert.Equal(t, [2]string{"2", ""}, resources["k3d-cputest-server-0"])
+	assert.Equal(t, [2]string{"0.5", "0-1"}, resources["k3d-cputest-agent-0"])
+	assert.Equal(t, [2]string{"0.5", "2"}, resources["k3d-cputest-agent-1"], "later cpusets override earlier ones")
+}
+
+func TestTransformNamedLoadbalancers(t *testing.T) {
+	newSimpleCfg := func(lbs ...conf.SimpleConfigNamedLoadbalancer) conf.SimpleConfig {
+		simpleCfg := conf.SimpleConfig{Servers: 1, Agents: 2}
+		simpleCfg.Name = "lbtest"
+		simpleCfg.Options.K3dOptions.Loadbalancers = lbs
+		return simpleCfg
+	}
+	ingressPorts := []conf.PortWithNodeFilters{{Port: "127.0.0.2:80:80", NodeFilters: []string{"agents:*"}}}
+
+	clusterCfg, err := TransformSimpleToClusterConfig(context.Background(), runtimes.Docker, newSimpleCfg(conf.SimpleConfigNamedLoadbalancer{
+		Name:            "ingress",
+		Ports:           ingressPorts,
+		ConfigOverrides: []string{"settings.workerConnections=2048"},
+	}), "")
+	require.NoError(t, err)
+
+	lb := clusterCfg.Cluster.GetLoadbalancer("ingress")
+	require.NotNil(t, lb)
+	assert.Equal(t, "k3d-lbtest-ingresslb", lb.Node.Name)
+	assert.Equal(t, map[string][]string{"80.tcp": {"k3d-lbtest-agent-0", "k3d-lbtest-agent-1"}}, lb.Config.Ports)
+	assert.Equal(t, 2048, lb.Config.Settings.WorkerConnections)
+	assert.Contains(t, clusterCfg.Cluster.Nodes, lb.Node)
+	assert.NotContains(t, clusterCfg.Cluster.ServerLoadBalancer.Config.Ports, "80.tcp")
+
+	for name, lbs := range map[string][]conf.SimpleConfigNamedLoadbalancer{
+		"reserved name":  {{Name: "server", Ports: ingressPorts}},
+		"invalid name":   {{Name: "in_gress", Ports: ingressPorts}},
+		"duplicate name": {{Name: "ingress", Ports: ingressPorts}, {Name: "ingress", Ports: ingressPorts}},
+		"no ports":       {{Name: "ingress"}},
+		"direct port":    {{Name: "ingress", Ports: []conf.PortWithNodeFilters{{Port: "80:80", NodeFilters: []string{"agent:0:direct"}}}}},
+	} {
+		_, err := TransformSimpleToClusterConfig(context.Background(), runtimes.Docker, newSimpleCfg(lbs...), "")
+		assert.Error(t, err, name)
+	}
+}
+
 func TestTransformRegistryUseOnlyConfig(t *testing.T) {
 	// Test loading a config file that only has registries.use (no create)
 	cfgFile := "./test_assets/config_test_registry_use_only.yaml"
@@ -104,3 +173,29 @@ func TestTransformRegistryUseOnlyConfig(t *testing.T) {
 		"Registries.Use should have one entry")
 	assert.Equal(t, "k3d-registry-use-test-registry", clusterCfg.ClusterCreateOpts.Registries.Use[0].Host)
 }
+
+func TestTransformRegistryKind(t *testing.T) {
+	simpleCfg := conf.SimpleConfig{
+		Servers: 1,
+		Registries: conf.SimpleConfigRegistries{
+			Create: &conf.SimpleConfigRegistryCreateConfig{Kind: "zot"},
+		},
+	}
+	simpleCfg.Name = "regkindtest"
+
+	clusterCfg, err := TransformSimpleToClusterConfig(context.Background(), runtimes.Docker, simpleCfg, "")
+	require.NoError(t, err)
+	require.NotNil(t, clusterCfg.ClusterCreateOpts.Registries.Create)
+	assert.Equal(t, k3d.RegistryKindZot, clusterCfg.ClusterCreateOpts.Registries.Create.Options.Kind)
+	assert.Empty(t, clusterCfg.ClusterCreateOpts.Registries.Create.Image,
+		"the image should be left to the registry kind")
+
+	simpleCfg.Registries.Create.Kind = "harbor-lite"
+	clusterCfg, err = TransformSimpleToClusterConfig(context.Background(), runtimes.Docker, simpleCfg, "")
+	require.NoError(t, err)
+	assert.Equal(t, k3d.RegistryKindHarborLite, clusterCfg.ClusterCreateOpts.Registries.Create.Options.Kind)
+
+	simpleCfg.Registries.Create.Kind = "no-such-kind"
+	_, err = TransformSimpleToClusterConfig(context.Background(), runtimes.Docker, simpleCfg, "")
+	assert.Error(t, err, "unknown registry kinds should be rejected")
+}
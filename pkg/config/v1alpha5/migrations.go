@@ -98,6 +98,7 @@ func MigrateV1Alpha4(input configtypes.Config) (configtypes.Config, error) {
 		}
 
 		cfg.Name = cfgIntermediate.Name
+		cfg.ClusterToken = cfgIntermediate.ClusterToken
 
 		/*
 		 * Finalizing
@@ -79,6 +79,11 @@ type EnvVarWithNodeFilters struct {
 	NodeFilters []string `mapstructure:"nodeFilters" json:"nodeFilters,omitempty"`
 }
 
+type CPUSetWithNodeFilters struct {
+	CPUSet      string   `mapstructure:"cpuset" json:"cpuset,omitempty"`
+	NodeFilters []string `mapstructure:"nodeFilters" json:"nodeFilters,omitempty"`
+}
+
 type K3sArgWithNodeFilters struct {
 	Arg         string   `mapstructure:"arg" json:"arg,omitempty"`
 	NodeFilters []string `mapstructure:"nodeFilters" json:"nodeFilters,omitempty"`
@@ -95,10 +100,13 @@ type SimpleConfigRegistryCreateConfig struct {
 	Name     string            `mapstructure:"name" json:"name,omitempty"`
 	Host     string            `mapstructure:"host" json:"host,omitempty"`
 	HostPort string            `mapstructure:"hostPort" json:"hostPort,omitempty"`
+	Kind     string            `mapstructure:"kind" json:"kind,omitempty"` // default: distribution
 	Image    string            `mapstructure:"image" json:"image,omitempty"`
 	Proxy    k3d.RegistryProxy `mapstructure:"proxy" json:"proxy,omitempty"`
 	Volumes  []string          `mapstructure:"volumes" json:"volumes,omitempty"`
 	EnforcePortMatch bool      `mapstructure:"enforcePortMatch" json:"enforcePortMatch,omitempty"`
+	TLS      bool              `mapstructure:"tls" json:"tls,omitempty"`
+	Auth     k3d.RegistryAuth  `mapstructure:"auth" json:"auth,omitempty"`
 }
 
 // SimpleConfigOptionsKubeconfig describes the set of options referring to the kubeconfig during cluster creation.
@@ -115,12 +123,30 @@ type SimpleConfigOptions struct {
 }
 
 type SimpleConfigOptionsRuntime struct {
-	GPURequest    string                 `mapstructure:"gpuRequest" json:"gpuRequest,omitempty"`
-	ServersMemory string                 `mapstructure:"serversMemory" json:"serversMemory,omitempty"`
-	AgentsMemory  string                 `mapstructure:"agentsMemory" json:"agentsMemory,omitempty"`
-	HostPidMode   bool                   `mapstructure:"hostPidMode" yjson:"hostPidMode,omitempty"`
-	Labels        []LabelWithNodeFilters `mapstructure:"labels" json:"labels,omitempty"`
-	Ulimits       []Ulimit               `mapstructure:"ulimits" json:"ulimits,omitempty"`
+	Name          string                                   `mapstructure:"name" json:"name,omitempty"`
+	GPURequest    string                                   `mapstructure:"gpuRequest" json:"gpuRequest,omitempty"`
+	ServersMemory string                                   `mapstructure:"serversMemory" json:"serversMemory,omitempty"`
+	AgentsMemory  string                                   `mapstructure:"agentsMemory" json:"agentsMemory,omitempty"`
+	ServersCPUs   string                                   `mapstructure:"serversCpus" json:"serversCpus,omitempty"`
+	AgentsCPUs    string                                   `mapstructure:"agentsCpus" json:"agentsCpus,omitempty"`
+	CPUSets       []CPUSetWithNodeFilters                  `mapstructure:"cpusets" json:"cpusets,omitempty"`
+	HostPidMode   bool                                     `mapstructure:"hostPidMode" yjson:"hostPidMode,omitempty"`
+	Labels        []LabelWithNodeFilters                   `mapstructure:"labels" json:"labels,omitempty"`
+	Ulimits       []Ulimit                                 `mapstructure:"ulimits" json:"ulimits,omitempty"`
+	Connections   map[string]SimpleConfigRuntimeConnection `mapstructure:"connections" json:"connections,omitempty"`
+}
+
+// SimpleConfigRuntimeConnection holds the settings used to connect to a runtime (keyed by runtime name)
+type SimpleConfigRuntimeConnection struct {
+	Endpoint string                           `mapstructure:"endpoint" json:"endpoint,omitempty"`
+	Timeout  time.Duration                    `mapstructure:"timeout" json:"timeout,omitempty"`
+	TLS      SimpleConfigRuntimeConnectionTLS `mapstructure:"tls" json:"tls,omitempty"`
+}
+
+type SimpleConfigRuntimeConnectionTLS struct {
+	CACert string `mapstructure:"caCert" json:"caCert,omitempty"`
+	Cert   string `mapstructure:"cert" json:"cert,omitempty"`
+	Key    string `mapstructure:"key" json:"key,omitempty"`
 }
 
 type Ulimit struct {
@@ -137,10 +163,49 @@ type SimpleConfigOptionsK3d struct {
 	NoRollback          bool                               `mapstructure:"disableRollback" json:"disableRollback"`
 	NodeHookActions     []k3d.NodeHookAction               `mapstructure:"nodeHookActions" json:"nodeHookActions,omitempty"`
 	Loadbalancer        SimpleConfigOptionsK3dLoadbalancer `mapstructure:"loadbalancer" json:"loadbalancer,omitempty"`
+	Loadbalancers       []SimpleConfigNamedLoadbalancer    `mapstructure:"loadbalancers" json:"loadbalancers,omitempty"`
 }
 
 type SimpleConfigOptionsK3dLoadbalancer struct {
-	ConfigOverrides []string `mapstructure:"configOverrides" json:"configOverrides,omitempty"`
+	Mode            string                                `mapstructure:"mode" json:"mode,omitempty"` // nginx (default) or native, for all loadbalancers of the cluster
+	ConfigOverrides []string                              `mapstructure:"configOverrides" json:"configOverrides,omitempty"`
+	Routes          []LoadbalancerRouteWithNodeFilters    `mapstructure:"routes" json:"routes,omitempty"`
+	Upstreams       []LoadbalancerUpstreamWithNodeFilters `mapstructure:"upstreams" json:"upstreams,omitempty"`
+}
+
+// SimpleConfigNamedLoadbalancer is an additional loadbalancer next to the server loadbalancer, e.g. for ingress traffic
+type SimpleConfigNamedLoadbalancer struct {
+	Name            string                `mapstructure:"name" json:"name"`
+	Ports           []PortWithNodeFilters `mapstructure:"ports" json:"ports,omitempty"`
+	ConfigOverrides []string              `mapstructure:"configOverrides" json:"configOverrides,omitempty"`
+}
+
+// LoadbalancerUpstreamWithNodeFilters tunes how the loadbalancer uses the filtered nodes as targets of a port (or all ports).
+// Later entries override the options set by earlier ones.
+type LoadbalancerUpstreamWithNodeFilters struct {
+	Port        string   `mapstructure:"port" json:"port,omitempty"` // CONTAINERPORT[/PROTOCOL] of the loadbalancer, default: all ports
+	Weight      int      `mapstructure:"weight" json:"weight,omitempty"`
+	Backup      bool     `mapstructure:"backup" json:"backup,omitempty"`
+	MaxFails    *int     `mapstructure:"maxFails" json:"maxFails,omitempty"`
+	FailTimeout string   `mapstructure:"failTimeout" json:"failTimeout,omitempty"`
+	Down        bool     `mapstructure:"down" json:"down,omitempty"`
+	NodeFilters []string `mapstructure:"nodeFilters" json:"nodeFilters,omitempty"`
+}
+
+// LoadbalancerRouteWithNodeFilters routes HTTP(S) requests for a hostname (and path) from the loadbalancer to a port on the filtered nodes
+type LoadbalancerRouteWithNodeFilters struct {
+	Host        string               `mapstructure:"host" json:"host,omitempty"`
+	Path        string               `mapstructure:"path" json:"path,omitempty"`     // default: /
+	Port        int                  `mapstructure:"port" json:"port,omitempty"`     // port on the target nodes
+	Listen      string               `mapstructure:"listen" json:"listen,omitempty"` // [HOST:][HOSTPORT:]CONTAINERPORT of the loadbalancer, default: 80 (443 with TLS)
+	TLS         LoadbalancerRouteTLS `mapstructure:"tls" json:"tls,omitempty"`
+	NodeFilters []string             `mapstructure:"nodeFilters" json:"nodeFilters,omitempty"`
+}
+
+// LoadbalancerRouteTLS references a certificate and its key on the host (or embedded), used to terminate TLS in the loadbalancer
+type LoadbalancerRouteTLS struct {
+	Cert string `mapstructure:"cert" json:"cert,omitempty"`
+	Key  string `mapstructure:"key" json:"key,omitempty"`
 }
 
 type SimpleConfigOptionsK3s struct {
@@ -149,9 +214,10 @@ type SimpleConfigOptionsK3s struct {
 }
 
 type SimpleConfigRegistries struct {
-	Use    []string                          `mapstructure:"use" json:"use,omitempty"`
-	Create *SimpleConfigRegistryCreateConfig `mapstructure:"create" json:"create,omitempty"`
-	Config string                            `mapstructure:"config" json:"config,omitempty"` // registries.yaml (k3s config for containerd registry override)
+	Use     []string                           `mapstructure:"use" json:"use,omitempty"`
+	Create  *SimpleConfigRegistryCreateConfig  `mapstructure:"create" json:"create,omitempty"`
+	Mirrors []SimpleConfigRegistryCreateConfig `mapstructure:"mirrors" json:"mirrors,omitempty"` // pull-through caches, one per upstream (proxy.remoteURL)
+	Config  string                             `mapstructure:"config" json:"config,omitempty"`   // registries.yaml (k3s config for containerd registry override)
 }
 
 // SimpleConfig describes the toplevel k3d configuration file.
@@ -164,7 +230,7 @@ type SimpleConfig struct {
 	Image             string                  `mapstructure:"image" json:"image,omitempty"`
 	Network           string                  `mapstructure:"network" json:"network,omitempty"`
 	Subnet            string                  `mapstructure:"subnet" json:"subnet,omitempty"`
-	ClusterToken      string                  `mapstructure:"token" json:"clusterToken,omitempty"` // default: auto-generated
+	ClusterToken      string                  `mapstructure:"token" json:"token,omitempty"` // default: auto-generated
 	Volumes           []VolumeWithNodeFilters `mapstructure:"volumes" json:"volumes,omitempty"`
 	Ports             []PortWithNodeFilters   `mapstructure:"ports" json:"ports,omitempty"`
 	Options           SimpleConfigOptions     `mapstructure:"options" json:"options,omitempty"`
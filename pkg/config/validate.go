@@ -32,6 +32,7 @@ import (
 	"github.com/k3d-io/k3d/v5/pkg/runtimes"
 	runtimeutil "github.com/k3d-io/k3d/v5/pkg/runtimes/util"
 	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+	"github.com/k3d-io/k3d/v5/pkg/util"
 
 	"fmt"
 
@@ -76,6 +77,19 @@ func ValidateClusterConfig(ctx context.Context, runtime runtimes.Runtime, config
 		}
 	}
 
+	// CPU limits must be positive (fractional) numbers
+	if config.ClusterCreateOpts.ServersCPUs != "" {
+		if _, err := util.ParseCPUs(config.ClusterCreateOpts.ServersCPUs); err != nil {
+			return fmt.Errorf("provided servers CPU limit value is invalid: %w", err)
+		}
+	}
+
+	if config.ClusterCreateOpts.AgentsCPUs != "" {
+		if _, err := util.ParseCPUs(config.ClusterCreateOpts.AgentsCPUs); err != nil {
+			return fmt.Errorf("provided agents CPU limit value is invalid: %w", err)
+		}
+	}
+
 	// hostAliases
 	if len(config.ClusterCreateOpts.HostAliases) > 0 {
 		// not allowed in hostnetwork mode
@@ -108,6 +122,12 @@ func ValidateClusterConfig(ctx context.Context, runtime runtimes.Runtime, config
 				return fmt.Errorf("failed to validate volume mount '%s': %w", volume, err)
 			}
 		}
+
+		if node.CPUSet != "" {
+			if err := util.ValidateCPUSet(node.CPUSet); err != nil {
+				return fmt.Errorf("invalid cpuset for node '%s': %w", node.Name, err)
+			}
+		}
 	}
 
 	return nil
@@ -0,0 +1,178 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+// Package loadbalancer implements the native loadbalancer mode (k3d.LoadbalancerModeNative):
+// a small L4 proxy built into the k3d binary, which reads the same config as the k3d-proxy image.
+package loadbalancer
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/go-connections/nat"
+	"sigs.k8s.io/yaml"
+
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+const (
+	defaultProxyTimeout   = 600 * time.Second // nginx: proxy_timeout
+	defaultConnectTimeout = 2 * time.Second   // nginx: proxy_connect_timeout
+	resolveTimeout        = 5 * time.Second
+)
+
+// portConfig is the proxy configuration of a single port of the loadbalancer
+type portConfig struct {
+	key           string // e.g. 80.tcp
+	port          int
+	proto         string
+	upstreams     *pool
+	proxyProtocol bool
+	timeout       time.Duration
+}
+
+// ReadConfig reads the loadbalancer config from a YAML (or JSON) file
+func ReadConfig(path string) (k3d.LoadbalancerConfig, []byte, error) {
+	var cfg k3d.LoadbalancerConfig
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, nil, fmt.Errorf("failed to read loadbalancer config: %w", err)
+	}
+	if err := yaml.Unmarshal(content, &cfg); err != nil {
+		return cfg, nil, fmt.Errorf("failed to parse loadbalancer config '%s': %w", path, err)
+	}
+	return cfg, content, nil
+}
+
+// CheckConfig checks that the native proxy can serve the loadbalancer config and that all of its targets resolve
+func CheckConfig(ctx context.Context, cfg k3d.LoadbalancerConfig) error {
+	ports, err := buildPortConfigs(cfg)
+	if err != nil {
+		return err
+	}
+	if _, err := newHealthCheck(cfg.Settings.HealthCheck); err != nil {
+		return err
+	}
+	return resolveTargets(ctx, ports)
+}
+
+// buildPortConfigs expands the (ranges of) ports of the config to the single ports the proxy listens on
+func buildPortConfigs(cfg k3d.LoadbalancerConfig) (map[string]*portConfig, error) {
+	if len(cfg.HTTP) > 0 {
+		return nil, fmt.Errorf("HTTP(S) routes are not supported by the native loadbalancer")
+	}
+
+	timeout := defaultProxyTimeout
+	if cfg.Settings.DefaultProxyTimeout > 0 {
+		timeout = time.Duration(cfg.Settings.DefaultProxyTimeout) * time.Second
+	}
+
+	ports := map[string]*portConfig{}
+	for portconfig, targets := range cfg.Ports {
+		portrange, proto, ok := strings.Cut(portconfig, ".")
+		if !ok || (proto != "tcp" && proto != "udp") {
+			return nil, fmt.Errorf("invalid port '%s': expected PORT[-PORT].PROTOCOL with protocol tcp or udp", portconfig)
+		}
+		start, end, err := nat.ParsePortRangeToInt(portrange)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port '%s': %w", portconfig, err)
+		}
+		for port := start; port <= end; port++ {
+			key := fmt.Sprintf("%d.%s", port, proto)
+			if _, exists := ports[key]; exists {
+				return nil, fmt.Errorf("port %s is configured more than once", key)
+			}
+
+			peers := []*peer{}
+			for _, target := range targets {
+				opts, ok := cfg.Settings.Upstreams[portconfig][target]
+				if !ok {
+					opts = cfg.Settings.Upstreams[key][target]
+				}
+				p, err := newPeer(target, net.JoinHostPort(target, strconv.Itoa(port)), opts)
+				if err != nil {
+					return nil, fmt.Errorf("invalid options for target '%s' of port %s: %w", target, portconfig, err)
+				}
+				peers = append(peers, p)
+			}
+
+			portOpts, ok := cfg.Settings.PortOptions[portconfig]
+			if !ok {
+				portOpts = cfg.Settings.PortOptions[key]
+			}
+			if portOpts.ProxyProtocol && proto != "tcp" {
+				return nil, fmt.Errorf("the PROXY protocol can only be enabled for tcp ports, not for '%s'", portconfig)
+			}
+
+			ports[key] = &portConfig{
+				key:           key,
+				port:          port,
+				proto:         proto,
+				upstreams:     newPool(peers),
+				proxyProtocol: portOpts.ProxyProtocol,
+				timeout:       timeout,
+			}
+		}
+	}
+	return ports, nil
+}
+
+// resolveTargets looks up all targets of the ports, like nginx does when loading its config
+func resolveTargets(ctx context.Context, ports map[string]*portConfig) error {
+	keys := make([]string, 0, len(ports))
+	for key := range ports {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	resolved := map[string]bool{}
+	for _, key := range keys {
+		for _, p := range ports[key].upstreams.peers() {
+			if resolved[p.name] {
+				continue
+			}
+			lookupCtx, cancel := context.WithTimeout(ctx, resolveTimeout)
+			_, err := net.DefaultResolver.LookupHost(lookupCtx, p.name)
+			cancel()
+			if err != nil {
+				// same message as nginx, which k3d checks for when updating the loadbalancer
+				return fmt.Errorf("host not found in upstream \"%s\": %w", p.addr, err)
+			}
+			resolved[p.name] = true
+		}
+	}
+	return nil
+}
+
+// parseNginxTime parses a time like nginx does (e.g. 10s, 1m or 30 for seconds)
+func parseNginxTime(value string) (time.Duration, error) {
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	return time.ParseDuration(value)
+}
@@ -0,0 +1,135 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package loadbalancer
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	l "github.com/k3d-io/k3d/v5/pkg/logger"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+// healthCheck are the settings of the active health checks
+type healthCheck struct {
+	interval  time.Duration // 0 disables the active health checks
+	threshold int
+}
+
+func newHealthCheck(settings *k3d.LoadbalancerHealthCheck) (*healthCheck, error) {
+	hc := &healthCheck{threshold: k3d.DefaultLoadbalancerHealthThreshold}
+	interval := k3d.DefaultLoadbalancerHealthInterval
+	if settings != nil {
+		if settings.Interval != "" {
+			interval = settings.Interval
+		}
+		if settings.Threshold < 0 {
+			return nil, fmt.Errorf("invalid health check threshold %d: must not be negative", settings.Threshold)
+		} else if settings.Threshold > 0 {
+			hc.threshold = settings.Threshold
+		}
+	}
+	var err error
+	if hc.interval, err = parseNginxTime(interval); err != nil {
+		return nil, fmt.Errorf("invalid health check interval '%s': %w", interval, err)
+	}
+	return hc, nil
+}
+
+// checkHealth probes the targets of the tcp ports in the interval of the current config until the context is cancelled
+func (p *Proxy) checkHealth(ctx context.Context) {
+	for {
+		hc := p.health.Load()
+		wait := p.opts.ReloadInterval // check again for a config enabling the health checks
+		if hc != nil && hc.interval > 0 {
+			wait = hc.interval
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		if hc = p.health.Load(); hc != nil && hc.interval > 0 {
+			p.probe(ctx, hc.threshold)
+		}
+	}
+}
+
+// probe connects to every target of the tcp ports once (udp targets can't be probed) and updates their health
+func (p *Proxy) probe(ctx context.Context, threshold int) {
+	p.mu.Lock()
+	pools := make([]*pool, 0, len(p.ports))
+	for _, port := range p.ports {
+		if port.proto == "tcp" {
+			pools = append(pools, port.upstreams)
+		}
+	}
+	p.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, pl := range pools {
+		for _, target := range pl.peers() {
+			if target.down {
+				continue
+			}
+			wg.Add(1)
+			go func(pl *pool, target *peer) {
+				defer wg.Done()
+				dialer := net.Dialer{Timeout: defaultConnectTimeout}
+				conn, err := dialer.DialContext(ctx, "tcp", target.addr)
+				if err == nil {
+					conn.Close()
+				}
+				pl.probed(target, err, threshold)
+			}(pl, target)
+		}
+	}
+	wg.Wait()
+}
+
+// probed records the result of an active health check of the peer, taking it out of (or back into) rotation
+// after threshold consecutive failed (or successful) probes
+func (pl *pool) probed(p *peer, err error, threshold int) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	if err != nil {
+		p.probePasses = 0
+		p.probeFails++
+		if !p.unhealthy && p.probeFails >= threshold {
+			p.unhealthy = true
+			l.Log().Warnf("Taking target %s out of rotation after %d failed health checks: %v", p.addr, p.probeFails, err)
+		}
+		return
+	}
+	p.probeFails = 0
+	if p.unhealthy {
+		p.probePasses++
+		if p.probePasses >= threshold {
+			p.unhealthy = false
+			p.probePasses = 0
+			l.Log().Infof("Taking target %s back into rotation after %d successful health checks", p.addr, threshold)
+		}
+	}
+}
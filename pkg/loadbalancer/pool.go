@@ -0,0 +1,183 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package loadbalancer
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+// peer is a target of a port, with its health following nginx' passive health checks (max_fails/fail_timeout)
+// and the active health checks of the proxy (see Proxy.checkHealth)
+type peer struct {
+	name        string // target node
+	addr        string // target node and port
+	weight      int
+	backup      bool
+	down        bool
+	maxFails    int
+	failTimeout time.Duration
+
+	currentWeight int
+	fails         int
+	checked       time.Time // start of the current failure window
+
+	unhealthy   bool // failed the last threshold active health checks
+	probeFails  int  // consecutive failed active health checks
+	probePasses int  // consecutive successful active health checks while unhealthy
+}
+
+func newPeer(name string, addr string, opts k3d.LoadbalancerUpstreamOptions) (*peer, error) {
+	p := &peer{
+		name:     name,
+		addr:     addr,
+		weight:   1,
+		backup:   opts.Backup,
+		down:     opts.Down,
+		maxFails: k3d.DefaultLoadbalancerUpstreamMaxFails,
+	}
+	if opts.Weight < 0 {
+		return nil, fmt.Errorf("weight must not be negative")
+	} else if opts.Weight > 0 {
+		p.weight = opts.Weight
+	}
+	if opts.MaxFails != nil {
+		if *opts.MaxFails < 0 {
+			return nil, fmt.Errorf("maxFails must not be negative")
+		}
+		p.maxFails = *opts.MaxFails
+	}
+	failTimeout := opts.FailTimeout
+	if failTimeout == "" {
+		failTimeout = k3d.DefaultLoadbalancerUpstreamTimeout
+	}
+	timeout, err := parseNginxTime(failTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("invalid failTimeout '%s': %w", opts.FailTimeout, err)
+	}
+	p.failTimeout = timeout
+	return p, nil
+}
+
+// pool selects the peers of a port by smooth weighted round-robin (like nginx), falling back to the backups
+type pool struct {
+	mu      sync.Mutex
+	primary []*peer
+	backup  []*peer
+}
+
+func newPool(peers []*peer) *pool {
+	pl := &pool{}
+	for _, p := range peers {
+		if p.backup {
+			pl.backup = append(pl.backup, p)
+		} else {
+			pl.primary = append(pl.primary, p)
+		}
+	}
+	return pl
+}
+
+// peers returns all peers of the pool, the backups last
+func (pl *pool) peers() []*peer {
+	return append(append([]*peer{}, pl.primary...), pl.backup...)
+}
+
+// next returns the next available peer, skipping the ones in tried, or nil if there is none left
+func (pl *pool) next(tried map[*peer]bool) *peer {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+
+	now := time.Now()
+	if p := pickWeighted(pl.primary, tried, now); p != nil {
+		return p
+	}
+	return pickWeighted(pl.backup, tried, now)
+}
+
+func pickWeighted(peers []*peer, tried map[*peer]bool, now time.Time) *peer {
+	var best *peer
+	total := 0
+	for _, p := range peers {
+		if tried[p] || !p.available(len(peers), now) {
+			continue
+		}
+		p.currentWeight += p.weight
+		total += p.weight
+		if best == nil || p.currentWeight > best.currentWeight {
+			best = p
+		}
+	}
+	if best != nil {
+		best.currentWeight -= total
+	}
+	return best
+}
+
+// available returns false for drained and unhealthy peers and peers which failed maxFails times within failTimeout
+func (p *peer) available(poolSize int, now time.Time) bool {
+	if p.down {
+		return false
+	}
+	// like nginx, a single peer is never taken out of rotation because of failures
+	if poolSize == 1 {
+		return true
+	}
+	if p.unhealthy {
+		return false
+	}
+	if p.maxFails == 0 || p.fails < p.maxFails {
+		return true
+	}
+	if now.Sub(p.checked) > p.failTimeout {
+		// give it another chance after failTimeout
+		p.fails = 0
+		return true
+	}
+	return false
+}
+
+// failed records a failed connection attempt to the peer
+func (pl *pool) failed(p *peer) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	if p.maxFails == 0 {
+		return
+	}
+	now := time.Now()
+	if p.fails == 0 || now.Sub(p.checked) > p.failTimeout {
+		p.fails = 0
+		p.checked = now
+	}
+	p.fails++
+}
+
+// succeeded records a successful connection to the peer, resetting its failures
+func (pl *pool) succeeded(p *peer) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	p.fails = 0
+}
@@ -0,0 +1,291 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package loadbalancer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	l "github.com/k3d-io/k3d/v5/pkg/logger"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+// ProxyOpts configure the native loadbalancer proxy
+type ProxyOpts struct {
+	ConfigPath     string        // loadbalancer config, default: k3d.DefaultLoadbalancerConfigPath
+	ListenHost     string        // host to listen on for the proxied ports, default: all interfaces
+	StatusAddr     string        // address of the status endpoint, default: 127.0.0.1:k3d.DefaultLoadbalancerStatusPort, "-" disables it
+	ReloadInterval time.Duration // interval to check the config file for changes, default: 1s
+}
+
+// Proxy is the native loadbalancer: it proxies tcp and udp ports to the cluster nodes, configured by the k3d loadbalancer config
+type Proxy struct {
+	opts ProxyOpts
+
+	mu        sync.Mutex // serializes (re)loads
+	listeners map[string]listener
+	ports     map[string]*portConfig // ports of the current config
+	content   []byte                 // content of the last config file that was loaded successfully
+	ctx       context.Context
+
+	health atomic.Pointer[healthCheck] // settings of the active health checks of the current config
+
+	slots atomic.Pointer[chan struct{}] // workerConnections
+
+	active   atomic.Int64
+	accepted atomic.Int64
+	handled  atomic.Int64
+}
+
+// listener serves a single port of the loadbalancer
+type listener interface {
+	update(cfg *portConfig)
+	close()
+}
+
+// NewProxy creates a new native loadbalancer proxy
+func NewProxy(opts ProxyOpts) *Proxy {
+	if opts.ConfigPath == "" {
+		opts.ConfigPath = k3d.DefaultLoadbalancerConfigPath
+	}
+	if opts.StatusAddr == "" {
+		opts.StatusAddr = net.JoinHostPort("127.0.0.1", strconv.Itoa(k3d.DefaultLoadbalancerStatusPort))
+	}
+	if opts.ReloadInterval == 0 {
+		opts.ReloadInterval = time.Second
+	}
+	return &Proxy{
+		opts:      opts,
+		listeners: map[string]listener{},
+	}
+}
+
+// Run loads the config and proxies its ports until the context is cancelled, reloading the config when the file changes
+func (p *Proxy) Run(ctx context.Context) error {
+	p.ctx = ctx
+	if err := p.Reload(); err != nil {
+		return err
+	}
+	defer p.closeAll()
+
+	if p.opts.StatusAddr != "-" {
+		server, err := p.serveStatus()
+		if err != nil {
+			return err
+		}
+		defer server.Close()
+	}
+
+	go p.checkHealth(ctx)
+
+	ticker := time.NewTicker(p.opts.ReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			l.Log().Infoln("Stopping loadbalancer")
+			return nil
+		case <-ticker.C:
+			if err := p.reload(false); err != nil {
+				l.Log().Errorln(err)
+			}
+		}
+	}
+}
+
+// Reload re-reads the config file and applies it, keeping the current config if the new one is invalid
+func (p *Proxy) Reload() error {
+	return p.reload(true)
+}
+
+func (p *Proxy) reload(force bool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	cfg, content, err := ReadConfig(p.opts.ConfigPath)
+	if err != nil {
+		return err
+	}
+	// the config file is written without a modification time, so compare its content instead
+	if !force && p.content != nil && bytes.Equal(content, p.content) {
+		return nil
+	}
+	// don't pick up the same (invalid) change again
+	previous := p.content
+	p.content = content
+
+	ports, err := buildPortConfigs(cfg)
+	var health *healthCheck
+	if err == nil {
+		health, err = newHealthCheck(cfg.Settings.HealthCheck)
+	}
+	if err == nil {
+		err = resolveTargets(p.ctx, ports)
+	}
+	if err == nil {
+		err = p.apply(cfg, ports)
+	}
+	if err != nil {
+		if previous == nil {
+			return err
+		}
+		return fmt.Errorf("failed to reload loadbalancer config, keeping the previous one: %w", err)
+	}
+	p.ports = ports
+	p.health.Store(health)
+
+	// the message k3d waits for when creating or updating the loadbalancer (see k3d.ReadyLogMessagesByRoleAndIntent)
+	l.Log().Infof("%s: proxying %d port(s)", k3d.ReadyLogMessagesByRoleAndIntent[k3d.LoadBalancerRole][k3d.IntentAny], len(ports))
+	return nil
+}
+
+// apply opens the listeners of new ports, closes the ones of removed ports and updates the others in place
+func (p *Proxy) apply(cfg k3d.LoadbalancerConfig, ports map[string]*portConfig) error {
+	workerConnections := cfg.Settings.WorkerConnections
+	if workerConnections <= 0 {
+		workerConnections = k3d.DefaultLoadbalancerWorkerConnections
+	}
+	if slots := p.slots.Load(); slots == nil || cap(*slots) != workerConnections {
+		// connections that are already open keep their slot in the old limit
+		newSlots := make(chan struct{}, workerConnections)
+		p.slots.Store(&newSlots)
+	}
+
+	keys := make([]string, 0, len(ports))
+	for key := range ports {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	opened := map[string]listener{}
+	for _, key := range keys {
+		if _, ok := p.listeners[key]; ok {
+			continue
+		}
+		ln, err := p.listen(ports[key])
+		if err != nil {
+			for _, o := range opened {
+				o.close()
+			}
+			return fmt.Errorf("failed to listen on port %s: %w", key, err)
+		}
+		opened[key] = ln
+	}
+
+	for key, ln := range p.listeners {
+		if cfg, ok := ports[key]; ok {
+			ln.update(cfg)
+		} else {
+			ln.close()
+			delete(p.listeners, key)
+		}
+	}
+	for key, ln := range opened {
+		p.listeners[key] = ln
+	}
+	return nil
+}
+
+func (p *Proxy) listen(cfg *portConfig) (listener, error) {
+	addr := net.JoinHostPort(p.opts.ListenHost, strconv.Itoa(cfg.port))
+	if cfg.proto == "udp" {
+		conn, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			return nil, err
+		}
+		return newUDPListener(p, conn, cfg), nil
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return newTCPListener(p, ln, cfg), nil
+}
+
+func (p *Proxy) closeAll() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for key, ln := range p.listeners {
+		ln.close()
+		delete(p.listeners, key)
+	}
+}
+
+// acquire takes a connection slot, returning false if workerConnections are in use
+func (p *Proxy) acquire() (release func(), ok bool) {
+	slots := *p.slots.Load()
+	p.accepted.Add(1)
+	select {
+	case slots <- struct{}{}:
+	default:
+		return nil, false
+	}
+	p.handled.Add(1)
+	p.active.Add(1)
+	return func() {
+		p.active.Add(-1)
+		<-slots
+	}, true
+}
+
+// serveStatus serves the connection counters (in the format of nginx' stub_status) and a reload endpoint
+func (p *Proxy) serveStatus() (*http.Server, error) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		active := p.active.Load()
+		fmt.Fprintf(w, "Active connections: %d \nserver accepts handled requests\n %d %d 0 \nReading: 0 Writing: %d Waiting: 0 \n", active, p.accepted.Load(), p.handled.Load(), active)
+	})
+	mux.HandleFunc("/reload", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := p.Reload(); err != nil {
+			l.Log().Errorln(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintln(w, "reloaded")
+	})
+
+	ln, err := net.Listen("tcp", p.opts.StatusAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on status address %s: %w", p.opts.StatusAddr, err)
+	}
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			l.Log().Errorf("Status endpoint failed: %v", err)
+		}
+	}()
+	return server, nil
+}
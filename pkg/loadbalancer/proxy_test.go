@@ -0,0 +1,353 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package loadbalancer
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"sigs.k8s.io/yaml"
+
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+func TestBuildPortConfigs(t *testing.T) {
+	maxFails := 0
+	ports, err := buildPortConfigs(k3d.LoadbalancerConfig{
+		Ports: map[string][]string{
+			"6443.tcp":        {"server-0", "server-1"},
+			"30000-30002.udp": {"agent-0"},
+		},
+		Settings: k3d.LoadBalancerSettings{
+			Upstreams: map[string]map[string]k3d.LoadbalancerUpstreamOptions{
+				"6443.tcp":        {"server-1": {Weight: 3, Backup: true, FailTimeout: "30"}},
+				"30000-30002.udp": {"agent-0": {MaxFails: &maxFails}},
+			},
+			PortOptions: map[string]k3d.LoadbalancerPortOptions{"6443.tcp": {ProxyProtocol: true}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to build port configs: %v", err)
+	}
+	if len(ports) != 4 {
+		t.Fatalf("expected 4 ports, got %d", len(ports))
+	}
+	api := ports["6443.tcp"]
+	if !api.proxyProtocol || api.timeout != defaultProxyTimeout {
+		t.Errorf("unexpected options of port 6443.tcp: %+v", api)
+	}
+	if len(api.upstreams.primary) != 1 || len(api.upstreams.backup) != 1 {
+		t.Fatalf("expected one primary and one backup upstream, got %+v", api.upstreams)
+	}
+	if backup := api.upstreams.backup[0]; backup.addr != "server-1:6443" || backup.weight != 3 || backup.failTimeout != 30*time.Second {
+		t.Errorf("unexpected backup upstream: %+v", backup)
+	}
+	udp := ports["30001.udp"]
+	if udp == nil || udp.proto != "udp" || udp.upstreams.primary[0].addr != "agent-0:30001" || udp.upstreams.primary[0].maxFails != 0 {
+		t.Errorf("unexpected port 30001.udp: %+v", udp)
+	}
+
+	for name, cfg := range map[string]k3d.LoadbalancerConfig{
+		"http routes": {
+			HTTP: []k3d.LoadbalancerHTTPServer{{Host: "app.localhost", Listen: 80}},
+		},
+		"invalid protocol": {
+			Ports: map[string][]string{"80.sctp": {"agent-0"}},
+		},
+		"proxy protocol on udp": {
+			Ports:    map[string][]string{"53.udp": {"agent-0"}},
+			Settings: k3d.LoadBalancerSettings{PortOptions: map[string]k3d.LoadbalancerPortOptions{"53.udp": {ProxyProtocol: true}}},
+		},
+		"overlapping ports": {
+			Ports: map[string][]string{"80.tcp": {"agent-0"}, "79-81.tcp": {"agent-1"}},
+		},
+		"invalid fail timeout": {
+			Ports: map[string][]string{"80.tcp": {"agent-0"}},
+			Settings: k3d.LoadBalancerSettings{Upstreams: map[string]map[string]k3d.LoadbalancerUpstreamOptions{
+				"80.tcp": {"agent-0": {FailTimeout: "soon"}},
+			}},
+		},
+	} {
+		if _, err := buildPortConfigs(cfg); err == nil {
+			t.Errorf("expected an error for %s", name)
+		}
+	}
+}
+
+func TestPool(t *testing.T) {
+	newTestPeer := func(name string, opts k3d.LoadbalancerUpstreamOptions) *peer {
+		p, err := newPeer(name, name+":80", opts)
+		if err != nil {
+			t.Fatalf("failed to create peer: %v", err)
+		}
+		return p
+	}
+	a := newTestPeer("a", k3d.LoadbalancerUpstreamOptions{Weight: 2})
+	b := newTestPeer("b", k3d.LoadbalancerUpstreamOptions{})
+	c := newTestPeer("c", k3d.LoadbalancerUpstreamOptions{Backup: true})
+	d := newTestPeer("d", k3d.LoadbalancerUpstreamOptions{Down: true})
+	pl := newPool([]*peer{a, b, c, d})
+
+	picked := ""
+	for i := 0; i < 6; i++ {
+		picked += pl.next(nil).name
+	}
+	if picked != "abaaba" {
+		t.Errorf("expected smooth weighted round-robin 'abaaba', got '%s'", picked)
+	}
+
+	// a failed peer is skipped until its failTimeout passed, the backup is only used if no primary peer is left
+	pl.failed(a)
+	if p := pl.next(nil); p != b {
+		t.Errorf("expected b after a failed, got %s", p.name)
+	}
+	if p := pl.next(map[*peer]bool{b: true}); p != c {
+		t.Errorf("expected the backup c after b was tried, got %v", p)
+	}
+	a.checked = time.Now().Add(-time.Minute)
+	if p := pl.next(map[*peer]bool{b: true}); p != a {
+		t.Errorf("expected a after its failTimeout passed, got %v", p)
+	}
+	if p := pl.next(map[*peer]bool{a: true, b: true, c: true}); p != nil {
+		t.Errorf("expected no peer left, got %s", p.name)
+	}
+
+	// a single peer is never taken out of rotation
+	single := newPool([]*peer{newTestPeer("e", k3d.LoadbalancerUpstreamOptions{})})
+	single.failed(single.primary[0])
+	if p := single.next(nil); p == nil {
+		t.Error("expected a single peer to stay available after a failure")
+	}
+}
+
+func TestHealthCheck(t *testing.T) {
+	if hc, err := newHealthCheck(nil); err != nil || hc.interval != 5*time.Second || hc.threshold != k3d.DefaultLoadbalancerHealthThreshold {
+		t.Errorf("unexpected default health check settings: %+v (%v)", hc, err)
+	}
+	if hc, err := newHealthCheck(&k3d.LoadbalancerHealthCheck{Interval: "0"}); err != nil || hc.interval != 0 {
+		t.Errorf("expected interval 0 to disable the health checks, got %+v (%v)", hc, err)
+	}
+	for _, settings := range []k3d.LoadbalancerHealthCheck{{Interval: "often"}, {Threshold: -1}} {
+		if _, err := newHealthCheck(&settings); err == nil {
+			t.Errorf("expected an error for health check settings %+v", settings)
+		}
+	}
+
+	alivePort, deadPort := freePort(t), freePort(t)
+	echoServer(t, alivePort, "")
+	alive, err := newPeer("alive", fmt.Sprintf("127.0.0.2:%d", alivePort), k3d.LoadbalancerUpstreamOptions{})
+	if err != nil {
+		t.Fatalf("failed to create peer: %v", err)
+	}
+	dead, err := newPeer("dead", fmt.Sprintf("127.0.0.2:%d", deadPort), k3d.LoadbalancerUpstreamOptions{})
+	if err != nil {
+		t.Fatalf("failed to create peer: %v", err)
+	}
+	pl := newPool([]*peer{alive, dead})
+	proxy := NewProxy(ProxyOpts{})
+	proxy.ports = map[string]*portConfig{"80.tcp": {key: "80.tcp", proto: "tcp", upstreams: pl}}
+
+	// the dead peer is only taken out of rotation after threshold failed probes
+	proxy.probe(context.Background(), 2)
+	if dead.unhealthy {
+		t.Fatalf("expected the dead peer to stay in rotation after a single failed probe")
+	}
+	proxy.probe(context.Background(), 2)
+	if !dead.unhealthy || alive.unhealthy {
+		t.Fatalf("expected only the dead peer to be unhealthy after two failed probes, got alive=%t dead=%t", alive.unhealthy, dead.unhealthy)
+	}
+	for i := 0; i < 3; i++ {
+		if p := pl.next(nil); p != alive {
+			t.Errorf("expected only the alive peer to be picked, got %s", p.name)
+		}
+	}
+
+	// and taken back into rotation after threshold successful probes
+	echoServer(t, deadPort, "")
+	proxy.probe(context.Background(), 2)
+	proxy.probe(context.Background(), 2)
+	if dead.unhealthy {
+		t.Errorf("expected the peer to be healthy again after two successful probes")
+	}
+}
+
+// freePort returns a port that's free on both 127.0.0.1 (the proxy) and 127.0.0.2 (the upstream)
+func freePort(t *testing.T) int {
+	t.Helper()
+	for i := 0; i < 10; i++ {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("failed to find a free port: %v", err)
+		}
+		port := ln.Addr().(*net.TCPAddr).Port
+		ln.Close()
+		if other, err := net.Listen("tcp", fmt.Sprintf("127.0.0.2:%d", port)); err == nil {
+			other.Close()
+			return port
+		}
+	}
+	t.Skip("no free port found on 127.0.0.2")
+	return 0
+}
+
+// echoServer answers every line with its prefix and the line
+func echoServer(t *testing.T, port int, prefix string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", fmt.Sprintf("127.0.0.2:%d", port))
+	if err != nil {
+		t.Skipf("failed to listen on 127.0.0.2: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					fmt.Fprintf(conn, "%s%s\n", prefix, scanner.Text())
+				}
+			}()
+		}
+	}()
+}
+
+func writeTestConfig(t *testing.T, path string, cfg k3d.LoadbalancerConfig) {
+	t.Helper()
+	content, err := yaml.Marshal(cfg)
+	if err != nil {
+		t.Fatalf("failed to marshal config: %v", err)
+	}
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+}
+
+func roundTrip(t *testing.T, port int, line string) string {
+	t.Helper()
+	conn, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", port), time.Second)
+	if err != nil {
+		t.Fatalf("failed to connect to the proxy: %v", err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	fmt.Fprintln(conn, line)
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatalf("failed to read from the proxy: %v", err)
+	}
+	return strings.TrimSpace(reply)
+}
+
+func TestProxyTCP(t *testing.T) {
+	port := freePort(t)
+	echoServer(t, port, "echo: ")
+
+	configPath := filepath.Join(t.TempDir(), "values.yaml")
+	portKey := fmt.Sprintf("%d.tcp", port)
+	writeTestConfig(t, configPath, k3d.LoadbalancerConfig{
+		Ports:    map[string][]string{portKey: {"127.0.0.2"}},
+		Settings: k3d.LoadBalancerSettings{WorkerConnections: 16},
+	})
+
+	proxy := NewProxy(ProxyOpts{ConfigPath: configPath, ListenHost: "127.0.0.1", StatusAddr: "-", ReloadInterval: 50 * time.Millisecond})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- proxy.Run(ctx) }()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("proxy failed: %v", err)
+		}
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+		if err == nil {
+			conn.Close()
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("proxy didn't start listening: %v", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	if reply := roundTrip(t, port, "hello"); reply != "echo: hello" {
+		t.Errorf("expected 'echo: hello', got '%s'", reply)
+	}
+
+	// enabling the PROXY protocol is picked up by the file watcher without reopening the port
+	writeTestConfig(t, configPath, k3d.LoadbalancerConfig{
+		Ports: map[string][]string{portKey: {"127.0.0.2"}},
+		Settings: k3d.LoadBalancerSettings{
+			WorkerConnections: 16,
+			PortOptions:       map[string]k3d.LoadbalancerPortOptions{portKey: {ProxyProtocol: true}},
+		},
+	})
+	for {
+		reply := roundTrip(t, port, "hello")
+		if strings.HasPrefix(reply, "echo: PROXY TCP4 127.0.0.1 127.0.0.1 ") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the PROXY protocol header to be sent after the reload, got '%s'", reply)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	// an unresolvable target keeps the previous config
+	writeTestConfig(t, configPath, k3d.LoadbalancerConfig{
+		Ports: map[string][]string{portKey: {"k3d-does-not-exist.invalid"}},
+	})
+	if err := proxy.Reload(); err == nil || !strings.Contains(err.Error(), "host not found in upstream") {
+		t.Errorf("expected reload to fail with 'host not found in upstream', got %v", err)
+	}
+	if reply := roundTrip(t, port, "still"); !strings.HasPrefix(reply, "echo: PROXY") {
+		t.Errorf("expected the previous config to be kept, got '%s'", reply)
+	}
+
+	// removed ports are closed
+	writeTestConfig(t, configPath, k3d.LoadbalancerConfig{Ports: map[string][]string{}})
+	if err := proxy.Reload(); err != nil {
+		t.Fatalf("failed to reload: %v", err)
+	}
+	if conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port)); err == nil {
+		conn.Close()
+		t.Error("expected the port to be closed after it was removed from the config")
+	}
+	if accepted := proxy.accepted.Load(); accepted < 3 {
+		t.Errorf("expected at least 3 accepted connections, got %d", accepted)
+	}
+}
@@ -0,0 +1,180 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package loadbalancer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	l "github.com/k3d-io/k3d/v5/pkg/logger"
+)
+
+type tcpListener struct {
+	proxy  *Proxy
+	ln     net.Listener
+	cfg    atomic.Pointer[portConfig]
+	closed atomic.Bool
+}
+
+func newTCPListener(p *Proxy, ln net.Listener, cfg *portConfig) *tcpListener {
+	t := &tcpListener{proxy: p, ln: ln}
+	t.cfg.Store(cfg)
+	go t.serve()
+	return t
+}
+
+func (t *tcpListener) update(cfg *portConfig) {
+	t.cfg.Store(cfg)
+}
+
+func (t *tcpListener) close() {
+	t.closed.Store(true)
+	t.ln.Close()
+}
+
+func (t *tcpListener) serve() {
+	for {
+		conn, err := t.ln.Accept()
+		if err != nil {
+			if t.closed.Load() {
+				return
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+			l.Log().Errorf("Failed to accept connection on port %s: %v", t.cfg.Load().key, err)
+			return
+		}
+		release, ok := t.proxy.acquire()
+		if !ok {
+			l.Log().Warnf("Dropping connection from %s on port %s: %d worker_connections are not enough", conn.RemoteAddr(), t.cfg.Load().key, cap(*t.proxy.slots.Load()))
+			conn.Close()
+			continue
+		}
+		go func() {
+			defer release()
+			t.handle(conn, t.cfg.Load())
+		}()
+	}
+}
+
+// handle connects the client to the next available upstream, trying the others if that fails
+func (t *tcpListener) handle(client net.Conn, cfg *portConfig) {
+	defer client.Close()
+
+	tried := map[*peer]bool{}
+	var upstream net.Conn
+	for {
+		pr := cfg.upstreams.next(tried)
+		if pr == nil {
+			l.Log().Errorf("no live upstreams while connecting to upstream, client: %s, server: %s", client.RemoteAddr(), cfg.key)
+			return
+		}
+		tried[pr] = true
+		conn, err := net.DialTimeout("tcp", pr.addr, defaultConnectTimeout)
+		if err != nil {
+			cfg.upstreams.failed(pr)
+			l.Log().Errorf("connect() to %s failed (%v) while connecting to upstream, client: %s, server: %s", pr.addr, err, client.RemoteAddr(), cfg.key)
+			continue
+		}
+		cfg.upstreams.succeeded(pr)
+		upstream = conn
+		break
+	}
+	defer upstream.Close()
+
+	if cfg.proxyProtocol {
+		if _, err := io.WriteString(upstream, proxyProtocolHeader(client)); err != nil {
+			l.Log().Errorf("Failed to send PROXY protocol header to %s: %v", upstream.RemoteAddr(), err)
+			return
+		}
+	}
+
+	pipe(client, upstream, cfg.timeout)
+}
+
+// proxyProtocolHeader returns the PROXY protocol (v1) header for a client connection
+func proxyProtocolHeader(client net.Conn) string {
+	src, srcOk := client.RemoteAddr().(*net.TCPAddr)
+	dst, dstOk := client.LocalAddr().(*net.TCPAddr)
+	if !srcOk || !dstOk {
+		return "PROXY UNKNOWN\r\n"
+	}
+	family := "TCP6"
+	if src.IP.To4() != nil && dst.IP.To4() != nil {
+		family = "TCP4"
+		src.IP, dst.IP = src.IP.To4(), dst.IP.To4()
+	}
+	return fmt.Sprintf("PROXY %s %s %s %d %d\r\n", family, src.IP, dst.IP, src.Port, dst.Port)
+}
+
+// pipe copies data in both directions until both are done or nothing was sent for the timeout (like nginx' proxy_timeout)
+func pipe(client net.Conn, upstream net.Conn, timeout time.Duration) {
+	var lastActivity atomic.Int64
+	lastActivity.Store(time.Now().UnixNano())
+
+	var wg sync.WaitGroup
+	copyConn := func(dst net.Conn, src net.Conn) {
+		defer wg.Done()
+		buf := make([]byte, 32*1024)
+		for {
+			_ = src.SetReadDeadline(time.Now().Add(timeout))
+			n, err := src.Read(buf)
+			if n > 0 {
+				lastActivity.Store(time.Now().UnixNano())
+				if _, werr := dst.Write(buf[:n]); werr != nil {
+					return
+				}
+			}
+			if err != nil {
+				var netErr net.Error
+				if errors.As(err, &netErr) && netErr.Timeout() {
+					// the other direction may still be active
+					if time.Since(time.Unix(0, lastActivity.Load())) < timeout {
+						continue
+					}
+					client.Close()
+					upstream.Close()
+					return
+				}
+				if tcp, ok := dst.(interface{ CloseWrite() error }); ok && errors.Is(err, io.EOF) {
+					_ = tcp.CloseWrite()
+				} else {
+					client.Close()
+					upstream.Close()
+				}
+				return
+			}
+		}
+	}
+	wg.Add(2)
+	go copyConn(upstream, client)
+	go copyConn(client, upstream)
+	wg.Wait()
+}
@@ -0,0 +1,159 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package loadbalancer
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	l "github.com/k3d-io/k3d/v5/pkg/logger"
+)
+
+// udpListener proxies datagrams, keeping a session (i.e. an upstream) per client address like nginx does
+type udpListener struct {
+	proxy    *Proxy
+	conn     net.PacketConn
+	cfg      atomic.Pointer[portConfig]
+	closed   atomic.Bool
+	mu       sync.Mutex
+	sessions map[string]*udpSession
+}
+
+type udpSession struct {
+	upstream     net.Conn
+	lastActivity atomic.Int64
+}
+
+func newUDPListener(p *Proxy, conn net.PacketConn, cfg *portConfig) *udpListener {
+	u := &udpListener{proxy: p, conn: conn, sessions: map[string]*udpSession{}}
+	u.cfg.Store(cfg)
+	go u.serve()
+	return u
+}
+
+func (u *udpListener) update(cfg *portConfig) {
+	u.cfg.Store(cfg)
+}
+
+func (u *udpListener) close() {
+	u.closed.Store(true)
+	u.conn.Close()
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for _, s := range u.sessions {
+		s.upstream.Close()
+	}
+}
+
+func (u *udpListener) serve() {
+	buf := make([]byte, 64*1024)
+	for {
+		n, client, err := u.conn.ReadFrom(buf)
+		if err != nil {
+			if !u.closed.Load() {
+				l.Log().Errorf("Failed to read from port %s: %v", u.cfg.Load().key, err)
+			}
+			return
+		}
+		s := u.session(client)
+		if s == nil {
+			continue
+		}
+		s.lastActivity.Store(time.Now().UnixNano())
+		if _, err := s.upstream.Write(buf[:n]); err != nil {
+			l.Log().Errorf("Failed to send datagram to upstream %s: %v", s.upstream.RemoteAddr(), err)
+		}
+	}
+}
+
+// session returns the session of the client, connecting it to the next available upstream if it's new
+func (u *udpListener) session(client net.Addr) *udpSession {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if s, ok := u.sessions[client.String()]; ok {
+		return s
+	}
+	if u.closed.Load() {
+		return nil
+	}
+
+	release, ok := u.proxy.acquire()
+	if !ok {
+		l.Log().Warnf("Dropping datagram from %s on port %s: %d worker_connections are not enough", client, u.cfg.Load().key, cap(*u.proxy.slots.Load()))
+		return nil
+	}
+
+	cfg := u.cfg.Load()
+	tried := map[*peer]bool{}
+	for {
+		pr := cfg.upstreams.next(tried)
+		if pr == nil {
+			l.Log().Errorf("no live upstreams while connecting to upstream, client: %s, server: %s", client, cfg.key)
+			release()
+			return nil
+		}
+		tried[pr] = true
+		upstream, err := net.DialTimeout("udp", pr.addr, defaultConnectTimeout)
+		if err != nil {
+			cfg.upstreams.failed(pr)
+			l.Log().Errorf("connect() to %s failed (%v) while connecting to upstream, client: %s, server: %s", pr.addr, err, client, cfg.key)
+			continue
+		}
+		s := &udpSession{upstream: upstream}
+		u.sessions[client.String()] = s
+		go u.reply(client, s, cfg.timeout, release)
+		return s
+	}
+}
+
+// reply sends the datagrams of the upstream back to the client until the session was idle for the timeout
+func (u *udpListener) reply(client net.Addr, s *udpSession, timeout time.Duration, release func()) {
+	defer func() {
+		u.mu.Lock()
+		delete(u.sessions, client.String())
+		u.mu.Unlock()
+		s.upstream.Close()
+		release()
+	}()
+
+	buf := make([]byte, 64*1024)
+	for {
+		_ = s.upstream.SetReadDeadline(time.Now().Add(timeout))
+		n, err := s.upstream.Read(buf)
+		if n > 0 {
+			s.lastActivity.Store(time.Now().UnixNano())
+			if _, err := u.conn.WriteTo(buf[:n], client); err != nil {
+				return
+			}
+		}
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() && time.Since(time.Unix(0, s.lastActivity.Load())) < timeout {
+				// the client is still sending
+				continue
+			}
+			return
+		}
+	}
+}
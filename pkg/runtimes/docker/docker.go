@@ -29,6 +29,7 @@ import (
 	"os"
 
 	l "github.com/k3d-io/k3d/v5/pkg/logger"
+	runtimeTypes "github.com/k3d-io/k3d/v5/pkg/runtimes/types"
 )
 
 type Docker struct{}
@@ -37,6 +38,20 @@ const (
 	DefaultDockerSock = "/var/run/docker.sock"
 )
 
+// connectionOpts override the connection settings of the docker CLI (i.e. DOCKER_HOST, DOCKER_CERT_PATH, etc.)
+var connectionOpts runtimeTypes.ConnectionOpts
+
+// SetConnectionOpts sets the endpoint, TLS material and timeout used to connect to the docker daemon
+func (d Docker) SetConnectionOpts(opts runtimeTypes.ConnectionOpts) error {
+	if opts.Endpoint != "" {
+		if _, err := url.Parse(opts.Endpoint); err != nil {
+			return fmt.Errorf("failed to parse docker endpoint '%s': %w", opts.Endpoint, err)
+		}
+	}
+	connectionOpts = opts
+	return nil
+}
+
 // ID returns the identity of the runtime
 func (d Docker) ID() string {
 	return "docker"
@@ -55,8 +70,11 @@ func (d Docker) GetHost() string {
 		l.Log().Traceln("[Docker] Not using docker-machine")
 	}
 
-	// b) DOCKER_HOST env var
-	dockerHost := os.Getenv("DOCKER_HOST")
+	// b) configured endpoint or DOCKER_HOST env var
+	dockerHost := connectionOpts.Endpoint
+	if dockerHost == "" {
+		dockerHost = os.Getenv("DOCKER_HOST")
+	}
 	if dockerHost == "" {
 		l.Log().Traceln("[Docker] GetHost: DOCKER_HOST empty/unset")
 		info, err := d.Info()
@@ -93,6 +111,9 @@ func (d Docker) GetHost() string {
 
 // GetRuntimePath returns the path of the docker socket
 func (d Docker) GetRuntimePath() string {
+	if endpoint, err := url.Parse(connectionOpts.Endpoint); err == nil && endpoint.Scheme == "unix" {
+		return endpoint.Path
+	}
 	dockerSock := os.Getenv("DOCKER_SOCK")
 	if dockerSock == "" {
 		dockerSock = DefaultDockerSock
@@ -37,6 +37,7 @@ import (
 	l "github.com/k3d-io/k3d/v5/pkg/logger"
 	runtimeErr "github.com/k3d-io/k3d/v5/pkg/runtimes/errors"
 	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+	"github.com/k3d-io/k3d/v5/pkg/util"
 
 	dockercliopts "github.com/docker/cli/opts"
 	dockerunits "github.com/docker/go-units"
@@ -74,6 +75,10 @@ func TranslateNodeToContainer(node *k3d.Node) (*NodeInDocker, error) {
 			}
 		}
 	}
+	if node.Role == k3d.LoadBalancerRole && node.RuntimeLabels[k3d.LabelLoadbalancerCopyBinary] == "true" {
+		// the k3d binary copied into the native loadbalancer
+		containerConfig.Entrypoint = []string{k3d.DefaultLoadbalancerNativeBinary}
+	}
 
 	containerConfig.Cmd = []string{}
 
@@ -122,6 +127,16 @@ func TranslateNodeToContainer(node *k3d.Node) (*NodeInDocker, error) {
 		hostConfig.Memory = memory
 	}
 
+	// cpu limits
+	if node.CPUs != "" {
+		cpus, err := util.ParseCPUs(node.CPUs)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to set CPU limit: %+v", err)
+		}
+		hostConfig.NanoCPUs = cpus
+	}
+	hostConfig.CpusetCpus = node.CPUSet
+
 	/* They have to run in privileged mode */
 	// TODO: can we replace this by a reduced set of capabilities?
 	hostConfig.Privileged = true
@@ -337,6 +352,8 @@ func TranslateContainerDetailsToNode(containerDetails types.ContainerJSON) (*k3d
 		AgentOpts:     k3d.AgentOpts{},
 		State:         nodeState,
 		Memory:        memoryStr,
+		CPUs:          util.FormatCPUs(containerDetails.HostConfig.NanoCPUs),
+		CPUSet:        containerDetails.HostConfig.CpusetCpus,
 		IP:            nodeIP, // only valid for the cluster network
 	}
 	return node, nil
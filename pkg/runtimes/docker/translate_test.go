@@ -55,6 +55,8 @@ func TestTranslateNodeToContainer(t *testing.T) {
 		Restart:       true,
 		RuntimeLabels: map[string]string{k3d.LabelRole: string(k3d.ServerRole), "test_key_1": "test_val_1"},
 		Networks:      []string{"mynet"},
+		CPUs:          "1.5",
+		CPUSet:        "0-1",
 	}
 
 	init := true
@@ -83,6 +85,10 @@ func TestTranslateNodeToContainer(t *testing.T) {
 			Privileged: true,
 			UsernsMode: "host",
 			Tmpfs:      map[string]string{"/run": "", "/var/run": ""},
+			Resources: container.Resources{
+				NanoCPUs:   1500000000,
+				CpusetCpus: "0-1",
+			},
 			PortBindings: nat.PortMap{
 				"6443/tcp": {
 					{
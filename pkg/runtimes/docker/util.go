@@ -40,6 +40,7 @@ import (
 	"github.com/docker/docker/pkg/archive"
 	l "github.com/k3d-io/k3d/v5/pkg/logger"
 	runtimeErrors "github.com/k3d-io/k3d/v5/pkg/runtimes/errors"
+	runtimeTypes "github.com/k3d-io/k3d/v5/pkg/runtimes/types"
 	k3d "github.com/k3d-io/k3d/v5/pkg/types"
 	"github.com/pkg/errors"
 	"github.com/spf13/pflag"
@@ -192,6 +193,9 @@ func GetDockerClient() (client.APIClient, error) {
 
 	flagset := pflag.NewFlagSet("docker", pflag.ContinueOnError)
 	newClientOpts.InstallFlags(flagset)
+	if err := applyConnectionOpts(flagset); err != nil {
+		return nil, fmt.Errorf("failed to apply docker connection settings: %w", err)
+	}
 	newClientOpts.SetDefaultOptions(flagset)
 
 	err = dockerCli.Initialize(newClientOpts)
@@ -199,9 +203,44 @@ func GetDockerClient() (client.APIClient, error) {
 		return nil, fmt.Errorf("failed to initialize docker CLI: %w", err)
 	}
 
+	// the timeout only applies to establishing the connection, as streams (e.g. logs) may be open for a long time
+	if connectionOpts.Timeout > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), connectionOpts.Timeout)
+		defer cancel()
+		if _, err := dockerCli.Client().Ping(ctx); err != nil {
+			return nil, fmt.Errorf("failed to connect to docker daemon within %s: %w", connectionOpts.Timeout, err)
+		}
+	}
+
 	return dockerCli.Client(), nil
 }
 
+// applyConnectionOpts sets the configured connection settings as docker CLI flags,
+// so that they take precedence over the environment (DOCKER_HOST, DOCKER_CERT_PATH, etc.)
+func applyConnectionOpts(flagset *pflag.FlagSet) error {
+	overrides := map[string]string{
+		"host":      connectionOpts.Endpoint,
+		"tlscacert": connectionOpts.TLS.CACert,
+		"tlscert":   connectionOpts.TLS.Cert,
+		"tlskey":    connectionOpts.TLS.Key,
+	}
+	if connectionOpts.TLS != (runtimeTypes.TLSOpts{}) {
+		overrides["tls"] = "true"
+	}
+	if connectionOpts.TLS.CACert != "" {
+		overrides[flags.FlagTLSVerify] = "true"
+	}
+	for flag, value := range overrides {
+		if value == "" {
+			continue
+		}
+		if err := flagset.Set(flag, value); err != nil {
+			return fmt.Errorf("failed to set '%s': %w", flag, err)
+		}
+	}
+	return nil
+}
+
 // isAttachedToNetwork return true if node is attached to network
 func isAttachedToNetwork(node *k3d.Node, network string) bool {
 	for _, nw := range node.Networks {
@@ -0,0 +1,198 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+// Package fake provides an in-memory implementation of the k3d runtime interface.
+// It simulates containers, labels, networks (incl. IPAM), volumes, files and logs of nodes
+// and is meant to test cluster orchestration logic without a container engine.
+package fake
+
+import (
+	"fmt"
+	"net/netip"
+	"os"
+	"sync"
+	"time"
+
+	runtimeTypes "github.com/k3d-io/k3d/v5/pkg/runtimes/types"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+// ExecHandler is called for every command executed in a node and returns the command's output.
+// stdin is only set for ExecInNodeWithStdin.
+type ExecHandler func(node *k3d.Node, cmd []string, stdin []byte) (string, error)
+
+// Runtime is an in-memory container runtime. The zero value is not usable, use NewRuntime() instead.
+type Runtime struct {
+	mu sync.Mutex
+
+	containers map[string]*container // by name
+	networks   map[string]*network   // by name
+	volumes    map[string]map[string]string
+	volumeData map[string]map[string]*file // files stored in named volumes, by volume name and path relative to the mount point
+	images     []string
+
+	nextContainerID int
+	nextNetworkID   int
+	nextSubnet      int
+
+	// LogScripts are the log lines emitted when a node with the given role is started
+	LogScripts map[k3d.Role][]string
+	// FileWriteLogScripts are the log lines emitted when a file is written to the given path of a node (e.g. simulating a config reload)
+	FileWriteLogScripts map[string][]string
+	// RoleFiles are the files present in every new node of the given role (i.e. as if they were part of the image)
+	RoleFiles map[k3d.Role]map[string][]byte
+	// ExecHandler (optional) simulates the output and result of commands executed in nodes
+	ExecHandler ExecHandler
+}
+
+type container struct {
+	id      string
+	node    *k3d.Node
+	labels  map[string]string // all labels, not only the k3d.* ones
+	files   map[string]*file
+	logs    []logLine
+	execLog [][]string
+}
+
+type file struct {
+	content []byte
+	mode    os.FileMode
+}
+
+type logLine struct {
+	time time.Time
+	text string
+}
+
+type network struct {
+	id      string
+	name    string
+	labels  map[string]string
+	prefix  netip.Prefix
+	gateway netip.Addr
+	members map[string]netip.Addr // container name -> IP
+}
+
+// defaultCoreDNSManifest is a stripped down version of the CoreDNS manifest deployed by K3s, which k3d patches upon cluster start
+const defaultCoreDNSManifest = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: coredns
+  namespace: kube-system
+data:
+  NodeHosts: ""
+`
+
+// NewRuntime returns a new, empty in-memory runtime which emits the default k3d ready log messages upon node start
+func NewRuntime() *Runtime {
+	r := &Runtime{
+		containers: map[string]*container{},
+		networks:   map[string]*network{},
+		volumes:    map[string]map[string]string{},
+		volumeData: map[string]map[string]*file{},
+		LogScripts: map[k3d.Role][]string{},
+		RoleFiles: map[k3d.Role]map[string][]byte{
+			k3d.ServerRole: {
+				"/var/lib/rancher/k3s/server/manifests/coredns.yaml": []byte(defaultCoreDNSManifest),
+			},
+		},
+		FileWriteLogScripts: map[string][]string{
+			k3d.DefaultLoadbalancerConfigPath: {k3d.ReadyLogMessagesByRoleAndIntent[k3d.LoadBalancerRole][k3d.IntentAny]},
+		},
+	}
+
+	// by default, every started node logs all ready messages for its role
+	for role, messages := range k3d.ReadyLogMessagesByRoleAndIntent {
+		if role == k3d.Role(k3d.InternalRoleInitServer) {
+			role = k3d.ServerRole
+		}
+		for _, msg := range messages {
+			r.LogScripts[role] = append(r.LogScripts[role], msg)
+		}
+	}
+	r.LogScripts[k3d.ServerRole] = append(r.LogScripts[k3d.ServerRole], "Cluster dns configmap has been set successfully")
+
+	return r
+}
+
+// ID returns the identity of the runtime
+func (r *Runtime) ID() string {
+	return "fake"
+}
+
+// GetHost returns the runtime host, which is always local for the fake runtime
+func (r *Runtime) GetHost() string {
+	return ""
+}
+
+// GetRuntimePath returns a fake socket path
+func (r *Runtime) GetRuntimePath() string {
+	return "/var/run/fake.sock"
+}
+
+// Info returns static information about the fake runtime
+func (r *Runtime) Info() (*runtimeTypes.RuntimeInfo, error) {
+	return &runtimeTypes.RuntimeInfo{
+		Name:          r.ID(),
+		Endpoint:      r.GetRuntimePath(),
+		Version:       "0.0.0",
+		OSType:        "linux",
+		OS:            "fake",
+		Arch:          "amd64",
+		CgroupVersion: "2",
+		CgroupDriver:  "systemd",
+		Filesystem:    "UNKNOWN",
+		InfoName:      "fake",
+	}, nil
+}
+
+// getContainer returns the container matching the node's name (with or without the k3d- prefix) or ID
+// and all of its runtime labels. The caller must hold the lock.
+func (r *Runtime) getContainer(node *k3d.Node) (*container, error) {
+	var found []*container
+	for name, c := range r.containers {
+		if name != node.Name && name != fmt.Sprintf("%s-%s", k3d.DefaultObjectNamePrefix, node.Name) && c.id != node.Name {
+			continue
+		}
+		if !hasLabels(c.labels, node.RuntimeLabels) {
+			continue
+		}
+		found = append(found, c)
+	}
+
+	if len(found) > 1 {
+		return nil, fmt.Errorf("Failed to get a single container for name '%s'. Found: %d", node.Name, len(found))
+	}
+	if len(found) == 0 {
+		return nil, fmt.Errorf("Didn't find container for node '%s'", node.Name)
+	}
+	return found[0], nil
+}
+
+func hasLabels(labels map[string]string, filter map[string]string) bool {
+	for k, v := range filter {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,186 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package fake_test
+
+import (
+	"context"
+	"io"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/k3d-io/k3d/v5/pkg/client"
+	"github.com/k3d-io/k3d/v5/pkg/runtimes"
+	runtimeErrors "github.com/k3d-io/k3d/v5/pkg/runtimes/errors"
+	"github.com/k3d-io/k3d/v5/pkg/runtimes/fake"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+	"github.com/pkg/errors"
+)
+
+var _ runtimes.Runtime = &fake.Runtime{}
+
+func newNode(name string, role k3d.Role, networks ...string) *k3d.Node {
+	labels := map[string]string{k3d.LabelRole: string(role)}
+	for k, v := range k3d.DefaultRuntimeLabels {
+		labels[k] = v
+	}
+	if len(networks) > 0 {
+		labels[k3d.LabelNetwork] = networks[0]
+	}
+	return &k3d.Node{Name: name, Role: role, Networks: networks, RuntimeLabels: labels}
+}
+
+func TestFakeNetworkIPAM(t *testing.T) {
+	ctx := context.Background()
+	rt := fake.NewRuntime()
+
+	net, exists, err := rt.CreateNetworkIfNotPresent(ctx, &k3d.ClusterNetwork{Name: "k3d-test"})
+	if err != nil || exists {
+		t.Fatalf("failed to create network (exists: %t): %v", exists, err)
+	}
+	if expected := netip.MustParsePrefix("172.30.0.0/24"); net.IPAM.IPPrefix != expected {
+		t.Errorf("expected subnet %s, got %s", expected, net.IPAM.IPPrefix)
+	}
+	if _, exists, _ := rt.CreateNetworkIfNotPresent(ctx, &k3d.ClusterNetwork{Name: "k3d-test"}); !exists {
+		t.Errorf("expected network to exist already")
+	}
+
+	static := newNode("static", k3d.ServerRole, "k3d-test")
+	static.IP = k3d.NodeIP{IP: netip.MustParseAddr("172.30.0.2"), Static: true}
+	if err := rt.CreateNode(ctx, static); err != nil {
+		t.Fatalf("failed to create node with static IP: %v", err)
+	}
+	dynamic := newNode("dynamic", k3d.AgentRole, "k3d-test")
+	if err := rt.CreateNode(ctx, dynamic); err != nil {
+		t.Fatalf("failed to create node: %v", err)
+	}
+	node, err := rt.GetNode(ctx, dynamic)
+	if err != nil {
+		t.Fatalf("failed to get node: %v", err)
+	}
+	if expected := netip.MustParseAddr("172.30.0.3"); node.IP.IP != expected {
+		t.Errorf("expected next free IP %s (skipping gateway and static IP), got %s", expected, node.IP.IP)
+	}
+
+	clash := newNode("clash", k3d.AgentRole, "k3d-test")
+	clash.IP = k3d.NodeIP{IP: netip.MustParseAddr("172.30.0.3"), Static: true}
+	if err := rt.CreateNode(ctx, clash); err == nil {
+		t.Errorf("expected error when creating a node with an IP that's already in use")
+	}
+
+	if err := rt.DeleteNetwork(ctx, "k3d-test"); !errors.Is(err, runtimeErrors.ErrRuntimeNetworkNotEmpty) {
+		t.Errorf("expected error '%v' when deleting a network with members, got '%v'", runtimeErrors.ErrRuntimeNetworkNotEmpty, err)
+	}
+}
+
+func TestFakeLogScripts(t *testing.T) {
+	ctx := context.Background()
+	rt := fake.NewRuntime()
+	rt.LogScripts[k3d.AgentRole] = []string{"agent is up"}
+
+	node := newNode("agent", k3d.AgentRole)
+	if err := rt.CreateNode(ctx, node); err != nil {
+		t.Fatalf("failed to create node: %v", err)
+	}
+	if err := rt.StartNode(ctx, node); err != nil {
+		t.Fatalf("failed to start node: %v", err)
+	}
+	if err := client.NodeWaitForLogMessage(ctx, rt, node, "agent is up", time.Time{}); err != nil {
+		t.Errorf("failed to wait for scripted log message: %v", err)
+	}
+
+	since := time.Now()
+	time.Sleep(10 * time.Millisecond)
+	if err := rt.AppendNodeLogs("agent", "reconfigured"); err != nil {
+		t.Fatalf("failed to append logs: %v", err)
+	}
+	logs, err := rt.GetNodeLogs(ctx, node, since, nil)
+	if err != nil {
+		t.Fatalf("failed to get logs: %v", err)
+	}
+	content, _ := io.ReadAll(logs)
+	if string(content) != "reconfigured\n" {
+		t.Errorf("expected only log lines since %s, got %q", since, content)
+	}
+}
+
+func TestFakeFiles(t *testing.T) {
+	ctx := context.Background()
+	rt := fake.NewRuntime()
+
+	node := newNode("server", k3d.ServerRole)
+	if err := rt.CreateNode(ctx, node); err != nil {
+		t.Fatalf("failed to create node: %v", err)
+	}
+	if err := rt.WriteToNode(ctx, []byte("hello"), "/etc/test.txt", 0644, node); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	reader, err := rt.ReadFromNode(ctx, "/etc/test.txt", node)
+	if err != nil {
+		t.Fatalf("failed to read file: %v", err)
+	}
+	content, _ := io.ReadAll(reader)
+	if len(content) <= 512 || string(content[512:517]) != "hello" {
+		t.Errorf("expected a tar stream containing the written file, got %q", content)
+	}
+
+	if _, err := rt.ReadFromNode(ctx, "/does/not/exist", node); !errors.Is(err, runtimeErrors.ErrRuntimeFileNotFound) {
+		t.Errorf("expected error '%v' for non-existing file, got '%v'", runtimeErrors.ErrRuntimeFileNotFound, err)
+	}
+}
+
+func TestFakeVolumeFiles(t *testing.T) {
+	ctx := context.Background()
+	rt := fake.NewRuntime()
+
+	if err := rt.CreateVolume(ctx, "data", map[string]string{}); err != nil {
+		t.Fatalf("failed to create volume: %v", err)
+	}
+	writer := newNode("writer", k3d.RegistryRole)
+	writer.Volumes = []string{"data:/var/lib/registry"}
+	reader := newNode("reader", k3d.NoRole)
+	reader.Volumes = []string{"data:/mnt:ro"}
+	for _, node := range []*k3d.Node{writer, reader} {
+		if err := rt.CreateNode(ctx, node); err != nil {
+			t.Fatalf("failed to create node: %v", err)
+		}
+	}
+
+	if err := rt.WriteToNode(ctx, []byte("blob"), "/var/lib/registry/blobs/data", 0644, writer); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if err := rt.WriteToNode(ctx, []byte("private"), "/var/lib/other", 0644, writer); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if content, ok := rt.ReadFile("reader", "/mnt/blobs/data"); !ok || string(content) != "blob" {
+		t.Errorf("expected file written to the volume to be visible in other containers mounting it, got %q", content)
+	}
+	if _, ok := rt.ReadFile("reader", "/var/lib/other"); ok {
+		t.Errorf("expected file written outside of the volume to be private to the container")
+	}
+
+	if err := rt.DeleteVolume(ctx, "data"); err == nil {
+		t.Errorf("expected deleting a volume in use to fail")
+	}
+}
@@ -0,0 +1,156 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package fake
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	runtimeErrors "github.com/k3d-io/k3d/v5/pkg/runtimes/errors"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// CopyToNode copies a file or directory from the local FS to the selected node
+func (r *Runtime) CopyToNode(ctx context.Context, src string, dest string, node *k3d.Node) error {
+	files := map[string]*file{}
+	err := filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		content, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		files[path.Join(dest, filepath.ToSlash(rel))] = &file{content: content, mode: info.Mode()}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read '%s': %w", src, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, err := r.getContainer(node)
+	if err != nil {
+		return fmt.Errorf("failed to find container for target node '%s': %w", node.Name, err)
+	}
+	for p, f := range files {
+		r.setFile(c, p, f)
+	}
+	return nil
+}
+
+// WriteToNode writes a byte array to the selected node and emits the log lines scripted for that path
+func (r *Runtime) WriteToNode(ctx context.Context, content []byte, dest string, mode os.FileMode, node *k3d.Node) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, err := r.getContainer(node)
+	if err != nil {
+		return fmt.Errorf("Failed to find container for node '%s': %+v", node.Name, err)
+	}
+	r.setFile(c, path.Clean("/"+dest), &file{content: append([]byte{}, content...), mode: mode})
+	if c.node.State.Running {
+		c.appendLogs(time.Now().UTC(), r.FileWriteLogScripts[dest]...)
+	}
+	return nil
+}
+
+// ReadFromNode reads from a given filepath inside the node. Like with docker, the result is a tar stream.
+func (r *Runtime) ReadFromNode(ctx context.Context, filePath string, node *k3d.Node) (io.ReadCloser, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, err := r.getContainer(node)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find container for node '%s': %w", node.Name, err)
+	}
+
+	filePath = path.Clean("/" + filePath)
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	found := false
+	for p, f := range r.getFiles(c) {
+		if p != filePath && !strings.HasPrefix(p, filePath+"/") {
+			continue
+		}
+		found = true
+		name := path.Join(path.Base(filePath), strings.TrimPrefix(p, filePath))
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: int64(f.mode), Size: int64(len(f.content)), Typeflag: tar.TypeReg}); err != nil {
+			return nil, fmt.Errorf("failed to write tar header: %w", err)
+		}
+		if _, err := tw.Write(f.content); err != nil {
+			return nil, fmt.Errorf("failed to write tar content: %w", err)
+		}
+	}
+	if !found {
+		return nil, errors.Wrap(runtimeErrors.ErrRuntimeFileNotFound, fmt.Sprintf("no such file '%s' in container '%s'", filePath, c.node.Name))
+	}
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close tar writer: %w", err)
+	}
+	return io.NopCloser(buf), nil
+}
+
+// GetKubeconfig grabs the kubeconfig from inside a k3d node (as a tar stream)
+func (r *Runtime) GetKubeconfig(ctx context.Context, node *k3d.Node) (io.ReadCloser, error) {
+	return r.ReadFromNode(ctx, "/output/kubeconfig.yaml", node)
+}
+
+// ReadFile returns the raw content of a file written to a node
+func (r *Runtime) ReadFile(nodeName string, filePath string) ([]byte, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, err := r.getContainer(&k3d.Node{Name: nodeName})
+	if err != nil {
+		return nil, false
+	}
+	f, ok := r.getFiles(c)[path.Clean("/"+filePath)]
+	if !ok {
+		return nil, false
+	}
+	return append([]byte{}, f.content...), true
+}
@@ -0,0 +1,85 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package fake
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// AddImages makes the given images available in the runtime
+func (r *Runtime) AddImages(images ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.images = append(r.images, images...)
+}
+
+// GetImages returns a list of images present in the runtime
+func (r *Runtime) GetImages(ctx context.Context) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]string{}, r.images...), nil
+}
+
+// GetImageStream returns a tar stream with a docker-archive style manifest of the given images
+func (r *Runtime) GetImageStream(ctx context.Context, images []string) (io.ReadCloser, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, image := range images {
+		found := false
+		for _, existing := range r.images {
+			if existing == image {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no such image: %s", image)
+		}
+	}
+
+	manifest, err := json.Marshal([]map[string][]string{{"RepoTags": images}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal image manifest: %w", err)
+	}
+
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	if err := tw.WriteHeader(&tar.Header{Name: "manifest.json", Mode: 0644, Size: int64(len(manifest))}); err != nil {
+		return nil, fmt.Errorf("failed to write tar header: %w", err)
+	}
+	if _, err := tw.Write(manifest); err != nil {
+		return nil, fmt.Errorf("failed to write tar content: %w", err)
+	}
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close tar writer: %w", err)
+	}
+	return io.NopCloser(buf), nil
+}
@@ -0,0 +1,234 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package fake
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+
+	runtimeErr "github.com/k3d-io/k3d/v5/pkg/runtimes/errors"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+// GetNetwork returns a given network by name or ID
+func (r *Runtime) GetNetwork(ctx context.Context, searchNet *k3d.ClusterNetwork) (*k3d.ClusterNetwork, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if searchNet.ID == "" && searchNet.Name == "" {
+		return nil, fmt.Errorf("failed to get network, because neither name nor ID was provided")
+	}
+
+	nameOrID := searchNet.Name
+	if nameOrID == "" {
+		nameOrID = searchNet.ID
+	}
+	net, err := r.getNetwork(nameOrID)
+	if err != nil {
+		return nil, err
+	}
+
+	k3dNetwork := &k3d.ClusterNetwork{
+		Name: net.name,
+		ID:   net.id,
+		IPAM: k3d.IPAM{
+			IPPrefix: net.prefix,
+			IPsUsed:  []netip.Addr{net.gateway},
+		},
+	}
+	for name, ip := range net.members {
+		k3dNetwork.IPAM.IPsUsed = append(k3dNetwork.IPAM.IPsUsed, ip)
+		k3dNetwork.Members = append(k3dNetwork.Members, &k3d.NetworkMember{Name: name, IP: ip})
+	}
+	k3dNetwork.IPAM.IPsUsed = append(k3dNetwork.IPAM.IPsUsed, searchNet.IPAM.IPsUsed...)
+
+	return k3dNetwork, nil
+}
+
+// CreateNetworkIfNotPresent creates a new network with the given (or the next free) subnet
+// @return: network, exists, error
+func (r *Runtime) CreateNetworkIfNotPresent(ctx context.Context, inNet *k3d.ClusterNetwork) (*k3d.ClusterNetwork, bool, error) {
+	existingNet, err := r.GetNetwork(ctx, inNet)
+	if err != nil && err != runtimeErr.ErrRuntimeNetworkNotExists {
+		return nil, false, fmt.Errorf("failed to check for existing networks: %w", err)
+	}
+	if existingNet != nil {
+		return existingNet, true, nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	prefix := inNet.IPAM.IPPrefix
+	if prefix == (netip.Prefix{}) {
+		// 172.30.0.0/24, 172.30.1.0/24, ...
+		prefix = netip.PrefixFrom(netip.AddrFrom4([4]byte{172, 30, byte(r.nextSubnet), 0}), 24)
+		r.nextSubnet++
+	} else if !prefix.IsValid() {
+		return nil, false, fmt.Errorf("invalid subnet prefix: %s", prefix.String())
+	}
+
+	r.nextNetworkID++
+	net := &network{
+		id:      fmt.Sprintf("%064x", r.nextNetworkID),
+		name:    inNet.Name,
+		labels:  map[string]string{},
+		prefix:  prefix.Masked(),
+		gateway: prefix.Masked().Addr().Next(), // second IP in subnet will be the Gateway (Next, so we don't hit x.x.x.0)
+		members: map[string]netip.Addr{},
+	}
+	for k, v := range k3d.DefaultRuntimeLabels {
+		net.labels[k] = v
+	}
+	r.networks[net.name] = net
+
+	newClusterNet := &k3d.ClusterNetwork{Name: net.name, ID: net.id, IPAM: k3d.IPAM{IPPrefix: net.prefix}}
+	if inNet.IPAM.Managed || inNet.IPAM.IPPrefix != (netip.Prefix{}) {
+		newClusterNet.IPAM.Managed = true
+	}
+	return newClusterNet, false, nil
+}
+
+// DeleteNetwork deletes a network by name or ID
+func (r *Runtime) DeleteNetwork(ctx context.Context, ID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	net, err := r.getNetwork(ID)
+	if err != nil {
+		return fmt.Errorf("failed to remove network '%s': %w", ID, err)
+	}
+	if len(net.members) > 0 {
+		return runtimeErr.ErrRuntimeNetworkNotEmpty
+	}
+	delete(r.networks, net.name)
+	return nil
+}
+
+// ConnectNodeToNetwork connects a node to a network
+func (r *Runtime) ConnectNodeToNetwork(ctx context.Context, node *k3d.Node, networkName string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, err := r.getContainer(node)
+	if err != nil {
+		return fmt.Errorf("failed to get container for node '%s': %w", node.Name, err)
+	}
+	return r.connect(c, networkName, k3d.NodeIP{})
+}
+
+// DisconnectNodeFromNetwork disconnects a node from a network
+func (r *Runtime) DisconnectNodeFromNetwork(ctx context.Context, node *k3d.Node, networkName string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, err := r.getContainer(node)
+	if err != nil {
+		return fmt.Errorf("failed to get container for node '%s': %w", node.Name, err)
+	}
+	net, err := r.getNetwork(networkName)
+	if err != nil {
+		return fmt.Errorf("failed to get network '%s': %w", networkName, err)
+	}
+	if _, ok := net.members[c.node.Name]; !ok {
+		return fmt.Errorf("container '%s' is not connected to network '%s'", c.node.Name, networkName)
+	}
+	delete(net.members, c.node.Name)
+
+	networks := []string{}
+	for _, n := range c.node.Networks {
+		if n != net.name {
+			networks = append(networks, n)
+		}
+	}
+	c.node.Networks = networks
+	return nil
+}
+
+// GetHostIP returns the gateway of the given network
+func (r *Runtime) GetHostIP(ctx context.Context, networkName string) (netip.Addr, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	net, err := r.getNetwork(networkName)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("failed to get network '%s': %w", networkName, err)
+	}
+	return net.gateway, nil
+}
+
+// getNetwork returns a network by its name or ID. The caller must hold the lock.
+func (r *Runtime) getNetwork(nameOrID string) (*network, error) {
+	if net, ok := r.networks[nameOrID]; ok {
+		return net, nil
+	}
+	for _, net := range r.networks {
+		if net.id == nameOrID {
+			return net, nil
+		}
+	}
+	return nil, runtimeErr.ErrRuntimeNetworkNotExists
+}
+
+// connect attaches a container to a network, using either the given static IP or the next free IP in the subnet.
+// The caller must hold the lock.
+func (r *Runtime) connect(c *container, networkName string, staticIP k3d.NodeIP) error {
+	net, err := r.getNetwork(networkName)
+	if err != nil {
+		return fmt.Errorf("failed to get network '%s': %w", networkName, err)
+	}
+	if _, ok := net.members[c.node.Name]; ok {
+		return nil
+	}
+
+	used := map[netip.Addr]bool{net.gateway: true}
+	for _, ip := range net.members {
+		used[ip] = true
+	}
+
+	var ip netip.Addr
+	if staticIP.IP.IsValid() {
+		if !net.prefix.Contains(staticIP.IP) {
+			return fmt.Errorf("static IP %s is not in subnet %s of network '%s'", staticIP.IP, net.prefix, net.name)
+		}
+		if used[staticIP.IP] {
+			return fmt.Errorf("static IP %s is already in use in network '%s'", staticIP.IP, net.name)
+		}
+		ip = staticIP.IP
+	} else {
+		for candidate := net.gateway.Next(); net.prefix.Contains(candidate); candidate = candidate.Next() {
+			if !used[candidate] {
+				ip = candidate
+				break
+			}
+		}
+		if !ip.IsValid() {
+			return fmt.Errorf("no free IP left in network '%s'", net.name)
+		}
+	}
+
+	net.members[c.node.Name] = ip
+	c.node.Networks = append(c.node.Networks, net.name)
+	return nil
+}
@@ -0,0 +1,425 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package fake
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/docker/go-connections/nat"
+	dockerunits "github.com/docker/go-units"
+	runtimeErr "github.com/k3d-io/k3d/v5/pkg/runtimes/errors"
+	runtimeTypes "github.com/k3d-io/k3d/v5/pkg/runtimes/types"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+	"github.com/k3d-io/k3d/v5/pkg/util"
+)
+
+// CreateNode creates a new (stopped) container
+func (r *Runtime) CreateNode(ctx context.Context, node *k3d.Node) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.containers[node.Name]; exists {
+		return fmt.Errorf("failed to create container for node '%s': name already in use", node.Name)
+	}
+
+	r.nextContainerID++
+	c := &container{
+		id:     fmt.Sprintf("%064x", r.nextContainerID),
+		node:   copyNode(node),
+		labels: map[string]string{},
+		files:  map[string]*file{},
+	}
+	for k, v := range node.RuntimeLabels {
+		c.labels[k] = v
+	}
+	// every container gets its own /etc/hosts, like with the real runtimes
+	c.files["/etc/hosts"] = &file{content: []byte("127.0.0.1\tlocalhost\n"), mode: 0644}
+	for p, content := range r.RoleFiles[node.Role] {
+		c.files[p] = &file{content: append([]byte{}, content...), mode: 0644}
+	}
+	c.node.Created = time.Now().UTC().Format(time.RFC3339Nano)
+	c.node.State = k3d.NodeState{Running: false, Status: "created"}
+	c.node.IP = k3d.NodeIP{}
+	c.node.Networks = []string{}
+
+	for i, netName := range node.Networks {
+		var staticIP k3d.NodeIP
+		if i == 0 && node.IP.Static {
+			staticIP = node.IP
+		}
+		if err := r.connect(c, netName, staticIP); err != nil {
+			return fmt.Errorf("failed to create container for node '%s': %w", node.Name, err)
+		}
+	}
+
+	r.containers[node.Name] = c
+	return nil
+}
+
+// DeleteNode deletes a node
+func (r *Runtime) DeleteNode(ctx context.Context, node *k3d.Node) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, ok := r.containers[node.Name]
+	if !ok {
+		// docker allows deleting by ID as well
+		for _, candidate := range r.containers {
+			if candidate.id == node.Name {
+				c = candidate
+			}
+		}
+		if c == nil {
+			return fmt.Errorf("failed to remove the container '%s': no such container", node.Name)
+		}
+	}
+
+	for _, net := range r.networks {
+		delete(net.members, c.node.Name)
+	}
+	delete(r.containers, c.node.Name)
+	return nil
+}
+
+// RenameNode renames the container of a node
+func (r *Runtime) RenameNode(ctx context.Context, node *k3d.Node, newName string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, err := r.getContainer(node)
+	if err != nil {
+		return fmt.Errorf("failed to get container for node '%s': %w", node.Name, err)
+	}
+	if _, exists := r.containers[newName]; exists {
+		return fmt.Errorf("failed to rename container '%s' to '%s': name already in use", c.node.Name, newName)
+	}
+
+	for _, net := range r.networks {
+		if ip, ok := net.members[c.node.Name]; ok {
+			delete(net.members, c.node.Name)
+			net.members[newName] = ip
+		}
+	}
+	delete(r.containers, c.node.Name)
+	c.node.Name = newName
+	r.containers[newName] = c
+	return nil
+}
+
+// GetNodesByLabel returns a list of existing nodes having all the default k3d labels and the given labels
+func (r *Runtime) GetNodesByLabel(ctx context.Context, labels map[string]string) ([]*k3d.Node, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	nodes := []*k3d.Node{}
+	for _, c := range r.containers {
+		if hasLabels(c.labels, k3d.DefaultRuntimeLabels) && hasLabels(c.labels, labels) {
+			nodes = append(nodes, r.toNode(c))
+		}
+	}
+	return nodes, nil
+}
+
+// GetNode tries to get a node container by its name
+func (r *Runtime) GetNode(ctx context.Context, node *k3d.Node) (*k3d.Node, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, err := r.getContainer(node)
+	if err != nil {
+		return node, fmt.Errorf("failed to get container for node '%s': %w", node.Name, err)
+	}
+	if !hasLabels(c.labels, k3d.DefaultRuntimeLabels) {
+		return node, fmt.Errorf("failed to translate container '%s' details to node spec: %w", c.node.Name, runtimeErr.ErrRuntimeContainerUnknown)
+	}
+	return r.toNode(c), nil
+}
+
+// GetNodeStatus returns the status of a node (Running, Started, etc.)
+func (r *Runtime) GetNodeStatus(ctx context.Context, node *k3d.Node) (bool, string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, err := r.getContainer(node)
+	if err != nil {
+		return false, "", fmt.Errorf("failed to get container for node '%s': %w", node.Name, err)
+	}
+	return c.node.State.Running, c.node.State.Status, nil
+}
+
+// GetNodesInNetwork returns all the k3d nodes connected to a given network
+func (r *Runtime) GetNodesInNetwork(ctx context.Context, network string) ([]*k3d.Node, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	net, err := r.getNetwork(network)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get network '%s': %w", network, err)
+	}
+
+	nodes := []*k3d.Node{}
+	for name := range net.members {
+		c := r.containers[name]
+		if !hasLabels(c.labels, k3d.DefaultRuntimeLabels) {
+			continue
+		}
+		nodes = append(nodes, r.toNode(c))
+	}
+	return nodes, nil
+}
+
+// StartNode starts an existing node and emits the log lines scripted for its role
+func (r *Runtime) StartNode(ctx context.Context, node *k3d.Node) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, err := r.getContainer(node)
+	if err != nil {
+		return fmt.Errorf("failed to get container for node '%s': %w", node.Name, err)
+	}
+	if v, ok := c.labels["app"]; !ok || v != "k3d" {
+		return fmt.Errorf("Failed to determine if container '%s' is managed by k3d (needs label 'app=k3d')", c.id)
+	}
+
+	now := time.Now().UTC()
+	c.node.State = k3d.NodeState{Running: true, Status: "running", Started: now.Format(time.RFC3339Nano)}
+	c.appendLogs(now, r.LogScripts[c.node.Role]...)
+
+	node.Created = c.node.Created
+	node.State.Running = c.node.State.Running
+	node.State.Started = c.node.State.Started
+	return nil
+}
+
+// StopNode stops an existing node
+func (r *Runtime) StopNode(ctx context.Context, node *k3d.Node) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, err := r.getContainer(node)
+	if err != nil {
+		return fmt.Errorf("failed to get container for node '%s': %w", node.Name, err)
+	}
+	if v, ok := c.labels["app"]; !ok || v != "k3d" {
+		return fmt.Errorf("Failed to determine if container '%s' is managed by k3d (needs label 'app=k3d')", c.id)
+	}
+	c.node.State.Running = false
+	c.node.State.Status = "exited"
+	return nil
+}
+
+// GetNodeLogs returns the log lines of a node emitted since the given time.
+// Other than with real runtimes, following the logs ends the stream after the current lines.
+func (r *Runtime) GetNodeLogs(ctx context.Context, node *k3d.Node, since time.Time, opts *runtimeTypes.NodeLogsOpts) (io.ReadCloser, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, err := r.getContainer(node)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get container for node '%s': %w", node.Name, err)
+	}
+	if !c.node.State.Running {
+		return nil, fmt.Errorf("node '%s' (container '%s') not running", node.Name, c.id)
+	}
+
+	buf := &bytes.Buffer{}
+	for _, line := range c.logs {
+		if !since.IsZero() && line.time.Before(since) {
+			continue
+		}
+		buf.WriteString(line.text)
+		buf.WriteString("\n")
+	}
+	return io.NopCloser(buf), nil
+}
+
+// AppendNodeLogs appends log lines to the logs of a node, e.g. to script the messages a test waits for
+func (r *Runtime) AppendNodeLogs(nodeName string, lines ...string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, err := r.getContainer(&k3d.Node{Name: nodeName})
+	if err != nil {
+		return err
+	}
+	c.appendLogs(time.Now().UTC(), lines...)
+	return nil
+}
+
+func (c *container) appendLogs(t time.Time, lines ...string) {
+	for _, line := range lines {
+		c.logs = append(c.logs, logLine{time: t, text: line})
+	}
+}
+
+// ExecInNode execs a command inside a node
+func (r *Runtime) ExecInNode(ctx context.Context, node *k3d.Node, cmd []string) error {
+	_, err := r.exec(node, cmd, nil)
+	return err
+}
+
+// ExecInNodeWithStdin execs a command inside a node, reading the whole stdin stream first
+func (r *Runtime) ExecInNodeWithStdin(ctx context.Context, node *k3d.Node, cmd []string, stdin io.ReadCloser) error {
+	input, err := io.ReadAll(stdin)
+	if err != nil {
+		return fmt.Errorf("failed to read stdin: %w", err)
+	}
+	if err := stdin.Close(); err != nil {
+		return fmt.Errorf("failed to close stdin: %w", err)
+	}
+	_, err = r.exec(node, cmd, input)
+	return err
+}
+
+// ExecInNodeGetLogs executes a command inside a node and returns the output to the caller
+func (r *Runtime) ExecInNodeGetLogs(ctx context.Context, node *k3d.Node, cmd []string) (*bufio.Reader, error) {
+	output, err := r.exec(node, cmd, nil)
+	return bufio.NewReader(strings.NewReader(output)), err
+}
+
+func (r *Runtime) exec(node *k3d.Node, cmd []string, stdin []byte) (string, error) {
+	r.mu.Lock()
+	c, err := r.getContainer(node)
+	if err != nil {
+		r.mu.Unlock()
+		return "", fmt.Errorf("failed to get container for node '%s': %w", node.Name, err)
+	}
+	if !c.node.State.Running {
+		r.mu.Unlock()
+		return "", fmt.Errorf("container '%s' is not running", c.node.Name)
+	}
+	c.execLog = append(c.execLog, append([]string{}, cmd...))
+	n := r.toNode(c)
+	handler := r.ExecHandler
+	r.mu.Unlock()
+
+	if handler == nil {
+		return "", nil
+	}
+	return handler(n, cmd, stdin)
+}
+
+// ExecHistory returns all commands that were executed in the given node so far
+func (r *Runtime) ExecHistory(nodeName string) [][]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, err := r.getContainer(&k3d.Node{Name: nodeName})
+	if err != nil {
+		return nil
+	}
+	history := make([][]string, 0, len(c.execLog))
+	for _, cmd := range c.execLog {
+		history = append(history, append([]string{}, cmd...))
+	}
+	return history
+}
+
+// toNode translates a container to a k3d node the same way real runtimes do (e.g. only k3d.* labels are returned).
+// The caller must hold the lock.
+func (r *Runtime) toNode(c *container) *k3d.Node {
+	node := copyNode(c.node)
+
+	node.RuntimeLabels = map[string]string{}
+	for k, v := range c.labels {
+		if strings.HasPrefix(k, "k3d") {
+			node.RuntimeLabels[k] = v
+		}
+	}
+
+	// re-order networks, so that the cluster network comes first
+	orderedNetworks := []string{}
+	otherNetworks := []string{}
+	for _, netName := range node.Networks {
+		if strings.HasPrefix(netName, fmt.Sprintf("%s-%s", k3d.DefaultObjectNamePrefix, c.labels[k3d.LabelClusterName])) {
+			orderedNetworks = append(orderedNetworks, netName)
+			continue
+		}
+		otherNetworks = append(otherNetworks, netName)
+	}
+	node.Networks = append(orderedNetworks, otherNetworks...)
+
+	// IP in the cluster network
+	node.IP = k3d.NodeIP{}
+	if netName, ok := c.labels[k3d.LabelNetwork]; ok {
+		if net, ok := r.networks[netName]; ok {
+			if ip, ok := net.members[c.node.Name]; ok {
+				_, isStatic := c.labels[k3d.LabelNodeStaticIP]
+				node.IP = k3d.NodeIP{IP: ip, Static: isStatic}
+			}
+		}
+	}
+
+	// role specific options which are only known via labels
+	node.ServerOpts.IsInit = c.labels[k3d.LabelServerIsInit] == "true"
+	node.ServerOpts.KubeAPI = &k3d.ExposureOpts{}
+	node.ServerOpts.KubeAPI.Binding.HostIP = c.labels[k3d.LabelServerAPIHostIP]
+	node.ServerOpts.KubeAPI.Host = c.labels[k3d.LabelServerAPIHost]
+	node.ServerOpts.KubeAPI.Binding.HostPort = c.labels[k3d.LabelServerAPIPort]
+
+	// like docker, report the memory limit in human readable decimal units (no limit: 0B)
+	var memory int64
+	if c.node.Memory != "" {
+		memory, _ = dockerunits.RAMInBytes(c.node.Memory)
+	}
+	node.Memory = dockerunits.HumanSize(float64(memory))
+
+	// like docker, report the CPU limit as it's stored (in units of 10^-9 CPUs)
+	var cpus int64
+	if c.node.CPUs != "" {
+		cpus, _ = util.ParseCPUs(c.node.CPUs)
+	}
+	node.CPUs = util.FormatCPUs(cpus)
+
+	return node
+}
+
+// copyNode creates a deep copy of the parts of a node spec that a container runtime would keep
+func copyNode(src *k3d.Node) *k3d.Node {
+	node := *src
+	node.Volumes = append([]string{}, src.Volumes...)
+	node.Env = append([]string{}, src.Env...)
+	node.Cmd = append(append([]string{}, src.Cmd...), src.Args...) // like docker, args become part of the command
+	node.Args = []string{}
+	node.Networks = append([]string{}, src.Networks...)
+	node.ExtraHosts = append([]string{}, src.ExtraHosts...)
+	node.RuntimeUlimits = append(node.RuntimeUlimits[:0:0], src.RuntimeUlimits...)
+	node.Files = nil
+	node.HookActions = nil
+	node.K3sNodeLabels = map[string]string{}
+	node.RuntimeLabels = map[string]string{}
+	for k, v := range src.RuntimeLabels {
+		node.RuntimeLabels[k] = v
+	}
+	node.Ports = nat.PortMap{}
+	for port, bindings := range src.Ports {
+		node.Ports[port] = append([]nat.PortBinding{}, bindings...)
+	}
+	return &node
+}
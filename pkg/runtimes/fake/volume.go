@@ -0,0 +1,146 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package fake
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"path"
+	"strings"
+
+	runtimeErrors "github.com/k3d-io/k3d/v5/pkg/runtimes/errors"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+// CreateVolume creates a new named volume
+func (r *Runtime) CreateVolume(ctx context.Context, name string, labels map[string]string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.volumes[name]; exists {
+		return nil
+	}
+	volumeLabels := map[string]string{}
+	for k, v := range labels {
+		volumeLabels[k] = v
+	}
+	for k, v := range k3d.DefaultRuntimeLabels {
+		volumeLabels[k] = v
+	}
+	for k, v := range k3d.DefaultRuntimeLabelsVar {
+		volumeLabels[k] = v
+	}
+	r.volumes[name] = volumeLabels
+	r.volumeData[name] = map[string]*file{}
+	return nil
+}
+
+// DeleteVolume deletes a named volume, unless it's still used by a container
+func (r *Runtime) DeleteVolume(ctx context.Context, name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.volumes[name]; !exists {
+		return fmt.Errorf("failed to find volume '%s': %w", name, runtimeErrors.ErrRuntimeVolumeNotExists)
+	}
+
+	refCount := 0
+	for _, c := range r.containers {
+		for _, volume := range c.node.Volumes {
+			if volume == name || strings.HasPrefix(volume, name+":") {
+				refCount++
+			}
+		}
+	}
+	if refCount > 0 {
+		return fmt.Errorf("failed to delete volume '%s' as it is still referenced by %d containers", name, refCount)
+	}
+
+	delete(r.volumes, name)
+	delete(r.volumeData, name)
+	return nil
+}
+
+// GetVolume tries to get a named volume
+func (r *Runtime) GetVolume(name string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.volumes[name]; !exists {
+		return "", fmt.Errorf("failed to find named volume '%s': %w", name, runtimeErrors.ErrRuntimeVolumeNotExists)
+	}
+	return name, nil
+}
+
+// GetVolumesByLabel returns the names of all volumes having the default k3d labels and the given labels
+func (r *Runtime) GetVolumesByLabel(ctx context.Context, labels map[string]string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var volumes []string
+	for name, volumeLabels := range r.volumes {
+		if hasLabels(volumeLabels, k3d.DefaultRuntimeLabels) && hasLabels(volumeLabels, labels) {
+			volumes = append(volumes, name)
+		}
+	}
+	return volumes, nil
+}
+
+// volumeMounts returns the named volumes mounted into the container, by mount point
+func (r *Runtime) volumeMounts(c *container) map[string]string {
+	mounts := map[string]string{}
+	for _, volume := range c.node.Volumes {
+		src, dest, found := strings.Cut(volume, ":")
+		if !found {
+			continue
+		}
+		dest, _, _ = strings.Cut(dest, ":")
+		if _, exists := r.volumes[src]; exists {
+			mounts[path.Clean(dest)] = src
+		}
+	}
+	return mounts
+}
+
+// setFile stores a file in the container or, if it's located in a mounted named volume, in that volume (shared with other containers)
+func (r *Runtime) setFile(c *container, filePath string, f *file) {
+	for dest, volume := range r.volumeMounts(c) {
+		if rel, found := strings.CutPrefix(filePath, dest+"/"); found {
+			r.volumeData[volume][rel] = f
+			return
+		}
+	}
+	c.files[filePath] = f
+}
+
+// getFiles returns all files of the container, including the ones in mounted named volumes
+func (r *Runtime) getFiles(c *container) map[string]*file {
+	files := maps.Clone(c.files)
+	for dest, volume := range r.volumeMounts(c) {
+		for rel, f := range r.volumeData[volume] {
+			files[path.Join(dest, rel)] = f
+		}
+	}
+	return files
+}
@@ -0,0 +1,213 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package nerdctl
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	l "github.com/k3d-io/k3d/v5/pkg/logger"
+)
+
+// cliError is returned if nerdctl exited with a non-zero exit code
+type cliError struct {
+	args     []string
+	stderr   string
+	exitCode int
+	cause    error
+}
+
+func (e *cliError) Error() string {
+	msg := strings.TrimSpace(e.stderr)
+	if msg == "" {
+		msg = e.cause.Error()
+	}
+	return fmt.Sprintf("'nerdctl %s' failed (exit code %d): %s", strings.Join(e.args, " "), e.exitCode, msg)
+}
+
+func (e *cliError) Unwrap() error {
+	return e.cause
+}
+
+// isNotFound checks if nerdctl failed, because the requested object does not exist
+func isNotFound(err error) bool {
+	var cliErr *cliError
+	if !errors.As(err, &cliErr) {
+		return false
+	}
+	stderr := strings.ToLower(cliErr.stderr)
+	return strings.Contains(stderr, "not found") || strings.Contains(stderr, "no such")
+}
+
+// ErrNerdctlNotFound is returned if the nerdctl binary, which every operation of the runtime depends on, cannot be found
+var ErrNerdctlNotFound = errors.New("the nerdctl runtime drives containerd by running the nerdctl CLI, which was not found")
+
+// nerdctlBinary returns the path of the nerdctl binary, which is looked up in $PATH unless set via EnvNerdctlBinary
+func nerdctlBinary() (string, error) {
+	binary := "nerdctl"
+	if override := os.Getenv(EnvNerdctlBinary); override != "" {
+		binary = override
+	}
+	path, err := exec.LookPath(binary)
+	if err != nil {
+		return "", fmt.Errorf("%w: install nerdctl (v1.0+) into your $PATH or set $%s to its location (%v)", ErrNerdctlNotFound, EnvNerdctlBinary, err)
+	}
+	return path, nil
+}
+
+// nerdctlCommand prepares a nerdctl command talking to the configured containerd socket and namespace
+func nerdctlCommand(ctx context.Context, args ...string) (*exec.Cmd, error) {
+	binary, err := nerdctlBinary()
+	if err != nil {
+		return nil, err
+	}
+	globalArgs := []string{
+		"--address", Nerdctl{}.GetRuntimePath(),
+		"--namespace", GetNamespace(),
+	}
+	l.Log().Tracef("[Nerdctl] Running 'nerdctl %s'", strings.Join(args, " "))
+	return exec.CommandContext(ctx, binary, append(globalArgs, args...)...), nil
+}
+
+// nerdctl runs nerdctl with the given arguments and returns its stdout once it exited
+func nerdctl(ctx context.Context, stdin io.Reader, args ...string) ([]byte, error) {
+	cmd, err := nerdctlCommand(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		return stdout.Bytes(), newCLIError(args, stderr.String(), err)
+	}
+	return stdout.Bytes(), nil
+}
+
+// nerdctlCombined runs nerdctl with the given arguments and returns its combined stdout and stderr once it exited
+func nerdctlCombined(ctx context.Context, stdin io.Reader, args ...string) ([]byte, error) {
+	cmd, err := nerdctlCommand(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	output := &bytes.Buffer{}
+	cmd.Stdin = stdin
+	cmd.Stdout = output
+	cmd.Stderr = output
+	if err := cmd.Run(); err != nil {
+		return output.Bytes(), newCLIError(args, "", err)
+	}
+	return output.Bytes(), nil
+}
+
+// nerdctlJSON runs nerdctl and decodes its (JSON) output into v
+func nerdctlJSON(ctx context.Context, v interface{}, args ...string) error {
+	out, err := nerdctl(ctx, nil, args...)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(out, v); err != nil {
+		return fmt.Errorf("failed to decode output of 'nerdctl %s': %w", strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+// nerdctlLines runs nerdctl and returns the non-empty lines of its output, e.g. for `--format '{{json .}}'` or `-q`
+func nerdctlLines(ctx context.Context, args ...string) ([]string, error) {
+	out, err := nerdctl(ctx, nil, args...)
+	if err != nil {
+		return nil, err
+	}
+	lines := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// nerdctlStream starts nerdctl and returns a stream of its stdout (and optionally stderr).
+// Closing the stream stops the process.
+func nerdctlStream(ctx context.Context, withStderr bool, args ...string) (io.ReadCloser, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	cmd, err := nerdctlCommand(ctx, args...)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	reader, writer := io.Pipe()
+	stderr := &bytes.Buffer{}
+	cmd.Stdout = writer
+	cmd.Stderr = stderr
+	if withStderr {
+		cmd.Stderr = writer
+	}
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to start 'nerdctl %s': %w", strings.Join(args, " "), err)
+	}
+
+	go func() {
+		err := cmd.Wait()
+		if err != nil && ctx.Err() == nil {
+			_ = writer.CloseWithError(newCLIError(args, stderr.String(), err))
+			return
+		}
+		_ = writer.Close()
+	}()
+
+	return &streamCloser{ReadCloser: reader, cancel: cancel}, nil
+}
+
+type streamCloser struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (s *streamCloser) Close() error {
+	s.cancel()
+	return s.ReadCloser.Close()
+}
+
+func newCLIError(args []string, stderr string, err error) error {
+	cliErr := &cliError{args: args, stderr: stderr, exitCode: -1, cause: err}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		cliErr.exitCode = exitErr.ExitCode()
+	}
+	return cliErr
+}
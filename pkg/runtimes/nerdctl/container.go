@@ -0,0 +1,127 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package nerdctl
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	l "github.com/k3d-io/k3d/v5/pkg/logger"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+// createContainer creates a new container from the translated nerdctl arguments, pulling the image if required
+func createContainer(ctx context.Context, args []string) (string, error) {
+	l.Log().Tracef("Creating container with arguments %+v", args)
+
+	out, err := nerdctl(ctx, nil, args...)
+	if err != nil {
+		return "", err
+	}
+	ID := strings.TrimSpace(string(out))
+	l.Log().Debugf("Created container (ID: %s)", ID)
+	return ID, nil
+}
+
+// removeContainer deletes a running container (like nerdctl rm -f -v)
+func removeContainer(ctx context.Context, ID string) error {
+	if _, err := nerdctl(ctx, nil, "rm", "--force", "--volumes", ID); err != nil {
+		return fmt.Errorf("nerdctl failed to remove the container '%s': %w", ID, err)
+	}
+
+	l.Log().Tracef("[Nerdctl] Deleted Container %s", ID)
+
+	return nil
+}
+
+// getContainersByLabel returns the IDs of all containers having all the default k3d labels and the given labels
+func getContainersByLabel(ctx context.Context, labels map[string]string) ([]string, error) {
+	args := []string{"ps", "--all", "--quiet", "--no-trunc"}
+	for k, v := range k3d.DefaultRuntimeLabels {
+		args = append(args, "--filter", fmt.Sprintf("label=%s=%s", k, v))
+	}
+	for k, v := range labels {
+		args = append(args, "--filter", fmt.Sprintf("label=%s=%s", k, v))
+	}
+
+	IDs, err := nerdctlLines(ctx, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+	return IDs, nil
+}
+
+// getContainerDetails inspects the containers with the given names or IDs
+func getContainerDetails(ctx context.Context, namesOrIDs ...string) ([]types.ContainerJSON, error) {
+	if len(namesOrIDs) == 0 {
+		return []types.ContainerJSON{}, nil
+	}
+
+	var containerDetails []types.ContainerJSON
+	args := append([]string{"container", "inspect", "--mode", "dockercompat"}, namesOrIDs...)
+	if err := nerdctlJSON(ctx, &containerDetails, args...); err != nil {
+		return nil, fmt.Errorf("failed to inspect container(s) %v: %w", namesOrIDs, err)
+	}
+	return containerDetails, nil
+}
+
+// getNodeContainer returns the details of the container matching the node's name (with or without the k3d- prefix) and all of its runtime labels
+func getNodeContainer(ctx context.Context, node *k3d.Node) (*types.ContainerJSON, error) {
+	candidates := []string{node.Name}
+	if !strings.HasPrefix(node.Name, k3d.DefaultObjectNamePrefix+"-") {
+		candidates = append(candidates, fmt.Sprintf("%s-%s", k3d.DefaultObjectNamePrefix, node.Name))
+	}
+
+	for _, candidate := range candidates {
+		containerDetails, err := getContainerDetails(ctx, candidate)
+		if err != nil {
+			if isNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		if len(containerDetails) != 1 {
+			return nil, fmt.Errorf("Failed to get a single container for name '%s'. Found: %d", node.Name, len(containerDetails))
+		}
+		if containerDetails[0].ContainerJSONBase == nil {
+			return nil, fmt.Errorf("failed to inspect container for node '%s'", node.Name)
+		}
+		if containerDetails[0].Config == nil || !hasLabels(containerDetails[0].Config.Labels, node.RuntimeLabels) {
+			continue
+		}
+		return &containerDetails[0], nil
+	}
+
+	return nil, fmt.Errorf("Didn't find container for node '%s'", node.Name)
+}
+
+func hasLabels(labels map[string]string, filter map[string]string) bool {
+	for k, v := range filter {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
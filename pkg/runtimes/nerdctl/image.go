@@ -0,0 +1,55 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package nerdctl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// GetImages returns a list of images present in the runtime
+func (c Nerdctl) GetImages(ctx context.Context) ([]string, error) {
+	lines, err := nerdctlLines(ctx, "images", "--format", "{{json .}}")
+	if err != nil {
+		return nil, fmt.Errorf("nerdctl failed to list images: %w", err)
+	}
+
+	var images []string
+	for _, line := range lines {
+		var image ImageListEntry
+		if err := json.Unmarshal([]byte(line), &image); err != nil {
+			return nil, fmt.Errorf("failed to decode image list entry '%s': %w", line, err)
+		}
+		if image.Repository == "" || image.Repository == "<none>" {
+			continue
+		}
+		if image.Tag == "" || image.Tag == "<none>" {
+			images = append(images, image.Repository)
+			continue
+		}
+		images = append(images, fmt.Sprintf("%s:%s", image.Repository, image.Tag))
+	}
+
+	return images, nil
+}
@@ -0,0 +1,62 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package nerdctl
+
+import (
+	"context"
+	"fmt"
+
+	runtimeTypes "github.com/k3d-io/k3d/v5/pkg/runtimes/types"
+)
+
+func (c Nerdctl) Info() (*runtimeTypes.RuntimeInfo, error) {
+	// fail early with a clear error, as a missing nerdctl would otherwise look like an unreachable containerd
+	if err := c.Preflight(); err != nil {
+		return nil, err
+	}
+
+	info := Info{}
+	if err := nerdctlJSON(context.Background(), &info, "info", "--format", "{{json .}}"); err != nil {
+		return nil, fmt.Errorf("nerdctl failed to provide info output: %w", err)
+	}
+
+	runtimeInfo := runtimeTypes.RuntimeInfo{
+		Name:          c.ID(),
+		Endpoint:      c.GetRuntimePath(),
+		Version:       info.ServerVersion,
+		OS:            info.OperatingSystem,
+		OSType:        info.OSType,
+		Arch:          info.Architecture,
+		CgroupVersion: info.CgroupVersion,
+		CgroupDriver:  info.CgroupDriver,
+		Filesystem:    "UNKNOWN",
+		InfoName:      info.Name,
+	}
+
+	// nerdctl reports the snapshotter as storage driver
+	if info.Driver != "" {
+		runtimeInfo.Filesystem = info.Driver
+	}
+
+	return &runtimeInfo, nil
+}
@@ -0,0 +1,109 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package nerdctl
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	l "github.com/k3d-io/k3d/v5/pkg/logger"
+	runtimeTypes "github.com/k3d-io/k3d/v5/pkg/runtimes/types"
+)
+
+// Nerdctl drives containerd directly (i.e. without a Docker daemon) by running the nerdctl CLI for every operation,
+// which provides the containerd namespace, CNI bridge networking and snapshotter based volumes.
+// It doesn't use the containerd client API, so nerdctl has to be installed (see Preflight).
+type Nerdctl struct{}
+
+const (
+	// DefaultContainerdSock is the socket of a default containerd setup
+	DefaultContainerdSock = "/run/containerd/containerd.sock"
+
+	// DefaultNamespace is the containerd namespace that k3d creates its containers, networks and volumes in
+	DefaultNamespace = "k3d"
+
+	// EnvAddress is the (nerdctl/ctr compatible) environment variable to override the containerd socket
+	EnvAddress = "CONTAINERD_ADDRESS"
+
+	// EnvNamespace is the (nerdctl/ctr compatible) environment variable to override the containerd namespace
+	EnvNamespace = "CONTAINERD_NAMESPACE"
+
+	// EnvNerdctlBinary is the environment variable to override the nerdctl binary which is looked up in $PATH by default
+	EnvNerdctlBinary = "K3D_NERDCTL_BINARY"
+)
+
+// connectionOpts override the default connection settings (i.e. CONTAINERD_ADDRESS and the default socket)
+var connectionOpts runtimeTypes.ConnectionOpts
+
+// SetConnectionOpts sets the containerd socket to connect to.
+// TLS and timeouts are not supported, as containerd only listens on a local socket.
+func (c Nerdctl) SetConnectionOpts(opts runtimeTypes.ConnectionOpts) error {
+	if opts.TLS != (runtimeTypes.TLSOpts{}) {
+		return fmt.Errorf("TLS is not supported by the nerdctl runtime")
+	}
+	if opts.Timeout != 0 {
+		return fmt.Errorf("connection timeouts are not supported by the nerdctl runtime")
+	}
+	if opts.Endpoint != "" && strings.Contains(opts.Endpoint, "://") && !strings.HasPrefix(opts.Endpoint, "unix://") {
+		return fmt.Errorf("unsupported containerd endpoint '%s' (only unix sockets are supported)", opts.Endpoint)
+	}
+	connectionOpts = opts
+	return nil
+}
+
+// ID returns the identity of the runtime
+func (c Nerdctl) ID() string {
+	return "nerdctl"
+}
+
+// Preflight checks that the nerdctl binary is available, which every operation of the runtime depends on
+func (c Nerdctl) Preflight() error {
+	_, err := nerdctlBinary()
+	return err
+}
+
+// GetHost returns the containerd host, which is always empty, as containerd only listens on a local socket
+func (c Nerdctl) GetHost() string {
+	return ""
+}
+
+// GetRuntimePath returns the path of the containerd socket
+func (c Nerdctl) GetRuntimePath() string {
+	if connectionOpts.Endpoint != "" {
+		return strings.TrimPrefix(connectionOpts.Endpoint, "unix://")
+	}
+	if address := os.Getenv(EnvAddress); address != "" {
+		l.Log().Tracef("[Nerdctl] Using address '%s' from $%s", address, EnvAddress)
+		return address
+	}
+	return DefaultContainerdSock
+}
+
+// GetNamespace returns the containerd namespace used by k3d
+func GetNamespace() string {
+	if namespace := os.Getenv(EnvNamespace); namespace != "" {
+		return namespace
+	}
+	return DefaultNamespace
+}
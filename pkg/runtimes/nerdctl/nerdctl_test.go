@@ -0,0 +1,115 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package nerdctl
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	runtimeErrors "github.com/k3d-io/k3d/v5/pkg/runtimes/errors"
+)
+
+// fakeNerdctl is a shell script that records its arguments and answers a few commands like nerdctl would
+const fakeNerdctl = `#!/bin/sh
+echo "$@" >> "$FAKE_NERDCTL_LOG"
+# skip global flags
+while [ "${1#--}" != "$1" ]; do shift 2; done
+case "$1 $2" in
+  "info --format")
+    echo '{"Name":"ci-host","ServerVersion":"v1.7.2","OSType":"linux","OperatingSystem":"Ubuntu 22.04","Architecture":"x86_64","CgroupDriver":"systemd","CgroupVersion":"2","Driver":"overlayfs"}'
+    ;;
+  "volume inspect")
+    echo "time=\"2023-01-01T00:00:00Z\" level=fatal msg=\"no such volume: $3\"" >&2
+    exit 1
+    ;;
+  *)
+    echo "unexpected command: $*" >&2
+    exit 2
+    ;;
+esac
+`
+
+func setupFakeNerdctl(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	binary := filepath.Join(dir, "nerdctl")
+	if err := os.WriteFile(binary, []byte(fakeNerdctl), 0755); err != nil {
+		t.Fatal(err)
+	}
+	logFile := filepath.Join(dir, "calls.log")
+	t.Setenv(EnvNerdctlBinary, binary)
+	t.Setenv("FAKE_NERDCTL_LOG", logFile)
+	t.Setenv(EnvAddress, "/run/k3d-test/containerd.sock")
+	t.Setenv(EnvNamespace, "")
+	return logFile
+}
+
+func TestNerdctlInfo(t *testing.T) {
+	logFile := setupFakeNerdctl(t)
+
+	info, err := Nerdctl{}.Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name != "nerdctl" || info.Version != "v1.7.2" || info.Filesystem != "overlayfs" || info.CgroupVersion != "2" {
+		t.Errorf("unexpected runtime info: %+v", info)
+	}
+	if info.Endpoint != "/run/k3d-test/containerd.sock" {
+		t.Errorf("expected endpoint from $%s, got '%s'", EnvAddress, info.Endpoint)
+	}
+
+	calls, err := os.ReadFile(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "--address /run/k3d-test/containerd.sock --namespace k3d info"; !strings.HasPrefix(string(calls), expected) {
+		t.Errorf("expected nerdctl to be called with '%s...', got '%s'", expected, calls)
+	}
+}
+
+func TestNerdctlVolumeNotFound(t *testing.T) {
+	setupFakeNerdctl(t)
+
+	_, err := Nerdctl{}.GetVolume("k3d-missing")
+	if !errors.Is(err, runtimeErrors.ErrRuntimeVolumeNotExists) {
+		t.Errorf("expected error '%v', got '%v'", runtimeErrors.ErrRuntimeVolumeNotExists, err)
+	}
+}
+
+func TestNerdctlInfoWithoutNerdctl(t *testing.T) {
+	t.Setenv(EnvNerdctlBinary, "")
+	t.Setenv("PATH", t.TempDir())
+
+	_, err := Nerdctl{}.Info()
+	if !errors.Is(err, ErrNerdctlNotFound) {
+		t.Errorf("expected error '%v', got '%v'", ErrNerdctlNotFound, err)
+	}
+
+	t.Setenv(EnvNerdctlBinary, filepath.Join(t.TempDir(), "nerdctl"))
+	if _, err := (Nerdctl{}).Info(); !errors.Is(err, ErrNerdctlNotFound) {
+		t.Errorf("expected error '%v' for a missing $%s, got '%v'", ErrNerdctlNotFound, EnvNerdctlBinary, err)
+	}
+}
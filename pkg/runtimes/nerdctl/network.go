@@ -0,0 +1,237 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package nerdctl
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"strings"
+
+	l "github.com/k3d-io/k3d/v5/pkg/logger"
+	runtimeErr "github.com/k3d-io/k3d/v5/pkg/runtimes/errors"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+// GetNetwork returns a given network
+func (c Nerdctl) GetNetwork(ctx context.Context, searchNet *k3d.ClusterNetwork) (*k3d.ClusterNetwork, error) {
+	if searchNet.ID == "" && searchNet.Name == "" {
+		return nil, fmt.Errorf("failed to get network, because neither name nor ID was provided")
+	}
+
+	nameOrID := searchNet.Name
+	if nameOrID == "" {
+		nameOrID = searchNet.ID
+	}
+
+	targetNetwork, err := inspectNetwork(ctx, nameOrID)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, runtimeErr.ErrRuntimeNetworkNotExists
+		}
+		return nil, fmt.Errorf("nerdctl failed to inspect network %s: %w", nameOrID, err)
+	}
+	l.Log().Debugf("Found network %+v", targetNetwork)
+
+	k3dNetwork := &k3d.ClusterNetwork{
+		Name: targetNetwork.Name,
+		ID:   targetNetwork.ID,
+	}
+
+	// find the containers connected to the network, as the inspect output doesn't contain them
+	IDs, err := getContainersByLabel(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+	containerDetails, err := getContainerDetails(ctx, IDs...)
+	if err != nil {
+		return nil, err
+	}
+	members := []*k3d.NetworkMember{}
+	for _, details := range containerDetails {
+		if details.NetworkSettings == nil || details.NetworkSettings.Networks[targetNetwork.Name] == nil {
+			continue
+		}
+		ipAddr, err := netip.ParseAddr(details.NetworkSettings.Networks[targetNetwork.Name].IPAddress)
+		if err != nil {
+			l.Log().Tracef("network member %s has no IP in network %s (likely not running): %v", details.Name, targetNetwork.Name, err)
+			continue
+		}
+		members = append(members, &k3d.NetworkMember{Name: strings.TrimPrefix(details.Name, "/"), IP: ipAddr})
+	}
+
+	// for networks that have a subnet, we inspect that as well (e.g. "host" network doesn't have it)
+	if len(targetNetwork.IPAM.Config) > 0 {
+		k3dNetwork.IPAM, err = parseIPAM(targetNetwork.IPAM.Config[0])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse IPAM config: %w", err)
+		}
+
+		for _, member := range members {
+			k3dNetwork.IPAM.IPsUsed = append(k3dNetwork.IPAM.IPsUsed, member.IP)
+		}
+
+		// append the used IPs that we already know from the search network,
+		// as we already need those before the containers are started
+		k3dNetwork.IPAM.IPsUsed = append(k3dNetwork.IPAM.IPsUsed, searchNet.IPAM.IPsUsed...)
+	} else {
+		l.Log().Debugf("Network %s does not have an IPAM config", k3dNetwork.Name)
+	}
+
+	k3dNetwork.Members = members
+
+	return k3dNetwork, nil
+}
+
+// CreateNetworkIfNotPresent creates a new CNI bridge network
+// @return: network, exists, error
+func (c Nerdctl) CreateNetworkIfNotPresent(ctx context.Context, inNet *k3d.ClusterNetwork) (*k3d.ClusterNetwork, bool, error) {
+	existingNet, err := c.GetNetwork(ctx, inNet)
+	if err != nil && err != runtimeErr.ErrRuntimeNetworkNotExists {
+		return nil, false, fmt.Errorf("failed to check for existing containerd networks: %w", err)
+	}
+	if existingNet != nil {
+		return existingNet, true, nil
+	}
+
+	args := []string{"network", "create", "--driver", "bridge"}
+	for _, k := range sortedKeys(k3d.DefaultRuntimeLabels) {
+		args = append(args, "--label", fmt.Sprintf("%s=%s", k, k3d.DefaultRuntimeLabels[k]))
+	}
+
+	// use user-defined subnet, if given - nerdctl picks a free subnet by itself otherwise
+	if inNet.IPAM.IPPrefix != (netip.Prefix{}) {
+		l.Log().Debugf("Using user-defined subnet prefix %s", inNet.IPAM.IPPrefix.String())
+		if !inNet.IPAM.IPPrefix.IsValid() {
+			return nil, false, fmt.Errorf("invalid subnet prefix: %s", inNet.IPAM.IPPrefix.String())
+		}
+		args = append(args,
+			"--subnet", inNet.IPAM.IPPrefix.String(),
+			"--gateway", inNet.IPAM.IPPrefix.Addr().Next().String(), // second IP in subnet will be the Gateway (Next, so we don't hit x.x.x.0)
+		)
+	}
+	args = append(args, inNet.Name)
+
+	if _, err := nerdctl(ctx, nil, args...); err != nil {
+		return nil, false, fmt.Errorf("nerdctl failed to create new network '%s': %w", inNet.Name, err)
+	}
+	l.Log().Infof("Created network '%s'", inNet.Name)
+
+	newNet, err := inspectNetwork(ctx, inNet.Name)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to inspect newly created network '%s': %w", inNet.Name, err)
+	}
+	if len(newNet.IPAM.Config) == 0 {
+		return nil, false, fmt.Errorf("newly created network '%s' has no subnet", inNet.Name)
+	}
+	prefix, err := netip.ParsePrefix(newNet.IPAM.Config[0].Subnet)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to parse IP Prefix of newly created network '%s': %w", newNet.Name, err)
+	}
+
+	newClusterNet := &k3d.ClusterNetwork{Name: inNet.Name, ID: newNet.ID, IPAM: k3d.IPAM{IPPrefix: prefix}}
+
+	if inNet.IPAM.Managed || inNet.IPAM.IPPrefix != (netip.Prefix{}) {
+		newClusterNet.IPAM.Managed = true
+	}
+
+	return newClusterNet, false, nil
+}
+
+// DeleteNetwork deletes a network
+func (c Nerdctl) DeleteNetwork(ctx context.Context, ID string) error {
+	if _, err := nerdctl(ctx, nil, "network", "rm", ID); err != nil {
+		if strings.Contains(err.Error(), "in use") {
+			return runtimeErr.ErrRuntimeNetworkNotEmpty
+		}
+		return fmt.Errorf("nerdctl failed to remove network '%s': %w", ID, err)
+	}
+	return nil
+}
+
+// inspectNetwork gets information about a network by its name or ID
+func inspectNetwork(ctx context.Context, nameOrID string) (*NetworkInspect, error) {
+	var networks []NetworkInspect
+	if err := nerdctlJSON(ctx, &networks, "network", "inspect", "--mode", "dockercompat", nameOrID); err != nil {
+		return nil, err
+	}
+	if len(networks) != 1 {
+		return nil, fmt.Errorf("expected a single network for '%s', got %d", nameOrID, len(networks))
+	}
+	return &networks[0], nil
+}
+
+// GetGatewayIP returns the IP of the network gateway
+func GetGatewayIP(ctx context.Context, network string) (netip.Addr, error) {
+	bridgeNetwork, err := inspectNetwork(ctx, network)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("failed to get bridge network with name '%s': %w", network, err)
+	}
+
+	if len(bridgeNetwork.IPAM.Config) == 0 {
+		return netip.Addr{}, fmt.Errorf("Failed to get IPAM Config for network %s", bridgeNetwork.Name)
+	}
+	ipam, err := parseIPAM(bridgeNetwork.IPAM.Config[0])
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("failed to get gateway of network %s: %w", bridgeNetwork.Name, err)
+	}
+	return ipam.IPsUsed[0], nil
+}
+
+// ConnectNodeToNetwork connects a node to a network
+func (c Nerdctl) ConnectNodeToNetwork(ctx context.Context, node *k3d.Node, networkName string) error {
+	// check that node was not attached to network before
+	for _, nw := range node.Networks {
+		if nw == networkName {
+			l.Log().Infof("Container '%s' is already connected to '%s'", node.Name, networkName)
+			return nil
+		}
+	}
+	return fmt.Errorf("failed to connect node '%s' to network '%s': connecting existing containers to networks is not supported by nerdctl", node.Name, networkName)
+}
+
+// DisconnectNodeFromNetwork disconnects a node from a network
+func (c Nerdctl) DisconnectNodeFromNetwork(ctx context.Context, node *k3d.Node, networkName string) error {
+	return fmt.Errorf("failed to disconnect node '%s' from network '%s': disconnecting containers from networks is not supported by nerdctl", node.Name, networkName)
+}
+
+// parseIPAM Returns an IPAM structure with the subnet and gateway filled in. If some of the values
+// cannot be parsed, an error is returned. If gateway is empty, the function calculates the default gateway.
+func parseIPAM(config NetworkIPAMConfig) (ipam k3d.IPAM, err error) {
+	var gateway netip.Addr
+	ipam = k3d.IPAM{IPsUsed: []netip.Addr{}}
+
+	ipam.IPPrefix, err = netip.ParsePrefix(config.Subnet)
+	if err != nil {
+		return
+	}
+
+	if config.Gateway == "" {
+		gateway = ipam.IPPrefix.Addr().Next()
+	} else {
+		gateway, err = netip.ParseAddr(config.Gateway)
+	}
+	ipam.IPsUsed = append(ipam.IPsUsed, gateway)
+
+	return
+}
@@ -0,0 +1,316 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package nerdctl
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	l "github.com/k3d-io/k3d/v5/pkg/logger"
+	runtimeErr "github.com/k3d-io/k3d/v5/pkg/runtimes/errors"
+	runtimeTypes "github.com/k3d-io/k3d/v5/pkg/runtimes/types"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+// CreateNode creates a new container
+func (c Nerdctl) CreateNode(ctx context.Context, node *k3d.Node) error {
+	// translate node spec to nerdctl arguments
+	args, err := TranslateNodeToArgs(node)
+	if err != nil {
+		return fmt.Errorf("failed to translate k3d node spec to nerdctl arguments: %w", err)
+	}
+
+	// create node
+	if _, err := createContainer(ctx, args); err != nil {
+		return fmt.Errorf("failed to create container for node '%s': %w", node.Name, err)
+	}
+
+	return nil
+}
+
+// DeleteNode deletes a node
+func (c Nerdctl) DeleteNode(ctx context.Context, nodeSpec *k3d.Node) error {
+	l.Log().Debugf("Deleting node %s ...", nodeSpec.Name)
+	return removeContainer(ctx, nodeSpec.Name)
+}
+
+// GetNodesByLabel returns a list of existing nodes
+func (c Nerdctl) GetNodesByLabel(ctx context.Context, labels map[string]string) ([]*k3d.Node, error) {
+	// (0) get containers
+	IDs, err := getContainersByLabel(ctx, labels)
+	if err != nil {
+		return nil, fmt.Errorf("nerdctl failed to get containers with labels '%v': %w", labels, err)
+	}
+
+	containerDetails, err := getContainerDetails(ctx, IDs...)
+	if err != nil {
+		return nil, err
+	}
+
+	// (1) convert them to node structs
+	nodes := []*k3d.Node{}
+	for _, details := range containerDetails {
+		node, err := TranslateContainerDetailsToNode(details)
+		if err != nil {
+			return nil, fmt.Errorf("failed to translate container '%s' details to k3d node spec: %w", details.Name, err)
+		}
+		nodes = append(nodes, node)
+	}
+
+	return nodes, nil
+}
+
+// StartNode starts an existing node
+func (c Nerdctl) StartNode(ctx context.Context, node *k3d.Node) error {
+	// get container which represents the node
+	nodeContainer, err := getNodeContainer(ctx, node)
+	if err != nil {
+		return fmt.Errorf("failed to get container for node '%s': %w", node.Name, err)
+	}
+
+	// check if the container is actually managed by
+	if v, ok := nodeContainer.Config.Labels["app"]; !ok || v != "k3d" {
+		return fmt.Errorf("Failed to determine if container '%s' is managed by k3d (needs label 'app=k3d')", nodeContainer.ID)
+	}
+
+	// actually start the container
+	l.Log().Infof("Starting node '%s'", node.Name)
+	startTime := time.Now().UTC()
+	if _, err := nerdctl(ctx, nil, "start", nodeContainer.ID); err != nil {
+		return fmt.Errorf("nerdctl failed to start container for node '%s': %w", node.Name, err)
+	}
+
+	// get container which represents the node
+	containerDetails, err := getContainerDetails(ctx, nodeContainer.ID)
+	if err != nil || len(containerDetails) != 1 {
+		return fmt.Errorf("Failed to inspect container %s for node %s: %+v", node.Name, nodeContainer.ID, err)
+	}
+
+	// not all versions of nerdctl report the start time, so we fall back to the time right before starting it
+	started := startTime
+	if t, err := time.Parse(time.RFC3339Nano, containerDetails[0].State.StartedAt); err == nil && !t.IsZero() {
+		started = t.UTC()
+	}
+
+	node.Created = containerDetails[0].Created
+	node.State.Running = containerDetails[0].State.Running
+	node.State.Started = started.Format(time.RFC3339Nano)
+
+	return nil
+}
+
+// StopNode stops an existing node
+func (c Nerdctl) StopNode(ctx context.Context, node *k3d.Node) error {
+	// get container which represents the node
+	nodeContainer, err := getNodeContainer(ctx, node)
+	if err != nil {
+		return fmt.Errorf("failed to get container for node '%s': %w", node.Name, err)
+	}
+
+	// check if the container is actually managed by
+	if v, ok := nodeContainer.Config.Labels["app"]; !ok || v != "k3d" {
+		return fmt.Errorf("Failed to determine if container '%s' is managed by k3d (needs label 'app=k3d')", nodeContainer.ID)
+	}
+
+	// actually stop the container
+	if _, err := nerdctl(ctx, nil, "stop", nodeContainer.ID); err != nil {
+		return fmt.Errorf("nerdctl failed to stop the container '%s': %w", nodeContainer.ID, err)
+	}
+
+	return nil
+}
+
+// GetNode tries to get a node container by its name
+func (c Nerdctl) GetNode(ctx context.Context, node *k3d.Node) (*k3d.Node, error) {
+	containerDetails, err := getNodeContainer(ctx, node)
+	if err != nil {
+		return node, fmt.Errorf("failed to get container for node '%s': %w", node.Name, err)
+	}
+
+	node, err = TranslateContainerDetailsToNode(*containerDetails)
+	if err != nil {
+		return node, fmt.Errorf("failed to translate container '%s' details to node spec: %w", containerDetails.Name, err)
+	}
+
+	return node, nil
+}
+
+// GetNodeStatus returns the status of a node (Running, Started, etc.)
+func (c Nerdctl) GetNodeStatus(ctx context.Context, node *k3d.Node) (bool, string, error) {
+	containerDetails, err := getNodeContainer(ctx, node)
+	if err != nil {
+		return false, "", fmt.Errorf("failed to get container for node '%s': %w", node.Name, err)
+	}
+
+	return containerDetails.State.Running, containerDetails.State.Status, nil
+}
+
+// GetNodeLogs returns the logs from a given node
+func (c Nerdctl) GetNodeLogs(ctx context.Context, node *k3d.Node, since time.Time, opts *runtimeTypes.NodeLogsOpts) (io.ReadCloser, error) {
+	containerDetails, err := getNodeContainer(ctx, node)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get container for node '%s': %w", node.Name, err)
+	}
+
+	if !containerDetails.State.Running {
+		return nil, fmt.Errorf("node '%s' (container '%s') not running", node.Name, containerDetails.ID)
+	}
+
+	args := []string{"logs"}
+	if !since.IsZero() {
+		args = append(args, "--since", since.UTC().Format(time.RFC3339Nano))
+	}
+	if opts != nil && opts.Follow {
+		args = append(args, "--follow")
+	}
+	args = append(args, containerDetails.ID)
+
+	logreader, err := nerdctlStream(ctx, true, args...)
+	if err != nil {
+		return nil, fmt.Errorf("nerdctl failed to get logs from node '%s' (container '%s'): %w", node.Name, containerDetails.ID, err)
+	}
+
+	return logreader, nil
+}
+
+// ExecInNodeGetLogs executes a command inside a node and returns the logs to the caller, e.g. to parse them
+func (c Nerdctl) ExecInNodeGetLogs(ctx context.Context, node *k3d.Node, cmd []string) (*bufio.Reader, error) {
+	logs, err := executeInNode(ctx, node, cmd, nil)
+	if logs == nil {
+		return nil, err
+	}
+	return bufio.NewReader(bytes.NewReader(logs)), err
+}
+
+// ExecInNode execs a command inside a node
+func (c Nerdctl) ExecInNode(ctx context.Context, node *k3d.Node, cmd []string) error {
+	return execInNode(ctx, node, cmd, nil)
+}
+
+// ExecInNodeWithStdin execs a command inside a node, streaming the given reader to its stdin
+func (c Nerdctl) ExecInNodeWithStdin(ctx context.Context, node *k3d.Node, cmd []string, stdin io.ReadCloser) error {
+	return execInNode(ctx, node, cmd, stdin)
+}
+
+func execInNode(ctx context.Context, node *k3d.Node, cmd []string, stdin io.ReadCloser) error {
+	logs, err := executeInNode(ctx, node, cmd, stdin)
+	if err != nil && logs != nil {
+		err = fmt.Errorf("%w: Logs from failed access process:\n%s", err, string(logs))
+	}
+	return err
+}
+
+// executeInNode runs a command inside a node and returns its (combined) output once it exited
+func executeInNode(ctx context.Context, node *k3d.Node, cmd []string, stdin io.ReadCloser) ([]byte, error) {
+	l.Log().Debugf("Executing command '%+v' in node '%s'", cmd, node.Name)
+
+	// get the container for the given node
+	nodeContainer, err := getNodeContainer(ctx, node)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get container for node '%s': %w", node.Name, err)
+	}
+
+	args := []string{"exec", "--privileged"}
+	var input io.Reader
+	if stdin != nil {
+		defer stdin.Close()
+		args = append(args, "--interactive")
+		input = stdin
+	}
+	args = append(args, nodeContainer.ID)
+	args = append(args, cmd...)
+
+	logs, err := nerdctlCombined(ctx, input, args...)
+	if err != nil {
+		var cliErr *cliError
+		if errors.As(err, &cliErr) && cliErr.exitCode > 0 {
+			return logs, fmt.Errorf("Exec process in node '%s' failed with exit code '%d'", node.Name, cliErr.exitCode)
+		}
+		return logs, fmt.Errorf("nerdctl failed to exec in node '%s': %w", node.Name, err)
+	}
+
+	l.Log().Debugf("Exec process in node '%s' exited with '0'", node.Name)
+	return logs, nil
+}
+
+// GetImageStream creates a tar stream for the given images, to be read (and closed) by the caller
+func (c Nerdctl) GetImageStream(ctx context.Context, images []string) (io.ReadCloser, error) {
+	stream, err := nerdctlStream(ctx, false, append([]string{"save"}, images...)...)
+	if err != nil {
+		return nil, fmt.Errorf("nerdctl failed to export images %v: %w", images, err)
+	}
+	return stream, nil
+}
+
+// GetNodesInNetwork returns all the nodes connected to a given network
+func (c Nerdctl) GetNodesInNetwork(ctx context.Context, network string) ([]*k3d.Node, error) {
+	IDs, err := getContainersByLabel(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+	containerDetails, err := getContainerDetails(ctx, IDs...)
+	if err != nil {
+		return nil, err
+	}
+
+	connectedNodes := []*k3d.Node{}
+
+	// nerdctl cannot filter containers by network, so we check the network settings of all k3d containers
+	for _, details := range containerDetails {
+		if details.NetworkSettings == nil {
+			continue
+		}
+		if _, ok := details.NetworkSettings.Networks[network]; !ok {
+			continue
+		}
+		node, err := TranslateContainerDetailsToNode(details)
+		if err != nil {
+			if errors.Is(err, runtimeErr.ErrRuntimeContainerUnknown) {
+				l.Log().Tracef("GetNodesInNetwork: inspected non-k3d-managed container %s", details.Name)
+				continue
+			}
+			return nil, fmt.Errorf("failed to translate container '%s' details to node spec: %w", details.Name, err)
+		}
+		connectedNodes = append(connectedNodes, node)
+	}
+
+	return connectedNodes, nil
+}
+
+// RenameNode renames the container of a node
+func (c Nerdctl) RenameNode(ctx context.Context, node *k3d.Node, newName string) error {
+	nodeContainer, err := getNodeContainer(ctx, node)
+	if err != nil {
+		return fmt.Errorf("failed to get container for node '%s': %w", node.Name, err)
+	}
+
+	if _, err := nerdctl(ctx, nil, "rename", nodeContainer.ID, newName); err != nil {
+		return fmt.Errorf("nerdctl failed to rename container '%s' to '%s': %w", nodeContainer.ID, newName, err)
+	}
+	return nil
+}
@@ -0,0 +1,251 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package nerdctl
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	docker "github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/go-connections/nat"
+	dockerunits "github.com/docker/go-units"
+	l "github.com/k3d-io/k3d/v5/pkg/logger"
+	dockerRuntime "github.com/k3d-io/k3d/v5/pkg/runtimes/docker"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+	"github.com/k3d-io/k3d/v5/pkg/util"
+)
+
+// labelRestartPolicy is the label used by containerd's restart manager (and thus nerdctl) to store the restart policy
+const labelRestartPolicy = "containerd.io/restart.policy"
+
+// TranslateNodeToArgs translates a k3d node specification to the arguments of `nerdctl create`
+func TranslateNodeToArgs(node *k3d.Node) ([]string, error) {
+	args := []string{"create", "--name", node.Name, "--hostname", node.Name}
+
+	/* Init */
+	init := true
+	if disableInit, err := strconv.ParseBool(os.Getenv(k3d.K3dEnvDebugDisableDockerInit)); err == nil && disableInit {
+		l.Log().Traceln("init disabled for all containers")
+		init = false
+	}
+	if init {
+		args = append(args, "--init")
+	}
+
+	/* They have to run in privileged mode */
+	args = append(args, "--privileged")
+
+	if node.HostPidMode {
+		args = append(args, "--pid", "host")
+	}
+
+	/* Entrypoint */
+	if node.K3dEntrypoint && (node.Role == k3d.AgentRole || node.Role == k3d.ServerRole) {
+		args = append(args, "--entrypoint", "/bin/k3d-entrypoint.sh")
+	}
+	if node.Role == k3d.LoadBalancerRole && node.RuntimeLabels[k3d.LabelLoadbalancerCopyBinary] == "true" {
+		// the k3d binary copied into the native loadbalancer
+		args = append(args, "--entrypoint", k3d.DefaultLoadbalancerNativeBinary)
+	}
+
+	/* Environment Variables */
+	for _, env := range node.Env {
+		args = append(args, "--env", env)
+	}
+
+	/* Labels */
+	for _, k := range sortedKeys(node.RuntimeLabels) {
+		args = append(args, "--label", fmt.Sprintf("%s=%s", k, node.RuntimeLabels[k]))
+	}
+
+	/* Ulimits */
+	for _, ulimit := range node.RuntimeUlimits {
+		args = append(args, "--ulimit", fmt.Sprintf("%s=%d:%d", ulimit.Name, ulimit.Soft, ulimit.Hard))
+	}
+
+	/* Auto-Restart */
+	if node.Restart {
+		args = append(args, "--restart", "unless-stopped")
+	}
+
+	/* Tmpfs Mounts */
+	for _, mnt := range k3d.DefaultTmpfsMounts {
+		args = append(args, "--tmpfs", mnt)
+	}
+
+	/* GPUs */
+	if node.GPURequest != "" {
+		args = append(args, "--gpus", node.GPURequest)
+	}
+
+	/* Memory Limits */
+	if node.Memory != "" {
+		memory, err := dockerunits.RAMInBytes(node.Memory)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to set memory limit: %+v", err)
+		}
+		args = append(args, "--memory", strconv.FormatInt(memory, 10))
+	}
+
+	/* CPU Limits */
+	if node.CPUs != "" {
+		if _, err := util.ParseCPUs(node.CPUs); err != nil {
+			return nil, fmt.Errorf("Failed to set CPU limit: %+v", err)
+		}
+		args = append(args, "--cpus", node.CPUs)
+	}
+	if node.CPUSet != "" {
+		args = append(args, "--cpuset-cpus", node.CPUSet)
+	}
+
+	/* Volumes */
+	for _, volume := range node.Volumes {
+		args = append(args, "--volume", volume)
+	}
+
+	/* Ports */
+	ports := make([]string, 0, len(node.Ports))
+	for port := range node.Ports {
+		ports = append(ports, string(port))
+	}
+	sort.Strings(ports)
+	for _, port := range ports {
+		for _, binding := range node.Ports[nat.Port(port)] {
+			args = append(args, "--publish", translatePortBinding(nat.Port(port), binding))
+		}
+	}
+
+	/* Networks */
+	for _, net := range node.Networks {
+		args = append(args, "--network", net)
+	}
+
+	/* Static IP */
+	if node.IP.IP.IsValid() && node.IP.Static {
+		args = append(args, "--ip", node.IP.IP.String())
+	}
+
+	/* Extra Hosts */
+	for _, host := range node.ExtraHosts {
+		args = append(args, "--add-host", host)
+	}
+
+	/* Image, Command & Arguments */
+	args = append(args, node.Image)
+	args = append(args, node.Cmd...)  // contains k3s command and role-specific required flags/args
+	args = append(args, node.Args...) // extra flags/args
+
+	return args, nil
+}
+
+// translatePortBinding formats a port binding as `[hostIP:][hostPort:]containerPort/proto`
+func translatePortBinding(port nat.Port, binding nat.PortBinding) string {
+	containerPort := fmt.Sprintf("%s/%s", port.Port(), port.Proto())
+	switch {
+	case binding.HostIP != "":
+		return fmt.Sprintf("%s:%s:%s", binding.HostIP, binding.HostPort, containerPort)
+	case binding.HostPort != "":
+		return fmt.Sprintf("%s:%s", binding.HostPort, containerPort)
+	default:
+		return containerPort
+	}
+}
+
+// volumeDataPathRegexp matches the host path of a named nerdctl volume, e.g. /var/lib/nerdctl/1935db59/volumes/k3d/k3d-test-images/_data
+var volumeDataPathRegexp = regexp.MustCompile(`/volumes/[^/]+/([^/]+)/_data$`)
+
+// TranslateContainerDetailsToNode translates the (docker compatible) output of `nerdctl container inspect` into a k3d node representation
+func TranslateContainerDetailsToNode(containerDetails types.ContainerJSON) (*k3d.Node, error) {
+	if containerDetails.ContainerJSONBase == nil {
+		return nil, fmt.Errorf("container details are missing the container base information")
+	}
+	if containerDetails.Config == nil {
+		containerDetails.Config = &docker.Config{}
+	}
+	if containerDetails.HostConfig == nil {
+		containerDetails.HostConfig = &docker.HostConfig{}
+	}
+	if containerDetails.NetworkSettings == nil {
+		containerDetails.NetworkSettings = &types.NetworkSettings{}
+	}
+	if containerDetails.State == nil {
+		containerDetails.State = &types.ContainerState{}
+	}
+
+	// nerdctl only reports the process arguments
+	if len(containerDetails.Config.Cmd) == 0 {
+		containerDetails.Config.Cmd = containerDetails.Args
+	}
+
+	// nerdctl does not report binds, but only the mounts
+	if len(containerDetails.HostConfig.Binds) == 0 {
+		for _, mnt := range containerDetails.Mounts {
+			source := mnt.Source
+			switch {
+			case mnt.Type == mount.TypeTmpfs:
+				continue
+			case mnt.Name != "":
+				source = mnt.Name
+			case volumeDataPathRegexp.MatchString(mnt.Source):
+				source = volumeDataPathRegexp.FindStringSubmatch(mnt.Source)[1]
+			}
+			bind := fmt.Sprintf("%s:%s", source, mnt.Destination)
+			if !mnt.RW {
+				bind += ":ro"
+			}
+			containerDetails.HostConfig.Binds = append(containerDetails.HostConfig.Binds, bind)
+		}
+	}
+
+	// the restart policy is stored as a label by nerdctl
+	if policy, ok := containerDetails.Config.Labels[labelRestartPolicy]; ok && containerDetails.HostConfig.RestartPolicy.Name == "" {
+		containerDetails.HostConfig.RestartPolicy.Name = docker.RestartPolicyMode(strings.SplitN(policy, ":", 2)[0])
+	}
+
+	// older versions of nerdctl only report the port bindings in the network settings
+	if len(containerDetails.HostConfig.PortBindings) == 0 {
+		containerDetails.HostConfig.PortBindings = nat.PortMap{}
+		for port, bindings := range containerDetails.NetworkSettings.Ports {
+			if len(bindings) > 0 {
+				containerDetails.HostConfig.PortBindings[port] = bindings
+			}
+		}
+	}
+
+	return dockerRuntime.TranslateContainerDetailsToNode(containerDetails)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,176 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package nerdctl
+
+import (
+	"encoding/json"
+	"net/netip"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/go-connections/nat"
+	"github.com/go-test/deep"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+func TestTranslateNodeToArgs(t *testing.T) {
+	inputNode := &k3d.Node{
+		Name:    "test",
+		Role:    k3d.ServerRole,
+		Image:   "rancher/k3s:v0.9.0",
+		Volumes: []string{"/test:/tmp/test", "k3d-test-images:/k3d/images:rw"},
+		Env:     []string{"TEST_KEY_1=TEST_VAL_1"},
+		Cmd:     []string{"server", "--https-listen-port=6443"},
+		Args:    []string{"--some-boolflag"},
+		Ports: nat.PortMap{
+			"6443/tcp": []nat.PortBinding{
+				{
+					HostIP:   "0.0.0.0",
+					HostPort: "6443",
+				},
+			},
+			"80/tcp": []nat.PortBinding{
+				{
+					HostPort: "8080",
+				},
+			},
+		},
+		Restart:       true,
+		RuntimeLabels: map[string]string{k3d.LabelRole: string(k3d.ServerRole), "test_key_1": "test_val_1"},
+		Networks:      []string{"mynet"},
+		IP:            k3d.NodeIP{IP: netip.MustParseAddr("10.4.0.5"), Static: true},
+		Memory:        "1g",
+		CPUs:          "0.5",
+		CPUSet:        "2",
+		ExtraHosts:    []string{"host.k3d.internal:10.4.0.1"},
+	}
+
+	expectedArgs := []string{"create", "--name", "test", "--hostname", "test"}
+	if disableInit, err := strconv.ParseBool(os.Getenv(k3d.K3dEnvDebugDisableDockerInit)); err != nil || !disableInit {
+		expectedArgs = append(expectedArgs, "--init")
+	}
+	expectedArgs = append(expectedArgs,
+		"--privileged",
+		"--env", "TEST_KEY_1=TEST_VAL_1",
+		"--label", "k3d.role=server",
+		"--label", "test_key_1=test_val_1",
+		"--restart", "unless-stopped",
+		"--tmpfs", "/run",
+		"--tmpfs", "/var/run",
+		"--memory", "1073741824",
+		"--cpus", "0.5",
+		"--cpuset-cpus", "2",
+		"--volume", "/test:/tmp/test",
+		"--volume", "k3d-test-images:/k3d/images:rw",
+		"--publish", "0.0.0.0:6443:6443/tcp",
+		"--publish", "8080:80/tcp",
+		"--network", "mynet",
+		"--ip", "10.4.0.5",
+		"--add-host", "host.k3d.internal:10.4.0.1",
+		"rancher/k3s:v0.9.0",
+		"server", "--https-listen-port=6443", "--some-boolflag",
+	)
+
+	actualArgs, err := TranslateNodeToArgs(inputNode)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if diff := deep.Equal(actualArgs, expectedArgs); diff != nil {
+		t.Errorf("Actual arguments\n%+v\ndo not match expected arguments\n%+v\nDiff:\n%+v", actualArgs, expectedArgs, diff)
+	}
+}
+
+func TestTranslateContainerDetailsToNode(t *testing.T) {
+	// shortened output of `nerdctl container inspect --mode dockercompat`
+	inspectOutput := `{
+		"Id": "9c0b5a1e",
+		"Created": "2023-01-02T03:04:05.123456789Z",
+		"Path": "/bin/k3d-entrypoint.sh",
+		"Args": ["server", "--https-listen-port=6443"],
+		"State": {"Status": "running", "Running": true, "StartedAt": "2023-01-02T03:04:06.123456789Z"},
+		"Image": "docker.io/rancher/k3s:latest",
+		"Name": "k3d-test-server-0",
+		"Mounts": [
+			{"Type": "bind", "Source": "/var/lib/nerdctl/1935db59/volumes/k3d/k3d-test-images/_data", "Destination": "/k3d/images", "RW": true},
+			{"Type": "bind", "Source": "/etc/k3d", "Destination": "/etc/k3d", "RW": false},
+			{"Type": "tmpfs", "Source": "tmpfs", "Destination": "/run", "RW": true}
+		],
+		"Config": {
+			"Hostname": "k3d-test-server-0",
+			"Env": ["K3S_TOKEN=abc"],
+			"Labels": {
+				"app": "k3d",
+				"k3d.cluster": "test",
+				"k3d.role": "server",
+				"k3d.cluster.network": "k3d-test",
+				"containerd.io/restart.policy": "unless-stopped",
+				"nerdctl/name": "k3d-test-server-0"
+			}
+		},
+		"NetworkSettings": {
+			"Ports": {"6443/tcp": [{"HostIp": "0.0.0.0", "HostPort": "6550"}], "80/tcp": null},
+			"Networks": {"k3d-test": {"IPAddress": "10.4.0.2", "IPPrefixLen": 24}}
+		}
+	}`
+
+	var containerDetails types.ContainerJSON
+	if err := json.Unmarshal([]byte(inspectOutput), &containerDetails); err != nil {
+		t.Fatal(err)
+	}
+
+	node, err := TranslateContainerDetailsToNode(containerDetails)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "k3d-test-server-0"; node.Name != expected {
+		t.Errorf("expected name '%s', got '%s'", expected, node.Name)
+	}
+	if node.Role != k3d.ServerRole {
+		t.Errorf("expected role '%s', got '%s'", k3d.ServerRole, node.Role)
+	}
+	if diff := deep.Equal(node.Cmd, []string{"server", "--https-listen-port=6443"}); diff != nil {
+		t.Errorf("unexpected command: %v", diff)
+	}
+	if diff := deep.Equal(node.Volumes, []string{"k3d-test-images:/k3d/images", "/etc/k3d:/etc/k3d:ro"}); diff != nil {
+		t.Errorf("unexpected volumes: %v", diff)
+	}
+	if diff := deep.Equal(node.Ports, nat.PortMap{"6443/tcp": []nat.PortBinding{{HostIP: "0.0.0.0", HostPort: "6550"}}}); diff != nil {
+		t.Errorf("unexpected ports: %v", diff)
+	}
+	if !node.Restart {
+		t.Errorf("expected restart policy to be parsed from the labels")
+	}
+	if expected := netip.MustParseAddr("10.4.0.2"); node.IP.IP != expected {
+		t.Errorf("expected IP '%s', got '%s'", expected, node.IP.IP)
+	}
+	if !node.State.Running || node.State.Status != "running" {
+		t.Errorf("expected node to be running, got %+v", node.State)
+	}
+	if _, ok := node.RuntimeLabels["nerdctl/name"]; ok {
+		t.Errorf("expected only k3d labels, got %v", node.RuntimeLabels)
+	}
+}
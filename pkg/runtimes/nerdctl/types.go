@@ -0,0 +1,68 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package nerdctl
+
+// NetworkInspect is the (docker compatible) output of `nerdctl network inspect`
+type NetworkInspect struct {
+	Name   string            `json:"Name"`
+	ID     string            `json:"Id"`
+	IPAM   NetworkIPAM       `json:"IPAM"`
+	Labels map[string]string `json:"Labels"`
+}
+
+// NetworkIPAM holds the IPAM configuration of a CNI network
+type NetworkIPAM struct {
+	Config []NetworkIPAMConfig `json:"Config"`
+}
+
+// NetworkIPAMConfig is a single subnet of a CNI network
+type NetworkIPAMConfig struct {
+	Subnet  string `json:"Subnet"`
+	Gateway string `json:"Gateway"`
+}
+
+// VolumeInspect is the output of `nerdctl volume inspect`
+type VolumeInspect struct {
+	Name       string            `json:"Name"`
+	Mountpoint string            `json:"Mountpoint"`
+	Labels     map[string]string `json:"Labels"`
+}
+
+// ImageListEntry is a single line of `nerdctl images --format '{{json .}}'`
+type ImageListEntry struct {
+	Repository string `json:"Repository"`
+	Tag        string `json:"Tag"`
+	ID         string `json:"ID"`
+}
+
+// Info is the (docker compatible) output of `nerdctl info --format '{{json .}}'`
+type Info struct {
+	Name            string `json:"Name"`
+	ServerVersion   string `json:"ServerVersion"`
+	OSType          string `json:"OSType"`
+	OperatingSystem string `json:"OperatingSystem"`
+	Architecture    string `json:"Architecture"`
+	CgroupDriver    string `json:"CgroupDriver"`
+	CgroupVersion   string `json:"CgroupVersion"`
+	Driver          string `json:"Driver"`
+}
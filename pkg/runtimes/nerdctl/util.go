@@ -0,0 +1,126 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package nerdctl
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/docker/docker/pkg/archive"
+	l "github.com/k3d-io/k3d/v5/pkg/logger"
+	runtimeErrors "github.com/k3d-io/k3d/v5/pkg/runtimes/errors"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// CopyToNode copies a file or directory from the local FS to the selected node
+func (c Nerdctl) CopyToNode(ctx context.Context, src string, dest string, node *k3d.Node) error {
+	nodeContainer, err := getNodeContainer(ctx, node)
+	if err != nil {
+		return fmt.Errorf("failed to find container for target node '%s': %w", node.Name, err)
+	}
+
+	if _, err := nerdctl(ctx, nil, "cp", src, fmt.Sprintf("%s:%s", nodeContainer.ID, dest)); err != nil {
+		return fmt.Errorf("failed to copy '%s' to '%s' in container '%s': %w", src, dest, nodeContainer.ID, err)
+	}
+	return nil
+}
+
+// WriteToNode writes a byte array to the selected node
+func (c Nerdctl) WriteToNode(ctx context.Context, content []byte, dest string, mode os.FileMode, node *k3d.Node) error {
+	nodeContainer, err := getNodeContainer(ctx, node)
+	if err != nil {
+		return fmt.Errorf("Failed to find container for node '%s': %+v", node.Name, err)
+	}
+
+	// stage the file with its full target path, so that copying the staging root to '/' creates all parent directories
+	stagingDir, err := os.MkdirTemp("", "k3d-nerdctl-")
+	if err != nil {
+		return fmt.Errorf("Failed to create staging directory: %+v", err)
+	}
+	defer os.RemoveAll(stagingDir)
+
+	stagedFile := filepath.Join(stagingDir, filepath.FromSlash(path.Clean("/"+dest)))
+	if err := os.MkdirAll(filepath.Dir(stagedFile), 0755); err != nil {
+		return fmt.Errorf("Failed to create staging directory: %+v", err)
+	}
+	if err := os.WriteFile(stagedFile, content, mode); err != nil {
+		return fmt.Errorf("Failed to write staging file: %+v", err)
+	}
+	if err := os.Chmod(stagedFile, mode); err != nil { // umask may have applied on write
+		return fmt.Errorf("Failed to set mode of staging file: %+v", err)
+	}
+
+	if _, err := nerdctl(ctx, nil, "cp", stagingDir+"/.", fmt.Sprintf("%s:/", nodeContainer.ID)); err != nil {
+		return fmt.Errorf("Failed to copy content to container '%s': %+v", nodeContainer.ID, err)
+	}
+
+	return nil
+}
+
+// ReadFromNode reads from a given filepath inside the node container.
+// Like with docker, the returned stream is a tar archive containing the file.
+func (c Nerdctl) ReadFromNode(ctx context.Context, filePath string, node *k3d.Node) (io.ReadCloser, error) {
+	l.Log().Tracef("Reading path %s from node %s...", filePath, node.Name)
+	nodeContainer, err := getNodeContainer(ctx, node)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find container for node '%s': %w", node.Name, err)
+	}
+
+	stagingDir, err := os.MkdirTemp("", "k3d-nerdctl-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create staging directory: %w", err)
+	}
+
+	base := path.Base(filePath)
+	if _, err := nerdctl(ctx, nil, "cp", fmt.Sprintf("%s:%s", nodeContainer.ID, filePath), filepath.Join(stagingDir, base)); err != nil {
+		os.RemoveAll(stagingDir)
+		if isNotFound(err) {
+			return nil, errors.Wrap(runtimeErrors.ErrRuntimeFileNotFound, err.Error())
+		}
+		return nil, fmt.Errorf("failed to copy path '%s' from container '%s': %w", filePath, nodeContainer.ID, err)
+	}
+
+	tarStream, err := archive.TarWithOptions(stagingDir, &archive.TarOptions{IncludeFiles: []string{base}})
+	if err != nil {
+		os.RemoveAll(stagingDir)
+		return nil, fmt.Errorf("failed to create tar stream of '%s': %w", filePath, err)
+	}
+
+	return &cleanupReadCloser{ReadCloser: tarStream, dir: stagingDir}, nil
+}
+
+// cleanupReadCloser removes a staging directory once the stream read from it is closed
+type cleanupReadCloser struct {
+	io.ReadCloser
+	dir string
+}
+
+func (c *cleanupReadCloser) Close() error {
+	defer os.RemoveAll(c.dir)
+	return c.ReadCloser.Close()
+}
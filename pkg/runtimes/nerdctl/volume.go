@@ -0,0 +1,106 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package nerdctl
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	runtimeErrors "github.com/k3d-io/k3d/v5/pkg/runtimes/errors"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+// CreateVolume creates a new named volume (backed by the snapshotter's data root)
+func (c Nerdctl) CreateVolume(ctx context.Context, name string, labels map[string]string) error {
+	volumeLabels := map[string]string{}
+	for k, v := range labels {
+		volumeLabels[k] = v
+	}
+	for k, v := range k3d.DefaultRuntimeLabels {
+		volumeLabels[k] = v
+	}
+	for k, v := range k3d.DefaultRuntimeLabelsVar {
+		volumeLabels[k] = v
+	}
+
+	args := []string{"volume", "create"}
+	for _, k := range sortedKeys(volumeLabels) {
+		args = append(args, "--label", fmt.Sprintf("%s=%s", k, volumeLabels[k]))
+	}
+	args = append(args, name)
+
+	if _, err := nerdctl(ctx, nil, args...); err != nil {
+		return fmt.Errorf("failed to create volume '%s': %w", name, err)
+	}
+	return nil
+}
+
+// DeleteVolume deletes a named volume
+func (c Nerdctl) DeleteVolume(ctx context.Context, name string) error {
+	if _, err := nerdctl(ctx, nil, "volume", "rm", name); err != nil {
+		if isNotFound(err) {
+			return fmt.Errorf("failed to find volume '%s': %w", name, runtimeErrors.ErrRuntimeVolumeNotExists)
+		}
+		if strings.Contains(err.Error(), "in use") {
+			return fmt.Errorf("failed to delete volume '%s' as it is still referenced by a container: %w", name, err)
+		}
+		return fmt.Errorf("nerdctl failed to delete volume '%s': %w", name, err)
+	}
+
+	return nil
+}
+
+// GetVolume tries to get a named volume
+func (c Nerdctl) GetVolume(name string) (string, error) {
+	var volumes []VolumeInspect
+	if err := nerdctlJSON(context.Background(), &volumes, "volume", "inspect", name); err != nil {
+		if isNotFound(err) {
+			return "", fmt.Errorf("failed to find named volume '%s': %w", name, runtimeErrors.ErrRuntimeVolumeNotExists)
+		}
+		return "", fmt.Errorf("nerdctl failed to inspect volume '%s': %w", name, err)
+	}
+	for _, vol := range volumes {
+		if vol.Name == name {
+			return vol.Name, nil
+		}
+	}
+	return "", fmt.Errorf("failed to find named volume '%s': %w", name, runtimeErrors.ErrRuntimeVolumeNotExists)
+}
+
+// GetVolumesByLabel lists the names of all volumes that have the default k3d labels and the given labels attached
+func (c Nerdctl) GetVolumesByLabel(ctx context.Context, labels map[string]string) ([]string, error) {
+	args := []string{"volume", "ls", "--quiet"}
+	for k, v := range k3d.DefaultRuntimeLabels {
+		args = append(args, "--filter", fmt.Sprintf("label=%s=%s", k, v))
+	}
+	for k, v := range labels {
+		args = append(args, "--filter", fmt.Sprintf("label=%s=%s", k, v))
+	}
+
+	volumes, err := nerdctlLines(ctx, args...)
+	if err != nil {
+		return nil, fmt.Errorf("nerdctl failed to list volumes: %w", err)
+	}
+	return volumes, nil
+}
@@ -0,0 +1,259 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package podman
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/docker/go-connections/tlsconfig"
+	runtimeTypes "github.com/k3d-io/k3d/v5/pkg/runtimes/types"
+)
+
+// apiError is the error body returned by the libpod REST API
+type apiError struct {
+	StatusCode int    `json:"response"`
+	Message    string `json:"message"`
+	Cause      string `json:"cause"`
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("podman API returned %d: %s", e.StatusCode, e.Message)
+}
+
+// isNotFound checks if the given error is a 404 returned by the libpod API
+func isNotFound(err error) bool {
+	var apiErr *apiError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// isConflict checks if the given error is a 409 returned by the libpod API
+func isConflict(err error) bool {
+	var apiErr *apiError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusConflict
+}
+
+// podmanClient talks to the libpod REST API over a unix socket or tcp
+type podmanClient struct {
+	network   string
+	address   string
+	timeout   time.Duration
+	tlsConfig *tls.Config
+	http      *http.Client
+}
+
+// GetPodmanClient returns a client for the libpod REST API at the configured endpoint
+func GetPodmanClient() (*podmanClient, error) {
+	endpoint, err := GetEndpoint()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get podman endpoint: %w", err)
+	}
+
+	c := &podmanClient{network: endpoint.Scheme, address: endpoint.Host, timeout: connectionOpts.Timeout}
+	if endpoint.Scheme == "unix" {
+		c.address = endpoint.Path
+	}
+
+	if connectionOpts.TLS != (runtimeTypes.TLSOpts{}) {
+		c.tlsConfig, err = tlsconfig.Client(tlsconfig.Options{
+			CAFile:             connectionOpts.TLS.CACert,
+			CertFile:           connectionOpts.TLS.Cert,
+			KeyFile:            connectionOpts.TLS.Key,
+			InsecureSkipVerify: connectionOpts.TLS.CACert == "",
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS material: %w", err)
+		}
+		c.tlsConfig.ServerName = endpoint.Hostname()
+	}
+
+	c.http = &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return c.dial(ctx)
+			},
+			DisableCompression: true,
+		},
+	}
+	return c, nil
+}
+
+// Close releases idle connections of the client
+func (c *podmanClient) Close() {
+	c.http.CloseIdleConnections()
+}
+
+// dial connects to the API, using TLS if configured. The timeout only applies to establishing the connection.
+func (c *podmanClient) dial(ctx context.Context) (net.Conn, error) {
+	dialer := net.Dialer{Timeout: c.timeout}
+	conn, err := dialer.DialContext(ctx, c.network, c.address)
+	if err != nil || c.tlsConfig == nil {
+		return conn, err
+	}
+
+	handshakeCtx := ctx
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		handshakeCtx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	tlsConn := tls.Client(conn, c.tlsConfig)
+	if err := tlsConn.HandshakeContext(handshakeCtx); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("TLS handshake with %s failed: %w", c.address, err)
+	}
+	return tlsConn, nil
+}
+
+// newRequest builds a request against the libpod API. The host part is ignored by the dialer.
+func (c *podmanClient) newRequest(ctx context.Context, method string, path string, query url.Values, body io.Reader) (*http.Request, error) {
+	u := url.URL{Scheme: "http", Host: "d", Path: libpodAPIPrefix + path, RawQuery: query.Encode()}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// do sends a request with an optional JSON body and returns the response if it has a 2xx status code.
+// The caller is responsible for closing the response body.
+func (c *podmanClient) do(ctx context.Context, method string, path string, query url.Values, body interface{}) (*http.Response, error) {
+	var bodyReader io.Reader
+	contentType := ""
+	switch b := body.(type) {
+	case nil:
+	case io.Reader:
+		bodyReader = b
+		contentType = "application/x-tar"
+	default:
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal request body: %w", err)
+		}
+		bodyReader = bytes.NewReader(encoded)
+		contentType = "application/json"
+	}
+
+	req, err := c.newRequest(ctx, method, path, query, bodyReader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request %s %s: %w", method, path, err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request %s %s failed: %w", method, path, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		return nil, decodeAPIError(resp)
+	}
+	return resp, nil
+}
+
+// doJSON sends a request and decodes the JSON response into out (if not nil)
+func (c *podmanClient) doJSON(ctx context.Context, method string, path string, query url.Values, body interface{}, out interface{}) error {
+	resp, err := c.do(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response of %s %s: %w", method, path, err)
+	}
+	return nil
+}
+
+// hijack sends a request that upgrades the connection to a raw stream (used for exec).
+// It returns the connection and a reader for the remaining stream.
+func (c *podmanClient) hijack(ctx context.Context, method string, path string, body interface{}) (net.Conn, *bufio.Reader, error) {
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal request body: %w", err)
+	}
+
+	req, err := c.newRequest(ctx, method, path, nil, bytes.NewReader(encoded))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create request %s %s: %w", method, path, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "tcp")
+
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to podman: %w", err)
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("failed to send request %s %s: %w", method, path, err)
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("failed to read response of %s %s: %w", method, path, err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols && resp.StatusCode != http.StatusOK {
+		defer conn.Close()
+		return nil, nil, decodeAPIError(resp)
+	}
+	return conn, reader, nil
+}
+
+func decodeAPIError(resp *http.Response) error {
+	apiErr := &apiError{}
+	body, _ := io.ReadAll(resp.Body)
+	if err := json.Unmarshal(body, apiErr); err != nil || apiErr.Message == "" {
+		apiErr.Message = strings.TrimSpace(string(body))
+	}
+	apiErr.StatusCode = resp.StatusCode
+	return apiErr
+}
+
+// encodeFilters encodes a filter map into the JSON format expected by the libpod "filters" query parameter
+func encodeFilters(filters map[string][]string) (string, error) {
+	encoded, err := json.Marshal(filters)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode filters: %w", err)
+	}
+	return string(encoded), nil
+}
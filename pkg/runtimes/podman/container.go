@@ -0,0 +1,199 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package podman
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	l "github.com/k3d-io/k3d/v5/pkg/logger"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+	"github.com/sirupsen/logrus"
+)
+
+// createContainer creates a new podman container from translated specs
+func createContainer(ctx context.Context, podmanNode *NodeInPodman) (string, error) {
+	l.Log().Tracef("Creating podman container with translated config\n%+v\n", podmanNode)
+
+	podman, err := GetPodmanClient()
+	if err != nil {
+		return "", fmt.Errorf("failed to create podman client: %w", err)
+	}
+	defer podman.Close()
+
+	// create container, pulling the image if it doesn't exist yet
+	var resp ContainerCreateResponse
+	for {
+		err = podman.doJSON(ctx, http.MethodPost, "/containers/create", nil, podmanNode, &resp)
+		if err != nil {
+			if isNotFound(err) {
+				if err := pullImage(ctx, podman, podmanNode.Image); err != nil {
+					return "", fmt.Errorf("podman failed to pull image '%s': %w", podmanNode.Image, err)
+				}
+				continue
+			}
+			return "", fmt.Errorf("podman failed to create container '%s': %w", podmanNode.Name, err)
+		}
+		l.Log().Debugf("Created container %s (ID: %s)", podmanNode.Name, resp.ID)
+		break
+	}
+
+	return resp.ID, nil
+}
+
+// removeContainer deletes a running container (like podman rm -f)
+func removeContainer(ctx context.Context, ID string) error {
+	podman, err := GetPodmanClient()
+	if err != nil {
+		return fmt.Errorf("failed to get podman client: %w", err)
+	}
+	defer podman.Close()
+
+	query := url.Values{}
+	query.Set("force", "true")
+	query.Set("v", "true")
+	if err := podman.doJSON(ctx, http.MethodDelete, fmt.Sprintf("/containers/%s", ID), query, nil, nil); err != nil {
+		return fmt.Errorf("podman failed to remove the container '%s': %w", ID, err)
+	}
+
+	l.Log().Tracef("[Podman] Deleted Container %s", ID)
+
+	return nil
+}
+
+// pullImage pulls a container image and outputs progress if --verbose flag is set
+func pullImage(ctx context.Context, podman *podmanClient, image string) error {
+	query := url.Values{}
+	query.Set("reference", image)
+	resp, err := podman.do(ctx, http.MethodPost, "/images/pull", query, nil)
+	if err != nil {
+		return fmt.Errorf("podman failed to pull the image '%s': %w", image, err)
+	}
+	defer resp.Body.Close()
+
+	l.Log().Infof("Pulling image '%s'", image)
+
+	// the pull progress is streamed as a sequence of JSON objects, which may contain an error
+	var writer io.Writer = io.Discard
+	if l.Log().GetLevel() == logrus.DebugLevel {
+		writer = l.Log().Out
+	}
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var report struct {
+			Stream string `json:"stream"`
+			Error  string `json:"error"`
+		}
+		if err := decoder.Decode(&report); err != nil {
+			if err == io.EOF {
+				break
+			}
+			l.Log().Warnf("Couldn't get podman output: %v", err)
+			break
+		}
+		if report.Error != "" {
+			return fmt.Errorf("podman failed to pull the image '%s': %s", image, report.Error)
+		}
+		_, _ = io.WriteString(writer, report.Stream)
+	}
+
+	return nil
+}
+
+// getContainersByLabel lists all containers (running or not) which have all the default k3d labels and the given labels attached
+func getContainersByLabel(ctx context.Context, labels map[string]string) ([]ListContainer, error) {
+	filters := map[string][]string{}
+	for k, v := range k3d.DefaultRuntimeLabels {
+		filters["label"] = append(filters["label"], fmt.Sprintf("%s=%s", k, v))
+	}
+	for k, v := range labels {
+		filters["label"] = append(filters["label"], fmt.Sprintf("%s=%s", k, v))
+	}
+	return listContainers(ctx, filters)
+}
+
+func listContainers(ctx context.Context, filters map[string][]string) ([]ListContainer, error) {
+	podman, err := GetPodmanClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create podman client: %w", err)
+	}
+	defer podman.Close()
+
+	encodedFilters, err := encodeFilters(filters)
+	if err != nil {
+		return nil, err
+	}
+	query := url.Values{}
+	query.Set("all", "true")
+	query.Set("filters", encodedFilters)
+
+	containers := []ListContainer{}
+	if err := podman.doJSON(ctx, http.MethodGet, "/containers/json", query, nil, &containers); err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+	return containers, nil
+}
+
+// getContainerDetails returns the inspect data of a container
+func getContainerDetails(ctx context.Context, containerID string) (*InspectContainerData, error) {
+	podman, err := GetPodmanClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create podman client: %w", err)
+	}
+	defer podman.Close()
+
+	details := &InspectContainerData{}
+	if err := podman.doJSON(ctx, http.MethodGet, fmt.Sprintf("/containers/%s/json", containerID), nil, nil, details); err != nil {
+		return nil, fmt.Errorf("failed to get details for container '%s': %w", containerID, err)
+	}
+	return details, nil
+}
+
+func getNodeContainer(ctx context.Context, node *k3d.Node) (*ListContainer, error) {
+	filters := map[string][]string{}
+	for k, v := range node.RuntimeLabels {
+		filters["label"] = append(filters["label"], fmt.Sprintf("%s=%s", k, v))
+	}
+
+	// regex filtering for exact name match (user input may or may not have the "k3d-" prefix)
+	filters["name"] = []string{fmt.Sprintf("^/?(%s-)?%s$", k3d.DefaultObjectNamePrefix, node.Name)}
+
+	containers, err := listContainers(ctx, filters)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(containers) > 1 {
+		return nil, fmt.Errorf("Failed to get a single container for name '%s'. Found: %d", node.Name, len(containers))
+	}
+
+	if len(containers) == 0 {
+		return nil, fmt.Errorf("Didn't find container for node '%s'", node.Name)
+	}
+
+	return &containers[0], nil
+}
@@ -0,0 +1,50 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package podman
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// GetImages returns a list of images present in the runtime
+func (p Podman) GetImages(ctx context.Context) ([]string, error) {
+	podman, err := GetPodmanClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create podman client: %w", err)
+	}
+	defer podman.Close()
+
+	imageSummary := []ImageSummary{}
+	if err := podman.doJSON(ctx, http.MethodGet, "/images/json", nil, nil, &imageSummary); err != nil {
+		return nil, fmt.Errorf("podman failed to list images: %w", err)
+	}
+
+	var images []string
+	for _, image := range imageSummary {
+		images = append(images, image.RepoTags...)
+	}
+
+	return images, nil
+}
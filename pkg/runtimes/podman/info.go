@@ -0,0 +1,68 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package podman
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	runtimeTypes "github.com/k3d-io/k3d/v5/pkg/runtimes/types"
+)
+
+func (p Podman) Info() (*runtimeTypes.RuntimeInfo, error) {
+	podman, err := GetPodmanClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create podman client: %w", err)
+	}
+	defer podman.Close()
+
+	info := Info{}
+	if err := podman.doJSON(context.Background(), http.MethodGet, "/info", nil, nil, &info); err != nil {
+		return nil, fmt.Errorf("podman failed to provide info output: %w", err)
+	}
+
+	runtimeInfo := runtimeTypes.RuntimeInfo{
+		Name:          p.ID(),
+		Endpoint:      p.GetRuntimePath(),
+		Version:       info.Version.Version,
+		OS:            fmt.Sprintf("%s %s", info.Host.Distribution.Distribution, info.Host.Distribution.Version),
+		OSType:        info.Host.OS,
+		Arch:          info.Host.Arch,
+		CgroupVersion: info.Host.CgroupVersion,
+		CgroupDriver:  info.Host.CgroupManager,
+		Filesystem:    "UNKNOWN",
+		InfoName:      info.Host.Hostname,
+	}
+
+	// cgroup version is reported as "v2" by podman, but docker (and thus k3d) uses "2"
+	if len(runtimeInfo.CgroupVersion) > 1 && runtimeInfo.CgroupVersion[0] == 'v' {
+		runtimeInfo.CgroupVersion = runtimeInfo.CgroupVersion[1:]
+	}
+
+	if fs, ok := info.Store.GraphStatus["Backing Filesystem"]; ok {
+		runtimeInfo.Filesystem = fs
+	}
+
+	return &runtimeInfo, nil
+}
@@ -0,0 +1,40 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package podman
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+// GetKubeconfig grabs the kubeconfig from inside a k3d node
+func (p Podman) GetKubeconfig(ctx context.Context, node *k3d.Node) (io.ReadCloser, error) {
+	reader, err := p.ReadFromNode(ctx, "/output/kubeconfig.yaml", node)
+	if err != nil {
+		return nil, fmt.Errorf("podman failed to copy path '/output/kubeconfig.yaml' from node '%s': %w", node.Name, err)
+	}
+	return reader, nil
+}
@@ -0,0 +1,279 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package podman
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	l "github.com/k3d-io/k3d/v5/pkg/logger"
+	runtimeErr "github.com/k3d-io/k3d/v5/pkg/runtimes/errors"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+// GetNetwork returns a given network
+func (p Podman) GetNetwork(ctx context.Context, searchNet *k3d.ClusterNetwork) (*k3d.ClusterNetwork, error) {
+	if searchNet.ID == "" && searchNet.Name == "" {
+		return nil, fmt.Errorf("failed to get network, because neither name nor ID was provided")
+	}
+
+	nameOrID := searchNet.Name
+	if nameOrID == "" {
+		nameOrID = searchNet.ID
+	}
+
+	targetNetwork, err := inspectNetwork(ctx, nameOrID)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, runtimeErr.ErrRuntimeNetworkNotExists
+		}
+		return nil, fmt.Errorf("podman failed to inspect network %s: %w", nameOrID, err)
+	}
+	l.Log().Debugf("Found network %+v", targetNetwork)
+
+	k3dNetwork := &k3d.ClusterNetwork{
+		Name: targetNetwork.Name,
+		ID:   targetNetwork.ID,
+	}
+
+	// find the containers connected to the network, as the inspect output doesn't contain them
+	containers, err := listContainers(ctx, map[string][]string{"network": {targetNetwork.Name}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers in network '%s': %w", targetNetwork.Name, err)
+	}
+	members := []*k3d.NetworkMember{}
+	for _, container := range containers {
+		containerDetails, err := getContainerDetails(ctx, container.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to inspect network member %s: %w", container.ID, err)
+		}
+		ipAddr, err := netip.ParseAddr(containerDetails.NetworkSettings.Networks[targetNetwork.Name].IPAddress)
+		if err != nil {
+			l.Log().Tracef("network member %s has no IP in network %s (likely not running): %v", containerDetails.Name, targetNetwork.Name, err)
+			continue
+		}
+		members = append(members, &k3d.NetworkMember{Name: containerDetails.Name, IP: ipAddr})
+	}
+
+	// for networks that have a subnet, we inspect that as well (e.g. "host" network doesn't have it)
+	if len(targetNetwork.Subnets) > 0 {
+		k3dNetwork.IPAM, err = parseIPAM(targetNetwork.Subnets[0])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse IPAM config: %w", err)
+		}
+
+		for _, member := range members {
+			k3dNetwork.IPAM.IPsUsed = append(k3dNetwork.IPAM.IPsUsed, member.IP)
+		}
+
+		// append the used IPs that we already know from the search network,
+		// as we already need those before the containers are started
+		k3dNetwork.IPAM.IPsUsed = append(k3dNetwork.IPAM.IPsUsed, searchNet.IPAM.IPsUsed...)
+	} else {
+		l.Log().Debugf("Network %s does not have an IPAM config", k3dNetwork.Name)
+	}
+
+	k3dNetwork.Members = members
+
+	return k3dNetwork, nil
+}
+
+// CreateNetworkIfNotPresent creates a new podman network
+// @return: network, exists, error
+func (p Podman) CreateNetworkIfNotPresent(ctx context.Context, inNet *k3d.ClusterNetwork) (*k3d.ClusterNetwork, bool, error) {
+	existingNet, err := p.GetNetwork(ctx, inNet)
+	if err != nil && err != runtimeErr.ErrRuntimeNetworkNotExists {
+		return nil, false, fmt.Errorf("failed to check for existing podman networks: %w", err)
+	}
+	if existingNet != nil {
+		return existingNet, true, nil
+	}
+
+	podman, err := GetPodmanClient()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to create podman client: %w", err)
+	}
+	defer podman.Close()
+
+	labels := make(map[string]string, 0)
+	for k, v := range k3d.DefaultRuntimeLabels {
+		labels[k] = v
+	}
+
+	netCreateOpts := Network{
+		Name:       inNet.Name,
+		Driver:     "bridge",
+		Labels:     labels,
+		DNSEnabled: true,
+	}
+
+	// use user-defined subnet, if given - podman picks a free subnet by itself otherwise
+	if inNet.IPAM.IPPrefix != (netip.Prefix{}) {
+		l.Log().Debugf("Using user-defined subnet prefix %s", inNet.IPAM.IPPrefix.String())
+		if !inNet.IPAM.IPPrefix.IsValid() {
+			return nil, false, fmt.Errorf("invalid subnet prefix: %s", inNet.IPAM.IPPrefix.String())
+		}
+		netCreateOpts.Subnets = []Subnet{
+			{
+				Subnet:  inNet.IPAM.IPPrefix.String(),
+				Gateway: inNet.IPAM.IPPrefix.Addr().Next().String(), // second IP in subnet will be the Gateway (Next, so we don't hit x.x.x.0)
+			},
+		}
+	}
+
+	newNet := Network{}
+	if err := podman.doJSON(ctx, http.MethodPost, "/networks/create", nil, netCreateOpts, &newNet); err != nil {
+		return nil, false, fmt.Errorf("podman failed to create new network '%s': %w", inNet.Name, err)
+	}
+
+	l.Log().Infof("Created network '%s'", inNet.Name)
+	if len(newNet.Subnets) == 0 {
+		return nil, false, fmt.Errorf("newly created network '%s' has no subnet", inNet.Name)
+	}
+	prefix, err := netip.ParsePrefix(newNet.Subnets[0].Subnet)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to parse IP Prefix of newly created network '%s': %w", newNet.ID, err)
+	}
+
+	newClusterNet := &k3d.ClusterNetwork{Name: inNet.Name, ID: newNet.ID, IPAM: k3d.IPAM{IPPrefix: prefix}}
+
+	if inNet.IPAM.Managed || inNet.IPAM.IPPrefix != (netip.Prefix{}) {
+		newClusterNet.IPAM.Managed = true
+	}
+
+	return newClusterNet, false, nil
+}
+
+// DeleteNetwork deletes a network
+func (p Podman) DeleteNetwork(ctx context.Context, ID string) error {
+	podman, err := GetPodmanClient()
+	if err != nil {
+		return fmt.Errorf("failed to get podman client: %w", err)
+	}
+	defer podman.Close()
+
+	if err := podman.doJSON(ctx, http.MethodDelete, fmt.Sprintf("/networks/%s", ID), nil, nil, nil); err != nil {
+		if isConflict(err) || strings.Contains(err.Error(), "being used") {
+			return runtimeErr.ErrRuntimeNetworkNotEmpty
+		}
+		return fmt.Errorf("podman failed to remove network '%s': %w", ID, err)
+	}
+	return nil
+}
+
+// inspectNetwork gets information about a network by its name or ID
+func inspectNetwork(ctx context.Context, nameOrID string) (*Network, error) {
+	podman, err := GetPodmanClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get podman client: %w", err)
+	}
+	defer podman.Close()
+
+	network := &Network{}
+	if err := podman.doJSON(ctx, http.MethodGet, fmt.Sprintf("/networks/%s/json", nameOrID), nil, nil, network); err != nil {
+		return nil, err
+	}
+	return network, nil
+}
+
+// GetGatewayIP returns the IP of the network gateway
+func GetGatewayIP(ctx context.Context, network string) (netip.Addr, error) {
+	bridgeNetwork, err := inspectNetwork(ctx, network)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("failed to get bridge network with name '%s': %w", network, err)
+	}
+
+	if len(bridgeNetwork.Subnets) == 0 {
+		return netip.Addr{}, fmt.Errorf("Failed to get subnets for network %s", bridgeNetwork.Name)
+	}
+	ipam, err := parseIPAM(bridgeNetwork.Subnets[0])
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("failed to get gateway of network %s: %w", bridgeNetwork.Name, err)
+	}
+	return ipam.IPsUsed[0], nil
+}
+
+// ConnectNodeToNetwork connects a node to a network
+func (p Podman) ConnectNodeToNetwork(ctx context.Context, node *k3d.Node, networkName string) error {
+	// check that node was not attached to network before
+	for _, nw := range node.Networks {
+		if nw == networkName {
+			l.Log().Infof("Container '%s' is already connected to '%s'", node.Name, networkName)
+			return nil
+		}
+	}
+
+	container, err := getNodeContainer(ctx, node)
+	if err != nil {
+		return fmt.Errorf("failed to get container for node '%s': %w", node.Name, err)
+	}
+
+	podman, err := GetPodmanClient()
+	if err != nil {
+		return fmt.Errorf("failed to get podman client: %w", err)
+	}
+	defer podman.Close()
+
+	return podman.doJSON(ctx, http.MethodPost, fmt.Sprintf("/networks/%s/connect", networkName), nil, NetworkConnectOptions{Container: container.ID}, nil)
+}
+
+// DisconnectNodeFromNetwork disconnects a node from a network
+func (p Podman) DisconnectNodeFromNetwork(ctx context.Context, node *k3d.Node, networkName string) error {
+	l.Log().Debugf("Disconnecting node %s from network %s...", node.Name, networkName)
+	container, err := getNodeContainer(ctx, node)
+	if err != nil {
+		return fmt.Errorf("failed to get container for node '%s': %w", node.Name, err)
+	}
+
+	podman, err := GetPodmanClient()
+	if err != nil {
+		return fmt.Errorf("failed to get podman client: %w", err)
+	}
+	defer podman.Close()
+
+	return podman.doJSON(ctx, http.MethodPost, fmt.Sprintf("/networks/%s/disconnect", networkName), nil, NetworkDisconnectOptions{Container: container.ID, Force: true}, nil)
+}
+
+// parseIPAM Returns an IPAM structure with the subnet and gateway filled in. If some of the values
+// cannot be parsed, an error is returned. If gateway is empty, the function calculates the default gateway.
+func parseIPAM(subnet Subnet) (ipam k3d.IPAM, err error) {
+	var gateway netip.Addr
+	ipam = k3d.IPAM{IPsUsed: []netip.Addr{}}
+
+	ipam.IPPrefix, err = netip.ParsePrefix(subnet.Subnet)
+	if err != nil {
+		return
+	}
+
+	if subnet.Gateway == "" {
+		gateway = ipam.IPPrefix.Addr().Next()
+	} else {
+		gateway, err = netip.ParseAddr(subnet.Gateway)
+	}
+	ipam.IPsUsed = append(ipam.IPsUsed, gateway)
+
+	return
+}
@@ -0,0 +1,415 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package podman
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	l "github.com/k3d-io/k3d/v5/pkg/logger"
+	runtimeErr "github.com/k3d-io/k3d/v5/pkg/runtimes/errors"
+	runtimeTypes "github.com/k3d-io/k3d/v5/pkg/runtimes/types"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+// CreateNode creates a new container
+func (p Podman) CreateNode(ctx context.Context, node *k3d.Node) error {
+	// translate node spec to podman container specs
+	podmanNode, err := TranslateNodeToContainer(node)
+	if err != nil {
+		return fmt.Errorf("failed to translate k3d node spec to podman container spec: %w", err)
+	}
+
+	// create node
+	_, err = createContainer(ctx, podmanNode)
+	if err != nil {
+		return fmt.Errorf("failed to create container for node '%s': %w", node.Name, err)
+	}
+
+	return nil
+}
+
+// DeleteNode deletes a node
+func (p Podman) DeleteNode(ctx context.Context, nodeSpec *k3d.Node) error {
+	l.Log().Debugf("Deleting node %s ...", nodeSpec.Name)
+	return removeContainer(ctx, nodeSpec.Name)
+}
+
+// GetNodesByLabel returns a list of existing nodes
+func (p Podman) GetNodesByLabel(ctx context.Context, labels map[string]string) ([]*k3d.Node, error) {
+	// (0) get containers
+	containers, err := getContainersByLabel(ctx, labels)
+	if err != nil {
+		return nil, fmt.Errorf("podman failed to get containers with labels '%v': %w", labels, err)
+	}
+
+	// (1) convert them to node structs
+	nodes := []*k3d.Node{}
+	for _, container := range containers {
+		var node *k3d.Node
+
+		containerDetails, err := getContainerDetails(ctx, container.ID)
+		if err != nil {
+			l.Log().Warnf("Failed to get details for container %s", container.Names[0])
+			node, err = TranslateContainerToNode(&container)
+			if err != nil {
+				return nil, fmt.Errorf("failed to translate container '%s' to k3d node spec: %w", container.Names[0], err)
+			}
+		} else {
+			node, err = TranslateContainerDetailsToNode(containerDetails)
+			if err != nil {
+				return nil, fmt.Errorf("failed to translate container'%s' details to k3d node spec: %w", containerDetails.Name, err)
+			}
+		}
+		nodes = append(nodes, node)
+	}
+
+	return nodes, nil
+}
+
+// StartNode starts an existing node
+func (p Podman) StartNode(ctx context.Context, node *k3d.Node) error {
+	podman, err := GetPodmanClient()
+	if err != nil {
+		return fmt.Errorf("failed to create podman client. %w", err)
+	}
+	defer podman.Close()
+
+	// get container which represents the node
+	nodeContainer, err := getNodeContainer(ctx, node)
+	if err != nil {
+		return fmt.Errorf("failed to get container for node '%s': %w", node.Name, err)
+	}
+
+	// check if the container is actually managed by
+	if v, ok := nodeContainer.Labels["app"]; !ok || v != "k3d" {
+		return fmt.Errorf("Failed to determine if container '%s' is managed by k3d (needs label 'app=k3d')", nodeContainer.ID)
+	}
+
+	// actually start the container
+	l.Log().Infof("Starting node '%s'", node.Name)
+	if err := podman.doJSON(ctx, http.MethodPost, fmt.Sprintf("/containers/%s/start", nodeContainer.ID), nil, nil, nil); err != nil {
+		return fmt.Errorf("podman failed to start container for node '%s': %w", node.Name, err)
+	}
+
+	// get container which represents the node
+	containerDetails, err := getContainerDetails(ctx, nodeContainer.ID)
+	if err != nil {
+		return fmt.Errorf("Failed to inspect container %s for node %s: %+v", node.Name, nodeContainer.ID, err)
+	}
+
+	node.Created = containerDetails.Created.Format(time.RFC3339Nano)
+	node.State.Running = containerDetails.State.Running
+	node.State.Started = containerDetails.State.StartedAt.Format(time.RFC3339Nano)
+
+	return nil
+}
+
+// StopNode stops an existing node
+func (p Podman) StopNode(ctx context.Context, node *k3d.Node) error {
+	podman, err := GetPodmanClient()
+	if err != nil {
+		return fmt.Errorf("Failed to create podman client. %+v", err)
+	}
+	defer podman.Close()
+
+	// get container which represents the node
+	nodeContainer, err := getNodeContainer(ctx, node)
+	if err != nil {
+		return fmt.Errorf("failed to get container for node '%s': %w", node.Name, err)
+	}
+
+	// check if the container is actually managed by
+	if v, ok := nodeContainer.Labels["app"]; !ok || v != "k3d" {
+		return fmt.Errorf("Failed to determine if container '%s' is managed by k3d (needs label 'app=k3d')", nodeContainer.ID)
+	}
+
+	// actually stop the container
+	if err := podman.doJSON(ctx, http.MethodPost, fmt.Sprintf("/containers/%s/stop", nodeContainer.ID), nil, nil, nil); err != nil {
+		return fmt.Errorf("podman failed to stop the container '%s': %w", nodeContainer.ID, err)
+	}
+
+	return nil
+}
+
+// GetNode tries to get a node container by its name
+func (p Podman) GetNode(ctx context.Context, node *k3d.Node) (*k3d.Node, error) {
+	container, err := getNodeContainer(ctx, node)
+	if err != nil {
+		return node, fmt.Errorf("failed to get container for node '%s': %w", node.Name, err)
+	}
+
+	containerDetails, err := getContainerDetails(ctx, container.ID)
+	if err != nil {
+		return node, fmt.Errorf("failed to get details for container '%s': %w", container.ID, err)
+	}
+
+	node, err = TranslateContainerDetailsToNode(containerDetails)
+	if err != nil {
+		return node, fmt.Errorf("failed to translate container '%s' details to node spec: %w", containerDetails.Name, err)
+	}
+
+	return node, nil
+}
+
+// GetNodeStatus returns the status of a node (Running, Started, etc.)
+func (p Podman) GetNodeStatus(ctx context.Context, node *k3d.Node) (bool, string, error) {
+	container, err := getNodeContainer(ctx, node)
+	if err != nil {
+		return false, "", fmt.Errorf("failed to get container for node '%s': %w", node.Name, err)
+	}
+
+	containerDetails, err := getContainerDetails(ctx, container.ID)
+	if err != nil {
+		return false, "", fmt.Errorf("podman failed to inspect container '%s': %w", container.ID, err)
+	}
+
+	return containerDetails.State.Running, containerDetails.State.Status, nil
+}
+
+// GetNodeLogs returns the logs from a given node
+func (p Podman) GetNodeLogs(ctx context.Context, node *k3d.Node, since time.Time, opts *runtimeTypes.NodeLogsOpts) (io.ReadCloser, error) {
+	nodeContainer, err := getNodeContainer(ctx, node)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get container for node '%s': %w", node.Name, err)
+	}
+
+	containerDetails, err := getContainerDetails(ctx, nodeContainer.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect container '%s': %w", nodeContainer.ID, err)
+	}
+
+	if !containerDetails.State.Running {
+		return nil, fmt.Errorf("node '%s' (container '%s') not running", node.Name, containerDetails.ID)
+	}
+
+	podman, err := GetPodmanClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get podman client; %w", err)
+	}
+
+	query := url.Values{}
+	query.Set("stdout", "true")
+	query.Set("stderr", "true")
+	if !since.IsZero() {
+		query.Set("since", since.Format("2006-01-02T15:04:05.999999999Z"))
+	}
+	if opts != nil && opts.Follow {
+		query.Set("follow", "true")
+	}
+
+	resp, err := podman.do(ctx, http.MethodGet, fmt.Sprintf("/containers/%s/logs", nodeContainer.ID), query, nil)
+	if err != nil {
+		return nil, fmt.Errorf("podman failed to get logs from node '%s' (container '%s'): %w", node.Name, nodeContainer.ID, err)
+	}
+
+	return resp.Body, nil
+}
+
+// ExecInNodeGetLogs executes a command inside a node and returns the logs to the caller, e.g. to parse them
+func (p Podman) ExecInNodeGetLogs(ctx context.Context, node *k3d.Node, cmd []string) (*bufio.Reader, error) {
+	logs, err := executeInNode(ctx, node, cmd, nil)
+	if logs == nil {
+		return nil, err
+	}
+	return bufio.NewReader(bytes.NewReader(logs)), err
+}
+
+// ExecInNode execs a command inside a node
+func (p Podman) ExecInNode(ctx context.Context, node *k3d.Node, cmd []string) error {
+	return execInNode(ctx, node, cmd, nil)
+}
+
+// ExecInNodeWithStdin execs a command inside a node, streaming the given reader to its stdin
+func (p Podman) ExecInNodeWithStdin(ctx context.Context, node *k3d.Node, cmd []string, stdin io.ReadCloser) error {
+	return execInNode(ctx, node, cmd, stdin)
+}
+
+func execInNode(ctx context.Context, node *k3d.Node, cmd []string, stdin io.ReadCloser) error {
+	logs, err := executeInNode(ctx, node, cmd, stdin)
+	if err != nil && logs != nil {
+		err = fmt.Errorf("%w: Logs from failed access process:\n%s", err, string(logs))
+	}
+	return err
+}
+
+// executeInNode runs a command inside a node and returns its (combined) output once it exited
+func executeInNode(ctx context.Context, node *k3d.Node, cmd []string, stdin io.ReadCloser) ([]byte, error) {
+	l.Log().Debugf("Executing command '%+v' in node '%s'", cmd, node.Name)
+
+	// get the container for the given node
+	nodeContainer, err := getNodeContainer(ctx, node)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get container for node '%s': %w", node.Name, err)
+	}
+
+	podman, err := GetPodmanClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get podman client: %w", err)
+	}
+	defer podman.Close()
+
+	attachStdin := stdin != nil
+
+	// exec
+	var exec ExecCreateResponse
+	if err := podman.doJSON(ctx, http.MethodPost, fmt.Sprintf("/containers/%s/exec", nodeContainer.ID), nil, ExecCreateConfig{
+		Privileged: true,
+		// Don't use tty true when piping stdin.
+		Tty:          !attachStdin,
+		AttachStderr: true,
+		AttachStdout: true,
+		AttachStdin:  attachStdin,
+		Cmd:          cmd,
+	}, &exec); err != nil {
+		return nil, fmt.Errorf("podman failed to create exec config for node '%s': %w", node.Name, err)
+	}
+
+	conn, reader, err := podman.hijack(ctx, http.MethodPost, fmt.Sprintf("/exec/%s/start", exec.ID), ExecStartConfig{Tty: !attachStdin})
+	if err != nil {
+		return nil, fmt.Errorf("podman failed to attach to exec process in node '%s': %w", node.Name, err)
+	}
+	defer conn.Close()
+
+	// If we need to write to stdin pipe, start a new goroutine that writes the stream to stdin
+	if stdin != nil {
+		go func() {
+			_, err := io.Copy(conn, stdin)
+			if err != nil {
+				l.Log().Errorf("Failed to copy read stream. %v", err)
+			}
+			err = stdin.Close()
+			if err != nil {
+				l.Log().Errorf("Failed to close stdin stream. %v", err)
+			}
+			if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+				_ = cw.CloseWrite()
+			}
+		}()
+	}
+
+	// the stream is closed by podman once the exec process exited
+	logs, err := io.ReadAll(reader)
+	if err != nil && !errors.Is(err, net.ErrClosed) {
+		return nil, fmt.Errorf("error reading logs from exec process in node %s: %w", node.Name, err)
+	}
+
+	for {
+		// get info about exec process inside container
+		var execInfo InspectExecSession
+		if err := podman.doJSON(ctx, http.MethodGet, fmt.Sprintf("/exec/%s/json", exec.ID), nil, nil, &execInfo); err != nil {
+			return logs, fmt.Errorf("podman failed to inspect exec process in node '%s': %w", node.Name, err)
+		}
+
+		// if still running, continue loop
+		if execInfo.Running {
+			l.Log().Tracef("Exec process '%+v' still running in node '%s'.. sleeping for 1 second...", cmd, node.Name)
+			time.Sleep(1 * time.Second)
+			continue
+		}
+
+		// check exitcode
+		if execInfo.ExitCode == 0 { // success
+			l.Log().Debugf("Exec process in node '%s' exited with '0'", node.Name)
+			return logs, nil
+		}
+		return logs, fmt.Errorf("Exec process in node '%s' failed with exit code '%d'", node.Name, execInfo.ExitCode)
+	}
+}
+
+// GetImageStream creates a tar stream for the given images, to be read (and closed) by the caller
+func (p Podman) GetImageStream(ctx context.Context, images []string) (io.ReadCloser, error) {
+	podman, err := GetPodmanClient()
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{}
+	query.Set("format", "docker-archive")
+	query.Set("compress", strconv.FormatBool(false))
+	for _, image := range images {
+		query.Add("references", image)
+	}
+
+	resp, err := podman.do(ctx, http.MethodGet, "/images/export", query, nil)
+	if err != nil {
+		return nil, fmt.Errorf("podman failed to export images %v: %w", images, err)
+	}
+	return resp.Body, nil
+}
+
+// GetNodesInNetwork returns all the nodes connected to a given network
+func (p Podman) GetNodesInNetwork(ctx context.Context, network string) ([]*k3d.Node, error) {
+	containers, err := listContainers(ctx, map[string][]string{"network": {network}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers in network '%s': %w", network, err)
+	}
+
+	connectedNodes := []*k3d.Node{}
+
+	// loop over list of containers connected to this cluster and transform them into nodes internally
+	for _, container := range containers {
+		containerDetails, err := getContainerDetails(ctx, container.ID)
+		if err != nil {
+			return nil, fmt.Errorf("podman failed to get details of container '%s': %w", container.ID, err)
+		}
+		node, err := TranslateContainerDetailsToNode(containerDetails)
+		if err != nil {
+			if errors.Is(err, runtimeErr.ErrRuntimeContainerUnknown) {
+				l.Log().Tracef("GetNodesInNetwork: inspected non-k3d-managed container %s", containerDetails.Name)
+				continue
+			}
+			return nil, fmt.Errorf("failed to translate container '%s' details to node spec: %w", containerDetails.Name, err)
+		}
+		connectedNodes = append(connectedNodes, node)
+	}
+
+	return connectedNodes, nil
+}
+
+// RenameNode renames the container of a node
+func (p Podman) RenameNode(ctx context.Context, node *k3d.Node, newName string) error {
+	container, err := getNodeContainer(ctx, node)
+	if err != nil {
+		return fmt.Errorf("failed to get container for node '%s': %w", node.Name, err)
+	}
+
+	podman, err := GetPodmanClient()
+	if err != nil {
+		return fmt.Errorf("failed to get podman client: %w", err)
+	}
+	defer podman.Close()
+
+	query := url.Values{}
+	query.Set("name", newName)
+	return podman.doJSON(ctx, http.MethodPost, fmt.Sprintf("/containers/%s/rename", container.ID), query, nil, nil)
+}
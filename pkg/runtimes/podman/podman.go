@@ -0,0 +1,125 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package podman
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	l "github.com/k3d-io/k3d/v5/pkg/logger"
+	runtimeTypes "github.com/k3d-io/k3d/v5/pkg/runtimes/types"
+)
+
+type Podman struct{}
+
+// connectionOpts override the default connection settings (i.e. CONTAINER_HOST and the default sockets)
+var connectionOpts runtimeTypes.ConnectionOpts
+
+const (
+	// DefaultPodmanSock is the socket of a rootful podman service
+	DefaultPodmanSock = "/run/podman/podman.sock"
+
+	// libpodAPIPrefix is the versioned prefix of all libpod REST API paths
+	libpodAPIPrefix = "/v4.0.0/libpod"
+)
+
+// ID returns the identity of the runtime
+func (p Podman) ID() string {
+	return "podman"
+}
+
+// GetHost returns the podman service host for remote (tcp) connections
+func (p Podman) GetHost() string {
+	endpoint, err := GetEndpoint()
+	if err != nil {
+		l.Log().Debugf("[Podman] GetHost: %v", err)
+		return ""
+	}
+	if endpoint.Scheme != "tcp" {
+		return ""
+	}
+	l.Log().Debugf("[Podman] PodmanHost: '%s'", endpoint.Host)
+	return endpoint.Host
+}
+
+// GetRuntimePath returns the path of the podman socket
+func (p Podman) GetRuntimePath() string {
+	endpoint, err := GetEndpoint()
+	if err != nil || endpoint.Scheme != "unix" {
+		return DefaultPodmanSock
+	}
+	return endpoint.Path
+}
+
+// SetConnectionOpts sets the endpoint, TLS material and timeout used to connect to the libpod REST API
+func (p Podman) SetConnectionOpts(opts runtimeTypes.ConnectionOpts) error {
+	if opts.Endpoint != "" {
+		endpoint, err := parseEndpoint(opts.Endpoint)
+		if err != nil {
+			return err
+		}
+		if endpoint.Scheme != "tcp" && opts.TLS != (runtimeTypes.TLSOpts{}) {
+			return fmt.Errorf("TLS is only supported for tcp:// endpoints")
+		}
+	}
+	connectionOpts = opts
+	return nil
+}
+
+// GetEndpoint returns the URL of the libpod REST API service.
+// Order of precedence:
+// 1. the configured endpoint (see SetConnectionOpts)
+// 2. CONTAINER_HOST env var (unix:// or tcp://)
+// 3. rootless socket in $XDG_RUNTIME_DIR, if it exists
+// 4. the default rootful socket
+func GetEndpoint() (*url.URL, error) {
+	if connectionOpts.Endpoint != "" {
+		return parseEndpoint(connectionOpts.Endpoint)
+	}
+
+	if containerHost := os.Getenv("CONTAINER_HOST"); containerHost != "" {
+		return parseEndpoint(containerHost)
+	}
+
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		rootlessSock := filepath.Join(runtimeDir, "podman", "podman.sock")
+		if _, err := os.Stat(rootlessSock); err == nil {
+			return &url.URL{Scheme: "unix", Path: rootlessSock}, nil
+		}
+	}
+
+	return &url.URL{Scheme: "unix", Path: DefaultPodmanSock}, nil
+}
+
+func parseEndpoint(rawEndpoint string) (*url.URL, error) {
+	endpoint, err := url.Parse(rawEndpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse podman endpoint '%s': %w", rawEndpoint, err)
+	}
+	if endpoint.Scheme != "unix" && endpoint.Scheme != "tcp" {
+		return nil, fmt.Errorf("unsupported scheme '%s' in podman endpoint '%s' (only unix:// and tcp:// are supported)", endpoint.Scheme, rawEndpoint)
+	}
+	return endpoint, nil
+}
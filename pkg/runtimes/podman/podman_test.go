@@ -0,0 +1,424 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package podman
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	runtimeErrors "github.com/k3d-io/k3d/v5/pkg/runtimes/errors"
+	runtimeTypes "github.com/k3d-io/k3d/v5/pkg/runtimes/types"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+// fakeLibpod is a minimal stand-in for the libpod REST API serving a single container
+type fakeLibpod struct {
+	mu         sync.Mutex
+	imagePulls int
+	container  *InspectContainerData
+	files      map[string][]byte
+	volumes    []Volume
+	networks   map[string]Network
+}
+
+func newFakeLibpod(t *testing.T) *fakeLibpod {
+	t.Helper()
+	f := &fakeLibpod{files: map[string][]byte{}, networks: map[string]Network{}}
+
+	mux := http.NewServeMux()
+	prefix := libpodAPIPrefix
+
+	mux.HandleFunc("GET "+prefix+"/info", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, Info{
+			Host:    InfoHost{Arch: "amd64", OS: "linux", Hostname: "fakehost", CgroupVersion: "v2", CgroupManager: "systemd", Distribution: InfoDistribution{Distribution: "fedora", Version: "40"}},
+			Store:   InfoStore{GraphDriverName: "overlay", GraphStatus: map[string]string{"Backing Filesystem": "xfs"}},
+			Version: InfoVersion{Version: "5.0.0"},
+		})
+	})
+
+	mux.HandleFunc("POST "+prefix+"/images/pull", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		f.imagePulls++
+		f.mu.Unlock()
+		writeJSON(w, map[string]string{"stream": "pulled " + r.URL.Query().Get("reference")})
+	})
+
+	mux.HandleFunc("POST "+prefix+"/containers/create", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if f.imagePulls == 0 {
+			writeError(w, http.StatusNotFound, "no such image")
+			return
+		}
+		spec := NodeInPodman{}
+		if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		env := []string{}
+		for k, v := range spec.Env {
+			env = append(env, k+"="+v)
+		}
+		networks := map[string]InspectAdditionalNetwork{}
+		for name := range spec.Networks {
+			networks[name] = InspectAdditionalNetwork{IPAddress: "10.89.0.2", Gateway: "10.89.0.1"}
+		}
+		f.container = &InspectContainerData{
+			ID:              "abc123",
+			Created:         time.Now(),
+			Name:            spec.Name,
+			ImageName:       spec.Image,
+			Config:          InspectContainerConfig{Hostname: spec.Hostname, Env: env, Cmd: spec.Command, Labels: spec.Labels},
+			NetworkSettings: InspectNetworkSettings{Networks: networks},
+		}
+		writeJSON(w, ContainerCreateResponse{ID: f.container.ID})
+	})
+
+	mux.HandleFunc("GET "+prefix+"/containers/json", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		containers := []ListContainer{}
+		if f.container != nil && f.matches(r.URL.Query().Get("filters")) {
+			containers = append(containers, ListContainer{ID: f.container.ID, Names: []string{f.container.Name}, Labels: f.container.Config.Labels})
+		}
+		writeJSON(w, containers)
+	})
+
+	mux.HandleFunc("GET "+prefix+"/containers/{id}/json", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if f.container == nil || r.PathValue("id") != f.container.ID {
+			writeError(w, http.StatusNotFound, "no such container")
+			return
+		}
+		writeJSON(w, f.container)
+	})
+
+	mux.HandleFunc("POST "+prefix+"/containers/{id}/start", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.container.State = InspectContainerState{Running: true, Status: "running", StartedAt: time.Now()}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.HandleFunc("POST "+prefix+"/containers/{id}/exec", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, ExecCreateResponse{ID: "exec1"})
+	})
+
+	mux.HandleFunc("POST "+prefix+"/exec/{id}/start", func(w http.ResponseWriter, r *http.Request) {
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("failed to hijack connection: %v", err)
+			return
+		}
+		defer conn.Close()
+		_, _ = buf.WriteString("HTTP/1.1 101 UPGRADED\r\nContent-Type: application/vnd.docker.raw-stream\r\nConnection: Upgrade\r\nUpgrade: tcp\r\n\r\n")
+		_, _ = buf.WriteString("hello from exec\n")
+		_ = buf.Flush()
+	})
+
+	mux.HandleFunc("GET "+prefix+"/exec/{id}/json", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, InspectExecSession{Running: false, ExitCode: 0})
+	})
+
+	mux.HandleFunc("PUT "+prefix+"/containers/{id}/archive", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		tr := tar.NewReader(r.Body)
+		for {
+			hdr, err := tr.Next()
+			if err != nil {
+				break
+			}
+			content, _ := io.ReadAll(tr)
+			f.files[filepath.Join(r.URL.Query().Get("path"), hdr.Name)] = content
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	mux.HandleFunc("GET "+prefix+"/containers/{id}/archive", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		path := r.URL.Query().Get("path")
+		content, ok := f.files[path]
+		if !ok {
+			writeError(w, http.StatusNotFound, "file not found")
+			return
+		}
+		tw := tar.NewWriter(w)
+		_ = tw.WriteHeader(&tar.Header{Name: filepath.Base(path), Mode: 0644, Size: int64(len(content))})
+		_, _ = tw.Write(content)
+		_ = tw.Close()
+	})
+
+	mux.HandleFunc("POST "+prefix+"/volumes/create", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		opts := VolumeCreateOptions{}
+		_ = json.NewDecoder(r.Body).Decode(&opts)
+		f.volumes = append(f.volumes, Volume{Name: opts.Name, Labels: opts.Label})
+		w.WriteHeader(http.StatusCreated)
+		writeJSON(w, Volume{Name: opts.Name})
+	})
+
+	mux.HandleFunc("GET "+prefix+"/volumes/json", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		writeJSON(w, f.volumes)
+	})
+
+	mux.HandleFunc("POST "+prefix+"/networks/create", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		network := Network{}
+		_ = json.NewDecoder(r.Body).Decode(&network)
+		network.ID = "net" + network.Name
+		if len(network.Subnets) == 0 {
+			network.Subnets = []Subnet{{Subnet: "10.89.0.0/24", Gateway: "10.89.0.1"}}
+		}
+		f.networks[network.Name] = network
+		writeJSON(w, network)
+	})
+
+	mux.HandleFunc("GET "+prefix+"/networks/{name}/json", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		network, ok := f.networks[r.PathValue("name")]
+		if !ok {
+			writeError(w, http.StatusNotFound, "network not found")
+			return
+		}
+		writeJSON(w, network)
+	})
+
+	sock := filepath.Join(t.TempDir(), "podman.sock")
+	listener, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatalf("failed to listen on %s: %v", sock, err)
+	}
+	server := httptest.NewUnstartedServer(mux)
+	server.Listener = listener
+	server.Start()
+	t.Cleanup(server.Close)
+
+	t.Setenv("CONTAINER_HOST", "unix://"+sock)
+	return f
+}
+
+// matches implements the label and name filters of the container list endpoint for the single fake container
+func (f *fakeLibpod) matches(encodedFilters string) bool {
+	filters := map[string][]string{}
+	_ = json.Unmarshal([]byte(encodedFilters), &filters)
+	for _, label := range filters["label"] {
+		k, v, _ := strings.Cut(label, "=")
+		if f.container.Config.Labels[k] != v {
+			return false
+		}
+	}
+	for _, name := range filters["name"] {
+		if matched, _ := regexp.MatchString(name, f.container.Name); !matched {
+			return false
+		}
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(apiError{StatusCode: status, Message: msg})
+}
+
+func TestPodmanInfo(t *testing.T) {
+	newFakeLibpod(t)
+
+	info, err := Podman{}.Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name != "podman" || info.Version != "5.0.0" || info.CgroupVersion != "2" || info.Filesystem != "xfs" || info.OS != "fedora 40" {
+		t.Errorf("unexpected runtime info: %+v", info)
+	}
+	if expected := (Podman{}).GetRuntimePath(); info.Endpoint != expected {
+		t.Errorf("expected endpoint %s, got %s", expected, info.Endpoint)
+	}
+}
+
+func TestPodmanConnectionOpts(t *testing.T) {
+	newFakeLibpod(t)
+	sock := strings.TrimPrefix(os.Getenv("CONTAINER_HOST"), "unix://")
+	t.Setenv("CONTAINER_HOST", "unix:///nonexistent/podman.sock")
+	t.Cleanup(func() { connectionOpts = runtimeTypes.ConnectionOpts{} })
+
+	if err := (Podman{}).SetConnectionOpts(runtimeTypes.ConnectionOpts{Endpoint: "ssh://host"}); err == nil {
+		t.Error("expected error for unsupported scheme")
+	}
+	if err := (Podman{}).SetConnectionOpts(runtimeTypes.ConnectionOpts{Endpoint: "unix://" + sock, TLS: runtimeTypes.TLSOpts{CACert: "ca.pem"}}); err == nil {
+		t.Error("expected error for TLS on a unix socket")
+	}
+
+	if err := (Podman{}).SetConnectionOpts(runtimeTypes.ConnectionOpts{Endpoint: "unix://" + sock, Timeout: time.Second}); err != nil {
+		t.Fatal(err)
+	}
+	if path := (Podman{}).GetRuntimePath(); path != sock {
+		t.Errorf("expected runtime path %s, got %s", sock, path)
+	}
+	if _, err := (Podman{}).Info(); err != nil {
+		t.Errorf("expected configured endpoint to take precedence over CONTAINER_HOST: %v", err)
+	}
+}
+
+func TestPodmanNodeLifecycle(t *testing.T) {
+	fake := newFakeLibpod(t)
+	ctx := context.Background()
+	p := Podman{}
+
+	labels := map[string]string{k3d.LabelClusterName: "test", k3d.LabelRole: string(k3d.ServerRole), k3d.LabelNetwork: "k3d-test"}
+	for k, v := range k3d.DefaultRuntimeLabels {
+		labels[k] = v
+	}
+	node := &k3d.Node{
+		Name:          "k3d-test-server-0",
+		Role:          k3d.ServerRole,
+		Image:         "rancher/k3s:latest",
+		Env:           []string{"K3S_TOKEN=secret"},
+		Cmd:           []string{"server"},
+		Networks:      []string{"k3d-test"},
+		RuntimeLabels: labels,
+	}
+
+	// create: the image is missing, so it has to be pulled first
+	if err := p.CreateNode(ctx, node); err != nil {
+		t.Fatalf("failed to create node: %v", err)
+	}
+	if fake.imagePulls != 1 {
+		t.Errorf("expected 1 image pull, got %d", fake.imagePulls)
+	}
+
+	if err := p.StartNode(ctx, node); err != nil {
+		t.Fatalf("failed to start node: %v", err)
+	}
+	if !node.State.Running {
+		t.Errorf("expected node to be running after start")
+	}
+
+	// get
+	got, err := p.GetNode(ctx, &k3d.Node{Name: "test-server-0"})
+	if err != nil {
+		t.Fatalf("failed to get node: %v", err)
+	}
+	if got.Role != k3d.ServerRole || got.Image != node.Image || got.IP.IP.String() != "10.89.0.2" {
+		t.Errorf("unexpected node: %+v", got)
+	}
+	nodes, err := p.GetNodesByLabel(ctx, map[string]string{k3d.LabelClusterName: "test"})
+	if err != nil || len(nodes) != 1 {
+		t.Errorf("expected 1 node for cluster, got %d (err: %v)", len(nodes), err)
+	}
+	nodes, err = p.GetNodesByLabel(ctx, map[string]string{k3d.LabelClusterName: "other"})
+	if err != nil || len(nodes) != 0 {
+		t.Errorf("expected no node for other cluster, got %d (err: %v)", len(nodes), err)
+	}
+
+	// exec
+	logreader, err := p.ExecInNodeGetLogs(ctx, node, []string{"echo", "hello"})
+	if err != nil {
+		t.Fatalf("failed to exec in node: %v", err)
+	}
+	line, _ := logreader.ReadString('\n')
+	if line != "hello from exec\n" {
+		t.Errorf("unexpected exec output '%s'", line)
+	}
+
+	// files
+	if err := p.WriteToNode(ctx, []byte("foo: bar"), "/etc/test/config.yaml", 0644, node); err != nil {
+		t.Fatalf("failed to write to node: %v", err)
+	}
+	reader, err := p.ReadFromNode(ctx, "/etc/test/config.yaml", node)
+	if err != nil {
+		t.Fatalf("failed to read from node: %v", err)
+	}
+	defer reader.Close()
+	tr := tar.NewReader(reader)
+	if _, err := tr.Next(); err != nil {
+		t.Fatalf("failed to read tar header: %v", err)
+	}
+	content, _ := io.ReadAll(tr)
+	if !bytes.Equal(content, []byte("foo: bar")) {
+		t.Errorf("unexpected file content '%s'", content)
+	}
+
+	if _, err := p.ReadFromNode(ctx, "/does/not/exist", node); err == nil || !strings.Contains(err.Error(), runtimeErrors.ErrRuntimeFileNotFound.Error()) {
+		t.Errorf("expected file not found error, got %v", err)
+	}
+}
+
+func TestPodmanVolumesAndNetworks(t *testing.T) {
+	newFakeLibpod(t)
+	ctx := context.Background()
+	p := Podman{}
+
+	if err := p.CreateVolume(ctx, "k3d-test-images", map[string]string{k3d.LabelClusterName: "test"}); err != nil {
+		t.Fatalf("failed to create volume: %v", err)
+	}
+	if name, err := p.GetVolume("k3d-test-images"); err != nil || name != "k3d-test-images" {
+		t.Errorf("expected to find volume, got '%s' (err: %v)", name, err)
+	}
+	if _, err := p.GetVolume("missing"); err == nil {
+		t.Errorf("expected error for missing volume")
+	}
+
+	net, exists, err := p.CreateNetworkIfNotPresent(ctx, &k3d.ClusterNetwork{Name: "k3d-test"})
+	if err != nil || exists {
+		t.Fatalf("expected new network, got exists=%t (err: %v)", exists, err)
+	}
+	if net.IPAM.IPPrefix.String() != "10.89.0.0/24" {
+		t.Errorf("unexpected network prefix %s", net.IPAM.IPPrefix)
+	}
+	_, exists, err = p.CreateNetworkIfNotPresent(ctx, &k3d.ClusterNetwork{Name: "k3d-test"})
+	if err != nil || !exists {
+		t.Errorf("expected existing network, got exists=%t (err: %v)", exists, err)
+	}
+
+	hostIP, err := p.GetHostIP(ctx, "k3d-test")
+	if err != nil || hostIP.String() != "10.89.0.1" {
+		t.Errorf("expected gateway IP 10.89.0.1, got %s (err: %v)", hostIP, err)
+	}
+}
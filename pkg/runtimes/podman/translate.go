@@ -0,0 +1,432 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package podman
+
+import (
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/go-connections/nat"
+	l "github.com/k3d-io/k3d/v5/pkg/logger"
+	runtimeErr "github.com/k3d-io/k3d/v5/pkg/runtimes/errors"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+	"github.com/k3d-io/k3d/v5/pkg/util"
+
+	dockerunits "github.com/docker/go-units"
+)
+
+// cpuPeriod is the CFS period (in microseconds) that CPU limits are expressed in, same as docker's --cpus
+const cpuPeriod uint64 = 100000
+
+// TranslateNodeToContainer translates a k3d node specification to a podman container representation
+func TranslateNodeToContainer(node *k3d.Node) (*NodeInPodman, error) {
+	init := true
+	if disableInit, err := strconv.ParseBool(os.Getenv(k3d.K3dEnvDebugDisableDockerInit)); err == nil && disableInit {
+		l.Log().Traceln("init disabled for all containers")
+		init = false
+	}
+
+	/* initialize everything that we need */
+	podmanNode := &NodeInPodman{
+		Name:     node.Name,
+		Hostname: node.Name,
+		Image:    node.Image,
+		Init:     init,
+		HostAdd:  node.ExtraHosts,
+		// Explicitly require bridge networking, as rootless podman would default to slirp4netns/pasta
+		NetNS: Namespace{NSMode: "bridge"},
+	}
+
+	/* Command & Arguments */
+	if node.K3dEntrypoint {
+		if node.Role == k3d.AgentRole || node.Role == k3d.ServerRole {
+			podmanNode.Entrypoint = []string{
+				"/bin/k3d-entrypoint.sh",
+			}
+		}
+	}
+	if node.Role == k3d.LoadBalancerRole && node.RuntimeLabels[k3d.LabelLoadbalancerCopyBinary] == "true" {
+		// the k3d binary copied into the native loadbalancer
+		podmanNode.Entrypoint = []string{k3d.DefaultLoadbalancerNativeBinary}
+	}
+
+	podmanNode.Command = []string{}
+	podmanNode.Command = append(podmanNode.Command, node.Cmd...)  // contains k3s command and role-specific required flags/args
+	podmanNode.Command = append(podmanNode.Command, node.Args...) // extra flags/args
+
+	/* Environment Variables */
+	podmanNode.Env = make(map[string]string, len(node.Env))
+	for _, env := range node.Env {
+		k, v, _ := strings.Cut(env, "=")
+		podmanNode.Env[k] = v
+	}
+
+	/* Labels */
+	podmanNode.Labels = node.RuntimeLabels // has to include the role
+
+	/* Ulimits */
+	for _, ulimit := range node.RuntimeUlimits {
+		podmanNode.Rlimits = append(podmanNode.Rlimits, POSIXRlimit{
+			Type: fmt.Sprintf("RLIMIT_%s", strings.ToUpper(ulimit.Name)),
+			Hard: uint64(ulimit.Hard),
+			Soft: uint64(ulimit.Soft),
+		})
+	}
+
+	/* Auto-Restart */
+	if node.Restart {
+		podmanNode.RestartPolicy = "unless-stopped"
+	}
+
+	/* Tmpfs Mounts */
+	for _, mnt := range k3d.DefaultTmpfsMounts {
+		podmanNode.Mounts = append(podmanNode.Mounts, Mount{
+			Destination: mnt,
+			Type:        "tmpfs",
+			Source:      "tmpfs",
+		})
+	}
+
+	if node.GPURequest != "" {
+		// podman exposes GPUs via CDI devices instead of docker's device requests
+		podmanNode.Devices = append(podmanNode.Devices, LinuxDevice{Path: "nvidia.com/gpu=all"})
+		if node.GPURequest != "all" {
+			l.Log().Warnf("[Podman] GPU request '%s' is not supported, exposing all GPUs via CDI instead", node.GPURequest)
+		}
+	}
+
+	// memory limits
+	if node.Memory != "" {
+		memory, err := dockerunits.RAMInBytes(node.Memory)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to set memory limit: %+v", err)
+		}
+		podmanNode.ResourceLimits = &LinuxResources{Memory: &LinuxMemory{Limit: &memory}}
+	}
+
+	// cpu limits
+	if node.CPUs != "" || node.CPUSet != "" {
+		if podmanNode.ResourceLimits == nil {
+			podmanNode.ResourceLimits = &LinuxResources{}
+		}
+		podmanNode.ResourceLimits.CPU = &LinuxCPU{Cpus: node.CPUSet}
+		if node.CPUs != "" {
+			cpus, err := util.ParseCPUs(node.CPUs)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to set CPU limit: %+v", err)
+			}
+			quota := cpus * int64(cpuPeriod) / 1e9
+			period := cpuPeriod
+			podmanNode.ResourceLimits.CPU.Quota = &quota
+			podmanNode.ResourceLimits.CPU.Period = &period
+		}
+	}
+
+	/* They have to run in privileged mode */
+	podmanNode.Privileged = true
+
+	// Privileged containers require the host user namespace
+	podmanNode.UserNS = Namespace{NSMode: "host"}
+
+	if node.HostPidMode {
+		podmanNode.PidNS = Namespace{NSMode: "host"}
+	}
+
+	/* Volumes */
+	for _, volume := range node.Volumes {
+		mount, namedVolume, err := translateVolume(volume)
+		if err != nil {
+			return nil, fmt.Errorf("failed to translate volume '%s': %w", volume, err)
+		}
+		if mount != nil {
+			podmanNode.Mounts = append(podmanNode.Mounts, *mount)
+		} else {
+			podmanNode.Volumes = append(podmanNode.Volumes, *namedVolume)
+		}
+	}
+
+	/* Ports */
+	for containerPort, bindings := range node.Ports {
+		portMappings, err := translatePortBindings(containerPort, bindings)
+		if err != nil {
+			return nil, err
+		}
+		podmanNode.PortMappings = append(podmanNode.PortMappings, portMappings...)
+	}
+
+	/* Network */
+	if len(node.Networks) > 0 {
+		podmanNode.Networks = make(map[string]PerNetworkOptions, len(node.Networks))
+		for _, net := range node.Networks {
+			if net == "host" {
+				podmanNode.NetNS = Namespace{NSMode: "host"}
+				continue
+			}
+			podmanNode.Networks[net] = PerNetworkOptions{}
+		}
+
+		/* Static IP */
+		if node.IP.IP.IsValid() && node.IP.Static {
+			podmanNode.Networks[node.Networks[0]] = PerNetworkOptions{
+				StaticIPs: []string{node.IP.IP.String()},
+			}
+		}
+	}
+
+	return podmanNode, nil
+}
+
+// translateVolume translates a docker-style volume string (src:dest[:opts]) to either a bind mount or a named volume
+func translateVolume(volume string) (*Mount, *NamedVolume, error) {
+	parts := strings.Split(volume, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return nil, nil, fmt.Errorf("invalid volume format, expected src:dest[:opts]")
+	}
+
+	var opts []string
+	if len(parts) == 3 {
+		opts = strings.Split(parts[2], ",")
+	}
+
+	if filepath.IsAbs(parts[0]) || strings.HasPrefix(parts[0], ".") {
+		return &Mount{
+			Destination: parts[1],
+			Type:        "bind",
+			Source:      parts[0],
+			Options:     append([]string{"rbind"}, opts...),
+		}, nil, nil
+	}
+
+	return nil, &NamedVolume{
+		Name:    parts[0],
+		Dest:    parts[1],
+		Options: opts,
+	}, nil
+}
+
+// translatePortBindings translates the host bindings of a single container port into podman port mappings
+func translatePortBindings(containerPort nat.Port, bindings []nat.PortBinding) ([]PortMapping, error) {
+	startPort, endPort, err := containerPort.Range()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse container port '%s': %w", containerPort, err)
+	}
+	portRange := uint16(endPort - startPort + 1)
+	if portRange == 1 {
+		portRange = 0
+	}
+
+	if len(bindings) == 0 {
+		bindings = []nat.PortBinding{{}}
+	}
+
+	portMappings := []PortMapping{}
+	for _, binding := range bindings {
+		mapping := PortMapping{
+			HostIP:        binding.HostIP,
+			ContainerPort: uint16(startPort),
+			Range:         portRange,
+			Protocol:      containerPort.Proto(),
+		}
+		if binding.HostPort != "" {
+			hostStart, _, err := nat.ParsePortRangeToInt(binding.HostPort)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse host port '%s': %w", binding.HostPort, err)
+			}
+			mapping.HostPort = uint16(hostStart)
+		}
+		portMappings = append(portMappings, mapping)
+	}
+	return portMappings, nil
+}
+
+// TranslateContainerToNode translates a podman container list object into a k3d node representation
+func TranslateContainerToNode(cont *ListContainer) (*k3d.Node, error) {
+	node := &k3d.Node{
+		Name:          strings.TrimPrefix(cont.Names[0], "/"), // container name with leading '/' cut off
+		Image:         cont.Image,
+		RuntimeLabels: cont.Labels,
+		Role:          k3d.NodeRoles[cont.Labels[k3d.LabelRole]],
+	}
+	return node, nil
+}
+
+// TranslateContainerDetailsToNode translates a podman container inspect object into a k3d node representation
+func TranslateContainerDetailsToNode(containerDetails *InspectContainerData) (*k3d.Node, error) {
+	// first, make sure, that it's actually a k3d managed container by checking if it has all the default labels
+	for k, v := range k3d.DefaultRuntimeLabels {
+		if containerDetails.Config.Labels[k] != v {
+			l.Log().Debugf("Container %s is missing default label %s=%s in label set %+v", containerDetails.Name, k, v, containerDetails.Config.Labels)
+			return nil, runtimeErr.ErrRuntimeContainerUnknown
+		}
+	}
+
+	// restart -> we only set 'unless-stopped' upon cluster creation
+	restart := false
+	if containerDetails.HostConfig.RestartPolicy.Name == "always" || containerDetails.HostConfig.RestartPolicy.Name == "unless-stopped" {
+		restart = true
+	}
+
+	// get networks and ensure that the cluster network is first in list
+	orderedNetworks := []string{}
+	otherNetworks := []string{}
+	for networkName := range containerDetails.NetworkSettings.Networks {
+		if strings.HasPrefix(networkName, fmt.Sprintf("%s-%s", k3d.DefaultObjectNamePrefix, containerDetails.Config.Labels[k3d.LabelClusterName])) {
+			orderedNetworks = append(orderedNetworks, networkName)
+			continue
+		}
+		otherNetworks = append(otherNetworks, networkName)
+	}
+	orderedNetworks = append(orderedNetworks, otherNetworks...)
+
+	/**
+	 * ServerOpts
+	 */
+
+	// IsInit
+	serverOpts := k3d.ServerOpts{IsInit: false}
+	clusterInitFlagSet := false
+	for _, arg := range containerDetails.Args {
+		if strings.Contains(arg, "--cluster-init") {
+			clusterInitFlagSet = true
+			break
+		}
+	}
+	if serverIsInitLabel, ok := containerDetails.Config.Labels[k3d.LabelServerIsInit]; ok {
+		if serverIsInitLabel == "true" {
+			if !clusterInitFlagSet {
+				l.Log().Errorf("Container %s has label %s=true, but the args do not contain the --cluster-init flag", containerDetails.Name, k3d.LabelServerIsInit)
+			} else {
+				serverOpts.IsInit = true
+			}
+		}
+	}
+
+	// Kube API
+	serverOpts.KubeAPI = &k3d.ExposureOpts{}
+	for k, v := range containerDetails.Config.Labels {
+		if k == k3d.LabelServerAPIHostIP {
+			serverOpts.KubeAPI.Binding.HostIP = v
+		} else if k == k3d.LabelServerAPIHost {
+			serverOpts.KubeAPI.Host = v
+		} else if k == k3d.LabelServerAPIPort {
+			serverOpts.KubeAPI.Binding.HostPort = v
+		}
+	}
+
+	// labels: only copy k3d.* labels
+	labels := map[string]string{}
+	for k, v := range containerDetails.Config.Labels {
+		if strings.HasPrefix(k, "k3d") {
+			labels[k] = v
+		}
+	}
+
+	// status
+	nodeState := k3d.NodeState{
+		Running: containerDetails.State.Running,
+		Status:  containerDetails.State.Status,
+	}
+	if !containerDetails.State.StartedAt.IsZero() {
+		nodeState.Started = containerDetails.State.StartedAt.Format(time.RFC3339Nano)
+	}
+
+	// memory limit
+	memoryStr := ""
+	if containerDetails.HostConfig.Memory > 0 {
+		memoryStr = dockerunits.HumanSize(float64(containerDetails.HostConfig.Memory))
+	}
+
+	// cpu limit
+	cpusStr := ""
+	if containerDetails.HostConfig.CPUQuota > 0 && containerDetails.HostConfig.CPUPeriod > 0 {
+		cpusStr = util.FormatCPUs(containerDetails.HostConfig.CPUQuota * 1e9 / int64(containerDetails.HostConfig.CPUPeriod))
+	}
+
+	// ports
+	ports := nat.PortMap{}
+	for port, bindings := range containerDetails.HostConfig.PortBindings {
+		portBindings := []nat.PortBinding{}
+		for _, binding := range bindings {
+			portBindings = append(portBindings, nat.PortBinding{HostIP: binding.HostIP, HostPort: binding.HostPort})
+		}
+		ports[nat.Port(port)] = portBindings
+	}
+
+	// IP
+	var nodeIP k3d.NodeIP
+	if netLabel, ok := labels[k3d.LabelNetwork]; ok && netLabel != "host" {
+		if clusterNet, ok := containerDetails.NetworkSettings.Networks[netLabel]; ok {
+			parsedIP, err := netip.ParseAddr(clusterNet.IPAddress)
+			if err != nil {
+				if nodeState.Running && nodeState.Status != "restarting" { // if the container is not running or currently restarting, it won't have an IP, so we don't error in that case
+					return nil, fmt.Errorf("failed to parse IP '%s' for container '%s': %s", clusterNet.IPAddress, containerDetails.Name, err)
+				}
+				l.Log().Tracef("failed to parse IP '%s' for container '%s', likely because it's not running (or restarting): %v", clusterNet.IPAddress, containerDetails.Name, err)
+			}
+			_, isStaticIP := labels[k3d.LabelNodeStaticIP]
+			if parsedIP.IsValid() {
+				nodeIP = k3d.NodeIP{
+					IP:     parsedIP,
+					Static: isStaticIP && labels[k3d.LabelNodeStaticIP] != "",
+				}
+			}
+		} else {
+			l.Log().Debugf("failed to get IP for container %s as we couldn't find the cluster network", containerDetails.Name)
+		}
+	} else {
+		l.Log().Debugf("no netlabel present on container %s", containerDetails.Name)
+	}
+
+	image := containerDetails.ImageName
+	if image == "" {
+		image = containerDetails.Image
+	}
+
+	node := &k3d.Node{
+		Name:          strings.TrimPrefix(containerDetails.Name, "/"),
+		Role:          k3d.NodeRoles[containerDetails.Config.Labels[k3d.LabelRole]],
+		Image:         image,
+		Volumes:       containerDetails.HostConfig.Binds,
+		Env:           containerDetails.Config.Env,
+		Cmd:           containerDetails.Config.Cmd,
+		Args:          []string{}, // empty, since Cmd already contains flags
+		Ports:         ports,
+		Restart:       restart,
+		Created:       containerDetails.Created.Format(time.RFC3339Nano),
+		RuntimeLabels: labels,
+		Networks:      orderedNetworks,
+		ServerOpts:    serverOpts,
+		AgentOpts:     k3d.AgentOpts{},
+		State:         nodeState,
+		Memory:        memoryStr,
+		CPUs:          cpusStr,
+		CPUSet:        containerDetails.HostConfig.CpusetCpus,
+		IP:            nodeIP, // only valid for the cluster network
+	}
+	return node, nil
+}
@@ -0,0 +1,316 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package podman
+
+import "time"
+
+/*
+ * Subsets of the libpod REST API types that k3d makes use of
+ * See https://docs.podman.io/en/latest/_static/api.html
+ */
+
+// NodeInPodman represents everything that's needed to create a node as a podman container (libpod SpecGenerator)
+type NodeInPodman struct {
+	Name           string                       `json:"name,omitempty"`
+	Hostname       string                       `json:"hostname,omitempty"`
+	Image          string                       `json:"image"`
+	Entrypoint     []string                     `json:"entrypoint,omitempty"`
+	Command        []string                     `json:"command,omitempty"`
+	Env            map[string]string            `json:"env,omitempty"`
+	Labels         map[string]string            `json:"labels,omitempty"`
+	Init           bool                         `json:"init,omitempty"`
+	Privileged     bool                         `json:"privileged,omitempty"`
+	RestartPolicy  string                       `json:"restart_policy,omitempty"`
+	UserNS         Namespace                    `json:"userns,omitempty"`
+	PidNS          Namespace                    `json:"pidns,omitempty"`
+	NetNS          Namespace                    `json:"netns,omitempty"`
+	Networks       map[string]PerNetworkOptions `json:"networks,omitempty"`
+	PortMappings   []PortMapping                `json:"portmappings,omitempty"`
+	Mounts         []Mount                      `json:"mounts,omitempty"`
+	Volumes        []NamedVolume                `json:"volumes,omitempty"`
+	HostAdd        []string                     `json:"hostadd,omitempty"`
+	Rlimits        []POSIXRlimit                `json:"r_limits,omitempty"`
+	ResourceLimits *LinuxResources              `json:"resource_limits,omitempty"`
+	Devices        []LinuxDevice                `json:"devices,omitempty"`
+}
+
+// Namespace describes a namespace mode, e.g. "host", "bridge" or "private"
+type Namespace struct {
+	NSMode string `json:"nsmode,omitempty"`
+	Value  string `json:"value,omitempty"`
+}
+
+// PerNetworkOptions are the options for a container in one network
+type PerNetworkOptions struct {
+	StaticIPs []string `json:"static_ips,omitempty"`
+	Aliases   []string `json:"aliases,omitempty"`
+}
+
+// PortMapping is a single port mapping of a container
+type PortMapping struct {
+	HostIP        string `json:"host_ip,omitempty"`
+	ContainerPort uint16 `json:"container_port"`
+	HostPort      uint16 `json:"host_port,omitempty"`
+	Range         uint16 `json:"range,omitempty"`
+	Protocol      string `json:"protocol,omitempty"`
+}
+
+// Mount is a bind or tmpfs mount
+type Mount struct {
+	Destination string   `json:"destination"`
+	Type        string   `json:"type"`
+	Source      string   `json:"source,omitempty"`
+	Options     []string `json:"options,omitempty"`
+}
+
+// NamedVolume is a named volume mounted into a container
+type NamedVolume struct {
+	Name    string   `json:"Name"`
+	Dest    string   `json:"Dest"`
+	Options []string `json:"Options,omitempty"`
+}
+
+// POSIXRlimit is a ulimit
+type POSIXRlimit struct {
+	Type string `json:"type"`
+	Hard uint64 `json:"hard"`
+	Soft uint64 `json:"soft"`
+}
+
+// LinuxResources are the resource limits of a container
+type LinuxResources struct {
+	Memory *LinuxMemory `json:"memory,omitempty"`
+	CPU    *LinuxCPU    `json:"cpu,omitempty"`
+}
+
+// LinuxMemory is the memory limit of a container
+type LinuxMemory struct {
+	Limit *int64 `json:"limit,omitempty"`
+}
+
+// LinuxCPU is the CPU limit (quota per period) and CPU pinning of a container
+type LinuxCPU struct {
+	Quota  *int64  `json:"quota,omitempty"`
+	Period *uint64 `json:"period,omitempty"`
+	Cpus   string  `json:"cpus,omitempty"`
+}
+
+// LinuxDevice is a device made available to the container (e.g. a CDI device for GPUs)
+type LinuxDevice struct {
+	Path string `json:"path"`
+}
+
+// ContainerCreateResponse is returned when creating a container
+type ContainerCreateResponse struct {
+	ID       string   `json:"Id"`
+	Warnings []string `json:"Warnings"`
+}
+
+// ListContainer is a container as returned by the list endpoint
+type ListContainer struct {
+	ID       string            `json:"Id"`
+	Names    []string          `json:"Names"`
+	Image    string            `json:"Image"`
+	Labels   map[string]string `json:"Labels"`
+	State    string            `json:"State"`
+	Networks []string          `json:"Networks"`
+}
+
+// InspectContainerData is the detailed representation of a container
+type InspectContainerData struct {
+	ID              string                     `json:"Id"`
+	Created         time.Time                  `json:"Created"`
+	Args            []string                   `json:"Args"`
+	State           InspectContainerState      `json:"State"`
+	Image           string                     `json:"Image"`
+	ImageName       string                     `json:"ImageName"`
+	Name            string                     `json:"Name"`
+	Config          InspectContainerConfig     `json:"Config"`
+	HostConfig      InspectContainerHostConfig `json:"HostConfig"`
+	NetworkSettings InspectNetworkSettings     `json:"NetworkSettings"`
+}
+
+// InspectContainerState is the state of a container
+type InspectContainerState struct {
+	Status    string    `json:"Status"`
+	Running   bool      `json:"Running"`
+	StartedAt time.Time `json:"StartedAt"`
+}
+
+// InspectContainerConfig is the configuration of a container
+type InspectContainerConfig struct {
+	Hostname string            `json:"Hostname"`
+	Env      []string          `json:"Env"`
+	Cmd      []string          `json:"Cmd"`
+	Labels   map[string]string `json:"Labels"`
+}
+
+// InspectContainerHostConfig is the host specific configuration of a container
+type InspectContainerHostConfig struct {
+	Binds         []string                     `json:"Binds"`
+	PortBindings  map[string][]InspectHostPort `json:"PortBindings"`
+	RestartPolicy InspectRestartPolicy         `json:"RestartPolicy"`
+	Memory        int64                        `json:"Memory"`
+	CPUQuota      int64                        `json:"CpuQuota"`
+	CPUPeriod     uint64                       `json:"CpuPeriod"`
+	CpusetCpus    string                       `json:"CpusetCpus"`
+}
+
+// InspectHostPort is a host port binding of a container
+type InspectHostPort struct {
+	HostIP   string `json:"HostIp"`
+	HostPort string `json:"HostPort"`
+}
+
+// InspectRestartPolicy is the restart policy of a container
+type InspectRestartPolicy struct {
+	Name string `json:"Name"`
+}
+
+// InspectNetworkSettings are the network settings of a container
+type InspectNetworkSettings struct {
+	Networks map[string]InspectAdditionalNetwork `json:"Networks"`
+}
+
+// InspectAdditionalNetwork holds the settings of a container for a single network
+type InspectAdditionalNetwork struct {
+	NetworkID string `json:"NetworkID"`
+	IPAddress string `json:"IPAddress"`
+	Gateway   string `json:"Gateway"`
+}
+
+// Network is a podman network (netavark/CNI)
+type Network struct {
+	Name       string            `json:"name"`
+	ID         string            `json:"id"`
+	Driver     string            `json:"driver"`
+	Subnets    []Subnet          `json:"subnets,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	Options    map[string]string `json:"options,omitempty"`
+	DNSEnabled bool              `json:"dns_enabled"`
+}
+
+// Subnet is a subnet of a podman network
+type Subnet struct {
+	Subnet  string `json:"subnet"`
+	Gateway string `json:"gateway,omitempty"`
+}
+
+// NetworkConnectOptions is the body to connect a container to a network
+type NetworkConnectOptions struct {
+	Container string `json:"container"`
+}
+
+// NetworkDisconnectOptions is the body to disconnect a container from a network
+type NetworkDisconnectOptions struct {
+	Container string `json:"Container"`
+	Force     bool   `json:"Force"`
+}
+
+// Volume is a podman named volume
+type Volume struct {
+	Name   string            `json:"Name"`
+	Driver string            `json:"Driver,omitempty"`
+	Labels map[string]string `json:"Labels,omitempty"`
+}
+
+// VolumeCreateOptions is the body to create a new volume
+type VolumeCreateOptions struct {
+	Name   string            `json:"Name"`
+	Driver string            `json:"Driver,omitempty"`
+	Label  map[string]string `json:"Label,omitempty"`
+}
+
+// ExecCreateConfig is the body to create a new exec session
+type ExecCreateConfig struct {
+	AttachStdin  bool     `json:"AttachStdin"`
+	AttachStdout bool     `json:"AttachStdout"`
+	AttachStderr bool     `json:"AttachStderr"`
+	Cmd          []string `json:"Cmd"`
+	Privileged   bool     `json:"Privileged"`
+	Tty          bool     `json:"Tty"`
+}
+
+// ExecCreateResponse is returned when creating an exec session
+type ExecCreateResponse struct {
+	ID string `json:"Id"`
+}
+
+// ExecStartConfig is the body to start an exec session
+type ExecStartConfig struct {
+	Detach bool `json:"Detach"`
+	Tty    bool `json:"Tty"`
+}
+
+// InspectExecSession is the state of an exec session
+type InspectExecSession struct {
+	Running  bool `json:"Running"`
+	ExitCode int  `json:"ExitCode"`
+}
+
+// ImageSummary is an image as returned by the list endpoint
+type ImageSummary struct {
+	ID       string   `json:"Id"`
+	RepoTags []string `json:"RepoTags"`
+	Names    []string `json:"Names"`
+}
+
+// Info is the system information of the podman service
+type Info struct {
+	Host    InfoHost    `json:"host"`
+	Store   InfoStore   `json:"store"`
+	Version InfoVersion `json:"version"`
+}
+
+// InfoHost holds information about the host of the podman service
+type InfoHost struct {
+	Arch          string           `json:"arch"`
+	OS            string           `json:"os"`
+	Hostname      string           `json:"hostname"`
+	CgroupManager string           `json:"cgroupManager"`
+	CgroupVersion string           `json:"cgroupVersion"`
+	Distribution  InfoDistribution `json:"distribution"`
+	Security      InfoSecurity     `json:"security"`
+}
+
+// InfoDistribution is the linux distribution of the host
+type InfoDistribution struct {
+	Distribution string `json:"distribution"`
+	Version      string `json:"version"`
+}
+
+// InfoSecurity holds security related information of the host
+type InfoSecurity struct {
+	Rootless bool `json:"rootless"`
+}
+
+// InfoStore holds information about the container storage
+type InfoStore struct {
+	GraphDriverName string            `json:"graphDriverName"`
+	GraphStatus     map[string]string `json:"graphStatus"`
+}
+
+// InfoVersion holds the version of the podman service
+type InfoVersion struct {
+	Version string `json:"Version"`
+}
@@ -0,0 +1,140 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package podman
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/docker/docker/pkg/archive"
+	l "github.com/k3d-io/k3d/v5/pkg/logger"
+	runtimeErrors "github.com/k3d-io/k3d/v5/pkg/runtimes/errors"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// CopyToNode copies a file or directory from the local FS to the selected node
+func (p Podman) CopyToNode(ctx context.Context, src string, dest string, node *k3d.Node) error {
+	nodeContainer, err := getNodeContainer(ctx, node)
+	if err != nil {
+		return fmt.Errorf("failed to find container for target node '%s': %w", node.Name, err)
+	}
+
+	// tar the source and rename it to the target name, so that we can extract it right in the target directory
+	srcAbs, err := filepath.Abs(src)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path of '%s': %w", src, err)
+	}
+	srcArchive, err := archive.TarWithOptions(filepath.Dir(srcAbs), &archive.TarOptions{
+		IncludeFiles: []string{filepath.Base(srcAbs)},
+		RebaseNames:  map[string]string{filepath.Base(srcAbs): path.Base(dest)},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create tar resource: %w", err)
+	}
+	defer srcArchive.Close()
+
+	return putArchive(ctx, nodeContainer.ID, path.Dir(dest), srcArchive)
+}
+
+// WriteToNode writes a byte array to the selected node
+func (p Podman) WriteToNode(ctx context.Context, content []byte, dest string, mode os.FileMode, node *k3d.Node) error {
+	nodeContainer, err := getNodeContainer(ctx, node)
+	if err != nil {
+		return fmt.Errorf("Failed to find container for node '%s': %+v", node.Name, err)
+	}
+
+	buf := new(bytes.Buffer)
+	tarWriter := tar.NewWriter(buf)
+	tarHeader := &tar.Header{
+		Name: dest,
+		Mode: int64(mode),
+		Size: int64(len(content)),
+	}
+
+	if err := tarWriter.WriteHeader(tarHeader); err != nil {
+		return fmt.Errorf("Failed to write tar header: %+v", err)
+	}
+
+	if _, err := tarWriter.Write(content); err != nil {
+		return fmt.Errorf("Failed to write tar content: %+v", err)
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		l.Log().Debugf("Failed to close tar writer: %+v", err)
+	}
+
+	if err := putArchive(ctx, nodeContainer.ID, "/", buf); err != nil {
+		return fmt.Errorf("Failed to copy content to container '%s': %+v", nodeContainer.ID, err)
+	}
+
+	return nil
+}
+
+// ReadFromNode reads from a given filepath inside the node container.
+// Like with docker, the returned stream is a tar archive containing the file.
+func (p Podman) ReadFromNode(ctx context.Context, path string, node *k3d.Node) (io.ReadCloser, error) {
+	l.Log().Tracef("Reading path %s from node %s...", path, node.Name)
+	nodeContainer, err := getNodeContainer(ctx, node)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find container for node '%s': %w", node.Name, err)
+	}
+
+	podman, err := GetPodmanClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get podman client: %w", err)
+	}
+
+	query := url.Values{}
+	query.Set("path", path)
+	resp, err := podman.do(ctx, http.MethodGet, fmt.Sprintf("/containers/%s/archive", nodeContainer.ID), query, nil)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, errors.Wrap(runtimeErrors.ErrRuntimeFileNotFound, err.Error())
+		}
+		return nil, fmt.Errorf("failed to copy path '%s' from container '%s': %w", path, nodeContainer.ID, err)
+	}
+
+	return resp.Body, nil
+}
+
+// putArchive extracts a tar archive into the given directory inside a container
+func putArchive(ctx context.Context, containerID string, dir string, content io.Reader) error {
+	podman, err := GetPodmanClient()
+	if err != nil {
+		return fmt.Errorf("failed to get podman client: %w", err)
+	}
+	defer podman.Close()
+
+	query := url.Values{}
+	query.Set("path", dir)
+	return podman.doJSON(ctx, http.MethodPut, fmt.Sprintf("/containers/%s/archive", containerID), query, content, nil)
+}
@@ -0,0 +1,139 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package podman
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	runtimeErrors "github.com/k3d-io/k3d/v5/pkg/runtimes/errors"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+// CreateVolume creates a new named volume
+func (p Podman) CreateVolume(ctx context.Context, name string, labels map[string]string) error {
+	podman, err := GetPodmanClient()
+	if err != nil {
+		return fmt.Errorf("failed to get podman client: %w", err)
+	}
+	defer podman.Close()
+
+	volumeCreateOptions := VolumeCreateOptions{
+		Name:   name,
+		Driver: "local",
+		Label:  map[string]string{},
+	}
+	for k, v := range labels {
+		volumeCreateOptions.Label[k] = v
+	}
+	for k, v := range k3d.DefaultRuntimeLabels {
+		volumeCreateOptions.Label[k] = v
+	}
+	for k, v := range k3d.DefaultRuntimeLabelsVar {
+		volumeCreateOptions.Label[k] = v
+	}
+
+	if err := podman.doJSON(ctx, http.MethodPost, "/volumes/create", nil, volumeCreateOptions, nil); err != nil {
+		return fmt.Errorf("failed to create volume '%s': %w", name, err)
+	}
+	return nil
+}
+
+// DeleteVolume deletes a named volume
+func (p Podman) DeleteVolume(ctx context.Context, name string) error {
+	podman, err := GetPodmanClient()
+	if err != nil {
+		return fmt.Errorf("failed to get podman client: %w", err)
+	}
+	defer podman.Close()
+
+	if err := podman.doJSON(ctx, http.MethodDelete, fmt.Sprintf("/volumes/%s", name), nil, nil, nil); err != nil {
+		if isNotFound(err) {
+			return fmt.Errorf("failed to find volume '%s': %w", name, err)
+		}
+		if isConflict(err) {
+			return fmt.Errorf("failed to delete volume '%s' as it is still referenced by a container: %w", name, err)
+		}
+		return fmt.Errorf("podman failed to delete volume '%s': %w", name, err)
+	}
+
+	return nil
+}
+
+// GetVolume tries to get a named volume
+func (p Podman) GetVolume(name string) (string, error) {
+	volumes, err := listVolumes(context.Background(), map[string][]string{"name": {name}})
+	if err != nil {
+		return "", err
+	}
+	for _, vol := range volumes {
+		if vol.Name == name {
+			return vol.Name, nil
+		}
+	}
+	return "", fmt.Errorf("failed to find named volume '%s': %w", name, runtimeErrors.ErrRuntimeVolumeNotExists)
+}
+
+// GetVolumesByLabel lists the names of all volumes that have the default k3d labels and the given labels attached
+func (p Podman) GetVolumesByLabel(ctx context.Context, labels map[string]string) ([]string, error) {
+	filters := map[string][]string{}
+	for k, v := range k3d.DefaultRuntimeLabels {
+		filters["label"] = append(filters["label"], fmt.Sprintf("%s=%s", k, v))
+	}
+	for k, v := range labels {
+		filters["label"] = append(filters["label"], fmt.Sprintf("%s=%s", k, v))
+	}
+
+	var volumes []string
+	volumeList, err := listVolumes(ctx, filters)
+	if err != nil {
+		return volumes, err
+	}
+	for _, v := range volumeList {
+		volumes = append(volumes, v.Name)
+	}
+	return volumes, nil
+}
+
+func listVolumes(ctx context.Context, filters map[string][]string) ([]Volume, error) {
+	podman, err := GetPodmanClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get podman client: %w", err)
+	}
+	defer podman.Close()
+
+	encodedFilters, err := encodeFilters(filters)
+	if err != nil {
+		return nil, err
+	}
+	query := url.Values{}
+	query.Set("filters", encodedFilters)
+
+	volumes := []Volume{}
+	if err := podman.doJSON(ctx, http.MethodGet, "/volumes/json", query, nil, &volumes); err != nil {
+		return nil, fmt.Errorf("podman failed to list volumes: %w", err)
+	}
+	return volumes, nil
+}
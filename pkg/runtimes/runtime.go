@@ -28,9 +28,12 @@ import (
 	"io"
 	"net/netip"
 	"os"
+	"sort"
 	"time"
 
 	"github.com/k3d-io/k3d/v5/pkg/runtimes/docker"
+	"github.com/k3d-io/k3d/v5/pkg/runtimes/nerdctl"
+	"github.com/k3d-io/k3d/v5/pkg/runtimes/podman"
 	runtimeTypes "github.com/k3d-io/k3d/v5/pkg/runtimes/types"
 	k3d "github.com/k3d-io/k3d/v5/pkg/types"
 )
@@ -41,9 +44,22 @@ var SelectedRuntime Runtime = docker.Docker{}
 // Docker docker
 var Docker = docker.Docker{}
 
+// Podman podman
+var Podman = podman.Podman{}
+
+// Nerdctl containerd via nerdctl
+var Nerdctl = nerdctl.Nerdctl{}
+
 // Runtimes defines a map of implemented k3d runtimes
 var Runtimes = map[string]Runtime{
-	"docker": docker.Docker{},
+	"docker":  docker.Docker{},
+	"podman":  podman.Podman{},
+	"nerdctl": nerdctl.Nerdctl{},
+}
+
+// runtimeAliases maps alternative names to implemented k3d runtimes
+var runtimeAliases = map[string]string{
+	"containerd": "nerdctl", // the nerdctl runtime is the way to run k3d on containerd
 }
 
 // Runtime defines an interface that can be implemented for various container runtime environments (docker, containerd, etc.)
@@ -83,8 +99,21 @@ type Runtime interface {
 	GetNetwork(context.Context, *k3d.ClusterNetwork) (*k3d.ClusterNetwork, error) // @param context, network (so we can filter by name or by id)
 }
 
+// Names returns the sorted names of all implemented k3d runtimes
+func Names() []string {
+	names := make([]string, 0, len(Runtimes))
+	for name := range Runtimes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // GetRuntime checks, if a given name is represented by an implemented k3d runtime and returns it
 func GetRuntime(rt string) (Runtime, error) {
+	if name, ok := runtimeAliases[rt]; ok {
+		rt = name
+	}
 	if runtime, ok := Runtimes[rt]; ok {
 		return runtime, nil
 	}
@@ -0,0 +1,143 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package runtimes
+
+import (
+	"fmt"
+
+	runtimeTypes "github.com/k3d-io/k3d/v5/pkg/runtimes/types"
+	k3d "github.com/k3d-io/k3d/v5/pkg/types"
+)
+
+// DefaultRuntime is the name of the runtime used if none is selected explicitly
+const DefaultRuntime = "docker"
+
+// SelectionSource describes where the selection of the runtime came from
+type SelectionSource string
+
+// Sources of a runtime selection, in order of precedence
+const (
+	SelectionSourceFlag    SelectionSource = "flag"
+	SelectionSourceEnv     SelectionSource = "env"
+	SelectionSourceConfig  SelectionSource = "config"
+	SelectionSourceDefault SelectionSource = "default"
+)
+
+// Selection describes which runtime is selected, why and how to connect to it
+type Selection struct {
+	Name       string                      `json:"name"`
+	Source     SelectionSource             `json:"source"`
+	Connection runtimeTypes.ConnectionOpts `json:"connection,omitempty"`
+}
+
+// Reason returns a human readable explanation of why the runtime was selected
+func (s Selection) Reason() string {
+	switch s.Source {
+	case SelectionSourceFlag:
+		return "set via the --runtime flag"
+	case SelectionSourceEnv:
+		return fmt.Sprintf("set via the %s environment variable", k3d.K3dEnvRuntime)
+	case SelectionSourceConfig:
+		return "set via options.runtime.name in the config file"
+	default:
+		return fmt.Sprintf("default, as neither --runtime, %s nor options.runtime.name is set", k3d.K3dEnvRuntime)
+	}
+}
+
+// CurrentSelection describes the selection of the SelectedRuntime
+var CurrentSelection = Selection{Name: DefaultRuntime, Source: SelectionSourceDefault}
+
+// ConfigurableRuntime is implemented by runtimes that support custom connection settings
+type ConfigurableRuntime interface {
+	SetConnectionOpts(runtimeTypes.ConnectionOpts) error
+}
+
+// PreflightRuntime is implemented by runtimes that depend on something (e.g. a CLI) that has to be checked on selection
+type PreflightRuntime interface {
+	Preflight() error
+}
+
+// ResolveSelection determines the runtime to use from the given values.
+// Order of precedence: flag > environment variable > config file > default
+func ResolveSelection(flagValue, envValue, configValue string) Selection {
+	switch {
+	case flagValue != "":
+		return Selection{Name: flagValue, Source: SelectionSourceFlag}
+	case envValue != "":
+		return Selection{Name: envValue, Source: SelectionSourceEnv}
+	case configValue != "":
+		return Selection{Name: configValue, Source: SelectionSourceConfig}
+	default:
+		return Selection{Name: DefaultRuntime, Source: SelectionSourceDefault}
+	}
+}
+
+// Select sets the SelectedRuntime according to the given selection and applies its connection settings
+func Select(selection Selection) error {
+	runtime, err := GetRuntime(selection.Name)
+	if err != nil {
+		return err
+	}
+	selection.Name = runtime.ID() // resolve aliases
+
+	if !selection.Connection.IsZero() {
+		if err := selection.Connection.Validate(); err != nil {
+			return fmt.Errorf("invalid connection settings for runtime '%s': %w", selection.Name, err)
+		}
+		configurable, ok := runtime.(ConfigurableRuntime)
+		if !ok {
+			return fmt.Errorf("runtime '%s' does not support custom connection settings", selection.Name)
+		}
+		if err := configurable.SetConnectionOpts(selection.Connection); err != nil {
+			return fmt.Errorf("failed to configure connection to runtime '%s': %w", selection.Name, err)
+		}
+	}
+
+	if preflight, ok := runtime.(PreflightRuntime); ok {
+		if err := preflight.Preflight(); err != nil {
+			return fmt.Errorf("runtime '%s' (%s) is not usable: %w", selection.Name, selection.Reason(), err)
+		}
+	}
+
+	SelectedRuntime = runtime
+	CurrentSelection = selection
+	return nil
+}
+
+// SelectFromConfig applies the runtime settings of a config file to the current selection:
+// the runtime name of the config file is only used if the runtime wasn't selected via flag or environment variable
+// and the connection settings of the config file are overridden by the ones that are already set (e.g. via flags).
+func SelectFromConfig(name string, connections map[string]runtimeTypes.ConnectionOpts) error {
+	selection := CurrentSelection
+	if name != "" && selection.Source == SelectionSourceDefault {
+		selection.Name = name
+		selection.Source = SelectionSourceConfig
+	}
+	if conn, ok := connections[selection.Name]; ok {
+		selection.Connection = conn.Merge(selection.Connection)
+	}
+	if selection == CurrentSelection {
+		return nil
+	}
+	return Select(selection)
+}
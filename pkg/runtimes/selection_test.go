@@ -0,0 +1,155 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package runtimes
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/k3d-io/k3d/v5/pkg/runtimes/nerdctl"
+	runtimeTypes "github.com/k3d-io/k3d/v5/pkg/runtimes/types"
+)
+
+func TestResolveSelection(t *testing.T) {
+	tests := map[string]struct {
+		flag, env, config string
+		expected          Selection
+	}{
+		"flag wins":      {"podman", "nerdctl", "docker", Selection{Name: "podman", Source: SelectionSourceFlag}},
+		"env over cfg":   {"", "nerdctl", "podman", Selection{Name: "nerdctl", Source: SelectionSourceEnv}},
+		"config":         {"", "", "podman", Selection{Name: "podman", Source: SelectionSourceConfig}},
+		"default":        {"", "", "", Selection{Name: DefaultRuntime, Source: SelectionSourceDefault}},
+		"empty flag/env": {"", "", "nerdctl", Selection{Name: "nerdctl", Source: SelectionSourceConfig}},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if actual := ResolveSelection(tc.flag, tc.env, tc.config); actual != tc.expected {
+				t.Errorf("expected %+v, got %+v", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestConnectionOpts(t *testing.T) {
+	base := runtimeTypes.ConnectionOpts{Endpoint: "tcp://10.0.0.1:2376", Timeout: 10 * time.Second, TLS: runtimeTypes.TLSOpts{CACert: "ca.pem"}}
+	merged := base.Merge(runtimeTypes.ConnectionOpts{Timeout: time.Second, TLS: runtimeTypes.TLSOpts{Cert: "cert.pem", Key: "key.pem"}})
+	expected := runtimeTypes.ConnectionOpts{Endpoint: "tcp://10.0.0.1:2376", Timeout: time.Second, TLS: runtimeTypes.TLSOpts{CACert: "ca.pem", Cert: "cert.pem", Key: "key.pem"}}
+	if merged != expected {
+		t.Errorf("expected %+v, got %+v", expected, merged)
+	}
+	if err := merged.Validate(); err != nil {
+		t.Errorf("unexpected validation error: %v", err)
+	}
+	if err := (runtimeTypes.ConnectionOpts{TLS: runtimeTypes.TLSOpts{Cert: "cert.pem"}}).Validate(); err == nil {
+		t.Error("expected error for client certificate without key")
+	}
+	if err := (runtimeTypes.ConnectionOpts{Timeout: -time.Second}).Validate(); err == nil {
+		t.Error("expected error for negative timeout")
+	}
+}
+
+func TestSelectFromConfig(t *testing.T) {
+	previousRuntime, previousSelection := SelectedRuntime, CurrentSelection
+	t.Cleanup(func() {
+		SelectedRuntime, CurrentSelection = previousRuntime, previousSelection
+		_ = Nerdctl.SetConnectionOpts(runtimeTypes.ConnectionOpts{})
+	})
+	fakeNerdctl(t)
+
+	connections := map[string]runtimeTypes.ConnectionOpts{
+		"nerdctl": {Endpoint: "unix:///tmp/config.sock"},
+	}
+
+	// the config file selects the runtime, if neither flag nor env var did
+	CurrentSelection = Selection{Name: DefaultRuntime, Source: SelectionSourceDefault}
+	if err := SelectFromConfig("nerdctl", connections); err != nil {
+		t.Fatal(err)
+	}
+	if SelectedRuntime != Nerdctl || CurrentSelection.Source != SelectionSourceConfig {
+		t.Errorf("expected nerdctl selected via config, got %s (%s)", SelectedRuntime.ID(), CurrentSelection.Source)
+	}
+	if path := (nerdctl.Nerdctl{}).GetRuntimePath(); path != "/tmp/config.sock" {
+		t.Errorf("expected runtime path from config connection, got %s", path)
+	}
+
+	// connection settings set via flags take precedence over the ones of the config file
+	if err := Select(Selection{Name: "nerdctl", Source: SelectionSourceFlag, Connection: runtimeTypes.ConnectionOpts{Endpoint: "unix:///tmp/flag.sock"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := SelectFromConfig("podman", connections); err != nil {
+		t.Fatal(err)
+	}
+	if SelectedRuntime != Nerdctl || CurrentSelection.Source != SelectionSourceFlag {
+		t.Errorf("expected nerdctl selected via flag to be kept, got %s (%s)", SelectedRuntime.ID(), CurrentSelection.Source)
+	}
+	if path := (nerdctl.Nerdctl{}).GetRuntimePath(); path != "/tmp/flag.sock" {
+		t.Errorf("expected runtime path from flag, got %s", path)
+	}
+
+	if err := SelectFromConfig("", map[string]runtimeTypes.ConnectionOpts{"nerdctl": {Timeout: time.Second}}); err == nil {
+		t.Error("expected error for unsupported connection settings")
+	}
+	if err := Select(Selection{Name: "nonexistent"}); err == nil {
+		t.Error("expected error for unknown runtime")
+	}
+}
+
+func TestSelectPreflight(t *testing.T) {
+	previousRuntime, previousSelection := SelectedRuntime, CurrentSelection
+	t.Cleanup(func() {
+		SelectedRuntime, CurrentSelection = previousRuntime, previousSelection
+	})
+
+	t.Setenv(nerdctl.EnvNerdctlBinary, "")
+	t.Setenv("PATH", t.TempDir())
+	if err := Select(Selection{Name: "nerdctl", Source: SelectionSourceEnv}); !errors.Is(err, nerdctl.ErrNerdctlNotFound) {
+		t.Errorf("expected selecting nerdctl without the binary to fail with '%v', got '%v'", nerdctl.ErrNerdctlNotFound, err)
+	}
+	if SelectedRuntime != previousRuntime {
+		t.Errorf("expected the selected runtime to be kept after a failed preflight check, got %s", SelectedRuntime.ID())
+	}
+
+	fakeNerdctl(t)
+	if err := Select(Selection{Name: "nerdctl", Source: SelectionSourceEnv}); err != nil {
+		t.Errorf("expected selecting nerdctl to succeed, got '%v'", err)
+	}
+
+	// containerd is an alias of nerdctl
+	if err := Select(Selection{Name: "containerd", Source: SelectionSourceFlag}); err != nil {
+		t.Fatalf("expected selecting containerd to succeed, got '%v'", err)
+	}
+	if SelectedRuntime != Nerdctl || CurrentSelection.Name != "nerdctl" {
+		t.Errorf("expected containerd to select the nerdctl runtime, got %s (%s)", SelectedRuntime.ID(), CurrentSelection.Name)
+	}
+}
+
+// fakeNerdctl points the nerdctl runtime to a dummy binary, so that it passes its preflight check
+func fakeNerdctl(t *testing.T) {
+	binary := filepath.Join(t.TempDir(), "nerdctl")
+	if err := os.WriteFile(binary, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(nerdctl.EnvNerdctlBinary, binary)
+}
@@ -21,6 +21,11 @@ THE SOFTWARE.
 */
 package types
 
+import (
+	"fmt"
+	"time"
+)
+
 type RuntimeInfo struct {
 	Name          string `json:"name,omitempty"`
 	Endpoint      string `json:"endpoint,omitempty"`
@@ -37,3 +42,53 @@ type RuntimeInfo struct {
 type NodeLogsOpts struct {
 	Follow bool
 }
+
+// ConnectionOpts are the settings used to connect to the API of a runtime
+type ConnectionOpts struct {
+	Endpoint string        `json:"endpoint,omitempty"` // e.g. unix:///run/podman/podman.sock or tcp://10.0.0.1:2376
+	Timeout  time.Duration `json:"timeout,omitempty"`  // timeout for establishing the connection
+	TLS      TLSOpts       `json:"tls,omitempty"`
+}
+
+// TLSOpts are the paths to the TLS material used to connect to a runtime
+type TLSOpts struct {
+	CACert string `json:"caCert,omitempty"`
+	Cert   string `json:"cert,omitempty"`
+	Key    string `json:"key,omitempty"`
+}
+
+// IsZero checks if no connection settings are set, i.e. the runtime's defaults should be used
+func (o ConnectionOpts) IsZero() bool {
+	return o == ConnectionOpts{}
+}
+
+// Merge returns a copy of the connection settings where all fields that are set in override are replaced
+func (o ConnectionOpts) Merge(override ConnectionOpts) ConnectionOpts {
+	if override.Endpoint != "" {
+		o.Endpoint = override.Endpoint
+	}
+	if override.Timeout != 0 {
+		o.Timeout = override.Timeout
+	}
+	if override.TLS.CACert != "" {
+		o.TLS.CACert = override.TLS.CACert
+	}
+	if override.TLS.Cert != "" {
+		o.TLS.Cert = override.TLS.Cert
+	}
+	if override.TLS.Key != "" {
+		o.TLS.Key = override.TLS.Key
+	}
+	return o
+}
+
+// Validate checks that the TLS material is complete
+func (o ConnectionOpts) Validate() error {
+	if (o.TLS.Cert == "") != (o.TLS.Key == "") {
+		return fmt.Errorf("TLS client certificate and key have to be set together")
+	}
+	if o.Timeout < 0 {
+		return fmt.Errorf("invalid negative timeout %s", o.Timeout)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package types
+
+import (
+	"time"
+
+	"github.com/docker/go-connections/nat"
+)
+
+// ClusterApplyActionType describes what an action of a cluster apply plan does
+type ClusterApplyActionType string
+
+const (
+	ClusterApplyActionAddNode            ClusterApplyActionType = "add"
+	ClusterApplyActionReplaceNode        ClusterApplyActionType = "replace"
+	ClusterApplyActionDeleteNode         ClusterApplyActionType = "delete"
+	ClusterApplyActionUpdateLoadbalancer ClusterApplyActionType = "update-loadbalancer"
+	ClusterApplyActionConnectRegistry    ClusterApplyActionType = "connect-registry"
+	ClusterApplyActionDisconnectRegistry ClusterApplyActionType = "disconnect-registry"
+)
+
+// ClusterApplyPlan is the set of actions needed to bring an existing cluster in line with a cluster config
+type ClusterApplyPlan struct {
+	Cluster string               `json:"cluster"`
+	Actions []ClusterApplyAction `json:"actions"`
+
+	// desired state of the loadbalancer, used to verify it after the nodes were changed
+	LoadbalancerPorts  nat.PortMap         `json:"-"`
+	LoadbalancerConfig *LoadbalancerConfig `json:"-"`
+	LoadbalancerFiles  []File              `json:"-"` // TLS certificates of the HTTP(S) routes
+	Registries         []*Registry         `json:"-"`
+}
+
+// ClusterApplyAction is a single step of a cluster apply plan
+type ClusterApplyAction struct {
+	Type    ClusterApplyActionType `json:"type"`
+	Target  string                 `json:"target"`            // node or registry name
+	Role    Role                   `json:"role,omitempty"`    // role of the target node
+	Changes []string               `json:"changes,omitempty"` // human readable changes ("+ env FOO=bar", "- volume /tmp:/tmp", ...)
+
+	Node *Node `json:"-"` // desired node spec (add/replace) or existing node (delete)
+}
+
+// IsEmpty returns true if the plan doesn't change anything
+func (p *ClusterApplyPlan) IsEmpty() bool {
+	return len(p.Actions) == 0
+}
+
+// ClusterApplyOpts describes a set of options one can set when applying a plan to a cluster
+type ClusterApplyOpts struct {
+	Timeout time.Duration // timeout for each node that's added or replaced
+}
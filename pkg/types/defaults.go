@@ -23,6 +23,7 @@ package types
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/k3d-io/k3d/v5/pkg/types/k3s"
 	"github.com/k3d-io/k3d/v5/version"
@@ -95,5 +96,8 @@ func GetDefaultObjectName(name string) string {
 // This makes sense e.g. when a new server is waiting to join an existing cluster and has to wait for other learners to finish.
 const DefaultNodeWaitForLogMessageCrashLoopBackOffLimit = 10
 
+// DefaultNodeDrainTimeout defines the maximum time to wait for the pods of a node to be evicted before it's replaced or removed
+const DefaultNodeDrainTimeout = 5 * time.Minute
+
 // DefaultNetwork defines the default (Docker) runtime network
 const DefaultRuntimeNetwork = "bridge"
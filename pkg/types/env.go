@@ -26,10 +26,14 @@ const (
 	// Log config
 	K3dEnvLogNodeWaitLogs = "K3D_LOG_NODE_WAIT_LOGS"
 
+	// Runtime
+	K3dEnvRuntime = "K3D_RUNTIME"
+
 	// Images
-	K3dEnvImageLoadbalancer = "K3D_IMAGE_LOADBALANCER"
-	K3dEnvImageTools        = "K3D_IMAGE_TOOLS"
-	K3dEnvImageHelperTag    = "K3D_HELPER_IMAGE_TAG"
+	K3dEnvImageLoadbalancer       = "K3D_IMAGE_LOADBALANCER"
+	K3dEnvImageLoadbalancerNative = "K3D_IMAGE_LOADBALANCER_NATIVE"
+	K3dEnvImageTools              = "K3D_IMAGE_TOOLS"
+	K3dEnvImageHelperTag          = "K3D_HELPER_IMAGE_TAG"
 
 	// Debug options
 	K3dEnvDebugCorednsRetries       = "K3D_DEBUG_COREDNS_RETRIES"
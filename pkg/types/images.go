@@ -36,6 +36,10 @@ const DefaultK3sImageRepo = "docker.io/rancher/k3s"
 // DefaultLBImageRepo defines the default cluster load balancer image
 const DefaultLBImageRepo = "ghcr.io/k3d-io/k3d-proxy"
 
+// DefaultLBNativeImageRepo defines the image of the native loadbalancer, which only contains the k3d binary.
+// It's only used if the running k3d binary can't be copied into the tools image (i.e. it's not a linux binary).
+const DefaultLBNativeImageRepo = "ghcr.io/k3d-io/k3d"
+
 // DefaultToolsImageRepo defines the default image used for the tools container
 const DefaultToolsImageRepo = "ghcr.io/k3d-io/k3d-tools"
 
@@ -45,6 +49,18 @@ const DefaultRegistryImageRepo = "docker.io/library/registry"
 // DefaultRegistryImageTag defines the default image tag used for the k3d-managed registry
 const DefaultRegistryImageTag = "2"
 
+// DefaultRegistryZotImageRepo defines the default image used for k3d-managed registries of kind zot
+const DefaultRegistryZotImageRepo = "ghcr.io/project-zot/zot"
+
+// DefaultRegistryZotImageTag defines the default image tag used for k3d-managed registries of kind zot
+const DefaultRegistryZotImageTag = "v2.1.0"
+
+// DefaultRegistryHarborLiteImageRepo defines the default image used for k3d-managed registries of kind harbor-lite
+const DefaultRegistryHarborLiteImageRepo = "docker.io/goharbor/registry-photon"
+
+// DefaultRegistryHarborLiteImageTag defines the default image tag used for k3d-managed registries of kind harbor-lite
+const DefaultRegistryHarborLiteImageTag = "v2.11.1"
+
 func GetLoadbalancerImage() string {
 	if img := os.Getenv(K3dEnvImageLoadbalancer); img != "" {
 		l.Log().Infof("Loadbalancer image set from env var $%s: %s", K3dEnvImageLoadbalancer, img)
@@ -54,6 +70,16 @@ func GetLoadbalancerImage() string {
 	return fmt.Sprintf("%s:%s", DefaultLBImageRepo, GetHelperImageVersion())
 }
 
+// GetLoadbalancerNativeImage returns the image of the native loadbalancer (see LoadbalancerModeNative)
+func GetLoadbalancerNativeImage() string {
+	if img := os.Getenv(K3dEnvImageLoadbalancerNative); img != "" {
+		l.Log().Infof("Native loadbalancer image set from env var $%s: %s", K3dEnvImageLoadbalancerNative, img)
+		return img
+	}
+
+	return fmt.Sprintf("%s:%s", DefaultLBNativeImageRepo, GetHelperImageVersion())
+}
+
 func GetToolsImage() string {
 	if img := os.Getenv(K3dEnvImageTools); img != "" {
 		l.Log().Infof("Tools image set from env var $%s: %s", K3dEnvImageTools, img)
@@ -50,7 +50,17 @@ var ReadyLogMessagesByRoleAndIntent = map[Role]map[Intent]string{
 	},
 }
 
+// ReadyLogMessagesByRegistryKind overrides the ready log message of registries, which are not of the default kind (distribution)
+var ReadyLogMessagesByRegistryKind = map[RegistryKind]string{
+	RegistryKindZot: "listen",
+}
+
 func GetReadyLogMessage(node *Node, intent Intent) string {
+	if node.Role == RegistryRole {
+		if msg, ok := ReadyLogMessagesByRegistryKind[node.RegistryKind()]; ok {
+			return msg
+		}
+	}
 	role := node.Role
 	if node.Role == ServerRole && node.ServerOpts.IsInit {
 		role = Role(InternalRoleInitServer)
@@ -24,6 +24,9 @@ package types
 /* DESCRIPTION
  * The Loadbalancer is a customized NGINX container running side-by-side with the cluster, NOT INSIDE IT.
  * It is used to do plain proxying of tcp/udp ports to the k3d node containers.
+ * Additionally, it can route HTTP(S) requests by hostname and path (optionally terminating TLS).
+ * Next to the server loadbalancer, which also proxies the Kubernetes API, a cluster can have named loadbalancers (e.g. for ingress).
+ * Instead of NGINX, the loadbalancers can run the k3d binary itself as a plain tcp/udp proxy (LoadbalancerModeNative, see pkg/loadbalancer).
  * One advantage of this approach is, that we can add new ports while the cluster is still running by re-creating
  * the loadbalancer and adding the new port config in the NGINX config. As the loadbalancer doesn't hold any state
  * (apart from the config file), it can easily be re-created in just a few seconds.
@@ -66,37 +69,164 @@ func NewLoadbalancer() *Loadbalancer {
  * 	4321.udp:
  * 		- k3d-k3s-default-agent-0
  * 		- k3d-k3s-default-agent-1
+ * http:
+ * 	- host: app.localhost
+ * 		listen: 443
+ * 		tls:
+ * 			certificate: /etc/nginx/certs/app.localhost.443.crt
+ * 			key: /etc/nginx/certs/app.localhost.443.key
+ * 		routes:
+ * 			- path: /
+ * 				port: 80
+ * 				nodes:
+ * 					- k3d-k3s-default-agent-0
+ * settings:
+ * 	workerConnections: 1024
+ * 	upstreams:
+ * 		4321.udp:
+ * 			k3d-k3s-default-agent-1:
+ * 				weight: 2
+ * 				down: true
+ * 	portOptions:
+ * 		1234.tcp:
+ * 			proxyProtocol: true
  */
 type LoadbalancerConfig struct {
-	Ports    map[string][]string  `json:"ports"`
-	Settings LoadBalancerSettings `json:"settings"`
+	Ports    map[string][]string      `json:"ports"`
+	HTTP     []LoadbalancerHTTPServer `json:"http,omitempty"`
+	Settings LoadBalancerSettings     `json:"settings"`
+}
+
+// LoadbalancerHTTPServer serves HTTP(S) requests for a hostname on a port of the loadbalancer
+type LoadbalancerHTTPServer struct {
+	Host   string                  `json:"host"`
+	Listen int                     `json:"listen"`
+	TLS    *LoadbalancerHTTPTLS    `json:"tls,omitempty"`
+	Routes []LoadbalancerHTTPRoute `json:"routes"`
+}
+
+// LoadbalancerHTTPTLS references the certificate (and its key) inside the loadbalancer container used to terminate TLS
+type LoadbalancerHTTPTLS struct {
+	Certificate string `json:"certificate"`
+	Key         string `json:"key"`
+}
+
+// LoadbalancerHTTPRoute proxies requests with a path prefix to a port on a set of nodes
+type LoadbalancerHTTPRoute struct {
+	Path  string   `json:"path"`
+	Port  int      `json:"port"`
+	Nodes []string `json:"nodes"`
 }
 
 type LoadBalancerSettings struct {
-	WorkerConnections   int `json:"workerConnections"`
-	DefaultProxyTimeout int `json:"defaultProxyTimeout,omitempty"`
+	WorkerConnections   int                                               `json:"workerConnections"`
+	DefaultProxyTimeout int                                               `json:"defaultProxyTimeout,omitempty"`
+	Upstreams           map[string]map[string]LoadbalancerUpstreamOptions `json:"upstreams,omitempty"`   // loadbalancer port (e.g. 80.tcp) -> target node -> options
+	PortOptions         map[string]LoadbalancerPortOptions                `json:"portOptions,omitempty"` // loadbalancer port (e.g. 443.tcp) -> options
+	HealthCheck         *LoadbalancerHealthCheck                          `json:"healthCheck,omitempty"` // active health checks (native mode only)
+}
+
+// LoadbalancerHealthCheck configures the active health checks of the native loadbalancer,
+// which probe the targets of its tcp ports in the background (in addition to the passive checks, see LoadbalancerUpstreamOptions)
+type LoadbalancerHealthCheck struct {
+	Interval  string `json:"interval,omitempty"`  // time between two probes of a target, default: 5s, 0 disables the active health checks
+	Threshold int    `json:"threshold,omitempty"` // consecutive failed (successful) probes to take a target out of (back into) rotation, default: 3
+}
+
+// LoadbalancerPortOptions tune how the loadbalancer proxies one of its (plain tcp/udp) ports
+type LoadbalancerPortOptions struct {
+	ProxyProtocol bool `json:"proxyProtocol,omitempty"` // send the PROXY protocol header to the targets, so they see the client's address (tcp only)
+}
+
+// LoadbalancerUpstreamOptions tune how the loadbalancer uses a target node of one of its ports.
+// HTTP(S) routes use the options of the port they're served on.
+type LoadbalancerUpstreamOptions struct {
+	Weight      int    `json:"weight,omitempty"`      // default: 1
+	Backup      bool   `json:"backup,omitempty"`      // only used if all other targets are unavailable
+	MaxFails    *int   `json:"maxFails,omitempty"`    // default: 1, 0 disables failure accounting
+	FailTimeout string `json:"failTimeout,omitempty"` // default: 10s
+	Down        bool   `json:"down,omitempty"`        // drained, i.e. taken out of rotation
 }
 
 const (
 	DefaultLoadbalancerConfigPath        = "/etc/confd/values.yaml"
 	DefaultLoadbalancerWorkerConnections = 1024
+	DefaultLoadbalancerHTTPPort          = 80
+	DefaultLoadbalancerHTTPSPort         = 443
+	DefaultLoadbalancerCertsPath         = "/etc/nginx/certs"
+	DefaultLoadbalancerUpstreamMaxFails  = 1
+	DefaultLoadbalancerUpstreamTimeout   = "10s"
+	DefaultLoadbalancerHealthInterval    = "5s"
+	DefaultLoadbalancerHealthThreshold   = 3
+	DefaultLoadbalancerStatusPort        = 18090 // nginx status endpoint, only listening on localhost inside the loadbalancer (see proxy/templates/nginx.tmpl)
+	MaxLoadbalancerPorts                 = 500   // proxied ports per loadbalancer, as nginx gets a server (and listening socket) per port, even within port ranges
+)
+
+// LoadbalancerStats are the connection counters of the loadbalancer (see nginx' stub_status), counting both proxied ports and HTTP(S) routes
+type LoadbalancerStats struct {
+	Active   int64 `json:"active"`   // open client connections
+	Accepted int64 `json:"accepted"` // accepted client connections since the (re)start
+	Handled  int64 `json:"handled"`  // handled connections, lower than accepted if some hit a limit (e.g. workerConnections)
+	Requests int64 `json:"requests"` // HTTP requests
+	Reading  int64 `json:"reading"`  // connections where the request header is read
+	Writing  int64 `json:"writing"`  // connections where the response is written (incl. proxied streams)
+	Waiting  int64 `json:"waiting"`  // idle keepalive connections
+}
+
+// LoadbalancerMode selects the implementation of the loadbalancer
+type LoadbalancerMode string
+
+const (
+	LoadbalancerModeNginx  LoadbalancerMode = "nginx"  // the k3d-proxy image (nginx rendered by confd), default
+	LoadbalancerModeNative LoadbalancerMode = "native" // the L4 proxy of the k3d binary itself (`k3d proxy`), without HTTP(S) routes
+)
+
+// LoadbalancerModes lists the supported loadbalancer modes
+var LoadbalancerModes = []LoadbalancerMode{LoadbalancerModeNginx, LoadbalancerModeNative}
+
+const (
+	DefaultLoadbalancerNativeBinary = "/bin/k3d" // path of the k3d binary in the native loadbalancer (copied into the tools image or part of the native loadbalancer image)
 )
 
 type LoadbalancerCreateOpts struct {
 	Labels          map[string]string
 	ConfigOverrides []string
+	Mode            LoadbalancerMode
 }
 
 /*
  * Helper Functions
  */
 
-// HasLoadBalancer returns true if cluster has a loadbalancer node
+// HasLoadBalancer returns true if cluster has a server loadbalancer node
 func (c *Cluster) HasLoadBalancer() bool {
 	for _, node := range c.Nodes {
-		if node.Role == LoadBalancerRole {
+		if node.IsServerLoadBalancer() {
 			return true
 		}
 	}
 	return false
 }
+
+// GetLoadbalancer returns the named loadbalancer of the cluster or nil, if it doesn't have one with that name
+func (c *Cluster) GetLoadbalancer(name string) *Loadbalancer {
+	for _, lb := range c.Loadbalancers {
+		if lb.Node != nil && lb.Node.RuntimeLabels[LabelLoadbalancerName] == name {
+			return lb
+		}
+	}
+	return nil
+}
+
+// LoadbalancerMode returns the mode of the loadbalancer node (see LabelLoadbalancerMode)
+func (node *Node) LoadbalancerMode() LoadbalancerMode {
+	if mode := node.RuntimeLabels[LabelLoadbalancerMode]; mode != "" {
+		return LoadbalancerMode(mode)
+	}
+	return LoadbalancerModeNginx
+}
+
+// IsServerLoadBalancer returns true if the node is the server loadbalancer of its cluster (and not a named loadbalancer)
+func (node *Node) IsServerLoadBalancer() bool {
+	return node.Role == LoadBalancerRole && node.RuntimeLabels[LabelLoadbalancerName] == ""
+}
@@ -28,21 +28,76 @@ const (
 	DefaultRegistriesFilePath = "/etc/rancher/k3s/registries.yaml"
 	DefaultRegistryMountPath  = "/var/lib/registry"
 	DefaultDockerHubAddress   = "registry-1.docker.io"
+	DefaultRegistryCertsPath  = "/etc/docker/registry/certs" // TLS certificate, key and CA inside TLS-enabled registries
+	DefaultRegistryNodeCAPath = "/etc/ssl/certs"             // trust store of the k3s nodes, where the CAs of TLS-enabled registries are added
+	DefaultRegistryAuthPath   = "/etc/docker/registry/auth"  // htpasswd file and credentials inside registries with authentication
+	DefaultRegistryConfigPath = "/etc/docker/registry/config.yml"
+	// Name of the file describing the registry inside an archive written by `k3d registry export`
+	RegistryArchiveManifestName = "registry.yaml"
 	// Default temporary path for the LocalRegistryHosting configmap, from where it will be applied via kubectl
 	DefaultLocalRegistryHostingConfigmapTempPath = "/tmp/localRegistryHostingCM.yaml"
 )
 
+// RegistryKind selects the implementation of a registry
+type RegistryKind string
+
+const (
+	RegistryKindDistribution RegistryKind = "distribution" // CNCF distribution (registry:2), default
+	RegistryKindZot          RegistryKind = "zot"          // zot, an OCI-native registry supporting artifacts and referrers
+	RegistryKindHarborLite   RegistryKind = "harbor-lite"  // the registry component of Harbor (goharbor/registry-photon), without the other Harbor services
+)
+
+// RegistryKinds lists the supported registry kinds
+var RegistryKinds = []RegistryKind{RegistryKindDistribution, RegistryKindZot, RegistryKindHarborLite}
+
 type RegistryOptions struct {
+	Kind             RegistryKind  `json:"kind,omitempty"` // default: distribution
 	ConfigFile       string        `json:"configFile,omitempty"`
 	Proxy            RegistryProxy `json:"proxy,omitempty"`
 	DeleteEnabled    bool          `json:"deleteEnabled,omitempty"`
 	EnforcePortMatch bool          `json:"enforcePortMatch,omitempty"`
+	TLS              bool          `json:"tls,omitempty"` // serve via https with a certificate signed by a generated CA
+	Auth             RegistryAuth  `json:"auth,omitempty"`
+}
+
+// RegistryAuth are the credentials required to access a registry (htpasswd authentication)
+type RegistryAuth struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
 }
 
 type RegistryProxy struct {
-	RemoteURL string `json:"remoteURL"`
-	Username  string `json:"username,omitempty"`
-	Password  string `json:"password,omitempty"`
+	RemoteURL    string `json:"remoteURL"`
+	Username     string `json:"username,omitempty"`
+	Password     string `json:"password,omitempty"`
+	PasswordFile string `json:"passwordFile,omitempty"` // read the password from this file on creation (not stored in the config)
+	PasswordEnv  string `json:"passwordEnv,omitempty"`  // read the password from this environment variable on creation (not stored in the config)
+}
+
+// RegistryGarbageCollectOpts describes a set of options for running the garbage collector of a registry
+type RegistryGarbageCollectOpts struct {
+	DeleteUntagged bool // also delete manifests that are not referenced by any tag
+	DryRun         bool // only print what would be deleted
+}
+
+// RegistryExportOpts describes a set of options for exporting a registry to an archive
+type RegistryExportOpts struct {
+	IncludeCredentials bool // also write the password of a registry with authentication to the archive (in plain text)
+}
+
+// RegistryImportOpts describes a set of options for importing a registry from an archive
+type RegistryImportOpts struct {
+	Name         string        // name of the new registry (default: name of the exported registry)
+	ExposureOpts *ExposureOpts // port of the new registry (default: port of the exported registry)
+	Auth         *RegistryAuth // credentials of the new registry (default: credentials in the archive, required if it only contains the username)
+}
+
+// RegistryKind returns the kind of the registry node (see LabelRegistryKind)
+func (node *Node) RegistryKind() RegistryKind {
+	if kind := node.RuntimeLabels[LabelRegistryKind]; kind != "" {
+		return RegistryKind(kind)
+	}
+	return RegistryKindDistribution
 }
 
 // Registry describes a k3d-managed registry
@@ -0,0 +1,110 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package types
+
+import (
+	"time"
+
+	"github.com/docker/go-connections/nat"
+)
+
+// ClusterSnapshotManifestName is the name of the manifest file inside a cluster snapshot archive
+const ClusterSnapshotManifestName = "snapshot.yaml"
+
+// ClusterSnapshotDatastore describes how the k3s datastore of a cluster was captured
+type ClusterSnapshotDatastore string
+
+const (
+	ClusterSnapshotDatastoreSQLite   ClusterSnapshotDatastore = "sqlite"   // the SQLite database files of the single server
+	ClusterSnapshotDatastoreEtcd     ClusterSnapshotDatastore = "etcd"     // an etcd snapshot taken on a server node
+	ClusterSnapshotDatastoreExternal ClusterSnapshotDatastore = "external" // external datastore (--datastore-endpoint), not captured
+)
+
+// ClusterSnapshot is the manifest of a cluster snapshot archive, describing everything needed to recreate the cluster
+type ClusterSnapshot struct {
+	K3dVersion    string                        `json:"k3dVersion"`
+	Created       time.Time                     `json:"created"`
+	Name          string                        `json:"name"`
+	Token         string                        `json:"token"`
+	Network       ClusterSnapshotNetwork        `json:"network"`
+	KubeAPI       ClusterSnapshotKubeAPI        `json:"kubeAPI"`
+	Datastore     ClusterSnapshotDatastore      `json:"datastore"`
+	DatastoreNode string                        `json:"datastoreNode,omitempty"` // server node that the datastore was captured from and will be restored to
+	ImageVolume   bool                          `json:"imageVolume"`
+	HostAliases   []HostAlias                   `json:"hostAliases,omitempty"`
+	Registries    []string                      `json:"registries,omitempty"` // names of the registries connected to the cluster network
+	Loadbalancer  *ClusterSnapshotLoadbalancer  `json:"loadbalancer,omitempty"`
+	Loadbalancers []ClusterSnapshotLoadbalancer `json:"loadbalancers,omitempty"` // named loadbalancers
+	Nodes         []ClusterSnapshotNode         `json:"nodes"`
+}
+
+// ClusterSnapshotNetwork describes the cluster network
+type ClusterSnapshotNetwork struct {
+	Name     string `json:"name"`
+	External bool   `json:"external,omitempty"`
+	Managed  bool   `json:"managed,omitempty"` // k3d-managed IPAM (static server IPs)
+	Subnet   string `json:"subnet,omitempty"`
+}
+
+// ClusterSnapshotKubeAPI describes how the Kubernetes API is exposed
+type ClusterSnapshotKubeAPI struct {
+	Host     string `json:"host,omitempty"`
+	HostIP   string `json:"hostIP,omitempty"`
+	HostPort string `json:"hostPort,omitempty"`
+}
+
+// ClusterSnapshotLoadbalancer describes the server loadbalancer or a named loadbalancer
+type ClusterSnapshotLoadbalancer struct {
+	Name   string             `json:"name,omitempty"` // empty for the server loadbalancer
+	Mode   LoadbalancerMode   `json:"mode,omitempty"` // empty for nginx
+	Image  string             `json:"image"`
+	Ports  nat.PortMap        `json:"ports,omitempty"`
+	Config LoadbalancerConfig `json:"config"`
+}
+
+// ClusterSnapshotNode describes a k3s node, stripped of everything that k3d generates during cluster creation
+type ClusterSnapshotNode struct {
+	Name          string            `json:"name"`
+	Role          Role              `json:"role"`
+	Image         string            `json:"image"`
+	IsInit        bool              `json:"isInit,omitempty"`
+	Args          []string          `json:"args,omitempty"`
+	Env           []string          `json:"env,omitempty"`
+	Volumes       []string          `json:"volumes,omitempty"`
+	Ports         nat.PortMap       `json:"ports,omitempty"`
+	RuntimeLabels map[string]string `json:"runtimeLabels,omitempty"` // labels set by the user, without the ones k3d generates
+	Memory        string            `json:"memory,omitempty"`
+	CPUs          string            `json:"cpus,omitempty"`
+	CPUSet        string            `json:"cpuset,omitempty"`
+	Files         []string          `json:"files,omitempty"` // files captured from the node, restored before it's started
+}
+
+// ClusterSnapshotOpts describes a set of options one can set when taking a snapshot of a cluster
+type ClusterSnapshotOpts struct {
+	IncludeImages bool // include the contents of the image volume
+}
+
+// ClusterRestoreOpts describes a set of options one can set when restoring a cluster from a snapshot
+type ClusterRestoreOpts struct {
+	WaitForServer bool
+	Timeout       time.Duration
+}
@@ -92,11 +92,20 @@ const (
 	LabelServerAPIHostIP         string = "k3d.server.api.hostIP"
 	LabelServerIsInit            string = "k3d.server.init"
 	LabelServerLoadBalancer      string = "k3d.server.loadbalancer"
+	LabelLoadbalancerName        string = "k3d.loadbalancer.name"
+	LabelLoadbalancerMode        string = "k3d.loadbalancer.mode"
+	LabelLoadbalancerCopyBinary  string = "k3d.loadbalancer.copyBinary"
 	LabelRegistryHost            string = "k3d.registry.host"
 	LabelRegistryHostIP          string = "k3d.registry.hostIP"
 	LabelRegistryPortExternal    string = "k3s.registry.port.external"
 	LabelRegistryPortInternal    string = "k3s.registry.port.internal"
+	LabelRegistryProtocol        string = "k3d.registry.protocol"
+	LabelRegistryAuth            string = "k3d.registry.auth"
+	LabelRegistryKind            string = "k3d.registry.kind"
+	LabelRegistryOptions         string = "k3d.registry.options"
+	LabelRegistryVolume          string = "k3d.registry.volume"
 	LabelNodeStaticIP            string = "k3d.node.staticIP"
+	LabelNodeUserLabels          string = "k3d.node.labels"
 )
 
 // DoNotCopyServerFlags defines a list of commands/args that shouldn't be copied from an existing node when adding a similar node to a cluster
@@ -118,14 +127,17 @@ type ClusterCreateOpts struct {
 	GPURequest          string            `json:"gpuRequest,omitempty"`
 	ServersMemory       string            `json:"serversMemory,omitempty"`
 	AgentsMemory        string            `json:"agentsMemory,omitempty"`
+	ServersCPUs         string            `json:"serversCpus,omitempty"`
+	AgentsCPUs          string            `json:"agentsCpus,omitempty"`
 	NodeHooks           []NodeHook        `json:"nodeHooks,omitempty"`
 	GlobalLabels        map[string]string `json:"globalLabels,omitempty"`
 	GlobalEnv           []string          `json:"globalEnv,omitempty"`
 	HostAliases         []HostAlias       `json:"hostAliases,omitempty"`
 	Registries          struct {
-		Create *Registry         `json:"create,omitempty"`
-		Use    []*Registry       `json:"use,omitempty"`
-		Config *wharfie.Registry `json:"config,omitempty"` // registries.yaml (k3s config for containerd registry override)
+		Create  *Registry         `json:"create,omitempty"`
+		Mirrors []*Registry       `json:"mirrors,omitempty"` // pull-through caches, one per upstream registry
+		Use     []*Registry       `json:"use,omitempty"`
+		Config  *wharfie.Registry `json:"config,omitempty"` // registries.yaml (k3s config for containerd registry override)
 	} `json:"registries,omitempty"`
 }
 
@@ -159,6 +171,21 @@ type ClusterDeleteOpts struct {
 	SkipRegistryCheck bool // skip checking if this is a registry (and act accordingly)
 }
 
+// ClusterScaleOpts describe the number of nodes per role that a cluster should be scaled to.
+// Roles without a number (nil) are left untouched.
+type ClusterScaleOpts struct {
+	Servers *int
+	Agents  *int
+}
+
+// ClusterUpgradeOpts describe a set of options one can set when upgrading the nodes of a cluster to a new image
+type ClusterUpgradeOpts struct {
+	Image        string
+	Timeout      time.Duration // timeout for each node to come up and get ready
+	DrainTimeout time.Duration // timeout for evicting the pods of each node
+	SkipDrain    bool          // don't cordon and drain nodes via the Kubernetes API before replacing them
+}
+
 // NodeCreateOpts describes a set of options one can set when creating a new node
 type NodeCreateOpts struct {
 	Wait            bool
@@ -180,7 +207,15 @@ type NodeStartOpts struct {
 
 // NodeDeleteOpts describes a set of options one can set when deleting a node
 type NodeDeleteOpts struct {
-	SkipLBUpdate bool // skip updating the loadbalancer
+	SkipLBUpdate         bool // skip updating the loadbalancer
+	DeleteRegistryVolume bool // delete the data volume of a registry as well (kept by default, so a re-created registry finds its data again)
+}
+
+// NodeReplaceOpts describes a set of options one can set when replacing a node
+type NodeReplaceOpts struct {
+	EnvironmentInfo *EnvironmentInfo // required to start k3s nodes if the DNS fix is enabled
+	Timeout         time.Duration    // timeout for the new node to get ready, before rolling back to the old node
+	KeepOldNode     bool             // keep the old node (renamed and stopped) after the replacement, so that the caller can still roll back to it
 }
 
 // NodeHookAction is an interface to implement actions that should trigger at specific points of the node lifecycle
@@ -243,6 +278,7 @@ type Cluster struct {
 	ExternalDatastore  *ExternalDatastore `json:"externalDatastore,omitempty"`
 	KubeAPI            *ExposureOpts      `json:"kubeAPI,omitempty"`
 	ServerLoadBalancer *Loadbalancer      `json:"serverLoadBalancer,omitempty"`
+	Loadbalancers      []*Loadbalancer    `json:"loadbalancers,omitempty"` // named loadbalancers next to the server loadbalancer
 	ImageVolume        string             `json:"imageVolume,omitempty"`
 	Volumes            []string           `json:"volumes,omitempty"` // k3d-managed volumes attached to this cluster
 }
@@ -305,6 +341,8 @@ type Node struct {
 	AgentOpts      AgentOpts             `json:"agentOpts,omitempty"`
 	GPURequest     string                // filled automatically
 	Memory         string                // filled automatically
+	CPUs           string                `json:"cpus,omitempty"`   // number of CPUs the node may use (fractional)
+	CPUSet         string                `json:"cpuset,omitempty"` // CPUs the node is pinned to (e.g. 0-3,5)
 	State          NodeState             // filled automatically
 	IP             NodeIP                // filled automatically -> refers solely to the cluster network
 	HookActions    []NodeHook            `json:"hooks,omitempty"`
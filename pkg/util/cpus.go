@@ -0,0 +1,78 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package util
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// ParseCPUs parses a (fractional) number of CPUs (e.g. 1.5) into units of 10^-9 CPUs, as used by container runtimes
+func ParseCPUs(value string) (int64, error) {
+	cpus, ok := new(big.Rat).SetString(value)
+	if !ok {
+		return 0, fmt.Errorf("failed to parse '%s' as a rational number", value)
+	}
+	nano := cpus.Mul(cpus, big.NewRat(1e9, 1))
+	if !nano.IsInt() {
+		return 0, fmt.Errorf("value '%s' is too precise", value)
+	}
+	if nano.Sign() <= 0 {
+		return 0, fmt.Errorf("value '%s' must be greater than zero", value)
+	}
+	return nano.Num().Int64(), nil
+}
+
+// FormatCPUs formats units of 10^-9 CPUs as a number of CPUs (no limit results in an empty string)
+func FormatCPUs(nanoCPUs int64) string {
+	if nanoCPUs <= 0 {
+		return ""
+	}
+	return strconv.FormatFloat(float64(nanoCPUs)/1e9, 'f', -1, 64)
+}
+
+// ValidateCPUSet checks if a cpuset is a list of CPUs and CPU ranges (e.g. 0-3,5)
+func ValidateCPUSet(cpuset string) error {
+	if cpuset == "" {
+		return fmt.Errorf("empty cpuset")
+	}
+	for _, part := range strings.Split(cpuset, ",") {
+		bounds := strings.SplitN(part, "-", 2)
+		start, err := strconv.ParseUint(bounds[0], 10, 16)
+		if err != nil {
+			return fmt.Errorf("invalid CPU '%s' in cpuset '%s'", bounds[0], cpuset)
+		}
+		if len(bounds) == 1 {
+			continue
+		}
+		end, err := strconv.ParseUint(bounds[1], 10, 16)
+		if err != nil {
+			return fmt.Errorf("invalid CPU '%s' in cpuset '%s'", bounds[1], cpuset)
+		}
+		if end < start {
+			return fmt.Errorf("invalid CPU range '%s' in cpuset '%s'", part, cpuset)
+		}
+	}
+	return nil
+}
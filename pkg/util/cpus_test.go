@@ -0,0 +1,64 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package util
+
+import (
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestParseCPUs(t *testing.T) {
+	testSets := map[string]struct {
+		value    string
+		expected int64
+		fail     bool
+	}{
+		"integer":      {value: "2", expected: 2e9},
+		"fractional":   {value: "0.5", expected: 5e8},
+		"too precise":  {value: "0.0000000001", fail: true},
+		"zero":         {value: "0", fail: true},
+		"negative":     {value: "-1", fail: true},
+		"not a number": {value: "two", fail: true},
+	}
+	for name, testSet := range testSets {
+		t.Run(name, func(t *testing.T) {
+			actual, err := ParseCPUs(testSet.value)
+			if testSet.fail {
+				assert.Assert(t, err != nil)
+				return
+			}
+			assert.NilError(t, err)
+			assert.Equal(t, testSet.expected, actual)
+			assert.Equal(t, testSet.value, FormatCPUs(actual))
+		})
+	}
+}
+
+func TestValidateCPUSet(t *testing.T) {
+	for _, valid := range []string{"0", "0-3", "0,2", "0-1,4-7"} {
+		assert.NilError(t, ValidateCPUSet(valid), valid)
+	}
+	for _, invalid := range []string{"", "a", "0-", "3-1", "0,,1", "-1"} {
+		assert.Assert(t, ValidateCPUSet(invalid) != nil, invalid)
+	}
+}
@@ -119,7 +119,7 @@ func FilterNodes(nodes []*k3d.Node, filters []string) ([]*k3d.Node, error) {
 			serverNodes = append(serverNodes, node)
 		} else if node.Role == k3d.AgentRole {
 			agentNodes = append(agentNodes, node)
-		} else if node.Role == k3d.LoadBalancerRole {
+		} else if node.IsServerLoadBalancer() {
 			serverlb = node
 		}
 	}
@@ -0,0 +1,263 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package proxy
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// KVPair is a key and its value, as returned by the get and gets template functions
+type KVPair struct {
+	Key   string
+	Value string
+}
+
+// RenderNginxConfig renders NginxTemplate from the given values (keyed like confd's file backend, e.g. /ports/80.tcp/0),
+// the same way confd does in the k3d-proxy image
+func RenderNginxConfig(values map[string]string) ([]byte, error) {
+	tmpl, err := template.New("nginx.tmpl").Funcs(TemplateFuncs(values)).Parse(NginxTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse loadbalancer template: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, nil); err != nil {
+		return nil, fmt.Errorf("failed to render loadbalancer template: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// TemplateFuncs returns the template functions of the confd release installed in the k3d-proxy image (see install-confd.sh),
+// with the key-value functions (exists, get, getv, ls, ...) reading from the given values.
+// confd is a standalone binary that doesn't export its function map, so this is the one place outside of the image that provides it.
+// Only the DNS lookup functions are left out, as a rendered config must not depend on the host it's rendered on.
+func TemplateFuncs(values map[string]string) template.FuncMap {
+	store := templateStore(values)
+	return template.FuncMap{
+		// key-value store
+		"exists": store.exists,
+		"get":    store.get,
+		"gets":   store.gets,
+		"getv":   store.getv,
+		"getvs":  store.getvs,
+		"ls":     store.ls,
+		"lsdir":  store.lsdir,
+
+		// generic functions
+		"base":         path.Base,
+		"dir":          path.Dir,
+		"split":        strings.Split,
+		"join":         strings.Join,
+		"toUpper":      strings.ToUpper,
+		"toLower":      strings.ToLower,
+		"contains":     strings.Contains,
+		"replace":      strings.Replace,
+		"trimSuffix":   strings.TrimSuffix,
+		"datetime":     time.Now,
+		"parseBool":    strconv.ParseBool,
+		"atoi":         strconv.Atoi,
+		"getenv":       templateGetenv,
+		"fileExists":   templateFileExists,
+		"json":         templateJSONObject,
+		"jsonArray":    templateJSONArray,
+		"map":          templateMap,
+		"base64Encode": templateBase64Encode,
+		"base64Decode": templateBase64Decode,
+		"reverse":      templateReverse,
+		"sortByLength": templateSortByLength,
+		"seq":          templateSeq,
+		"add":          func(a, b int) int { return a + b },
+		"sub":          func(a, b int) int { return a - b },
+		"div":          func(a, b int) int { return a / b },
+		"mod":          func(a, b int) int { return a % b },
+		"mul":          func(a, b int) int { return a * b },
+	}
+}
+
+// templateStore is an in-memory version of confd's key-value store
+type templateStore map[string]string
+
+func (s templateStore) exists(key string) bool {
+	_, ok := s[key]
+	return ok
+}
+
+func (s templateStore) get(key string) (KVPair, error) {
+	value, ok := s[key]
+	if !ok {
+		return KVPair{}, fmt.Errorf("key does not exist: %s", key)
+	}
+	return KVPair{Key: key, Value: value}, nil
+}
+
+func (s templateStore) gets(pattern string) ([]KVPair, error) {
+	pairs := []KVPair{}
+	for key, value := range s {
+		matched, err := path.Match(pattern, key)
+		if err != nil {
+			return nil, err
+		}
+		if matched {
+			pairs = append(pairs, KVPair{Key: key, Value: value})
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].Key < pairs[j].Key })
+	return pairs, nil
+}
+
+func (s templateStore) getv(key string, defaultValue ...string) (string, error) {
+	if value, ok := s[key]; ok {
+		return value, nil
+	}
+	if len(defaultValue) > 0 {
+		return defaultValue[0], nil
+	}
+	return "", fmt.Errorf("key does not exist: %s", key)
+}
+
+func (s templateStore) getvs(pattern string) ([]string, error) {
+	pairs, err := s.gets(pattern)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]string, 0, len(pairs))
+	for _, pair := range pairs {
+		values = append(values, pair.Value)
+	}
+	sort.Strings(values)
+	return values, nil
+}
+
+func (s templateStore) ls(dir string) []string {
+	return s.children(dir, false)
+}
+
+func (s templateStore) lsdir(dir string) []string {
+	return s.children(dir, true)
+}
+
+// children returns the sorted names of the keys and directories (or only the directories) directly below dir
+func (s templateStore) children(dir string, onlyDirs bool) []string {
+	names := map[string]bool{}
+	prefix := strings.TrimSuffix(dir, "/") + "/"
+	for key := range s {
+		rest, ok := strings.CutPrefix(key, prefix)
+		if !ok {
+			continue
+		}
+		name, _, isDir := strings.Cut(rest, "/")
+		if isDir || !onlyDirs {
+			names[name] = true
+		}
+	}
+	result := make([]string, 0, len(names))
+	for name := range names {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func templateGetenv(key string, defaultValue ...string) string {
+	if value := os.Getenv(key); value != "" || len(defaultValue) == 0 {
+		return value
+	}
+	return defaultValue[0]
+}
+
+func templateFileExists(filepath string) bool {
+	_, err := os.Stat(filepath)
+	return err == nil
+}
+
+func templateJSONObject(data string) (map[string]interface{}, error) {
+	var result map[string]interface{}
+	err := json.Unmarshal([]byte(data), &result)
+	return result, err
+}
+
+func templateJSONArray(data string) ([]interface{}, error) {
+	var result []interface{}
+	err := json.Unmarshal([]byte(data), &result)
+	return result, err
+}
+
+func templateMap(values ...interface{}) (map[string]interface{}, error) {
+	if len(values)%2 != 0 {
+		return nil, fmt.Errorf("map requires an even number of arguments")
+	}
+	result := make(map[string]interface{}, len(values)/2)
+	for i := 0; i < len(values); i += 2 {
+		key, ok := values[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("map keys must be strings")
+		}
+		result[key] = values[i+1]
+	}
+	return result, nil
+}
+
+func templateBase64Encode(data string) string {
+	return base64.StdEncoding.EncodeToString([]byte(data))
+}
+
+func templateBase64Decode(data string) (string, error) {
+	decoded, err := base64.StdEncoding.DecodeString(data)
+	return string(decoded), err
+}
+
+func templateReverse(values interface{}) interface{} {
+	switch v := values.(type) {
+	case []string:
+		for i, j := 0, len(v)-1; i < j; i, j = i+1, j-1 {
+			v[i], v[j] = v[j], v[i]
+		}
+	case []KVPair:
+		for i, j := 0, len(v)-1; i < j; i, j = i+1, j-1 {
+			v[i], v[j] = v[j], v[i]
+		}
+	}
+	return values
+}
+
+func templateSortByLength(values []string) []string {
+	sort.SliceStable(values, func(i, j int) bool { return len(values[i]) < len(values[j]) })
+	return values
+}
+
+func templateSeq(first, last int) []int {
+	result := []int{}
+	for i := first; i <= last; i++ {
+		result = append(result, i)
+	}
+	return result
+}
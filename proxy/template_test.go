@@ -0,0 +1,64 @@
+/*
+Copyright © 2020-2023 The k3d Author(s)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package proxy
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestTemplateFuncsKeyValueStore(t *testing.T) {
+	values := map[string]string{
+		"/ports/80.tcp/0":                    "k3d-test-agent-1",
+		"/ports/80.tcp/1":                    "k3d-test-agent-0",
+		"/ports/6443.tcp/0":                  "k3d-test-server-0",
+		"/settings/workerConnections":        "1024",
+		"/settings/upstreams/80.tcp/a/down":  "true",
+		"/settings/upstreams/80.tcp/a/other": "x",
+	}
+
+	tmpl := `{{ lsdir "/ports" }} {{ ls "/settings" }} {{ getvs "/ports/80.tcp/*" }} {{ getv "/missing" "default" }} ` +
+		`{{ range gets "/ports/80.tcp/*" }}{{ .Key }}={{ .Value }} {{ end }}{{ exists "/settings/workerConnections" }} {{ add 1 2 }}`
+	parsed, err := template.New("test").Funcs(TemplateFuncs(values)).Parse(tmpl)
+	if err != nil {
+		t.Fatalf("failed to parse template: %v", err)
+	}
+	var rendered strings.Builder
+	if err := parsed.Execute(&rendered, nil); err != nil {
+		t.Fatalf("failed to render template: %v", err)
+	}
+	expected := "[6443.tcp 80.tcp] [upstreams workerConnections] [k3d-test-agent-0 k3d-test-agent-1] default " +
+		"/ports/80.tcp/0=k3d-test-agent-1 /ports/80.tcp/1=k3d-test-agent-0 true 3"
+	if rendered.String() != expected {
+		t.Errorf("expected '%s', got '%s'", expected, rendered.String())
+	}
+
+	if _, err := templateStore(values).getv("/missing"); err == nil {
+		t.Errorf("expected an error for a missing key without default")
+	}
+	if dirs := templateStore(values).lsdir("/settings/upstreams/80.tcp/a"); !reflect.DeepEqual(dirs, []string{}) {
+		t.Errorf("expected no directories below a leaf directory, got %v", dirs)
+	}
+}